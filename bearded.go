@@ -10,13 +10,13 @@ import (
 	"github.com/bearded-web/bearded/cmd/agent"
 	"github.com/bearded-web/bearded/cmd/dispatcher"
 	"github.com/bearded-web/bearded/cmd/utils"
+	"github.com/bearded-web/bearded/pkg/version"
 )
 
 const (
-	Version = "0.0.1"
-	Author  = "m0sth8"
-	Email   = "m0sth8@gmail.com"
-	Name    = "bearded"
+	Author = "m0sth8"
+	Email  = "m0sth8@gmail.com"
+	Name   = "bearded"
 )
 
 func BeforeHandler(c *cli.Context) error {
@@ -42,14 +42,17 @@ func BeforeHandler(c *cli.Context) error {
 func main() {
 	app := cli.NewApp()
 
-	app.Version = Version
+	app.Version = version.Get().String()
 	app.Author = Author
 	app.Email = Email
 	app.Name = Name
 	app.Commands = []cli.Command{
 		dispatcher.New(),
+		dispatcher.Doctor(),
 		utils.Plugins,
 		utils.Plans,
+		utils.Keys,
+		utils.Seed,
 		agent.New(),
 	}
 
@@ -14,6 +14,7 @@ import (
 	"github.com/bearded-web/bearded/pkg/client"
 	"github.com/bearded-web/bearded/pkg/config"
 	"github.com/bearded-web/bearded/pkg/config/flags"
+	"github.com/bearded-web/bearded/pkg/proxy"
 	"github.com/bearded-web/bearded/pkg/utils"
 	"github.com/bearded-web/bearded/pkg/utils/load"
 )
@@ -60,6 +61,11 @@ func agentAction(cliCtx *cli.Context, api *client.Client, timeout cmd.Timeout) {
 		logrus.Fatal(err)
 	}
 
+	// the api client of the agent uses the default transport
+	if err := proxy.ConfigureDefault(cfg.Proxy); err != nil {
+		logrus.Fatal(err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -2,6 +2,7 @@ package dispatcher
 
 import (
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -17,38 +18,58 @@ import (
 )
 
 func New() cli.Command {
-	cmd := cli.Command{
+	return cli.Command{
 		Name:   "dispatcher",
 		Usage:  "Start Dispatcher",
 		Action: dispatcherAction,
+		Flags:  configFlags(),
+	}
+}
+
+// Doctor checks the config and the environment of the dispatcher, it's run with the same flags
+func Doctor() cli.Command {
+	cmd := cli.Command{
+		Name:   "doctor",
+		Usage:  "Check the dispatcher config, mongodb, email, templates, frontend and agent token",
+		Action: doctorAction,
 		Flags: []cli.Flag{
 			cli.StringFlag{
-				Name:   "config",
-				EnvVar: "BEARDED_CONFIG",
-				Usage:  "path to config",
-			},
-			cli.StringFlag{
-				Name:   "config-format",
-				EnvVar: "BEARDED_CONFIG_FORMAT",
-				Usage:  "Specify config format, by default format is taken from ext",
+				Name:  "email-to",
+				Usage: "send a test message to this address, the email check is skipped if it's empty",
 			},
 		},
 	}
+	cmd.Flags = append(cmd.Flags, configFlags()...)
+	return cmd
+}
+
+func configFlags() []cli.Flag {
+	result := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			EnvVar: "BEARDED_CONFIG",
+			Usage:  "path to config",
+		},
+		cli.StringFlag{
+			Name:   "config-format",
+			EnvVar: "BEARDED_CONFIG_FORMAT",
+			Usage:  "Specify config format, by default format is taken from ext",
+		},
+	}
 	cfg := config.NewDispatcher()
-	cmd.Flags = append(cmd.Flags, flags.GenerateFlags(cfg, flags.Opts{
+	return append(result, flags.GenerateFlags(cfg, flags.Opts{
 		EnvPrefix: "BEARDED",
 	})...)
-	return cmd
 }
 
-func dispatcherAction(cliCtx *cli.Context) {
+// loadConfig from the file and then from flags, flags override the file
+func loadConfig(cliCtx *cli.Context) (*config.Dispatcher, error) {
 	cfg := config.NewDispatcher()
 	if cfgPath := cliCtx.String("config"); cfgPath != "" {
 		logrus.Infof("Load config from %s", cfgPath)
 		err := load.FromFile(cfgPath, cfg)
 		if err != nil {
-			logrus.Fatalf("Couldn't load config: %s", err)
-			return
+			return nil, fmt.Errorf("Couldn't load config: %s", err)
 		}
 	}
 
@@ -56,10 +77,38 @@ func dispatcherAction(cliCtx *cli.Context) {
 	err := flags.ParseFlags(cfg, cliCtx, flags.Opts{
 		EnvPrefix: "BEARDED",
 	})
+	if err != nil {
+		return nil, err
+	}
+	cfg.Debug = cliCtx.GlobalBool("debug")
+	return cfg, nil
+}
+
+func doctorAction(cliCtx *cli.Context) {
+	cfg, err := loadConfig(cliCtx)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-utils.NotifyInterrupt()
+		cancel()
+	}()
+
+	diagnosis := dispatcher.Doctor(ctx, cfg, dispatcher.DoctorOpts{EmailTo: cliCtx.String("email-to")})
+	fmt.Print(diagnosis)
+	if !diagnosis.Ok() {
+		os.Exit(1)
+	}
+}
+
+func dispatcherAction(cliCtx *cli.Context) {
+	cfg, err := loadConfig(cliCtx)
 	if err != nil {
 		logrus.Fatal(err)
 	}
-	if cfg.Debug = cliCtx.GlobalBool("debug"); cfg.Debug {
+	if cfg.Debug {
 		logrus.Info("Debug mode is enabled")
 	}
 	ctx, cancel := context.WithCancel(context.Background())
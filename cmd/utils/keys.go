@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/m0sth8/cli" // use fork until subcommands will be fixed
+
+	"github.com/bearded-web/bearded/pkg/utils"
+)
+
+var Keys = cli.Command{
+	Name:  "keys",
+	Usage: "Helper to rotate session cookie keys",
+	Subcommands: []cli.Command{
+		cli.Command{
+			Name:   "generate",
+			Usage:  "Generate a new hash and block key pair, put it first in api.cookie.keyPairs",
+			Action: keysGenerateAction,
+		},
+	},
+}
+
+// ========= Actions
+
+func keysGenerateAction(ctx *cli.Context) {
+	fmt.Println("api:")
+	fmt.Println("  cookie:")
+	fmt.Println("    keyPairs:")
+	fmt.Printf("    - %s # new hash key\n", utils.RandomString(32))
+	fmt.Printf("    - %s # new block key\n", utils.RandomString(16))
+	fmt.Println("    # previous pairs follow until they are retired")
+}
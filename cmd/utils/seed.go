@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/m0sth8/cli" // use fork until subcommands will be fixed
+	mgo "gopkg.in/mgo.v2"
+
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/seed"
+)
+
+var seedDbFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "mongo-addr",
+		Value:  "127.0.0.1",
+		EnvVar: "BEARDED_SEED_MONGO_ADDR",
+		Usage:  "mongo address, the same as for the dispatcher",
+	},
+	cli.StringFlag{
+		Name:   "mongo-database",
+		Value:  seed.DbPrefix + "bearded",
+		EnvVar: "BEARDED_SEED_MONGO_DATABASE",
+		Usage:  fmt.Sprintf("database name, it should have %s prefix", seed.DbPrefix),
+	},
+}
+
+var Seed = cli.Command{
+	Name:  "seed",
+	Usage: "Helper to fill a development database with fake data",
+	Subcommands: []cli.Command{
+		cli.Command{
+			Name:   "load",
+			Usage:  "Clear previously seeded data and generate it again",
+			Action: seedLoadAction,
+			Flags: append([]cli.Flag{
+				cli.IntFlag{Name: "seed", Value: int(seed.DefaultOpts.Seed), Usage: "the same seed gives the same data"},
+				cli.StringFlag{Name: "password", Value: seed.DefaultOpts.Password, Usage: "password of seeded users"},
+				cli.IntFlag{Name: "users", Value: seed.DefaultOpts.Users},
+				cli.IntFlag{Name: "projects", Value: seed.DefaultOpts.Projects, Usage: "projects of every user"},
+				cli.IntFlag{Name: "targets", Value: seed.DefaultOpts.Targets, Usage: "targets of every project"},
+				cli.IntFlag{Name: "scans", Value: seed.DefaultOpts.Scans, Usage: "scans of every target"},
+				cli.IntFlag{Name: "issues", Value: seed.DefaultOpts.Issues, Usage: "issues of every target"},
+			}, seedDbFlags...),
+		},
+		cli.Command{
+			Name:   "clear",
+			Usage:  "Remove seeded data",
+			Action: seedClearAction,
+			Flags:  seedDbFlags,
+		},
+	},
+}
+
+// ========= Actions
+
+func seedLoadAction(ctx *cli.Context) {
+	mgr, dbName := seedManager(ctx)
+	defer mgr.Close()
+
+	opts := seed.Opts{
+		Seed:     int64(ctx.Int("seed")),
+		Password: ctx.String("password"),
+		Users:    ctx.Int("users"),
+		Projects: ctx.Int("projects"),
+		Targets:  ctx.Int("targets"),
+		Scans:    ctx.Int("scans"),
+		Issues:   ctx.Int("issues"),
+	}
+	result, err := seed.Seed(mgr, dbName, opts)
+	if err != nil {
+		fmt.Printf("Seeding failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created %s\n", result)
+	fmt.Printf("Users are user@%s with password %q, e.g. alice@%s\n", seed.EmailDomain, opts.Password, seed.EmailDomain)
+}
+
+func seedClearAction(ctx *cli.Context) {
+	mgr, dbName := seedManager(ctx)
+	defer mgr.Close()
+
+	removed, err := seed.Clear(mgr, dbName)
+	if err != nil {
+		fmt.Printf("Clearing failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Removed %d seeded objects\n", removed)
+}
+
+func seedManager(ctx *cli.Context) (*manager.Manager, string) {
+	dbName := ctx.String("mongo-database")
+	// the database name is checked before connecting, so production isn't touched even by indexes
+	if err := seed.Check(dbName); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	session, err := mgo.DialWithTimeout(ctx.String("mongo-addr"), 10*time.Second)
+	if err != nil {
+		fmt.Printf("Can't connect to mongo: %v\n", err)
+		os.Exit(1)
+	}
+	mgr := manager.New(session.DB(dbName))
+	if err := mgr.Init(); err != nil {
+		fmt.Printf("Can't initialize the database: %v\n", err)
+		os.Exit(1)
+	}
+	return mgr, dbName
+}
@@ -11,15 +11,25 @@ import (
 type Agent struct {
 	Id     bson.ObjectId `json:"id,omitempty" bson:"_id"` // autogenerated id
 	Name   string        `json:"name"`                    // unique name is usually a hostname
-	Status Status        `json:"status,omitempty" description:"one of [registered|approved|waiting|paused|unavailable|blocked]"`
+	Status Status        `json:"status,omitempty" description:"one of [registered|approved|waiting|paused|unavailable|blocked|retired]"`
 	Type   Type          `json:"type,omitempty" description:"one of [system]"`
 
 	Created time.Time `json:"created,omitempty" description:"when plan is created"`
 	Updated time.Time `json:"updated,omitempty" description:"when plan is updated"`
+
+	LastSeen time.Time `json:"lastSeen,omitempty" bson:"lastSeen" description:"when the agent asked for jobs last time"`
+	Stale    bool      `json:"stale" description:"the agent is offline for a while"`
+	Retired  time.Time `json:"retired,omitempty" bson:"retired,omitempty" description:"when the agent was retired"`
+
+	Capabilities []string `json:"capabilities,omitempty" bson:"capabilities,omitempty" description:"what the agent can run, e.g. docker"`
+	Version      string   `json:"version,omitempty" bson:"version,omitempty" description:"build version of the agent"`
 	// tags is useful for filtering by clouds, server types etc.. f.e {"cloud": ["north"], "memory": ["high"], "cpu": ["low"]}
 	//	Tags map[string][]string
 }
 
+// the agent runs plugins in docker containers
+const CapabilityDocker = "docker"
+
 func New() *Agent {
 	return &Agent{}
 }
@@ -0,0 +1,22 @@
+package agent
+
+// Agents could keep a websocket channel with the dispatcher, jobs are pushed by the dispatcher
+// instead of polling, heartbeats and logs are sent over the same connection.
+
+type ChannelMethod string
+
+const (
+	ChannelJobs      ChannelMethod = "jobs"      // the dispatcher pushes jobs to the agent
+	ChannelHeartbeat ChannelMethod = "heartbeat" // the agent is alive, the dispatcher responds with the agent
+	ChannelLog       ChannelMethod = "log"       // the agent sends a chunk of session logs
+)
+
+type ChannelRequest struct {
+	Method ChannelMethod `json:"method"`
+	Jobs   []*Job        `json:"jobs,omitempty"`
+	Log    *Log          `json:"log,omitempty"`
+}
+
+type ChannelResponse struct {
+	Agent *Agent `json:"agent,omitempty"`
+}
@@ -9,6 +9,7 @@ const (
 	StatusRegistered Status = "registered" // Agent registered in system, but doesn't approved
 	StatusApproved   Status = "approved"
 	StatusBlocked    Status = "blocked" // agent was blocked by some reasons
+	StatusRetired    Status = "retired" // agent was offline too long or deregistered, it doesn't get jobs
 )
 
 var statuses = []interface{}{
@@ -16,6 +17,7 @@ var statuses = []interface{}{
 	StatusRegistered,
 	StatusApproved,
 	StatusBlocked,
+	StatusRetired,
 }
 
 type Type string
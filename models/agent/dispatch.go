@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/scan"
+)
+
+// last seen time is updated once a minute at most, so agents which weren't seen longer are offline
+const OfflineAfter = time.Minute * 3
+
+// why the agent can't take sessions of the scan
+const (
+	RejectOffline = "offline"
+	RejectBlocked = "blocked"
+	RejectRetired = "retired"
+	// the capability name is added after the space
+	RejectCapability = "missing capability"
+)
+
+// Dispatch explains why sessions of the scan aren't taken by agents
+type Dispatch struct {
+	Scan   bson.ObjectId   `json:"scan"`
+	Status scan.ScanStatus `json:"status"`
+	Reason string          `json:"reason,omitempty" description:"why the scan isn't dispatched, empty if it is running or an agent could take it"`
+
+	Capabilities []string     `json:"capabilities,omitempty" description:"what agents need to run plugins of the scan"`
+	Agents       []*Candidate `json:"agents,omitempty" description:"agents with reasons why they can't take the scan, only for admins"`
+}
+
+type Candidate struct {
+	Id           bson.ObjectId `json:"id"`
+	Name         string        `json:"name"`
+	Status       Status        `json:"status"`
+	LastSeen     time.Time     `json:"lastSeen"`
+	Capabilities []string      `json:"capabilities,omitempty"`
+	Working      int           `json:"working" description:"sessions which are run by the agent now, agents run them in parallel"`
+	Rejected     []string      `json:"rejected,omitempty" description:"why the agent can't take the scan, empty if it can"`
+}
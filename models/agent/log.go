@@ -0,0 +1,25 @@
+package agent
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/pkg/pagination"
+)
+
+// Log is a chunk of plugin output sent by the agent while the session is running
+type Log struct {
+	Id      bson.ObjectId `json:"id" bson:"_id"`
+	Agent   bson.ObjectId `json:"agent"`
+	Scan    bson.ObjectId `json:"scan"`
+	Session bson.ObjectId `json:"session"`
+	Data    string        `json:"data"`
+	Size    int           `json:"-" description:"size of data in bytes, used for capping logs"`
+	Created time.Time     `json:"created"`
+}
+
+type LogList struct {
+	pagination.Meta `json:",inline"`
+	Results         []*Log `json:"results"`
+}
@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"encoding/json"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/pkg/pagination"
+)
+
+// Audit events are recorded when someone gains or loses privileges, acts as another user
+// or takes a target out of service, share links are audited on every access
+
+type Type string
+
+const (
+	TypeAdminAdded    Type = "admin_added"
+	TypeAdminRemoved  Type = "admin_removed"
+	TypeMemberAdded   Type = "member_added"
+	TypeMemberRemoved Type = "member_removed"
+	TypeTokenCreated  Type = "token_created"
+	TypeTokenRevoked  Type = "token_revoked"
+
+	TypeImpersonationStarted Type = "impersonation_started"
+	TypeImpersonationStopped Type = "impersonation_stopped"
+	// changes made by the admin while impersonating the user
+	TypeImpersonatedRequest Type = "impersonated_request"
+
+	TypeTargetDeactivated Type = "target_deactivated"
+	TypeTargetReactivated Type = "target_reactivated"
+
+	TypeShareCreated  Type = "share_created"
+	TypeShareRevoked  Type = "share_revoked"
+	TypeShareAccessed Type = "share_accessed"
+
+	TypeResetLinkCreated Type = "reset_link_created"
+
+	TypeSignupChanged Type = "signup_changed"
+)
+
+var Types = []Type{
+	TypeAdminAdded,
+	TypeAdminRemoved,
+	TypeMemberAdded,
+	TypeMemberRemoved,
+	TypeTokenCreated,
+	TypeTokenRevoked,
+	TypeImpersonationStarted,
+	TypeImpersonationStopped,
+	TypeImpersonatedRequest,
+	TypeTargetDeactivated,
+	TypeTargetReactivated,
+	TypeShareCreated,
+	TypeShareRevoked,
+	TypeShareAccessed,
+	TypeResetLinkCreated,
+	TypeSignupChanged,
+}
+
+// It's a hack to show custom type as string in swagger
+func (t Type) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(t))
+}
+
+func (t Type) Enum() []interface{} {
+	result := make([]interface{}, 0, len(Types))
+	for _, v := range Types {
+		result = append(result, v)
+	}
+	return result
+}
+
+func (t Type) Convert(text string) (interface{}, error) {
+	return Type(text), nil
+}
+
+type Event struct {
+	Id      bson.ObjectId `json:"id,omitempty" bson:"_id"`
+	Type    Type          `json:"type"`
+	Created time.Time     `json:"created"`
+
+	Actor   bson.ObjectId `json:"actor,omitempty" bson:",omitempty" description:"user who made the change, empty for changes of the config"`
+	User    bson.ObjectId `json:"user,omitempty" bson:",omitempty" description:"user who gained or lost privileges"`
+	Email   string        `json:"email,omitempty" bson:",omitempty" description:"email of the admin, admins are configured by emails"`
+	Project bson.ObjectId `json:"project,omitempty" bson:",omitempty"`
+	Token   bson.ObjectId `json:"token,omitempty" bson:",omitempty"`
+	Target  bson.ObjectId `json:"target,omitempty" bson:",omitempty"`
+	Share   bson.ObjectId `json:"share,omitempty" bson:",omitempty"`
+	Role    string        `json:"role,omitempty" bson:",omitempty" description:"role of the token"`
+	Request string        `json:"request,omitempty" bson:",omitempty" description:"method and path of the impersonated request"`
+
+	Message string `json:"message"`
+}
+
+type EventList struct {
+	pagination.Meta `json:",inline"`
+	Results         []*Event `json:"results"`
+}
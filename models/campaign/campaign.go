@@ -0,0 +1,51 @@
+package campaign
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/pagination"
+)
+
+// Campaign scans targets of the project with the plan, like a quarterly assessment.
+// Its scans are the scan group with the campaign id.
+type Campaign struct {
+	Id      bson.ObjectId   `json:"id,omitempty" bson:"_id"`
+	Name    string          `json:"name"`
+	Project bson.ObjectId   `json:"project"`
+	Owner   bson.ObjectId   `json:"owner,omitempty"`
+	Plan    bson.ObjectId   `json:"plan"`
+	Targets []bson.ObjectId `json:"targets" description:"scanned targets"`
+	Created time.Time       `json:"created,omitempty"`
+	Updated time.Time       `json:"updated,omitempty"`
+
+	Status *scan.GroupStatus `json:"status,omitempty" bson:"-" description:"statuses of campaign scans, set only for the campaign detail"`
+}
+
+func (c *Campaign) String() string {
+	return c.Id.Hex()
+}
+
+type CampaignList struct {
+	pagination.Meta `json:",inline"`
+	Results         []*Campaign `json:"results"`
+}
+
+// Report rolls up results of campaign scans
+type Report struct {
+	Campaign *Campaign              `json:"campaign"`
+	Issues   map[issue.Severity]int `json:"issues" description:"issues reported by campaign scans by severity"`
+	Targets  []*TargetReport        `json:"targets"`
+}
+
+// TargetReport is the result of the campaign scan of the target
+type TargetReport struct {
+	Target bson.ObjectId          `json:"target"`
+	Scan   bson.ObjectId          `json:"scan"`
+	Status scan.ScanStatus        `json:"status"`
+	Passed *bool                  `json:"passed,omitempty" description:"scan satisfies the scan policy, set for done scans"`
+	Issues map[issue.Severity]int `json:"issues" description:"issues reported by the scan by severity"`
+}
@@ -14,8 +14,9 @@ type Comment struct {
 	Owner   bson.ObjectId `json:"owner" bson:"owner" description:"user who created a comment"`
 	Text    string        `json:"text" description:"raw markdown text"`
 
-	Type Type          `json:"-"`
-	Link bson.ObjectId `json:"-"`
+	Type    Type          `json:"-"`
+	Link    bson.ObjectId `json:"-"`
+	Project bson.ObjectId `json:"-" bson:"project,omitempty"`
 }
 
 type CommentList struct {
@@ -0,0 +1,269 @@
+package compliance
+
+import (
+	"sort"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+// Targets and projects are in scope of compliance frameworks, targets inherit frameworks of their project.
+// Issues are mapped to controls of frameworks by cwe ids of their vulndb types or by canonical classes.
+
+const (
+	FrameworkPci  = "pci"
+	FrameworkSoc2 = "soc2"
+)
+
+type Framework struct {
+	Id       string     `json:"id"`
+	Title    string     `json:"title"`
+	Controls []*Control `json:"controls"`
+}
+
+type Control struct {
+	Id      string        `json:"id"`
+	Title   string        `json:"title"`
+	Cwe     []string      `json:"cwe" description:"cwe ids of issues which violate the control, like 79"`
+	Classes []issue.Class `json:"classes,omitempty" description:"classes of issues without cwes which violate the control"`
+}
+
+var Frameworks = []*Framework{
+	{
+		Id:    FrameworkPci,
+		Title: "PCI DSS 4.0",
+		Controls: []*Control{
+			{
+				Id:      "2.2",
+				Title:   "System components are configured and managed securely",
+				Cwe:     []string{"16", "2", "215", "548", "693", "942", "1004", "614"},
+				Classes: []issue.Class{issue.ClassMisconfig},
+			},
+			{
+				Id:    "4.2.1",
+				Title: "Strong cryptography protects cardholder data during transmission",
+				Cwe:   []string{"295", "311", "319", "326", "327", "523"},
+			},
+			{
+				Id:    "6.2.4",
+				Title: "Software engineering techniques prevent common software attacks",
+				Cwe: []string{"20", "22", "77", "78", "79", "89", "90", "91", "94", "352", "434", "601", "611", "643", "918",
+					"200", "209", "497"},
+				Classes: []issue.Class{issue.ClassXss, issue.ClassSqli, issue.ClassCsrf, issue.ClassRce,
+					issue.ClassPathTraversal, issue.ClassOpenRedirect, issue.ClassInfoLeak},
+			},
+			{
+				Id:      "6.3.3",
+				Title:   "Known security vulnerabilities are addressed by installing patches",
+				Cwe:     []string{"937", "1035", "1104"},
+				Classes: []issue.Class{issue.ClassOutdated},
+			},
+			{
+				Id:      "8.3",
+				Title:   "Strong authentication for users and administrators is established",
+				Cwe:     []string{"287", "307", "384", "521", "613", "798"},
+				Classes: []issue.Class{issue.ClassAuth},
+			},
+		},
+	},
+	{
+		Id:    FrameworkSoc2,
+		Title: "SOC 2",
+		Controls: []*Control{
+			{
+				Id:      "CC6.1",
+				Title:   "Logical access security protects information assets",
+				Cwe:     []string{"284", "285", "287", "306", "307", "521", "639", "798", "862", "863"},
+				Classes: []issue.Class{issue.ClassAuth},
+			},
+			{
+				Id:    "CC6.6",
+				Title: "Security measures protect against threats from sources outside system boundaries",
+				Cwe:   []string{"20", "22", "77", "78", "79", "89", "94", "352", "434", "601", "611", "918"},
+				Classes: []issue.Class{issue.ClassXss, issue.ClassSqli, issue.ClassCsrf, issue.ClassRce,
+					issue.ClassPathTraversal, issue.ClassOpenRedirect},
+			},
+			{
+				Id:    "CC6.7",
+				Title: "Transmission of information is restricted and protected",
+				Cwe:   []string{"295", "311", "319", "326", "327", "523", "614"},
+			},
+			{
+				Id:      "CC7.1",
+				Title:   "Configuration changes and new vulnerabilities are detected",
+				Cwe:     []string{"16", "548", "693", "937", "942", "1035", "1104"},
+				Classes: []issue.Class{issue.ClassMisconfig, issue.ClassOutdated},
+			},
+			{
+				Id:      "C1.1",
+				Title:   "Confidential information is protected",
+				Cwe:     []string{"200", "209", "497", "532", "538"},
+				Classes: []issue.Class{issue.ClassInfoLeak},
+			},
+		},
+	},
+}
+
+// Get returns the framework by id, nil if it's unknown
+func Get(id string) *Framework {
+	for _, f := range Frameworks {
+		if f.Id == id {
+			return f
+		}
+	}
+	return nil
+}
+
+// Ids of known frameworks
+func Ids() []string {
+	ids := make([]string, 0, len(Frameworks))
+	for _, f := range Frameworks {
+		ids = append(ids, f.Id)
+	}
+	return ids
+}
+
+// Match returns controls which are violated by the issue with the cwe ids and the class,
+// the class is used only if the issue doesn't have cwes
+func (f *Framework) Match(cwes []string, class issue.Class) []*Control {
+	result := []*Control{}
+	for _, c := range f.Controls {
+		if c.matches(cwes, class) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func (c *Control) matches(cwes []string, class issue.Class) bool {
+	if len(cwes) > 0 {
+		for _, cwe := range cwes {
+			for _, val := range c.Cwe {
+				if cwe == val {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, val := range c.Classes {
+		if class != "" && class == val {
+			return true
+		}
+	}
+	return false
+}
+
+// Report lists in-scope targets of the framework and their open issues by violated controls
+type Report struct {
+	Framework string           `json:"framework"`
+	Title     string           `json:"title"`
+	Project   bson.ObjectId    `json:"project,omitempty" description:"empty for the report across all available projects"`
+	Targets   []*Asset         `json:"targets" description:"targets in scope of the framework"`
+	Controls  []*ControlIssues `json:"controls" description:"all controls of the framework, controls without issues too"`
+	Unmapped  []*ReportedIssue `json:"unmapped" description:"open issues of in-scope targets which aren't mapped to any control"`
+	Created   time.Time        `json:"created"`
+
+	framework *Framework
+	assets    map[bson.ObjectId]*Asset
+	controls  map[string]*ControlIssues
+	affected  map[string]map[bson.ObjectId]bool
+}
+
+type Asset struct {
+	Id        bson.ObjectId  `json:"id"`
+	Project   bson.ObjectId  `json:"project"`
+	Addr      string         `json:"addr,omitempty"`
+	Inherited bool           `json:"inherited,omitempty" description:"the target is in scope because of its project"`
+	Issues    int            `json:"issues" description:"number of open issues"`
+	Severity  issue.Severity `json:"severity,omitempty" description:"the highest severity of open issues"`
+}
+
+type ControlIssues struct {
+	Id      string           `json:"id"`
+	Title   string           `json:"title"`
+	Targets int              `json:"targets" description:"number of affected targets"`
+	Issues  []*ReportedIssue `json:"issues"`
+}
+
+type ReportedIssue struct {
+	Id       bson.ObjectId  `json:"id"`
+	Target   bson.ObjectId  `json:"target"`
+	Summary  string         `json:"summary"`
+	Severity issue.Severity `json:"severity"`
+	VulnType int            `json:"vulnType,omitempty"`
+	Cwe      []string       `json:"cwe,omitempty"`
+	Class    issue.Class    `json:"class,omitempty"`
+}
+
+// NewReport returns the empty report of the framework with all its controls,
+// targets and issues are added one by one, so issues of large scopes aren't kept in memory as documents.
+func NewReport(f *Framework) *Report {
+	r := &Report{
+		Framework: f.Id,
+		Title:     f.Title,
+		Targets:   []*Asset{},
+		Controls:  make([]*ControlIssues, 0, len(f.Controls)),
+		Unmapped:  []*ReportedIssue{},
+		framework: f,
+		assets:    map[bson.ObjectId]*Asset{},
+		controls:  map[string]*ControlIssues{},
+		affected:  map[string]map[bson.ObjectId]bool{},
+	}
+	for _, c := range f.Controls {
+		r.controls[c.Id] = &ControlIssues{Id: c.Id, Title: c.Title, Issues: []*ReportedIssue{}}
+		r.affected[c.Id] = map[bson.ObjectId]bool{}
+		r.Controls = append(r.Controls, r.controls[c.Id])
+	}
+	return r
+}
+
+// AddTarget adds the in-scope target to the report
+func (r *Report) AddTarget(asset *Asset) {
+	r.assets[asset.Id] = asset
+	r.Targets = append(r.Targets, asset)
+}
+
+// AddIssue counts the open issue for its target and adds it to violated controls or to unmapped issues,
+// issues of targets which aren't added are skipped
+func (r *Report) AddIssue(obj *ReportedIssue) {
+	asset := r.assets[obj.Target]
+	if asset == nil {
+		return
+	}
+	if asset.Issues == 0 || obj.Severity.Level() > asset.Severity.Level() {
+		asset.Severity = obj.Severity
+	}
+	asset.Issues++
+	matched := r.framework.Match(obj.Cwe, obj.Class)
+	if len(matched) == 0 {
+		r.Unmapped = append(r.Unmapped, obj)
+		return
+	}
+	for _, c := range matched {
+		r.controls[c.Id].Issues = append(r.controls[c.Id].Issues, obj)
+		r.affected[c.Id][obj.Target] = true
+	}
+}
+
+// Done counts affected targets of controls and sorts issues, the most severe go first
+func (r *Report) Done() {
+	for _, c := range r.Controls {
+		c.Targets = len(r.affected[c.Id])
+		sort.Sort(bySeverity(c.Issues))
+	}
+	sort.Sort(bySeverity(r.Unmapped))
+}
+
+type bySeverity []*ReportedIssue
+
+func (s bySeverity) Len() int      { return len(s) }
+func (s bySeverity) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s bySeverity) Less(i, j int) bool {
+	if a, b := s[i].Severity.Level(), s[j].Severity.Level(); a != b {
+		return a > b
+	}
+	return s[i].Id < s[j].Id
+}
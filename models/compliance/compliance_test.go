@@ -0,0 +1,57 @@
+package compliance
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+func TestReport(t *testing.T) {
+	pci := Get(FrameworkPci)
+	require.NotNil(t, pci)
+	first, second, other := bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()
+
+	r := NewReport(pci)
+	require.Len(t, r.Controls, len(pci.Controls), "controls without issues are listed too")
+	r.AddTarget(&Asset{Id: first})
+	r.AddTarget(&Asset{Id: second, Inherited: true})
+
+	xss := &ReportedIssue{Id: bson.NewObjectId(), Target: first, Severity: issue.SeverityLow, Cwe: []string{"79"}}
+	sqli := &ReportedIssue{Id: bson.NewObjectId(), Target: second, Severity: issue.SeverityHigh, Class: issue.ClassSqli}
+	tls := &ReportedIssue{Id: bson.NewObjectId(), Target: first, Severity: issue.SeverityMedium, Cwe: []string{"319"}}
+	unmapped := &ReportedIssue{Id: bson.NewObjectId(), Target: first, Severity: issue.SeverityInfo, Cwe: []string{"1"}}
+	r.AddIssue(xss)
+	r.AddIssue(sqli)
+	r.AddIssue(tls)
+	r.AddIssue(unmapped)
+	r.AddIssue(&ReportedIssue{Id: bson.NewObjectId(), Target: other, Severity: issue.SeverityHigh, Cwe: []string{"79"}})
+	r.Done()
+
+	require.Equal(t, 3, r.Targets[0].Issues)
+	require.Equal(t, issue.SeverityMedium, r.Targets[0].Severity, "the highest severity is kept for any order of issues")
+	require.Equal(t, 1, r.Targets[1].Issues)
+	require.Equal(t, issue.SeverityHigh, r.Targets[1].Severity)
+
+	controls := map[string]*ControlIssues{}
+	for _, c := range r.Controls {
+		controls[c.Id] = c
+	}
+	require.Equal(t, []*ReportedIssue{sqli, xss}, controls["6.2.4"].Issues, "the most severe issues go first, issues of other targets are skipped")
+	require.Equal(t, 2, controls["6.2.4"].Targets)
+	require.Equal(t, []*ReportedIssue{tls}, controls["4.2.1"].Issues)
+	require.Equal(t, 1, controls["4.2.1"].Targets)
+	require.Empty(t, controls["8.3"].Issues)
+	require.Equal(t, 0, controls["8.3"].Targets)
+	require.Equal(t, []*ReportedIssue{unmapped}, r.Unmapped)
+}
+
+func TestFrameworkMatch(t *testing.T) {
+	pci := Get(FrameworkPci)
+	require.Len(t, pci.Match([]string{"79"}, issue.ClassAuth), 1, "the class is ignored if the issue has cwes")
+	require.Equal(t, "8.3", pci.Match(nil, issue.ClassAuth)[0].Id)
+	require.Empty(t, pci.Match(nil, ""))
+	require.Nil(t, Get("unknown"))
+}
@@ -7,6 +7,7 @@ import (
 
 	"gopkg.in/mgo.v2/bson"
 
+	"github.com/bearded-web/bearded/models/issue"
 	"github.com/bearded-web/bearded/models/scan"
 	"github.com/bearded-web/bearded/models/target"
 	"github.com/bearded-web/bearded/models/tech"
@@ -16,8 +17,12 @@ import (
 type ItemType string
 
 const (
-	TypeComment ItemType = "comment"
-	TypeScan    ItemType = "scan"
+	TypeComment  ItemType = "comment"
+	TypeScan     ItemType = "scan"
+	TypeMerge    ItemType = "merge"
+	TypePause    ItemType = "pause"
+	TypeResume   ItemType = "resume"
+	TypeSeverity ItemType = "severity"
 )
 
 // It's a hack to show custom type as string in swagger
@@ -26,7 +31,7 @@ func (t ItemType) MarshalJSON() ([]byte, error) {
 }
 
 func (t ItemType) Enum() []interface{} {
-	return []interface{}{TypeScan, TypeComment}
+	return []interface{}{TypeScan, TypeComment, TypeMerge, TypePause, TypeResume, TypeSeverity}
 }
 
 func (t ItemType) Convert(text string) (interface{}, error) {
@@ -45,9 +50,23 @@ type FeedItem struct {
 
 	// data for scan types
 	ScanId        bson.ObjectId         `json:"-" bson:"scanid,omitempty"`
-	Scan          *scan.Scan            `json:"scan,omitempty" description:"scan shows only for type: scan"`
+	Scan          *scan.Scan            `json:"scan,omitempty" description:"scan shows only for types: scan, pause, resume"`
 	SummaryReport *target.SummaryReport `json:"summaryReport,omitempty" bson:"summaryReport" description:"shows only for type: scan"`
 	Techs         []*tech.Tech          `json:"techs,omitempty" bson:"techs" description:"shows only for type: scan"`
+
+	// data for merge types
+	Issue  bson.ObjectId   `json:"issue,omitempty" bson:"issue,omitempty" description:"issue which others were merged into, shows only for type: merge"`
+	Merged []bson.ObjectId `json:"merged,omitempty" bson:"merged,omitempty" description:"ids of merged issues, shows only for type: merge"`
+
+	// data for severity types, the issue field is used too
+	Severity *SeverityChange `json:"severity,omitempty" bson:"severity,omitempty" description:"shows only for type: severity"`
+}
+
+// SeverityChange of the issue after its vulndb entry is changed
+type SeverityChange struct {
+	Vuln int            `json:"vuln" description:"vulndb id"`
+	From issue.Severity `json:"from"`
+	To   issue.Severity `json:"to"`
 }
 
 type Feed struct {
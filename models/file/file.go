@@ -3,6 +3,8 @@ package file
 import (
 	"io"
 
+	"gopkg.in/mgo.v2/bson"
+
 	"github.com/bearded-web/bearded/pkg/utils"
 )
 
@@ -12,6 +14,10 @@ type Meta struct {
 	Size        int    `json:"size,omitempty"`
 	ContentType string `json:"contentType"`
 	MD5         string `json:"md5,omitempty"`
+	Thumbnail   string `json:"thumbnail,omitempty" description:"id of the image thumbnail file"`
+
+	Owner   bson.ObjectId `json:"owner,omitempty" bson:"owner,omitempty" description:"user who uploaded the file"`
+	Project bson.ObjectId `json:"project,omitempty" bson:"project,omitempty" description:"project of the issue, report or target which the file is attached to"`
 }
 
 type File struct {
@@ -22,3 +28,18 @@ type File struct {
 func UniqueFileId() string {
 	return utils.UuidV4String()
 }
+
+// Ids returns ids of files and their thumbnails
+func Ids(metas ...*Meta) []string {
+	ids := []string{}
+	for _, meta := range metas {
+		if meta == nil {
+			continue
+		}
+		ids = append(ids, meta.Id)
+		if meta.Thumbnail != "" {
+			ids = append(ids, meta.Thumbnail)
+		}
+	}
+	return ids
+}
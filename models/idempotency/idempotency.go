@@ -0,0 +1,25 @@
+package idempotency
+
+import (
+	"net/http"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Record keeps the response of a request made with Idempotency-Key header,
+// so the same request could be replayed without creating duplicates.
+type Record struct {
+	Id      bson.ObjectId `json:"id,omitempty" bson:"_id"`
+	User    bson.ObjectId `json:"user"`
+	Key     string        `json:"key"`
+	Scope   string        `json:"scope" description:"http method and path of the original request"`
+	Created time.Time     `json:"created,omitempty"`
+	Updated time.Time     `json:"updated,omitempty"`
+
+	// response is empty until the original request is finished
+	Completed bool        `json:"completed"`
+	Status    int         `json:"status,omitempty"`
+	Header    http.Header `json:"header,omitempty"`
+	Body      []byte      `json:"-"`
+}
@@ -0,0 +1,70 @@
+package incident
+
+import (
+	"encoding/json"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/pkg/pagination"
+)
+
+// Incidents are operational errors of bearded itself, like offline agents or crashed sessions.
+// They aren't findings of scans, so they go to ops instead of project members.
+
+type Type string
+
+const (
+	TypeAgentOffline   Type = "agent_offline"
+	TypeAgentRetired   Type = "agent_retired"
+	TypeSessionFailed  Type = "session_failed" // session crashed or the plugin returned an error
+	TypeSchedulerError Type = "scheduler_error"
+	TypePluginTimeout  Type = "plugin_timeout" // plugin exceeded the step timeout, the scan continued without its results
+	TypeScanFailed     Type = "scan_failed"    // unattended scan is failed or no agent can take it, the owner is notified too
+)
+
+var Types = []Type{
+	TypeAgentOffline,
+	TypeAgentRetired,
+	TypeSessionFailed,
+	TypeSchedulerError,
+	TypePluginTimeout,
+	TypeScanFailed,
+}
+
+// It's a hack to show custom type as string in swagger
+func (t Type) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(t))
+}
+
+func (t Type) Enum() []interface{} {
+	result := make([]interface{}, 0, len(Types))
+	for _, v := range Types {
+		result = append(result, v)
+	}
+	return result
+}
+
+func (t Type) Convert(text string) (interface{}, error) {
+	return Type(text), nil
+}
+
+type Incident struct {
+	Id      bson.ObjectId `json:"id,omitempty" bson:"_id"`
+	Type    Type          `json:"type"`
+	Created time.Time     `json:"created"`
+
+	Agent   bson.ObjectId `json:"agent,omitempty" bson:",omitempty"`
+	Project bson.ObjectId `json:"project,omitempty" bson:",omitempty"`
+	Scan    bson.ObjectId `json:"scan,omitempty" bson:",omitempty"`
+	Session bson.ObjectId `json:"session,omitempty" bson:",omitempty"`
+	Plugin  string        `json:"plugin,omitempty" bson:",omitempty" description:"plugin name and version"`
+
+	Error   string `json:"error,omitempty" bson:",omitempty" description:"original error for triage"`
+	Message string `json:"message"`
+}
+
+type IncidentList struct {
+	pagination.Meta `json:",inline"`
+	Results         []*Incident `json:"results"`
+}
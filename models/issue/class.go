@@ -0,0 +1,100 @@
+package issue
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Class is a canonical vulnerability class, plugins name the same classes differently
+type Class string
+
+const (
+	ClassXss           = Class("xss")
+	ClassSqli          = Class("sqli")
+	ClassCsrf          = Class("csrf")
+	ClassRce           = Class("rce")
+	ClassPathTraversal = Class("path-traversal")
+	ClassOpenRedirect  = Class("open-redirect")
+	ClassAuth          = Class("auth")
+	ClassInfoLeak      = Class("info-leak")
+	ClassMisconfig     = Class("misconfig")
+	ClassOutdated      = Class("outdated")
+	ClassOther         = Class("other")
+)
+
+var classes = []interface{}{
+	ClassXss,
+	ClassSqli,
+	ClassCsrf,
+	ClassRce,
+	ClassPathTraversal,
+	ClassOpenRedirect,
+	ClassAuth,
+	ClassInfoLeak,
+	ClassMisconfig,
+	ClassOutdated,
+	ClassOther,
+}
+
+// names used by known plugins, lowercased
+var classAliases = map[string]Class{
+	"cross-site scripting":       ClassXss,
+	"cross site scripting":       ClassXss,
+	"sql injection":              ClassSqli,
+	"sql-injection":              ClassSqli,
+	"sqlinjection":               ClassSqli,
+	"cross-site request forgery": ClassCsrf,
+	"command injection":          ClassRce,
+	"os commanding":              ClassRce,
+	"code execution":             ClassRce,
+	"remote code execution":      ClassRce,
+	"rfi":                        ClassRce,
+	"upload":                     ClassRce,
+	"local file inclusion":       ClassPathTraversal,
+	"traversal":                  ClassPathTraversal,
+	"lfi":                        ClassPathTraversal,
+	"path traversal":             ClassPathTraversal,
+	"directory traversal":        ClassPathTraversal,
+	"unvalidated redirect":       ClassOpenRedirect,
+	"open redirect":              ClassOpenRedirect,
+	"redirect":                   ClassOpenRedirect,
+	"authentication":             ClassAuth,
+	"authbypass":                 ClassAuth,
+	"bypass":                     ClassAuth,
+	"information disclosure":     ClassInfoLeak,
+	"information leak":           ClassInfoLeak,
+	"fpd":                        ClassInfoLeak,
+	"misconfiguration":           ClassMisconfig,
+	"outdated":                   ClassOutdated,
+	"vulnerable component":       ClassOutdated,
+}
+
+// It's a hack to show custom type as string in swagger
+func (t Class) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(t))
+}
+
+func (t Class) Enum() []interface{} {
+	return classes
+}
+
+func (t Class) Convert(text string) (interface{}, error) {
+	return Class(text), nil
+}
+
+// ClassOf returns the canonical class for a plugin specific name, unknown names are other
+func ClassOf(name string) Class {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return ""
+	}
+	for _, c := range classes {
+		if c.(Class) == Class(name) {
+			return Class(name)
+		}
+	}
+	if c, ok := classAliases[name]; ok {
+		return c
+	}
+	return ClassOther
+}
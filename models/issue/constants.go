@@ -12,19 +12,12 @@ const (
 	SeverityError  = Severity("error")
 )
 
-var severities = []interface{}{
-	SeverityInfo,
-	SeverityLow,
-	SeverityMedium,
-	SeverityHigh,
-	SeverityError,
-}
-
 // It's a hack to show custom type as string in swagger
 func (t Severity) MarshalJSON() ([]byte, error) {
 	return json.Marshal(string(t))
 }
 
+// Enum returns severities of the current scheme and error
 func (t Severity) Enum() []interface{} {
 	return severities
 }
@@ -33,6 +26,20 @@ func (t Severity) Convert(text string) (interface{}, error) {
 	return Severity(text), nil
 }
 
+// Level is used to compare severities, higher is more dangerous.
+// Error isn't a vulnerability, so it has zero level like unknown severities.
+func (t Severity) Level() int {
+	return severityLevels[t]
+}
+
+// LevelSeverity returns the severity of the level in the current scheme, empty for unknown levels
+func LevelSeverity(level int) Severity {
+	if level < 1 || level > len(Severities) {
+		return ""
+	}
+	return Severities[level-1]
+}
+
 //
 //type Affect string
 //
@@ -52,6 +59,9 @@ const (
 	ActivityTrue      = ActivityType("true")  // set to true
 	ActivityResolved  = ActivityType("resolved")
 	ActivityReopened  = ActivityType("reopened")
+	ActivityMerged    = ActivityType("merged") // other issues were merged into this one
+	// raw output of the report is purged by the output retention, the report link is kept as a tombstone
+	ActivityOutputPurged = ActivityType("output_purged")
 )
 
 var activities = []interface{}{
@@ -61,6 +71,9 @@ var activities = []interface{}{
 	ActivityUnmuted,
 	ActivityFalse,
 	ActivityTrue,
+	ActivityResolved,
+	ActivityMerged,
+	ActivityOutputPurged,
 }
 
 // It's a hack to show custom type as string in swagger
@@ -3,9 +3,11 @@ package issue
 import (
 	"crypto/md5"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/bearded-web/bearded/models/file"
 	"github.com/bearded-web/bearded/pkg/pagination"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -24,11 +26,17 @@ type Issue struct {
 	UniqId     string       `json:"uniqId,omitempty" bson:"uniqId" description:"id for merging similar issues"`
 	Summary    string       `json:"summary"`
 	VulnType   int          `json:"vulnType,omitempty" bson:"vulnType" description:"vulnerability type from vulndb"`
+	Class      Class        `json:"class,omitempty" bson:"class,omitempty" description:"canonical vulnerability class, set by normalization"`
 	Severity   Severity     `json:"severity"`
+	Cvss       float64      `json:"cvss,omitempty" bson:"cvss,omitempty" description:"cvss base score, used if the severity isn't in the scheme"`
 	References []*Reference `json:"references,omitempty" bson:"references" description:"information about vulnerability"`
 	Extras     []*Extra     `json:"extras,omitempty" bson:"extras" description:"information about vulnerability, deprecated"`
 	Desc       string       `json:"desc,omitempty"`
 	Vector     *Vector      `json:"vector,omitempty"`
+	// evidence uploaded by plugin, e.g. screenshots or http dumps
+	Attachments []*file.Meta `json:"attachments,omitempty" bson:"attachments,omitempty" description:"files with evidence"`
+	// plugin specific fields, plugin adapters map known ones to the fields above and keep the rest
+	Raw map[string]interface{} `json:"raw,omitempty" bson:"raw,omitempty" description:"plugin specific fields which aren't mapped"`
 	//	Affect   Affect   `json:"affect,omitempty" description:"who is affected by the issue?"`
 }
 
@@ -66,6 +74,15 @@ type Report struct {
 	Report      bson.ObjectId `json:"report" description:"report id"`
 	Scan        bson.ObjectId `json:"scan,omitempty" description:"scan id"`
 	ScanSession bson.ObjectId `json:"scanSession,omitempty" bson:"scanSession" description:"scan session id"`
+	Plugin      string        `json:"plugin,omitempty" bson:"plugin,omitempty" description:"plugin which reported the issue, name:version"`
+}
+
+// Remediation is guidance for fixing the issue, it's rendered from the matching template
+// when the issue is created and could be edited for the issue
+type Remediation struct {
+	Template bson.ObjectId `json:"template,omitempty" bson:"template,omitempty" description:"template the text is rendered from"`
+	Text     string        `json:"text"`
+	Edited   bool          `json:"edited,omitempty" bson:"edited,omitempty" description:"the text is edited for the issue, template changes don't override it"`
 }
 
 type Activity struct {
@@ -74,6 +91,16 @@ type Activity struct {
 
 	User   bson.ObjectId `json:"user,omitempty" bson:",omitempty" description:"who did the activity"`
 	Report *Report       `json:"report,omitempty" description:"link to report for reported activity"`
+	Note   string        `json:"note,omitempty" bson:",omitempty" description:"details of system activities, like what is purged"`
+}
+
+// Merged keeps ids of the issue which was merged into another one,
+// so old links and new reports with the same uniqId lead to the result of merging
+type Merged struct {
+	Id      bson.ObjectId `json:"id" description:"id of the merged issue"`
+	Target  bson.ObjectId `json:"target"`
+	UniqId  string        `json:"uniqId,omitempty" bson:"uniqId"`
+	Created time.Time     `json:"created" description:"when the issue was merged"`
 }
 
 type TargetIssue struct {
@@ -82,8 +109,21 @@ type TargetIssue struct {
 	Project    bson.ObjectId `json:"project"`
 	Created    time.Time     `json:"created,omitempty" description:"when issue is created"`
 	Updated    time.Time     `json:"updated,omitempty" description:"when issue is updated"`
+	Version    int           `json:"version" description:"incremented on every update, send it back with If-Match header"`
 	ResolvedAt time.Time     `json:"resolvedAt,omitempty" bson:"resolvedAt" description:"resolved time"`
 	Activities []*Activity   `json:"activities,omitempty"`
+	Tags       []string      `json:"tags,omitempty" bson:"tags,omitempty" description:"key or key=value labels"`
+	Merged     []*Merged     `json:"merged,omitempty" bson:"merged,omitempty" description:"issues merged into this one"`
+	Origin     *Report       `json:"origin,omitempty" bson:"origin,omitempty" description:"the first report of the issue, empty for issues created by users"`
+	LastSeen   time.Time     `json:"lastSeen,omitempty" bson:"lastSeen,omitempty" description:"when the issue is reported the last time"`
+	Missed     int           `json:"missed,omitempty" bson:"missed,omitempty" description:"consecutive scans of the target which didn't report the issue, it's reset when the issue is reported"`
+	Baseline   bson.ObjectId `json:"baseline,omitempty" bson:"baseline,omitempty" description:"id of the last project baseline which took the issue"`
+	// severity level for sorting, it's set by the issue manager
+	Level int `json:"-" bson:"level"`
+	// set when a user changes the severity, such issues keep it on vulndb updates
+	SeverityOverride bool `json:"severityOverride,omitempty" bson:"severityOverride,omitempty" description:"severity is set by a user"`
+	// guidance for fixing, empty if there is no matching template
+	Remediation *Remediation `json:"remediation,omitempty" bson:"remediation,omitempty"`
 
 	// usually this field is taken from the last report
 	Issue  `json:",inline" bson:",inline"`
@@ -91,25 +131,155 @@ type TargetIssue struct {
 }
 
 func (i *TargetIssue) AddUserReportActivity(userId bson.ObjectId) {
+	i.LastSeen = time.Now().UTC()
 	i.Activities = append(i.Activities, &Activity{
-		Created: time.Now().UTC(),
+		Created: i.LastSeen,
 		Type:    ActivityReported,
 		User:    userId,
 	})
 }
 
-func (i *TargetIssue) AddReportActivity(reportId, scanId, sessionId bson.ObjectId) {
+func (i *TargetIssue) AddReportActivity(reportId, scanId, sessionId bson.ObjectId, plugin string) {
+	i.LastSeen = time.Now().UTC()
 	i.Activities = append(i.Activities, &Activity{
-		Created: time.Now().UTC(),
+		Created: i.LastSeen,
 		Type:    ActivityReported,
 		Report: &Report{
 			Report:      reportId,
 			Scan:        scanId,
 			ScanSession: sessionId,
+			Plugin:      plugin,
 		},
 	})
+	i.SetOrigin()
+}
+
+// HasReport returns true if the issue has the reported activity of the report
+func (i *TargetIssue) HasReport(reportId bson.ObjectId) bool {
+	for _, act := range i.Activities {
+		if act.Type == ActivityReported && act.Report != nil && act.Report.Report == reportId {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve the issue by the system, e.g. when it isn't reported again
+func (i *TargetIssue) Resolve(now time.Time) {
+	i.Resolved = true
+	i.ResolvedAt = now
+	i.Activities = append(i.Activities, &Activity{
+		Created: now,
+		Type:    ActivityResolved,
+	})
 }
 
+// Names of plugins which reported the issue, without versions
+func (i *TargetIssue) ReportPlugins() []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, act := range i.Activities {
+		if act.Type != ActivityReported || act.Report == nil || act.Report.Plugin == "" {
+			continue
+		}
+		name := strings.SplitN(act.Report.Plugin, ":", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Set origin from the first reported activity, issues created before origins were kept get it on the next report
+func (i *TargetIssue) SetOrigin() {
+	if i.Origin != nil {
+		return
+	}
+	for _, act := range i.Activities {
+		if act.Type == ActivityReported && act.Report != nil {
+			origin := *act.Report
+			i.Origin = &origin
+			return
+		}
+	}
+}
+
+// The first reported activity, it has no report if the issue is created by a user
+func (i *TargetIssue) FirstReported() *Activity {
+	for _, act := range i.Activities {
+		if act.Type == ActivityReported {
+			return act
+		}
+	}
+	return nil
+}
+
+// Time of the last reported activity, zero if the issue was never reported
+func (i *TargetIssue) GetLastSeen() time.Time {
+	var last time.Time
+	for _, act := range i.Activities {
+		if act.Type == ActivityReported && act.Created.After(last) {
+			last = act.Created
+		}
+	}
+	return last
+}
+
+// Add attachments which the issue doesn't have yet, returns true if any is added
+func (i *TargetIssue) AddAttachments(files ...*file.Meta) bool {
+	added := false
+outer:
+	for _, f := range files {
+		if f == nil || f.Id == "" {
+			continue
+		}
+		for _, existed := range i.Attachments {
+			if existed.Id == f.Id {
+				continue outer
+			}
+		}
+		i.Attachments = append(i.Attachments, f)
+		added = true
+	}
+	return added
+}
+
+// Merge other issues into this one. Activities, attachments and merged ids are kept,
+// the earliest creation time and the latest report time are used.
+func (i *TargetIssue) Merge(userId bson.ObjectId, others ...*TargetIssue) {
+	now := time.Now().UTC()
+	for _, other := range others {
+		if other.Created.Before(i.Created) {
+			i.Created = other.Created
+		}
+		if other.LastSeen.After(i.LastSeen) {
+			i.LastSeen = other.LastSeen
+		}
+		i.Activities = append(i.Activities, other.Activities...)
+		i.AddAttachments(other.Attachments...)
+		i.Merged = append(i.Merged, other.Merged...)
+		i.Merged = append(i.Merged, &Merged{
+			Id:      other.Id,
+			Target:  other.Target,
+			UniqId:  other.UniqId,
+			Created: now,
+		})
+	}
+	sort.Stable(activitiesByCreated(i.Activities))
+	i.Activities = append(i.Activities, &Activity{
+		Created: now,
+		Type:    ActivityMerged,
+		User:    userId,
+	})
+}
+
+type activitiesByCreated []*Activity
+
+func (a activitiesByCreated) Len() int           { return len(a) }
+func (a activitiesByCreated) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a activitiesByCreated) Less(i, j int) bool { return a[i].Created.Before(a[j].Created) }
+
 type TargetIssueList struct {
 	pagination.Meta `json:",inline"`
 	Results         []*TargetIssue `json:"results"`
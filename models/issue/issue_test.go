@@ -0,0 +1,19 @@
+package issue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestTargetIssueHasReport(t *testing.T) {
+	reportId := bson.NewObjectId()
+	obj := &TargetIssue{}
+	require.False(t, obj.HasReport(reportId))
+	obj.AddUserReportActivity(bson.NewObjectId())
+	obj.AddReportActivity(bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId(), "barbudo/nmap:0.0.1")
+	require.False(t, obj.HasReport(reportId))
+	obj.AddReportActivity(reportId, bson.NewObjectId(), bson.NewObjectId(), "barbudo/nmap:0.0.1")
+	require.True(t, obj.HasReport(reportId))
+}
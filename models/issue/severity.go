@@ -0,0 +1,132 @@
+package issue
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SeverityLevel describes one severity of the scheme
+type SeverityLevel struct {
+	Name    Severity   `json:"name"`
+	Label   string     `json:"label" description:"human readable name"`
+	MinCvss float64    `json:"minCvss" description:"issues with cvss score from this value are mapped to the severity"`
+	Aliases []Severity `json:"aliases,omitempty" description:"severities reported by plugins which are mapped to this one"`
+}
+
+// Scheme is a list of severities from the least to the most dangerous
+type Scheme []*SeverityLevel
+
+// DefaultScheme has the severities which were always used, scores are taken from CVSS v3 ratings
+var DefaultScheme = Scheme{
+	{Name: SeverityInfo, Label: "Info", MinCvss: 0, Aliases: []Severity{"informational", "none"}},
+	{Name: SeverityLow, Label: "Low", MinCvss: 0.1},
+	{Name: SeverityMedium, Label: "Medium", MinCvss: 4.0, Aliases: []Severity{"moderate"}},
+	{Name: SeverityHigh, Label: "High", MinCvss: 7.0, Aliases: []Severity{"critical"}},
+}
+
+// The current scheme, it's set on start and considered read only after that
+var (
+	scheme         Scheme
+	severityLevels map[Severity]int
+	severityNames  map[Severity]Severity // lowercased names and aliases to the severity
+	severities     []interface{}
+
+	// Severities of the current scheme from the least to the most dangerous
+	Severities []Severity
+)
+
+func init() {
+	if err := SetScheme(DefaultScheme); err != nil {
+		panic(err)
+	}
+}
+
+// Check that the scheme has unique names and aliases, and its scores grow with severity
+func (s Scheme) Validate() error {
+	if len(s) == 0 {
+		return fmt.Errorf("severity scheme is empty")
+	}
+	names := map[Severity]bool{SeverityError: true}
+	for i, level := range s {
+		if level.Name == "" {
+			return fmt.Errorf("severity %d has empty name", i)
+		}
+		for _, name := range append([]Severity{level.Name}, level.Aliases...) {
+			name = Severity(strings.ToLower(string(name)))
+			if names[name] {
+				return fmt.Errorf("severity %q is used twice or reserved", name)
+			}
+			names[name] = true
+		}
+		if level.MinCvss < 0 || level.MinCvss > 10 {
+			return fmt.Errorf("severity %s min cvss should be from 0 to 10", level.Name)
+		}
+		if i > 0 && level.MinCvss <= s[i-1].MinCvss {
+			return fmt.Errorf("severity %s min cvss should be greater than %s one", level.Name, s[i-1].Name)
+		}
+	}
+	return nil
+}
+
+// SetScheme replaces the current scheme, it isn't safe to call it while the scheme is used
+func SetScheme(s Scheme) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	scheme = s
+	severityLevels = map[Severity]int{}
+	severityNames = map[Severity]Severity{}
+	severities = []interface{}{}
+	Severities = []Severity{}
+	for i, level := range s {
+		if level.Label == "" {
+			level.Label = string(level.Name)
+		}
+		severityLevels[level.Name] = i + 1
+		severityNames[Severity(strings.ToLower(string(level.Name)))] = level.Name
+		for _, alias := range level.Aliases {
+			severityNames[Severity(strings.ToLower(string(alias)))] = level.Name
+		}
+		severities = append(severities, level.Name)
+		Severities = append(Severities, level.Name)
+	}
+	severities = append(severities, SeverityError)
+	return nil
+}
+
+func GetScheme() Scheme {
+	return scheme
+}
+
+// Find the severity of the current scheme by its name or alias, case insensitive
+func MapSeverity(raw Severity) (Severity, bool) {
+	sev, ok := severityNames[Severity(strings.ToLower(strings.TrimSpace(string(raw))))]
+	return sev, ok
+}
+
+// Find the severity of the current scheme for the cvss score
+func CvssSeverity(score float64) Severity {
+	i := sort.Search(len(scheme), func(i int) bool { return scheme[i].MinCvss > score })
+	if i == 0 {
+		return scheme[0].Name
+	}
+	return scheme[i-1].Name
+}
+
+// Map severity reported by a plugin into the current scheme. Known names and aliases are preferred,
+// then cvss score is used, otherwise the issue gets the least severity. Errors are kept as is.
+func (i *Issue) MapSeverity() {
+	if i.Severity == SeverityError {
+		return
+	}
+	if sev, ok := MapSeverity(i.Severity); ok {
+		i.Severity = sev
+		return
+	}
+	if i.Cvss > 0 {
+		i.Severity = CvssSeverity(i.Cvss)
+		return
+	}
+	i.Severity = scheme[0].Name
+}
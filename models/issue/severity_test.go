@@ -0,0 +1,115 @@
+package issue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemeValidate(t *testing.T) {
+	require.NoError(t, DefaultScheme.Validate())
+
+	invalid := map[string]Scheme{
+		"empty":      {},
+		"empty name": {{Name: ""}},
+		"reserved":   {{Name: SeverityError}},
+		"duplicate":  {{Name: "low"}, {Name: "Low", MinCvss: 1}},
+		"duplicate alias": {
+			{Name: "low", Aliases: []Severity{"minor"}},
+			{Name: "high", MinCvss: 7, Aliases: []Severity{"MINOR"}},
+		},
+		"alias of another name": {{Name: "low"}, {Name: "high", MinCvss: 7, Aliases: []Severity{"low"}}},
+		"negative score":        {{Name: "low", MinCvss: -1}},
+		"score above 10":        {{Name: "low"}, {Name: "high", MinCvss: 10.1}},
+		"same score":            {{Name: "low", MinCvss: 4}, {Name: "high", MinCvss: 4}},
+		"decreasing score":      {{Name: "low", MinCvss: 7}, {Name: "high", MinCvss: 4}},
+	}
+	for name, s := range invalid {
+		require.Error(t, s.Validate(), name)
+	}
+}
+
+func TestCvssSeverity(t *testing.T) {
+	cases := []struct {
+		score    float64
+		severity Severity
+	}{
+		{0, SeverityInfo},
+		{0.1, SeverityLow},
+		{3.9, SeverityLow},
+		{4.0, SeverityMedium},
+		{6.9, SeverityMedium},
+		{7.0, SeverityHigh},
+		{10, SeverityHigh},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.severity, CvssSeverity(c.score), "score %v", c.score)
+	}
+}
+
+func TestMapSeverity(t *testing.T) {
+	cases := map[Severity]Severity{
+		"high":          SeverityHigh,
+		" HIGH ":        SeverityHigh,
+		"Critical":      SeverityHigh,
+		"moderate":      SeverityMedium,
+		"informational": SeverityInfo,
+		"none":          SeverityInfo,
+	}
+	for raw, severity := range cases {
+		sev, ok := MapSeverity(raw)
+		require.True(t, ok, string(raw))
+		require.Equal(t, severity, sev)
+	}
+	_, ok := MapSeverity("urgent")
+	require.False(t, ok)
+	_, ok = MapSeverity(SeverityError)
+	require.False(t, ok)
+
+	// unknown severities are mapped by the score, then to the least severity, errors are kept
+	i := &Issue{Severity: "urgent", Cvss: 9.8}
+	i.MapSeverity()
+	require.Equal(t, SeverityHigh, i.Severity)
+	i = &Issue{Severity: "urgent"}
+	i.MapSeverity()
+	require.Equal(t, SeverityInfo, i.Severity)
+	i = &Issue{Severity: SeverityError, Cvss: 9.8}
+	i.MapSeverity()
+	require.Equal(t, SeverityError, i.Severity)
+}
+
+func TestSetScheme(t *testing.T) {
+	defer func() {
+		require.NoError(t, SetScheme(DefaultScheme))
+	}()
+	custom := Scheme{
+		{Name: "minor", MinCvss: 0, Aliases: []Severity{"low", "info"}},
+		{Name: "major", Label: "Major", MinCvss: 5},
+		{Name: "blocker", MinCvss: 9, Aliases: []Severity{"critical"}},
+	}
+	require.NoError(t, SetScheme(custom))
+
+	require.Equal(t, custom, GetScheme())
+	require.Equal(t, []Severity{"minor", "major", "blocker"}, Severities)
+	require.Equal(t, []interface{}{Severity("minor"), Severity("major"), Severity("blocker"), SeverityError}, Severity("").Enum())
+	require.Equal(t, 3, Severity("blocker").Level())
+	require.Equal(t, 0, SeverityHigh.Level())
+	require.Equal(t, 0, SeverityError.Level())
+	require.Equal(t, Severity("blocker"), LevelSeverity(3))
+	require.Equal(t, Severity(""), LevelSeverity(0))
+	require.Equal(t, Severity(""), LevelSeverity(4))
+	sev, ok := MapSeverity("Critical")
+	require.True(t, ok)
+	require.Equal(t, Severity("blocker"), sev)
+	require.Equal(t, Severity("major"), CvssSeverity(8.9))
+
+	// invalid scheme doesn't replace the current one
+	require.Error(t, SetScheme(Scheme{}))
+	require.Equal(t, custom, GetScheme())
+
+	require.NoError(t, SetScheme(DefaultScheme))
+	require.Equal(t, []Severity{SeverityInfo, SeverityLow, SeverityMedium, SeverityHigh}, Severities)
+	require.Equal(t, 4, SeverityHigh.Level())
+	_, ok = MapSeverity("blocker")
+	require.False(t, ok)
+}
@@ -8,4 +8,6 @@ import (
 type Info struct {
 	User     *user.User         `json:"user"`
 	Projects []*project.Project `json:"projects"`
+
+	Impersonator *user.User `json:"impersonator,omitempty" description:"admin who impersonates the user, the ui should show it"`
 }
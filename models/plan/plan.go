@@ -2,10 +2,12 @@ package plan
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"gopkg.in/mgo.v2/bson"
 
+	"github.com/bearded-web/bearded/models/policy"
 	"github.com/bearded-web/bearded/models/target"
 	"github.com/bearded-web/bearded/pkg/pagination"
 )
@@ -30,21 +32,85 @@ type Conf struct {
 	SharedFiles []*SharedFile `json:"sharedFiles,omitempty" description:"share file to container"`
 }
 
+// Input is the output of a prior step, it's shared to the container as json report of the step
+type Input struct {
+	Output string `json:"output" description:"output name of a prior step"`
+	Path   string `json:"path,omitempty" description:"path is relative to /share/, output name with .json extension by default"`
+}
+
+func (i *Input) SharePath() string {
+	if i.Path != "" {
+		return i.Path
+	}
+	return i.Output + ".json"
+}
+
 type WorkflowStep struct {
 	Plugin string `json:"plugin" description:"plugin name"`
 	Name   string `json:"name" description:"step name"`
 	Desc   string `json:"desc,omitempty" description:"step description"`
 	Conf   *Conf  `json:"conf,omitempty"`
+
+	Output string   `json:"output,omitempty" bson:"output,omitempty" description:"name of the step report for inputs of next steps"`
+	Inputs []*Input `json:"inputs,omitempty" bson:"inputs,omitempty" description:"outputs of prior steps which are passed to the plugin"`
+
+	Retention *Retention `json:"retention,omitempty" bson:"retention,omitempty" description:"issue caps of the step, it's preferred to the plan retention"`
+
+	Throttle *target.Throttle `json:"throttle,omitempty" bson:"throttle,omitempty" description:"load on the target, it is preferred to the plugin one"`
+
+	Timeout int `json:"timeout,omitempty" bson:"timeout,omitempty" description:"wall-clock limit of the plugin in seconds, the step is skipped and the scan continues if it's exceeded"`
 }
 
 type Plan struct {
 	Id         bson.ObjectId     `json:"id,omitempty" bson:"_id,omitempty"`
-	Name       string            `json:"name"`
+	Name       string            `json:"name" creating:"nonzero"`
 	Desc       string            `json:"desc"` // human readable description
-	Workflow   []*WorkflowStep   `json:"workflow"`
+	Workflow   []*WorkflowStep   `json:"workflow" creating:"min=1"`
 	Created    time.Time         `json:"created,omitempty" description:"when plan is created"`
 	Updated    time.Time         `json:"updated,omitempty" description:"when plan is updated"`
-	TargetType target.TargetType `json:"targetType" bson:"targetType" description:"what target type is supported"`
+	Version    int               `json:"version" description:"incremented on every update, send it back with If-Match header"`
+	TargetType target.TargetType `json:"targetType" bson:"targetType" description:"what target type is supported" creating:"nonzero"`
+	Policy     *policy.Policy    `json:"policy,omitempty" bson:"policy,omitempty" description:"scan policy, it's preferred to the project policy"`
+	Retention  *Retention        `json:"retention,omitempty" bson:"retention,omitempty" description:"issue caps of the scan, they are shared by all sessions"`
+	OutputDays int               `json:"outputDays,omitempty" bson:"outputDays,omitempty" description:"raw plugin output of scans is purged after this number of days, issues are kept, the project setting is used if zero"`
+}
+
+// Validate that every input refers to the output of a prior step, steps are run in the workflow order
+func (p *Plan) Validate() error {
+	outputs := map[string]bool{}
+	for i, step := range p.Workflow {
+		for _, in := range step.Inputs {
+			if in.Output == "" {
+				return fmt.Errorf("step %d: input output is required", i+1)
+			}
+			if !outputs[in.Output] {
+				return fmt.Errorf("step %d: output %q isn't produced by prior steps", i+1, in.Output)
+			}
+			if path := in.SharePath(); strings.HasPrefix(path, "/") || strings.Contains(path, "..") {
+				return fmt.Errorf("step %d: input path %q should be relative to /share/", i+1, path)
+			}
+		}
+		if step.Retention != nil {
+			if err := step.Retention.Validate(); err != nil {
+				return fmt.Errorf("step %d: retention %s", i+1, err)
+			}
+		}
+		if step.Throttle != nil {
+			if err := step.Throttle.Validate(); err != nil {
+				return fmt.Errorf("step %d: throttle %s", i+1, err)
+			}
+		}
+		if step.Timeout < 0 {
+			return fmt.Errorf("step %d: timeout can't be negative", i+1)
+		}
+		if step.Output != "" {
+			if outputs[step.Output] {
+				return fmt.Errorf("step %d: output %q is already produced by a prior step", i+1, step.Output)
+			}
+			outputs[step.Output] = true
+		}
+	}
+	return nil
 }
 
 type PlanList struct {
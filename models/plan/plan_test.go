@@ -0,0 +1,40 @@
+package plan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/models/target"
+)
+
+func TestPlanValidate(t *testing.T) {
+	crawl := &WorkflowStep{Plugin: "crawler", Output: "urls"}
+	valid := map[string][]*WorkflowStep{
+		"without inputs":        {{Plugin: "nmap"}, {Plugin: "w3af"}},
+		"input of a prior step": {crawl, {Plugin: "w3af", Inputs: []*Input{{Output: "urls"}}}},
+		"input with path":       {crawl, {Plugin: "w3af", Inputs: []*Input{{Output: "urls", Path: "in/urls.json"}}}},
+		"limits": {{Plugin: "w3af", Timeout: 60, Retention: &Retention{MaxIssues: 10},
+			Throttle: &target.Throttle{Rate: 5}}},
+	}
+	for name, workflow := range valid {
+		require.NoError(t, (&Plan{Workflow: workflow}).Validate(), name)
+	}
+
+	invalid := map[string][]*WorkflowStep{
+		"empty input":         {crawl, {Plugin: "w3af", Inputs: []*Input{{}}}},
+		"unknown output":      {crawl, {Plugin: "w3af", Inputs: []*Input{{Output: "hosts"}}}},
+		"output of next step": {{Plugin: "w3af", Inputs: []*Input{{Output: "urls"}}}, crawl},
+		"own output":          {{Plugin: "crawler", Output: "urls", Inputs: []*Input{{Output: "urls"}}}},
+		"absolute path":       {crawl, {Plugin: "w3af", Inputs: []*Input{{Output: "urls", Path: "/etc/passwd"}}}},
+		"path out of share":   {crawl, {Plugin: "w3af", Inputs: []*Input{{Output: "urls", Path: "../urls.json"}}}},
+		"duplicate output":    {crawl, {Plugin: "spider", Output: "urls"}},
+		"negative timeout":    {{Plugin: "w3af", Timeout: -1}},
+		"negative retention":  {{Plugin: "w3af", Retention: &Retention{MaxIssues: -1}}},
+		"wrong severity":      {{Plugin: "w3af", Retention: &Retention{MinSeverity: "urgent"}}},
+		"negative rate":       {{Plugin: "w3af", Throttle: &target.Throttle{Rate: -1}}},
+	}
+	for name, workflow := range invalid {
+		require.Error(t, (&Plan{Workflow: workflow}).Validate(), name)
+	}
+}
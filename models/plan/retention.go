@@ -0,0 +1,62 @@
+package plan
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+// Retention caps issues of noisy plugins, so they don't bloat the db.
+// Issues which aren't stored are counted by severity in the report of the session.
+// Retention could be set for a plan or a step, step retention is preferred.
+// The plan cap is shared by all sessions of the scan, the step cap by sessions of the step plugin.
+type Retention struct {
+	MinSeverity issue.Severity `json:"minSeverity,omitempty" bson:"minSeverity,omitempty" description:"issues with lower severity aren't stored"`
+	MaxIssues   int            `json:"maxIssues,omitempty" bson:"maxIssues,omitempty" description:"max stored issues of a scan, issues with the lowest severity are dropped beyond it, zero is unlimited"`
+}
+
+func (r *Retention) Validate() error {
+	if r.MinSeverity != "" && r.MinSeverity.Level() == 0 {
+		return fmt.Errorf("min severity should be one of %v, got %q", issue.Severities, r.MinSeverity)
+	}
+	if r.MaxIssues < 0 {
+		return fmt.Errorf("max issues shouldn't be negative")
+	}
+	return nil
+}
+
+// Drop returns issues which aren't stored, stored is the number of issues which are already kept
+// by other sessions under the same cap. Plugin errors are always kept.
+func (r *Retention) Drop(issues []*issue.Issue, stored int) []*issue.Issue {
+	dropped := []*issue.Issue{}
+	kept := []*issue.Issue{}
+	for _, iss := range issues {
+		if iss.Severity == issue.SeverityError {
+			continue
+		}
+		if r.MinSeverity != "" && iss.Severity.Level() < r.MinSeverity.Level() {
+			dropped = append(dropped, iss)
+			continue
+		}
+		kept = append(kept, iss)
+	}
+	if r.MaxIssues > 0 {
+		left := r.MaxIssues - stored
+		if left < 0 {
+			left = 0
+		}
+		if len(kept) > left {
+			// the most dangerous issues are kept, reported order is kept for the same severity
+			sort.Stable(bySeverity(kept))
+			dropped = append(dropped, kept[left:]...)
+		}
+	}
+	return dropped
+}
+
+type bySeverity []*issue.Issue
+
+func (s bySeverity) Len() int           { return len(s) }
+func (s bySeverity) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s bySeverity) Less(i, j int) bool { return s[i].Severity.Level() > s[j].Severity.Level() }
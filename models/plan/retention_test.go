@@ -0,0 +1,53 @@
+package plan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+func TestRetentionDrop(t *testing.T) {
+	reported := func(severities ...issue.Severity) []*issue.Issue {
+		issues := []*issue.Issue{}
+		for i, sev := range severities {
+			issues = append(issues, &issue.Issue{Summary: string(sev) + string(rune('a'+i)), Severity: sev})
+		}
+		return issues
+	}
+	summaries := func(issues []*issue.Issue) []string {
+		result := []string{}
+		for _, iss := range issues {
+			result = append(result, iss.Summary)
+		}
+		return result
+	}
+	issues := reported(issue.SeverityInfo, issue.SeverityHigh, issue.SeverityError, issue.SeverityLow, issue.SeverityInfo)
+
+	testCases := []struct {
+		name      string
+		retention *Retention
+		stored    int
+		dropped   []string
+	}{
+		{"no caps", &Retention{}, 0, []string{}},
+		{"min severity", &Retention{MinSeverity: issue.SeverityLow}, 0, []string{"infoa", "infoe"}},
+		{"max issues", &Retention{MaxIssues: 2}, 0, []string{"infoa", "infoe"}},
+		{"cap is shared with stored issues", &Retention{MaxIssues: 2}, 1, []string{"lowd", "infoa", "infoe"}},
+		{"cap is reached", &Retention{MaxIssues: 2}, 5, []string{"highb", "lowd", "infoa", "infoe"}},
+		{"both", &Retention{MinSeverity: issue.SeverityLow, MaxIssues: 1}, 0, []string{"infoa", "infoe", "lowd"}},
+	}
+	for _, tc := range testCases {
+		dropped := tc.retention.Drop(issues, tc.stored)
+		require.Equal(t, tc.dropped, summaries(dropped), tc.name)
+	}
+	// plugin errors are kept and the reported order isn't changed
+	require.Equal(t, []string{"infoa", "highb", "errorc", "lowd", "infoe"}, summaries(issues))
+}
+
+func TestRetentionValidate(t *testing.T) {
+	require.NoError(t, (&Retention{MinSeverity: issue.SeverityLow, MaxIssues: 10}).Validate())
+	require.Error(t, (&Retention{MinSeverity: "unknown"}).Validate())
+	require.Error(t, (&Retention{MaxIssues: -1}).Validate())
+}
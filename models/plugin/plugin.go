@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/bearded-web/bearded/models/target"
@@ -9,9 +10,44 @@ import (
 	"gopkg.in/mgo.v2/bson"
 )
 
+// network modes of plugin containers
+const (
+	NetworkBridge = "bridge"
+	NetworkNone   = "none"
+	NetworkHost   = "host"
+)
+
 type Container struct {
 	Registry string `json:"registry"` // use public if empty
 	Image    string `json:"image"`
+	Output   string `json:"output,omitempty" bson:"output,omitempty" description:"absolute path to the results file in the container, it's reported instead of the output"`
+	Network  string `json:"network,omitempty" bson:"network,omitempty" description:"one of bridge|none|host, bridge if empty, scripts need bridge"`
+}
+
+// Validate the network policy, scripts talk to the agent through the bridge.
+// The host network is allowed only for util plugins like network scanners and only to admins,
+// the container sees services of the agent host with it.
+func (c *Container) Validate(t PluginType, admin bool) error {
+	switch c.Network {
+	case "", NetworkBridge:
+	case NetworkNone:
+		if t == Script {
+			return fmt.Errorf("script plugins need %s network", NetworkBridge)
+		}
+	case NetworkHost:
+		if t != Util {
+			return fmt.Errorf("only %s plugins could use %s network", Util, NetworkHost)
+		}
+		if !admin {
+			return fmt.Errorf("only admins could set %s network", NetworkHost)
+		}
+	default:
+		return fmt.Errorf("unknown network %q", c.Network)
+	}
+	if c.Output != "" && !strings.HasPrefix(c.Output, "/") {
+		return fmt.Errorf("output should be an absolute path")
+	}
+	return nil
 }
 
 type Desc struct {
@@ -40,6 +76,8 @@ type Plugin struct {
 
 	TargetType target.TargetType `json:"targetType" bson:"targetType" description:"available only for target with this type"`
 
+	Throttle *target.Throttle `json:"throttle,omitempty" bson:"throttle,omitempty" description:"load of the plugin on the target, the concurrency is enforced by the agent and the rate is a hint"`
+
 	//	Requirements []*Required   `json:"requirements,omitempty" description:"other plugins required for running"`
 	Enabled bool `json:"enabled" description:"is plugin enabled for running"`
 	// experimental
@@ -47,6 +85,11 @@ type Plugin struct {
 	//	Links []*Link `json:"links,omitempty"`
 }
 
+// Name and version like in plan steps
+func (p *Plugin) Ref() string {
+	return fmt.Sprintf("%s:%s", p.Name, p.Version)
+}
+
 // Short description of plugin
 func (p *Plugin) String() string {
 	var str string
@@ -0,0 +1,34 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContainerValidate(t *testing.T) {
+	cases := []struct {
+		container *Container
+		t         PluginType
+		admin     bool
+		valid     bool
+	}{
+		{&Container{}, Script, false, true},
+		{&Container{Network: NetworkBridge, Output: "/tmp/report.json"}, Util, false, true},
+		{&Container{Network: NetworkNone}, Util, false, true},
+		{&Container{Network: NetworkNone}, Script, false, false},
+		{&Container{Network: NetworkHost}, Util, true, true},
+		{&Container{Network: NetworkHost}, Util, false, false},
+		{&Container{Network: NetworkHost}, Script, true, false},
+		{&Container{Network: "overlay"}, Util, true, false},
+		{&Container{Output: "report.json"}, Util, false, false},
+	}
+	for _, c := range cases {
+		err := c.container.Validate(c.t, c.admin)
+		if c.valid {
+			require.NoError(t, err, "%+v of %s", c.container, c.t)
+		} else {
+			require.Error(t, err, "%+v of %s", c.container, c.t)
+		}
+	}
+}
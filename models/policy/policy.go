@@ -0,0 +1,87 @@
+package policy
+
+import (
+	"fmt"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+// Rule limits the number of issues with the severity or with the cvss score from the value
+type Rule struct {
+	Severity issue.Severity `json:"severity,omitempty" description:"one of the configured severities"`
+	Cvss     float64        `json:"cvss,omitempty" description:"count issues with cvss score from this value instead of the severity"`
+	Max      int            `json:"max" description:"scan fails if it has more issues with this severity or score"`
+}
+
+// Policy is evaluated when a scan is finished, the scan passes if all rules are satisfied.
+// Policy could be set for a plan or a project, plan policy is preferred.
+type Policy struct {
+	Rules   []*Rule `json:"rules"`
+	NewOnly bool    `json:"newOnly,omitempty" description:"count only issues which aren't in the project baseline"`
+}
+
+// Default policy fails scan if it has any issue with the severity or higher
+func Default(severity issue.Severity) *Policy {
+	p := &Policy{}
+	for _, s := range issue.Severities {
+		if s.Level() >= severity.Level() && s.Level() > 0 {
+			p.Rules = append(p.Rules, &Rule{Severity: s, Max: 0})
+		}
+	}
+	return p
+}
+
+func (p *Policy) Validate() error {
+	for _, r := range p.Rules {
+		if r.Cvss != 0 {
+			if r.Severity != "" {
+				return fmt.Errorf("rule should have either severity or cvss, got both")
+			}
+			if r.Cvss < 0 || r.Cvss > 10 {
+				return fmt.Errorf("rule cvss should be from 0 to 10, got %v", r.Cvss)
+			}
+		} else if r.Severity.Level() == 0 {
+			return fmt.Errorf("rule severity should be one of %v, got %q", issue.Severities, r.Severity)
+		}
+		if r.Max < 0 {
+			return fmt.Errorf("rule max for %s shouldn't be negative", r.target())
+		}
+	}
+	return nil
+}
+
+// Cvss scores used by the rules, issues are counted for each of them
+func (p *Policy) CvssScores() []float64 {
+	var scores []float64
+	seen := map[float64]bool{}
+	for _, r := range p.Rules {
+		if r.Cvss != 0 && !seen[r.Cvss] {
+			seen[r.Cvss] = true
+			scores = append(scores, r.Cvss)
+		}
+	}
+	return scores
+}
+
+// Evaluate the policy with issue counts by severity and by cvss score (issues with the score or higher),
+// returns violated rules in human readable form
+func (p *Policy) Evaluate(issues map[issue.Severity]int, cvss map[float64]int) (bool, []string) {
+	var violations []string
+	for _, r := range p.Rules {
+		count := issues[r.Severity]
+		if r.Cvss != 0 {
+			count = cvss[r.Cvss]
+		}
+		if count > r.Max {
+			violations = append(violations, fmt.Sprintf("%d %s issues, %d allowed", count, r.target(), r.Max))
+		}
+	}
+	return len(violations) == 0, violations
+}
+
+func (r *Rule) target() string {
+	if r.Cvss != 0 {
+		return fmt.Sprintf("cvss %v+", r.Cvss)
+	}
+	return string(r.Severity)
+}
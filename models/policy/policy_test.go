@@ -0,0 +1,65 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+func TestValidate(t *testing.T) {
+	valid := []*Policy{
+		{},
+		{Rules: []*Rule{{Severity: issue.SeverityHigh, Max: 0}, {Severity: issue.SeverityMedium, Max: 5}}},
+		{Rules: []*Rule{{Cvss: 9.0, Max: 0}, {Cvss: 10, Max: 1}}},
+	}
+	for _, p := range valid {
+		require.NoError(t, p.Validate())
+	}
+	invalid := []*Policy{
+		{Rules: []*Rule{{}}},
+		{Rules: []*Rule{{Severity: "unknown"}}},
+		{Rules: []*Rule{{Severity: issue.SeverityHigh, Max: -1}}},
+		{Rules: []*Rule{{Severity: issue.SeverityHigh, Cvss: 7}}},
+		{Rules: []*Rule{{Cvss: 10.1}}},
+		{Rules: []*Rule{{Cvss: -1}}},
+		{Rules: []*Rule{{Cvss: 4, Max: -1}}},
+	}
+	for _, p := range invalid {
+		require.Error(t, p.Validate(), "rule %+v", p.Rules[0])
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p := &Policy{Rules: []*Rule{
+		{Severity: issue.SeverityHigh, Max: 0},
+		{Severity: issue.SeverityMedium, Max: 5},
+		{Cvss: 9.0, Max: 0},
+		{Cvss: 9.0, Max: 2},
+	}}
+	require.Equal(t, []float64{9.0}, p.CvssScores())
+
+	passed, violations := p.Evaluate(nil, nil)
+	require.True(t, passed)
+	require.Empty(t, violations)
+
+	passed, violations = p.Evaluate(map[issue.Severity]int{issue.SeverityMedium: 5, issue.SeverityLow: 10}, map[float64]int{9.0: 0})
+	require.True(t, passed)
+	require.Empty(t, violations)
+
+	passed, violations = p.Evaluate(map[issue.Severity]int{issue.SeverityHigh: 1, issue.SeverityMedium: 6}, map[float64]int{9.0: 1})
+	require.False(t, passed)
+	require.Equal(t, []string{
+		"1 high issues, 0 allowed",
+		"6 medium issues, 5 allowed",
+		"1 cvss 9+ issues, 0 allowed",
+	}, violations)
+}
+
+func TestDefault(t *testing.T) {
+	p := Default(issue.SeverityMedium)
+	require.NoError(t, p.Validate())
+	require.Equal(t, []*Rule{{Severity: issue.SeverityMedium}, {Severity: issue.SeverityHigh}}, p.Rules)
+	require.Empty(t, p.CvssScores())
+}
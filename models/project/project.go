@@ -5,6 +5,7 @@ import (
 
 	"gopkg.in/mgo.v2/bson"
 
+	"github.com/bearded-web/bearded/models/policy"
 	"github.com/bearded-web/bearded/pkg/pagination"
 )
 
@@ -18,8 +19,56 @@ type Project struct {
 	Owner   bson.ObjectId `json:"owner,omitempty"`
 	Created time.Time     `json:"created,omitempty"`
 	Updated time.Time     `json:"updated,omitempty"`
+	Version int           `json:"version" description:"incremented on every update, send it back with If-Match header"`
 
 	Members []*Member `json:"members" bson:"members"`
+	Tags    []string  `json:"tags,omitempty" bson:"tags,omitempty" description:"key or key=value labels"`
+
+	Compliance []string `json:"compliance,omitempty" bson:"compliance,omitempty" description:"compliance frameworks which all targets of the project are in scope of"`
+
+	Policy   *policy.Policy `json:"policy,omitempty" bson:"policy,omitempty" description:"scan policy for the project scans, plan policy is preferred"`
+	Baseline *Baseline      `json:"baseline,omitempty" bson:"baseline,omitempty" description:"known issues, which are skipped in new issues view"`
+
+	RecomputeSeverity bool `json:"recomputeSeverity,omitempty" bson:"recomputeSeverity,omitempty" description:"update severities of issues when their vulndb entries are changed"`
+
+	Plan bson.ObjectId `json:"plan,omitempty" bson:"plan,omitempty" description:"default plan for scans which are started without a plan"`
+
+	AutoClose *AutoClose `json:"autoClose,omitempty" bson:"autoClose,omitempty" description:"resolve issues which aren't reported again by scans of their target"`
+
+	History int `json:"history,omitempty" bson:"history,omitempty" description:"done scans which are kept per target, the cap of the dispatcher is used if zero"`
+
+	OutputDays int `json:"outputDays,omitempty" bson:"outputDays,omitempty" description:"raw plugin output of scans is purged after this number of days unless the plan sets it, the dispatcher setting is used if zero"`
+
+	Coalesce int `json:"coalesce,omitempty" bson:"coalesce,omitempty" description:"seconds, new scans of the same target and plan attach to the active scan started within the window, zero disables it"`
+}
+
+// AutoClose resolves open issues after they are missed by consecutive finished scans of the target.
+// If both thresholds are set, both of them should be reached.
+type AutoClose struct {
+	Scans int `json:"scans,omitempty" description:"consecutive scans which didn't report the issue"`
+	Days  int `json:"days,omitempty" description:"days since the issue was reported the last time"`
+}
+
+func (a *AutoClose) Enabled() bool {
+	return a != nil && (a.Scans > 0 || a.Days > 0)
+}
+
+// Due returns true if the issue which is missed by the number of scans and reported at the last seen time should be resolved
+func (a *AutoClose) Due(missed int, lastSeen, now time.Time) bool {
+	if !a.Enabled() {
+		return false
+	}
+	return missed >= a.Scans && (a.Days == 0 || now.Sub(lastSeen) >= time.Duration(a.Days)*time.Hour*24)
+}
+
+// Baseline is a snapshot of known issues, so only new ones could be shown or checked by scan policy.
+// Issues of the baseline are marked with its id, target issue is the same for the same fingerprint (uniqId) of the target.
+// A new baseline gets a new id, so issues marked by the previous one become new.
+type Baseline struct {
+	Id      bson.ObjectId `json:"id" bson:"id"`
+	Scan    bson.ObjectId `json:"scan,omitempty" bson:"scan,omitempty" description:"scan which issues are taken to the baseline"`
+	Count   int           `json:"count" description:"number of issues taken to the baseline"`
+	Updated time.Time     `json:"updated"`
 }
 
 func (p *Project) String() string {
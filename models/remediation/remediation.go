@@ -0,0 +1,38 @@
+package remediation
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/pkg/pagination"
+)
+
+// Template is reusable remediation advice for issues of the vulndb type or the cwe.
+// The text is a go template with Vars, e.g. "Encode the {{.Parameter}} parameter on {{.Target}}".
+type Template struct {
+	Id       bson.ObjectId `json:"id,omitempty" bson:"_id"`
+	Title    string        `json:"title"`
+	VulnType int           `json:"vulnType,omitempty" bson:"vulnType,omitempty" description:"vulnerability type from vulndb, it's preferred to the cwe"`
+	Cwe      string        `json:"cwe,omitempty" bson:"cwe,omitempty" description:"cwe id, like 79, for issues of vulndb types with this cwe"`
+	Text     string        `json:"text" description:"markdown with variables: {{.Target}}, {{.Url}}, {{.Parameter}}, {{.Summary}}"`
+	Owner    bson.ObjectId `json:"owner,omitempty" bson:"owner,omitempty"`
+	Created  time.Time     `json:"created,omitempty"`
+	Updated  time.Time     `json:"updated,omitempty"`
+}
+
+type TemplateList struct {
+	pagination.Meta `json:",inline"`
+	Results         []*Template `json:"results"`
+}
+
+// Vars are substituted into the template text
+type Vars struct {
+	// address of the target, like example.com
+	Target string
+	// url where the issue is happened
+	Url string
+	// the first parameter of the issue vector
+	Parameter string
+	Summary   string
+}
@@ -22,13 +22,21 @@ type Report struct {
 	Created     time.Time     `json:"created,omitempty" description:"when report is created"`
 	Updated     time.Time     `json:"updated,omitempty" description:"when report is updated"`
 	Scan        bson.ObjectId `json:"scan,omitempty" description:"scan id"`
+	Project     bson.ObjectId `json:"project,omitempty" bson:"project,omitempty" description:"project of the scan"`
 	ScanSession bson.ObjectId `json:"scanSession,omitempty" bson:"scanSession" description:"scan session id"`
+	ResultId    string        `json:"resultId,omitempty" bson:"resultId,omitempty" description:"id of the session result which is set by the agent, uploads of the same result return the stored report"`
 
 	Raw `json:",inline,omitempty" bson:"raw,inline"`
 
 	Multi  []*Report      `json:"multi,omitempty" bson:"multi,omitempty"`
 	Issues []*issue.Issue `json:"issues,omitempty" bson:"issues,omitempty"`
 	Techs  []*tech.Tech   `json:"techs,omitempty"`
+
+	Dropped map[issue.Severity]int `json:"dropped,omitempty" bson:"dropped,omitempty" description:"numbers of issues by severity which aren't stored due to the plan retention"`
+
+	PurgeAfter time.Time `json:"purgeAfter,omitempty" bson:"purgeAfter,omitempty" description:"when raw plugin output is purged by the output retention, it's set when the report is written"`
+	Purged     time.Time `json:"purged,omitempty" bson:"purged,omitempty" description:"when raw plugin output is purged due to the output retention, issues are kept"`
+	PurgedSize int       `json:"purgedSize,omitempty" bson:"purgedSize,omitempty" description:"bytes of purged raw output, files aren't counted"`
 }
 
 type ReportList struct {
@@ -69,6 +77,62 @@ func (r *Report) GetAllIssues() []*issue.Issue {
 	return issues
 }
 
+// AllFiles returns files of raw output and issue attachments of the report and underlying multi reports
+func (r *Report) AllFiles() []*file.Meta {
+	files := append([]*file.Meta{}, r.Files...)
+	for _, iss := range r.Issues {
+		files = append(files, iss.Attachments...)
+	}
+	for _, rep := range r.Multi {
+		files = append(files, rep.AllFiles()...)
+	}
+	return files
+}
+
+// PurgeOutput removes raw output and files of the report and underlying multi reports,
+// returns removed files and the size of removed output
+func (r *Report) PurgeOutput() ([]*file.Meta, int) {
+	files := r.Files
+	size := len(r.Raw.Raw)
+	r.Raw = Raw{}
+	r.Files = nil
+	for _, rep := range r.Multi {
+		subFiles, subSize := rep.PurgeOutput()
+		files = append(files, subFiles...)
+		size += subSize
+	}
+	return files, size
+}
+
+// Drop removes issues from the report and underlying multi reports, they are counted in dropped of the top report
+func (r *Report) Drop(issues []*issue.Issue) {
+	if len(issues) == 0 {
+		return
+	}
+	drop := map[*issue.Issue]bool{}
+	if r.Dropped == nil {
+		r.Dropped = map[issue.Severity]int{}
+	}
+	for _, iss := range issues {
+		drop[iss] = true
+		r.Dropped[iss.Severity]++
+	}
+	r.removeIssues(drop)
+}
+
+func (r *Report) removeIssues(drop map[*issue.Issue]bool) {
+	for _, subReport := range r.Multi {
+		subReport.removeIssues(drop)
+	}
+	kept := r.Issues[:0]
+	for _, iss := range r.Issues {
+		if !drop[iss] {
+			kept = append(kept, iss)
+		}
+	}
+	r.Issues = kept
+}
+
 // get all techs from the report and underlying multi reports
 func (r *Report) GetAllTechs() []*tech.Tech {
 	var techs []*tech.Tech
@@ -0,0 +1,34 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+func TestReportDrop(t *testing.T) {
+	info := &issue.Issue{Summary: "banner", Severity: issue.SeverityInfo}
+	low := &issue.Issue{Summary: "cookie", Severity: issue.SeverityLow}
+	high := &issue.Issue{Summary: "xss", Severity: issue.SeverityHigh}
+	rep := &Report{
+		Type: TypeMulti,
+		Multi: []*Report{
+			{Type: TypeIssues, Issues: []*issue.Issue{info, high}},
+			{Type: TypeIssues, Issues: []*issue.Issue{low}},
+		},
+	}
+
+	rep.Drop(nil)
+	require.Nil(t, rep.Dropped, "nothing is dropped")
+
+	rep.Drop([]*issue.Issue{info, low})
+	require.Equal(t, []*issue.Issue{high}, rep.GetAllIssues(), "issues are removed from multi reports")
+	require.Equal(t, map[issue.Severity]int{issue.SeverityInfo: 1, issue.SeverityLow: 1}, rep.Dropped)
+	require.Nil(t, rep.Multi[0].Dropped, "drops are counted in the top report")
+
+	rep.Drop([]*issue.Issue{high})
+	require.Empty(t, rep.GetAllIssues())
+	require.Equal(t, 1, rep.Dropped[issue.SeverityHigh])
+}
@@ -34,3 +34,37 @@ func (t ScanStatus) Enum() []interface{} {
 func (t ScanStatus) Convert(text string) (interface{}, error) {
 	return ScanStatus(text), nil
 }
+
+// Allowed status changes of scans and sessions. Finished and failed are final, sessions are returned
+// to created when their agent is gone.
+var transitions = map[ScanStatus][]ScanStatus{
+	StatusCreated: {StatusQueued, StatusWorking, StatusFinished, StatusFailed},
+	StatusQueued:  {StatusCreated, StatusWorking, StatusPaused, StatusFinished, StatusFailed},
+	StatusWorking: {StatusCreated, StatusQueued, StatusPaused, StatusFinished, StatusFailed},
+	StatusPaused:  {StatusQueued, StatusWorking, StatusFinished, StatusFailed},
+}
+
+// CanChange reports if the status can be changed to another one, keeping the same status is allowed
+func (t ScanStatus) CanChange(to ScanStatus) bool {
+	if t == to {
+		return true
+	}
+	for _, st := range transitions[t] {
+		if st == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusesTo returns statuses which can be changed to the status, including the status itself
+func StatusesTo(to ScanStatus) []ScanStatus {
+	result := []ScanStatus{to}
+	for _, st := range scanStatuses {
+		from := st.(ScanStatus)
+		if from != to && from.CanChange(to) {
+			result = append(result, from)
+		}
+	}
+	return result
+}
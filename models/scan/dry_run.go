@@ -0,0 +1,27 @@
+package scan
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/report"
+)
+
+// Dry runs check the plugin against a test target, they aren't listed and don't create issues.
+// Reports are kept inside the scan, so mongo removes the whole run when it's expired.
+type DryRun struct {
+	Plugin  bson.ObjectId    `json:"plugin" description:"tested plugin id"`
+	Created time.Time        `json:"created"`
+	Reports []*report.Report `json:"reports,omitempty" bson:"reports,omitempty" description:"reports sent by plugin sessions"`
+}
+
+// GetReport returns the report of the session or nil if it isn't sent yet
+func (d *DryRun) GetReport(session bson.ObjectId) *report.Report {
+	for _, rep := range d.Reports {
+		if rep.ScanSession == session {
+			return rep
+		}
+	}
+	return nil
+}
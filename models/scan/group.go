@@ -0,0 +1,37 @@
+package scan
+
+import (
+	"gopkg.in/mgo.v2/bson"
+)
+
+// GroupStatus summarizes statuses of scans of the group
+type GroupStatus struct {
+	Group   bson.ObjectId `json:"group"`
+	Total   int           `json:"total"`
+	Waiting int           `json:"waiting" description:"scans which aren't queued yet because of the group concurrency or scan windows"`
+	Queued  int           `json:"queued" description:"created and queued scans"`
+	Running int           `json:"running"`
+	Paused  int           `json:"paused"`
+	Done    int           `json:"done"`
+	Failed  int           `json:"failed"`
+}
+
+func (g *GroupStatus) Add(sc *Scan) {
+	g.Total++
+	if sc.Waiting || sc.WaitWindow {
+		g.Waiting++
+		return
+	}
+	switch sc.Status {
+	case StatusCreated, StatusQueued:
+		g.Queued++
+	case StatusWorking:
+		g.Running++
+	case StatusPaused:
+		g.Paused++
+	case StatusFinished:
+		g.Done++
+	case StatusFailed:
+		g.Failed++
+	}
+}
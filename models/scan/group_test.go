@@ -0,0 +1,24 @@
+package scan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupStatus(t *testing.T) {
+	g := &GroupStatus{}
+	for _, sc := range []*Scan{
+		{Status: StatusCreated, Waiting: true},
+		{Status: StatusQueued, WaitWindow: true},
+		{Status: StatusCreated},
+		{Status: StatusQueued},
+		{Status: StatusWorking},
+		{Status: StatusPaused},
+		{Status: StatusFinished},
+		{Status: StatusFailed},
+	} {
+		g.Add(sc)
+	}
+	require.Equal(t, &GroupStatus{Total: 8, Waiting: 2, Queued: 2, Running: 1, Paused: 1, Done: 1, Failed: 1}, g)
+}
@@ -0,0 +1,48 @@
+package scan
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ImportFormat is the format of third-party scanner results
+type ImportFormat string
+
+const (
+	// json report of OWASP ZAP
+	FormatZap ImportFormat = "zap"
+	// SARIF 2.1.0 log of any static or dynamic analyzer
+	FormatSarif ImportFormat = "sarif"
+)
+
+var importFormats = []interface{}{FormatZap, FormatSarif}
+
+func (f ImportFormat) IsValid() bool {
+	for _, val := range importFormats {
+		if val.(ImportFormat) == f {
+			return true
+		}
+	}
+	return false
+}
+
+// It's a hack to show custom type as string in swagger
+func (f ImportFormat) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(f))
+}
+
+func (f ImportFormat) Enum() []interface{} {
+	return importFormats
+}
+
+func (f ImportFormat) Convert(text string) (interface{}, error) {
+	return ImportFormat(text), nil
+}
+
+// Imported scans keep results of scanners which are run outside of bearded, they are created finished
+// with one session for every tool and aren't queued.
+type Import struct {
+	Format  ImportFormat `json:"format"`
+	Tools   []string     `json:"tools,omitempty" bson:"tools,omitempty" description:"scanners from the imported results, name:version"`
+	Created time.Time    `json:"created"`
+}
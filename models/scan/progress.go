@@ -0,0 +1,83 @@
+package scan
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Progress is reported by the plugin while the session is working
+type Progress struct {
+	Percent int       `json:"percent" description:"0-100"`
+	Message string    `json:"message,omitempty" bson:"message,omitempty" description:"what the plugin is doing, like crawling"`
+	Updated time.Time `json:"updated,omitempty"`
+}
+
+// Percent of the session, done sessions are complete and sessions without reported progress have nothing done
+func (p *Session) Percent() int {
+	switch {
+	case p.IsDone():
+		return 100
+	case p.Progress != nil && p.Status == StatusWorking:
+		return p.Progress.Percent
+	}
+	return 0
+}
+
+// EstimateProgress returns the percent of the scan, it's the average of all sessions,
+// so it's estimated by the number of done sessions if plugins don't report progress
+func (p *Scan) EstimateProgress() int {
+	if p.IsDone() {
+		return 100
+	}
+	sessions := p.GetAllSessions()
+	if len(sessions) == 0 {
+		return 0
+	}
+	total := 0
+	for _, sess := range sessions {
+		total += sess.Percent()
+	}
+	return total / len(sessions)
+}
+
+type SessionProgress struct {
+	Session bson.ObjectId `json:"session"`
+	Step    string        `json:"step"`
+	Plugin  string        `json:"plugin"`
+	Status  ScanStatus    `json:"status"`
+	Percent int           `json:"percent"`
+	Message string        `json:"message,omitempty"`
+}
+
+// ScanProgress is the progress of the scan with progresses of its sessions
+type ScanProgress struct {
+	Scan     bson.ObjectId      `json:"scan"`
+	Status   ScanStatus         `json:"status"`
+	Percent  int                `json:"percent"`
+	Sessions []*SessionProgress `json:"sessions"`
+}
+
+func (p *Scan) GetProgress() *ScanProgress {
+	result := &ScanProgress{
+		Scan:     p.Id,
+		Status:   p.Status,
+		Percent:  p.EstimateProgress(),
+		Sessions: []*SessionProgress{},
+	}
+	for _, sess := range p.GetAllSessions() {
+		sp := &SessionProgress{
+			Session: sess.Id,
+			Status:  sess.Status,
+			Percent: sess.Percent(),
+		}
+		if sess.Step != nil {
+			sp.Step, sp.Plugin = sess.Step.Name, sess.Step.Plugin
+		}
+		if sess.Progress != nil && sess.Status == StatusWorking {
+			sp.Message = sess.Progress.Message
+		}
+		result.Sessions = append(result.Sessions, sp)
+	}
+	return result
+}
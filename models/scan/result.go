@@ -0,0 +1,24 @@
+package scan
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/policy"
+)
+
+// Result of the scan, CI uses it to decide if the build should fail
+type Result struct {
+	Scan       bson.ObjectId          `json:"scan"`
+	Status     ScanStatus             `json:"status" description:"one of [created|queued|working|paused|finished|failed]"`
+	Done       bool                   `json:"done" description:"scan is finished or failed, the result won't change"`
+	Issues     map[issue.Severity]int `json:"issues" description:"number of issues by severity"`
+	Passed     bool                   `json:"passed" description:"scan is finished and satisfies the policy"`
+	Violations []string               `json:"violations,omitempty" description:"violated rules of the policy"`
+	Policy     *policy.Policy         `json:"policy" description:"policy which is used for the scan"`
+	Url        string                 `json:"url" description:"scan page for humans"`
+}
+
+func (p *Scan) IsDone() bool {
+	return p.Status == StatusFinished || p.Status == StatusFailed
+}
@@ -1,6 +1,9 @@
 package scan
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -17,14 +20,20 @@ type Dates struct {
 	Queued   *time.Time `json:"queued,omitempty"`
 	Started  *time.Time `json:"started,omitempty"`
 	Finished *time.Time `json:"finished,omitempty"`
+	Paused   *time.Time `json:"paused,omitempty" bson:"paused,omitempty" description:"when the scan is paused, empty after resuming"`
 }
 
 type Session struct {
-	Id     bson.ObjectId      `json:"id,omitempty"`
-	Status ScanStatus         `json:"status" description:"one of [created|queued|working|paused|finished|failed]"`
-	Step   *plan.WorkflowStep `json:"step"`
-	Plugin bson.ObjectId      `json:"plugin,omitempty" description:"plugin id"`
-	Scan   bson.ObjectId      `json:"scan" description:"scan id"`
+	Id       bson.ObjectId      `json:"id,omitempty"`
+	Status   ScanStatus         `json:"status" description:"one of [created|queued|working|paused|finished|failed]"`
+	Step     *plan.WorkflowStep `json:"step"`
+	Plugin   bson.ObjectId      `json:"plugin,omitempty" description:"plugin id"`
+	Scan     bson.ObjectId      `json:"scan" description:"scan id"`
+	Agent    bson.ObjectId      `json:"agent,omitempty" bson:"agent,omitempty" description:"agent which took the session"`
+	Error    string             `json:"error,omitempty" bson:"error,omitempty" description:"why the session is failed or timed out"`
+	TimedOut bool               `json:"timedOut,omitempty" bson:"timedOut,omitempty" description:"plugin exceeded the step timeout, so the session is finished without results"`
+
+	Progress *Progress `json:"progress,omitempty" bson:"progress,omitempty" description:"progress which is reported by the plugin"`
 	// dates
 	Dates `json:",inline"`
 
@@ -58,6 +67,10 @@ func (p *Session) GetAllChildren() []*Session {
 	return result
 }
 
+func (p *Session) IsDone() bool {
+	return p.Status == StatusFinished || p.Status == StatusFailed
+}
+
 func (p *Session) HasParent() bool {
 	return p.Parent != ""
 }
@@ -80,8 +93,35 @@ type Scan struct {
 	Target  bson.ObjectId `json:"target"`
 	Project bson.ObjectId `json:"project"`
 
+	// scans of the project targets started together
+	Group   bson.ObjectId `json:"group,omitempty" bson:"group,omitempty" description:"id of the scan group"`
+	Waiting bool          `json:"waiting,omitempty" bson:"waiting,omitempty" description:"the scan isn't queued until other scans of the group are done"`
+
+	WaitWindow bool `json:"waitWindow,omitempty" bson:"waitWindow,omitempty" description:"the scan isn't queued until the scan window of the target"`
+	Windowed   bool `json:"windowed,omitempty" bson:"windowed,omitempty" description:"the scan waited for the scan window of the target"`
+	// scans started with the override are dispatched outside of scan windows too
+	WindowOverride bool `json:"windowOverride,omitempty" bson:"windowOverride,omitempty" description:"the scan is started outside of scan windows by the user"`
+
+	Template bson.ObjectId `json:"template,omitempty" bson:"template,omitempty" description:"scan template which the scan is started from"`
+	// scans are coalesced only with scans of the same effective config
+	ConfHash string `json:"-" bson:"confHash,omitempty"`
+
+	DryRun *DryRun `json:"dryRun,omitempty" bson:"dryRun,omitempty" description:"set for test runs of plugins, they don't have a project and a target"`
+
+	Import *Import `json:"import,omitempty" bson:"import,omitempty" description:"set for scans created from results of third-party scanners, they don't have a plan"`
+
+	// set when the scan is finished
+	Passed     *bool    `json:"passed,omitempty" bson:"passed,omitempty" description:"scan satisfies the scan policy"`
+	Violations []string `json:"violations,omitempty" bson:"violations,omitempty" description:"violated rules of the scan policy"`
+
 	// dates
 	Dates `json:",inline"`
+
+	Timing *Timing `json:"timing,omitempty" bson:"-" description:"set only for the scan detail"`
+
+	QueueReason string `json:"queueReason,omitempty" bson:"-" description:"why the scan isn't taken by agents, set only for the scan detail"`
+
+	Progress int `json:"progress" bson:"-" description:"estimated percent of the scan, set for the scan detail and the list"`
 }
 
 type ScanList struct {
@@ -108,6 +148,31 @@ func (p *Scan) GetSession(id bson.ObjectId) *Session {
 	return nil
 }
 
+// Unattended scans are started by bearded instead of users, they are scans of groups and campaigns
+// and scans which waited for scan windows
+func (p *Scan) Unattended() bool {
+	return p.Group != "" || p.Windowed
+}
+
+// GetConfHash returns the hash of the effective config of the scan: the conf and steps of sessions
+// with overrides of the template and the request
+func (p *Scan) GetConfHash() string {
+	steps := []*plan.WorkflowStep{}
+	for _, sess := range p.Sessions {
+		steps = append(steps, sess.Step)
+	}
+	// maps are marshaled with sorted keys, so the same config has the same hash
+	data, err := json.Marshal(struct {
+		Conf  ScanConf
+		Steps []*plan.WorkflowStep
+	}{p.Conf, steps})
+	if err != nil {
+		return ""
+	}
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
 // get all session from this session and all children recursively
 func (p *Scan) GetAllSessions() []*Session {
 	result := []*Session{}
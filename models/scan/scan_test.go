@@ -0,0 +1,27 @@
+package scan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/plan"
+)
+
+func TestScanConfHash(t *testing.T) {
+	newScan := func(args string, params map[string]interface{}) *Scan {
+		return &Scan{
+			Conf: ScanConf{Target: "http://example.com", Params: params},
+			Sessions: []*Session{
+				{Id: bson.NewObjectId(), Step: &plan.WorkflowStep{Plugin: "barbudo/nmap:0.0.1", Conf: &plan.Conf{CommandArgs: args}}},
+			},
+		}
+	}
+	hash := newScan("-sV", map[string]interface{}{"depth": 1, "cookie": "a"}).GetConfHash()
+	require.Len(t, hash, 40)
+	require.Equal(t, hash, newScan("-sV", map[string]interface{}{"cookie": "a", "depth": 1}).GetConfHash(),
+		"session ids don't change the hash, params are ordered")
+	require.NotEqual(t, hash, newScan("-sS", map[string]interface{}{"depth": 1, "cookie": "a"}).GetConfHash(), "step overrides change the hash")
+	require.NotEqual(t, hash, newScan("-sV", map[string]interface{}{"depth": 2, "cookie": "a"}).GetConfHash(), "params change the hash")
+}
@@ -0,0 +1,141 @@
+package scan
+
+import (
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/target"
+	"github.com/bearded-web/bearded/pkg/pagination"
+)
+
+// Template bundles the plan with plugin configs, the scope and schedule defaults,
+// so scans of different targets are started with the same settings.
+// Templates of the project are shared by its members, templates without a project are available for everyone.
+type Template struct {
+	Id      bson.ObjectId `json:"id,omitempty" bson:"_id"`
+	Name    string        `json:"name"`
+	Desc    string        `json:"desc,omitempty" bson:"desc,omitempty"`
+	Project bson.ObjectId `json:"project,omitempty" bson:"project,omitempty" description:"empty for global templates"`
+	Owner   bson.ObjectId `json:"owner,omitempty" bson:"owner,omitempty"`
+	Plan    bson.ObjectId `json:"plan"`
+
+	Plugins  []*TemplatePlugin      `json:"plugins,omitempty" bson:"plugins,omitempty" description:"config overrides of plan steps by plugin"`
+	Params   map[string]interface{} `json:"params,omitempty" bson:"params,omitempty" description:"scan conf params for command args and form data of steps"`
+	Scope    *TemplateScope         `json:"scope,omitempty" bson:"scope,omitempty"`
+	Schedule *TemplateSchedule      `json:"schedule,omitempty" bson:"schedule,omitempty"`
+
+	Created time.Time `json:"created,omitempty"`
+	Updated time.Time `json:"updated,omitempty"`
+}
+
+func (t *Template) String() string {
+	return t.Id.Hex()
+}
+
+// TemplatePlugin overrides the conf of plan steps with the plugin, empty fields keep values of the plan
+type TemplatePlugin struct {
+	Plugin      string           `json:"plugin" description:"plugin name"`
+	CommandArgs string           `json:"commandArgs,omitempty" bson:"commandArgs,omitempty"`
+	FormData    string           `json:"formData,omitempty" bson:"formData,omitempty"`
+	Throttle    *target.Throttle `json:"throttle,omitempty" bson:"throttle,omitempty"`
+}
+
+// Apply overrides to the step, the conf is copied, so the plan isn't changed
+func (p *TemplatePlugin) Apply(step *plan.WorkflowStep) {
+	conf := &plan.Conf{}
+	if step.Conf != nil {
+		*conf = *step.Conf
+	}
+	if p.CommandArgs != "" {
+		conf.CommandArgs = p.CommandArgs
+	}
+	if p.FormData != "" {
+		conf.FormData = p.FormData
+	}
+	step.Conf = conf
+	if !p.Throttle.IsZero() {
+		step.Throttle = p.Throttle
+	}
+}
+
+// TemplateScope limits the scanned part of the target
+type TemplateScope struct {
+	Path    string   `json:"path,omitempty" bson:"path,omitempty" description:"path which is appended to the address of web targets, like /app"`
+	Exclude []string `json:"exclude,omitempty" bson:"exclude,omitempty" description:"patterns which plugins shouldn't scan, passed as the exclude param"`
+}
+
+// Address of the scanned target, the path is used only for web targets
+func (s *TemplateScope) Address(t *target.Target) string {
+	addr := t.Addr()
+	if s == nil || s.Path == "" || t.Type != target.TypeWeb {
+		return addr
+	}
+	return strings.TrimRight(addr, "/") + "/" + strings.TrimLeft(s.Path, "/")
+}
+
+type TemplateSchedule struct {
+	Override bool `json:"override,omitempty" bson:"override,omitempty" description:"start scans even if targets are outside of their scan windows"`
+}
+
+// Plugin returns overrides of the plugin, nil if there are none
+func (t *Template) Plugin(name string) *TemplatePlugin {
+	for _, p := range t.Plugins {
+		if p.Plugin == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// ScanParams returns params of scans from the template, the scope exclude is the exclude param
+func (t *Template) ScanParams() map[string]interface{} {
+	params := map[string]interface{}{}
+	for key, val := range t.Params {
+		params[key] = val
+	}
+	if t.Scope != nil && len(t.Scope.Exclude) > 0 {
+		params["exclude"] = t.Scope.Exclude
+	}
+	return params
+}
+
+// Override returns the copy of the template with values which are set in the other one,
+// params and plugins are merged by keys
+func (t *Template) Override(other *Template) *Template {
+	result := *t
+	if other == nil {
+		return &result
+	}
+	if other.Params != nil {
+		result.Params = map[string]interface{}{}
+		for key, val := range t.Params {
+			result.Params[key] = val
+		}
+		for key, val := range other.Params {
+			result.Params[key] = val
+		}
+	}
+	if len(other.Plugins) > 0 {
+		result.Plugins = append([]*TemplatePlugin{}, other.Plugins...)
+		for _, p := range t.Plugins {
+			if other.Plugin(p.Plugin) == nil {
+				result.Plugins = append(result.Plugins, p)
+			}
+		}
+	}
+	if other.Scope != nil {
+		result.Scope = other.Scope
+	}
+	if other.Schedule != nil {
+		result.Schedule = other.Schedule
+	}
+	return &result
+}
+
+type TemplateList struct {
+	pagination.Meta `json:",inline"`
+	Results         []*Template `json:"results"`
+}
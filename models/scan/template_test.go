@@ -0,0 +1,152 @@
+package scan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/target"
+)
+
+func TestTemplatePluginApply(t *testing.T) {
+	throttle := &target.Throttle{Concurrency: 1}
+	for _, tc := range []struct {
+		name   string
+		plugin *TemplatePlugin
+		step   *plan.WorkflowStep
+		conf   *plan.Conf
+		limit  *target.Throttle
+	}{
+		{
+			name:   "empty overrides keep the step",
+			plugin: &TemplatePlugin{Plugin: "nmap"},
+			step:   &plan.WorkflowStep{Conf: &plan.Conf{CommandArgs: "-sV", Target: "example.com"}, Throttle: throttle},
+			conf:   &plan.Conf{CommandArgs: "-sV", Target: "example.com"},
+			limit:  throttle,
+		},
+		{
+			name:   "args and form data are replaced",
+			plugin: &TemplatePlugin{Plugin: "nmap", CommandArgs: "-sS", FormData: `{"a":1}`},
+			step:   &plan.WorkflowStep{Conf: &plan.Conf{CommandArgs: "-sV", Target: "example.com"}},
+			conf:   &plan.Conf{CommandArgs: "-sS", FormData: `{"a":1}`, Target: "example.com"},
+		},
+		{
+			name:   "steps without conf get one",
+			plugin: &TemplatePlugin{Plugin: "nmap", CommandArgs: "-sS"},
+			step:   &plan.WorkflowStep{},
+			conf:   &plan.Conf{CommandArgs: "-sS"},
+		},
+		{
+			name:   "zero throttle doesn't remove the step one",
+			plugin: &TemplatePlugin{Plugin: "nmap", Throttle: &target.Throttle{}},
+			step:   &plan.WorkflowStep{Throttle: throttle},
+			conf:   &plan.Conf{},
+			limit:  throttle,
+		},
+		{
+			name:   "throttle is replaced",
+			plugin: &TemplatePlugin{Plugin: "nmap", Throttle: &target.Throttle{Rate: 2}},
+			step:   &plan.WorkflowStep{Throttle: throttle},
+			conf:   &plan.Conf{},
+			limit:  &target.Throttle{Rate: 2},
+		},
+	} {
+		orig := tc.step.Conf
+		var origConf plan.Conf
+		if orig != nil {
+			origConf = *orig
+		}
+		tc.plugin.Apply(tc.step)
+		require.Equal(t, tc.conf, tc.step.Conf, tc.name)
+		require.Equal(t, tc.limit, tc.step.Throttle, tc.name)
+		if orig != nil {
+			require.Equal(t, origConf, *orig, "%s: the conf of the plan isn't changed", tc.name)
+		}
+	}
+}
+
+func TestTemplateScopeAddress(t *testing.T) {
+	web := &target.Target{Type: target.TypeWeb, Web: &target.WebTarget{Domain: "http://example.com/"}}
+	for _, tc := range []struct {
+		name   string
+		scope  *TemplateScope
+		target *target.Target
+		addr   string
+	}{
+		{"nil scope", nil, web, "http://example.com/"},
+		{"empty path", &TemplateScope{}, web, "http://example.com/"},
+		{"path is appended", &TemplateScope{Path: "/app"}, web, "http://example.com/app"},
+		{"path without slash", &TemplateScope{Path: "app/"}, web, "http://example.com/app/"},
+		{"not web targets", &TemplateScope{Path: "/app"}, &target.Target{Type: target.TypeAndroid}, ""},
+	} {
+		require.Equal(t, tc.addr, tc.scope.Address(tc.target), tc.name)
+	}
+}
+
+func TestTemplateScanParams(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		tmpl   *Template
+		params map[string]interface{}
+	}{
+		{"empty", &Template{}, map[string]interface{}{}},
+		{"params", &Template{Params: map[string]interface{}{"depth": 2}}, map[string]interface{}{"depth": 2}},
+		{"empty exclude", &Template{Scope: &TemplateScope{Path: "/app"}}, map[string]interface{}{}},
+		{
+			"exclude is the param",
+			&Template{Params: map[string]interface{}{"depth": 2, "exclude": "old"}, Scope: &TemplateScope{Exclude: []string{"/logout"}}},
+			map[string]interface{}{"depth": 2, "exclude": []string{"/logout"}},
+		},
+	} {
+		require.Equal(t, tc.params, tc.tmpl.ScanParams(), tc.name)
+	}
+	// params of the template aren't changed
+	tmpl := &Template{Params: map[string]interface{}{"depth": 2}, Scope: &TemplateScope{Exclude: []string{"/logout"}}}
+	tmpl.ScanParams()
+	require.Equal(t, map[string]interface{}{"depth": 2}, tmpl.Params)
+}
+
+func TestTemplateOverride(t *testing.T) {
+	nmap := &TemplatePlugin{Plugin: "nmap", CommandArgs: "-sV"}
+	w3af := &TemplatePlugin{Plugin: "w3af", FormData: "{}"}
+	base := &Template{
+		Name:     "base",
+		Params:   map[string]interface{}{"depth": 1, "cookie": "a"},
+		Plugins:  []*TemplatePlugin{nmap, w3af},
+		Scope:    &TemplateScope{Path: "/app"},
+		Schedule: &TemplateSchedule{Override: true},
+	}
+	for _, tc := range []struct {
+		name   string
+		other  *Template
+		result *Template
+	}{
+		{"nil keeps the template", nil, base},
+		{"empty keeps the template", &Template{}, base},
+		{
+			"params are merged",
+			&Template{Params: map[string]interface{}{"depth": 3}},
+			&Template{Name: "base", Params: map[string]interface{}{"depth": 3, "cookie": "a"},
+				Plugins: base.Plugins, Scope: base.Scope, Schedule: base.Schedule},
+		},
+		{
+			"plugins are merged by names",
+			&Template{Plugins: []*TemplatePlugin{{Plugin: "nmap", CommandArgs: "-sS"}}},
+			&Template{Name: "base", Params: base.Params, Scope: base.Scope, Schedule: base.Schedule,
+				Plugins: []*TemplatePlugin{{Plugin: "nmap", CommandArgs: "-sS"}, w3af}},
+		},
+		{
+			"scope and schedule are replaced",
+			&Template{Scope: &TemplateScope{Exclude: []string{"/logout"}}, Schedule: &TemplateSchedule{}},
+			&Template{Name: "base", Params: base.Params, Plugins: base.Plugins,
+				Scope: &TemplateScope{Exclude: []string{"/logout"}}, Schedule: &TemplateSchedule{}},
+		},
+	} {
+		result := base.Override(tc.other)
+		require.Equal(t, tc.result, result, tc.name)
+		require.False(t, result == base, "%s: the copy is returned", tc.name)
+	}
+	require.Equal(t, map[string]interface{}{"depth": 1, "cookie": "a"}, base.Params, "the template isn't changed")
+	require.Equal(t, []*TemplatePlugin{nmap, w3af}, base.Plugins)
+}
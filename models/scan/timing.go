@@ -0,0 +1,88 @@
+package scan
+
+import (
+	"sort"
+	"time"
+)
+
+// Time spent by sessions of the plugin
+type PluginTiming struct {
+	Plugin   string  `json:"plugin" description:"plugin from the plan step"`
+	Sessions int     `json:"sessions" description:"number of timed sessions"`
+	Duration float64 `json:"duration" description:"total time in seconds"`
+	Average  float64 `json:"average" description:"average session time in seconds"`
+}
+
+type Timing struct {
+	Duration float64         `json:"duration" description:"seconds from the start to the end of the scan, up to now if the scan is working"`
+	Plugins  []*PluginTiming `json:"plugins" description:"time by plugin, the slowest first"`
+}
+
+// Duration of the session from the start to the end or now, false if the session isn't started
+func (p *Session) Duration(now time.Time) (time.Duration, bool) {
+	if p.Started == nil {
+		return 0, false
+	}
+	end := now
+	if p.Finished != nil {
+		end = *p.Finished
+	}
+	if end.Before(*p.Started) {
+		return 0, true
+	}
+	return end.Sub(*p.Started), true
+}
+
+// Timing of the scan and its sessions including children, sessions without plan step are timed as unknown
+func (p *Scan) GetTiming(now time.Time) *Timing {
+	timing := &Timing{Plugins: []*PluginTiming{}}
+	if p.Started != nil {
+		end := now
+		if p.Finished != nil {
+			end = *p.Finished
+		}
+		if end.After(*p.Started) {
+			timing.Duration = end.Sub(*p.Started).Seconds()
+		}
+	}
+	plugins := map[string]*PluginTiming{}
+	for _, sess := range p.GetAllSessions() {
+		d, ok := sess.Duration(now)
+		if !ok {
+			continue
+		}
+		name := "unknown"
+		if sess.Step != nil && sess.Step.Plugin != "" {
+			name = sess.Step.Plugin
+		}
+		pt := plugins[name]
+		if pt == nil {
+			pt = &PluginTiming{Plugin: name}
+			plugins[name] = pt
+			timing.Plugins = append(timing.Plugins, pt)
+		}
+		pt.Sessions++
+		pt.Duration += d.Seconds()
+	}
+	for _, pt := range timing.Plugins {
+		pt.Average = pt.Duration / float64(pt.Sessions)
+	}
+	SortTimings(timing.Plugins)
+	return timing
+}
+
+// Sort timings from the slowest plugin
+func SortTimings(timings []*PluginTiming) {
+	sort.Sort(byDuration(timings))
+}
+
+type byDuration []*PluginTiming
+
+func (s byDuration) Len() int      { return len(s) }
+func (s byDuration) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byDuration) Less(i, j int) bool {
+	if s[i].Duration != s[j].Duration {
+		return s[i].Duration > s[j].Duration
+	}
+	return s[i].Plugin < s[j].Plugin
+}
@@ -0,0 +1,77 @@
+package scan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/models/plan"
+)
+
+func at(t time.Time) *time.Time {
+	return &t
+}
+
+func TestSessionDuration(t *testing.T) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	_, ok := (&Session{}).Duration(now)
+	require.False(t, ok, "not started session isn't timed")
+
+	d, ok := (&Session{Dates: Dates{Started: at(now.Add(-time.Minute))}}).Duration(now)
+	require.True(t, ok)
+	require.Equal(t, time.Minute, d, "working session is timed up to now")
+
+	d, ok = (&Session{Dates: Dates{Started: at(now.Add(-time.Hour)), Finished: at(now.Add(-50 * time.Minute))}}).Duration(now)
+	require.True(t, ok)
+	require.Equal(t, 10*time.Minute, d)
+
+	d, ok = (&Session{Dates: Dates{Started: at(now), Finished: at(now.Add(-time.Minute))}}).Duration(now)
+	require.True(t, ok)
+	require.Equal(t, time.Duration(0), d, "clock skew doesn't give negative time")
+}
+
+func TestScanTiming(t *testing.T) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	session := func(plugin string, seconds int) *Session {
+		sess := &Session{Dates: Dates{Started: at(now.Add(-time.Hour)), Finished: at(now.Add(-time.Hour + time.Duration(seconds)*time.Second))}}
+		if plugin != "" {
+			sess.Step = &plan.WorkflowStep{Plugin: plugin}
+		}
+		return sess
+	}
+	nmap := session("nmap", 30)
+	nmap.Children = []*Session{session("w3af", 90)}
+	sc := &Scan{
+		Dates: Dates{Started: at(now.Add(-time.Hour)), Finished: at(now.Add(-time.Hour + 5*time.Minute))},
+		Sessions: []*Session{
+			nmap,
+			session("w3af", 30),
+			session("", 10),
+			{Step: &plan.WorkflowStep{Plugin: "wpscan"}},
+		},
+	}
+
+	timing := sc.GetTiming(now)
+	require.Equal(t, 300.0, timing.Duration)
+	require.Equal(t, []*PluginTiming{
+		{Plugin: "w3af", Sessions: 2, Duration: 120, Average: 60},
+		{Plugin: "nmap", Sessions: 1, Duration: 30, Average: 30},
+		{Plugin: "unknown", Sessions: 1, Duration: 10, Average: 10},
+	}, timing.Plugins, "children are included, not started sessions are skipped")
+
+	// working scan is timed up to now
+	sc.Finished = nil
+	require.Equal(t, 3600.0, sc.GetTiming(now).Duration)
+	require.Equal(t, 0.0, (&Scan{}).GetTiming(now).Duration)
+	require.Empty(t, (&Scan{}).GetTiming(now).Plugins)
+}
+
+func TestSortTimings(t *testing.T) {
+	timings := []*PluginTiming{{Plugin: "b", Duration: 1}, {Plugin: "c", Duration: 5}, {Plugin: "a", Duration: 1}}
+	SortTimings(timings)
+	require.Equal(t, "c", timings[0].Plugin)
+	require.Equal(t, "a", timings[1].Plugin, "plugins with the same time are sorted by name")
+	require.Equal(t, "b", timings[2].Plugin)
+}
@@ -0,0 +1,34 @@
+package search
+
+import (
+	"time"
+
+	"github.com/bearded-web/bearded/pkg/pagination"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Type of objects which are searched
+type Type string
+
+const (
+	TypeIssue Type = "issue"
+	TypeScan  Type = "scan"
+)
+
+// Search is a named query saved by the user, it's run by passing its id to the list endpoint
+type Search struct {
+	Id      bson.ObjectId `json:"id" bson:"_id"`
+	User    bson.ObjectId `json:"user" description:"owner of the search"`
+	Type    Type          `json:"type" description:"one of: [issue|scan]"`
+	Name    string        `json:"name"`
+	Query   string        `json:"query" description:"url encoded list parameters, e.g. severity=high&status=0"`
+	Default bool          `json:"default" description:"default view of the user for this type"`
+	Created time.Time     `json:"created,omitempty"`
+	Updated time.Time     `json:"updated,omitempty"`
+	Version int           `json:"version" description:"incremented on every update, send it back with If-Match header"`
+}
+
+type SearchList struct {
+	pagination.Meta `json:",inline"`
+	Results         []*Search `json:"results"`
+}
@@ -0,0 +1,69 @@
+package share
+
+import (
+	"encoding/json"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/pkg/pagination"
+)
+
+// Share links give read only access to one resource without login, until they are expired or revoked
+
+const TokenLength = 32
+
+type Resource string
+
+const (
+	// the scan with its reports and issues
+	ResourceScan Resource = "scan"
+	// issues of the project
+	ResourceProject Resource = "project"
+)
+
+var Resources = []Resource{ResourceScan, ResourceProject}
+
+// It's a hack to show custom type as string in swagger
+func (r Resource) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(r))
+}
+
+func (r Resource) Enum() []interface{} {
+	result := make([]interface{}, 0, len(Resources))
+	for _, v := range Resources {
+		result = append(result, v)
+	}
+	return result
+}
+
+func (r Resource) Convert(text string) (interface{}, error) {
+	return Resource(text), nil
+}
+
+type Share struct {
+	Id        bson.ObjectId `json:"id,omitempty" bson:"_id"`
+	Resource  Resource      `json:"resource" description:"one of: [scan|project]"`
+	Project   bson.ObjectId `json:"project"`
+	Scan      bson.ObjectId `json:"scan,omitempty" bson:",omitempty"`
+	Owner     bson.ObjectId `json:"owner" description:"user who created the link"`
+	Hash      string        `json:"-"`
+	HashValue string        `json:"value,omitempty" bson:"-" description:"token of the link, it's shown only after creation"`
+	Expire    time.Time     `json:"expire"`
+	Revoked   bool          `json:"revoked"`
+	Created   time.Time     `json:"created,omitempty"`
+	Updated   time.Time     `json:"updated,omitempty"`
+
+	LastUsed time.Time `json:"lastUsed,omitempty" bson:"lastUsed,omitempty"`
+	Uses     int       `json:"uses" description:"how many times the link is opened"`
+}
+
+// IsActive returns false if the link is revoked or expired
+func (s *Share) IsActive(now time.Time) bool {
+	return !s.Revoked && now.Before(s.Expire)
+}
+
+type ShareList struct {
+	pagination.Meta `json:",inline"`
+	Results         []*Share `json:"results"`
+}
@@ -0,0 +1,80 @@
+package stats
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+// CompareBy is the kind of rows of the comparison matrix
+type CompareBy string
+
+const (
+	// issues of the same vulndb type, issues without the type are compared by summary
+	CompareByType CompareBy = "type"
+	// issues with the same uniq id, it's the same finding on different targets
+	CompareByIssue CompareBy = "issue"
+	// issues of the same canonical class
+	CompareByClass CompareBy = "class"
+)
+
+var CompareBys = []CompareBy{CompareByType, CompareByIssue, CompareByClass}
+
+func (c CompareBy) IsValid() bool {
+	for _, val := range CompareBys {
+		if c == val {
+			return true
+		}
+	}
+	return false
+}
+
+// Comparison is the matrix of open issues by compared targets, the most widespread problems go first
+type Comparison struct {
+	Project bson.ObjectId     `json:"project,omitempty" description:"empty for comparison across all available projects"`
+	By      CompareBy         `json:"by"`
+	Targets []*ComparedTarget `json:"targets" description:"columns of the matrix"`
+	Rows    []*ComparisonRow  `json:"rows" description:"sorted by the number of affected targets and the severity"`
+	Created time.Time         `json:"created"`
+}
+
+type ComparedTarget struct {
+	Id      bson.ObjectId `json:"id"`
+	Project bson.ObjectId `json:"project"`
+	Addr    string        `json:"addr,omitempty"`
+	Rows    int           `json:"rows" description:"number of rows which affect the target"`
+}
+
+type ComparisonRow struct {
+	VulnType int            `json:"vulnType,omitempty" bson:"vulnType"`
+	UniqId   string         `json:"uniqId,omitempty" bson:"uniqId"`
+	Class    issue.Class    `json:"class,omitempty" bson:"class"`
+	Summary  string         `json:"summary,omitempty" bson:"summary"`
+	Severity issue.Severity `json:"severity" description:"the highest severity of issues in the row"`
+
+	Targets []bson.ObjectId `json:"targets" description:"affected targets"`
+	Count   int             `json:"count" description:"number of affected targets"`
+	Share   float64         `json:"share" bson:"-" description:"part of compared targets which are affected, from 0 to 1"`
+	Issues  int             `json:"issues" description:"number of open issues in the row"`
+}
+
+// SetTargets sets columns of the matrix and counts affected targets of rows and rows of targets
+func (c *Comparison) SetTargets(targets []*ComparedTarget) {
+	c.Targets = targets
+	index := map[bson.ObjectId]*ComparedTarget{}
+	for _, t := range targets {
+		index[t.Id] = t
+	}
+	for _, row := range c.Rows {
+		if len(targets) > 0 {
+			row.Share = float64(row.Count) / float64(len(targets))
+		}
+		for _, id := range row.Targets {
+			if t := index[id]; t != nil {
+				t.Rows++
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestComparisonSetTargets(t *testing.T) {
+	a, b, c, gone := bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()
+	comparison := &Comparison{Rows: []*ComparisonRow{
+		{UniqId: "xss", Targets: []bson.ObjectId{a, b}, Count: 2},
+		{UniqId: "sqli", Targets: []bson.ObjectId{a}, Count: 1},
+		// targets which aren't compared aren't counted
+		{UniqId: "csrf", Targets: []bson.ObjectId{gone}, Count: 1},
+	}}
+	targets := []*ComparedTarget{{Id: a}, {Id: b}, {Id: c}, {Id: bson.NewObjectId()}}
+	comparison.SetTargets(targets)
+
+	require.Equal(t, targets, comparison.Targets)
+	require.Equal(t, 2, targets[0].Rows)
+	require.Equal(t, 1, targets[1].Rows)
+	require.Equal(t, 0, targets[2].Rows, "targets without issues have no rows")
+	require.Equal(t, 0.5, comparison.Rows[0].Share)
+	require.Equal(t, 0.25, comparison.Rows[1].Share)
+	require.Equal(t, 0.25, comparison.Rows[2].Share)
+
+	// rows without targets don't divide by zero
+	empty := &Comparison{Rows: []*ComparisonRow{{UniqId: "xss", Count: 1}}}
+	empty.SetTargets([]*ComparedTarget{})
+	require.Equal(t, 0.0, empty.Rows[0].Share)
+	require.Empty(t, empty.Targets)
+}
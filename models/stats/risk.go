@@ -0,0 +1,146 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+// RiskIssue has fields of the issue which are needed for the risk score,
+// issues with the same fields are counted together
+type RiskIssue struct {
+	Target     bson.ObjectId  `bson:"target"`
+	Severity   issue.Severity `bson:"severity"`
+	Cvss       float64        `bson:"cvss"`
+	Created    time.Time      `bson:"created"`
+	Resolved   bool           `bson:"resolved"`
+	ResolvedAt time.Time      `bson:"resolvedAt"`
+	// zero is counted as one issue
+	Count int `bson:"count"`
+}
+
+func (i *RiskIssue) count() int {
+	if i.Count > 0 {
+		return i.Count
+	}
+	return 1
+}
+
+// Open returns true if the issue is open at the time, false and muted issues aren't taken
+func (i *RiskIssue) Open(at time.Time) bool {
+	if i.Created.After(at) {
+		return false
+	}
+	return !i.Resolved || i.ResolvedAt.After(at)
+}
+
+// RiskWeights is the formula of the risk score: the sum of weights of open issues.
+// The issue weighs as its severity or its cvss score, the weight grows with the age of the issue.
+type RiskWeights struct {
+	Severity map[issue.Severity]float64
+	// issues with cvss score weigh as the score
+	Cvss bool
+	// share of the weight which is added for every 30 days while the issue is open
+	Age float64
+	// days after which the weight doesn't grow, zero is unlimited
+	MaxAge int
+}
+
+// Weight of the issue at the time
+func (w *RiskWeights) Weight(i *RiskIssue, at time.Time) float64 {
+	weight := w.Severity[i.Severity]
+	if w.Cvss && i.Cvss > 0 {
+		weight = i.Cvss
+	}
+	days := at.Sub(i.Created).Hours() / 24
+	if w.MaxAge > 0 && days > float64(w.MaxAge) {
+		days = float64(w.MaxAge)
+	}
+	if days > 0 {
+		weight += weight * w.Age * days / 30
+	}
+	return weight
+}
+
+// Score of issues which are open at the time, it's rounded to one decimal
+func (w *RiskWeights) Score(issues []*RiskIssue, at time.Time) (float64, int) {
+	score, open := 0.0, 0
+	for _, i := range issues {
+		if !i.Open(at) {
+			continue
+		}
+		score += w.Weight(i, at) * float64(i.count())
+		open += i.count()
+	}
+	return round(score), open
+}
+
+func round(val float64) float64 {
+	return math.Floor(val*10+0.5) / 10
+}
+
+type TargetRisk struct {
+	Target bson.ObjectId `json:"target"`
+	Score  float64       `json:"score"`
+	Open   int           `json:"open"`
+}
+
+// Score at the end of the interval started from the date
+type RiskPoint struct {
+	Date  time.Time `json:"date"`
+	Score float64   `json:"score"`
+}
+
+type Risk struct {
+	Project  bson.ObjectId `json:"project,omitempty" description:"empty for the risk of all available projects"`
+	Target   bson.ObjectId `json:"target,omitempty"`
+	Score    float64       `json:"score" description:"sum of weights of open issues"`
+	Open     int           `json:"open" description:"open issues which make the score"`
+	Targets  []*TargetRisk `json:"targets" description:"scores of targets, the riskiest first"`
+	Interval Interval      `json:"interval"`
+	Trend    []*RiskPoint  `json:"trend"`
+	Created  time.Time     `json:"created"`
+}
+
+// Fill the risk from issues which were open in [from, to) period
+func (w *RiskWeights) Fill(r *Risk, issues []*RiskIssue, from, to time.Time) {
+	r.Score, r.Open = w.Score(issues, to)
+
+	byTarget := map[bson.ObjectId][]*RiskIssue{}
+	for _, i := range issues {
+		byTarget[i.Target] = append(byTarget[i.Target], i)
+	}
+	r.Targets = []*TargetRisk{}
+	for id, targetIssues := range byTarget {
+		tr := &TargetRisk{Target: id}
+		if tr.Score, tr.Open = w.Score(targetIssues, to); tr.Open > 0 {
+			r.Targets = append(r.Targets, tr)
+		}
+	}
+	sort.Sort(targetsByScore(r.Targets))
+
+	r.Trend = []*RiskPoint{}
+	for start := from; start.Before(to); start = r.Interval.Next(start) {
+		end := r.Interval.Next(start)
+		if end.After(to) {
+			end = to
+		}
+		score, _ := w.Score(issues, end)
+		r.Trend = append(r.Trend, &RiskPoint{Date: start, Score: score})
+	}
+}
+
+type targetsByScore []*TargetRisk
+
+func (t targetsByScore) Len() int      { return len(t) }
+func (t targetsByScore) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t targetsByScore) Less(i, j int) bool {
+	if t[i].Score != t[j].Score {
+		return t[i].Score > t[j].Score
+	}
+	return t[i].Target < t[j].Target
+}
@@ -0,0 +1,82 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+func TestRiskWeight(t *testing.T) {
+	now := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	w := &RiskWeights{Severity: map[issue.Severity]float64{issue.SeverityHigh: 10, issue.SeverityLow: 1}}
+	high := &RiskIssue{Severity: issue.SeverityHigh, Cvss: 7.5, Created: now.AddDate(0, 0, -60)}
+	require.Equal(t, 10.0, w.Weight(high, now))
+	require.Equal(t, 0.0, w.Weight(&RiskIssue{Severity: issue.SeverityInfo}, now), "unknown severities weigh nothing")
+
+	w.Cvss = true
+	require.Equal(t, 7.5, w.Weight(high, now))
+	require.Equal(t, 1.0, w.Weight(&RiskIssue{Severity: issue.SeverityLow, Created: now}, now), "issues without cvss weigh as severity")
+
+	w.Cvss, w.Age = false, 0.1
+	require.InDelta(t, 12.0, w.Weight(high, now), 0.0001, "the weight grows for every 30 days")
+	w.MaxAge = 30
+	require.InDelta(t, 11.0, w.Weight(high, now), 0.0001, "the age is limited")
+	require.Equal(t, 10.0, w.Weight(&RiskIssue{Severity: issue.SeverityHigh, Created: now.Add(time.Hour)}, now),
+		"issues from the future don't lose weight")
+}
+
+func TestRiskScore(t *testing.T) {
+	now := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	w := &RiskWeights{Severity: map[issue.Severity]float64{issue.SeverityHigh: 10, issue.SeverityLow: 0.25}}
+	issues := []*RiskIssue{
+		{Severity: issue.SeverityHigh, Created: now.AddDate(0, 0, -1)},
+		{Severity: issue.SeverityLow, Created: now.AddDate(0, 0, -1), Count: 3},
+		// resolved before the time
+		{Severity: issue.SeverityHigh, Created: now.AddDate(0, 0, -2), Resolved: true, ResolvedAt: now.AddDate(0, 0, -1)},
+		// resolved after the time
+		{Severity: issue.SeverityHigh, Created: now.AddDate(0, 0, -2), Resolved: true, ResolvedAt: now.Add(time.Hour)},
+		// created after the time
+		{Severity: issue.SeverityHigh, Created: now.Add(time.Hour)},
+	}
+	score, open := w.Score(issues, now)
+	require.Equal(t, 20.8, score, "the score is rounded to one decimal")
+	require.Equal(t, 5, open, "grouped issues are counted by their count")
+
+	score, open = w.Score(nil, now)
+	require.Equal(t, 0.0, score)
+	require.Equal(t, 0, open)
+}
+
+func TestRiskFill(t *testing.T) {
+	from := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 3)
+	w := &RiskWeights{Severity: map[issue.Severity]float64{issue.SeverityHigh: 10, issue.SeverityLow: 1}}
+	first, second := bson.NewObjectId(), bson.NewObjectId()
+	if second < first {
+		first, second = second, first
+	}
+	issues := []*RiskIssue{
+		{Target: first, Severity: issue.SeverityHigh, Created: from.AddDate(0, 0, -1)},
+		{Target: second, Severity: issue.SeverityHigh, Created: from.AddDate(0, 0, 1)},
+		{Target: second, Severity: issue.SeverityLow, Created: from, Resolved: true, ResolvedAt: from.AddDate(0, 0, 2)},
+		// targets without open issues aren't listed
+		{Target: bson.NewObjectId(), Severity: issue.SeverityLow, Created: from, Resolved: true, ResolvedAt: from.AddDate(0, 0, 1)},
+	}
+	r := &Risk{Interval: IntervalDay}
+	w.Fill(r, issues, from, to)
+	require.Equal(t, 20.0, r.Score)
+	require.Equal(t, 2, r.Open)
+	require.Equal(t, []*TargetRisk{
+		{Target: first, Score: 10, Open: 1},
+		{Target: second, Score: 10, Open: 1},
+	}, r.Targets, "targets with the same score are sorted by id")
+	require.Equal(t, []*RiskPoint{
+		{Date: from, Score: 21},
+		{Date: from.AddDate(0, 0, 1), Score: 20},
+		{Date: from.AddDate(0, 0, 2), Score: 20},
+	}, r.Trend, "the score is taken at the end of every interval")
+}
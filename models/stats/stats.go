@@ -0,0 +1,92 @@
+package stats
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/scan"
+)
+
+type Issues struct {
+	Total     int                    `json:"total"`
+	Open      int                    `json:"open" description:"not resolved, false or muted issues"`
+	Confirmed int                    `json:"confirmed"`
+	Resolved  int                    `json:"resolved"`
+	False     int                    `json:"false"`
+	Muted     int                    `json:"muted"`
+	Severity  map[issue.Severity]int `json:"severity" description:"open issues by severity"`
+}
+
+// Interval of trend points
+type Interval string
+
+const (
+	IntervalDay   Interval = "day"
+	IntervalWeek  Interval = "week" // weeks start on Monday
+	IntervalMonth Interval = "month"
+)
+
+var Intervals = []Interval{IntervalDay, IntervalWeek, IntervalMonth}
+
+// Start of the interval which contains the time, in UTC
+func (i Interval) Start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch i {
+	case IntervalWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case IntervalMonth:
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day
+}
+
+// Start of the next interval
+func (i Interval) Next(t time.Time) time.Time {
+	switch i {
+	case IntervalWeek:
+		return t.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+func (i Interval) IsValid() bool {
+	for _, interval := range Intervals {
+		if i == interval {
+			return true
+		}
+	}
+	return false
+}
+
+// Point of the issue trend, counts of issues opened and resolved in the period started from the date
+type TrendPoint struct {
+	Date     time.Time `json:"date"`
+	Opened   int       `json:"opened"`
+	Resolved int       `json:"resolved"`
+	Open     int       `json:"open" description:"issues which aren't resolved at the end of the period"`
+}
+
+type Trend struct {
+	Project  bson.ObjectId    `json:"project,omitempty" description:"empty for trend of all available projects"`
+	Severity []issue.Severity `json:"severity,omitempty"`
+	Interval Interval         `json:"interval"`
+	From     time.Time        `json:"from"`
+	To       time.Time        `json:"to"`
+	Points   []*TrendPoint    `json:"points"`
+}
+
+type Stats struct {
+	Project bson.ObjectId           `json:"project,omitempty" description:"empty for stats of all available projects"`
+	Issues  *Issues                 `json:"issues"`
+	Scans   map[scan.ScanStatus]int `json:"scans" description:"scans by status"`
+	Targets int                     `json:"targets" description:"active targets"`
+	Risk    float64                 `json:"risk" description:"risk score of open issues"`
+	Trend   []*TrendPoint           `json:"trend" description:"issues opened and resolved by day"`
+	Plugins []*scan.PluginTiming    `json:"plugins" description:"time of plugins in scans finished in the trend period, the slowest first"`
+	Created time.Time               `json:"created" description:"when stats are calculated, they could be cached for a while"`
+}
@@ -0,0 +1,80 @@
+package stats
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/pkg/pagination"
+)
+
+// TopBy is the kind of the most common issues
+type TopBy string
+
+const (
+	// vulndb types, issues without the type are counted by summary
+	TopByType TopBy = "type"
+	// cwe ids of vulndb types, issues of types without cwes aren't counted
+	TopByCwe TopBy = "cwe"
+)
+
+var TopBys = []TopBy{TopByType, TopByCwe}
+
+func (t TopBy) IsValid() bool {
+	return t == TopByType || t == TopByCwe
+}
+
+// TopStatus selects issues which are counted in top vulns
+type TopStatus string
+
+const (
+	TopOpen      TopStatus = "open"
+	TopConfirmed TopStatus = "confirmed"
+	TopResolved  TopStatus = "resolved"
+	TopFalse     TopStatus = "false"
+	TopMuted     TopStatus = "muted"
+	TopAll       TopStatus = "all"
+)
+
+var TopStatuses = []TopStatus{TopOpen, TopConfirmed, TopResolved, TopFalse, TopMuted, TopAll}
+
+func (t TopStatus) IsValid() bool {
+	for _, val := range TopStatuses {
+		if t == val {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns the issue query for the status, it's empty for all issues
+func (t TopStatus) Query() bson.M {
+	switch t {
+	case TopConfirmed:
+		return bson.M{"confirmed": true}
+	case TopResolved:
+		return bson.M{"resolved": true}
+	case TopFalse:
+		return bson.M{"false": true}
+	case TopMuted:
+		return bson.M{"muted": true}
+	case TopAll:
+		return bson.M{}
+	}
+	return bson.M{"resolved": false, "false": false, "muted": false}
+}
+
+type TopVuln struct {
+	VulnType int            `json:"vulnType,omitempty"`
+	Cwe      string         `json:"cwe,omitempty"`
+	Title    string         `json:"title" description:"title of the vulndb type or summary of issues without the type"`
+	Severity issue.Severity `json:"severity" description:"the highest severity of counted issues"`
+	Count    int            `json:"count" description:"number of issues"`
+	Targets  int            `json:"targets" description:"number of affected targets"`
+}
+
+type TopVulnList struct {
+	pagination.Meta `json:",inline"`
+	Project         bson.ObjectId `json:"project,omitempty" description:"empty for all available projects"`
+	By              TopBy         `json:"by"`
+	Results         []*TopVuln    `json:"results"`
+}
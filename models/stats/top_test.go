@@ -0,0 +1,31 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestTopStatusQuery(t *testing.T) {
+	for _, tc := range []struct {
+		status TopStatus
+		query  bson.M
+	}{
+		{TopOpen, bson.M{"resolved": false, "false": false, "muted": false}},
+		{TopConfirmed, bson.M{"confirmed": true}},
+		{TopResolved, bson.M{"resolved": true}},
+		{TopFalse, bson.M{"false": true}},
+		{TopMuted, bson.M{"muted": true}},
+		{TopAll, bson.M{}},
+		// unknown statuses are rejected by IsValid, the query falls back to open issues
+		{TopStatus("fixed"), bson.M{"resolved": false, "false": false, "muted": false}},
+	} {
+		require.Equal(t, tc.query, tc.status.Query(), string(tc.status))
+	}
+	for _, status := range TopStatuses {
+		require.True(t, status.IsValid())
+	}
+	require.False(t, TopStatus("fixed").IsValid())
+	require.False(t, TopStatus("").IsValid())
+}
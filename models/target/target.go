@@ -22,6 +22,18 @@ type Target struct {
 	Project bson.ObjectId  `json:"project"`
 	Created time.Time      `json:"created,omitempty"`
 	Updated time.Time      `json:"updated,omitempty"`
+	Version int            `json:"version" description:"incremented on every update, send it back with If-Match header"`
+	Tags    []string       `json:"tags,omitempty" bson:"tags,omitempty" description:"key or key=value labels"`
+
+	Compliance []string  `json:"compliance,omitempty" bson:"compliance,omitempty" description:"compliance frameworks which the target is in scope of, frameworks of the project are added to them"`
+	Windows    []*Window `json:"windows,omitempty" bson:"windows,omitempty" description:"scans are dispatched only in these windows, any time if empty"`
+
+	Throttle *Throttle `json:"throttle,omitempty" bson:"throttle,omitempty" description:"load of plugins for fragile targets, the stricter of it and the plugin one is used"`
+
+	History int `json:"history,omitempty" bson:"history,omitempty" description:"done scans which are kept, the cap of the project or the dispatcher is used if zero"`
+
+	Inactive    bool      `json:"inactive" bson:"inactive,omitempty" description:"target is out of service, it isn't scanned but keeps issues and scans"`
+	Deactivated time.Time `json:"deactivated,omitempty" bson:"deactivated,omitempty"`
 
 	SummaryReport *SummaryReport `json:"summaryReport,omitempty" bson:"summaryReport"`
 }
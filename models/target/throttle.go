@@ -0,0 +1,43 @@
+package target
+
+import "fmt"
+
+// Throttle describes the load of plugins on the target, zero values aren't limited.
+// The concurrency is enforced by the agent, the rate is only a hint which plugins follow themselves.
+// It's declared by plugins and plan steps, targets make it stricter for fragile assets.
+type Throttle struct {
+	Rate        float64 `json:"rate,omitempty" bson:"rate,omitempty" description:"requests per second which the plugin is asked to keep to, it isn't enforced"`
+	Concurrency int     `json:"concurrency,omitempty" bson:"concurrency,omitempty" description:"max sessions against the target which the agent runs at the same time"`
+}
+
+func (t *Throttle) Validate() error {
+	if t.Rate < 0 || t.Concurrency < 0 {
+		return fmt.Errorf("limits shouldn't be negative")
+	}
+	return nil
+}
+
+func (t *Throttle) IsZero() bool {
+	return t == nil || (t.Rate == 0 && t.Concurrency == 0)
+}
+
+// Stricter returns the throttle with the lowest limits of both, nil if neither is limited
+func (t *Throttle) Stricter(other *Throttle) *Throttle {
+	if t.IsZero() {
+		if other.IsZero() {
+			return nil
+		}
+		result := *other
+		return &result
+	}
+	result := *t
+	if !other.IsZero() {
+		if other.Rate > 0 && (result.Rate == 0 || other.Rate < result.Rate) {
+			result.Rate = other.Rate
+		}
+		if other.Concurrency > 0 && (result.Concurrency == 0 || other.Concurrency < result.Concurrency) {
+			result.Concurrency = other.Concurrency
+		}
+	}
+	return &result
+}
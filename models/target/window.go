@@ -0,0 +1,127 @@
+package target
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Window is a period of week when the target can be scanned
+type Window struct {
+	Days     []string `json:"days,omitempty" bson:"days,omitempty" description:"days of week [mon|tue|wed|thu|fri|sat|sun], every day if empty"`
+	Start    string   `json:"start" description:"start time in form of 15:04"`
+	End      string   `json:"end" description:"end time in form of 15:04, the window lasts over midnight if it's before the start"`
+	Timezone string   `json:"timezone,omitempty" bson:"timezone,omitempty" description:"IANA timezone, e.g. Europe/Moscow, UTC if empty"`
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// windows are checked for every queued scan, so timezones aren't loaded from the disk every time
+var locations = struct {
+	sync.RWMutex
+	byName map[string]*time.Location
+}{byName: map[string]*time.Location{}}
+
+func loadLocation(name string) (*time.Location, error) {
+	locations.RLock()
+	loc, ok := locations.byName[name]
+	locations.RUnlock()
+	if ok {
+		return loc, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Lock()
+	locations.byName[name] = loc
+	locations.Unlock()
+	return loc, nil
+}
+
+func (w *Window) Validate() error {
+	_, _, _, err := w.parse()
+	return err
+}
+
+// Contains returns true if the time is in the window, the day of windows lasting over midnight is the start day
+func (w *Window) Contains(now time.Time) bool {
+	loc, start, end, err := w.parse()
+	if err != nil {
+		return false
+	}
+	local := now.In(loc)
+	minutes := local.Hour()*60 + local.Minute()
+	day := local.Weekday()
+	switch {
+	case start == end:
+		return w.hasDay(day)
+	case start < end:
+		return minutes >= start && minutes < end && w.hasDay(day)
+	case minutes >= start:
+		return w.hasDay(day)
+	case minutes < end:
+		return w.hasDay((day + 6) % 7)
+	}
+	return false
+}
+
+func (w *Window) hasDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if strings.ToLower(d) == weekdays[day] {
+			return true
+		}
+	}
+	return false
+}
+
+// start and end are returned in minutes since midnight
+func (w *Window) parse() (*time.Location, int, int, error) {
+	loc, err := loadLocation(w.Timezone)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("unknown timezone %s", w.Timezone)
+	}
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	for _, d := range w.Days {
+		known := false
+		for _, wd := range weekdays {
+			known = known || strings.ToLower(d) == wd
+		}
+		if !known {
+			return nil, 0, 0, fmt.Errorf("unknown day %s, it should be one of %v", d, weekdays)
+		}
+	}
+	return loc, start, end, nil
+}
+
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("time %q should be in form of 15:04", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// InWindow returns true if the target can be scanned at the time, targets without windows can be scanned any time
+func (t *Target) InWindow(now time.Time) bool {
+	if len(t.Windows) == 0 {
+		return true
+	}
+	for _, w := range t.Windows {
+		if w.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
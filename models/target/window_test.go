@@ -0,0 +1,91 @@
+package target
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindowValidate(t *testing.T) {
+	valid := []*Window{
+		{Start: "01:00", End: "05:00"},
+		{Start: "22:00", End: "02:00", Days: []string{"Sat", "sun"}, Timezone: "Europe/Moscow"},
+		{Start: "00:00", End: "00:00"},
+	}
+	for _, w := range valid {
+		require.NoError(t, w.Validate(), "%#v", w)
+	}
+	invalid := map[string]*Window{
+		"empty":            {},
+		"wrong start":      {Start: "1am", End: "05:00"},
+		"wrong end":        {Start: "01:00", End: "25:00"},
+		"unknown day":      {Start: "01:00", End: "05:00", Days: []string{"monday"}},
+		"unknown timezone": {Start: "01:00", End: "05:00", Timezone: "Mars/Olympus"},
+	}
+	for name, w := range invalid {
+		require.Error(t, w.Validate(), name)
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	// 2015-06-06 is saturday
+	utc := func(day, hour, min int) time.Time {
+		return time.Date(2015, 6, day, hour, min, 0, 0, time.UTC)
+	}
+	cases := []struct {
+		name   string
+		window *Window
+		now    time.Time
+		in     bool
+	}{
+		{"inside", &Window{Start: "01:00", End: "05:00"}, utc(6, 3, 0), true},
+		{"start is included", &Window{Start: "01:00", End: "05:00"}, utc(6, 1, 0), true},
+		{"end is excluded", &Window{Start: "01:00", End: "05:00"}, utc(6, 5, 0), false},
+		{"before", &Window{Start: "01:00", End: "05:00"}, utc(6, 0, 59), false},
+
+		{"before midnight", &Window{Start: "22:00", End: "02:00"}, utc(6, 23, 0), true},
+		{"after midnight", &Window{Start: "22:00", End: "02:00"}, utc(6, 1, 0), true},
+		{"outside of midnight window", &Window{Start: "22:00", End: "02:00"}, utc(6, 12, 0), false},
+		// the day of the window over midnight is the start day
+		{"after midnight of the start day", &Window{Start: "22:00", End: "02:00", Days: []string{"sat"}}, utc(7, 1, 0), true},
+		{"after midnight of another day", &Window{Start: "22:00", End: "02:00", Days: []string{"sat"}}, utc(6, 1, 0), false},
+		{"before midnight of another day", &Window{Start: "22:00", End: "02:00", Days: []string{"sun"}}, utc(6, 23, 0), false},
+
+		{"same start and end is the whole day", &Window{Start: "10:00", End: "10:00"}, utc(6, 3, 0), true},
+		{"same start and end of another day", &Window{Start: "10:00", End: "10:00", Days: []string{"mon"}}, utc(6, 3, 0), false},
+
+		{"empty days are every day", &Window{Start: "01:00", End: "05:00", Days: []string{}}, utc(8, 3, 0), true},
+		{"days are case insensitive", &Window{Start: "01:00", End: "05:00", Days: []string{"SAT"}}, utc(6, 3, 0), true},
+		{"another day", &Window{Start: "01:00", End: "05:00", Days: []string{"mon", "tue"}}, utc(6, 3, 0), false},
+
+		{"timezone", &Window{Start: "01:00", End: "05:00", Timezone: "Europe/Moscow"}, utc(6, 0, 0), true},
+		{"timezone changes the day", &Window{Start: "01:00", End: "05:00", Days: []string{"sun"}, Timezone: "Europe/Moscow"},
+			utc(6, 22, 30), true},
+		// clocks go forward at 2:00 on 2015-03-08 in New York, windows use the local wall clock
+		{"dst start day", &Window{Start: "01:00", End: "04:00", Timezone: "America/New_York"},
+			time.Date(2015, 3, 8, 3, 30, 0, 0, ny), true},
+		{"dst start day skipped hour", &Window{Start: "02:00", End: "03:00", Timezone: "America/New_York"},
+			time.Date(2015, 3, 8, 1, 59, 0, 0, ny).Add(time.Minute), false},
+		// clocks go back at 2:00 on 2015-11-01, both 1:30 are in the window
+		{"dst end day", &Window{Start: "01:00", End: "02:00", Timezone: "America/New_York"},
+			time.Date(2015, 11, 1, 5, 30, 0, 0, time.UTC), true},
+		{"dst end day repeated hour", &Window{Start: "01:00", End: "02:00", Timezone: "America/New_York"},
+			time.Date(2015, 11, 1, 6, 30, 0, 0, time.UTC), true},
+
+		{"invalid window", &Window{Start: "01:00", End: "05:00", Timezone: "Mars/Olympus"}, utc(6, 3, 0), false},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.in, c.window.Contains(c.now), c.name)
+	}
+}
+
+func TestInWindow(t *testing.T) {
+	now := time.Date(2015, 6, 6, 3, 0, 0, 0, time.UTC)
+	require.True(t, (&Target{}).InWindow(now))
+	tg := &Target{Windows: []*Window{{Start: "10:00", End: "12:00"}, {Start: "02:00", End: "04:00"}}}
+	require.True(t, tg.InWindow(now))
+	require.False(t, tg.InWindow(now.Add(3*time.Hour)))
+}
@@ -10,6 +10,14 @@ import (
 const TokenLength = 32
 const DefaultScope = "all"
 
+// Roles of project tokens
+const (
+	RoleMember = "member" // the same access to the project as a member has
+	RoleViewer = "viewer" // read only access to the project
+)
+
+var Roles = []string{RoleMember, RoleViewer}
+
 type Token struct {
 	Id        bson.ObjectId `json:"id,omitempty" bson:"_id"`
 	User      bson.ObjectId `json:"user"`
@@ -17,9 +25,24 @@ type Token struct {
 	Hash      string        `json:"-"`
 	HashValue string        `json:"value" bson:"-"`
 	Scopes    []string      `json:"scopes,omitempty"`
+	Project   bson.ObjectId `json:"project,omitempty" bson:",omitempty" description:"project tokens have access only to this project"`
+	Role      string        `json:"role,omitempty" bson:",omitempty" description:"role of project token, one of: [member|viewer]"`
 	Created   time.Time     `json:"created,omitempty"`
 	Updated   time.Time     `json:"updated,omitempty"`
 	Removed   bool          `json:"-"`
+
+	LastUsed time.Time `json:"lastUsed,omitempty" bson:"lastUsed,omitempty" description:"when the token was used, it's updated at most once per a few minutes"`
+	LastIp   string    `json:"lastIp,omitempty" bson:"lastIp,omitempty" description:"client ip of the last use"`
+	Stale    bool      `json:"stale" bson:"-" description:"the token isn't used for a long time, it could be revoked"`
+}
+
+// IsStale returns true if the token isn't used since the time, tokens which are never used are checked by creation
+func (t *Token) IsStale(since time.Time) bool {
+	used := t.LastUsed
+	if used.IsZero() {
+		used = t.Created
+	}
+	return !t.Removed && used.Before(since)
 }
 
 type TokenList struct {
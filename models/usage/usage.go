@@ -0,0 +1,101 @@
+package usage
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/pkg/pagination"
+)
+
+// Usage of the api is counted by users in hourly buckets, buckets are removed after the longest window.
+// Requests with api tokens are counted in buckets of the tokens, usage of the user is the sum of all its buckets.
+
+// Window of usage which ends now
+type Window string
+
+const (
+	WindowHour  Window = "hour"
+	WindowDay   Window = "day"
+	WindowMonth Window = "month"
+)
+
+var Windows = []Window{WindowHour, WindowDay, WindowMonth}
+
+func (w Window) IsValid() bool {
+	for _, val := range Windows {
+		if w == val {
+			return true
+		}
+	}
+	return false
+}
+
+// Duration of the window, a month is 30 days
+func (w Window) Duration() time.Duration {
+	switch w {
+	case WindowHour:
+		return time.Hour
+	case WindowMonth:
+		return time.Hour * 24 * 30
+	}
+	return time.Hour * 24
+}
+
+// Since returns the start of the first bucket in the window
+func (w Window) Since(now time.Time) time.Time {
+	return now.UTC().Truncate(time.Hour).Add(time.Hour - w.Duration())
+}
+
+// Bucket counts usage of the user in the hour, the token is empty for requests of sessions and for scans
+type Bucket struct {
+	Id       bson.ObjectId `json:"id,omitempty" bson:"_id"`
+	User     bson.ObjectId `json:"user"`
+	Token    bson.ObjectId `json:"token,omitempty" bson:",omitempty"`
+	Hour     time.Time     `json:"hour"`
+	Requests int           `json:"requests"`
+	Scans    int           `json:"scans"`
+}
+
+// Counts of the user in the window
+type Counts struct {
+	Window   Window `json:"window"`
+	Requests int    `json:"requests"`
+	Scans    int    `json:"scans"`
+}
+
+// Quota is the max usage in 24 hours, zero is unlimited
+type Quota struct {
+	Requests int `json:"requests"`
+	Scans    int `json:"scans"`
+}
+
+// TokenCounts are requests with the api token in the window
+type TokenCounts struct {
+	Token    bson.ObjectId `json:"token" bson:"_id"`
+	Name     string        `json:"name,omitempty" bson:"-"`
+	Requests int           `json:"requests"`
+}
+
+type Usage struct {
+	User      bson.ObjectId  `json:"user"`
+	Windows   []*Counts      `json:"windows"`
+	Tokens    []*TokenCounts `json:"tokens" description:"requests with api tokens of the user in the day window"`
+	Quota     Quota          `json:"quota" description:"quotas of the user, admins aren't limited"`
+	Remaining Quota          `json:"remaining" description:"usage left in the day window, it's -1 for unlimited values"`
+}
+
+// Consumer is the user with its usage in the window
+type Consumer struct {
+	User     bson.ObjectId `json:"user" bson:"_id"`
+	Email    string        `json:"email,omitempty" bson:"-"`
+	Requests int           `json:"requests"`
+	Scans    int           `json:"scans"`
+}
+
+type ConsumerList struct {
+	pagination.Meta `json:",inline"`
+	Window          Window      `json:"window"`
+	By              string      `json:"by" description:"requests or scans"`
+	Results         []*Consumer `json:"results"`
+}
@@ -14,11 +14,28 @@ type User struct {
 	Email    string        `json:"email"`
 	Password string        `json:"-"` // password hash in passlib format: $hashAlgo[$values]$hexdigest_hash$
 	Avatar   string        `json:"avatar,omitempty"`
+	Locale   string        `json:"locale,omitempty" bson:"locale,omitempty" description:"preferred language of emails, like en or pt-br"`
+	Timezone string        `json:"timezone,omitempty" bson:"timezone,omitempty" description:"IANA timezone for times in emails and new scan windows, UTC if empty"`
 
 	Created time.Time `json:"created,omitempty"`
 	Updated time.Time `json:"updated,omitempty"`
 
 	Admin bool `json:"admin" bson:"-"`
+
+	// service accounts are created for project tokens and have access only to this project
+	Project bson.ObjectId `json:"project,omitempty" bson:",omitempty"`
+}
+
+// Location returns the timezone of the user, UTC is returned for empty or unknown timezones
+func (u *User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
 }
 
 func (u *User) String() string {
@@ -30,6 +47,11 @@ func (u *User) IdStr() string {
 	return fmt.Sprintf("%x", string(u.Id))
 }
 
+// Service account isn't a human, it's bound to one project
+func (u *User) IsService() bool {
+	return u.Project != ""
+}
+
 func (u *User) IsAdmin() bool {
 	return false
 }
@@ -24,6 +24,7 @@ type Vuln struct {
 	References  []Reference      `json:"references"`
 	Wasc        []string         `json:"wasc,omitempty"`
 	Cwe         []string         `json:"cwe,omitempty"`
+	Cve         []string         `json:"cve,omitempty" description:"cve ids from references, like CVE-2014-6271"`
 	OwaspTop10  map[string][]int `json:"owasp_top_10,omitempty"`
 	Fix         VulnFix          `json:"fix"`
 }
@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/pkg/pagination"
+)
+
+// Deliveries are attempts to post alerts to webhooks, they are kept to debug failed webhooks and replay them.
+// Subscriptions are alerters configured with webhooks, they are named by the key of the payload, e.g. event or incident.
+
+type Status string
+
+const (
+	StatusDelivered Status = "delivered"
+	StatusFailed    Status = "failed"
+)
+
+var statuses = []interface{}{
+	StatusDelivered,
+	StatusFailed,
+}
+
+// It's a hack to show custom type as string in swagger
+func (t Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(t))
+}
+
+func (t Status) Enum() []interface{} {
+	return statuses
+}
+
+func (t Status) Convert(text string) (interface{}, error) {
+	return Status(text), nil
+}
+
+type Delivery struct {
+	Id           bson.ObjectId `json:"id,omitempty" bson:"_id"`
+	Subscription string        `json:"subscription" description:"alerts which are delivered, event or incident"`
+	Type         string        `json:"type" description:"type of the delivered event or incident"`
+	Url          string        `json:"url"`
+	Body         string        `json:"body" description:"posted json"`
+	Status       Status        `json:"status" description:"one of [delivered|failed]"`
+	Code         int           `json:"code,omitempty" bson:"code,omitempty" description:"http status of the response"`
+	Error        string        `json:"error,omitempty" bson:"error,omitempty"`
+	Duration     int64         `json:"duration" description:"request time in milliseconds"`
+	Created      time.Time     `json:"created"`
+	Replay       bson.ObjectId `json:"replay,omitempty" bson:"replay,omitempty" description:"replayed delivery"`
+}
+
+type DeliveryList struct {
+	pagination.Meta `json:",inline"`
+	Results         []*Delivery `json:"results"`
+}
+
+type Subscription struct {
+	Name  string   `json:"name" description:"event or incident"`
+	Url   string   `json:"url"`
+	Types []string `json:"types" description:"alerted types, all types if empty"`
+}
+
+type SubscriptionList struct {
+	pagination.Meta `json:",inline"`
+	Results         []*Subscription `json:"results"`
+}
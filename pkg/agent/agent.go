@@ -6,13 +6,14 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/facebookgo/stackerr"
 	dockerclient "github.com/fsouza/go-dockerclient"
 	"golang.org/x/net/context"
 	"gopkg.in/fatih/set.v0"
+	"gopkg.in/mgo.v2/bson"
 
 	"github.com/bearded-web/bearded/models/agent"
 	"github.com/bearded-web/bearded/models/plugin"
@@ -21,19 +22,36 @@ import (
 	"github.com/bearded-web/bearded/pkg/client"
 	"github.com/bearded-web/bearded/pkg/config"
 	"github.com/bearded-web/bearded/pkg/docker"
+	"github.com/bearded-web/bearded/pkg/logging"
+	"github.com/bearded-web/bearded/pkg/transport"
 	"github.com/bearded-web/bearded/pkg/transport/mango"
 	"github.com/bearded-web/bearded/pkg/utils"
 	"github.com/bearded-web/bearded/pkg/utils/async"
+	"github.com/bearded-web/bearded/pkg/version"
 	"github.com/bearded-web/bearded/vendor/homedir"
 )
 
+var log = logging.Logger(logging.Agent)
+
 type Agent struct {
 	// client helps to communicate with bearded api
 	api     *client.Client
 	name    string
 	dclient *docker.Docker
+	// limits of plugin containers, plugins aren't limited if it's nil
+	Config *config.Agent
 
 	jobs *set.Set
+	// concurrency limits of sessions against targets
+	slots *targetSlots
+	// results which aren't accepted by the dispatcher yet
+	results *resultBuffer
+
+	mu sync.Mutex
+	// the websocket channel to the dispatcher while it's connected
+	channel transport.Transport
+	// the channel isn't connected again until this time after a failure
+	channelRetry time.Time
 }
 
 func New(api *client.Client, dclient *docker.Docker, name string) (*Agent, error) {
@@ -42,7 +60,9 @@ func New(api *client.Client, dclient *docker.Docker, name string) (*Agent, error
 		name:    name,
 		dclient: dclient,
 		jobs:    set.New(),
+		slots:   newTargetSlots(),
 	}
+	a.results, _ = newResultBuffer("")
 	return a, nil
 }
 
@@ -50,50 +70,64 @@ func (a *Agent) Serve(ctx context.Context) error {
 	var resultErr error
 
 	agnt := &agent.Agent{
-		Name:   a.name,
-		Type:   agent.System,
-		Status: agent.StatusUndefined,
+		Name:         a.name,
+		Type:         agent.System,
+		Status:       agent.StatusUndefined,
+		Capabilities: capabilities,
+		Version:      version.Version,
 	}
 	prevStatus := agnt.Status
+	go a.retryResults(ctx)
 loop:
 	for {
 		timeout := 0
 		if prevStatus != agnt.Status {
-			logrus.Debugf("Agent status: %s -> %s", prevStatus, agnt.Status)
+			log.Debugf("Agent status: %s -> %s", prevStatus, agnt.Status)
 			prevStatus = agnt.Status
 		}
 		switch agnt.Status {
 		case agent.StatusUndefined:
 			err := a.Register(ctx, agnt)
 			if err != nil && !utils.IsCanceled(err) {
-				logrus.Errorf("Registration error: %v", err)
+				log.Errorf("Registration error: %v", err)
 				timeout = 5
 			}
-			logrus.Infof("Agent Id: %s", client.FromId(agnt.Id))
+			log.Infof("Agent Id: %s", client.FromId(agnt.Id))
 		case agent.StatusRegistered:
 			err := a.Retrieve(ctx, agnt)
 			if err != nil && !utils.IsCanceled(err) {
-				logrus.Errorf("Retrieve error: %v", err)
+				log.Errorf("Retrieve error: %v", err)
 				timeout = 5
 			}
 			if agnt.Status == agent.StatusRegistered {
 				timeout = 5
 			}
 		case agent.StatusApproved:
+			if a.useChannel() {
+				err := a.ServeChannel(ctx, agnt)
+				if err != nil && !utils.IsCanceled(err) {
+					log.Warnf("Channel error, jobs are polled over http: %v", err)
+					a.channelRetry = time.Now().Add(channelRetryInterval)
+				}
+				break
+			}
 			err := a.GetJobs(ctx, agnt)
 			if err != nil && !utils.IsCanceled(err) {
-				logrus.Errorf("GetJobs error: %v", err)
+				log.Errorf("GetJobs error: %v", err)
 				timeout = 5
 			}
 		case agent.StatusBlocked:
 			resultErr = fmt.Errorf("Agent is blocked")
 			break loop
+		case agent.StatusRetired:
+			resultErr = fmt.Errorf("Agent is retired, approve it to run again")
+			break loop
 		default:
 			resultErr = fmt.Errorf("Unknown agent status: %s", agnt.Status)
 			break loop
 		}
 		if timeout != 0 {
-			logrus.Debugf("Timeout: %d", timeout)
+			log.Debugf("Timeout: %d", timeout)
 		}
 		select {
 		case <-ctx.Done():
@@ -118,16 +152,16 @@ loop:
 }
 
 func (a *Agent) Register(ctx context.Context, agnt *agent.Agent) error {
-	logrus.Info("Register")
+	log.Info("Register")
 	if created, err := a.api.Agents.Create(ctx, agnt); err != nil {
 		if !client.IsConflicted(err) {
-			logrus.Error(err)
+			log.Error(err)
 			return err
 		}
-		logrus.Info("Already existed")
+		log.Info("Already existed")
 		// agent is already existed
 		// retrieve existed
-		logrus.Info("Get by name and type")
+		log.Info("Get by name and type")
 		agentList, err := a.api.Agents.List(ctx, &client.AgentsListOpts{Name: agnt.Name, Type: agnt.Type})
 		if err != nil {
 			return err
@@ -137,6 +171,16 @@ func (a *Agent) Register(ctx context.Context, agnt *agent.Agent) error {
 			return err
 		}
 		*agnt = *agentList.Results[0]
+		// capabilities and the version of the existed agent are changed after upgrades
+		if !sameStrings(agnt.Capabilities, capabilities) || agnt.Version != version.Version {
+			agnt.Capabilities = capabilities
+			agnt.Version = version.Version
+			updated, err := a.api.Agents.Update(ctx, agnt)
+			if err != nil {
+				return err
+			}
+			*agnt = *updated
+		}
 	} else {
 		*agnt = *created
 	}
@@ -144,7 +188,7 @@ func (a *Agent) Register(ctx context.Context, agnt *agent.Agent) error {
 }
 
 func (a *Agent) Retrieve(ctx context.Context, agnt *agent.Agent) error {
-	logrus.Info("Retrieve")
+	log.Info("Retrieve")
 	if agnt.Id == "" {
 		agnt.Status = agent.StatusUndefined
 		return fmt.Errorf("ageng.Id shouldn't be empty")
@@ -158,28 +202,28 @@ func (a *Agent) Retrieve(ctx context.Context, agnt *agent.Agent) error {
 }
 
 func (a *Agent) GetJobs(ctx context.Context, agnt *agent.Agent) error {
-	//	logrus.Debug("Request jobs")
+	//	log.Debug("Request jobs")
 	jobs, err := a.api.Agents.GetJobs(ctx, agnt)
 	if err != nil {
 		return err
 	}
-	//	logrus.Debugf("Got %d jobs", len(jobs))
+	//	log.Debugf("Got %d jobs", len(jobs))
 	for _, job := range jobs {
-		if err := a.HandleJob(ctx, job); err != nil {
+		if err := a.HandleJob(ctx, agnt.Id, job); err != nil {
 			// TODO (m0sth8): return scan failed status
 			// what should I do if backend server is unavailable?
-			logrus.Error(err)
+			log.Error(err)
 		}
 	}
 	return nil
 }
 
-func (a *Agent) HandleJob(ctx context.Context, job *agent.Job) error {
-	logrus.Debugf("Job: %s", job)
+func (a *Agent) HandleJob(ctx context.Context, agentId bson.ObjectId, job *agent.Job) error {
+	log.Debugf("Job: %s", job)
 	if job.Cmd == agent.CmdScan {
 		go func() {
 			asnc := async.New(ctx, func(ctx context.Context) error {
-				return a.HandleScan(ctx, job.Scan)
+				return a.HandleScan(ctx, agentId, job.Scan)
 			})
 			a.jobs.Add(asnc)
 			<-asnc.Result()
@@ -189,40 +233,63 @@ func (a *Agent) HandleJob(ctx context.Context, job *agent.Job) error {
 	return nil
 }
 
-func (a *Agent) HandleScan(ctx context.Context, sess *scan.Session) error {
+// HandleScan runs the plugin for the session, agentId is used for sending session logs
+func (a *Agent) HandleScan(ctx context.Context, agentId bson.ObjectId, sess *scan.Session) error {
 	// take a plugin
 	pl, err := a.api.Plugins.Get(ctx, client.FromId(sess.Plugin))
 	if err != nil {
 		return stackerr.Wrap(err)
 	}
-	logrus.Infof("plugin: %s", pl)
-	logrus.Info("set session to working state")
+	log.Infof("plugin: %s", pl)
+	log.Info("set session to working state")
 	sess.Status = scan.StatusWorking
+	// the step of the job has shared inputs and throttle which the stored session doesn't have
+	step := sess.Step
 	if sess, err = a.api.Scans.SessionUpdate(ctx, sess); err != nil {
 		return err
 	}
+	sess.Step = step
 
 	setFailed := func(err error) error {
 		if utils.IsCanceled(err) {
-			logrus.Infof("set session to failed state, due to %s", err)
+			log.Info("set session to failed state, due to cancel")
 		} else {
-			logrus.Info("set session to failed state, due to cancel")
+			log.Infof("set session to failed state, due to %s", err)
+			sess.Error = err.Error()
 		}
 		sess.Status = scan.StatusFailed
-		if sess, err = a.api.Scans.SessionUpdate(ctx, sess); err != nil {
-			return err
+		// session status should be sent even if the agent is stopping
+		if _, uErr := a.api.Scans.SessionUpdate(flushCtx(ctx), sess); uErr != nil {
+			log.Errorf("Can't set session to failed state: %v", uErr)
 		}
 		return err
 	}
+	// the container waits for other sessions against the target, the session isn't failed by the limit
+	limit := 0
+	if sess.Step.Throttle != nil {
+		limit = sess.Step.Throttle.Concurrency
+	}
+	key := targetKey(sess)
+	if err := a.slots.Acquire(ctx, key, limit); err != nil {
+		return setFailed(err)
+	}
+	defer a.slots.Release(key)
+
 	// we have a couple of hack for boot2docker network
 	isBoot2Docker := utils.IsBoot2Docker()
 
+	limits := a.limitsOf(pl.Name)
 	hostCfg := &dockerclient.HostConfig{}
+	applyLimits(hostCfg, limits)
 	args := sess.Step.Conf.CommandArgs
 	cfg := &dockerclient.Config{
 		Image: pl.Container.Image,
 		Tty:   true,
 		Cmd:   strings.Split(args, " "),
+		Env:   append(containerEnv(sess), a.proxyEnv()...),
+	}
+	if network := pl.Container.Network; network != "" {
+		hostCfg.NetworkMode = network
 	}
 
 	switch pl.Type {
@@ -248,19 +315,19 @@ func (a *Agent) HandleScan(ctx context.Context, sess *scan.Session) error {
 			// TODO (m0sth8): exclude tmp root to config files
 			home, err := homedir.Dir()
 			if err != nil {
-				logrus.Error(stackerr.Wrap(err))
+				log.Error(stackerr.Wrap(err))
 				return setFailed(fmt.Errorf("Can't get a home directory"))
 			}
 			tmpRoot = filepath.Join(home, "Library/Caches/bearded-web")
 			err = os.MkdirAll(tmpRoot, 0755)
 			if err != nil {
-				logrus.Error(stackerr.Wrap(err))
+				log.Error(stackerr.Wrap(err))
 				return setFailed(fmt.Errorf("Can't create a tmp directory %s", tmpRoot))
 			}
 		}
 		tmpDir, err := ioutil.TempDir(tmpRoot, "bearded-volume-")
 		if err != nil {
-			logrus.Error(stackerr.Wrap(err))
+			log.Error(stackerr.Wrap(err))
 			return setFailed(fmt.Errorf("Can't create a temp directory"))
 		}
 		defer func() {
@@ -269,7 +336,7 @@ func (a *Agent) HandleScan(ctx context.Context, sess *scan.Session) error {
 		shareDir := filepath.Join(tmpDir, "share")
 		err = os.MkdirAll(shareDir, 0755)
 		if err != nil {
-			logrus.Error(stackerr.Wrap(err))
+			log.Error(stackerr.Wrap(err))
 			return setFailed(fmt.Errorf("Can't create a share directory"))
 		}
 		for _, sharedFile := range sharedFiles {
@@ -278,12 +345,12 @@ func (a *Agent) HandleScan(ctx context.Context, sess *scan.Session) error {
 			dir = filepath.Join(shareDir, filepath.Join("/", dir))
 			err := os.MkdirAll(dir, 0755)
 			if err != nil {
-				logrus.Error(stackerr.Wrap(err))
+				log.Error(stackerr.Wrap(err))
 				return setFailed(fmt.Errorf("Can't create a directory"))
 			}
 			err = ioutil.WriteFile(filepath.Join(dir, base), []byte(sharedFile.Text), 0644)
 			if err != nil {
-				logrus.Error(stackerr.Wrap(err))
+				log.Error(stackerr.Wrap(err))
 				return setFailed(fmt.Errorf("Can't create a temporary file"))
 			}
 			println("put file", filepath.Join(dir, base))
@@ -298,18 +365,55 @@ func (a *Agent) HandleScan(ctx context.Context, sess *scan.Session) error {
 			takeFiles = append(takeFiles, f.Path)
 		}
 	}
-	ch := a.dclient.RunImage(ctx, cfg, hostCfg, takeFiles)
+	output := pl.Container.Output
+	if output != "" {
+		takeFiles = append(takeFiles, output)
+	}
+	// plugin output is streamed to the dispatcher while the plugin is running
+	logs := newLogStreamer(ctx, a.logSender(agentId), sess)
+	defer logs.Close(ctx)
+	// the container is stopped when the time limit is exceeded
+	runCtx := ctx
+	timeout := limits.Timeout
+	// the step timeout skips the step, the time limit of the agent fails the session
+	soft := stepTimeout(limits, sess.Step)
+	if soft > 0 {
+		timeout = soft
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+	stopped := func() error {
+		if ctx.Err() != nil {
+			return setFailed(ctx.Err())
+		}
+		if soft > 0 {
+			log.Warnf("set session to finished state, due to %s", stepTimeoutErr(soft))
+			sess.Error = stepTimeoutErr(soft).Error()
+			sess.TimedOut = true
+			sess.Status = scan.StatusFinished
+			if _, err := a.api.Scans.SessionUpdate(flushCtx(ctx), sess); err != nil {
+				log.Errorf("Can't set session to finished state: %v", err)
+				return err
+			}
+			return nil
+		}
+		return setFailed(timeoutErr(limits))
+	}
+	ch := a.dclient.RunImage(runCtx, cfg, hostCfg, takeFiles, logs)
 	// creating container
 	var container *dockerclient.Container
 	select {
-	case <-ctx.Done():
+	case <-runCtx.Done():
 		select {
 		case <-ch:
 			// wait while container to be stopped and killed
 		case <-time.After(time.Second * 5):
-			logrus.Warn("Wait container: timeout exceeded")
+			log.Warn("Wait container: timeout exceeded")
 		}
-		return setFailed(ctx.Err())
+		return stopped()
 	case res := <-ch:
 		// container info
 		if res.Err != nil {
@@ -335,7 +439,7 @@ func (a *Agent) HandleScan(ctx context.Context, sess *scan.Session) error {
 			}
 			host = string(bootIp)
 		}
-		logrus.Infof("script addr is %s:%s", host, port)
+		log.Infof("script addr is %s:%s", host, port)
 		//		transp := websocket.NewClient(fmt.Sprintf("ws://%s:%s", host, port))
 		transp, err := mango.NewClient(fmt.Sprintf("tcp://%s:%s", host, port))
 		if err != nil {
@@ -356,22 +460,27 @@ func (a *Agent) HandleScan(ctx context.Context, sess *scan.Session) error {
 	)
 	// running
 	select {
-	case <-ctx.Done():
+	case <-runCtx.Done():
 		select {
 		case <-ch:
 		// wait while container be stopped and killed
 		case <-time.After(time.Second * 5):
-			logrus.Warn("Wait container: timeout exceeded")
+			log.Warn("Wait container: timeout exceeded")
 		}
-		return setFailed(ctx.Err())
+		return stopped()
 	case res = <-ch:
 		//		if closed {
 		//			// TODO (m0sth8): handle closed channel from docker container
 		//			return setFailed(stackerr.Newf("Docker channel is closed, %v", res))
 		//		}
 	}
+	// the container is stopped, so all output is sent before the session status
+	logs.Close(ctx)
+	if res.OOMKilled && limits.Memory > 0 {
+		return setFailed(memoryErr(limits))
+	}
 	if res.Err != nil {
-		logrus.Error(res.Err)
+		log.Error(res.Err)
 		return setFailed(stackerr.Wrap(res.Err))
 	}
 	var rep *report.Report
@@ -379,6 +488,18 @@ func (a *Agent) HandleScan(ctx context.Context, sess *scan.Session) error {
 		Type: report.TypeRaw,
 		Raw:  report.Raw{Raw: string(res.Log)},
 	}
+	// the plugin writes results to the output file, its logs are already streamed
+	if output != "" {
+		data, found := res.Files[output]
+		if !found {
+			return setFailed(fmt.Errorf("plugin output %s isn't found in the container", output))
+		}
+		content, err := ioutil.ReadAll(data)
+		if err != nil {
+			return setFailed(stackerr.Wrap(err))
+		}
+		raw.Raw.Raw = string(content)
+	}
 	// handle files from container
 	if sess.Step.Conf.TakeFiles != nil && res.Files != nil {
 		for _, f := range sess.Step.Conf.TakeFiles {
@@ -387,9 +508,9 @@ func (a *Agent) HandleScan(ctx context.Context, sess *scan.Session) error {
 				if f.Name != "" {
 					name = f.Name
 				}
-				meta, err := a.api.Files.Create(ctx, name, data)
+				meta, err := a.api.Files.Create(flushCtx(ctx), name, data)
 				if err != nil {
-					logrus.Error(stackerr.Wrap(err))
+					log.Error(stackerr.Wrap(err))
 					continue
 				}
 				raw.Files = append(raw.Files, meta)
@@ -414,17 +535,34 @@ func (a *Agent) HandleScan(ctx context.Context, sess *scan.Session) error {
 		}
 	}
 
-	_, err = a.api.Scans.SessionReportCreate(ctx, sess, rep)
-	if err != nil {
-		return setFailed(stackerr.Wrap(err))
+	// the plugin is finished, so results are sent even if the agent is stopping,
+	// they are buffered and uploaded later if the dispatcher is unavailable
+	result := &sessionResult{Id: bson.NewObjectId().Hex(), Session: sess, Report: rep, Created: time.Now().UTC()}
+	rep.ResultId = result.Id
+	if err := a.uploadResult(flushCtx(ctx), result); err != nil {
+		if !retryable(err) {
+			return stackerr.Wrap(err)
+		}
+		log.Warnf("Result of session %s isn't uploaded, it's buffered: %v", client.FromId(sess.Id), err)
+		if err := a.results.Add(result); err != nil {
+			return setFailed(stackerr.Wrap(err))
+		}
+		return nil
 	}
+	log.Info("finished")
+	return nil
+}
 
-	logrus.Info("finished")
-	sess.Status = scan.StatusFinished
-	if sess, err = a.api.Scans.SessionUpdate(ctx, sess); err != nil {
-		return err
+// time to send results and statuses after the agent is stopped
+const flushTimeout = time.Second * 5
+
+// flushCtx returns ctx or, if ctx is already done, a new short context,
+// so the last requests of the session could be made during shutdown.
+func flushCtx(ctx context.Context) context.Context {
+	if ctx.Err() == nil {
+		return ctx
 	}
-	return nil
+	return utils.JustTimeout(context.Background(), flushTimeout)
 }
 
 func ServeAgent(ctx context.Context, cfg *config.Agent, api *client.Client) error {
@@ -439,10 +577,21 @@ func ServeAgent(ctx context.Context, cfg *config.Agent, api *client.Client) erro
 		}
 		cfg.Name = hostname
 	}
-	logrus.Infof("Agent name: %s", cfg.Name)
+	log.Infof("Bearded agent %s", version.Get())
+	log.Infof("Agent name: %s", cfg.Name)
 	server, err := New(api, dclient, cfg.Name)
 	if err != nil {
 		return fmt.Errorf("Initialization error: %s", err.Error())
 	}
+	server.Config = cfg
+	if cfg.Buffer != "" {
+		// internal agents share the config, so every agent has its own results
+		if server.results, err = newResultBuffer(filepath.Join(cfg.Buffer, cfg.Name)); err != nil {
+			return fmt.Errorf("Can't load buffered results: %s", err.Error())
+		}
+		if n := len(server.results.List()); n > 0 {
+			log.Infof("%d buffered results are going to be uploaded", n)
+		}
+	}
 	return server.Serve(ctx)
 }
@@ -2,8 +2,10 @@
 package api
 
 import (
+	"github.com/bearded-web/bearded/models/file"
 	"github.com/bearded-web/bearded/models/plan"
 	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
 )
 
 type Method int
@@ -16,8 +18,16 @@ const (
 	RunPlugin
 	SendReport
 	DownloadFile
+	UploadFile
+	SendProgress
 )
 
+// file which is uploaded by plugin, e.g. an artifact for an issue
+type File struct {
+	Name string
+	Data []byte
+}
+
 type RequestV1 struct {
 	Method Method
 
@@ -25,6 +35,8 @@ type RequestV1 struct {
 	RunPlugin         *plan.WorkflowStep
 	SendReport        *report.Report
 	DownloadFile      string
+	UploadFile        *File
+	SendProgress      *scan.Progress
 }
 
 type ResponseV1 struct {
@@ -33,4 +45,5 @@ type ResponseV1 struct {
 	GetPluginVersions []string
 	RunPlugin         *report.Report
 	DownloadFile      []byte
+	UploadFile        *file.Meta
 }
@@ -4,9 +4,9 @@ package api
 
 import "fmt"
 
-const _Method_name = "PingConnectGetConfig"
+const _Method_name = "PingConnectGetConfigGetPluginVersionsRunPluginSendReportDownloadFileUploadFileSendProgress"
 
-var _Method_index = [...]uint8{0, 4, 11, 20}
+var _Method_index = [...]uint8{0, 4, 11, 20, 37, 46, 56, 68, 78, 90}
 
 func (i Method) String() string {
 	if i < 0 || i+1 >= Method(len(_Method_index)) {
@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/agent"
+	"github.com/bearded-web/bearded/pkg/client"
+	"github.com/bearded-web/bearded/pkg/transport"
+	"github.com/bearded-web/bearded/pkg/transport/websocket"
+	"github.com/bearded-web/bearded/pkg/utils"
+)
+
+const (
+	// the dispatcher closes the channel if the agent is silent for a minute
+	channelHeartbeatInterval = time.Second * 20
+	channelRequestTimeout    = time.Second * 10
+	// jobs are polled over http for this time after the channel is failed
+	channelRetryInterval = time.Minute
+)
+
+func (a *Agent) useChannel() bool {
+	if a.Config != nil && a.Config.Polling {
+		return false
+	}
+	return time.Now().After(a.channelRetry)
+}
+
+// ServeChannel gets jobs pushed over the websocket channel, it returns nil when the agent isn't approved anymore
+// and an error if the channel can't be connected or it's broken.
+func (a *Agent) ServeChannel(ctx context.Context, agnt *agent.Agent) error {
+	conn, err := a.api.Agents.Channel(client.FromId(agnt.Id))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	log.Info("Channel is connected")
+
+	transp := websocket.NewConn(conn)
+	chCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	closed := make(chan error, 1)
+	go func() {
+		// jobs aren't bound to the channel, they are finished even if the channel is broken
+		closed <- transp.Serve(chCtx, &channelHandler{ctx: ctx, agent: a, agentId: agnt.Id})
+	}()
+	a.setChannel(transp)
+	defer a.setChannel(nil)
+
+	ticker := time.NewTicker(channelHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		resp := &agent.ChannelResponse{}
+		err := transp.Request(utils.JustTimeout(chCtx, channelRequestTimeout),
+			&agent.ChannelRequest{Method: agent.ChannelHeartbeat}, resp)
+		if err != nil {
+			return err
+		}
+		if resp.Agent != nil {
+			*agnt = *resp.Agent
+		}
+		if agnt.Status != agent.StatusApproved {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-closed:
+			if err == nil {
+				err = fmt.Errorf("channel is closed")
+			}
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Agent) setChannel(transp transport.Transport) {
+	a.mu.Lock()
+	a.channel = transp
+	a.mu.Unlock()
+}
+
+func (a *Agent) getChannel() transport.Transport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.channel
+}
+
+// logs are sent over the channel while it's connected, otherwise with api requests
+func (a *Agent) logSender(agentId bson.ObjectId) LogSender {
+	send := httpLogSender(a.api, agentId)
+	return func(ctx context.Context, chunk *agent.Log) error {
+		if transp := a.getChannel(); transp != nil {
+			err := transp.Request(utils.JustTimeout(ctx, channelRequestTimeout),
+				&agent.ChannelRequest{Method: agent.ChannelLog, Log: chunk}, &agent.ChannelResponse{})
+			if err == nil {
+				return nil
+			}
+			log.Debugf("Can't send logs over the channel: %v", err)
+		}
+		return send(ctx, chunk)
+	}
+}
+
+// channelHandler handles requests of the dispatcher
+type channelHandler struct {
+	ctx     context.Context
+	agent   *Agent
+	agentId bson.ObjectId
+}
+
+func (h *channelHandler) Handle(_ context.Context, msg transport.Extractor) (interface{}, error) {
+	req := &agent.ChannelRequest{}
+	if err := msg.Extract(req); err != nil {
+		return nil, err
+	}
+	if req.Method != agent.ChannelJobs {
+		return nil, fmt.Errorf("unknown method %s", req.Method)
+	}
+	for _, job := range req.Jobs {
+		if err := h.agent.HandleJob(h.ctx, h.agentId, job); err != nil {
+			log.Error(err)
+		}
+	}
+	return &agent.ChannelResponse{}, nil
+}
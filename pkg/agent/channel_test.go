@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/agent"
+	"github.com/bearded-web/bearded/pkg/client"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/transport"
+	wsTransport "github.com/bearded-web/bearded/pkg/transport/websocket"
+)
+
+func TestServeChannel(t *testing.T) {
+	agnt := &agent.Agent{Id: bson.NewObjectId(), Status: agent.StatusApproved}
+	logs := make(chan *agent.Log, 1)
+
+	s := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/api/v1/agents/"+agnt.Id.Hex()+"/channel", req.URL.Path)
+		require.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+		conn, err := (&websocket.Upgrader{}).Upgrade(res, req, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		transp := wsTransport.NewConn(conn)
+		transp.Serve(context.Background(), transport.Handle(func(ctx context.Context, msg transport.Extractor) (interface{}, error) {
+			req := &agent.ChannelRequest{}
+			require.NoError(t, msg.Extract(req))
+			if req.Method == agent.ChannelLog {
+				logs <- req.Log
+			}
+			return &agent.ChannelResponse{Agent: agnt}, nil
+		}))
+	}))
+	defer s.Close()
+
+	api := client.NewClient(s.URL+"/api/", nil)
+	api.Token = "token"
+	a, err := New(api, nil, "agent")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- a.ServeChannel(ctx, &agent.Agent{Id: agnt.Id})
+	}()
+	for i := 0; a.getChannel() == nil; i++ {
+		require.True(t, i < 100, "channel isn't connected")
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	chunk := &agent.Log{Scan: bson.NewObjectId(), Session: bson.NewObjectId(), Data: "output"}
+	require.NoError(t, a.logSender(agnt.Id)(ctx, chunk))
+	select {
+	case got := <-logs:
+		require.Equal(t, chunk.Session, got.Session)
+		require.Equal(t, "output", got.Data)
+	case <-time.After(time.Second):
+		t.Fatal("logs aren't sent over the channel")
+	}
+
+	cancel()
+	require.Equal(t, context.Canceled, <-served)
+	require.Nil(t, a.getChannel())
+}
+
+func TestUseChannel(t *testing.T) {
+	a := &Agent{}
+	require.True(t, a.useChannel())
+	a.channelRetry = time.Now().Add(channelRetryInterval)
+	require.False(t, a.useChannel())
+
+	a = &Agent{Config: &config.Agent{Polling: true}}
+	require.False(t, a.useChannel())
+}
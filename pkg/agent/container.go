@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/bearded-web/bearded/models/agent"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/proxy"
+)
+
+// agents always run plugins in docker containers
+var capabilities = []string{agent.CapabilityDocker}
+
+// the target and the step config are passed to the container in env, besides command args
+func containerEnv(sess *scan.Session) []string {
+	conf := sess.Step.Conf
+	env := []string{
+		fmt.Sprintf("BEARDED_TARGET=%s", conf.Target),
+		fmt.Sprintf("BEARDED_SESSION=%s", sess.Id.Hex()),
+	}
+	if conf.FormData != "" {
+		env = append(env, fmt.Sprintf("BEARDED_FORM_DATA=%s", conf.FormData))
+	}
+	// the rate is a hint, the agent doesn't count requests, plugins pass it to options of the tool
+	if t := sess.Step.Throttle; t != nil {
+		if t.Rate > 0 {
+			env = append(env, fmt.Sprintf("BEARDED_RATE=%g", t.Rate))
+		}
+		if t.Concurrency > 0 {
+			env = append(env, fmt.Sprintf("BEARDED_CONCURRENCY=%d", t.Concurrency))
+		}
+	}
+	return env
+}
+
+// plugins reach targets through the proxy of the agent
+func (a *Agent) proxyEnv() []string {
+	if a.Config == nil {
+		return proxy.Env(config.Proxy{})
+	}
+	return proxy.Env(a.Config.Proxy)
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
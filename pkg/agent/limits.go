@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/pkg/config"
+)
+
+// docker cpu quota is set for this period
+const cpuPeriod = 100000
+
+// applyLimits restricts cpu and memory of the plugin container by cgroups, swap isn't allowed
+func applyLimits(hostCfg *dockerclient.HostConfig, limits config.Limits) {
+	if limits.Cpu > 0 {
+		hostCfg.CPUPeriod = cpuPeriod
+		hostCfg.CPUQuota = int64(limits.Cpu) * cpuPeriod / 100
+	}
+	if limits.Memory > 0 {
+		hostCfg.Memory = int64(limits.Memory) << 20
+		hostCfg.MemorySwap = hostCfg.Memory
+	}
+}
+
+func (a *Agent) limitsOf(plugin string) config.Limits {
+	if a.Config == nil {
+		return config.Limits{}
+	}
+	return a.Config.LimitsOf(plugin)
+}
+
+// stepTimeout returns the timeout of the plan step in seconds if it's shorter than the time limit of the agent,
+// otherwise 0 and the agent limit is applied
+func stepTimeout(limits config.Limits, step *plan.WorkflowStep) int {
+	if step == nil || step.Timeout <= 0 {
+		return 0
+	}
+	if limits.Timeout > 0 && limits.Timeout <= step.Timeout {
+		return 0
+	}
+	return step.Timeout
+}
+
+func timeoutErr(limits config.Limits) error {
+	return fmt.Errorf("plugin exceeded the time limit of %s", time.Duration(limits.Timeout)*time.Second)
+}
+
+func stepTimeoutErr(timeout int) error {
+	return fmt.Errorf("plugin exceeded the step timeout of %s", time.Duration(timeout)*time.Second)
+}
+
+func memoryErr(limits config.Limits) error {
+	return fmt.Errorf("plugin exceeded the memory limit of %d MB", limits.Memory)
+}
@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"testing"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/pkg/config"
+)
+
+func TestLimitsOf(t *testing.T) {
+	cfg := &config.Agent{
+		Limits:  config.Limits{Cpu: 100, Memory: 512, Timeout: 3600},
+		Plugins: []config.PluginLimits{{Plugin: "barbudo/w3af", Memory: 2048, Timeout: 7200}},
+	}
+	require.Equal(t, config.Limits{Cpu: 100, Memory: 512, Timeout: 3600}, cfg.LimitsOf("barbudo/wpscan"))
+	require.Equal(t, config.Limits{Cpu: 100, Memory: 2048, Timeout: 7200}, cfg.LimitsOf("barbudo/w3af"))
+}
+
+func TestApplyLimits(t *testing.T) {
+	hostCfg := &dockerclient.HostConfig{}
+	applyLimits(hostCfg, config.Limits{})
+	require.Equal(t, &dockerclient.HostConfig{}, hostCfg)
+
+	applyLimits(hostCfg, config.Limits{Cpu: 50, Memory: 256})
+	require.Equal(t, int64(cpuPeriod), hostCfg.CPUPeriod)
+	require.Equal(t, int64(cpuPeriod/2), hostCfg.CPUQuota)
+	require.Equal(t, int64(256<<20), hostCfg.Memory)
+	require.Equal(t, hostCfg.Memory, hostCfg.MemorySwap)
+}
+
+func TestStepTimeout(t *testing.T) {
+	require.Equal(t, 0, stepTimeout(config.Limits{Timeout: 3600}, nil))
+	require.Equal(t, 0, stepTimeout(config.Limits{Timeout: 3600}, &plan.WorkflowStep{}))
+	require.Equal(t, 300, stepTimeout(config.Limits{Timeout: 3600}, &plan.WorkflowStep{Timeout: 300}))
+	require.Equal(t, 300, stepTimeout(config.Limits{}, &plan.WorkflowStep{Timeout: 300}))
+	// the agent limit is stricter, so the session is failed by it
+	require.Equal(t, 0, stepTimeout(config.Limits{Timeout: 3600}, &plan.WorkflowStep{Timeout: 7200}))
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/agent"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/client"
+)
+
+const (
+	// logs are sent to the dispatcher at least this often while the plugin is running
+	logFlushInterval = time.Second * 2
+	// or when the buffer has grown to this size, it's less than the dispatcher limit for a chunk
+	logChunkSize = 32 << 10
+)
+
+// LogSender sends a chunk of session logs to the dispatcher
+type LogSender func(ctx context.Context, chunk *agent.Log) error
+
+// LogStreamer collects plugin output and sends it to the dispatcher in chunks.
+// Write never fails, logs which can't be sent are dropped, so the plugin isn't affected.
+type LogStreamer struct {
+	send LogSender
+	sess *scan.Session
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+
+	done  chan struct{}
+	wg    sync.WaitGroup
+	close sync.Once
+}
+
+// NewLogStreamer sends logs with api requests
+func NewLogStreamer(ctx context.Context, api *client.Client, agentId bson.ObjectId, sess *scan.Session) *LogStreamer {
+	return newLogStreamer(ctx, httpLogSender(api, agentId), sess)
+}
+
+func newLogStreamer(ctx context.Context, send LogSender, sess *scan.Session) *LogStreamer {
+	l := &LogStreamer{
+		send: send,
+		sess: sess,
+		done: make(chan struct{}),
+	}
+	l.wg.Add(1)
+	go l.loop(ctx)
+	return l
+}
+
+func (l *LogStreamer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	l.buf.Write(p)
+	full := l.buf.Len() >= logChunkSize
+	l.mu.Unlock()
+	if full {
+		l.flush(context.Background())
+	}
+	return len(p), nil
+}
+
+// Close sends the rest of logs and stops the streamer, it's safe to call Close several times
+func (l *LogStreamer) Close(ctx context.Context) {
+	l.close.Do(func() {
+		close(l.done)
+		l.wg.Wait()
+		l.flush(flushCtx(ctx))
+	})
+}
+
+func (l *LogStreamer) loop(ctx context.Context) {
+	defer l.wg.Done()
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.flush(ctx)
+		}
+	}
+}
+
+func (l *LogStreamer) flush(ctx context.Context) {
+	l.mu.Lock()
+	for l.buf.Len() > 0 {
+		data := string(l.buf.Next(logChunkSize))
+		err := l.send(ctx, &agent.Log{
+			Scan:    l.sess.Scan,
+			Session: l.sess.Id,
+			Data:    data,
+		})
+		if err != nil {
+			log.Warnf("Can't send session logs: %v", err)
+		}
+	}
+	l.mu.Unlock()
+}
+
+func httpLogSender(api *client.Client, agentId bson.ObjectId) LogSender {
+	return func(ctx context.Context, chunk *agent.Log) error {
+		_, err := api.Agents.LogsCreate(ctx, client.FromId(agentId), chunk)
+		return err
+	}
+}
@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/agent"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/client"
+)
+
+func TestLogStreamer(t *testing.T) {
+	agentId := bson.NewObjectId()
+	sess := &scan.Session{Id: bson.NewObjectId(), Scan: bson.NewObjectId()}
+
+	mu := sync.Mutex{}
+	chunks := []*agent.Log{}
+	s := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/api/v1/agents/"+agentId.Hex()+"/logs", req.URL.Path)
+		chunk := &agent.Log{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(chunk))
+		mu.Lock()
+		chunks = append(chunks, chunk)
+		mu.Unlock()
+		res.WriteHeader(http.StatusCreated)
+		json.NewEncoder(res).Encode(chunk)
+	}))
+	defer s.Close()
+
+	api := client.NewClient(s.URL+"/api/", nil)
+	logs := NewLogStreamer(context.Background(), api, agentId, sess)
+
+	n, err := logs.Write([]byte("first line\n"))
+	require.NoError(t, err)
+	require.Equal(t, 11, n)
+	// big output is split into several chunks
+	logs.Write([]byte(strings.Repeat("x", logChunkSize+10)))
+	logs.Close(context.Background())
+	logs.Close(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, chunks, 2)
+	require.Equal(t, sess.Id, chunks[0].Session)
+	require.Equal(t, sess.Scan, chunks[0].Scan)
+	data := ""
+	for _, chunk := range chunks {
+		data += chunk.Data
+	}
+	require.Equal(t, "first line\n"+strings.Repeat("x", logChunkSize+10), data)
+}
@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/client"
+)
+
+// buffered results are uploaded again this often until the dispatcher accepts them
+const resultRetryInterval = time.Second * 10
+
+// sessionResult is the report of the session which is uploaded with the finished status.
+// The report has the result id, so the dispatcher stores it once even if it's uploaded again.
+type sessionResult struct {
+	Id      string         `json:"id"`
+	Session *scan.Session  `json:"session"`
+	Report  *report.Report `json:"report"`
+	Created time.Time      `json:"created"`
+}
+
+type resultsByCreated []*sessionResult
+
+func (r resultsByCreated) Len() int           { return len(r) }
+func (r resultsByCreated) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r resultsByCreated) Less(i, j int) bool { return r[i].Created.Before(r[j].Created) }
+
+// resultBuffer keeps results which aren't acknowledged by the dispatcher, so they aren't lost while it's unavailable.
+// Results are written to the directory if it's set and survive restarts of the agent, otherwise they are kept in memory.
+type resultBuffer struct {
+	dir string
+
+	mu      sync.Mutex
+	results map[string]*sessionResult
+}
+
+// newResultBuffer loads results which are left in the directory by the previous run
+func newResultBuffer(dir string) (*resultBuffer, error) {
+	b := &resultBuffer{dir: dir, results: map[string]*sessionResult{}}
+	if dir == "" {
+		return b, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		res := &sessionResult{}
+		if err := json.Unmarshal(data, res); err != nil || res.Id == "" || res.Session == nil || res.Report == nil {
+			log.Warnf("Broken result %s is skipped: %v", name, err)
+			continue
+		}
+		b.results[res.Id] = res
+	}
+	return b, nil
+}
+
+// Add keeps the result until it's removed, the file is replaced at once, so it isn't read half written
+func (b *resultBuffer) Add(res *sessionResult) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.dir != "" {
+		data, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		tmp := b.path(res.Id) + ".tmp"
+		if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, b.path(res.Id)); err != nil {
+			return err
+		}
+	}
+	b.results[res.Id] = res
+	return nil
+}
+
+func (b *resultBuffer) Remove(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.results, id)
+	if b.dir != "" {
+		if err := os.Remove(b.path(id)); err != nil && !os.IsNotExist(err) {
+			log.Errorf("Can't remove the result %s: %v", id, err)
+		}
+	}
+}
+
+// List returns buffered results, the oldest go first
+func (b *resultBuffer) List() []*sessionResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	results := make([]*sessionResult, 0, len(b.results))
+	for _, res := range b.results {
+		results = append(results, res)
+	}
+	sort.Sort(resultsByCreated(results))
+	return results
+}
+
+// Flush uploads results, they are removed when the dispatcher accepts or rejects them.
+// Uploading is stopped at the first retryable error, the dispatcher is likely still unavailable.
+func (b *resultBuffer) Flush(ctx context.Context, upload func(context.Context, *sessionResult) error) {
+	for _, res := range b.List() {
+		if ctx.Err() != nil {
+			return
+		}
+		err := upload(ctx, res)
+		if err != nil && retryable(err) {
+			log.Debugf("Result %s isn't uploaded yet: %v", res.Id, err)
+			return
+		}
+		if err != nil {
+			log.Errorf("Result %s of session %s is rejected: %v", res.Id, client.FromId(res.Session.Id), err)
+		} else {
+			log.Infof("Buffered result %s of session %s is uploaded", res.Id, client.FromId(res.Session.Id))
+		}
+		b.Remove(res.Id)
+	}
+}
+
+func (b *resultBuffer) path(id string) string {
+	return filepath.Join(b.dir, id+".json")
+}
+
+// retryable errors are network errors and errors of the unavailable or overloaded dispatcher,
+// other responses won't change if the request is repeated
+func retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errResp, ok := err.(*client.ErrorResponse); ok && errResp.Response != nil {
+		code := errResp.Response.StatusCode
+		return code >= http.StatusInternalServerError || code == 429 || code == http.StatusRequestTimeout
+	}
+	return true
+}
+
+// uploadResult sends the report and then the finished status of the session, both are safe to repeat.
+// The session is failed if the report is rejected, unless another report of the session is already stored.
+func (a *Agent) uploadResult(ctx context.Context, res *sessionResult) error {
+	if _, err := a.api.Scans.SessionReportCreate(ctx, res.Session, res.Report); err != nil {
+		if !retryable(err) && !client.IsConflicted(err) {
+			failed := *res.Session
+			failed.Status = scan.StatusFailed
+			failed.Error = fmt.Sprintf("results are rejected: %v", err)
+			if _, uErr := a.api.Scans.SessionUpdate(ctx, &failed); uErr != nil {
+				log.Errorf("Can't set session to failed state: %v", uErr)
+			}
+		}
+		return err
+	}
+	sess := *res.Session
+	sess.Status = scan.StatusFinished
+	_, err := a.api.Scans.SessionUpdate(ctx, &sess)
+	return err
+}
+
+// retryResults uploads buffered results until the agent is stopped
+func (a *Agent) retryResults(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resultRetryInterval):
+		}
+		a.results.Flush(ctx, a.uploadResult)
+	}
+}
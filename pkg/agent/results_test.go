@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/client"
+)
+
+func testResult(id string, created time.Time) *sessionResult {
+	return &sessionResult{
+		Id:      id,
+		Session: &scan.Session{Id: bson.NewObjectId()},
+		Report:  &report.Report{Type: report.TypeRaw, ResultId: id},
+		Created: created,
+	}
+}
+
+func TestResultBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "results")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b, err := newResultBuffer(dir)
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	require.NoError(t, b.Add(testResult("second", now)))
+	require.NoError(t, b.Add(testResult("first", now.Add(-time.Minute))))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0600))
+
+	// results survive restarts
+	b, err = newResultBuffer(dir)
+	require.NoError(t, err)
+	results := b.List()
+	require.Len(t, results, 2)
+	require.Equal(t, "first", results[0].Id)
+	require.Equal(t, "first", results[0].Report.ResultId)
+
+	b.Remove("first")
+	b, err = newResultBuffer(dir)
+	require.NoError(t, err)
+	require.Len(t, b.List(), 1)
+}
+
+func TestResultBufferFlush(t *testing.T) {
+	b, err := newResultBuffer("")
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	require.NoError(t, b.Add(testResult("first", now)))
+	require.NoError(t, b.Add(testResult("second", now.Add(time.Second))))
+	require.NoError(t, b.Add(testResult("third", now.Add(time.Second*2))))
+
+	uploaded := []string{}
+	b.Flush(context.Background(), func(ctx context.Context, res *sessionResult) error {
+		uploaded = append(uploaded, res.Id)
+		switch res.Id {
+		case "second":
+			return &client.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadRequest}}
+		case "third":
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	// the rejected result is dropped, the dispatcher is unavailable for the last one
+	require.Equal(t, []string{"first", "second", "third"}, uploaded)
+	results := b.List()
+	require.Len(t, results, 1)
+	require.Equal(t, "third", results[0].Id)
+}
+
+func TestRetryable(t *testing.T) {
+	resp := func(code int) error {
+		return &client.ErrorResponse{Response: &http.Response{StatusCode: code}}
+	}
+	require.False(t, retryable(nil))
+	require.True(t, retryable(errors.New("connection refused")))
+	require.True(t, retryable(resp(http.StatusBadGateway)))
+	require.True(t, retryable(resp(429)))
+	require.False(t, retryable(resp(http.StatusConflict)))
+	require.False(t, retryable(resp(http.StatusNotFound)))
+}
@@ -1,13 +1,14 @@
 package agent
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"golang.org/x/net/context"
 
+	"github.com/bearded-web/bearded/models/file"
 	"github.com/bearded-web/bearded/models/plan"
 	"github.com/bearded-web/bearded/models/report"
 	"github.com/bearded-web/bearded/models/scan"
@@ -16,11 +17,16 @@ import (
 	"github.com/bearded-web/bearded/pkg/transport"
 )
 
+// plugins could report progress often, it's sent to the dispatcher not more often than this
+const progressInterval = time.Second * 2
+
 type RemoteServer struct {
 	transp transport.Transport
 	Rep    *report.Report
 	sess   *scan.Session
 	api    *client.Client
+
+	progressSent time.Time
 }
 
 // Server connects agent with plugin script
@@ -73,6 +79,16 @@ func (s *RemoteServer) Handle(ctx context.Context, msg transport.Extractor) (int
 		} else {
 			resp.DownloadFile = data
 		}
+	case api.SendProgress:
+		if err := s.SendProgress(ctx, req.SendProgress); err != nil {
+			return nil, err
+		}
+	case api.UploadFile:
+		if data, err := s.UploadFile(ctx, req.UploadFile); err != nil {
+			return nil, err
+		} else {
+			resp.UploadFile = data
+		}
 	default:
 		return nil, fmt.Errorf("Unknown method requested %s", req.Method)
 	}
@@ -130,10 +146,12 @@ loop:
 				// why session is not found???
 				return nil, err
 			}
-			logrus.Error(err)
+			log.Error(err)
 			// TODO (m0sth8): add errors counter and fail if counter is more then maximum
 			// TODO (m0sth8): add exponential sleep on errors
-			time.Sleep(time.Second * 15)
+			if err := sleep(ctx, time.Second*15); err != nil {
+				return nil, err
+			}
 			continue loop
 		}
 		switch sess2.Status {
@@ -142,10 +160,14 @@ loop:
 		case scan.StatusFailed:
 			return nil, fmt.Errorf("session was failed")
 		case scan.StatusPaused:
-			time.Sleep(time.Second * 30)
+			if err := sleep(ctx, time.Second*30); err != nil {
+				return nil, err
+			}
 			continue loop
 		}
-		time.Sleep(time.Second * 2)
+		if err := sleep(ctx, time.Second*2); err != nil {
+			return nil, err
+		}
 	}
 
 	rep, err := s.api.Scans.SessionReportGet(ctx, sess)
@@ -155,11 +177,40 @@ loop:
 	return rep, nil
 }
 
+// sleep for duration or until ctx is done
+func sleep(ctx context.Context, duration time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(duration):
+		return nil
+	}
+}
+
 func (s *RemoteServer) SendReport(ctx context.Context, rep *report.Report) error {
 	s.Rep = rep
 	return nil
 }
 
+// SendProgress passes the progress of the plugin to the dispatcher, failures don't break the plugin
+func (s *RemoteServer) SendProgress(ctx context.Context, progress *scan.Progress) error {
+	if progress == nil {
+		return fmt.Errorf("progress is empty")
+	}
+	if progress.Percent < 0 || progress.Percent > 100 {
+		return fmt.Errorf("percent should be in 0-100")
+	}
+	now := time.Now()
+	if progress.Percent < 100 && now.Sub(s.progressSent) < progressInterval {
+		return nil
+	}
+	s.progressSent = now
+	if _, err := s.api.Scans.SessionProgress(ctx, s.sess, progress); err != nil {
+		log.Errorf("Progress of session %s isn't sent: %v", s.sess.Id.Hex(), err)
+	}
+	return nil
+}
+
 func (s *RemoteServer) DownloadFile(ctx context.Context, fileId string) ([]byte, error) {
 	buf, err := s.api.Files.Download(ctx, fileId)
 	if err != nil {
@@ -167,3 +218,11 @@ func (s *RemoteServer) DownloadFile(ctx context.Context, fileId string) ([]byte,
 	}
 	return ioutil.ReadAll(buf)
 }
+
+// Store the plugin artifact, the plugin links returned meta to issues in its report
+func (s *RemoteServer) UploadFile(ctx context.Context, f *api.File) (*file.Meta, error) {
+	if f == nil {
+		return nil, fmt.Errorf("file is empty")
+	}
+	return s.api.Files.Create(ctx, f.Name, bytes.NewReader(f.Data))
+}
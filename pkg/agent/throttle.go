@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"net/url"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/bearded-web/bearded/models/scan"
+)
+
+// targetSlots limits sessions which are run against the same target at the same time,
+// sessions over the limit wait for a free slot instead of failing
+type targetSlots struct {
+	mu      sync.Mutex
+	running map[string]int
+	// closed and replaced when a slot is released
+	freed chan struct{}
+}
+
+func newTargetSlots() *targetSlots {
+	return &targetSlots{
+		running: map[string]int{},
+		freed:   make(chan struct{}),
+	}
+}
+
+// Acquire the slot of the target, every session takes a slot, but only sessions with the limit wait for it.
+// The slot should be released even if the session isn't limited.
+func (t *targetSlots) Acquire(ctx context.Context, target string, limit int) error {
+	for {
+		t.mu.Lock()
+		if limit <= 0 || t.running[target] < limit {
+			t.running[target]++
+			t.mu.Unlock()
+			return nil
+		}
+		freed := t.freed
+		t.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-freed:
+		}
+	}
+}
+
+func (t *targetSlots) Release(target string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running[target]--; t.running[target] <= 0 {
+		delete(t.running, target)
+	}
+	close(t.freed)
+	t.freed = make(chan struct{})
+}
+
+// sessions against urls of the same host share slots
+func targetKey(sess *scan.Session) string {
+	if sess.Step == nil || sess.Step.Conf == nil {
+		return ""
+	}
+	target := sess.Step.Conf.Target
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return target
+}
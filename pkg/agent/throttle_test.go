@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
+)
+
+func TestTargetSlots(t *testing.T) {
+	slots := newTargetSlots()
+	ctx := context.Background()
+	require.NoError(t, slots.Acquire(ctx, "example.com", 1))
+	// other targets and unlimited sessions don't wait
+	require.NoError(t, slots.Acquire(ctx, "other.com", 1))
+	require.NoError(t, slots.Acquire(ctx, "example.com", 0))
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- slots.Acquire(ctx, "example.com", 2)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("slot is acquired over the limit")
+	case <-time.After(time.Millisecond * 50):
+	}
+	slots.Release("example.com")
+	select {
+	case err := <-acquired:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("slot isn't acquired after release")
+	}
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Equal(t, context.Canceled, slots.Acquire(cancelCtx, "example.com", 1))
+}
+
+func TestTargetKey(t *testing.T) {
+	sess := &scan.Session{Step: &plan.WorkflowStep{Conf: &plan.Conf{Target: "http://example.com:8080/path"}}}
+	require.Equal(t, "example.com:8080", targetKey(sess))
+	sess.Step.Conf.Target = "example.com"
+	require.Equal(t, "example.com", targetKey(sess))
+}
+
+func TestContainerEnvThrottle(t *testing.T) {
+	sess := &scan.Session{Step: &plan.WorkflowStep{
+		Conf:     &plan.Conf{Target: "http://example.com"},
+		Throttle: &target.Throttle{Rate: 2.5, Concurrency: 1},
+	}}
+	env := containerEnv(sess)
+	require.Contains(t, env, "BEARDED_RATE=2.5")
+	require.Contains(t, env, "BEARDED_CONCURRENCY=1")
+}
@@ -0,0 +1,264 @@
+package alert
+
+// Alerts about audit events and operational incidents are sent by email and to the webhook.
+// Sending doesn't block callers, failures are only logged.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/audit"
+	"github.com/bearded-web/bearded/models/incident"
+	"github.com/bearded-web/bearded/models/webhook"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/email"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/template"
+	signature "github.com/bearded-web/bearded/pkg/webhook"
+)
+
+const webhookTimeout = time.Second * 10
+
+type Alert struct {
+	Type    string
+	Subject string
+	Text    string
+	// posted to the webhook as json
+	Payload interface{}
+
+	// email templates of the alert, the subject is rendered from <Template>-subject,
+	// Subject and Text are sent if there are no templates for the locale
+	Template string
+	// binding of the templates
+	Data interface{}
+}
+
+// Email returns the subject and the text of the alert email in the locale
+func (al *Alert) Email(tmpl template.Renderer, locale string) (string, string) {
+	subject, text := al.Subject, al.Text
+	if tmpl == nil || al.Template == "" {
+		return subject, text
+	}
+	if v, err := tmpl.Text(al.Template+"-subject", al.Data, locale); err == nil && v != "" {
+		subject = v
+	}
+	if v, err := tmpl.Text(al.Template, al.Data, locale); err == nil && v != "" {
+		text = v + "\n"
+	}
+	return subject, text
+}
+
+// AuditAlert is posted to the webhook as {"event": {...}}
+func AuditAlert(ev *audit.Event) *Alert {
+	return &Alert{
+		Type:    string(ev.Type),
+		Subject: fmt.Sprintf("Bearded privilege change: %s", ev.Type),
+		Text:    fmt.Sprintf("%s\n\nEvent: %s\nTime: %s\n", ev.Message, ev.Id.Hex(), ev.Created),
+		Payload: ev,
+
+		Template: "email/audit",
+		Data:     ev,
+	}
+}
+
+// IncidentAlert is posted to the webhook as {"incident": {...}}
+func IncidentAlert(inc *incident.Incident) *Alert {
+	text := fmt.Sprintf("%s\n\nIncident: %s\nTime: %s\n", inc.Message, inc.Id.Hex(), inc.Created)
+	if inc.Agent != "" {
+		text += fmt.Sprintf("Agent: %s\n", inc.Agent.Hex())
+	}
+	if inc.Scan != "" {
+		text += fmt.Sprintf("Scan: %s\n", inc.Scan.Hex())
+	}
+	if inc.Session != "" {
+		text += fmt.Sprintf("Session: %s\n", inc.Session.Hex())
+	}
+	if inc.Plugin != "" {
+		text += fmt.Sprintf("Plugin: %s\n", inc.Plugin)
+	}
+	if inc.Error != "" {
+		text += fmt.Sprintf("Error: %s\n", inc.Error)
+	}
+	return &Alert{
+		Type:    string(inc.Type),
+		Subject: fmt.Sprintf("Bearded incident: %s", inc.Type),
+		Text:    text,
+		Payload: inc,
+
+		Template: "email/incident",
+		Data:     inc,
+	}
+}
+
+type Alerter struct {
+	// key of the payload in the webhook body
+	key    string
+	cfg    config.Alerts
+	mailer email.Mailer
+	from   string
+	http   *http.Client
+
+	// webhook deliveries are recorded if it's set, the manager is copied for every delivery
+	Manager *manager.Manager
+	// emails are localized with templates if it's set, recipients of alerts get the default locale
+	Template template.Renderer
+}
+
+// New creates alerter, emails are sent from the address with the mailer,
+// payloads are posted to the webhook under the key
+func New(key string, cfg config.Alerts, mailer email.Mailer, from string) *Alerter {
+	return &Alerter{
+		key:    key,
+		cfg:    cfg,
+		mailer: mailer,
+		from:   from,
+		http:   &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// Enabled returns true if alerts of this type are sent somewhere
+func (a *Alerter) Enabled(t string) bool {
+	if len(a.cfg.Emails) == 0 && a.cfg.Webhook == "" {
+		return false
+	}
+	if len(a.cfg.Types) == 0 {
+		return true
+	}
+	for _, v := range a.cfg.Types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Send the alert in background
+func (a *Alerter) Send(al *Alert) {
+	if !a.Enabled(al.Type) {
+		return
+	}
+	go func() {
+		if err := a.send(al); err != nil {
+			logrus.Errorf("Alert %q isn't sent: %s", al.Subject, err)
+		}
+	}()
+}
+
+func (a *Alerter) send(al *Alert) error {
+	var errs []error
+	if len(a.cfg.Emails) > 0 {
+		if err := a.sendEmail(al); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if a.cfg.Webhook != "" {
+		if err := a.sendWebhook(al); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+func (a *Alerter) sendEmail(al *Alert) error {
+	msg := email.NewMessage()
+	msg.SetHeader("From", msg.FormatAddress(a.from, "Bearded"))
+	subject, text := al.Email(a.Template, "")
+	msg.SetHeader("To", a.cfg.Emails...)
+	msg.SetHeader("Subject", subject)
+	msg.SetBody("text/plain", text)
+	return a.mailer.Send(msg)
+}
+
+// Key is the name of the webhook subscription
+func (a *Alerter) Key() string {
+	return a.key
+}
+
+// Subscription returns the webhook configuration, nil if the webhook isn't set
+func (a *Alerter) Subscription() *webhook.Subscription {
+	if a.cfg.Webhook == "" {
+		return nil
+	}
+	types := a.cfg.Types
+	if types == nil {
+		types = []string{}
+	}
+	return &webhook.Subscription{Name: a.key, Url: a.cfg.Webhook, Types: types}
+}
+
+func (a *Alerter) sendWebhook(al *Alert) error {
+	data, err := json.Marshal(map[string]interface{}{a.key: al.Payload})
+	if err != nil {
+		return err
+	}
+	d := a.post(&webhook.Delivery{Type: al.Type, Body: string(data)})
+	a.record(d)
+	if d.Status != webhook.StatusDelivered {
+		return fmt.Errorf("%s", d.Error)
+	}
+	return nil
+}
+
+// Replay posts the body of the delivery to the current webhook again, the new delivery is returned
+func (a *Alerter) Replay(orig *webhook.Delivery) *webhook.Delivery {
+	d := a.post(&webhook.Delivery{Type: orig.Type, Body: orig.Body, Replay: orig.Id})
+	a.record(d)
+	return d
+}
+
+func (a *Alerter) post(d *webhook.Delivery) *webhook.Delivery {
+	d.Subscription = a.key
+	d.Url = a.cfg.Webhook
+	d.Status = webhook.StatusFailed
+	started := time.Now()
+	resp, err := a.postBody([]byte(d.Body), started)
+	d.Duration = int64(time.Since(started) / time.Millisecond)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	defer resp.Body.Close()
+	d.Code = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		d.Error = fmt.Sprintf("webhook returned %d status", resp.StatusCode)
+		return d
+	}
+	d.Status = webhook.StatusDelivered
+	return d
+}
+
+// replayed deliveries are signed again, so they pass the time window of the receiver
+func (a *Alerter) postBody(body []byte, now time.Time) (*http.Response, error) {
+	req, err := http.NewRequest("POST", a.cfg.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.cfg.Secret != "" {
+		if err := signature.SignRequest(req, []byte(a.cfg.Secret), body, now); err != nil {
+			return nil, err
+		}
+	}
+	return a.http.Do(req)
+}
+
+// deliveries are only history, so failed recording doesn't fail sending
+func (a *Alerter) record(d *webhook.Delivery) {
+	if a.Manager == nil {
+		return
+	}
+	mgr := a.Manager.Copy()
+	defer mgr.Close()
+	if _, err := mgr.Webhooks.Create(d); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+}
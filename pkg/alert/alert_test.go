@@ -0,0 +1,207 @@
+package alert
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/gomail.v1"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/audit"
+	"github.com/bearded-web/bearded/models/incident"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/webhook"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/template"
+	signature "github.com/bearded-web/bearded/pkg/webhook"
+)
+
+type fakeMailer struct {
+	messages []*gomail.Message
+}
+
+func (m *fakeMailer) Send(msg *gomail.Message) error {
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *fakeMailer) Close() {}
+
+func TestEnabled(t *testing.T) {
+	a := New("event", config.Alerts{}, &fakeMailer{}, "")
+	require.False(t, a.Enabled(string(audit.TypeAdminAdded)))
+
+	a = New("event", config.Alerts{Emails: []string{"sec@example.com"}}, &fakeMailer{}, "")
+	require.True(t, a.Enabled(string(audit.TypeAdminAdded)))
+	require.True(t, a.Enabled(string(audit.TypeTokenCreated)))
+
+	a = New("event", config.Alerts{Webhook: "http://example.com", Types: []string{"admin_added"}}, &fakeMailer{}, "")
+	require.True(t, a.Enabled(string(audit.TypeAdminAdded)))
+	require.False(t, a.Enabled(string(audit.TypeTokenCreated)))
+}
+
+func TestSend(t *testing.T) {
+	var body map[string]*audit.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer srv.Close()
+
+	mailer := &fakeMailer{}
+	a := New("event", config.Alerts{Emails: []string{"sec@example.com"}, Webhook: srv.URL}, mailer, "bearded@example.com")
+	ev := &audit.Event{Id: bson.NewObjectId(), Type: audit.TypeAdminAdded, Email: "admin@example.com"}
+	require.NoError(t, a.send(AuditAlert(ev)))
+
+	require.Len(t, mailer.messages, 1)
+	require.Equal(t, []string{"sec@example.com"}, mailer.messages[0].GetHeader("To"))
+	require.NotNil(t, body["event"])
+	require.Equal(t, ev.Id, body["event"].Id)
+	require.Equal(t, "admin@example.com", body["event"].Email)
+}
+
+func TestSendWebhookError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	a := New("event", config.Alerts{Webhook: srv.URL}, &fakeMailer{}, "")
+	require.Error(t, a.send(AuditAlert(&audit.Event{Id: bson.NewObjectId(), Type: audit.TypeAdminRemoved})))
+}
+
+func TestIncidentAlert(t *testing.T) {
+	var body map[string]*incident.Incident
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer srv.Close()
+
+	mailer := &fakeMailer{}
+	a := New("incident", config.Alerts{Emails: []string{"ops@example.com"}, Webhook: srv.URL}, mailer, "bearded@example.com")
+	inc := &incident.Incident{
+		Id:      bson.NewObjectId(),
+		Type:    incident.TypeSessionFailed,
+		Agent:   bson.NewObjectId(),
+		Scan:    bson.NewObjectId(),
+		Error:   "container exited with 1",
+		Message: "Session is failed",
+	}
+	al := IncidentAlert(inc)
+	require.Contains(t, al.Text, inc.Agent.Hex())
+	require.Contains(t, al.Text, inc.Scan.Hex())
+	require.Contains(t, al.Text, "container exited with 1")
+	require.NoError(t, a.send(al))
+
+	require.Len(t, mailer.messages, 1)
+	require.Equal(t, []string{"Bearded incident: session_failed"}, mailer.messages[0].GetHeader("Subject"))
+	require.NotNil(t, body["incident"])
+	require.Equal(t, inc.Agent, body["incident"].Agent)
+}
+
+func TestReplay(t *testing.T) {
+	var body string
+	code := http.StatusBadGateway
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		body = string(data)
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	a := New("event", config.Alerts{Webhook: srv.URL}, &fakeMailer{}, "")
+	orig := &webhook.Delivery{Id: bson.NewObjectId(), Type: "admin_added", Body: `{"event":{}}`}
+
+	d := a.Replay(orig)
+	require.Equal(t, webhook.StatusFailed, d.Status)
+	require.Equal(t, http.StatusBadGateway, d.Code)
+	require.Equal(t, "event", d.Subscription)
+	require.Equal(t, orig.Id, d.Replay)
+
+	code = http.StatusOK
+	d = a.Replay(orig)
+	require.Equal(t, webhook.StatusDelivered, d.Status)
+	require.Empty(t, d.Error)
+	require.Equal(t, orig.Body, body)
+}
+
+func TestSignedWebhook(t *testing.T) {
+	verifier := signature.NewVerifier([]byte("secret"), 0)
+	var verifyErr error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, verifyErr = verifier.VerifyRequest(r)
+	}))
+	defer srv.Close()
+
+	a := New("event", config.Alerts{Webhook: srv.URL, Secret: "secret"}, &fakeMailer{}, "")
+	d := a.Replay(&webhook.Delivery{Type: "admin_added", Body: `{"event":{}}`})
+	require.Equal(t, webhook.StatusDelivered, d.Status)
+	require.NoError(t, verifyErr)
+
+	a = New("event", config.Alerts{Webhook: srv.URL}, &fakeMailer{}, "")
+	a.Replay(&webhook.Delivery{Type: "admin_added", Body: `{"event":{}}`})
+	require.Equal(t, signature.ErrNoSignature, verifyErr)
+}
+
+func TestScanFailedAlert(t *testing.T) {
+	mailer := &fakeMailer{}
+	n := NewScanNotifier(nil, mailer, "bearded@example.com", "http://bearded.example.com/scan/%s")
+	sc := &scan.Scan{Id: bson.NewObjectId(), Project: bson.NewObjectId(), Group: bson.NewObjectId()}
+	require.True(t, sc.Unattended())
+
+	al := n.ScanFailedAlert(sc, "no agents are registered")
+	require.Equal(t, string(incident.TypeScanFailed), al.Type)
+	require.Contains(t, al.Text, "no agents are registered")
+	require.Contains(t, al.Text, "http://bearded.example.com/scan/"+sc.Id.Hex())
+	inc := al.Payload.(*incident.Incident)
+	require.Equal(t, sc.Id, inc.Scan)
+	require.Equal(t, sc.Project, inc.Project)
+
+	require.NoError(t, n.send("owner@example.com", "ru", al))
+	require.Len(t, mailer.messages, 1)
+	require.Equal(t, []string{"owner@example.com"}, mailer.messages[0].GetHeader("To"))
+	require.Equal(t, []string{"Bearded scan " + sc.Id.Hex() + " is failed"}, mailer.messages[0].GetHeader("Subject"),
+		"without templates the english email is sent")
+
+	// scans started by users and nil notifiers are skipped, the manager isn't touched
+	n.Failed(&scan.Scan{Id: bson.NewObjectId()}, "failed")
+	(*ScanNotifier)(nil).Failed(sc, "failed")
+	require.Len(t, mailer.messages, 1)
+	require.True(t, (&scan.Scan{Windowed: true}).Unattended())
+}
+
+func TestAlertEmail(t *testing.T) {
+	tmpl := template.New(&template.Opts{Directory: "../../extra/templates"})
+	n := NewScanNotifier(nil, &fakeMailer{}, "", "http://bearded.example.com/scan/%s")
+	sc := &scan.Scan{Id: bson.NewObjectId()}
+	al := n.ScanFailedAlert(sc, "no agents are registered")
+
+	subject, text := al.Email(tmpl, "ru")
+	require.Equal(t, "Скан bearded "+sc.Id.Hex()+" завершился ошибкой", subject)
+	require.Contains(t, text, "no agents are registered")
+	require.Contains(t, text, "http://bearded.example.com/scan/"+sc.Id.Hex())
+
+	// there are no english templates, so the text of the alert is kept
+	subject, text = al.Email(tmpl, "")
+	require.Equal(t, al.Subject, subject)
+	require.Equal(t, al.Text, text)
+	subject, text = al.Email(nil, "ru")
+	require.Equal(t, al.Subject, subject)
+
+	inc := &incident.Incident{Id: bson.NewObjectId(), Type: incident.TypeSessionFailed, Scan: bson.NewObjectId(),
+		Message: "Session is failed", Error: "exit 1"}
+	subject, text = IncidentAlert(inc).Email(tmpl, "ru")
+	require.Equal(t, "Bearded: инцидент: session_failed", subject)
+	require.Contains(t, text, "Скан: "+inc.Scan.Hex())
+	require.Contains(t, text, "Ошибка: exit 1")
+	require.NotContains(t, text, "Агент")
+
+	ev := &audit.Event{Id: bson.NewObjectId(), Type: audit.TypeAdminAdded, Message: "Admin <a@example.com> is added"}
+	subject, text = AuditAlert(ev).Email(tmpl, "ru")
+	require.Equal(t, "Bearded: изменение привилегий: admin_added", subject)
+	require.Contains(t, text, "Admin <a@example.com> is added", "plain text isn't escaped")
+}
@@ -0,0 +1,54 @@
+package alert
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/incident"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+// Reporter records operational incidents and alerts ops about them
+type Reporter struct {
+	mgr     *manager.Manager
+	alerter *Alerter
+}
+
+// NewReporter creates reporter, the manager is used from different goroutines, so it's copied on every report.
+// Alerts aren't sent if the alerter is nil.
+func NewReporter(mgr *manager.Manager, alerter *Alerter) *Reporter {
+	return &Reporter{
+		mgr:     mgr,
+		alerter: alerter,
+	}
+}
+
+// Alerter returns the alerter of incidents, it's nil if alerts aren't sent
+func (r *Reporter) Alerter() *Alerter {
+	if r == nil {
+		return nil
+	}
+	return r.alerter
+}
+
+// Report the incident, it's only logged if the reporter is nil.
+// Incidents are reported when something is already broken, so errors are only logged.
+func (r *Reporter) Report(inc *incident.Incident) {
+	if inc.Error != "" {
+		logrus.Errorf("Incident %s: %s: %s", inc.Type, inc.Message, inc.Error)
+	} else {
+		logrus.Errorf("Incident %s: %s", inc.Type, inc.Message)
+	}
+	if r == nil {
+		return
+	}
+	mgr := r.mgr.Copy()
+	defer mgr.Close()
+	// ops are alerted even if the db is the broken part
+	if _, err := mgr.Incidents.Create(inc); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+	if r.alerter != nil {
+		r.alerter.Send(IncidentAlert(inc))
+	}
+}
@@ -0,0 +1,108 @@
+package alert
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/bearded-web/bearded/models/incident"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/email"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/template"
+)
+
+// ScanNotifier tells owners of unattended scans that they are failed or can't be dispatched,
+// nobody watches such scans, so failures aren't noticed otherwise
+type ScanNotifier struct {
+	mgr    *manager.Manager
+	mailer email.Mailer
+	from   string
+	// link to the scan page, %s is replaced with the scan id
+	link string
+
+	// notifications are recorded as incidents too, so they are posted to the incident webhook
+	Incidents *Reporter
+	// emails are localized in the locale of the owner if it's set
+	Template template.Renderer
+}
+
+// NewScanNotifier creates notifier, emails are sent from the address with the mailer,
+// the manager is copied on every notification
+func NewScanNotifier(mgr *manager.Manager, mailer email.Mailer, from, link string) *ScanNotifier {
+	return &ScanNotifier{
+		mgr:    mgr,
+		mailer: mailer,
+		from:   from,
+		link:   link,
+	}
+}
+
+// ScanFailedAlert is posted to the incident webhook as {"incident": {...}} and emailed to the owner
+func (n *ScanNotifier) ScanFailedAlert(sc *scan.Scan, reason string) *Alert {
+	inc := &incident.Incident{
+		Type:    incident.TypeScanFailed,
+		Project: sc.Project,
+		Scan:    sc.Id,
+		Error:   reason,
+		Message: fmt.Sprintf("Unattended scan %s is failed", sc.Id.Hex()),
+	}
+	link := strings.Replace(n.link, "%s", sc.Id.Hex(), 1)
+	return &Alert{
+		Type:    string(inc.Type),
+		Subject: fmt.Sprintf("Bearded scan %s is failed", sc.Id.Hex()),
+		Text:    fmt.Sprintf("%s: %s\n\n%s\n", inc.Message, reason, link),
+		Payload: inc,
+
+		Template: "email/scan-failed",
+		Data:     map[string]string{"Scan": sc.Id.Hex(), "Reason": reason, "Link": link},
+	}
+}
+
+// Failed notifies the owner of the unattended scan in background, scans started by users aren't notified.
+// It does nothing if the notifier is nil.
+func (n *ScanNotifier) Failed(sc *scan.Scan, reason string) {
+	if n == nil || !sc.Unattended() {
+		return
+	}
+	al := n.ScanFailedAlert(sc, reason)
+	n.Incidents.Report(al.Payload.(*incident.Incident))
+	go func() {
+		if err := n.notify(sc, al); err != nil {
+			logrus.Errorf("Owner of scan %s isn't notified: %s", sc.Id.Hex(), err)
+		}
+	}()
+}
+
+// scans of groups are owned by users who started them, owners of projects are notified about others
+func (n *ScanNotifier) notify(sc *scan.Scan, al *Alert) error {
+	mgr := n.mgr.Copy()
+	defer mgr.Close()
+	owner := sc.Owner
+	if owner == "" {
+		p, err := mgr.Projects.GetById(sc.Project)
+		if err != nil {
+			return err
+		}
+		owner = p.Owner
+	}
+	u, err := mgr.Users.GetById(owner)
+	if err != nil {
+		return err
+	}
+	return n.send(u.Email, u.Locale, al)
+}
+
+func (n *ScanNotifier) send(to, locale string, al *Alert) error {
+	if to == "" {
+		return nil
+	}
+	subject, text := al.Email(n.Template, locale)
+	msg := email.NewMessage()
+	msg.SetHeader("From", msg.FormatAddress(n.from, "Bearded"))
+	msg.SetHeader("To", to)
+	msg.SetHeader("Subject", subject)
+	msg.SetBody("text/plain", text)
+	return n.mailer.Send(msg)
+}
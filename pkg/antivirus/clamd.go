@@ -0,0 +1,126 @@
+package antivirus
+
+// Client for clamd INSTREAM command.
+// Data is sent in chunks prefixed with the length, the zero length chunk ends the stream.
+// Read more https://linux.die.net/man/8/clamd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTimeout = time.Second * 30
+
+	chunkSize = 64 << 10
+)
+
+// ErrTooLarge is returned if the file exceeds StreamMaxLength of clamd, the file can't be checked
+var ErrTooLarge = errors.New("clamd: file is larger than the stream limit")
+
+// Scanner checks uploaded files, the virus name is returned for infected ones
+type Scanner interface {
+	Scan(r io.Reader) (string, error)
+}
+
+type Clamd struct {
+	// tcp address like 127.0.0.1:3310 or path of the unix socket
+	Addr    string
+	Timeout time.Duration
+}
+
+// NewClamd creates the client, the default timeout is used if it's zero
+func NewClamd(addr string, timeout time.Duration) *Clamd {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &Clamd{Addr: addr, Timeout: timeout}
+}
+
+func (c *Clamd) Scan(r io.Reader) (string, error) {
+	network := "tcp"
+	if strings.HasPrefix(c.Addr, "/") {
+		network = "unix"
+	}
+	conn, err := net.DialTimeout(network, c.Addr, c.Timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", err
+	}
+	buf := make([]byte, chunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return "", writeErr(conn, err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return "", writeErr(conn, err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return "", writeErr(conn, err)
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return "", err
+	}
+	return parseReply(reply)
+}
+
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+// clamd replies and closes the connection when the stream exceeds the limit,
+// so the reply is checked if the stream can't be written
+func writeErr(conn net.Conn, err error) error {
+	if reply, rErr := readReply(conn); rErr == nil && isSizeLimit(reply) {
+		return ErrTooLarge
+	}
+	return err
+}
+
+func isSizeLimit(reply string) bool {
+	return strings.Contains(reply, "size limit exceeded")
+}
+
+// reply is "stream: OK", "stream: <virus> FOUND" or "<message> ERROR"
+func parseReply(reply string) (string, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return strings.TrimSuffix(reply, " FOUND"), nil
+	case isSizeLimit(reply):
+		return "", ErrTooLarge
+	}
+	return "", fmt.Errorf("clamd: %s", reply)
+}
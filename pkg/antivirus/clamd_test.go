@@ -0,0 +1,77 @@
+package antivirus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fake clamd reports files with the eicar word
+func fakeClamd(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			cmd, _ := r.ReadString(0)
+			if cmd != "zINSTREAM\x00" {
+				conn.Write([]byte("UNKNOWN COMMAND ERROR\x00"))
+				conn.Close()
+				continue
+			}
+			data := &bytes.Buffer{}
+			for {
+				var size uint32
+				if err := binary.Read(r, binary.BigEndian, &size); err != nil || size == 0 {
+					break
+				}
+				io.CopyN(data, r, int64(size))
+			}
+			if strings.Contains(data.String(), "eicar") {
+				conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+			} else {
+				conn.Write([]byte("stream: OK\x00"))
+			}
+			conn.Close()
+		}
+	}()
+	return l
+}
+
+func TestClamd(t *testing.T) {
+	l := fakeClamd(t)
+	defer l.Close()
+
+	c := NewClamd(l.Addr().String(), 0)
+	virus, err := c.Scan(strings.NewReader("clean file"))
+	require.NoError(t, err)
+	assert.Equal(t, "", virus)
+
+	// large files are sent in several chunks
+	data := bytes.Repeat([]byte("a"), chunkSize*2+10)
+	virus, err = c.Scan(io.MultiReader(bytes.NewReader(data), strings.NewReader("eicar")))
+	require.NoError(t, err)
+	assert.Equal(t, "Eicar-Test-Signature", virus)
+
+	_, err = NewClamd("127.0.0.1:1", 0).Scan(strings.NewReader("file"))
+	assert.Error(t, err)
+}
+
+func TestParseReply(t *testing.T) {
+	_, err := parseReply("INSTREAM size limit exceeded. ERROR")
+	assert.Equal(t, ErrTooLarge, err)
+	_, err = parseReply("UNKNOWN COMMAND ERROR")
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrTooLarge, err)
+}
@@ -0,0 +1,259 @@
+package archive
+
+// Projects are exported to a zip archive of json documents and files, so they could be imported
+// to another instance. Ids are remapped on import, plugins are referenced by name and version.
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/file"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
+)
+
+// Version of the archive format, archives of newer versions aren't imported
+const Version = 1
+
+const (
+	ContentType = "application/zip"
+
+	manifestName = "manifest.json"
+	filesDir     = "files"
+)
+
+type PluginRef struct {
+	Id      bson.ObjectId `json:"id,omitempty" description:"plugin id on the source instance"`
+	Name    string        `json:"name"`
+	Version string        `json:"version"`
+}
+
+func (p *PluginRef) String() string {
+	return fmt.Sprintf("%s:%s", p.Name, p.Version)
+}
+
+type Manifest struct {
+	Version int           `json:"version"`
+	Created time.Time     `json:"created"`
+	Project bson.ObjectId `json:"project" description:"project id on the source instance"`
+	Plugins []*PluginRef  `json:"plugins" description:"plugins which are used by plans and scans"`
+}
+
+type File struct {
+	Meta *file.Meta
+	Data []byte
+	// exported files are opened when the archive is written, Data is used if it's nil
+	Open func() (io.ReadCloser, error)
+}
+
+type Archive struct {
+	Manifest *Manifest
+	Project  *project.Project
+	Targets  []*target.Target
+	Plans    []*plan.Plan
+	Scans    []*scan.Scan
+	Reports  []*report.Report
+	Issues   []*issue.TargetIssue
+	Files    []*File
+}
+
+// json documents in order of writing, the manifest is the first one
+var documentNames = []string{manifestName, "project.json", "targets.json", "plans.json",
+	"scans.json", "reports.json", "issues.json"}
+
+// documents of the archive by file name
+func (a *Archive) documents() map[string]interface{} {
+	return map[string]interface{}{
+		manifestName:   &a.Manifest,
+		"project.json": &a.Project,
+		"targets.json": &a.Targets,
+		"plans.json":   &a.Plans,
+		"scans.json":   &a.Scans,
+		"reports.json": &a.Reports,
+		"issues.json":  &a.Issues,
+	}
+}
+
+// Write the archive as zip
+func Write(w io.Writer, a *Archive) error {
+	zw := zip.NewWriter(w)
+	docs := a.documents()
+	for _, name := range documentNames {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if err := json.NewEncoder(f).Encode(docs[name]); err != nil {
+			return err
+		}
+	}
+	metas := make([]*file.Meta, 0, len(a.Files))
+	for _, af := range a.Files {
+		f, err := zw.Create(path.Join(filesDir, af.Meta.Id))
+		if err != nil {
+			return err
+		}
+		if af.Open == nil {
+			if _, err := f.Write(af.Data); err != nil {
+				return err
+			}
+		} else if err := copyFile(f, af); err != nil {
+			return err
+		}
+		metas = append(metas, af.Meta)
+	}
+	f, err := zw.Create("files.json")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(metas); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// returned when the uncompressed archive is larger than the limit
+type SizeError struct {
+	Limit int64
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("archive is larger than %d bytes uncompressed", e.Limit)
+}
+
+func copyFile(w io.Writer, af *File) error {
+	r, err := af.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// Read the zip archive, the manifest version is checked before other documents are decoded.
+// The total uncompressed size is limited by maxSize, zero disables the limit. Sizes from zip headers are
+// checked before reading and the read data is counted too, so archives with wrong headers are stopped as well.
+func Read(data []byte, maxSize int64) (*Archive, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("archive isn't a zip file: %s", err)
+	}
+	entries := map[string]*zip.File{}
+	var total uint64
+	for _, f := range zr.File {
+		entries[f.Name] = f
+		total += f.UncompressedSize64
+	}
+	if maxSize > 0 && total > uint64(maxSize) {
+		return nil, &SizeError{Limit: maxSize}
+	}
+	budget := &sizeBudget{limit: maxSize, left: maxSize}
+	open := func(f *zip.File) (io.ReadCloser, error) {
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		return budget.wrap(r), nil
+	}
+	readJson := func(name string, doc interface{}) error {
+		f, ok := entries[name]
+		if !ok {
+			return fmt.Errorf("archive doesn't have %s", name)
+		}
+		r, err := open(f)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		if err := json.NewDecoder(r).Decode(doc); err != nil {
+			if sErr, ok := err.(*SizeError); ok {
+				return sErr
+			}
+			return fmt.Errorf("archive has broken %s: %s", name, err)
+		}
+		return nil
+	}
+
+	a := &Archive{}
+	if err := readJson(manifestName, &a.Manifest); err != nil {
+		return nil, err
+	}
+	if a.Manifest == nil || a.Manifest.Version < 1 {
+		return nil, fmt.Errorf("archive has wrong manifest")
+	}
+	if a.Manifest.Version > Version {
+		return nil, fmt.Errorf("archive version %d is newer than supported %d", a.Manifest.Version, Version)
+	}
+	docs := a.documents()
+	for _, name := range documentNames[1:] {
+		if err := readJson(name, docs[name]); err != nil {
+			return nil, err
+		}
+	}
+	if a.Project == nil {
+		return nil, fmt.Errorf("archive doesn't have a project")
+	}
+
+	metas := []*file.Meta{}
+	if err := readJson("files.json", &metas); err != nil {
+		return nil, err
+	}
+	for _, meta := range metas {
+		f, ok := entries[path.Join(filesDir, meta.Id)]
+		if !ok {
+			return nil, fmt.Errorf("archive doesn't have file %s", meta.Id)
+		}
+		r, err := open(f)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		a.Files = append(a.Files, &File{Meta: meta, Data: data})
+	}
+	return a, nil
+}
+
+// sizeBudget is shared by readers of the archive entries, reading fails when it's spent
+type sizeBudget struct {
+	limit int64
+	left  int64
+}
+
+func (b *sizeBudget) wrap(r io.ReadCloser) io.ReadCloser {
+	if b.limit <= 0 {
+		return r
+	}
+	return &budgetReader{ReadCloser: r, budget: b, limited: io.LimitReader(r, b.left+1)}
+}
+
+type budgetReader struct {
+	io.ReadCloser
+	budget  *sizeBudget
+	limited io.Reader
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	n, err := r.limited.Read(p)
+	r.budget.left -= int64(n)
+	if r.budget.left < 0 {
+		return 0, &SizeError{Limit: r.budget.limit}
+	}
+	return n, err
+}
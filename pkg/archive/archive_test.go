@@ -0,0 +1,191 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/file"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
+)
+
+func testArchive() *Archive {
+	projectId, targetId, planId, scanId := bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()
+	sessId, childId, reportId, issueId := bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()
+	pluginId, baselineId := bson.NewObjectId(), bson.NewObjectId()
+	attachment := &file.Meta{Id: "file-1", Name: "screenshot.png", ContentType: "image/png"}
+	return &Archive{
+		Manifest: &Manifest{
+			Version: Version,
+			Created: time.Now().UTC(),
+			Project: projectId,
+			Plugins: []*PluginRef{{Id: pluginId, Name: "barbudo/wappalyzer", Version: "0.0.2"}},
+		},
+		Project: &project.Project{
+			Id:       projectId,
+			Name:     "web",
+			Owner:    bson.NewObjectId(),
+			Members:  []*project.Member{{User: bson.NewObjectId()}},
+			Baseline: &project.Baseline{Id: baselineId, Scan: scanId, Count: 1},
+		},
+		Targets: []*target.Target{{Id: targetId, Type: target.TypeWeb, Project: projectId,
+			Web: &target.WebTarget{Domain: "http://example.com"}}},
+		Plans: []*plan.Plan{{Id: planId, Name: "wappalyzer",
+			Workflow: []*plan.WorkflowStep{{Plugin: "barbudo/wappalyzer:0.0.2"}}}},
+		Scans: []*scan.Scan{{
+			Id: scanId, Status: scan.StatusFinished, Plan: planId, Target: targetId, Project: projectId,
+			Sessions: []*scan.Session{{
+				Id: sessId, Scan: scanId, Plugin: pluginId, Agent: bson.NewObjectId(), Status: scan.StatusFinished,
+				Children: []*scan.Session{{Id: childId, Scan: scanId, Parent: sessId, Plugin: pluginId}},
+			}},
+		}},
+		Reports: []*report.Report{{Id: reportId, Type: report.TypeRaw, Scan: scanId, ScanSession: childId,
+			Raw: report.Raw{Raw: "raw", Files: []*file.Meta{attachment}}}},
+		Issues: []*issue.TargetIssue{{
+			Id: issueId, Target: targetId, Project: projectId, Baseline: baselineId,
+			Activities: []*issue.Activity{{Type: issue.ActivityReported, User: bson.NewObjectId(),
+				Report: &issue.Report{Report: reportId, Scan: scanId, ScanSession: childId}}},
+			Origin: &issue.Report{Report: reportId, Scan: scanId, ScanSession: childId, Plugin: "barbudo/wappalyzer:0.0.2"},
+			Issue:  issue.Issue{Summary: "xss", Attachments: []*file.Meta{attachment}},
+		}},
+		Files: []*File{{Meta: attachment, Data: []byte("png")}},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	a := testArchive()
+	buf := &bytes.Buffer{}
+	require.NoError(t, Write(buf, a))
+
+	b, err := Read(buf.Bytes(), 0)
+	require.NoError(t, err)
+	require.Equal(t, a.Manifest.Project, b.Manifest.Project)
+	require.Equal(t, a.Project.Id, b.Project.Id)
+	require.Equal(t, a.Manifest.Plugins, b.Manifest.Plugins)
+	require.Len(t, b.Scans, 1)
+	require.Len(t, b.Scans[0].Sessions[0].Children, 1)
+	require.Equal(t, "raw", b.Reports[0].Raw.Raw)
+	require.Equal(t, "xss", b.Issues[0].Summary)
+	require.Len(t, b.Files, 1)
+	require.Equal(t, []byte("png"), b.Files[0].Data)
+
+	// exported files are read when the archive is written
+	a.Files[0].Data = nil
+	a.Files[0].Open = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("opened")), nil
+	}
+	buf.Reset()
+	require.NoError(t, Write(buf, a))
+	b, err = Read(buf.Bytes(), 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("opened"), b.Files[0].Data)
+}
+
+func TestReadLimit(t *testing.T) {
+	a := testArchive()
+	a.Files[0].Data = bytes.Repeat([]byte("a"), 1<<20)
+	buf := &bytes.Buffer{}
+	require.NoError(t, Write(buf, a))
+	// the data is compressed well, so the archive is small
+	require.True(t, buf.Len() < 1<<16)
+
+	_, err := Read(buf.Bytes(), 1<<16)
+	require.IsType(t, &SizeError{}, err)
+	_, err = Read(buf.Bytes(), 2<<20)
+	require.NoError(t, err)
+
+	// sizes from zip headers aren't trusted
+	budget := &sizeBudget{limit: 10, left: 10}
+	r := budget.wrap(ioutil.NopCloser(strings.NewReader("0123456789")))
+	_, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	r = budget.wrap(ioutil.NopCloser(strings.NewReader("a")))
+	_, err = ioutil.ReadAll(r)
+	require.Equal(t, &SizeError{Limit: 10}, err)
+}
+
+func TestReadVersion(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	f, err := zw.Create(manifestName)
+	require.NoError(t, err)
+	require.NoError(t, json.NewEncoder(f).Encode(&Manifest{Version: Version + 1}))
+	require.NoError(t, zw.Close())
+
+	_, err = Read(buf.Bytes(), 0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "newer than supported")
+
+	_, err = Read([]byte("not a zip"), 0)
+	require.Error(t, err)
+}
+
+func TestRemap(t *testing.T) {
+	a := testArchive()
+	oldProject, oldOwner := a.Project.Id, a.Project.Owner
+	oldScan, oldSess := a.Scans[0].Id, a.Scans[0].Sessions[0].Id
+	oldBaseline := a.Project.Baseline.Id
+	oldPlugin := a.Scans[0].Sessions[0].Plugin
+
+	owner := bson.NewObjectId()
+	newPlugin := bson.NewObjectId()
+	im := newImporter(owner)
+	im.plugins[oldPlugin] = newPlugin
+	im.files["file-1"] = &file.Meta{Id: "file-2", Name: "screenshot.png"}
+	// the file isn't in the archive
+	a.Issues[0].Attachments = append(a.Issues[0].Attachments, &file.Meta{Id: "file-3"})
+	a.Targets[0].Android = &target.AndroidTarget{File: &file.Meta{Id: "file-3"}}
+	im.remap(a)
+
+	p := a.Project
+	require.NotEqual(t, oldProject, p.Id)
+	require.Equal(t, owner, p.Owner)
+	require.NotEqual(t, oldOwner, p.Owner)
+	require.Empty(t, p.Members)
+
+	sc := a.Scans[0]
+	require.NotEqual(t, oldScan, sc.Id)
+	require.Equal(t, p.Id, sc.Project)
+	require.Equal(t, a.Targets[0].Id, sc.Target)
+	require.Equal(t, a.Plans[0].Id, sc.Plan)
+	require.Equal(t, p.Baseline.Scan, sc.Id)
+
+	sess := sc.Sessions[0]
+	child := sess.Children[0]
+	require.NotEqual(t, oldSess, sess.Id)
+	require.Equal(t, sess.Id, child.Parent)
+	require.Equal(t, sc.Id, child.Scan)
+	require.Equal(t, newPlugin, sess.Plugin)
+	require.Equal(t, bson.ObjectId(""), sess.Agent)
+
+	rep := a.Reports[0]
+	require.Equal(t, sc.Id, rep.Scan)
+	require.Equal(t, child.Id, rep.ScanSession)
+	require.Equal(t, "file-2", rep.Files[0].Id)
+
+	iss := a.Issues[0]
+	require.NotEqual(t, oldBaseline, p.Baseline.Id)
+	require.Equal(t, p.Baseline.Id, iss.Baseline)
+	require.Equal(t, a.Targets[0].Id, iss.Target)
+	require.Equal(t, []*file.Meta{{Id: "file-2", Name: "screenshot.png"}}, iss.Attachments)
+	require.Nil(t, a.Targets[0].Android.File)
+	act := iss.Activities[0]
+	require.Equal(t, bson.ObjectId(""), act.User)
+	require.Equal(t, rep.Id, act.Report.Report)
+	require.Equal(t, child.Id, act.Report.ScanSession)
+	require.Equal(t, sc.Id, iss.Origin.Scan)
+	require.Equal(t, "barbudo/wappalyzer:0.0.2", iss.Origin.Plugin)
+}
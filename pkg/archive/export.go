@@ -0,0 +1,153 @@
+package archive
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/file"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+// Export collects the project with targets, finished scans with reports, issues, used plans and files.
+// Scans which are still running are skipped, they couldn't be continued on another instance.
+func Export(mgr *manager.Manager, p *project.Project) (*Archive, error) {
+	a := &Archive{
+		Manifest: &Manifest{
+			Version: Version,
+			Created: time.Now().UTC(),
+			Project: p.Id,
+			Plugins: []*PluginRef{},
+		},
+		Project: p,
+	}
+	var err error
+	query := bson.M{"project": p.Id}
+	if a.Targets, _, err = mgr.Targets.FilterByQuery(query); err != nil {
+		return nil, err
+	}
+	if a.Issues, _, err = mgr.Issues.FilterByQuery(query); err != nil {
+		return nil, err
+	}
+	scans, _, err := mgr.Scans.FilterByQuery(bson.M{
+		"project": p.Id,
+		"status":  bson.M{"$in": []scan.ScanStatus{scan.StatusFinished, scan.StatusFailed}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.Scans = scans
+
+	sessions := []*scan.Session{}
+	planIds := []bson.ObjectId{}
+	for _, sc := range scans {
+		sessions = append(sessions, sc.GetAllSessions()...)
+		planIds = append(planIds, sc.Plan)
+	}
+	if len(sessions) > 0 {
+		if a.Reports, _, err = mgr.Reports.FilterBySessions(sessions); err != nil {
+			return nil, err
+		}
+	} else {
+		a.Reports = []*report.Report{}
+	}
+	if a.Plans, _, err = mgr.Plans.FilterByQuery(bson.M{"_id": bson.M{"$in": planIds}}); err != nil {
+		return nil, err
+	}
+
+	if err := exportPlugins(mgr, a, sessions); err != nil {
+		return nil, err
+	}
+	if err := exportFiles(mgr, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// plugins are taken from sessions by id and from plan steps by name
+func exportPlugins(mgr *manager.Manager, a *Archive, sessions []*scan.Session) error {
+	known := map[string]bool{}
+	add := func(ref *PluginRef) {
+		if !known[ref.String()] {
+			known[ref.String()] = true
+			a.Manifest.Plugins = append(a.Manifest.Plugins, ref)
+		}
+	}
+	ids := map[bson.ObjectId]bool{}
+	for _, sess := range sessions {
+		if sess.Plugin == "" || ids[sess.Plugin] {
+			continue
+		}
+		ids[sess.Plugin] = true
+		pl, err := mgr.Plugins.GetById(mgr.FromId(sess.Plugin))
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		add(&PluginRef{Id: pl.Id, Name: pl.Name, Version: pl.Version})
+	}
+	for _, pl := range a.Plans {
+		for _, step := range pl.Workflow {
+			name, version := step.Plugin, ""
+			if i := strings.Index(name, ":"); i >= 0 {
+				name, version = name[:i], name[i+1:]
+			}
+			add(&PluginRef{Name: name, Version: version})
+		}
+	}
+	return nil
+}
+
+// files of android targets, issue attachments and raw reports are copied to the archive
+func exportFiles(mgr *manager.Manager, a *Archive) error {
+	metas := []*file.Meta{}
+	for _, t := range a.Targets {
+		if t.Android != nil && t.Android.File != nil {
+			metas = append(metas, t.Android.File)
+		}
+	}
+	for _, iss := range a.Issues {
+		metas = append(metas, iss.Attachments...)
+	}
+	for _, rep := range a.Reports {
+		metas = append(metas, reportFiles(rep)...)
+	}
+
+	seen := map[string]bool{}
+	for _, meta := range metas {
+		if meta == nil || meta.Id == "" || seen[meta.Id] {
+			continue
+		}
+		seen[meta.Id] = true
+		f, err := mgr.Files.GetById(meta.Id)
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				// links to removed files are kept, like on the source instance
+				continue
+			}
+			return err
+		}
+		f.Close()
+		// the data is read when the archive is written
+		id := meta.Id
+		a.Files = append(a.Files, &File{Meta: f.Meta, Open: func() (io.ReadCloser, error) {
+			return mgr.Files.GetById(id)
+		}})
+	}
+	return nil
+}
+
+func reportFiles(rep *report.Report) []*file.Meta {
+	result := append([]*file.Meta{}, rep.Files...)
+	for _, child := range rep.Multi {
+		result = append(result, reportFiles(child)...)
+	}
+	return result
+}
@@ -0,0 +1,258 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/file"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+// returned when the user already has a project with the name of the imported one
+var ErrProjectExists = errors.New("project with this name is existed")
+
+type Result struct {
+	Project        *project.Project `json:"project"`
+	MissingPlugins []string         `json:"missingPlugins" description:"plugins which aren't found on this instance in form of name:version"`
+	ReusedPlans    []string         `json:"reusedPlans" description:"plans which are existed on this instance with the same name, they are used instead of imported ones"`
+}
+
+// Import recreates the project from the archive with new ids, the user becomes the owner.
+// Users of the source instance aren't known, so members and authors of activities are dropped.
+// Plans are shared between projects, so the existed ones with the same name are used.
+// The project is inserted the last, so objects of a failed import aren't visible to anybody.
+func Import(mgr *manager.Manager, a *Archive, owner bson.ObjectId) (*Result, error) {
+	_, count, err := mgr.Projects.FilterByQuery(bson.M{"name": a.Project.Name, "owner": owner})
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrProjectExists
+	}
+
+	im := newImporter(owner)
+	result := &Result{MissingPlugins: []string{}, ReusedPlans: []string{}}
+	for _, ref := range a.Manifest.Plugins {
+		query := bson.M{"name": ref.Name}
+		if ref.Version != "" {
+			query["version"] = ref.Version
+		}
+		plugins, _, err := mgr.Plugins.FilterByQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		if len(plugins) == 0 {
+			result.MissingPlugins = append(result.MissingPlugins, ref.String())
+			continue
+		}
+		if ref.Id != "" {
+			im.plugins[ref.Id] = plugins[0].Id
+		}
+	}
+
+	plans := []*plan.Plan{}
+	for _, pl := range a.Plans {
+		existed, _, err := mgr.Plans.FilterByQuery(bson.M{"name": pl.Name})
+		if err != nil {
+			return nil, err
+		}
+		if len(existed) > 0 {
+			im.ids[pl.Id] = existed[0].Id
+			result.ReusedPlans = append(result.ReusedPlans, pl.Name)
+			continue
+		}
+		plans = append(plans, pl)
+	}
+	a.Plans = plans
+
+	for _, f := range a.Files {
+		// files are linked to the project when objects with them are imported
+		f.Meta.Owner, f.Meta.Project = owner, ""
+		meta, err := mgr.Files.Create(bytes.NewReader(f.Data), f.Meta)
+		if err != nil {
+			return nil, err
+		}
+		im.files[f.Meta.Id] = meta
+	}
+
+	im.remap(a)
+
+	for _, obj := range a.Plans {
+		if err := mgr.Plans.Import(obj); err != nil {
+			return nil, err
+		}
+	}
+	for _, obj := range a.Targets {
+		if err := mgr.Targets.Import(obj); err != nil {
+			return nil, err
+		}
+	}
+	for _, obj := range a.Scans {
+		if err := mgr.Scans.Import(obj); err != nil {
+			return nil, err
+		}
+	}
+	for _, obj := range a.Reports {
+		if err := mgr.Reports.Import(obj); err != nil {
+			return nil, err
+		}
+	}
+	for _, obj := range a.Issues {
+		if err := mgr.Issues.Import(obj); err != nil {
+			return nil, err
+		}
+	}
+	if err := mgr.Projects.Import(a.Project); err != nil {
+		return nil, err
+	}
+	result.Project = a.Project
+	return result, nil
+}
+
+type importer struct {
+	owner bson.ObjectId
+	// new ids by ids of the source instance
+	ids map[bson.ObjectId]bson.ObjectId
+	// plugins of this instance by ids of the source instance
+	plugins map[bson.ObjectId]bson.ObjectId
+	// created files by ids of the source instance
+	files map[string]*file.Meta
+}
+
+func newImporter(owner bson.ObjectId) *importer {
+	return &importer{
+		owner:   owner,
+		ids:     map[bson.ObjectId]bson.ObjectId{},
+		plugins: map[bson.ObjectId]bson.ObjectId{},
+		files:   map[string]*file.Meta{},
+	}
+}
+
+// id returns the new id for the source one, the same source id always gets the same new id
+func (im *importer) id(old bson.ObjectId) bson.ObjectId {
+	if old == "" {
+		return ""
+	}
+	if id, ok := im.ids[old]; ok {
+		return id
+	}
+	id := bson.NewObjectId()
+	im.ids[old] = id
+	return id
+}
+
+// links to files which aren't in the archive are dropped, ids of the source instance could point
+// to unrelated files of this one
+func (im *importer) file(meta *file.Meta) *file.Meta {
+	if meta == nil {
+		return nil
+	}
+	return im.files[meta.Id]
+}
+
+func (im *importer) fileList(metas []*file.Meta) []*file.Meta {
+	if metas == nil {
+		return nil
+	}
+	result := make([]*file.Meta, 0, len(metas))
+	for _, meta := range metas {
+		if created := im.file(meta); created != nil {
+			result = append(result, created)
+		}
+	}
+	return result
+}
+
+// remap replaces all ids of the archive objects with new ones
+func (im *importer) remap(a *Archive) {
+	p := a.Project
+	p.Id = im.id(p.Id)
+	p.Owner = im.owner
+	p.Members = []*project.Member{}
+	if p.Baseline != nil {
+		p.Baseline.Id = im.id(p.Baseline.Id)
+		p.Baseline.Scan = im.id(p.Baseline.Scan)
+	}
+
+	for _, t := range a.Targets {
+		t.Id = im.id(t.Id)
+		t.Project = p.Id
+		if t.Android != nil {
+			t.Android.File = im.file(t.Android.File)
+		}
+	}
+
+	for _, pl := range a.Plans {
+		pl.Id = im.id(pl.Id)
+	}
+
+	for _, sc := range a.Scans {
+		sc.Id = im.id(sc.Id)
+		sc.Plan = im.id(sc.Plan)
+		sc.Target = im.id(sc.Target)
+		sc.Project = p.Id
+		sc.Owner = im.owner
+		for _, sess := range sc.GetAllSessions() {
+			im.remapSession(sc, sess)
+		}
+	}
+
+	for _, rep := range a.Reports {
+		im.remapReport(rep)
+		rep.Project = p.Id
+	}
+
+	for _, iss := range a.Issues {
+		iss.Id = im.id(iss.Id)
+		iss.Target = im.id(iss.Target)
+		iss.Project = p.Id
+		iss.Baseline = im.id(iss.Baseline)
+		iss.Attachments = im.fileList(iss.Attachments)
+		for _, act := range iss.Activities {
+			act.User = ""
+			im.remapIssueReport(act.Report)
+		}
+		im.remapIssueReport(iss.Origin)
+		for _, merged := range iss.Merged {
+			merged.Id = im.id(merged.Id)
+			merged.Target = im.id(merged.Target)
+		}
+	}
+}
+
+// agents of the source instance aren't known, plugins are replaced with the ones of this instance if they are found
+func (im *importer) remapSession(sc *scan.Scan, sess *scan.Session) {
+	sess.Id = im.id(sess.Id)
+	sess.Scan = sc.Id
+	sess.Parent = im.id(sess.Parent)
+	sess.Agent = ""
+	if id, ok := im.plugins[sess.Plugin]; ok {
+		sess.Plugin = id
+	}
+}
+
+func (im *importer) remapIssueReport(rep *issue.Report) {
+	if rep == nil {
+		return
+	}
+	rep.Report = im.id(rep.Report)
+	rep.Scan = im.id(rep.Scan)
+	rep.ScanSession = im.id(rep.ScanSession)
+}
+
+func (im *importer) remapReport(rep *report.Report) {
+	rep.Id = im.id(rep.Id)
+	rep.Scan = im.id(rep.Scan)
+	rep.ScanSession = im.id(rep.ScanSession)
+	rep.Files = im.fileList(rep.Files)
+	for _, child := range rep.Multi {
+		im.remapReport(child)
+	}
+}
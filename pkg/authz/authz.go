@@ -0,0 +1,82 @@
+package authz
+
+// Client of an external policy engine, e.g. Open Policy Agent data api.
+// The decision input is posted as {"input": {...}}, the engine answers {"result": true}.
+// Read more http://www.openpolicyagent.org/docs/rest-api.html#get-a-document-with-input
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const DefaultTimeout = time.Second * 3
+
+type Subject struct {
+	Id      string `json:"id"`
+	Email   string `json:"email"`
+	Admin   bool   `json:"admin"`
+	Service bool   `json:"service" description:"subject is a project service user"`
+}
+
+type Resource struct {
+	Type    string `json:"type"`
+	Id      string `json:"id"`
+	Project string `json:"project,omitempty"`
+}
+
+type Input struct {
+	Subject  Subject  `json:"subject"`
+	Action   string   `json:"action"`
+	Resource Resource `json:"resource"`
+	// decision of built-in permissions, so policies can only restrict it
+	Default bool `json:"default"`
+}
+
+type Client struct {
+	Url  string
+	http *http.Client
+}
+
+// New creates client, the default timeout is used if zero
+func New(url string, timeout time.Duration) *Client {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &Client{
+		Url:  url,
+		http: &http.Client{Timeout: timeout},
+	}
+}
+
+// Allow returns the decision of the policy engine, undefined decisions are denied.
+// Error is returned if the engine is unavailable, callers shouldn't grant access in that case.
+func (c *Client) Allow(input *Input) (bool, error) {
+	body, err := json.Marshal(map[string]*Input{"input": input})
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest("POST", c.Url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bearded")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("policy engine returned %d status", resp.StatusCode)
+	}
+	result := struct {
+		Result *bool `json:"result"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Result != nil && *result.Result, nil
+}
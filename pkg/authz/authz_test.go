@@ -0,0 +1,57 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Input *Input `json:"input"`
+		}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		// only admins pass the policy
+		fmt.Fprintf(w, `{"result": %t}`, body.Input.Default && body.Input.Subject.Admin)
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, 0)
+	input := &Input{Action: "project.access", Resource: Resource{Type: "project", Id: "1"}, Default: true}
+	allowed, err := c.Allow(input)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	input.Subject.Admin = true
+	allowed, err = c.Allow(input)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func TestAllowUndefined(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer ts.Close()
+
+	allowed, err := New(ts.URL, 0).Allow(&Input{Default: true})
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestAllowUnavailable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	allowed, err := New(ts.URL, 0).Allow(&Input{Default: true})
+	assert.Error(t, err)
+	assert.False(t, allowed)
+}
@@ -0,0 +1,86 @@
+package cache
+
+// Cache keeps results of hot reads in the store as json.
+// Keys are versioned by generation, so invalidation is a single increment
+// which is seen by all dispatchers sharing the store.
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/bearded-web/bearded/pkg/store"
+)
+
+type Cache struct {
+	store  store.Store
+	prefix string
+	ttl    time.Duration
+}
+
+// New creates cache with the name, entries expire after ttl even without invalidation.
+// Zero ttl disables the cache.
+func New(st store.Store, name string, ttl time.Duration) *Cache {
+	return &Cache{
+		store:  st,
+		prefix: "cache:" + name + ":",
+		ttl:    ttl,
+	}
+}
+
+// Key joins parts, parts should include everything the result depends on, like the user permission scope
+func Key(parts ...interface{}) string {
+	strs := make([]string, 0, len(parts))
+	for _, part := range parts {
+		strs = append(strs, fmt.Sprint(part))
+	}
+	return strings.Join(strs, ":")
+}
+
+// Get the cached value into the result, returns false if there is no value
+func (c *Cache) Get(key string, result interface{}) bool {
+	if c.ttl <= 0 {
+		return false
+	}
+	data, err := c.store.Get(c.key(key))
+	if err != nil {
+		if err != store.ErrNotFound {
+			logrus.Warnf("Cache %s get error: %v", c.prefix, err)
+		}
+		return false
+	}
+	return json.Unmarshal(data, result) == nil
+}
+
+func (c *Cache) Set(key string, value interface{}) {
+	if c.ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		logrus.Warnf("Cache %s set error: %v", c.prefix, err)
+		return
+	}
+	if err := c.store.Set(c.key(key), data, c.ttl); err != nil {
+		logrus.Warnf("Cache %s set error: %v", c.prefix, err)
+	}
+}
+
+// Invalidate all entries of the cache, it should be called after writes
+func (c *Cache) Invalidate() {
+	if _, err := c.store.Incr(c.prefix+"gen", 0); err != nil {
+		logrus.Warnf("Cache %s invalidate error: %v", c.prefix, err)
+	}
+}
+
+func (c *Cache) key(key string) string {
+	gen := int64(0)
+	if data, err := c.store.Get(c.prefix + "gen"); err == nil {
+		gen, _ = strconv.ParseInt(string(data), 10, 64)
+	}
+	return fmt.Sprintf("%s%d:%s", c.prefix, gen, key)
+}
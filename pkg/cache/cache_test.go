@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/pkg/store"
+)
+
+func TestCache(t *testing.T) {
+	type value struct {
+		Name string
+	}
+	st := store.NewMemory()
+	c := New(st, "test", time.Minute)
+	key := Key("list", "admin", 1)
+	require.Equal(t, "list:admin:1", key)
+
+	result := &value{}
+	require.False(t, c.Get(key, result))
+
+	c.Set(key, &value{Name: "first"})
+	require.True(t, c.Get(key, result))
+	require.Equal(t, "first", result.Name)
+
+	// another cache with the same name and store sees invalidation
+	New(st, "test", time.Minute).Invalidate()
+	require.False(t, c.Get(key, result))
+
+	disabled := New(st, "disabled", 0)
+	disabled.Set(key, &value{Name: "first"})
+	require.False(t, disabled.Get(key, result))
+}
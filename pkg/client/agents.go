@@ -3,13 +3,17 @@ package client
 import (
 	"fmt"
 
-	"github.com/bearded-web/bearded/models/agent"
+	"github.com/gorilla/websocket"
 	"golang.org/x/net/context"
+
+	"github.com/bearded-web/bearded/models/agent"
 )
 
 const (
 	agentsUrl     = "agents"
 	agentsJobsUrl = "jobs"
+	agentsLogsUrl = "logs"
+	agentsChanUrl = "channel"
 )
 
 type AgentsService struct {
@@ -54,3 +58,15 @@ func (s *AgentsService) GetJobs(ctx context.Context, src *agent.Agent) ([]*agent
 	url := fmt.Sprintf("%s/%s/%s", agentsUrl, FromId(src.Id), agentsJobsUrl)
 	return jobs, s.client.List(ctx, url, nil, &jobs)
 }
+
+// Channel connects the agent to the dispatcher over websocket, it fails if the dispatcher doesn't support channels
+func (s *AgentsService) Channel(agentId string) (*websocket.Conn, error) {
+	return s.client.Dial(fmt.Sprintf("%s/%s/%s", agentsUrl, agentId, agentsChanUrl))
+}
+
+// Send a chunk of session logs for the agent
+func (s *AgentsService) LogsCreate(ctx context.Context, agentId string, src *agent.Log) (*agent.Log, error) {
+	obj := &agent.Log{}
+	url := fmt.Sprintf("%s/%s/%s", agentsUrl, agentId, agentsLogsUrl)
+	return obj, s.client.Create(ctx, url, src, obj)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/facebookgo/stackerr"
 	"github.com/google/go-querystring/query"
+	"github.com/gorilla/websocket"
 	"golang.org/x/net/context"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -158,6 +159,38 @@ func (c *Client) NewRequest(method, urlStr string, body interface{}) (*http.Requ
 	return req, nil
 }
 
+// Dial opens a websocket connection to the relative url with the same headers as api requests
+func (c *Client) Dial(urlStr string) (*websocket.Conn, error) {
+	u, err := c.getUrl(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	wsUrl, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	wsUrl.Scheme = "ws"
+	if c.BaseURL.Scheme == "https" {
+		wsUrl.Scheme = "wss"
+	}
+	header := http.Header{}
+	if c.UserAgent != "" {
+		header.Add("User-Agent", c.UserAgent)
+	}
+	if c.Token != "" {
+		header.Add("Authorization", fmt.Sprintf("Bearer %s", c.Token))
+	}
+	dialer := &websocket.Dialer{}
+	if transport, ok := c.client.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = transport.TLSClientConfig
+	}
+	if c.Debug {
+		logrus.Debugf("DIAL %s", wsUrl)
+	}
+	conn, _, err := dialer.Dial(wsUrl.String(), header)
+	return conn, err
+}
+
 func (c *Client) getUrl(urlStr string) (string, error) {
 	urlStr = fmt.Sprintf("v%d/%s", apiVersion, urlStr)
 	rel, err := url.Parse(urlStr)
@@ -354,14 +387,27 @@ func (r *ErrorResponse) Error() string {
 	return msg
 }
 
-// ServiceError is a transport object to pass information about a non-Http error occurred in a WebService while processing a request.
+// ServiceError is the error envelope returned by the api
 type ServiceError struct {
-	Code    int
-	Message string
+	Code    string `json:"code"` // stable machine readable code, like NOT_FOUND or VALIDATION_FAILED
+	Message string `json:"message"`
+	Errno   int    `json:"errno"`
+
+	Fields []*FieldError `json:"fields,omitempty"`
+
+	// fields of the old envelope sent by older servers, they are decoded here so they don't collide with code and message
+	LegacyCode    int    `json:"Code"`
+	LegacyMessage string `json:"Message"`
+}
+
+// FieldError describes one invalid field of the request entity
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
 }
 
 // NewError returns a ServiceError using the code and reason
-func NewError(code int, message string) ServiceError {
+func NewError(code string, message string) ServiceError {
 	return ServiceError{Code: code, Message: message}
 }
 
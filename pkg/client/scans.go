@@ -50,6 +50,13 @@ func (s *ScansService) SessionUpdate(ctx context.Context, src *scan.Session) (*s
 	return obj, s.client.Update(ctx, sessUrl, id, src, obj)
 }
 
+// SessionProgress sets the progress of the working session
+func (s *ScansService) SessionProgress(ctx context.Context, src *scan.Session, progress *scan.Progress) (*scan.Session, error) {
+	obj := &scan.Session{}
+	sessUrl := fmt.Sprintf("%s/%s/sessions/%s", scansUrl, FromId(src.Scan), FromId(src.Id))
+	return obj, s.client.Update(ctx, sessUrl, "progress", progress, obj)
+}
+
 func (s *ScansService) SessionGet(ctx context.Context, scanId, sessionId string) (*scan.Session, error) {
 	obj := &scan.Session{}
 	sessUrl := fmt.Sprintf("%s/%s/sessions", scansUrl, scanId)
@@ -0,0 +1,77 @@
+package dispatcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/codegangsta/negroni"
+	"github.com/emicklei/go-restful"
+
+	"github.com/bearded-web/bearded/services"
+)
+
+// bodyLimit wraps request bodies with the default limit, services respond with bad request when the body
+// can't be read, so such responses are replaced with 413 if the limit is exceeded.
+func bodyLimit(limit int64) negroni.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		body := services.LimitBody(rw, r, limit)
+		next(&bodyLimitWriter{ResponseWriter: rw, body: body}, r)
+	}
+}
+
+func writeTooLarge(rw http.ResponseWriter) {
+	rw.Header().Set("Content-Type", restful.MIME_JSON)
+	rw.Header().Set("Connection", "close")
+	rw.WriteHeader(http.StatusRequestEntityTooLarge)
+	data, _ := json.Marshal(services.TooLargeErr)
+	rw.Write(data)
+}
+
+type bodyLimitWriter struct {
+	http.ResponseWriter
+	body     *services.LimitedBody
+	replaced bool
+}
+
+func (w *bodyLimitWriter) WriteHeader(code int) {
+	if code >= http.StatusBadRequest && code < http.StatusInternalServerError && w.body.Exceeded() {
+		w.replaced = true
+		writeTooLarge(w.ResponseWriter)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// body of the original error is dropped
+func (w *bodyLimitWriter) Write(data []byte) (int, error) {
+	if w.replaced {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// the timeout filter stops db operations when the client is gone
+func (w *bodyLimitWriter) CloseNotify() <-chan bool {
+	if notifier, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return notifier.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+func (w *bodyLimitWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// agent channels upgrade the connection to websocket
+func (w *bodyLimitWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer doesn't support hijacking")
+	}
+	return hijacker.Hijack()
+}
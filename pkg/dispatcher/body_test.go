@@ -0,0 +1,74 @@
+package dispatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/codegangsta/negroni"
+	"github.com/emicklei/go-restful"
+
+	"github.com/bearded-web/bearded/services"
+)
+
+func TestBodyLimit(t *testing.T) {
+	read := func(req *restful.Request, resp *restful.Response) {
+		if _, err := ioutil.ReadAll(req.Request.Body); err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+			return
+		}
+		resp.WriteHeader(http.StatusCreated)
+		resp.WriteEntity(map[string]string{})
+	}
+	container := restful.NewContainer()
+	ws := &restful.WebService{}
+	ws.Path("/api/v1/body").Produces(restful.MIME_JSON)
+	ws.Route(ws.POST("").To(read))
+	ws.Route(ws.POST("upload").Filter(services.BodyLimit(100)).To(read))
+	container.Add(ws)
+
+	app := negroni.New()
+	app.Use(bodyLimit(10))
+	app.UseHandler(container)
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	post := func(path string, body string, chunked bool) (int, *services.ServiceError) {
+		var r io.Reader = strings.NewReader(body)
+		if chunked {
+			// the size of the body is unknown, so it's rejected only after reading
+			r = ioutil.NopCloser(bytes.NewBufferString(body))
+		}
+		req, _ := http.NewRequest("POST", srv.URL+path, r)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		e := &services.ServiceError{}
+		json.NewDecoder(resp.Body).Decode(e)
+		return resp.StatusCode, e
+	}
+
+	if code, _ := post("/api/v1/body", "small", false); code != http.StatusCreated {
+		t.Errorf("small body: expected 201, got %d", code)
+	}
+	for _, chunked := range []bool{false, true} {
+		code, e := post("/api/v1/body", strings.Repeat("a", 50), chunked)
+		if code != http.StatusRequestEntityTooLarge || e.Errno != services.CodeTooLarge {
+			t.Errorf("large body, chunked %v: expected 413 with too large error, got %d %v", chunked, code, e.Errno)
+		}
+	}
+	if code, _ := post("/api/v1/body/upload", strings.Repeat("a", 50), false); code != http.StatusCreated {
+		t.Errorf("upload under the route limit: expected 201, got %d", code)
+	}
+	if code, _ := post("/api/v1/body/upload", strings.Repeat("a", 200), true); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload over the route limit: expected 413, got %d", code)
+	}
+}
@@ -5,55 +5,227 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/negroni"
 	"github.com/emicklei/go-restful"
 	"golang.org/x/net/context"
+	"gopkg.in/fatih/set.v0"
 	"gopkg.in/mgo.v2"
 
+	auditModel "github.com/bearded-web/bearded/models/audit"
+	"github.com/bearded-web/bearded/pkg/alert"
+	"github.com/bearded-web/bearded/pkg/antivirus"
+	"github.com/bearded-web/bearded/pkg/authz"
 	"github.com/bearded-web/bearded/pkg/config"
 	"github.com/bearded-web/bearded/pkg/email"
 	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/hibp"
+	"github.com/bearded-web/bearded/pkg/logging"
 	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/pagination"
 	"github.com/bearded-web/bearded/pkg/passlib"
+	"github.com/bearded-web/bearded/pkg/proxy"
+	"github.com/bearded-web/bearded/pkg/quota"
+	"github.com/bearded-web/bearded/pkg/ratelimit"
 	"github.com/bearded-web/bearded/pkg/scheduler"
+	"github.com/bearded-web/bearded/pkg/store"
 	"github.com/bearded-web/bearded/pkg/template"
 	"github.com/bearded-web/bearded/pkg/utils/async"
+	"github.com/bearded-web/bearded/pkg/version"
 	"github.com/bearded-web/bearded/services"
 	"github.com/bearded-web/bearded/services/agent"
+	"github.com/bearded-web/bearded/services/audit"
 	"github.com/bearded-web/bearded/services/auth"
+	"github.com/bearded-web/bearded/services/campaign"
 	configService "github.com/bearded-web/bearded/services/config"
 	"github.com/bearded-web/bearded/services/feed"
 	"github.com/bearded-web/bearded/services/file"
+	"github.com/bearded-web/bearded/services/incident"
 	"github.com/bearded-web/bearded/services/issue"
 	"github.com/bearded-web/bearded/services/me"
 	"github.com/bearded-web/bearded/services/plan"
 	"github.com/bearded-web/bearded/services/plugin"
 	"github.com/bearded-web/bearded/services/project"
+	"github.com/bearded-web/bearded/services/remediation"
 	"github.com/bearded-web/bearded/services/scan"
+	"github.com/bearded-web/bearded/services/share"
+	"github.com/bearded-web/bearded/services/stats"
 	"github.com/bearded-web/bearded/services/target"
 	"github.com/bearded-web/bearded/services/tech"
+	templateService "github.com/bearded-web/bearded/services/template"
 	"github.com/bearded-web/bearded/services/token"
+	"github.com/bearded-web/bearded/services/usage"
 	"github.com/bearded-web/bearded/services/user"
+	versionService "github.com/bearded-web/bearded/services/version"
 	"github.com/bearded-web/bearded/services/vulndb"
+	"github.com/bearded-web/bearded/services/webhook"
 )
 
-func initServices(wsContainer *restful.Container, cfg *config.Dispatcher,
-	mgr *manager.Manager, mailer email.Mailer, tmpl *template.Template) error {
+func initServices(ctx context.Context, wsContainer *restful.Container, cfg *config.Dispatcher,
+	mgr *manager.Manager, st store.Store, mailer email.Mailer, tmpl *template.Template) error {
 
 	// password manager for generation and verification passwords
-	passCtx := passlib.NewContext()
+	passCtx, err := passlib.New(passlib.Policy{
+		Scheme: cfg.Password.Scheme,
+		Cost:   cfg.Password.Cost,
+	})
+	if err != nil {
+		return fmt.Errorf("wrong password policy: %s", err)
+	}
+	passPolicy, err := getPasswordPolicy(cfg.Password)
+	if err != nil {
+		return fmt.Errorf("wrong password policy: %s", err)
+	}
+
+	if migrated, err := mgr.Issues.MigrateSeverities(); err != nil {
+		return fmt.Errorf("can't move issues to the severity scheme: %s", err)
+	} else if migrated > 0 {
+		logrus.Infof("%d issues are moved to the severity scheme", migrated)
+	}
+	if migrated, err := mgr.Issues.MigrateSortKeys(); err != nil {
+		return fmt.Errorf("can't set issue sort keys: %s", err)
+	} else if migrated > 0 {
+		logrus.Infof("Sort keys of %d issues are set", migrated)
+	}
+	if migrated, err := mgr.Projects.MigrateBaselines(); err != nil {
+		return fmt.Errorf("can't move project baselines to issues: %s", err)
+	} else if migrated > 0 {
+		logrus.Infof("Baselines of %d projects are moved to issues", migrated)
+	}
+	if migrated, err := mgr.Reports.MigrateProjects(); err != nil {
+		return fmt.Errorf("can't set projects of reports: %s", err)
+	} else if migrated > 0 {
+		logrus.Infof("Projects of %d reports are set", migrated)
+	}
+	if migrated, err := mgr.Comments.MigrateProjects(); err != nil {
+		return fmt.Errorf("can't set projects of comments: %s", err)
+	} else if migrated > 0 {
+		logrus.Infof("Projects of %d comments are set", migrated)
+	}
+	if migrated, err := mgr.Files.MigrateProjects(); err != nil {
+		return fmt.Errorf("can't link files to projects: %s", err)
+	} else if migrated > 0 {
+		logrus.Infof("%d files are linked to projects", migrated)
+	}
+	// issues keep old severities until the next start, it isn't a reason to stop
+	if err := recomputeSeverities(mgr); err != nil {
+		logrus.Errorf("Can't recompute issue severities: %s", err)
+	}
+
+	incidentAlerter := alert.New("incident", cfg.Incidents, mailer, cfg.Api.SystemEmail)
+	incidentAlerter.Manager = mgr
+	incidentAlerter.Template = tmpl
+	incidents := alert.NewReporter(mgr, incidentAlerter)
+	notifier := alert.NewScanNotifier(mgr, mailer, cfg.Api.SystemEmail, cfg.Api.Host+cfg.Api.ScanPath)
+	notifier.Incidents = incidents
+	notifier.Template = tmpl
 
 	sch := scheduler.NewMemoryScheduler(mgr.Copy())
+	sch.Incidents = incidents
+	if agentsCfg := cfg.Agents; agentsCfg.CleanupInterval > 0 {
+		cleaner := scheduler.NewAgentCleaner(mgr.Copy(), sch,
+			time.Duration(agentsCfg.StaleAfter)*time.Second,
+			time.Duration(agentsCfg.RetireAfter)*time.Second)
+		cleaner.Incidents = incidents
+		go cleaner.Run(ctx, time.Duration(agentsCfg.CleanupInterval)*time.Second)
+	}
+	if scansCfg := cfg.Scans; scansCfg.PauseTtl > 0 && scansCfg.CheckInterval > 0 {
+		expirer := scheduler.NewPauseExpirer(mgr.Copy(), sch, time.Duration(scansCfg.PauseTtl)*time.Second)
+		expirer.Incidents = incidents
+		expirer.Notifier = notifier
+		go expirer.Run(ctx, time.Duration(scansCfg.CheckInterval)*time.Second)
+	}
+	var groups *scheduler.GroupQueue
+	if scansCfg := cfg.Scans; scansCfg.GroupConcurrency > 0 {
+		groups = scheduler.NewGroupQueue(mgr.Copy(), sch, scansCfg.GroupConcurrency)
+		groups.Incidents = incidents
+		groups.Notifier = notifier
+		if scansCfg.CheckInterval > 0 {
+			go groups.Run(ctx, time.Duration(scansCfg.CheckInterval)*time.Second)
+		}
+	}
+	var outputs *scheduler.OutputPruner
+	if scansCfg := cfg.Scans; scansCfg.PruneInterval > 0 {
+		pruner := scheduler.NewHistoryPruner(mgr.Copy(), scansCfg.History)
+		pruner.Incidents = incidents
+		go pruner.Run(ctx, time.Duration(scansCfg.PruneInterval)*time.Second)
+
+		outputs = scheduler.NewOutputPruner(mgr.Copy(), scansCfg.OutputDays)
+		outputs.Incidents = incidents
+		if migrated, err := outputs.Migrate(); err != nil {
+			return fmt.Errorf("can't set purge dates of reports: %s", err)
+		} else if migrated > 0 {
+			logrus.Infof("Purge dates of %d reports are set", migrated)
+		}
+		go outputs.Run(ctx, time.Duration(scansCfg.PruneInterval)*time.Second)
+	}
+	if scansCfg := cfg.Scans; scansCfg.CheckInterval > 0 {
+		windows := scheduler.NewWindowQueue(mgr.Copy(), sch)
+		windows.Groups = groups
+		windows.Incidents = incidents
+		windows.Notifier = notifier
+		go windows.Run(ctx, time.Duration(scansCfg.CheckInterval)*time.Second)
+	}
 
 	// services
 	base := services.New(mgr, passCtx, sch, mailer, cfg.Api)
+	paginator, err := pagination.NewWithLimits(cfg.Api.Pagination.LimitDefault, cfg.Api.Pagination.LimitMax)
+	if err != nil {
+		return fmt.Errorf("wrong pagination: %s", err)
+	}
 	if cfg.Api.Host != "" {
-		base.Paginator.Host = cfg.Api.Host
+		paginator.Host = cfg.Api.Host
 	}
+	base.Paginator = paginator
+	wsContainer.Filter(paginator.LimitFilter)
+	limiter, err := ratelimit.New(st, mgr, cfg.Api.RateLimit)
+	if err != nil {
+		return fmt.Errorf("wrong rate limit: %s", err)
+	}
+	if limiter.Enabled() {
+		// tokens and projects are limited after authentication
+		wsContainer.Filter(limiter.Filter)
+		base.AuthChecks = append(base.AuthChecks, limiter.Check)
+	}
+	base.Quota = quota.New(mgr, cfg.Api.Quota)
+	base.AuthChecks = append(base.AuthChecks, filters.QuotaCheck(base.Quota))
+	go base.Quota.Run(ctx)
 	base.Template = tmpl
+	base.Store = st
+	base.PasswordPolicy = passPolicy
+	if err := bootstrapAdmin(mgr, passCtx, cfg.Admin); err != nil {
+		return fmt.Errorf("can't create admin %s: %s", cfg.Admin.Email, err)
+	}
+	base.Alerter = alert.New("event", cfg.Audit, mailer, cfg.Api.SystemEmail)
+	base.Alerter.Manager = mgr
+	base.Alerter.Template = tmpl
+	base.Incidents = incidents
+	base.Notifier = notifier
+	base.Groups = groups
+	base.Outputs = outputs
+	if err := auditAdmins(mgr, base.Alerter); err != nil {
+		return fmt.Errorf("can't audit admins: %s", err)
+	}
+	if authzCfg := cfg.Api.Authz; authzCfg.Url != "" {
+		services.SetAuthorizer(&services.PolicyAuthorizer{
+			Client:  authz.New(authzCfg.Url, time.Duration(authzCfg.Timeout)*time.Second),
+			Default: services.DefaultAuthorizer{},
+		})
+		logrus.Infof("Access decisions are asked from %s", authzCfg.Url)
+	}
+	if hibpCfg := cfg.Password.Hibp; hibpCfg.Enable {
+		base.Pwned = hibp.New(hibpCfg.Url,
+			time.Duration(hibpCfg.Timeout)*time.Second,
+			time.Duration(hibpCfg.CacheDuration)*time.Second)
+		logrus.Infof("New passwords are checked with %s", hibpCfg.Url)
+	}
+	if avCfg := cfg.Api.File.Antivirus; avCfg.Addr != "" {
+		base.Antivirus = antivirus.NewClamd(avCfg.Addr, time.Duration(avCfg.Timeout)*time.Second)
+		logrus.Infof("Uploaded files are checked with clamd on %s", avCfg.Addr)
+	}
 	all := []services.ServiceInterface{
 		auth.New(base),
 		plugin.New(base),
@@ -71,6 +243,16 @@ func initServices(wsContainer *restful.Container, cfg *config.Dispatcher,
 		configService.New(base),
 		token.New(base),
 		tech.New(base),
+		stats.New(base),
+		audit.New(base),
+		incident.New(base),
+		webhook.New(base),
+		campaign.New(base),
+		share.New(base),
+		remediation.New(base),
+		templateService.New(base),
+		versionService.New(base),
+		usage.New(base),
 	}
 
 	// initialize services
@@ -87,25 +269,149 @@ func initServices(wsContainer *restful.Container, cfg *config.Dispatcher,
 	return nil
 }
 
+// Admins are configured by emails, so changes are found by comparing with the previous start
+func auditAdmins(mgr *manager.Manager, alerter *alert.Alerter) error {
+	current := set.New()
+	for _, email := range mgr.Permission.GetAdmins() {
+		if email != manager.AgentEmail {
+			current.Add(email)
+		}
+	}
+	known, err := mgr.Audit.GetAdmins()
+	if err != nil {
+		return err
+	}
+	previous := set.New()
+	for _, email := range known {
+		previous.Add(email)
+	}
+	record := func(t auditModel.Type, emails []string, msg string) error {
+		sort.Strings(emails)
+		for _, email := range emails {
+			ev, err := mgr.Audit.Create(&auditModel.Event{
+				Type:    t,
+				Email:   email,
+				Message: fmt.Sprintf(msg, email),
+			})
+			if err != nil {
+				return err
+			}
+			logrus.Warnf("Audit %s: %s", ev.Type, ev.Message)
+			alerter.Send(alert.AuditAlert(ev))
+		}
+		return nil
+	}
+	if err := record(auditModel.TypeAdminAdded, set.StringSlice(set.Difference(current, previous)),
+		"%s is added to admins in the config"); err != nil {
+		return err
+	}
+	if err := record(auditModel.TypeAdminRemoved, set.StringSlice(set.Difference(previous, current)),
+		"%s is removed from admins in the config"); err != nil {
+		return err
+	}
+	emails := set.StringSlice(current)
+	sort.Strings(emails)
+	return mgr.Audit.SetAdmins(emails)
+}
+
+// Vulndb is built in, so updated entries are found by comparing with the previous start
+func recomputeSeverities(mgr *manager.Manager) error {
+	changed, err := mgr.Vulndb.GetChanged()
+	if err != nil {
+		return err
+	}
+	// severities set by users weren't marked before the first start with recomputing
+	if changed == nil {
+		marked, err := mgr.Issues.MigrateSeverityOverrides()
+		if err != nil {
+			return err
+		}
+		if marked > 0 {
+			logrus.Infof("%d issues are marked to keep severities set by users", marked)
+		}
+	}
+	if len(changed) > 0 {
+		logrus.Infof("%d vulndb entries have new severities", len(changed))
+		updated, err := mgr.Issues.RecomputeSeverities(changed)
+		if err != nil {
+			return err
+		}
+		if updated > 0 {
+			logrus.Infof("Severities of %d issues are recomputed", updated)
+		}
+	}
+	return mgr.Vulndb.SaveSeverities()
+}
+
+// internal agent should finish the current session during this time, it's less than the main shutdown timeout
+const agentStopTimeout = time.Second * 15
+
 type MgoLogger struct {
 }
 
 func (m *MgoLogger) Output(calldepth int, s string) error {
-	logrus.Debug(s)
+	logging.Logger(logging.Manager).Debug(s)
 	return nil
 }
 
-func getManager(cfg config.Mongo) (*manager.Manager, error) {
+// the delay between connection attempts is doubled up to this value
+const mongoMaxBackoff = time.Second * 30
+
+// dialMongo tries to connect to mongodb until attempts are exhausted or ctx is done
+func dialMongo(ctx context.Context, cfg config.Mongo) (*mgo.Session, error) {
+	attempts := cfg.ConnectAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	timeout := time.Duration(cfg.ConnectTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = time.Second * 10
+	}
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		logrus.Infof("Connecting to mongodb on %s, attempt %d of %d", cfg.Addr, attempt, attempts)
+		session, err := mgo.DialWithTimeout(cfg.Addr, timeout)
+		if err == nil {
+			return session, nil
+		}
+		if attempt >= attempts {
+			return nil, fmt.Errorf("Cannot connect to mongodb after %d attempts: %s", attempts, err.Error())
+		}
+		logrus.Warnf("Cannot connect to mongodb: %s, retry in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("Cannot connect to mongodb: %s", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > mongoMaxBackoff {
+			backoff = mongoMaxBackoff
+		}
+	}
+}
+
+func getManager(ctx context.Context, cfg config.Mongo, apiCfg config.Api) (*manager.Manager, error) {
 	// initialize mongodb session
 	logrus.Infof("Init mongodb on %s", cfg.Addr)
-	session, err := mgo.Dial(cfg.Addr)
+	session, err := dialMongo(ctx, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("Cannot connect to mongodb: %s", err.Error())
+		return nil, err
 	}
 	logrus.Infof("Successfull")
 	logrus.Infof("Set mongo database %s", cfg.Database)
 	mgrCfg := manager.ManagerConfig{
-		TextSearchEnable: cfg.TextSearchEnable,
+		TextSearchEnable:   cfg.TextSearchEnable,
+		TextLanguage:       cfg.TextSearch.Language,
+		TextWeights:        cfg.TextSearch.Weights,
+		IdempotencyExpire:  time.Duration(apiCfg.IdempotencyDuration) * time.Second,
+		AgentLogExpire:     time.Duration(apiCfg.AgentLog.Duration) * time.Second,
+		WebhookHistory:     apiCfg.WebhookHistory,
+		DryRunExpire:       time.Duration(apiCfg.DryRun.Duration) * time.Second,
+		TokenTouchInterval: time.Duration(apiCfg.Token.TouchInterval) * time.Second,
+		TokenStaleAfter:    time.Duration(apiCfg.Token.StaleAfter) * 24 * time.Hour,
+		SlowQuery:          time.Duration(cfg.SlowQuery) * time.Millisecond,
+		Queries:            manager.NewQueryStats(),
+		Isolation:          apiCfg.Isolation,
 	}
 	mgr := manager.New(session.DB(cfg.Database), mgrCfg)
 	// Initialize db indexes
@@ -115,7 +421,7 @@ func getManager(cfg config.Mongo) (*manager.Manager, error) {
 	return mgr, nil
 }
 
-func getRestContainer(cfg config.Api) *restful.Container {
+func getRestContainer(cfg config.Api) (*restful.Container, error) {
 	// Create container and initialize services
 	wsContainer := restful.NewContainer()
 	wsContainer.Router(restful.CurlyRouter{}) // CurlyRouter is the faster routing alternative for restful
@@ -123,15 +429,30 @@ func getRestContainer(cfg config.Api) *restful.Container {
 	// setup session
 	cookieOpts := &filters.CookieOpts{
 		Path:     "/api/",
+		Domain:   cfg.Cookie.Domain,
+		MaxAge:   cfg.Cookie.MaxAge,
 		HttpOnly: true,
 		Secure:   cfg.Cookie.Secure,
+		SameSite: filters.SameSiteMode(cfg.Cookie.SameSite),
+	}
+	if err := cookieOpts.Validate(); err != nil {
+		return nil, fmt.Errorf("wrong cookie: %s", err)
+	}
+	if err := filters.ValidateKeyPairs(cfg.Cookie.KeyPairs...); err != nil {
+		return nil, fmt.Errorf("wrong cookie key pairs: %s", err)
 	}
 	// TODO (m0sth8): extract keys to configuration file
 	wsContainer.Filter(filters.SessionCookieFilter(cfg.Cookie.Name, cookieOpts, cfg.Cookie.KeyPairs...))
+	wsContainer.Filter(filters.TimeoutFilter(time.Duration(cfg.RequestTimeout) * time.Second))
+	wsContainer.Filter(filters.CacheFilter(cfg.Caching.Default))
+
+	// not found routes and other container errors are json, like errors of services
+	wsContainer.ServiceErrorHandler(writeServiceError)
+	wsContainer.Handle("/", http.HandlerFunc(notFound))
 
 	// Disable recovering in restful cause we recover all panics in negroni
 	wsContainer.DoNotRecover(true)
-	return wsContainer
+	return wsContainer, nil
 
 }
 
@@ -149,11 +470,20 @@ func getNegroniApp(cfg *config.Dispatcher) *negroni.Negroni {
 		recovery.PrintStack = false // do not print stack to response
 	}
 	app.Use(recovery)
+	app.Use(bodyLimit(int64(cfg.Api.MaxBodySize)))
 
 	// TODO (m0sth8): add secure middleware
 	if !cfg.Frontend.Disable {
 		logrus.Infof("Frontend served from %s directory", cfg.Frontend.Path)
-		app.Use(negroni.NewStatic(http.Dir(cfg.Frontend.Path)))
+		dir := http.Dir(cfg.Frontend.Path)
+		app.Use(negroni.NewStatic(dir))
+		if cfg.Frontend.Fallback && cfg.Frontend.Index != "" {
+			fallback := &spaFallback{dir: dir, index: cfg.Frontend.Index}
+			if cfg.Swagger.Enable {
+				fallback.skip = []string{cfg.Swagger.Path, cfg.Swagger.ApiPath}
+			}
+			app.Use(fallback)
+		}
 	}
 	return app
 }
@@ -165,28 +495,55 @@ func runInternalAgent(ctx context.Context, mgr *manager.Manager,
 		return nil
 	}
 	if tkn, err := getAgentToken(mgr); err != nil {
-		logrus.Errorf("Can't get agent token: %s", err)
+		logrus.Errorf("Internal agent is not started, can't get agent token: %s", err)
 		return nil
 	} else {
-		return RunInternalAgent(ctx, app, tkn, &cfg.Agent)
+		return RunInternalAgents(ctx, app, tkn, &cfg.Agent, cfg.Workers)
 	}
 }
 
 func Serve(ctx context.Context, cfg *config.Dispatcher) error {
+	if err := resolveSecrets(cfg); err != nil {
+		return fmt.Errorf("can't resolve secrets: %s", err)
+	}
+	if err := logging.Configure(cfg.Log); err != nil {
+		return fmt.Errorf("wrong log config: %s", err)
+	}
+	logrus.Infof("Bearded dispatcher %s", version.Get())
 	if cfg.Debug {
 		logrus.Info("Debug mode is enabled")
 	}
+	// clients of webhooks and other integrations use the default transport
+	if err := proxy.ConfigureDefault(cfg.Proxy); err != nil {
+		return err
+	}
+	if proxy.IsSet(cfg.Proxy) {
+		logrus.Infof("Outbound requests go through the proxy, http: %q, https: %q",
+			proxy.Redacted(cfg.Proxy.Http), proxy.Redacted(cfg.Proxy.Https))
+	}
 	// TODO (m0sth8): validate config
 	logrus.Infof("Template path: %v", cfg.Template.Path)
-	tmpl := template.New(&template.Opts{Directory: cfg.Template.Path})
+	tmpl := template.New(&template.Opts{Directory: cfg.Template.Path, DefaultLocale: cfg.Template.DefaultLocale})
 
-	mgr, err := getManager(cfg.Mongo)
+	// the scheme is used by the vulndb which is loaded with the manager
+	if err := setSeverityScheme(cfg.Severities); err != nil {
+		return fmt.Errorf("wrong severities: %s", err)
+	}
+
+	mgr, err := getManager(ctx, cfg.Mongo, cfg.Api)
 	if err != nil {
 		return err
 	}
 	defer mgr.Close()
 
-	mgr.Permission.SetAdmins(cfg.Api.Admins)
+	admins := cfg.Api.Admins
+	if cfg.Admin.Email != "" {
+		admins = append(admins, cfg.Admin.Email)
+	}
+	mgr.Permission.SetAdmins(admins)
+
+	// shared state for several dispatchers, it's in memory without redis
+	st := store.New(cfg.Redis)
 
 	// initialize mailer
 	mailer, err := email.New(cfg.Email)
@@ -203,9 +560,12 @@ func Serve(ctx context.Context, cfg *config.Dispatcher) error {
 
 	}
 
-	wsContainer := getRestContainer(cfg.Api)
+	wsContainer, err := getRestContainer(cfg.Api)
+	if err != nil {
+		return err
+	}
 	// Initialize and register services in container
-	err = initServices(wsContainer, cfg, mgr, mailer, tmpl)
+	err = initServices(ctx, wsContainer, cfg, mgr, st, mailer, tmpl)
 	if err != nil {
 		return fmt.Errorf("Cannot initialize services: %s", err.Error())
 	}
@@ -218,7 +578,14 @@ func Serve(ctx context.Context, cfg *config.Dispatcher) error {
 	app := getNegroniApp(cfg)
 	app.UseHandler(wsContainer) // set wsContainer as main handler
 
-	agentErr := runInternalAgent(ctx, mgr, app, cfg.Agent)
+	// internal agents are stopped with the server, even if the server is failed
+	agentCtx, cancelAgent := context.WithCancel(ctx)
+	defer cancelAgent()
+	agentCfg := cfg.Agent
+	if !proxy.IsSet(agentCfg.Proxy) {
+		agentCfg.Proxy = cfg.Proxy
+	}
+	agentErr := runInternalAgent(agentCtx, mgr, app, agentCfg)
 
 	// Start negroni middleware with our restful container
 	sErr := async.Promise(func() error {
@@ -236,14 +603,11 @@ func Serve(ctx context.Context, cfg *config.Dispatcher) error {
 	}
 
 	if agentErr != nil {
-		logrus.Info("Waiting for agent to stop")
-		select {
-		case err := <-agentErr:
-			if err != nil {
-				logrus.Error(err)
-			}
-		case <-time.After(time.Second * 15):
-			logrus.Warn("Can't stop agent because of timeout")
+		logrus.Info("Waiting for agents to stop")
+		if stopAgents(cancelAgent, agentErr, agentStopTimeout) {
+			logrus.Info("Agents are stopped")
+		} else {
+			logrus.Warn("Can't stop agents because of timeout")
 		}
 	}
 	// TODO (m0sth8): waiting for http server to stop
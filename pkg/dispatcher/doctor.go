@@ -0,0 +1,277 @@
+package dispatcher
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/email"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/pagination"
+	"github.com/bearded-web/bearded/pkg/passlib"
+	"github.com/bearded-web/bearded/pkg/template"
+)
+
+type CheckStatus string
+
+const (
+	CheckPass = CheckStatus("pass")
+	CheckFail = CheckStatus("fail")
+	CheckSkip = CheckStatus("skip")
+)
+
+// Check is a result of one diagnostic of the deployment
+type Check struct {
+	Name    string
+	Status  CheckStatus
+	Message string
+}
+
+// Diagnosis is a report of the doctor, checks are in the order they are run
+type Diagnosis struct {
+	Checks []*Check
+}
+
+// Ok returns false if any check is failed, skipped checks are ok
+func (d *Diagnosis) Ok() bool {
+	for _, c := range d.Checks {
+		if c.Status == CheckFail {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Diagnosis) String() string {
+	buf := &bytes.Buffer{}
+	for _, c := range d.Checks {
+		fmt.Fprintf(buf, "[%s] %-10s %s\n", c.Status, c.Name, c.Message)
+	}
+	return buf.String()
+}
+
+func (d *Diagnosis) add(name string, status CheckStatus, msg string, args ...interface{}) {
+	d.Checks = append(d.Checks, &Check{Name: name, Status: status, Message: fmt.Sprintf(msg, args...)})
+}
+
+type DoctorOpts struct {
+	// the test message is sent to this address, the email check is skipped if it's empty
+	EmailTo string
+}
+
+// Doctor checks the configuration and the environment of the dispatcher without serving the api.
+// Mongo is connected only once, checks which need the database are skipped if it isn't available.
+func Doctor(ctx context.Context, cfg *config.Dispatcher, opts DoctorOpts) *Diagnosis {
+	d := &Diagnosis{}
+
+	if err := checkConfig(cfg); err != nil {
+		d.add("config", CheckFail, "%s", err)
+	} else {
+		d.add("config", CheckPass, "is valid")
+	}
+
+	mgr := doctorMongo(ctx, d, cfg.Mongo)
+	if mgr != nil {
+		defer mgr.Close()
+	}
+	doctorIndexes(d, mgr)
+	doctorEmail(d, cfg, opts.EmailTo)
+	doctorTemplates(d, cfg.Template)
+	doctorFrontend(d, cfg.Frontend)
+	doctorAgent(d, mgr, cfg.Agent)
+	return d
+}
+
+// checkConfig validates parts of the config which are checked on the start of the dispatcher
+func checkConfig(cfg *config.Dispatcher) error {
+	if err := resolveSecrets(cfg); err != nil {
+		return fmt.Errorf("can't resolve secrets: %s", err)
+	}
+	if err := setSeverityScheme(cfg.Severities); err != nil {
+		return fmt.Errorf("wrong severities: %s", err)
+	}
+	if _, err := getRestContainer(cfg.Api); err != nil {
+		return err
+	}
+	if _, err := passlib.New(passlib.Policy{Scheme: cfg.Password.Scheme, Cost: cfg.Password.Cost}); err != nil {
+		return fmt.Errorf("wrong password policy: %s", err)
+	}
+	if _, err := getPasswordPolicy(cfg.Password); err != nil {
+		return fmt.Errorf("wrong password policy: %s", err)
+	}
+	if _, err := pagination.NewWithLimits(cfg.Api.Pagination.LimitDefault, cfg.Api.Pagination.LimitMax); err != nil {
+		return fmt.Errorf("wrong pagination: %s", err)
+	}
+	if _, err := email.New(cfg.Email); err != nil {
+		return fmt.Errorf("wrong email: %s", err)
+	}
+	return nil
+}
+
+func doctorMongo(ctx context.Context, d *Diagnosis, cfg config.Mongo) *manager.Manager {
+	// the doctor shouldn't wait for mongo like the dispatcher does
+	cfg.ConnectAttempts = 1
+	session, err := dialMongo(ctx, cfg)
+	if err == nil {
+		err = session.Ping()
+		if err != nil {
+			session.Close()
+		}
+	}
+	if err != nil {
+		d.add("mongo", CheckFail, "%s", err)
+		return nil
+	}
+	d.add("mongo", CheckPass, "connected to %s, database %s", cfg.Addr, cfg.Database)
+	return manager.New(session.DB(cfg.Database))
+}
+
+func doctorIndexes(d *Diagnosis, mgr *manager.Manager) {
+	if mgr == nil {
+		d.add("indexes", CheckSkip, "mongo isn't available")
+		return
+	}
+	missing, err := mgr.MissingIndexes()
+	if err != nil {
+		d.add("indexes", CheckFail, "%s", err)
+		return
+	}
+	if len(missing) > 0 {
+		d.add("indexes", CheckFail, "collections without indexes: %s, they are created on the start of the dispatcher",
+			strings.Join(missing, ", "))
+		return
+	}
+	d.add("indexes", CheckPass, "are created")
+}
+
+func doctorEmail(d *Diagnosis, cfg *config.Dispatcher, to string) {
+	mailer, err := email.New(cfg.Email)
+	if err != nil {
+		d.add("email", CheckFail, "%s", err)
+		return
+	}
+	defer mailer.Close()
+	if mailer.Disabled() {
+		d.add("email", CheckSkip, "email is disabled, password reset links are created by admins")
+		return
+	}
+	if to == "" {
+		d.add("email", CheckSkip, "%s backend, set the address to send a test message", cfg.Email.Backend)
+		return
+	}
+	msg := email.NewMessage()
+	msg.SetHeader("From", msg.FormatAddress(cfg.Api.SystemEmail, "Bearded"))
+	msg.SetHeader("To", to)
+	msg.SetHeader("Subject", "Bearded test message")
+	msg.SetBody("text/plain", "The email is configured for the bearded dispatcher.")
+	if err := mailer.Send(msg); err != nil {
+		d.add("email", CheckFail, "can't send the test message to %s: %s", to, err)
+		return
+	}
+	d.add("email", CheckPass, "the test message is sent to %s with %s backend", to, cfg.Email.Backend)
+}
+
+// templates which are required by services
+var requiredTemplates = []string{"email/reset-password"}
+
+func doctorTemplates(d *Diagnosis, cfg config.Template) {
+	if err := checkDir(cfg.Path); err != nil {
+		d.add("templates", CheckFail, "%s", err)
+		return
+	}
+	var tmpl *template.Template
+	// templates are parsed with panics, so the dispatcher doesn't start with broken ones
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+		tmpl = template.New(&template.Opts{Directory: cfg.Path, DefaultLocale: cfg.DefaultLocale})
+		return nil
+	}()
+	if err != nil {
+		d.add("templates", CheckFail, "can't parse templates in %s: %s", cfg.Path, err)
+		return
+	}
+	for _, name := range requiredTemplates {
+		if !tmpl.Has(name) {
+			d.add("templates", CheckFail, "template %s isn't found in %s", name, cfg.Path)
+			return
+		}
+	}
+	d.add("templates", CheckPass, "are parsed from %s", cfg.Path)
+}
+
+func doctorFrontend(d *Diagnosis, cfg config.Frontend) {
+	if cfg.Disable {
+		d.add("frontend", CheckSkip, "is disabled")
+		return
+	}
+	if err := checkDir(cfg.Path); err != nil {
+		d.add("frontend", CheckFail, "%s", err)
+		return
+	}
+	if cfg.Fallback && cfg.Index != "" {
+		index := filepath.Join(cfg.Path, cfg.Index)
+		if _, err := os.Stat(index); err != nil {
+			d.add("frontend", CheckFail, "index file %s isn't found, deep links won't work", index)
+			return
+		}
+	}
+	d.add("frontend", CheckPass, "is served from %s", cfg.Path)
+}
+
+func doctorAgent(d *Diagnosis, mgr *manager.Manager, cfg config.InternalAgent) {
+	if !cfg.Enable {
+		d.add("agent", CheckSkip, "internal agent is disabled")
+		return
+	}
+	if mgr == nil {
+		d.add("agent", CheckSkip, "mongo isn't available")
+		return
+	}
+	// the doctor doesn't change the db, the user and the token are created on the start of the dispatcher
+	u, err := mgr.Users.GetByEmail(manager.AgentEmail)
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			d.add("agent", CheckFail, "system user %s is missing, it's created on the start of the dispatcher",
+				manager.AgentEmail)
+			return
+		}
+		d.add("agent", CheckFail, "can't get system user %s: %s", manager.AgentEmail, err)
+		return
+	}
+	tokens, _, err := mgr.Tokens.FilterByQuery(bson.M{
+		"user":    u.Id,
+		"name":    agentTokenName,
+		"removed": false,
+	}, manager.Opts{Limit: 1})
+	if err != nil {
+		d.add("agent", CheckFail, "can't get token for system user %s: %s", manager.AgentEmail, err)
+		return
+	}
+	if len(tokens) == 0 {
+		d.add("agent", CheckFail, "token %q of the internal agent is missing, it's created on the start of the dispatcher",
+			agentTokenName)
+		return
+	}
+	d.add("agent", CheckPass, "token of the internal agent is available")
+}
+
+func checkDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("directory %s isn't found", path)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s isn't a directory", path)
+	}
+	return nil
+}
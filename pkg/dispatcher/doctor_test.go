@@ -0,0 +1,103 @@
+package dispatcher
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/tests"
+)
+
+func TestDoctor(t *testing.T) {
+	logrus.SetLevel(logrus.PanicLevel)
+	dir, err := ioutil.TempDir("", "frontend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.NewDispatcher()
+	cfg.Mongo.Addr = "127.0.0.1:1"
+	cfg.Mongo.ConnectTimeout = 1
+	cfg.Template.Path = "../../extra/templates"
+	cfg.Frontend.Path = dir
+	cfg.Agent.Enable = true
+
+	d := Doctor(context.Background(), cfg, DoctorOpts{EmailTo: "admin@example.com"})
+	expected := map[string]CheckStatus{
+		"config":    CheckPass,
+		"mongo":     CheckFail,
+		"indexes":   CheckSkip,
+		"email":     CheckPass,
+		"templates": CheckPass,
+		// there is no index file in the frontend path
+		"frontend": CheckFail,
+		"agent":    CheckSkip,
+	}
+	if len(d.Checks) != len(expected) {
+		t.Fatalf("expected %d checks, got %d:\n%s", len(expected), len(d.Checks), d)
+	}
+	for _, c := range d.Checks {
+		if c.Status != expected[c.Name] {
+			t.Errorf("%s: expected %s, got %s: %s", c.Name, expected[c.Name], c.Status, c.Message)
+		}
+	}
+	if d.Ok() {
+		t.Error("diagnosis with failed checks shouldn't be ok")
+	}
+
+	if err := ioutil.WriteFile(dir+"/index.html", []byte("shell"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Template.Path = dir + "/missing"
+	d = Doctor(context.Background(), cfg, DoctorOpts{})
+	for _, c := range d.Checks {
+		switch c.Name {
+		case "frontend":
+			if c.Status != CheckPass {
+				t.Errorf("frontend with the index file should pass: %s", c.Message)
+			}
+		case "templates":
+			if c.Status != CheckFail {
+				t.Error("missing templates directory should fail")
+			}
+		case "email":
+			if c.Status != CheckSkip {
+				t.Error("email without the address should be skipped")
+			}
+		}
+	}
+}
+
+func TestDoctorAgent(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := manager.New(mongo.DB(dbName))
+	cfg := config.InternalAgent{Enable: true}
+
+	d := &Diagnosis{}
+	doctorAgent(d, mgr, cfg)
+	if d.Checks[0].Status != CheckFail {
+		t.Errorf("missing agent user should fail: %s", d.Checks[0].Message)
+	}
+	if _, err := mgr.Users.GetByEmail(manager.AgentEmail); !mgr.IsNotFound(err) {
+		t.Errorf("doctor shouldn't create the agent user, got %v", err)
+	}
+
+	if _, err := getAgentToken(mgr); err != nil {
+		t.Fatal(err)
+	}
+	d = &Diagnosis{}
+	doctorAgent(d, mgr, cfg)
+	if d.Checks[0].Status != CheckPass {
+		t.Errorf("existed agent token should pass: %s", d.Checks[0].Message)
+	}
+}
@@ -0,0 +1,80 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+
+	"github.com/bearded-web/bearded/services"
+)
+
+// all api services are registered under this prefix, the cookie path is the same
+const apiPrefix = "/api/"
+
+// spaFallback serves the index file for routes of the single page app, so deep links work after the reload.
+// It's used after the static middleware: api routes, other methods and missing files with an extension
+// are passed to the next handler, so they get json errors instead of the app shell.
+type spaFallback struct {
+	dir   http.FileSystem
+	index string
+	// routes served by the rest container outside of the api prefix, e.g. swagger
+	skip []string
+}
+
+func (f *spaFallback) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !f.isAppRoute(r) {
+		next(rw, r)
+		return
+	}
+	file, err := f.dir.Open(f.index)
+	if err != nil {
+		next(rw, r)
+		return
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		next(rw, r)
+		return
+	}
+	// the shell is small and changed with every release, so it shouldn't be cached
+	rw.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(rw, r, f.index, stat.ModTime(), file)
+}
+
+func (f *spaFallback) isAppRoute(r *http.Request) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+	p := r.URL.Path
+	if strings.HasPrefix(p, apiPrefix) || path.Ext(p) != "" {
+		return false
+	}
+	for _, prefix := range f.skip {
+		if prefix != "" && strings.HasPrefix(p, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeServiceError writes errors of the rest container, like not found routes, in the api error envelope
+func writeServiceError(err restful.ServiceError, _ *restful.Request, resp *restful.Response) {
+	code := services.CodeWrongData
+	if err.Code == http.StatusNotFound {
+		code = services.CodeNotFound
+	}
+	// the route isn't matched, so the response doesn't know produced types
+	resp.WriteHeader(err.Code)
+	resp.WriteAsJson(services.NewError(code, err.Message))
+}
+
+// notFound responds to paths outside of all services, it's registered on the root of the rest container
+func notFound(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", restful.MIME_JSON)
+	rw.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(rw).Encode(services.NotFoundErr)
+}
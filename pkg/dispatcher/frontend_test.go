@@ -0,0 +1,78 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codegangsta/negroni"
+	"github.com/emicklei/go-restful"
+
+	"github.com/bearded-web/bearded/services"
+)
+
+func TestSpaFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frontend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("shell"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	container := restful.NewContainer()
+	container.ServiceErrorHandler(writeServiceError)
+	container.Handle("/", http.HandlerFunc(notFound))
+	ws := &restful.WebService{}
+	ws.Path("/api/v1/ping").Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("").To(func(_ *restful.Request, resp *restful.Response) {
+		resp.WriteEntity(map[string]string{"pong": "ok"})
+	}))
+	container.Add(ws)
+
+	app := negroni.New()
+	app.Use(negroni.NewStatic(http.Dir(dir)))
+	app.Use(&spaFallback{dir: http.Dir(dir), index: "index.html", skip: []string{"/swagger/"}})
+	app.UseHandler(container)
+
+	get := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, path := range []string{"/", "/projects/1/targets", "/scan/abc"} {
+		rec := get("GET", path)
+		if rec.Code != http.StatusOK || rec.Body.String() != "shell" {
+			t.Errorf("%s: expected the app shell, got %d %q", path, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := get("GET", "/api/v1/ping"); rec.Code != http.StatusOK || rec.Body.String() == "shell" {
+		t.Errorf("api route shouldn't get the shell, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	for _, path := range []string{"/api/v1/unknown", "/api/v1/ping/unknown", "/missing.js", "/swagger/index"} {
+		rec := get("GET", path)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, rec.Code)
+			continue
+		}
+		e := &services.ServiceError{}
+		if err := json.Unmarshal(rec.Body.Bytes(), e); err != nil {
+			t.Errorf("%s: expected json error, got %q", path, rec.Body.String())
+			continue
+		}
+		if e.Errno != services.CodeNotFound {
+			t.Errorf("%s: expected not found errno, got %d", path, e.Errno)
+		}
+	}
+	if rec := get("POST", "/projects"); rec.Code == http.StatusOK {
+		t.Error("only GET and HEAD should get the shell")
+	}
+}
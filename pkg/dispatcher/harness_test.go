@@ -0,0 +1,364 @@
+package dispatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/campaign"
+	"github.com/bearded-web/bearded/models/comment"
+	"github.com/bearded-web/bearded/models/feed"
+	"github.com/bearded-web/bearded/models/file"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/share"
+	"github.com/bearded-web/bearded/models/target"
+	"github.com/bearded-web/bearded/models/tech"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/models/webhook"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/email"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/passlib"
+	"github.com/bearded-web/bearded/pkg/store"
+	"github.com/bearded-web/bearded/pkg/template"
+	"github.com/bearded-web/bearded/pkg/tests"
+)
+
+// Integration tests run the whole api against an ephemeral mongo, see tests.StartMongo.
+// The mongo is started once in TestMain, every harness gets its own database.
+var testMongo *tests.Mongo
+
+const (
+	testAdminEmail    = "admin@example.com"
+	testAdminPassword = "admin-password"
+)
+
+type harness struct {
+	t      *testing.T
+	Cfg    *config.Dispatcher
+	Mgr    *manager.Manager
+	Server *httptest.Server
+
+	session *mgo.Session
+	dbName  string
+	passCtx *passlib.Context
+	cancel  context.CancelFunc
+}
+
+// newHarness serves all services on a fresh database, the test is skipped if mongo isn't available.
+// The admin testAdminEmail is bootstrapped, call Close when the test is finished.
+// The config is changed by configure functions before services are started.
+func newHarness(t *testing.T, configure ...func(cfg *config.Dispatcher)) *harness {
+	if testMongo == nil {
+		t.Skip(tests.ErrNoMongo)
+	}
+	logrus.SetLevel(logrus.PanicLevel)
+
+	session, dbName, err := testMongo.RandomDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.NewDispatcher()
+	cfg.Mongo.Database = dbName
+	cfg.Admin.Email = testAdminEmail
+	cfg.Admin.Password = testAdminPassword
+	// the weakest hashing, so users are created and logged in fast
+	cfg.Password.Cost = 4
+	for _, fn := range configure {
+		fn(cfg)
+	}
+	h := &harness{t: t, Cfg: cfg, session: session, dbName: dbName}
+
+	h.Mgr = manager.New(session.DB(dbName))
+	h.Mgr.Cfg.Isolation = cfg.Api.Isolation
+	if err := h.Mgr.Init(); err != nil {
+		h.Close()
+		t.Fatal(err)
+	}
+	h.Mgr.Permission.SetAdmins([]string{cfg.Admin.Email})
+	if h.passCtx, err = passlib.New(passlib.Policy{Scheme: cfg.Password.Scheme, Cost: cfg.Password.Cost}); err != nil {
+		h.Close()
+		t.Fatal(err)
+	}
+	mailer, err := email.New(cfg.Email)
+	if err != nil {
+		h.Close()
+		t.Fatal(err)
+	}
+	tmpl := template.New(&template.Opts{Directory: "../../extra/templates", DefaultLocale: cfg.Template.DefaultLocale})
+
+	container, err := getRestContainer(cfg.Api)
+	if err != nil {
+		h.Close()
+		t.Fatal(err)
+	}
+	var ctx context.Context
+	ctx, h.cancel = context.WithCancel(context.Background())
+	if err := initServices(ctx, container, cfg, h.Mgr, store.New(cfg.Redis), mailer, tmpl); err != nil {
+		h.Close()
+		t.Fatal(err)
+	}
+	h.Server = httptest.NewServer(container)
+	return h
+}
+
+// Close the server and drop the database
+func (h *harness) Close() {
+	if h.Server != nil {
+		h.Server.Close()
+	}
+	if h.cancel != nil {
+		h.cancel()
+	}
+	h.Mgr.Close()
+	tests.RandomTestMongoDown(h.session, h.dbName)
+}
+
+// CreateUser with the password directly in the database
+func (h *harness) CreateUser(email, password string) *user.User {
+	hash, err := h.passCtx.Encrypt(password)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	u, err := h.Mgr.Users.Create(&user.User{Email: email, Password: hash})
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return u
+}
+
+// Anonymous client keeps cookies, so it's authenticated after Login
+func (h *harness) Anonymous() *apiClient {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return &apiClient{h: h, http: &http.Client{Jar: jar}}
+}
+
+// Login returns the client with the session of the user
+func (h *harness) Login(email, password string) *apiClient {
+	c := h.Anonymous()
+	if code := c.Post("/api/v1/auth", map[string]string{"email": email, "password": password}, nil); code != http.StatusCreated {
+		h.t.Fatalf("can't login %s: %d", email, code)
+	}
+	return c
+}
+
+// Admin is logged in as the bootstrapped admin
+func (h *harness) Admin() *apiClient {
+	return h.Login(testAdminEmail, testAdminPassword)
+}
+
+type apiClient struct {
+	h    *harness
+	http *http.Client
+}
+
+// Do the json request and decode the response into result if it's not nil, the status code is returned.
+// Transport errors fail the test.
+func (c *apiClient) Do(method, path string, body, result interface{}) int {
+	t := c.h.t
+	buf := &bytes.Buffer{}
+	if body != nil {
+		if err := json.NewEncoder(buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, c.h.Server.URL+path, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if result != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatal(fmt.Errorf("can't decode %s %s: %s", method, path, err))
+		}
+	}
+	return resp.StatusCode
+}
+
+func (c *apiClient) Get(path string, result interface{}) int {
+	return c.Do("GET", path, nil, result)
+}
+
+func (c *apiClient) Post(path string, body, result interface{}) int {
+	return c.Do("POST", path, body, result)
+}
+
+func (c *apiClient) Put(path string, body, result interface{}) int {
+	return c.Do("PUT", path, body, result)
+}
+
+func (c *apiClient) Delete(path string) int {
+	return c.Do("DELETE", path, nil, nil)
+}
+
+// isolation fixture is the project of the owner with one object of every scoped collection
+type isolationFixture struct {
+	project  *project.Project
+	target   *target.Target
+	scan     *scan.Scan
+	issue    *issue.TargetIssue
+	report   *report.Report
+	comment  *comment.Comment
+	file     *file.Meta
+	template *scan.Template
+	share    *share.Share
+	tech     *tech.TargetTech
+	campaign *campaign.Campaign
+	feed     *feed.FeedItem
+}
+
+func newIsolationFixture(h *harness, owner *user.User) *isolationFixture {
+	t := h.t
+	mgr := h.Mgr
+	f := &isolationFixture{}
+	var err error
+	must := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.project, err = mgr.Projects.Create(&project.Project{Name: "isolated", Owner: owner.Id})
+	must(err)
+	f.target, err = mgr.Targets.Create(&target.Target{Project: f.project.Id, Type: target.TypeWeb,
+		Web: &target.WebTarget{Domain: "http://isolated.example.com"}})
+	must(err)
+	f.scan, err = mgr.Scans.Create(&scan.Scan{Project: f.project.Id, Target: f.target.Id, Owner: owner.Id})
+	must(err)
+	f.file, err = mgr.Files.Create(bytes.NewBufferString("evidence"), &file.Meta{Name: "evidence.txt", Owner: owner.Id})
+	must(err)
+	f.issue, err = mgr.Issues.Create(&issue.TargetIssue{Project: f.project.Id, Target: f.target.Id,
+		Issue: issue.Issue{Summary: "isolated", Attachments: []*file.Meta{f.file}}})
+	must(err)
+	f.report, err = mgr.Reports.Create(&report.Report{Type: report.TypeEmpty, Scan: f.scan.Id,
+		ScanSession: bson.NewObjectId(), Project: f.project.Id})
+	must(err)
+	f.comment, err = mgr.Comments.Create(&comment.Comment{Owner: owner.Id, Type: comment.Issue,
+		Link: f.issue.Id, Project: f.project.Id, Text: "isolated"})
+	must(err)
+	f.template, err = mgr.Templates.Create(&scan.Template{Name: "isolated", Project: f.project.Id, Plan: bson.NewObjectId()})
+	must(err)
+	f.share, err = mgr.Shares.Create(&share.Share{Resource: share.ResourceProject, Project: f.project.Id, Owner: owner.Id})
+	must(err)
+	f.tech, err = mgr.Techs.Create(&tech.TargetTech{Project: f.project.Id, Target: f.target.Id})
+	must(err)
+	f.campaign, err = mgr.Campaigns.Create(&campaign.Campaign{Name: "isolated", Project: f.project.Id, Owner: owner.Id})
+	must(err)
+	f.feed, err = mgr.Feed.Create(&feed.FeedItem{Type: feed.TypeComment, Project: f.project.Id, Target: f.target.Id, Owner: owner.Id})
+	must(err)
+	return f
+}
+
+func TestIsolation(t *testing.T) {
+	h := newHarness(t, func(cfg *config.Dispatcher) { cfg.Api.Isolation = true })
+	defer h.Close()
+
+	owner := h.CreateUser("owner@example.com", "owner-password")
+	other := h.CreateUser("other@example.com", "other-password")
+	f := newIsolationFixture(h, owner)
+	ownerClient := h.Login("owner@example.com", "owner-password")
+	otherClient := h.Login("other@example.com", "other-password")
+
+	objects := map[string]string{
+		"project":  "/api/v1/projects/" + f.project.Id.Hex(),
+		"target":   "/api/v1/targets/" + f.target.Id.Hex(),
+		"scan":     "/api/v1/scans/" + f.scan.Id.Hex(),
+		"reports":  "/api/v1/scans/" + f.scan.Id.Hex() + "/reports",
+		"issue":    "/api/v1/issues/" + f.issue.Id.Hex(),
+		"comments": "/api/v1/issues/" + f.issue.Id.Hex() + "/comments",
+		"file":     "/api/v1/files/" + f.file.Id,
+		"download": "/api/v1/files/" + f.file.Id + "/download",
+		"template": "/api/v1/templates/" + f.template.Id.Hex(),
+		"tech":     "/api/v1/techs/" + f.tech.Id.Hex(),
+		"campaign": "/api/v1/campaigns/" + f.campaign.Id.Hex(),
+		"feed":     "/api/v1/feed/" + f.feed.Id.Hex(),
+	}
+	for name, path := range objects {
+		if code := ownerClient.Do("GET", path, nil, nil); code != http.StatusOK {
+			t.Fatalf("owner %s: expected 200, got %d", name, code)
+		}
+		if code := otherClient.Do("GET", path, nil, nil); code != http.StatusNotFound {
+			t.Fatalf("non-member %s: expected 404, got %d", name, code)
+		}
+	}
+
+	// writes of objects out of the scope aren't possible too
+	writes := map[string]int{
+		"target": otherClient.Put(objects["target"], map[string]interface{}{}, nil),
+		"issue":  otherClient.Put(objects["issue"], map[string]interface{}{"summary": "changed"}, nil),
+		"tech":   otherClient.Put(objects["tech"], map[string]interface{}{}, nil),
+		"share":  otherClient.Delete("/api/v1/shares/" + f.share.Id.Hex()),
+		"feed":   otherClient.Delete(objects["feed"]),
+	}
+	for name, code := range writes {
+		if code != http.StatusNotFound {
+			t.Fatalf("non-member change of %s: expected 404, got %d", name, code)
+		}
+	}
+	if iss, err := h.Mgr.Issues.GetById(f.issue.Id); err != nil || iss.Summary != "isolated" {
+		t.Fatalf("issue is changed by non-member: %v", err)
+	}
+
+	lists := []string{
+		"/api/v1/targets?project=" + f.project.Id.Hex(),
+		"/api/v1/scans?project=" + f.project.Id.Hex(),
+		"/api/v1/issues?project=" + f.project.Id.Hex(),
+		"/api/v1/feed?project=" + f.project.Id.Hex(),
+		"/api/v1/techs?project=" + f.project.Id.Hex(),
+		"/api/v1/campaigns?project=" + f.project.Id.Hex(),
+	}
+	for _, path := range lists {
+		list := &struct {
+			Count int `json:"count"`
+		}{}
+		if code := otherClient.Get(path, list); code != http.StatusOK && code != http.StatusNotFound {
+			t.Fatalf("non-member %s: expected empty list or 404, got %d", path, code)
+		}
+		if list.Count != 0 {
+			t.Fatalf("non-member %s: expected empty list, got %d", path, list.Count)
+		}
+	}
+
+	// collections which are reached only through other objects are scoped in the manager
+	mgr := h.Mgr.Copy().WithScope(h.Mgr.ScopeFor(other))
+	defer mgr.Close()
+	if _, err := mgr.Reports.GetById(f.report.Id); !mgr.IsNotFound(err) {
+		t.Fatalf("non-member report: expected not found, got %v", err)
+	}
+	if _, err := mgr.Comments.GetById(f.comment.Id); !mgr.IsNotFound(err) {
+		t.Fatalf("non-member comment: expected not found, got %v", err)
+	}
+	if _, err := mgr.Files.GetById(f.file.Id); !mgr.IsNotFound(err) {
+		t.Fatalf("non-member file: expected not found, got %v", err)
+	}
+	if n, err := mgr.Issues.RemoveAll(bson.M{"project": f.project.Id}); err != nil || n != 0 {
+		t.Fatalf("non-member removed %d issues: %v", n, err)
+	}
+	// deliveries of admin alerts don't belong to projects
+	if _, err := h.Mgr.Webhooks.Create(&webhook.Delivery{Subscription: "incident", Status: webhook.StatusDelivered}); err != nil {
+		t.Fatal(err)
+	}
+	if _, count, err := mgr.Webhooks.FilterByQuery(bson.M{}); err != nil || count != 0 {
+		t.Fatalf("non-member webhook deliveries: %d %v", count, err)
+	}
+}
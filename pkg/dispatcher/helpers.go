@@ -1,16 +1,155 @@
 package dispatcher
 
-import "github.com/bearded-web/bearded/pkg/manager"
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/token"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/passlib"
+	"github.com/bearded-web/bearded/pkg/secret"
+	"github.com/bearded-web/bearded/pkg/utils"
+	"github.com/bearded-web/bearded/pkg/validate"
+)
+
+// name of the token which is provisioned for the internal agent
+const agentTokenName = "internal agent"
 
 // Get or create token by default agent email. The token is used only by internal agent.
+// The system user and the token are created on the first run, so the internal agent works without setup.
 func getAgentToken(mgr *manager.Manager) (string, error) {
 	u, err := mgr.Users.GetByEmail(manager.AgentEmail)
 	if err != nil {
-		return "", err
+		if !mgr.IsNotFound(err) {
+			return "", fmt.Errorf("can't get system user %s: %s", manager.AgentEmail, err)
+		}
+		u, err = mgr.Users.Create(&user.User{Email: manager.AgentEmail})
+		if err != nil {
+			return "", fmt.Errorf("can't create system user %s: %s", manager.AgentEmail, err)
+		}
+		logrus.Infof("System user %s is created for the internal agent", manager.AgentEmail)
+	}
+	tokens, _, err := mgr.Tokens.FilterByQuery(bson.M{
+		"user":    u.Id,
+		"name":    agentTokenName,
+		"removed": false,
+	}, manager.Opts{Limit: 1})
+	if err != nil {
+		return "", fmt.Errorf("can't get token for system user %s: %s", manager.AgentEmail, err)
+	}
+	if len(tokens) > 0 {
+		return tokens[0].Hash, nil
+	}
+	tkn, err := mgr.Tokens.Create(&token.Token{
+		User: u.Id,
+		Name: agentTokenName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("can't create token for system user %s: %s", manager.AgentEmail, err)
+	}
+	logrus.Infof("Token %q is created for the internal agent", agentTokenName)
+	return tkn.Hash, nil
+}
+
+// Make strength policy for new passwords, the builtin blocklist is extended with passwords from the file
+func getPasswordPolicy(cfg config.Password) (*validate.PasswordPolicy, error) {
+	policy := validate.NewPasswordPolicy()
+	policy.MinLength = cfg.MinLength
+	policy.MaxLength = cfg.MaxLength
+	policy.RequireLower = cfg.RequireLower
+	policy.RequireUpper = cfg.RequireUpper
+	policy.RequireDigit = cfg.RequireDigit
+	policy.RequireSpecial = cfg.RequireSpecial
+	if cfg.Blocklist != "" {
+		if err := policy.LoadBlocklist(cfg.Blocklist); err != nil {
+			return nil, fmt.Errorf("can't load blocklist: %s", err)
+		}
+		logrus.Infof("Password blocklist contains %d passwords", len(policy.Blocklist))
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Create the first admin if it's configured and there are no users except the system one.
+// It does nothing once any user exists, so it's safe to keep the option after the first run.
+func bootstrapAdmin(mgr *manager.Manager, passCtx *passlib.Context, cfg config.Admin) error {
+	if cfg.Email == "" {
+		return nil
+	}
+	_, count, err := mgr.Users.FilterByQuery(bson.M{"email": bson.M{"$ne": manager.AgentEmail}}, manager.Opts{Limit: 1})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
 	}
-	token, err := mgr.Tokens.GetOrCreate(u.Id)
+	password := cfg.Password
+	generated := password == ""
+	if generated {
+		password = utils.RandomString(12)
+	}
+	hash, err := passCtx.Encrypt(password)
 	if err != nil {
-		return "", err
+		return err
+	}
+	if _, err := mgr.Users.Create(&user.User{Email: cfg.Email, Password: hash}); err != nil {
+		return err
+	}
+	if generated {
+		// the password isn't stored anywhere, so it's shown only once
+		logrus.Warnf("Admin %s is created with password: %s", cfg.Email, password)
+	} else {
+		logrus.Infof("Admin %s is created", cfg.Email)
+	}
+	return nil
+}
+
+// Set severity scheme from the config, the default scheme is kept if the config is empty
+func setSeverityScheme(cfg []config.Severity) error {
+	if len(cfg) > 0 {
+		scheme := issue.Scheme{}
+		for _, sev := range cfg {
+			level := &issue.SeverityLevel{
+				Name:    issue.Severity(sev.Name),
+				Label:   sev.Label,
+				MinCvss: sev.MinCvss,
+			}
+			for _, alias := range sev.Aliases {
+				level.Aliases = append(level.Aliases, issue.Severity(alias))
+			}
+			scheme = append(scheme, level)
+		}
+		if err := issue.SetScheme(scheme); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("Severities: %v", issue.Severities)
+	return nil
+}
+
+// Replace secret references in the config with values from the backends.
+// The vault config is resolved first, so the vault token could be kept in env or file.
+func resolveSecrets(cfg *config.Dispatcher) error {
+	r := secret.NewResolver()
+	vaultCfg := &cfg.Secrets.Vault
+	if err := r.Resolve(vaultCfg); err != nil {
+		return err
+	}
+	if vaultCfg.Addr != "" {
+		token := vaultCfg.Token
+		if token == "" {
+			token = os.Getenv("VAULT_TOKEN")
+		}
+		r.Register("vault", secret.NewVault(vaultCfg.Addr, token, time.Duration(vaultCfg.Timeout)*time.Second))
 	}
-	return token.Hash, nil
+	return r.Resolve(cfg)
 }
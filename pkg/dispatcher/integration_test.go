@@ -0,0 +1,180 @@
+package dispatcher
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/bearded-web/bearded/models/me"
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/plugin"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
+	"github.com/bearded-web/bearded/pkg/tests"
+	"github.com/bearded-web/bearded/services"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(func() int {
+		mongo, err := tests.StartMongo()
+		if err != nil {
+			// tests which need mongo are skipped
+			println(err.Error())
+		} else {
+			testMongo = mongo
+			defer mongo.Stop()
+		}
+		return m.Run()
+	}())
+}
+
+func TestAuthFlow(t *testing.T) {
+	h := newHarness(t)
+	defer h.Close()
+
+	anon := h.Anonymous()
+	if code := anon.Get("/api/v1/me", nil); code != http.StatusUnauthorized {
+		t.Fatalf("anonymous me: expected 401, got %d", code)
+	}
+	if code := anon.Post("/api/v1/auth", map[string]string{"email": testAdminEmail, "password": "wrong"}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: expected 401, got %d", code)
+	}
+
+	info := &me.Info{}
+	if code := h.Admin().Get("/api/v1/me", info); code != http.StatusOK {
+		t.Fatalf("admin me: expected 200, got %d", code)
+	}
+	if info.User.Email != testAdminEmail || !info.User.Admin {
+		t.Fatalf("expected admin %s, got %s admin=%v", testAdminEmail, info.User.Email, info.User.Admin)
+	}
+
+	h.CreateUser("user@example.com", "user-password")
+	info = &me.Info{}
+	if code := h.Login("user@example.com", "user-password").Get("/api/v1/me", info); code != http.StatusOK {
+		t.Fatalf("user me: expected 200, got %d", code)
+	}
+	if info.User.Admin {
+		t.Fatal("user shouldn't be admin")
+	}
+	// the default project is created on the first request
+	if len(info.Projects) != 1 {
+		t.Fatalf("expected the default project, got %d projects", len(info.Projects))
+	}
+}
+
+func TestProjectFlow(t *testing.T) {
+	h := newHarness(t)
+	defer h.Close()
+
+	h.CreateUser("owner@example.com", "owner-password")
+	h.CreateUser("other@example.com", "other-password")
+	owner := h.Login("owner@example.com", "owner-password")
+
+	if code := owner.Post("/api/v1/projects", map[string]string{}, nil); code != http.StatusBadRequest {
+		t.Fatalf("project without name: expected 400, got %d", code)
+	}
+	p := &project.Project{}
+	if code := owner.Post("/api/v1/projects", map[string]string{"name": "integration"}, p); code != http.StatusCreated {
+		t.Fatalf("create project: expected 201, got %d", code)
+	}
+	if code := owner.Get("/api/v1/projects/"+p.Id.Hex(), &project.Project{}); code != http.StatusOK {
+		t.Fatalf("get project: expected 200, got %d", code)
+	}
+
+	list := &project.ProjectList{}
+	if code := owner.Get("/api/v1/projects", list); code != http.StatusOK {
+		t.Fatalf("list projects: expected 200, got %d", code)
+	}
+	found := false
+	for _, item := range list.Results {
+		found = found || item.Id == p.Id
+	}
+	if !found {
+		t.Fatalf("project %s isn't listed", p.Id.Hex())
+	}
+
+	// updates require the current version
+	if code := owner.Put("/api/v1/projects/"+p.Id.Hex(), map[string]interface{}{"name": "renamed"}, nil); code != services.StatusPreconditionRequired {
+		t.Fatalf("update without version: expected 428, got %d", code)
+	}
+	updated := &project.Project{}
+	code := owner.Put("/api/v1/projects/"+p.Id.Hex(), map[string]interface{}{"name": "renamed", "version": p.Version}, updated)
+	if code != http.StatusOK || updated.Version != p.Version+1 {
+		t.Fatalf("update project: expected 200 with version %d, got %d with %d", p.Version+1, code, updated.Version)
+	}
+	if code := owner.Put("/api/v1/projects/"+p.Id.Hex(), map[string]interface{}{"name": "stale", "version": p.Version}, nil); code != http.StatusConflict {
+		t.Fatalf("update with stale version: expected 409, got %d", code)
+	}
+
+	// projects are visible only to members
+	other := h.Login("other@example.com", "other-password")
+	if code := other.Get("/api/v1/projects/"+p.Id.Hex(), nil); code == http.StatusOK {
+		t.Fatal("project shouldn't be visible to other users")
+	}
+}
+
+func TestScanFlow(t *testing.T) {
+	h := newHarness(t)
+	defer h.Close()
+
+	pl, err := h.Mgr.Plugins.Create(&plugin.Plugin{
+		Name:    "barbudo/integration",
+		Version: "0.0.1",
+		Type:    plugin.Script,
+		Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pln, err := h.Mgr.Plans.Create(&plan.Plan{
+		Name:       "integration",
+		TargetType: target.TypeWeb,
+		Workflow:   []*plan.WorkflowStep{{Name: "step", Plugin: pl.Name + ":" + pl.Version}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.CreateUser("scanner@example.com", "scanner-password")
+	c := h.Login("scanner@example.com", "scanner-password")
+
+	p := &project.Project{}
+	if code := c.Post("/api/v1/projects", map[string]string{"name": "scans"}, p); code != http.StatusCreated {
+		t.Fatalf("create project: expected 201, got %d", code)
+	}
+	tg := &target.Target{}
+	code := c.Post("/api/v1/targets", map[string]interface{}{
+		"type":    target.TypeWeb,
+		"project": p.Id.Hex(),
+		"web":     map[string]string{"domain": "http://example.com"},
+	}, tg)
+	if code != http.StatusCreated {
+		t.Fatalf("create target: expected 201, got %d", code)
+	}
+
+	if code := c.Post("/api/v1/scans", map[string]string{"project": p.Id.Hex(), "target": tg.Id.Hex()}, nil); code != http.StatusBadRequest {
+		t.Fatalf("scan without plan: expected 400, got %d", code)
+	}
+	sc := &scan.Scan{}
+	code = c.Post("/api/v1/scans", map[string]string{
+		"project": p.Id.Hex(),
+		"target":  tg.Id.Hex(),
+		"plan":    pln.Id.Hex(),
+	}, sc)
+	if code != http.StatusCreated {
+		t.Fatalf("create scan: expected 201, got %d", code)
+	}
+	if len(sc.Sessions) != 1 || sc.Sessions[0].Plugin != pl.Id {
+		t.Fatalf("expected a session of the plugin %s, got %d sessions", pl.Id.Hex(), len(sc.Sessions))
+	}
+
+	got := &scan.Scan{}
+	if code := c.Get("/api/v1/scans/"+sc.Id.Hex(), got); code != http.StatusOK {
+		t.Fatalf("get scan: expected 200, got %d", code)
+	}
+	// sessions are queued when agents take jobs
+	if got.Status != scan.StatusCreated || got.Target != tg.Id {
+		t.Fatalf("expected the created scan of target %s, got %s of %s", tg.Id.Hex(), got.Status, got.Target.Hex())
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"time"
 
+	"github.com/Sirupsen/logrus"
 	"golang.org/x/net/context"
 
 	"github.com/bearded-web/bearded/pkg/agent"
@@ -13,16 +16,67 @@ import (
 	"github.com/bearded-web/bearded/pkg/utils/async"
 )
 
+// serves one agent until the context is done, it's replaced in tests
+var serveAgent = agent.ServeAgent
+
 // Run agent inside current process
 // Start httptest local server
 func RunInternalAgent(ctx context.Context, app http.Handler, token string, cfg *config.Agent) <-chan error {
-	ts := httptest.NewServer(app)
-	api := client.NewClient(fmt.Sprintf("%s/api/", ts.URL), nil)
-	api.Token = token
+	return RunInternalAgents(ctx, app, token, cfg, 1)
+}
+
+// Run a number of agents inside current process, all of them use the same local server.
+// Every agent is registered with its own name, so sessions are pulled independently.
+// The result is returned after all agents are stopped.
+func RunInternalAgents(ctx context.Context, app http.Handler, token string, cfg *config.Agent, workers int) <-chan error {
 	if cfg.Name == "" {
 		cfg.Name = "internal"
 	}
+	workers = agentWorkers(workers)
+
+	ts := httptest.NewServer(app)
+	agents := make([]async.Async, 0, workers)
+	for i := 0; i < workers; i++ {
+		api := client.NewClient(fmt.Sprintf("%s/api/", ts.URL), nil)
+		api.Token = token
+		agentCfg := *cfg
+		if i > 0 {
+			agentCfg.Name = fmt.Sprintf("%s-%d", cfg.Name, i+1)
+		}
+		agents = append(agents, async.New(ctx, func(ctx context.Context) error {
+			return serveAgent(ctx, &agentCfg, api)
+		}))
+	}
+	all := async.All(agents...)
 	return async.Promise(func() error {
-		return agent.ServeAgent(ctx, cfg, api)
+		defer ts.Close()
+		return <-all.Result()
 	})
 }
+
+// stopAgents cancels internal agents and waits for all of them at most the timeout,
+// returns false if some agent is stuck in the plugin or api request
+func stopAgents(cancel func(), result <-chan error, timeout time.Duration) bool {
+	cancel()
+	select {
+	case err := <-result:
+		if err != nil {
+			logrus.Error(err)
+		}
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// every agent runs docker containers, so more agents than cpus only slow down the scans
+func agentWorkers(workers int) int {
+	if workers < 1 {
+		return 1
+	}
+	if max := runtime.NumCPU(); workers > max {
+		logrus.Warnf("Internal agent workers are limited to the number of cpus: %d instead of %d", max, workers)
+		return max
+	}
+	return workers
+}
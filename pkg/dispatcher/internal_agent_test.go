@@ -0,0 +1,102 @@
+package dispatcher
+
+import (
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/bearded-web/bearded/pkg/client"
+	"github.com/bearded-web/bearded/pkg/config"
+)
+
+// fakeAgents replaces agents with ones which record their names and wait for the context,
+// stuck agents ignore the context
+type fakeAgents struct {
+	mu      sync.Mutex
+	names   []string
+	running int
+	stuck   bool
+	started chan struct{}
+}
+
+func useFakeAgents(stuck bool) (*fakeAgents, func()) {
+	f := &fakeAgents{stuck: stuck, started: make(chan struct{}, 100)}
+	original := serveAgent
+	serveAgent = func(ctx context.Context, cfg *config.Agent, api *client.Client) error {
+		f.mu.Lock()
+		f.names = append(f.names, cfg.Name)
+		f.running++
+		f.mu.Unlock()
+		f.started <- struct{}{}
+		if f.stuck {
+			time.Sleep(time.Second)
+		} else {
+			<-ctx.Done()
+		}
+		f.mu.Lock()
+		f.running--
+		f.mu.Unlock()
+		return nil
+	}
+	return f, func() { serveAgent = original }
+}
+
+func (f *fakeAgents) wait(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-f.started:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("only %d of %d agents are started", i, n)
+		}
+	}
+}
+
+func TestAgentWorkers(t *testing.T) {
+	require.Equal(t, 1, agentWorkers(0))
+	require.Equal(t, 1, agentWorkers(-1))
+	require.Equal(t, 1, agentWorkers(1))
+	require.Equal(t, runtime.NumCPU(), agentWorkers(runtime.NumCPU()+8))
+}
+
+func TestRunInternalAgents(t *testing.T) {
+	fakes, restore := useFakeAgents(false)
+	defer restore()
+
+	workers := agentWorkers(3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := RunInternalAgents(ctx, http.NotFoundHandler(), "token", &config.Agent{}, workers)
+	fakes.wait(t, workers)
+
+	fakes.mu.Lock()
+	names := append([]string{}, fakes.names...)
+	fakes.mu.Unlock()
+	sort.Strings(names)
+	expected := []string{"internal", "internal-2", "internal-3"}[:workers]
+	require.Equal(t, expected, names)
+
+	// all workers are stopped within the timeout
+	require.True(t, stopAgents(cancel, result, time.Second*5))
+	fakes.mu.Lock()
+	defer fakes.mu.Unlock()
+	require.Equal(t, 0, fakes.running)
+}
+
+func TestStopStuckAgents(t *testing.T) {
+	fakes, restore := useFakeAgents(true)
+	defer restore()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := RunInternalAgents(ctx, http.NotFoundHandler(), "token", &config.Agent{Name: "stuck"}, 1)
+	fakes.wait(t, 1)
+	require.False(t, stopAgents(cancel, result, time.Millisecond*50))
+	// the result is still returned when the agent is finished
+	require.True(t, stopAgents(cancel, result, time.Second*5))
+}
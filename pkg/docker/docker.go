@@ -20,6 +20,8 @@ type ContainerResponse struct {
 	Err       error
 	Log       []byte
 	Files     map[string]io.Reader
+	// the container is killed because the memory limit is exceeded
+	OOMKilled bool
 }
 
 type Docker struct {
@@ -57,8 +59,9 @@ func (d *Docker) PullImage(name string) error {
 
 // RunImage returns 2 response, first with created container object, second with logs.
 // I know it's kind of stupid. But I'll rewrite it later.
+// Container output is copied to logs while the container is running, if logs isn't nil.
 func (d *Docker) RunImage(ctx context.Context, config *dockerclient.Config,
-	hostCfg *dockerclient.HostConfig, takeFiles []string) <-chan ContainerResponse {
+	hostCfg *dockerclient.HostConfig, takeFiles []string, logs io.Writer) <-chan ContainerResponse {
 
 	// TODO (m0sth8): rewrite this, please
 	ch := make(chan ContainerResponse, 2)
@@ -132,9 +135,14 @@ func (d *Docker) RunImage(ctx context.Context, config *dockerclient.Config,
 			cprint("Waiting for log")
 			stdout := bytes.NewBuffer(nil)
 			stderr := bytes.NewBuffer(nil)
+			var outStream, errStream io.Writer = stdout, stderr
+			if logs != nil {
+				outStream = io.MultiWriter(stdout, logs)
+				errStream = io.MultiWriter(stderr, logs)
+			}
 			err := d.Client.Logs(dockerclient.LogsOptions{
-				OutputStream: stdout,
-				ErrorStream:  stderr,
+				OutputStream: outStream,
+				ErrorStream:  errStream,
 				Container:    container.ID,
 				Follow:       true,
 				Stdout:       true,
@@ -166,6 +174,9 @@ func (d *Docker) RunImage(ctx context.Context, config *dockerclient.Config,
 		case tmpResp := <-respCh:
 			resp.Err = tmpResp.Err
 			resp.Log = tmpResp.Log
+			if state, err := d.Client.InspectContainer(container.ID); err == nil {
+				resp.OOMKilled = state.State.OOMKilled
+			}
 		}
 		if resp.Err == nil && takeFiles != nil && len(takeFiles) > 0 {
 			files := map[string]io.Reader{}
@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/bearded-web/bearded/pkg/config"
 )
 
 func TestConsoleBackend(t *testing.T) {
@@ -17,3 +19,19 @@ func TestConsoleBackend(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Contains(t, buf.String(), "Hello <b>Bob</b> and <i>Cora</i>!")
 }
+
+func TestDisabledBackend(t *testing.T) {
+	e, err := New(config.Email{Backend: string(DisabledType)})
+	assert.NoError(t, err)
+	assert.True(t, e.Disabled())
+	assert.True(t, IsDisabled(e))
+
+	msg := NewMessage()
+	msg.SetHeader("To", "admin@example.com")
+	assert.NoError(t, e.Send(msg))
+
+	e, err = New(config.Email{Backend: string(ConsoleType)})
+	assert.NoError(t, err)
+	assert.False(t, IsDisabled(e))
+	assert.False(t, IsDisabled(NewMemoryBackend(1)))
+}
@@ -0,0 +1,34 @@
+package email
+
+import (
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/gomail.v1"
+)
+
+// DisabledBackend drops messages, so notifications don't fail on deployments without email
+type DisabledBackend struct{}
+
+func NewDisabledBackend() *DisabledBackend {
+	return &DisabledBackend{}
+}
+
+func (b *DisabledBackend) Send(m *gomail.Message) error {
+	logrus.Debugf("Email is disabled, message %q to %v isn't sent", m.GetHeader("Subject"), m.GetHeader("To"))
+	return nil
+}
+
+func (b *DisabledBackend) Close() {
+
+}
+
+func (b *DisabledBackend) Disabled() bool {
+	return true
+}
+
+// IsDisabled returns true if the mailer drops messages
+func IsDisabled(m Mailer) bool {
+	d, ok := m.(interface {
+		Disabled() bool
+	})
+	return ok && d.Disabled()
+}
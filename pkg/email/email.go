@@ -12,6 +12,8 @@ type BackendType string
 const (
 	SmtpType    = BackendType("smtp")
 	ConsoleType = BackendType("console")
+	// messages aren't sent at all, for deployments without email
+	DisabledType = BackendType("disabled")
 )
 
 var (
@@ -19,8 +21,9 @@ var (
 )
 
 var Backends = map[BackendType]struct{}{
-	SmtpType:    struct{}{},
-	ConsoleType: struct{}{},
+	SmtpType:     struct{}{},
+	ConsoleType:  struct{}{},
+	DisabledType: struct{}{},
 }
 
 type Mailer interface {
@@ -47,6 +50,11 @@ func (e *Email) Close() {
 	e.backend.Close()
 }
 
+// Disabled returns true if messages are dropped, flows which rely on email should tell it to users
+func (e *Email) Disabled() bool {
+	return IsDisabled(e.backend)
+}
+
 func (e *Email) SetConfig(cfg config.Email) error {
 	if err := validateConfig(cfg); err != nil {
 		return err
@@ -60,6 +68,8 @@ func (e *Email) SetConfig(cfg config.Email) error {
 		e.backend = NewSmtpBackend(cfg.Smtp)
 	case ConsoleType:
 		e.backend = NewConsoleBackend()
+	case DisabledType:
+		e.backend = NewDisabledBackend()
 	default:
 		return ErrUnknownBackend
 	}
@@ -0,0 +1,80 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+var csvHeader = []string{
+	"id", "target", "project", "summary", "severity", "cvss", "vulnType", "class", "url",
+	"confirmed", "false", "muted", "resolved", "created", "lastSeen", "scan", "session", "plugin",
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// Titles parses the localized csv header, like the translated report/issues-csv-header template.
+// Nil is returned if titles don't match columns, so the header of keys is used.
+func Titles(line string) []string {
+	titles, err := csv.NewReader(strings.NewReader(line)).Read()
+	if err != nil || len(titles) != len(csvHeader) {
+		return nil
+	}
+	for i, title := range titles {
+		titles[i] = strings.TrimSpace(title)
+	}
+	return titles
+}
+
+func newCsvWriter(w io.Writer, titles []string) (*csvWriter, error) {
+	header := csvHeader
+	if len(titles) == len(csvHeader) {
+		header = titles
+	}
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write(header); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (w *csvWriter) Write(obj *issue.TargetIssue) error {
+	url := ""
+	if obj.Vector != nil {
+		url = obj.Vector.Url
+	}
+	cvss, vulnType := "", ""
+	if obj.Cvss > 0 {
+		cvss = strconv.FormatFloat(obj.Cvss, 'f', -1, 64)
+	}
+	if obj.VulnType != 0 {
+		vulnType = strconv.Itoa(obj.VulnType)
+	}
+	o := origin(obj)
+	return w.w.Write([]string{
+		obj.Id.Hex(), obj.Target.Hex(), obj.Project.Hex(), obj.Summary, string(obj.Severity), cvss, vulnType,
+		string(obj.Class), url,
+		strconv.FormatBool(obj.Confirmed), strconv.FormatBool(obj.False),
+		strconv.FormatBool(obj.Muted), strconv.FormatBool(obj.Resolved),
+		csvTime(obj.Created), csvTime(obj.LastSeen),
+		o.Scan.Hex(), o.ScanSession.Hex(), o.Plugin,
+	})
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
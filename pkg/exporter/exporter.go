@@ -0,0 +1,89 @@
+// Package exporter writes issues in formats of other tools, like spreadsheets and SARIF viewers.
+//
+// Issues are written one by one, so exports of large projects aren't kept in memory.
+// Every issue keeps its origin: the scan, the session and the plugin which reported it first.
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+// Format of exported issues
+type Format string
+
+const (
+	// one issue per line with a header, for spreadsheets
+	FormatCsv Format = "csv"
+	// SARIF 2.1.0 log with one run of bearded, for code scanning dashboards and SARIF viewers
+	FormatSarif Format = "sarif"
+)
+
+var formats = []interface{}{FormatCsv, FormatSarif}
+
+func (f Format) IsValid() bool {
+	for _, val := range formats {
+		if val.(Format) == f {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentType of the exported data
+func (f Format) ContentType() string {
+	if f == FormatSarif {
+		return "application/sarif+json"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Ext is the file extension of the exported data
+func (f Format) Ext() string {
+	if f == FormatSarif {
+		return "sarif"
+	}
+	return "csv"
+}
+
+// It's a hack to show custom type as string in swagger
+func (f Format) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(f))
+}
+
+func (f Format) Enum() []interface{} {
+	return formats
+}
+
+func (f Format) Convert(text string) (interface{}, error) {
+	return Format(text), nil
+}
+
+// Writer writes issues one by one, Close must be called to finish the document
+type Writer interface {
+	Write(*issue.TargetIssue) error
+	Close() error
+}
+
+// NewWriter returns the writer of issues in the format,
+// titles name csv columns in the language of the reader, columns are named by keys if titles are nil
+func NewWriter(format Format, w io.Writer, titles []string) (Writer, error) {
+	switch format {
+	case FormatCsv:
+		return newCsvWriter(w, titles)
+	case FormatSarif:
+		return newSarifWriter(w)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// origin of the issue, issues created by users don't have it
+func origin(obj *issue.TargetIssue) *issue.Report {
+	if obj.Origin != nil {
+		return obj.Origin
+	}
+	return &issue.Report{}
+}
@@ -0,0 +1,152 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/importer"
+)
+
+func testIssues() []*issue.TargetIssue {
+	reported := &issue.TargetIssue{
+		Id:      bson.NewObjectId(),
+		Target:  bson.NewObjectId(),
+		Project: bson.NewObjectId(),
+		Created: time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC),
+		Origin:  &issue.Report{Scan: bson.NewObjectId(), ScanSession: bson.NewObjectId(), Plugin: "barbudo/wpscan:0.1.2"},
+		Issue: issue.Issue{
+			UniqId:   "wpscan-xss",
+			Summary:  "Reflected XSS, in search",
+			Desc:     "The q parameter isn't encoded",
+			Severity: issue.SeverityHigh,
+			Cvss:     7.5,
+			Class:    issue.ClassXss,
+			Vector:   &issue.Vector{Url: "http://example.com/search?q=1"},
+		},
+	}
+	manual := &issue.TargetIssue{
+		Id:     bson.NewObjectId(),
+		Target: bson.NewObjectId(),
+		Issue:  issue.Issue{Summary: "Weak password policy", Severity: issue.SeverityLow},
+	}
+	manual.Confirmed = true
+	return []*issue.TargetIssue{reported, manual}
+}
+
+func export(t *testing.T, format Format, issues []*issue.TargetIssue) []byte {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(format, buf, nil)
+	require.NoError(t, err)
+	for _, obj := range issues {
+		require.NoError(t, w.Write(obj))
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestCsv(t *testing.T) {
+	issues := testIssues()
+	rows, err := csv.NewReader(bytes.NewReader(export(t, FormatCsv, issues))).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	require.Equal(t, csvHeader, rows[0])
+
+	row := map[string]string{}
+	for i, name := range csvHeader {
+		row[name] = rows[1][i]
+	}
+	require.Equal(t, issues[0].Id.Hex(), row["id"])
+	require.Equal(t, "Reflected XSS, in search", row["summary"])
+	require.Equal(t, "7.5", row["cvss"])
+	require.Equal(t, "http://example.com/search?q=1", row["url"])
+	require.Equal(t, "2015-03-01T10:00:00Z", row["created"])
+	require.Equal(t, issues[0].Origin.Scan.Hex(), row["scan"])
+	require.Equal(t, issues[0].Origin.ScanSession.Hex(), row["session"])
+	require.Equal(t, "barbudo/wpscan:0.1.2", row["plugin"])
+
+	// issues created by users don't have the origin
+	require.Equal(t, "true", rows[2][9])
+	require.Equal(t, []string{"", "", ""}, rows[2][15:])
+
+	// the empty export has only the header
+	rows, err = csv.NewReader(bytes.NewReader(export(t, FormatCsv, nil))).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+}
+
+func TestCsvTitles(t *testing.T) {
+	data, err := ioutil.ReadFile("../../extra/templates/ru/report/issues-csv-header.html")
+	require.NoError(t, err)
+	titles := Titles(string(data))
+	require.Len(t, titles, len(csvHeader), "the translation has every column")
+	require.Equal(t, "цель", titles[1])
+
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(FormatCsv, buf, titles)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	rows, err := csv.NewReader(buf).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, titles, rows[0])
+
+	require.Nil(t, Titles("id, target"), "titles which don't match columns aren't used")
+	require.Nil(t, Titles(""))
+}
+
+func TestSarif(t *testing.T) {
+	issues := testIssues()
+	data := export(t, FormatSarif, issues)
+
+	log := &struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct{ Name string }
+			}
+			Results []*sarifResult
+		}
+	}{}
+	require.NoError(t, json.Unmarshal(data, log))
+	require.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	require.Equal(t, "bearded", log.Runs[0].Tool.Driver.Name)
+	results := log.Runs[0].Results
+	require.Len(t, results, 2)
+	require.Equal(t, "class/xss", results[0].RuleId)
+	require.Equal(t, "error", results[0].Level)
+	require.Equal(t, "wpscan-xss", results[0].Fingerprints[sarifFingerprint])
+	require.Equal(t, "7.5", results[0].Properties["security-severity"])
+	require.Equal(t, issues[0].Origin.Scan.Hex(), results[0].Properties["scan"])
+	require.Equal(t, "barbudo/wpscan:0.1.2", results[0].Properties["plugin"])
+	require.Equal(t, "note", results[1].Level)
+	require.Nil(t, results[1].Properties["scan"])
+
+	// exported logs are read by the sarif import
+	runs, err := importer.Parse(scan.FormatSarif, data)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	require.Len(t, runs[0].Issues, 2)
+	require.Equal(t, 7.5, runs[0].Issues[0].Cvss)
+	require.Equal(t, "http://example.com/search?q=1", runs[0].Issues[0].Vector.Url)
+
+	data = export(t, FormatSarif, nil)
+	require.NoError(t, json.Unmarshal(data, log))
+	require.Empty(t, log.Runs[0].Results)
+}
+
+func TestSarifLevel(t *testing.T) {
+	require.Equal(t, "error", sarifLevel(issue.SeverityHigh))
+	require.Equal(t, "warning", sarifLevel(issue.SeverityMedium))
+	require.Equal(t, "note", sarifLevel(issue.SeverityLow))
+	require.Equal(t, "none", sarifLevel(issue.SeverityInfo))
+	require.Equal(t, "none", sarifLevel(issue.SeverityError))
+}
@@ -0,0 +1,153 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	sarifTool    = "bearded"
+	sarifToolUri = "https://github.com/bearded-web/bearded"
+	// uniq ids of issues are stable between scans, so they are fingerprints of results
+	sarifFingerprint = "bearded/uniqId/v1"
+)
+
+// results are streamed between the header and the footer, so the whole log isn't kept in memory
+var (
+	sarifHeader = fmt.Sprintf(`{"$schema":%q,"version":%q,"runs":[{"tool":{"driver":{"name":%q,"informationUri":%q}},"results":[`,
+		sarifSchema, sarifVersion, sarifTool, sarifToolUri)
+	sarifFooter = "]}]}\n"
+)
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			Uri string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+type sarifResult struct {
+	RuleId       string                 `json:"ruleId"`
+	Level        string                 `json:"level"`
+	Message      sarifMessage           `json:"message"`
+	Locations    []*sarifLocation       `json:"locations,omitempty"`
+	Fingerprints map[string]string      `json:"fingerprints,omitempty"`
+	Properties   map[string]interface{} `json:"properties"`
+}
+
+type sarifWriter struct {
+	w     io.Writer
+	count int
+}
+
+func newSarifWriter(w io.Writer) (*sarifWriter, error) {
+	if _, err := io.WriteString(w, sarifHeader); err != nil {
+		return nil, err
+	}
+	return &sarifWriter{w: w}, nil
+}
+
+func (w *sarifWriter) Write(obj *issue.TargetIssue) error {
+	data, err := json.Marshal(sarifIssue(obj))
+	if err != nil {
+		return err
+	}
+	if w.count > 0 {
+		if _, err := io.WriteString(w.w, ","); err != nil {
+			return err
+		}
+	}
+	w.count++
+	_, err = w.w.Write(data)
+	return err
+}
+
+func (w *sarifWriter) Close() error {
+	_, err := io.WriteString(w.w, sarifFooter)
+	return err
+}
+
+func sarifIssue(obj *issue.TargetIssue) *sarifResult {
+	res := &sarifResult{
+		RuleId:  sarifRule(obj),
+		Level:   sarifLevel(obj.Severity),
+		Message: sarifMessage{Text: obj.Summary},
+	}
+	if obj.Desc != "" {
+		res.Message.Text = obj.Summary + "\n\n" + obj.Desc
+	}
+	if obj.Vector != nil && obj.Vector.Url != "" {
+		loc := &sarifLocation{}
+		loc.PhysicalLocation.ArtifactLocation.Uri = obj.Vector.Url
+		res.Locations = []*sarifLocation{loc}
+	}
+	if obj.UniqId != "" {
+		res.Fingerprints = map[string]string{sarifFingerprint: obj.UniqId}
+	}
+	o := origin(obj)
+	props := map[string]interface{}{
+		"issue":    obj.Id.Hex(),
+		"target":   obj.Target.Hex(),
+		"project":  obj.Project.Hex(),
+		"severity": obj.Severity,
+	}
+	if obj.Cvss > 0 {
+		// the cvss score as a string like github code scanning reads it
+		props["security-severity"] = strconv.FormatFloat(obj.Cvss, 'f', 1, 64)
+	}
+	if o.Scan != "" {
+		props["scan"] = o.Scan.Hex()
+	}
+	if o.ScanSession != "" {
+		props["session"] = o.ScanSession.Hex()
+	}
+	if o.Plugin != "" {
+		props["plugin"] = o.Plugin
+	}
+	if len(obj.Tags) > 0 {
+		props["tags"] = obj.Tags
+	}
+	res.Properties = props
+	return res
+}
+
+// issues of the same vulndb type or class are results of the same rule
+func sarifRule(obj *issue.TargetIssue) string {
+	switch {
+	case obj.VulnType != 0:
+		return fmt.Sprintf("vulndb/%d", obj.VulnType)
+	case obj.Class != "":
+		return fmt.Sprintf("class/%s", obj.Class)
+	}
+	return obj.Summary
+}
+
+// levels are taken from the min cvss of the severity, so custom schemes are mapped like the default one
+func sarifLevel(sev issue.Severity) string {
+	for _, level := range issue.GetScheme() {
+		if level.Name != sev {
+			continue
+		}
+		switch {
+		case level.MinCvss >= 7:
+			return "error"
+		case level.MinCvss >= 4:
+			return "warning"
+		case level.MinCvss > 0:
+			return "note"
+		}
+		return "none"
+	}
+	return "none"
+}
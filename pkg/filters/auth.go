@@ -1,6 +1,7 @@
 package filters
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -8,6 +9,8 @@ import (
 	"github.com/emicklei/go-restful"
 	"github.com/facebookgo/stackerr"
 
+	"github.com/bearded-web/bearded/models/audit"
+	"github.com/bearded-web/bearded/models/token"
 	"github.com/bearded-web/bearded/models/user"
 	"github.com/bearded-web/bearded/pkg/manager"
 	"github.com/bearded-web/bearded/services"
@@ -16,44 +19,127 @@ import (
 const (
 	SessionUserKey = "__user"
 	AttrUserKey    = "__user"
+
+	// id of the admin who impersonates the session user
+	SessionImpersonatorKey = "__impersonator"
+	AttrImpersonatorKey    = "__impersonator"
+
+	// api token of the request user
+	AttrTokenKey = "__token"
 )
 
-func AuthRequiredFilter(mgr *manager.Manager) restful.FilterFunction {
+// AuthRequiredFilter rejects requests of anonymous users, checks are called for authenticated users in order
+func AuthRequiredFilter(mgr *manager.Manager, checks ...services.AuthCheck) restful.FilterFunction {
 	// TODO (m0sth8): It's not a good solution to make db request on every http request. Fix it.
 	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
-		if req.Attribute(AttrUserKey) != nil {
+		if u, ok := req.Attribute(AttrUserKey).(*user.User); ok {
 			// user is already set in attributes
+			services.SetScope(req, mgr.ScopeFor(u))
+			if !authorized(req, resp, u, checks) {
+				return
+			}
 			chain.ProcessFilter(req, resp)
 			return
 		}
 		session := GetSession(req)
 		userId, existed := session.Get(SessionUserKey)
 		if !existed {
-			resp.WriteServiceError(http.StatusUnauthorized, services.AuthReqErr)
+			services.WriteError(resp, http.StatusUnauthorized, services.AuthReqErr)
 			return
 		}
 		mgrCopy := mgr.Copy()
 		defer mgrCopy.Close() // if something goes wrong
 		user, err := mgr.Users.GetById(mgr.ToId(userId))
-		mgrCopy.Close() // manually close manager here, because defer will be triggered too late
-
 		if err != nil {
+			mgrCopy.Close()
 			if mgr.IsNotFound(err) {
 				// it seems like this user was deleted, so logout him forcibly
 				session.Del(SessionUserKey)
-				resp.WriteServiceError(http.StatusUnauthorized, services.AuthReqErr)
+				services.WriteError(resp, http.StatusUnauthorized, services.AuthReqErr)
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		impersonator, err := getImpersonator(mgrCopy, session)
+		mgrCopy.Close() // manually close manager here, because defer will be triggered too late
+		if err != nil {
+			if err == errImpersonationEnded {
+				services.WriteError(resp, http.StatusUnauthorized, services.AuthReqErr)
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 		// save user to restful attributes
 		req.SetAttribute(AttrUserKey, user)
+		services.SetScope(req, mgr.ScopeFor(user))
+		if impersonator != nil {
+			req.SetAttribute(AttrImpersonatorKey, impersonator)
+			auditImpersonated(mgr, req, impersonator, user)
+		}
+		if !authorized(req, resp, user, checks) {
+			return
+		}
 		chain.ProcessFilter(req, resp)
 	}
 }
 
+func authorized(req *restful.Request, resp *restful.Response, u *user.User, checks []services.AuthCheck) bool {
+	for _, check := range checks {
+		if !check(req, resp, u) {
+			return false
+		}
+	}
+	return true
+}
+
+var errImpersonationEnded = errors.New("impersonation is ended")
+
+// Get the admin who impersonates the session user, nil if the session isn't impersonated.
+// The session is logged out when the admin is deleted or loses admin permission.
+func getImpersonator(mgr *manager.Manager, session *Session) (*user.User, error) {
+	adminId, existed := session.Get(SessionImpersonatorKey)
+	if !existed {
+		return nil, nil
+	}
+	admin, err := mgr.Users.GetById(mgr.ToId(adminId))
+	if err != nil && !mgr.IsNotFound(err) {
+		return nil, err
+	}
+	if err != nil || !mgr.Permission.IsAdmin(admin) {
+		logrus.Warnf("Impersonation by %s is ended, admin isn't found or lost permission", adminId)
+		session.Del(SessionImpersonatorKey)
+		session.Del(SessionUserKey)
+		return nil, errImpersonationEnded
+	}
+	return admin, nil
+}
+
+// Every request of the impersonated session is logged with the real admin,
+// changes are also recorded to the audit log
+func auditImpersonated(mgr *manager.Manager, req *restful.Request, admin, u *user.User) {
+	request := fmt.Sprintf("%s %s", req.Request.Method, req.Request.URL.Path)
+	logrus.Infof("Impersonated request %s by admin %s as user %s", request, admin, u)
+	if isSafeMethod(req.Request.Method) {
+		return
+	}
+	mgrCopy := mgr.Copy()
+	defer mgrCopy.Close()
+	ev := &audit.Event{
+		Type:    audit.TypeImpersonatedRequest,
+		Actor:   admin.Id,
+		User:    u.Id,
+		Request: request,
+		Message: fmt.Sprintf("Admin %s made request %s as user %s", admin.Email, request, u.Email),
+	}
+	if _, err := mgrCopy.Audit.Create(ev); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+}
+
 // Get user from restful.Request attribute or panic
 func GetUser(req *restful.Request) *user.User {
 	raw := req.Attribute(AttrUserKey)
@@ -66,3 +152,25 @@ func GetUser(req *restful.Request) *user.User {
 	}
 	return u
 }
+
+// Get the api token of the request, nil if the user isn't authenticated by a token
+func GetToken(req *restful.Request) *token.Token {
+	tkn, _ := req.Attribute(AttrTokenKey).(*token.Token)
+	return tkn
+}
+
+// Get the admin who impersonates the current user, nil if the request isn't impersonated
+func GetImpersonator(req *restful.Request) *user.User {
+	u, _ := req.Attribute(AttrImpersonatorKey).(*user.User)
+	return u
+}
+
+// ForbidImpersonated rejects changes of the account, like the password, settings and api tokens,
+// in impersonated sessions: admins help users with impersonation, but they shouldn't take over accounts
+func ForbidImpersonated(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	if GetImpersonator(req) != nil {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+	chain.ProcessFilter(req, resp)
+}
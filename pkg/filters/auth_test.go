@@ -0,0 +1,51 @@
+package filters
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/models/user"
+)
+
+func TestForbidImpersonated(t *testing.T) {
+	var impersonator *user.User
+	container := restful.NewContainer()
+	ws := &restful.WebService{}
+	ws.Path("/test").Produces(restful.MIME_JSON)
+	ws.Filter(func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		if impersonator != nil {
+			req.SetAttribute(AttrImpersonatorKey, impersonator)
+		}
+		chain.ProcessFilter(req, resp)
+	})
+	ws.Route(ws.PUT("settings").Filter(ForbidImpersonated).To(func(req *restful.Request, resp *restful.Response) {
+		resp.WriteHeader(http.StatusNoContent)
+	}))
+	container.Add(ws)
+
+	put := func() int {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("PUT", "/test/settings", nil)
+		require.NoError(t, err)
+		container.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	require.Equal(t, http.StatusNoContent, put())
+	impersonator = &user.User{Email: "admin@example.com"}
+	require.Equal(t, http.StatusForbidden, put())
+}
+
+func TestClientIp(t *testing.T) {
+	for addr, ip := range map[string]string{
+		"10.0.0.1:1234": "10.0.0.1",
+		"[::1]:1234":    "::1",
+		"10.0.0.1":      "10.0.0.1",
+		"@unix-socket":  "@unix-socket",
+	} {
+		require.Equal(t, ip, ClientIp(&http.Request{RemoteAddr: addr}), addr)
+	}
+}
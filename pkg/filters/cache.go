@@ -0,0 +1,71 @@
+package filters
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+
+	"github.com/bearded-web/bearded/services"
+)
+
+// CacheFilter sets the default Cache-Control header of api responses, routes mark cacheable reads
+// with services.CacheFor. Errors and responses of other methods get the default header too,
+// so they aren't cached even if the route is cacheable. Empty default doesn't change responses.
+func CacheFilter(def string) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		if def != "" {
+			method := req.Request.Method
+			resp.ResponseWriter = &cacheWriter{
+				ResponseWriter: resp.ResponseWriter,
+				def:            def,
+				read:           method == "GET" || method == "HEAD",
+			}
+		}
+		chain.ProcessFilter(req, resp)
+	}
+}
+
+type cacheWriter struct {
+	http.ResponseWriter
+	def   string
+	read  bool
+	wrote bool
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.wrote = true
+		cacheable := w.read && (code == http.StatusOK || code == http.StatusNotModified)
+		if !cacheable || w.Header().Get(services.CacheControlHeader) == "" {
+			w.Header().Set(services.CacheControlHeader, w.def)
+			w.Header().Del(services.ExpiresHeader)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// the status is implicit if the handler writes the body at once
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *cacheWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// agent channels upgrade the connection to websocket
+func (w *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer doesn't support hijacking")
+	}
+	return hijacker.Hijack()
+}
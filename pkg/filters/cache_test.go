@@ -0,0 +1,50 @@
+package filters
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/services"
+)
+
+func TestCacheFilter(t *testing.T) {
+	ok := func(req *restful.Request, resp *restful.Response) {
+		resp.WriteEntity(map[string]string{"name": "w3af"})
+	}
+	missed := func(req *restful.Request, resp *restful.Response) {
+		services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+	}
+	container := restful.NewContainer()
+	container.Filter(CacheFilter("no-store"))
+	ws := &restful.WebService{}
+	ws.Path("/test").Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("user").To(ok))
+	ws.Route(ws.GET("plugin").Filter(services.CacheFor(60, false)).To(ok))
+	ws.Route(ws.GET("vuln").Filter(services.CacheFor(3600, true)).To(ok))
+	ws.Route(ws.GET("missed").Filter(services.CacheFor(3600, true)).To(missed))
+	ws.Route(ws.POST("plugin").Filter(services.CacheFor(60, false)).To(ok))
+	ws.Route(ws.GET("disabled").Filter(services.CacheFor(0, true)).To(ok))
+	container.Add(ws)
+
+	do := func(method, path string) http.Header {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(method, path, nil)
+		require.NoError(t, err)
+		container.ServeHTTP(rec, req)
+		return rec.Header()
+	}
+	require.Equal(t, "no-store", do("GET", "/test/user").Get("Cache-Control"))
+	h := do("GET", "/test/plugin")
+	require.Equal(t, "private, max-age=60", h.Get("Cache-Control"))
+	require.NotEmpty(t, h.Get("Expires"))
+	require.Equal(t, "public, max-age=3600", do("GET", "/test/vuln").Get("Cache-Control"))
+	h = do("GET", "/test/missed")
+	require.Equal(t, "no-store", h.Get("Cache-Control"))
+	require.Empty(t, h.Get("Expires"))
+	require.Equal(t, "no-store", do("POST", "/test/plugin").Get("Cache-Control"))
+	require.Equal(t, "no-store", do("GET", "/test/disabled").Get("Cache-Control"))
+}
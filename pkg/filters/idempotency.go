@@ -0,0 +1,176 @@
+package filters
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/idempotency"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/services"
+)
+
+const (
+	IdempotencyHeader       = "Idempotency-Key"
+	IdempotencyReplayHeader = "Idempotent-Replayed"
+	IdempotencyKeyMaxLength = 256
+)
+
+var (
+	IdempotencyInProgressErr = services.NewError(services.CodeDuplicate,
+		"request with this idempotency key is in progress")
+	IdempotencyMismatchErr = services.NewError(services.CodeWrongData,
+		"idempotency key was used for another request")
+)
+
+// IdempotencyParam describes the header for swagger
+func IdempotencyParam(ws *restful.WebService) *restful.Parameter {
+	return ws.HeaderParameter(IdempotencyHeader,
+		"unique key to safely retry the request, the original response is returned on replay")
+}
+
+// IdempotencyFilter stores successful responses for requests with Idempotency-Key header
+// and returns the stored response when the same user repeats the request with the same key.
+// Keys are expired after ManagerConfig.IdempotencyExpire, expired keys and keys of requests which are pending
+// longer than manager.IdempotencyPendingTimeout are taken again. The filter must be used after auth filters.
+func IdempotencyFilter(mgr *manager.Manager) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		key := req.HeaderParameter(IdempotencyHeader)
+		if key == "" {
+			chain.ProcessFilter(req, resp)
+			return
+		}
+		if len(key) > IdempotencyKeyMaxLength {
+			services.WriteError(resp, http.StatusBadRequest,
+				services.NewBadReq("%s header is too long", IdempotencyHeader))
+			return
+		}
+		u := GetUser(req)
+		scope := fmt.Sprintf("%s %s", req.Request.Method, req.Request.URL.Path)
+
+		mgrCopy := mgr.Copy()
+		defer mgrCopy.Close()
+
+		rec, existed, err := takeIdempotencyKey(mgrCopy, &idempotency.Record{
+			User:  u.Id,
+			Key:   key,
+			Scope: scope,
+		})
+		if err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		if existed != nil {
+			replayIdempotent(resp, existed, scope)
+			return
+		}
+
+		finished := false
+		defer func() {
+			// the key is released if the handler panics, so the request could be retried
+			if finished {
+				return
+			}
+			if err := mgrCopy.Idempotency.Remove(rec); err != nil {
+				logrus.Error(stackerr.Wrap(err))
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: resp.ResponseWriter}
+		resp.ResponseWriter = recorder
+		chain.ProcessFilter(req, resp)
+		resp.ResponseWriter = recorder.ResponseWriter
+		finished = true
+
+		// only successful responses are saved, so failed requests could be retried with the same key
+		if recorder.status < http.StatusOK || recorder.status >= http.StatusMultipleChoices {
+			if err := mgrCopy.Idempotency.Remove(rec); err != nil {
+				logrus.Error(stackerr.Wrap(err))
+			}
+			return
+		}
+		rec.Status = recorder.status
+		rec.Header = http.Header{}
+		if contentType := recorder.Header().Get("Content-Type"); contentType != "" {
+			rec.Header.Set("Content-Type", contentType)
+		}
+		rec.Body = recorder.body.Bytes()
+		if err := mgrCopy.Idempotency.Complete(rec); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		}
+	}
+}
+
+// takeIdempotencyKey creates the pending record, the existed record is returned if the key is already taken.
+// Stale records are treated as absent, they are removed and the key is taken again.
+func takeIdempotencyKey(mgr *manager.Manager, raw *idempotency.Record) (*idempotency.Record, *idempotency.Record, error) {
+	for i := 0; ; i++ {
+		rec, err := mgr.Idempotency.Create(raw)
+		if err == nil {
+			return rec, nil, nil
+		}
+		if !mgr.IsDup(err) {
+			return nil, nil, err
+		}
+		existed, err := mgr.Idempotency.GetByKey(raw.User, raw.Key)
+		if err != nil {
+			if mgr.IsNotFound(err) && i == 0 {
+				// the concurrent request has failed and released the key
+				continue
+			}
+			return nil, nil, err
+		}
+		if i > 0 || !mgr.Idempotency.IsStale(existed) {
+			return nil, existed, nil
+		}
+		if err := mgr.Idempotency.RemoveStale(existed); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+func replayIdempotent(resp *restful.Response, rec *idempotency.Record, scope string) {
+	if rec.Scope != scope {
+		services.WriteError(resp, http.StatusBadRequest, IdempotencyMismatchErr)
+		return
+	}
+	if !rec.Completed {
+		services.WriteError(resp, http.StatusConflict, IdempotencyInProgressErr)
+		return
+	}
+	for k, values := range rec.Header {
+		for _, v := range values {
+			resp.AddHeader(k, v)
+		}
+	}
+	resp.AddHeader(IdempotencyReplayHeader, "true")
+	resp.WriteHeader(rec.Status)
+	resp.Write(rec.Body)
+}
+
+// responseRecorder copies status and body which are written to the underlying writer
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,170 @@
+package filters
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/models/idempotency"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+type idempotencyServer struct {
+	*httptest.Server
+	calls   int32
+	release chan struct{}
+}
+
+// the handler blocks until the release if the block query is set, it fails if the fail query is set
+func newIdempotencyServer(t *testing.T, u *user.User) *idempotencyServer {
+	s := &idempotencyServer{release: make(chan struct{})}
+	ws := new(restful.WebService)
+	handler := func(req *restful.Request, resp *restful.Response) {
+		n := atomic.AddInt32(&s.calls, 1)
+		if req.QueryParameter("block") != "" {
+			<-s.release
+		}
+		if req.QueryParameter("fail") != "" {
+			resp.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if req.QueryParameter("panic") != "" {
+			panic("handler panic")
+		}
+		resp.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(resp, "call %d", n)
+	}
+	for _, path := range []string{"/items", "/other"} {
+		ws.Route(ws.POST(path).To(handler).Filter(IdempotencyFilter(testMgr)))
+	}
+	container := restful.NewContainer()
+	container.Filter(func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		req.SetAttribute(AttrUserKey, u)
+		chain.ProcessFilter(req, resp)
+	})
+	container.Add(ws)
+	s.Server = httptest.NewServer(container)
+	return s
+}
+
+func (s *idempotencyServer) post(t *testing.T, path, key string) (*http.Response, string) {
+	req, err := http.NewRequest("POST", s.URL+path, nil)
+	require.NoError(t, err)
+	req.Header.Set(IdempotencyHeader, key)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func idempotencyUser(t *testing.T) *user.User {
+	logrus.SetLevel(logrus.FatalLevel)
+	require.NoError(t, testMgr.Idempotency.Init())
+	u, err := testMgr.Users.Create(&user.User{})
+	require.NoError(t, err)
+	return u
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	s := newIdempotencyServer(t, idempotencyUser(t))
+	defer s.Close()
+
+	resp, body := s.post(t, "/items", "replay")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "call 1", body)
+	require.Empty(t, resp.Header.Get(IdempotencyReplayHeader))
+
+	resp, body = s.post(t, "/items", "replay")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "call 1", body)
+	require.Equal(t, "true", resp.Header.Get(IdempotencyReplayHeader))
+	require.Equal(t, int32(1), atomic.LoadInt32(&s.calls))
+
+	// the key is bound to the method and path
+	resp, body = s.post(t, "/other", "replay")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, body, "another request")
+	require.Equal(t, int32(1), atomic.LoadInt32(&s.calls))
+
+	// without the key requests aren't replayed
+	resp, body = s.post(t, "/items", "")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "call 2", body)
+
+	resp, _ = s.post(t, "/items", strings.Repeat("k", IdempotencyKeyMaxLength+1))
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestIdempotencyConcurrent(t *testing.T) {
+	s := newIdempotencyServer(t, idempotencyUser(t))
+	defer s.Close()
+
+	done := make(chan string)
+	go func() {
+		_, body := s.post(t, "/items?block=1", "concurrent")
+		done <- body
+	}()
+	for atomic.LoadInt32(&s.calls) == 0 {
+		time.Sleep(time.Millisecond * 10)
+	}
+	resp, _ := s.post(t, "/items", "concurrent")
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	close(s.release)
+	require.Equal(t, "call 1", <-done)
+	resp, body := s.post(t, "/items", "concurrent")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "call 1", body)
+	require.Equal(t, int32(1), atomic.LoadInt32(&s.calls))
+}
+
+func TestIdempotencyRelease(t *testing.T) {
+	u := idempotencyUser(t)
+	s := newIdempotencyServer(t, u)
+	defer s.Close()
+
+	// failed and panicked requests release the key
+	resp, _ := s.post(t, "/items?fail=1", "failed")
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	resp, body := s.post(t, "/items", "failed")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "call 2", body)
+
+	resp, _ = s.post(t, "/items?panic=1", "panicked")
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	_, err := testMgr.Idempotency.GetByKey(u.Id, "panicked")
+	require.True(t, testMgr.IsNotFound(err))
+
+	// expired records and abandoned pending records are treated as absent
+	old := time.Now().UTC().Add(-manager.DefaultIdempotencyExpire - time.Minute)
+	_, err = testMgr.Idempotency.Create(&idempotency.Record{User: u.Id, Key: "expired", Scope: "POST /items"})
+	require.NoError(t, err)
+	rec, err := testMgr.Idempotency.GetByKey(u.Id, "expired")
+	require.NoError(t, err)
+	rec.Created = old
+	rec.Body = []byte("expired")
+	rec.Status = http.StatusCreated
+	require.NoError(t, testMgr.Idempotency.Complete(rec))
+	before := atomic.LoadInt32(&s.calls)
+	resp, body = s.post(t, "/items", "expired")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, fmt.Sprintf("call %d", before+1), body)
+
+	pending, err := testMgr.Idempotency.Create(&idempotency.Record{User: u.Id, Key: "pending", Scope: "POST /items"})
+	require.NoError(t, err)
+	require.False(t, testMgr.Idempotency.IsStale(pending))
+	pending.Updated = time.Now().UTC().Add(-manager.IdempotencyPendingTimeout - time.Minute)
+	require.True(t, testMgr.Idempotency.IsStale(pending))
+}
@@ -0,0 +1,27 @@
+package filters
+
+import (
+	"github.com/emicklei/go-restful"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/quota"
+	"github.com/bearded-web/bearded/services"
+)
+
+// QuotaCheck counts requests of authenticated users in the tracker, it's added to auth checks of services.
+// Requests with api tokens are counted for the tokens too, the error is written if the user is over the requests quota.
+func QuotaCheck(t *quota.Tracker) services.AuthCheck {
+	return func(req *restful.Request, resp *restful.Response, u *user.User) bool {
+		tokenId := bson.ObjectId("")
+		if tkn := GetToken(req); tkn != nil {
+			tokenId = tkn.Id
+		}
+		ex := t.Request(u, tokenId)
+		if ex == nil {
+			return true
+		}
+		services.WriteError(resp, services.StatusTooManyRequests, services.NewError(services.CodeOverQuota, ex.Error()))
+		return false
+	}
+}
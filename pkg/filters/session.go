@@ -3,9 +3,9 @@ package filters
 import (
 	"fmt"
 	"net/http"
-	"time"
-
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/negroni"
@@ -67,8 +67,63 @@ type CookieOpts struct {
 	MaxAge   int
 	Secure   bool
 	HttpOnly bool
+	// one of SameSite constants, the attribute isn't set if empty
+	SameSite string
+}
+
+const (
+	SameSiteLax    = "Lax"
+	SameSiteStrict = "Strict"
+	SameSiteNone   = "None"
+)
+
+// Validate the same site mode, browsers reject SameSite=None cookies without Secure
+func (o *CookieOpts) Validate() error {
+	switch o.SameSite {
+	case "", SameSiteLax, SameSiteStrict:
+	case SameSiteNone:
+		if !o.Secure {
+			return fmt.Errorf("SameSite=None requires secure cookie")
+		}
+	default:
+		return fmt.Errorf("SameSite should be one of [%s|%s|%s], got %q", SameSiteLax, SameSiteStrict, SameSiteNone, o.SameSite)
+	}
+	return nil
+}
+
+// SameSiteMode returns the canonical mode for the config value in any case, unknown values are kept
+func SameSiteMode(mode string) string {
+	for _, m := range []string{SameSiteLax, SameSiteStrict, SameSiteNone} {
+		if strings.EqualFold(mode, m) {
+			return m
+		}
+	}
+	return mode
+}
+
+// ValidateKeyPairs checks keys of the session cookie: hash and block keys go in pairs,
+// block keys are used for AES and should be 16, 24 or 32 bytes long
+func ValidateKeyPairs(keyPairs ...string) error {
+	if len(keyPairs) == 0 {
+		return fmt.Errorf("at least one key is required")
+	}
+	for i, key := range keyPairs {
+		if key == "" {
+			return fmt.Errorf("key %d is empty", i)
+		}
+		if i%2 == 1 {
+			if l := len(key); l != 16 && l != 24 && l != 32 {
+				return fmt.Errorf("block key %d should be 16, 24 or 32 bytes long, got %d", i, l)
+			}
+		}
+	}
+	return nil
 }
 
+// SessionCookieFilter stores the session in the signed and encrypted cookie.
+// Key pairs are ordered: the first pair signs new cookies, the rest are only used to decode,
+// so the keys can be rotated by prepending a new pair. Cookies decoded with an old pair
+// are signed with the first one in the response, so the old pair can be removed later.
 func SessionCookieFilter(cookieName string, opts *CookieOpts, keyPairs ...string) restful.FilterFunction {
 	keyPairsBytes := [][]byte{}
 	for _, key := range keyPairs {
@@ -80,8 +135,10 @@ func SessionCookieFilter(cookieName string, opts *CookieOpts, keyPairs ...string
 
 		session := NewSession()
 		if cookie, err := req.Request.Cookie(cookieName); err == nil {
-			if err = securecookie.DecodeMulti(cookieName, cookie.Value, &session.store, codecs...); err == nil {
-
+			if i, err := decodeSession(cookieName, cookie.Value, session, codecs); err == nil {
+				if i > 0 {
+					session.modified = true
+				}
 			} else {
 				logrus.Warn(err)
 			}
@@ -98,8 +155,7 @@ func SessionCookieFilter(cookieName string, opts *CookieOpts, keyPairs ...string
 				return
 			}
 			if encoded, err := securecookie.EncodeMulti(cookieName, session.store, codecs...); err == nil {
-				cookie := NewCookie(cookieName, encoded, opts)
-				http.SetCookie(rw, cookie)
+				SetCookie(rw, NewCookie(cookieName, encoded, opts), opts)
 			}
 		})
 
@@ -107,6 +163,20 @@ func SessionCookieFilter(cookieName string, opts *CookieOpts, keyPairs ...string
 	}
 }
 
+// decodeSession returns the index of the codec which decoded the cookie
+func decodeSession(name, value string, session *Session, codecs []securecookie.Codec) (int, error) {
+	var err error
+	for i, codec := range codecs {
+		if err = codec.Decode(name, value, &session.store); err == nil {
+			return i, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("no codecs for the session cookie")
+	}
+	return -1, err
+}
+
 func SessionFilterMock(session *Session) restful.FilterFunction {
 	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
 		req.SetAttribute(AttrSessionKey, session)
@@ -127,6 +197,18 @@ func GetSession(req *restful.Request) *Session {
 	return session
 }
 
+// SetCookie adds Set-Cookie header like http.SetCookie, http.Cookie doesn't support SameSite attribute
+func SetCookie(w http.ResponseWriter, cookie *http.Cookie, options *CookieOpts) {
+	value := cookie.String()
+	if value == "" {
+		return
+	}
+	if options != nil && options.SameSite != "" {
+		value += "; SameSite=" + options.SameSite
+	}
+	w.Header().Add("Set-Cookie", value)
+}
+
 // NewCookie returns an http.Cookie with the options set. It also sets
 // the Expires field calculated based on the MaxAge value, for Internet
 // Explorer compatibility.
@@ -0,0 +1,59 @@
+package filters
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCookieOptsValidate(t *testing.T) {
+	require.NoError(t, (&CookieOpts{}).Validate())
+	require.NoError(t, (&CookieOpts{SameSite: SameSiteStrict}).Validate())
+	require.NoError(t, (&CookieOpts{SameSite: SameSiteNone, Secure: true}).Validate())
+	require.Error(t, (&CookieOpts{SameSite: SameSiteNone}).Validate())
+	require.Error(t, (&CookieOpts{SameSite: "loose"}).Validate())
+	require.Equal(t, SameSiteNone, SameSiteMode("none"))
+}
+
+func TestSetCookie(t *testing.T) {
+	opts := &CookieOpts{Path: "/api/", Domain: "example.com", MaxAge: 60, Secure: true, HttpOnly: true, SameSite: SameSiteNone}
+	rec := httptest.NewRecorder()
+	SetCookie(rec, NewCookie("sss", "value", opts), opts)
+	header := rec.Header().Get("Set-Cookie")
+	require.Contains(t, header, "sss=value")
+	require.Contains(t, header, "Domain=example.com")
+	require.Contains(t, header, "Max-Age=60")
+	require.Contains(t, header, "Secure")
+	require.Contains(t, header, "; SameSite=None")
+
+	rec = httptest.NewRecorder()
+	SetCookie(rec, NewCookie("sss", "value", nil), nil)
+	require.NotContains(t, rec.Header().Get("Set-Cookie"), "SameSite")
+}
+
+func TestValidateKeyPairs(t *testing.T) {
+	require.NoError(t, ValidateKeyPairs("hash", "0123456789abcdef"))
+	require.NoError(t, ValidateKeyPairs("hash", "0123456789abcdef", "old-hash"))
+	require.Error(t, ValidateKeyPairs())
+	require.Error(t, ValidateKeyPairs("hash", "short"))
+	require.Error(t, ValidateKeyPairs("", "0123456789abcdef"))
+}
+
+func TestDecodeSessionRotated(t *testing.T) {
+	oldKeys := [][]byte{[]byte("old-hash"), []byte("0123456789abcdef")}
+	newKeys := [][]byte{[]byte("new-hash"), []byte("fedcba9876543210")}
+	encoded, err := securecookie.EncodeMulti("sss", map[string]string{"user": "1"}, securecookie.CodecsFromPairs(oldKeys...)...)
+	require.NoError(t, err)
+
+	session := NewSession()
+	i, err := decodeSession("sss", encoded, session, securecookie.CodecsFromPairs(append(newKeys, oldKeys...)...))
+	require.NoError(t, err)
+	require.Equal(t, 1, i)
+	val, _ := session.Get("user")
+	require.Equal(t, "1", val)
+
+	_, err = decodeSession("sss", encoded, NewSession(), securecookie.CodecsFromPairs(newKeys...))
+	require.Error(t, err)
+}
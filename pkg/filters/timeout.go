@@ -0,0 +1,85 @@
+package filters
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"golang.org/x/net/context"
+
+	"github.com/bearded-web/bearded/services"
+)
+
+// TimeoutFilter sets the deadline for every request, routes could override it with services.Timeout.
+// Db operations fail after the deadline, so server errors of such requests are replaced
+// with 503 status and timeout error.
+func TimeoutFilter(timeout time.Duration) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		// db operations of the request are aborted when the client is gone
+		parent, disconnect := context.WithCancel(context.Background())
+		defer disconnect()
+		if notifier, ok := resp.ResponseWriter.(http.CloseNotifier); ok {
+			closed := notifier.CloseNotify()
+			go func() {
+				select {
+				case <-closed:
+					disconnect()
+				case <-parent.Done():
+				}
+			}()
+		}
+		cancel := services.StartTimeout(req, parent, timeout)
+		defer cancel()
+
+		resp.ResponseWriter = &timeoutWriter{ResponseWriter: resp.ResponseWriter, req: req}
+		chain.ProcessFilter(req, resp)
+	}
+}
+
+type timeoutWriter struct {
+	http.ResponseWriter
+	req      *restful.Request
+	timedOut bool
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if code >= http.StatusInternalServerError && services.IsTimeout(w.req) {
+		w.timedOut = true
+		w.Header().Set("Content-Type", restful.MIME_JSON)
+		w.Header().Set("Retry-After", "1")
+		w.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+		data, _ := json.Marshal(services.TimeoutErr)
+		w.ResponseWriter.Write(data)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// body of the original error is dropped after timeout
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if w.timedOut {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// streaming endpoints use flusher of the original writer,
+// they should wait for services.Context instead of close notifier which is used by the filter
+func (w *timeoutWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// agent channels upgrade the connection to websocket
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer doesn't support hijacking")
+	}
+	return hijacker.Hijack()
+}
@@ -0,0 +1,53 @@
+package filters
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/services"
+)
+
+func TestTimeoutFilter(t *testing.T) {
+	slow := func(req *restful.Request, resp *restful.Response) {
+		<-services.Context(req).Done()
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+	}
+	failed := func(req *restful.Request, resp *restful.Response) {
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+	}
+	container := restful.NewContainer()
+	container.Filter(TimeoutFilter(time.Millisecond * 10))
+	ws := &restful.WebService{}
+	ws.Path("/test").Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("slow").To(slow))
+	ws.Route(ws.GET("failed").To(failed))
+	ws.Route(ws.GET("long").Filter(services.Timeout(time.Millisecond * 50)).To(slow))
+	container.Add(ws)
+
+	get := func(path string) (*httptest.ResponseRecorder, time.Duration) {
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		container.ServeHTTP(rec, req)
+		return rec, time.Now().Sub(start)
+	}
+
+	rec, _ := get("/test/slow")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Contains(t, rec.Body.String(), string(services.ErrTimeout))
+
+	// errors before the deadline are kept
+	rec, _ = get("/test/failed")
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Contains(t, rec.Body.String(), string(services.ErrDb))
+
+	rec, took := get("/test/long")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.True(t, took >= time.Millisecond*50, "route timeout should override the default one")
+}
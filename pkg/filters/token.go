@@ -1,21 +1,26 @@
 package filters
 
 import (
+	"net"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/bearded-web/bearded/models/token"
 	"github.com/bearded-web/bearded/models/user"
 	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/services"
 	"github.com/emicklei/go-restful"
 )
 
-func getUserByToken(mgr *manager.Manager, authorization string) *user.User {
+func getUserByToken(mgr *manager.Manager, authorization, ip string) (*user.User, *token.Token) {
 	if authorization == "" {
-		return nil
+		return nil, nil
 	}
 	parts := strings.Split(authorization, " ")
 	if len(parts) != 2 || parts[0] != "Bearer" {
-		return nil
+		return nil, nil
 	}
 
 	tokenHash := parts[1]
@@ -23,29 +28,52 @@ func getUserByToken(mgr *manager.Manager, authorization string) *user.User {
 	mgrCopy := mgr.Copy()
 	defer mgrCopy.Close()
 
-	token, err := mgrCopy.Tokens.GetByHash(tokenHash)
+	tkn, err := mgrCopy.Tokens.GetByHash(tokenHash)
 	if err != nil {
 		if !mgrCopy.IsNotFound(err) {
 			logrus.Error(err)
 		}
-		return nil
+		return nil, nil
 	}
-	u, err := mgrCopy.Users.GetById(token.User)
+	u, err := mgrCopy.Users.GetById(tkn.User)
 	if err != nil {
 		if !mgrCopy.IsNotFound(err) {
 			logrus.Error(err)
 		}
-		return nil
+		return nil, nil
 	}
-	return u
+	if _, err := mgrCopy.Tokens.Touch(tkn, ip, time.Now().UTC()); err != nil {
+		logrus.Error(err)
+	}
+	return u, tkn
+}
+
+// ClientIp returns the ip of the request without the port, the remote address is returned as is if it has no port
+func ClientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
 func AuthTokenFilter(mgr *manager.Manager) restful.FilterFunction {
 	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
-		if u := getUserByToken(mgr, req.Request.Header.Get("Authorization")); u != nil {
+		u, tkn := getUserByToken(mgr, req.Request.Header.Get("Authorization"), ClientIp(req.Request))
+		if u != nil {
+			// viewer tokens of projects are read only
+			if tkn.Role == token.RoleViewer && !isSafeMethod(req.Request.Method) {
+				services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+				return
+			}
 			req.SetAttribute(AttrUserKey, u)
+			req.SetAttribute(AttrTokenKey, tkn)
 		}
 		chain.ProcessFilter(req, resp)
 
 	}
 }
+
+func isSafeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
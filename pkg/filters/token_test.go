@@ -41,20 +41,25 @@ func TestGetUserByToken(t *testing.T) {
 		c.So(err, c.ShouldBeNil)
 		hash := token.Hash
 		c.Convey("Take user by good hash", func() {
-			u2 := getUserByToken(testMgr, fmt.Sprintf("Bearer %s", hash))
+			u2, _ := getUserByToken(testMgr, fmt.Sprintf("Bearer %s", hash), "127.0.0.1")
 			c.So(u, c.ShouldNotBeNil)
 			c.So(u.Id, c.ShouldEqual, u2.Id)
 		})
 		c.Convey("Take user by wrong hash", func() {
-			u2 := getUserByToken(testMgr, fmt.Sprintf("Bearer 2%s", hash[1:]))
+			u2, _ := getUserByToken(testMgr, fmt.Sprintf("Bearer 2%s", hash[1:]), "127.0.0.1")
 			c.So(u2, c.ShouldBeNil)
 		})
 		c.Convey("Take user by wrong first part", func() {
-			u2 := getUserByToken(testMgr, fmt.Sprintf("Auth %s", hash))
+			u2, _ := getUserByToken(testMgr, fmt.Sprintf("Auth %s", hash), "127.0.0.1")
 			c.So(u2, c.ShouldBeNil)
 		})
 		c.Convey("Take user by empty auth", func() {
-			u2 := getUserByToken(testMgr, fmt.Sprintf(""))
+			u2, _ := getUserByToken(testMgr, fmt.Sprintf(""), "127.0.0.1")
+			c.So(u2, c.ShouldBeNil)
+		})
+		c.Convey("Take user by revoked token", func() {
+			c.So(testMgr.Tokens.Remove(token), c.ShouldBeNil)
+			u2, _ := getUserByToken(testMgr, fmt.Sprintf("Bearer %s", hash), "127.0.0.1")
 			c.So(u2, c.ShouldBeNil)
 		})
 
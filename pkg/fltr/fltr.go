@@ -195,6 +195,8 @@ fields:
 			}
 		}
 		modifiers := getModifiers(tags)
+		// modifiers of the field are combined, so ranges like created_gte and created_lt could be set together
+		cmp := bson.M{}
 	modifiers:
 		for _, m := range modifiers {
 			mName := fmt.Sprintf("%s%s%s", name, ModifierDivider, m)
@@ -214,16 +216,16 @@ fields:
 						ins = append(ins, v)
 					}
 				}
-				result[bsonName] = bson.M{fmt.Sprintf("$%s", m): ins}
+				cmp[fmt.Sprintf("$%s", m)] = ins
+				result[bsonName] = cmp
 				continue modifiers
 			}
 			// gt, gte, lt, lte, ne
 			if v, err := parseValue(field, val); err != nil {
 				return nil, fmt.Errorf("param %s: %v", name, err)
 			} else {
-				result[bsonName] = bson.M{fmt.Sprintf("$%s", m): v}
-				// if there is an eq value then we just skip modifiers
-				continue fields
+				cmp[fmt.Sprintf("$%s", m)] = v
+				result[bsonName] = cmp
 			}
 		}
 	}
@@ -1,12 +1,14 @@
 package fltr
 
 import (
+	"net/http"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/emicklei/go-restful"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func TestGetFilterQuery(t *testing.T) {
@@ -64,3 +66,16 @@ func TestGetParams(t *testing.T) {
 	assert.Equal(t, false, params[4].Data().Required)
 
 }
+
+func TestFromRequestRange(t *testing.T) {
+	f := struct {
+		Created int    `fltr:"created,gte,lt"`
+		Status  string `fltr:"status,in,nin"`
+	}{}
+	httpReq, err := http.NewRequest("GET", "/?created_gte=10&created_lt=20&status_in=a,b&status_nin=b", nil)
+	require.NoError(t, err)
+	query, err := FromRequest(restful.NewRequest(httpReq), f)
+	require.NoError(t, err)
+	assert.Equal(t, bson.M{"$gte": 10, "$lt": 20}, query["created"])
+	assert.Equal(t, bson.M{"$in": []interface{}{"a", "b"}, "$nin": []interface{}{"b"}}, query["status"])
+}
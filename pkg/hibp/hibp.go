@@ -0,0 +1,128 @@
+package hibp
+
+// Client for HaveIBeenPwned passwords range api.
+// Only the first 5 symbols of password sha1 hash are sent (k-anonymity model),
+// the api returns suffixes of all breached hashes with this prefix.
+// Read more https://haveibeenpwned.com/API/v3#SearchingPwnedPasswordsByRange
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultUrl           = "https://api.pwnedpasswords.com/range/"
+	DefaultTimeout       = time.Second * 3
+	DefaultCacheDuration = time.Minute * 10
+
+	prefixLength = 5
+)
+
+type Client struct {
+	Url           string
+	CacheDuration time.Duration
+	http          *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	suffixes map[string]struct{}
+	expires  time.Time
+}
+
+// New creates client, default values are used for empty url and zero durations
+func New(url string, timeout, cacheDuration time.Duration) *Client {
+	if url == "" {
+		url = DefaultUrl
+	}
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	if cacheDuration == 0 {
+		cacheDuration = DefaultCacheDuration
+	}
+	return &Client{
+		Url:           url,
+		CacheDuration: cacheDuration,
+		http:          &http.Client{Timeout: timeout},
+		cache:         map[string]*cacheEntry{},
+	}
+}
+
+// IsPwned returns true if the password was found in known breaches.
+// Error is returned if the api is unavailable, callers decide what to do in that case.
+func (c *Client) IsPwned(password string) (bool, error) {
+	hash := fmt.Sprintf("%X", sha1.Sum([]byte(password)))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+	suffixes, err := c.suffixes(prefix)
+	if err != nil {
+		return false, err
+	}
+	_, found := suffixes[suffix]
+	return found, nil
+}
+
+func (c *Client) suffixes(prefix string) (map[string]struct{}, error) {
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.cache[prefix]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.suffixes, nil
+	}
+
+	suffixes, err := c.fetch(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// remove expired entries, so the cache doesn't grow forever
+	for k, v := range c.cache {
+		if now.After(v.expires) {
+			delete(c.cache, k)
+		}
+	}
+	c.cache[prefix] = &cacheEntry{suffixes: suffixes, expires: now.Add(c.CacheDuration)}
+	return suffixes, nil
+}
+
+func (c *Client) fetch(prefix string) (map[string]struct{}, error) {
+	req, err := http.NewRequest("GET", c.Url+prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "bearded")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("hibp api returned %d status", resp.StatusCode)
+	}
+	// every line has format SUFFIX:COUNT
+	suffixes := map[string]struct{}{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, ":"); i > 0 {
+			line = line[:i]
+		}
+		if line != "" {
+			suffixes[strings.ToUpper(line)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return suffixes, nil
+}
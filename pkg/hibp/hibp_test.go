@@ -0,0 +1,46 @@
+package hibp
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPwned(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		// sha1("password") = 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+		require.Equal(t, "/5BAA6", r.URL.Path)
+		fmt.Fprint(w, "003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\r\n")
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL+"/", 0, time.Minute)
+	pwned, err := c.IsPwned("password")
+	require.NoError(t, err)
+	assert.True(t, pwned)
+
+	// the same prefix is taken from the cache
+	pwned, err = c.IsPwned("password")
+	require.NoError(t, err)
+	assert.True(t, pwned)
+	assert.Equal(t, 1, calls)
+}
+
+func TestIsPwnedUnavailable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL+"/", 0, 0)
+	pwned, err := c.IsPwned("password")
+	assert.Error(t, err)
+	assert.False(t, pwned)
+}
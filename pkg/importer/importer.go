@@ -0,0 +1,119 @@
+// Package importer maps results of third-party scanners to bearded issues.
+//
+// Known fields are mapped to the canonical issue, the rest of the finding is kept in raw,
+// so nothing reported by the tool is lost. Issues are normalized and merged by uniq ids like plugin ones.
+package importer
+
+import (
+	"crypto/md5"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/scan"
+)
+
+// Run is results of one tool, it becomes the session of the imported scan
+type Run struct {
+	Tool    string
+	Version string
+	Issues  []*issue.Issue
+}
+
+// Ref is the tool name with the version like plugin refs, name:version
+func (r *Run) Ref() string {
+	if r.Version == "" {
+		return r.Tool
+	}
+	return fmt.Sprintf("%s:%s", r.Tool, r.Version)
+}
+
+// Parse returns runs of tools from the data in the format, empty results aren't an error
+func Parse(format scan.ImportFormat, data []byte) ([]*Run, error) {
+	switch format {
+	case scan.FormatZap:
+		return parseZap(data)
+	case scan.FormatSarif:
+		return parseSarif(data)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// classes of the most common cwe ids, other issues are classified by normalization
+var cweClasses = map[string]issue.Class{
+	"79":   issue.ClassXss,
+	"80":   issue.ClassXss,
+	"89":   issue.ClassSqli,
+	"352":  issue.ClassCsrf,
+	"77":   issue.ClassRce,
+	"78":   issue.ClassRce,
+	"94":   issue.ClassRce,
+	"22":   issue.ClassPathTraversal,
+	"23":   issue.ClassPathTraversal,
+	"601":  issue.ClassOpenRedirect,
+	"287":  issue.ClassAuth,
+	"306":  issue.ClassAuth,
+	"200":  issue.ClassInfoLeak,
+	"209":  issue.ClassInfoLeak,
+	"16":   issue.ClassMisconfig,
+	"1104": issue.ClassOutdated,
+	"937":  issue.ClassOutdated,
+}
+
+func cweClass(cwe string) issue.Class {
+	return cweClasses[strings.TrimPrefix(strings.ToLower(strings.TrimSpace(cwe)), "cwe-")]
+}
+
+var (
+	tagRe = regexp.MustCompile(`<[^>]*>`)
+	urlRe = regexp.MustCompile(`https?://[^\s<>"]+`)
+)
+
+// text of html fragments, paragraphs are separated by empty lines
+func htmlText(s string) string {
+	s = strings.Replace(s, "</p><p>", "\n\n", -1)
+	s = tagRe.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+func references(s string) []*issue.Reference {
+	var refs []*issue.Reference
+	for _, u := range urlRe.FindAllString(s, -1) {
+		refs = append(refs, &issue.Reference{Url: u})
+	}
+	return refs
+}
+
+// uniqId is built from the tool, the rule and fields which identify the finding, so it's stable between imports
+func uniqId(fields ...string) string {
+	hash := md5.New()
+	hash.Write([]byte(strings.Join(fields, ":")))
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// fingerprint values in the order of keys
+func fingerprint(prints map[string]string) string {
+	keys := make([]string, 0, len(prints))
+	for key := range prints {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, key+"="+prints[key])
+	}
+	return strings.Join(values, ",")
+}
+
+func toString(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	}
+	return fmt.Sprintf("%v", val)
+}
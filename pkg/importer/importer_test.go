@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/scan"
+)
+
+const zapData = `{
+  "@version": "2.11.1",
+  "site": [{
+    "@name": "https://example.com",
+    "alerts": [{
+      "pluginid": "40012",
+      "alert": "Cross Site Scripting (Reflected)",
+      "riskcode": "3",
+      "confidence": "2",
+      "desc": "<p>Cross-site Scripting is an attack technique.</p><p>It's &quot;reflected&quot;.</p>",
+      "reference": "<p>https://owasp.org/www-community/attacks/xss/</p><p>https://cwe.mitre.org/data/definitions/79.html</p>",
+      "solution": "<p>Validate input.</p>",
+      "cweid": "79",
+      "instances": [
+        {"uri": "https://example.com/search?q=1", "method": "GET", "param": "q", "attack": "<script>alert(1)</script>", "evidence": ""},
+        {"uri": "https://example.com/find?s=1", "method": "GET", "param": "s", "attack": ""}
+      ]
+    }]
+  }]
+}`
+
+func TestParseZap(t *testing.T) {
+	runs, err := Parse(scan.FormatZap, []byte(zapData))
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	require.Equal(t, "OWASP ZAP:2.11.1", runs[0].Ref())
+	require.Len(t, runs[0].Issues, 2)
+
+	iss := runs[0].Issues[0]
+	require.Equal(t, "Cross Site Scripting (Reflected)", iss.Summary)
+	require.Equal(t, "Cross-site Scripting is an attack technique.\n\nIt's \"reflected\".", iss.Desc)
+	require.Equal(t, issue.SeverityHigh, iss.Severity)
+	require.Equal(t, issue.ClassXss, iss.Class)
+	require.Len(t, iss.References, 2)
+	require.Equal(t, "https://example.com/search?q=1", iss.Vector.Url)
+	require.Equal(t, []string{"q"}, iss.Vector.HttpTransactions[0].Params)
+	require.Equal(t, "<p>Validate input.</p>", iss.Raw["solution"])
+	require.Equal(t, map[string]interface{}{"attack": "<script>alert(1)</script>"}, iss.Raw["instance"])
+	require.Nil(t, iss.Raw["desc"])
+
+	require.NotEqual(t, iss.UniqId, runs[0].Issues[1].UniqId)
+	again, err := Parse(scan.FormatZap, []byte(zapData))
+	require.NoError(t, err)
+	require.Equal(t, iss.UniqId, again[0].Issues[0].UniqId)
+
+	// old reports have one site object
+	runs, err = Parse(scan.FormatZap, []byte(`{"site": {"@name": "http://a", "alerts": [{"alert": "x", "riskcode": "1", "uri": "http://a/"}]}}`))
+	require.NoError(t, err)
+	require.Len(t, runs[0].Issues, 1)
+	require.Equal(t, "http://a/", runs[0].Issues[0].Vector.Url)
+	require.Nil(t, runs[0].Issues[0].Raw["uri"])
+
+	_, err = Parse(scan.FormatZap, []byte(`[1, 2]`))
+	require.Error(t, err)
+}
+
+const sarifData = `{
+  "version": "2.1.0",
+  "runs": [{
+    "tool": {"driver": {"name": "semgrep", "semanticVersion": "1.2.0", "rules": [
+      {"id": "sqli", "shortDescription": {"text": "SQL injection"}, "helpUri": "https://semgrep.dev/r/sqli",
+       "properties": {"security-severity": "8.1", "tags": ["security", "external/cwe/cwe-89"]}},
+      {"id": "debug", "name": "Debug enabled", "defaultConfiguration": {"level": "note"}}
+    ]}},
+    "results": [
+      {"ruleId": "sqli", "level": "error", "message": {"text": "Query is built from input"},
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "app/db.py"}, "region": {"startLine": 12}}}],
+       "partialFingerprints": {"primaryLocationLineHash": "abc"}, "codeFlows": []},
+      {"ruleId": "debug", "ruleIndex": 1, "message": {"text": "Debug is on"}}
+    ]
+  }]
+}`
+
+func TestParseSarif(t *testing.T) {
+	runs, err := Parse(scan.FormatSarif, []byte(sarifData))
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	require.Equal(t, "semgrep:1.2.0", runs[0].Ref())
+	require.Len(t, runs[0].Issues, 2)
+
+	iss := runs[0].Issues[0]
+	require.Equal(t, "SQL injection", iss.Summary)
+	require.Equal(t, "Query is built from input", iss.Desc)
+	require.Equal(t, 8.1, iss.Cvss)
+	require.Equal(t, issue.Severity(""), iss.Severity)
+	require.Equal(t, issue.ClassSqli, iss.Class)
+	require.Equal(t, "app/db.py", iss.Vector.Url)
+	require.Equal(t, "https://semgrep.dev/r/sqli", iss.References[0].Url)
+	require.Equal(t, "sqli", iss.Raw["ruleId"])
+	require.NotNil(t, iss.Raw["codeFlows"])
+	require.NotNil(t, iss.Raw["locations"])
+	require.Nil(t, iss.Raw["message"])
+	require.Equal(t, uniqId("semgrep", "sqli", "app/db.py", "primaryLocationLineHash=abc"), iss.UniqId)
+
+	iss = runs[0].Issues[1]
+	require.Equal(t, "Debug enabled", iss.Summary)
+	require.Equal(t, issue.SeverityLow, iss.Severity)
+	require.Nil(t, iss.Vector)
+
+	_, err = Parse(scan.FormatSarif, []byte(`{"version": "1.0.0", "runs": []}`))
+	require.Error(t, err)
+	_, err = Parse(scan.ImportFormat("nessus"), []byte(`{}`))
+	require.Error(t, err)
+}
@@ -0,0 +1,210 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+type sarifLog struct {
+	Version string      `json:"version"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name            string       `json:"name"`
+			Version         string       `json:"version"`
+			SemanticVersion string       `json:"semanticVersion"`
+			Rules           []*sarifRule `json:"rules"`
+		} `json:"driver"`
+	} `json:"tool"`
+	Results []json.RawMessage `json:"results"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	Id                   string        `json:"id"`
+	Name                 string        `json:"name"`
+	ShortDescription     *sarifMessage `json:"shortDescription"`
+	FullDescription      *sarifMessage `json:"fullDescription"`
+	HelpUri              string        `json:"helpUri"`
+	DefaultConfiguration *struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+	Properties sarifProperties `json:"properties"`
+}
+
+type sarifProperties struct {
+	// github and other tools report the cvss score, like "7.5"
+	SecuritySeverity interface{} `json:"security-severity"`
+	Tags             []string    `json:"tags"`
+}
+
+type sarifResult struct {
+	RuleId    string       `json:"ruleId"`
+	RuleIndex *int         `json:"ruleIndex"`
+	Level     string       `json:"level"`
+	Message   sarifMessage `json:"message"`
+	Locations []struct {
+		PhysicalLocation *struct {
+			ArtifactLocation *struct {
+				Uri string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region *struct {
+				StartLine int `json:"startLine"`
+			} `json:"region"`
+		} `json:"physicalLocation"`
+	} `json:"locations"`
+	Fingerprints        map[string]string `json:"fingerprints"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+	Properties          sarifProperties   `json:"properties"`
+}
+
+var sarifLevels = map[string]issue.Severity{
+	"error":   issue.SeverityHigh,
+	"warning": issue.SeverityMedium,
+	"note":    issue.SeverityLow,
+	"none":    issue.SeverityInfo,
+}
+
+// every run of the log is results of one tool, fields of results which aren't mapped are kept in raw
+func parseSarif(data []byte) ([]*Run, error) {
+	log := &sarifLog{}
+	if err := json.Unmarshal(data, log); err != nil {
+		return nil, fmt.Errorf("wrong sarif log: %v", err)
+	}
+	if log.Version != "" && !strings.HasPrefix(log.Version, "2.") {
+		return nil, fmt.Errorf("sarif version %s isn't supported, only 2.x", log.Version)
+	}
+	runs := make([]*Run, 0, len(log.Runs))
+	for i, r := range log.Runs {
+		driver := r.Tool.Driver
+		run := &Run{Tool: driver.Name, Version: driver.Version}
+		if run.Tool == "" {
+			run.Tool = "sarif"
+		}
+		if run.Version == "" {
+			run.Version = driver.SemanticVersion
+		}
+		rules := map[string]*sarifRule{}
+		for _, rule := range driver.Rules {
+			rules[rule.Id] = rule
+		}
+		for j, data := range r.Results {
+			res := &sarifResult{}
+			raw := map[string]interface{}{}
+			if err := json.Unmarshal(data, res); err != nil {
+				return nil, fmt.Errorf("wrong sarif log: run %d, result %d: %v", i+1, j+1, err)
+			}
+			if err := json.Unmarshal(data, &raw); err != nil {
+				return nil, fmt.Errorf("wrong sarif log: run %d, result %d: %v", i+1, j+1, err)
+			}
+			rule := rules[res.RuleId]
+			if res.RuleIndex != nil && *res.RuleIndex >= 0 && *res.RuleIndex < len(driver.Rules) {
+				rule = driver.Rules[*res.RuleIndex]
+			}
+			run.Issues = append(run.Issues, sarifIssue(run, rule, res, raw))
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+func sarifIssue(run *Run, rule *sarifRule, res *sarifResult, raw map[string]interface{}) *issue.Issue {
+	if rule == nil {
+		rule = &sarifRule{Id: res.RuleId}
+	}
+	if res.RuleId == "" {
+		res.RuleId = rule.Id
+	}
+	iss := &issue.Issue{Desc: res.Message.Text}
+	delete(raw, "message")
+	switch {
+	case rule.ShortDescription != nil && rule.ShortDescription.Text != "":
+		iss.Summary = rule.ShortDescription.Text
+	case rule.Name != "":
+		iss.Summary = rule.Name
+	case res.RuleId != "":
+		iss.Summary = res.RuleId
+	default:
+		iss.Summary = res.Message.Text
+	}
+	if iss.Desc == "" && rule.FullDescription != nil {
+		iss.Desc = rule.FullDescription.Text
+	}
+	if rule.HelpUri != "" {
+		iss.References = []*issue.Reference{{Url: rule.HelpUri}}
+	}
+
+	// the cvss score is more precise than the level, the severity is taken from it by the scheme
+	score := cvss(res.Properties.SecuritySeverity)
+	if score == 0 {
+		score = cvss(rule.Properties.SecuritySeverity)
+	}
+	level := res.Level
+	if level == "" && rule.DefaultConfiguration != nil {
+		level = rule.DefaultConfiguration.Level
+	}
+	if level == "" {
+		// the default level of sarif
+		level = "warning"
+	}
+	if score > 0 {
+		iss.Cvss = score
+	} else {
+		iss.Severity = sarifLevels[level]
+	}
+
+	tags := append(append([]string{}, rule.Properties.Tags...), res.Properties.Tags...)
+	for _, tag := range tags {
+		// like external/cwe/cwe-79
+		if i := strings.LastIndex(strings.ToLower(tag), "cwe-"); i >= 0 && iss.Class == "" {
+			iss.Class = cweClass(tag[i:])
+		}
+	}
+	if len(rule.Properties.Tags) > 0 {
+		raw["ruleTags"] = rule.Properties.Tags
+	}
+
+	uri, line := "", 0
+	if len(res.Locations) > 0 && res.Locations[0].PhysicalLocation != nil {
+		loc := res.Locations[0].PhysicalLocation
+		if loc.ArtifactLocation != nil {
+			uri = loc.ArtifactLocation.Uri
+		}
+		if loc.Region != nil {
+			line = loc.Region.StartLine
+		}
+	}
+	if uri != "" {
+		iss.Vector = &issue.Vector{Url: uri}
+	}
+	iss.Raw = raw
+
+	// fingerprints of the tool survive code changes, otherwise the finding is identified by its location
+	switch {
+	case len(res.Fingerprints) > 0:
+		iss.UniqId = uniqId(run.Tool, res.RuleId, fingerprint(res.Fingerprints))
+	case len(res.PartialFingerprints) > 0:
+		iss.UniqId = uniqId(run.Tool, res.RuleId, uri, fingerprint(res.PartialFingerprints))
+	default:
+		iss.UniqId = uniqId(run.Tool, res.RuleId, uri, strconv.Itoa(line), res.Message.Text)
+	}
+	return iss
+}
+
+func cvss(val interface{}) float64 {
+	score, err := strconv.ParseFloat(strings.TrimSpace(toString(val)), 64)
+	if err != nil || score < 0 || score > 10 {
+		return 0
+	}
+	return score
+}
@@ -0,0 +1,130 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+const zapTool = "OWASP ZAP"
+
+// json report of zap, sites are an object in old versions
+type zapReport struct {
+	Version string          `json:"@version"`
+	Site    json.RawMessage `json:"site"`
+}
+
+type zapSite struct {
+	Name   string                   `json:"@name"`
+	Alerts []map[string]interface{} `json:"alerts"`
+}
+
+var zapRisks = map[string]issue.Severity{
+	"0": issue.SeverityInfo,
+	"1": issue.SeverityLow,
+	"2": issue.SeverityMedium,
+	"3": issue.SeverityHigh,
+}
+
+// every instance of the alert is an issue, fields of the instance which aren't mapped are kept in raw.instance
+func parseZap(data []byte) ([]*Run, error) {
+	rep := &zapReport{}
+	if err := json.Unmarshal(data, rep); err != nil {
+		return nil, fmt.Errorf("wrong zap report: %v", err)
+	}
+	sites := []*zapSite{}
+	if len(rep.Site) > 0 {
+		if err := json.Unmarshal(rep.Site, &sites); err != nil {
+			site := &zapSite{}
+			if err := json.Unmarshal(rep.Site, site); err != nil {
+				return nil, fmt.Errorf("wrong zap report: site should be an object or an array")
+			}
+			sites = append(sites, site)
+		}
+	}
+	run := &Run{Tool: zapTool, Version: rep.Version}
+	for _, site := range sites {
+		for _, alert := range site.Alerts {
+			run.Issues = append(run.Issues, zapIssues(site, alert)...)
+		}
+	}
+	return []*Run{run}, nil
+}
+
+func zapIssues(site *zapSite, alert map[string]interface{}) []*issue.Issue {
+	instances := []map[string]interface{}{}
+	if list, ok := alert["instances"].([]interface{}); ok {
+		for _, item := range list {
+			if instance, ok := item.(map[string]interface{}); ok {
+				instances = append(instances, instance)
+			}
+		}
+	}
+	if len(instances) == 0 {
+		// old reports have the location in the alert
+		instances = append(instances, map[string]interface{}{})
+	}
+	raw := map[string]interface{}{}
+	for key, val := range alert {
+		raw[key] = val
+	}
+	summary := toString(raw["alert"])
+	if summary == "" {
+		summary = toString(raw["name"])
+	}
+	delete(raw, "alert")
+	delete(raw, "name")
+	delete(raw, "instances")
+	base := issue.Issue{
+		Summary:    summary,
+		Desc:       htmlText(toString(raw["desc"])),
+		Severity:   zapRisks[toString(raw["riskcode"])],
+		References: references(toString(raw["reference"])),
+		Class:      cweClass(toString(raw["cweid"])),
+	}
+	delete(raw, "desc")
+	delete(raw, "reference")
+	if base.Severity != "" {
+		delete(raw, "riskcode")
+	}
+	if site.Name != "" {
+		raw["site"] = site.Name
+	}
+
+	issues := make([]*issue.Issue, 0, len(instances))
+	for _, instance := range instances {
+		iss := base
+		iss.Raw = map[string]interface{}{}
+		for key, val := range raw {
+			iss.Raw[key] = val
+		}
+		uri, method, param := toString(instance["uri"]), toString(instance["method"]), toString(instance["param"])
+		if uri == "" {
+			uri, method, param = toString(raw["uri"]), toString(raw["method"]), toString(raw["param"])
+			delete(iss.Raw, "uri")
+			delete(iss.Raw, "method")
+			delete(iss.Raw, "param")
+		}
+		if uri != "" {
+			transaction := &issue.HttpTransaction{Url: uri, Method: method}
+			if param != "" {
+				transaction.Params = []string{param}
+			}
+			iss.Vector = &issue.Vector{Url: uri, HttpTransactions: []*issue.HttpTransaction{transaction}}
+		}
+		rest := map[string]interface{}{}
+		for key, val := range instance {
+			if key != "uri" && key != "method" && key != "param" && toString(val) != "" {
+				rest[key] = val
+			}
+		}
+		if len(rest) > 0 {
+			iss.Raw["instance"] = rest
+		}
+		// the same alert of the plugin in the same place is the same issue
+		iss.UniqId = uniqId(zapTool, toString(raw["pluginid"]), iss.Summary, uri, method, param)
+		issues = append(issues, &iss)
+	}
+	return issues
+}
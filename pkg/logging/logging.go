@@ -0,0 +1,155 @@
+package logging
+
+// Subsystem loggers share output and format with the standard logger, but have their own levels,
+// so operators could debug the scheduler without mongo queries flooding the log.
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/bearded-web/bearded/pkg/config"
+)
+
+const (
+	Manager   = "manager"
+	Scheduler = "scheduler"
+	Agent     = "agent"
+)
+
+var (
+	mu      sync.Mutex
+	loggers = map[string]*subsystem{}
+)
+
+type subsystem struct {
+	logger *logrus.Logger
+	// level is taken from the standard logger if it's not set
+	level *logrus.Level
+}
+
+// Logger returns the logger of the subsystem, the same logger is returned for the same name
+func Logger(name string) *logrus.Logger {
+	mu.Lock()
+	defer mu.Unlock()
+	sub, ok := loggers[name]
+	if !ok {
+		std := logrus.StandardLogger()
+		sub = &subsystem{logger: &logrus.Logger{
+			Out:       std.Out,
+			Formatter: std.Formatter,
+			Hooks:     std.Hooks,
+			Level:     std.Level,
+		}}
+		loggers[name] = sub
+	}
+	return sub.logger
+}
+
+func isKnown(name string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	_, ok := loggers[name]
+	return ok
+}
+
+// Configure sets level and format of the standard logger and levels of subsystems, empty values aren't changed
+func Configure(cfg config.Log) error {
+	switch cfg.Format {
+	case "":
+	case "text":
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format %q, should be text or json", cfg.Format)
+	}
+	for _, name := range []string{Manager, Scheduler, Agent} {
+		Logger(name)
+	}
+	levels := map[string]string{
+		Manager:   cfg.Manager,
+		Scheduler: cfg.Scheduler,
+		Agent:     cfg.Agent,
+	}
+	if cfg.Level != "" {
+		levels[""] = cfg.Level
+	}
+	return SetLevels(levels)
+}
+
+// SetLevels changes levels at runtime, empty name is for the standard logger,
+// empty level resets the subsystem to the standard level.
+// Levels are checked first, so nothing is changed if any of them is wrong.
+func SetLevels(levels map[string]string) error {
+	parsed := map[string]*logrus.Level{}
+	for name, value := range levels {
+		if name != "" && !isKnown(name) {
+			return fmt.Errorf("unknown subsystem %q", name)
+		}
+		if value == "" {
+			if name == "" {
+				return fmt.Errorf("level is required")
+			}
+			parsed[name] = nil
+			continue
+		}
+		level, err := logrus.ParseLevel(value)
+		if err != nil {
+			return fmt.Errorf("wrong %s level: %s", name, err)
+		}
+		parsed[name] = &level
+	}
+	if level, ok := parsed[""]; ok {
+		logrus.SetLevel(*level)
+		delete(parsed, "")
+	}
+	mu.Lock()
+	for name, level := range parsed {
+		loggers[name].level = level
+	}
+	mu.Unlock()
+	update()
+	return nil
+}
+
+// Levels returns current levels, the standard one has empty name
+func Levels() map[string]string {
+	mu.Lock()
+	defer mu.Unlock()
+	levels := map[string]string{"": logrus.GetLevel().String()}
+	for name, sub := range loggers {
+		levels[name] = sub.logger.Level.String()
+	}
+	return levels
+}
+
+// Names of known subsystems
+func Names() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := make([]string, 0, len(loggers))
+	for name := range loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// subsystems follow format of the standard logger and its level if they don't have own one
+func update() {
+	mu.Lock()
+	defer mu.Unlock()
+	std := logrus.StandardLogger()
+	for _, sub := range loggers {
+		sub.logger.Formatter = std.Formatter
+		sub.logger.Out = std.Out
+		if sub.level != nil {
+			sub.logger.Level = *sub.level
+		} else {
+			sub.logger.Level = std.Level
+		}
+	}
+}
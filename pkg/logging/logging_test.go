@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/pkg/config"
+)
+
+func TestLevels(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+
+	require.NoError(t, Configure(config.Log{Level: "warning", Format: "json", Scheduler: "debug"}))
+	require.Equal(t, logrus.WarnLevel, logrus.GetLevel())
+	require.IsType(t, &logrus.JSONFormatter{}, Logger(Manager).Formatter)
+	require.Equal(t, logrus.WarnLevel, Logger(Manager).Level)
+	require.Equal(t, logrus.DebugLevel, Logger(Scheduler).Level)
+
+	// subsystems without own level follow the main one
+	require.NoError(t, SetLevels(map[string]string{"": "error"}))
+	require.Equal(t, logrus.ErrorLevel, Logger(Manager).Level)
+	require.Equal(t, logrus.DebugLevel, Logger(Scheduler).Level)
+
+	require.NoError(t, SetLevels(map[string]string{Scheduler: ""}))
+	require.Equal(t, logrus.ErrorLevel, Logger(Scheduler).Level)
+
+	require.Error(t, SetLevels(map[string]string{"unknown": "info"}))
+	require.Error(t, SetLevels(map[string]string{"": "info", Agent: "wrong"}))
+	require.Equal(t, logrus.ErrorLevel, logrus.GetLevel(), "nothing is changed with wrong level")
+	require.Error(t, Configure(config.Log{Format: "xml"}))
+
+	require.Equal(t, "error", Levels()[""])
+	require.Equal(t, []string{Agent, Manager, Scheduler}, Names())
+	logrus.SetFormatter(&logrus.TextFormatter{})
+}
@@ -3,7 +3,6 @@ package manager
 import (
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
@@ -20,10 +19,12 @@ type AgentFltr struct {
 	Name   string       `fltr:"name"`
 	Type   agent.Type   `fltr:"type,in,nin"`
 	Status agent.Status `fltr:"status,in,nin"`
+
+	Capability string `fltr:"capability" bson:"capabilities"`
 }
 
 func (s *AgentManager) Init() error {
-	logrus.Infof("Initialize agent indexes")
+	log.Infof("Initialize agent indexes")
 	err := s.col.EnsureIndex(mgo.Index{
 		Key:        []string{"name", "type"},
 		Unique:     true,
@@ -32,7 +33,7 @@ func (s *AgentManager) Init() error {
 	if err != nil {
 		return err
 	}
-	for _, index := range []string{"name", "status"} {
+	for _, index := range []string{"name", "status", "lastSeen"} {
 		err := s.col.EnsureIndex(mgo.Index{
 			Key:        []string{index},
 			Background: true,
@@ -78,6 +79,7 @@ func (m *AgentManager) Create(raw *agent.Agent) (*agent.Agent, error) {
 	raw.Id = bson.NewObjectId()
 	raw.Created = time.Now().UTC()
 	raw.Updated = raw.Created
+	raw.LastSeen = raw.Created
 	if err := m.col.Insert(raw); err != nil {
 		return nil, err
 	}
@@ -92,3 +94,47 @@ func (m *AgentManager) Update(obj *agent.Agent) error {
 func (m *AgentManager) Remove(obj *agent.Agent) error {
 	return m.col.RemoveId(obj.Id)
 }
+
+// Update the last time the agent was seen, it's not stale anymore
+func (m *AgentManager) Touch(id bson.ObjectId) error {
+	return m.col.UpdateId(id, bson.M{"$set": bson.M{"lastSeen": time.Now().UTC(), "stale": false}})
+}
+
+// query for active agents which haven't been seen since the time,
+// agents created before last seen time was tracked are checked by update time
+func offlineQuery(since time.Time) bson.M {
+	return bson.M{
+		"status": bson.M{"$nin": []agent.Status{agent.StatusBlocked, agent.StatusRetired}},
+		"$or": []bson.M{
+			{"lastSeen": bson.M{"$lt": since}},
+			{"lastSeen": bson.M{"$exists": false}, "updated": bson.M{"$lt": since}},
+		},
+	}
+}
+
+// Mark agents which haven't been seen since the time as stale, returns marked agents
+func (m *AgentManager) MarkStale(since time.Time) ([]*agent.Agent, error) {
+	query := offlineQuery(since)
+	query["stale"] = bson.M{"$ne": true}
+	agents, _, err := m.FilterByQuery(query)
+	if err != nil || len(agents) == 0 {
+		return nil, err
+	}
+	ids := make([]bson.ObjectId, 0, len(agents))
+	for _, ag := range agents {
+		ag.Stale = true
+		ids = append(ids, ag.Id)
+	}
+	// agents which were seen in the meantime aren't marked
+	query["_id"] = bson.M{"$in": ids}
+	if _, err := m.col.UpdateAll(query, bson.M{"$set": bson.M{"stale": true}}); err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
+// Get active agents which haven't been seen since the time
+func (m *AgentManager) GetOffline(since time.Time) ([]*agent.Agent, error) {
+	results, _, err := m.FilterByQuery(offlineQuery(since))
+	return results, err
+}
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/audit"
+	"github.com/bearded-web/bearded/pkg/fltr"
+)
+
+// Audit log of privilege changes, events are never updated or removed
+
+type AuditManager struct {
+	manager *Manager
+	col     *mgo.Collection
+	// the last known state, like configured admins, to find changes on start
+	state *mgo.Collection
+}
+
+type AuditFltr struct {
+	Type    audit.Type    `fltr:"type,in"`
+	Actor   bson.ObjectId `fltr:"actor"`
+	User    bson.ObjectId `fltr:"user"`
+	Project bson.ObjectId `fltr:"project"`
+}
+
+const auditAdminsState = "admins"
+
+func (m *AuditManager) Init() error {
+	log.Infof("Initialize audit indexes")
+	for _, index := range []string{"created", "type", "user", "project"} {
+		err := m.col.EnsureIndex(mgo.Index{
+			Key:        []string{index},
+			Background: true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *AuditManager) Fltr() *AuditFltr {
+	return &AuditFltr{}
+}
+
+func (m *AuditManager) FilterBy(f *AuditFltr, opts ...Opts) ([]*audit.Event, int, error) {
+	query := fltr.GetQuery(f)
+	return m.FilterByQuery(query, opts...)
+}
+
+func (m *AuditManager) FilterByQuery(query bson.M, opts ...Opts) ([]*audit.Event, int, error) {
+	results := []*audit.Event{}
+	count, err := m.manager.FilterBy(m.col, &query, &results, opts...)
+	return results, count, err
+}
+
+func (m *AuditManager) Create(raw *audit.Event) (*audit.Event, error) {
+	raw.Id = bson.NewObjectId()
+	raw.Created = time.Now().UTC()
+	if err := m.col.Insert(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// Get admin emails which were configured on the last start, nil if it's the first start
+func (m *AuditManager) GetAdmins() ([]string, error) {
+	doc := &struct {
+		Emails []string
+	}{}
+	err := m.state.FindId(auditAdminsState).One(doc)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if doc.Emails == nil {
+		doc.Emails = []string{}
+	}
+	return doc.Emails, nil
+}
+
+func (m *AuditManager) SetAdmins(emails []string) error {
+	_, err := m.state.UpsertId(auditAdminsState, bson.M{"emails": emails})
+	return err
+}
@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/campaign"
+	"github.com/bearded-web/bearded/pkg/fltr"
+)
+
+type CampaignManager struct {
+	manager *Manager
+	col     *mgo.Collection
+}
+
+type CampaignFltr struct {
+	Project bson.ObjectId `fltr:"project"`
+	Plan    bson.ObjectId `fltr:"plan"`
+}
+
+func (m *CampaignManager) Init() error {
+	log.Infof("Initialize campaign indexes")
+	return m.col.EnsureIndex(mgo.Index{
+		Key:        []string{"project"},
+		Background: true,
+	})
+}
+
+func (m *CampaignManager) Fltr() *CampaignFltr {
+	return &CampaignFltr{}
+}
+
+func (m *CampaignManager) GetById(id bson.ObjectId) (*campaign.Campaign, error) {
+	u := &campaign.Campaign{}
+	return u, m.manager.GetById(m.col, id, u)
+}
+
+func (m *CampaignManager) FilterBy(f *CampaignFltr, opts ...Opts) ([]*campaign.Campaign, int, error) {
+	query := fltr.GetQuery(f)
+	return m.FilterByQuery(query, opts...)
+}
+
+func (m *CampaignManager) FilterByQuery(query bson.M, opts ...Opts) ([]*campaign.Campaign, int, error) {
+	results := []*campaign.Campaign{}
+	count, err := m.manager.FilterBy(m.col, &query, &results, opts...)
+	return results, count, err
+}
+
+// Create the campaign, the id is kept if it's set, so scans could be built before
+func (m *CampaignManager) Create(raw *campaign.Campaign) (*campaign.Campaign, error) {
+	if raw.Id == "" {
+		raw.Id = bson.NewObjectId()
+	}
+	raw.Created = time.Now().UTC()
+	raw.Updated = raw.Created
+	if err := m.col.Insert(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func (m *CampaignManager) Remove(obj *campaign.Campaign) error {
+	return m.manager.removeId(m.col, obj.Id)
+}
@@ -3,7 +3,6 @@ package manager
 import (
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
@@ -24,7 +23,7 @@ type CommentFltr struct {
 }
 
 func (s *CommentManager) Init() error {
-	logrus.Infof("Initialize comment indexes")
+	log.Infof("Initialize comment indexes")
 	err := s.col.EnsureIndex(mgo.Index{
 		Key:        []string{"type", "link"},
 		Background: true,
@@ -32,7 +31,7 @@ func (s *CommentManager) Init() error {
 	if err != nil {
 		return err
 	}
-	for _, index := range []string{"created", "updated", "owner"} {
+	for _, index := range []string{"created", "updated", "owner", "project"} {
 		err := s.col.EnsureIndex(mgo.Index{
 			Key:        []string{index},
 			Background: true,
@@ -77,9 +76,54 @@ func (m *CommentManager) Create(raw *comment.Comment) (*comment.Comment, error)
 
 func (m *CommentManager) Update(obj *comment.Comment) error {
 	obj.Updated = time.Now().UTC()
-	return m.col.UpdateId(obj.Id, obj)
+	return m.manager.updateId(m.col, obj.Id, obj)
 }
 
 func (m *CommentManager) Remove(obj *comment.Comment) error {
-	return m.col.RemoveId(obj.Id)
+	return m.manager.removeId(m.col, obj.Id)
+}
+
+// Move comments from one object to another, returns number of moved comments
+func (m *CommentManager) Relink(t comment.Type, from []bson.ObjectId, to bson.ObjectId) (int, error) {
+	query := bson.M{"type": t, "link": bson.M{"$in": from}}
+	info, err := m.manager.updateAll(m.col, query, bson.M{"$set": bson.M{"link": to}})
+	if info != nil {
+		return info.Updated, err
+	}
+	return 0, err
+}
+
+// Set projects of comments which are stored before comments had them, returns the number of updated comments.
+// Comments of scans are linked to targets.
+func (m *CommentManager) MigrateProjects() (int, error) {
+	count := 0
+	links := map[comment.Type]*mgo.Collection{
+		comment.Scan:  m.manager.Targets.col,
+		comment.Issue: m.manager.Issues.col,
+	}
+	for t, col := range links {
+		missing := bson.M{"type": t, "project": bson.M{"$exists": false}}
+		ids := []bson.ObjectId{}
+		if err := m.col.Find(missing).Distinct("link", &ids); err != nil {
+			return count, err
+		}
+		for _, id := range ids {
+			obj := &struct {
+				Project bson.ObjectId `bson:"project"`
+			}{}
+			if err := col.FindId(id).Select(bson.M{"project": 1}).One(obj); err != nil {
+				if err == mgo.ErrNotFound {
+					continue
+				}
+				return count, err
+			}
+			info, err := m.col.UpdateAll(bson.M{"type": t, "link": id, "project": missing["project"]},
+				bson.M{"$set": bson.M{"project": obj.Project}})
+			if err != nil {
+				return count, err
+			}
+			count += info.Updated
+		}
+	}
+	return count, nil
 }
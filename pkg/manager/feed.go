@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
@@ -30,7 +29,7 @@ type FeedItemFltr struct {
 }
 
 func (s *FeedManager) Init() error {
-	logrus.Infof("Initialize feed indexes")
+	log.Infof("Initialize feed indexes")
 	for _, index := range []string{"target", "project", "updated", "type"} {
 		err := s.col.EnsureIndex(mgo.Index{
 			Key:        []string{index},
@@ -67,7 +66,7 @@ func (m *FeedManager) EnrichMulti(items []*feed.FeedItem) ([]*feed.FeedItem, err
 	results := make([]*feed.FeedItem, 0, len(items))
 	for _, item := range items {
 		if err := m.Enrich(item); err != nil {
-			logrus.Error(err)
+			log.Error(err)
 			continue
 		}
 		results = append(results, item)
@@ -107,11 +106,11 @@ func (m *FeedManager) Create(raw *feed.FeedItem) (*feed.FeedItem, error) {
 
 func (m *FeedManager) Update(obj *feed.FeedItem) error {
 	obj.Updated = time.Now().UTC()
-	return m.col.UpdateId(obj.Id, obj)
+	return m.manager.updateId(m.col, obj.Id, obj)
 }
 
 func (m *FeedManager) Remove(obj *feed.FeedItem) error {
-	return m.col.RemoveId(obj.Id)
+	return m.manager.removeId(m.col, obj.Id)
 }
 
 func (m *FeedManager) AddScan(sc *scan.Scan) (*feed.FeedItem, error) {
@@ -128,6 +127,52 @@ func (m *FeedManager) AddScan(sc *scan.Scan) (*feed.FeedItem, error) {
 	return m.Create(&feedItem)
 }
 
+// Add pause or resume of the scan by the user, the scan is kept as it was at the moment
+func (m *FeedManager) AddScanEvent(sc *scan.Scan, t feed.ItemType, owner bson.ObjectId) (*feed.FeedItem, error) {
+	feedItem := feed.FeedItem{
+		Type:    t,
+		Project: sc.Project,
+		Target:  sc.Target,
+		ScanId:  sc.Id,
+		Owner:   owner,
+		Scan:    sc,
+	}
+	return m.Create(&feedItem)
+}
+
+func (m *FeedManager) AddMerge(obj *issue.TargetIssue, merged []bson.ObjectId, owner bson.ObjectId) (*feed.FeedItem, error) {
+	feedItem := feed.FeedItem{
+		Type:    feed.TypeMerge,
+		Project: obj.Project,
+		Target:  obj.Target,
+		Owner:   owner,
+		Issue:   obj.Id,
+		Merged:  merged,
+	}
+	return m.Create(&feedItem)
+}
+
+// Add the severity change of the issue after vulndb update, there is no owner for such items
+func (m *FeedManager) AddSeverity(obj *issue.TargetIssue, from issue.Severity) (*feed.FeedItem, error) {
+	feedItem := feed.FeedItem{
+		Type:     feed.TypeSeverity,
+		Project:  obj.Project,
+		Target:   obj.Target,
+		Issue:    obj.Id,
+		Severity: &feed.SeverityChange{Vuln: obj.VulnType, From: from, To: obj.Severity},
+	}
+	return m.Create(&feedItem)
+}
+
+// RemoveScans removes feed items of the scans, returns the number of removed items
+func (m *FeedManager) RemoveScans(ids []bson.ObjectId) (int, error) {
+	info, err := m.manager.removeAll(m.col, bson.M{"scanid": bson.M{"$in": ids}})
+	if info != nil {
+		return info.Removed, err
+	}
+	return 0, err
+}
+
 func (m *FeedManager) UpdateScan(sc *scan.Scan) error {
 	query := bson.M{
 		"type":    feed.TypeScan,
@@ -137,7 +182,7 @@ func (m *FeedManager) UpdateScan(sc *scan.Scan) error {
 	}
 	now := time.Now().UTC()
 	update := bson.M{"$set": bson.M{"updated": now, "scan": sc}}
-	return m.col.Update(query, update)
+	return m.manager.update(m.col, query, update)
 }
 
 func (m *FeedManager) UpdateScanReport(sc *scan.Scan, rep *report.Report) error {
@@ -168,5 +213,5 @@ func (m *FeedManager) UpdateScanReport(sc *scan.Scan, rep *report.Report) error
 	if len(techs) > 0 {
 		update["$addToSet"] = bson.M{"techs": bson.M{"$each": techs}}
 	}
-	return m.col.Update(query, update)
+	return m.manager.update(m.col, query, update)
 }
@@ -1,14 +1,22 @@
 package manager
 
 import (
+	"errors"
 	"io"
 
 	"github.com/facebookgo/stackerr"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 
 	"github.com/bearded-web/bearded/models/file"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/target"
 )
 
+// returned when attached files aren't existed or belong to another project
+var ErrForeignFile = errors.New("file isn't found or belongs to another project")
+
 type FileManager struct {
 	manager *Manager
 	grid    *mgo.GridFS
@@ -18,7 +26,8 @@ func (m *FileManager) Init() error {
 	return nil
 }
 
-// Get file by id, don't forget to close file after
+// Get file by id, don't forget to close file after.
+// Files out of the scope aren't found.
 func (m *FileManager) GetById(id string) (*file.File, error) {
 	f, err := m.grid.OpenId(id)
 	if err != nil {
@@ -26,12 +35,121 @@ func (m *FileManager) GetById(id string) (*file.File, error) {
 	}
 	meta := &file.Meta{}
 	if err = f.GetMeta(meta); err != nil {
+		f.Close()
+		return nil, stackerr.Wrap(err)
+	}
+	if ok, err := m.visible(meta); err != nil || !ok {
+		f.Close()
+		if err == nil {
+			err = mgo.ErrNotFound
+		}
 		return nil, stackerr.Wrap(err)
 	}
 	meta.MD5 = f.MD5()
 	return &file.File{Meta: meta, ReadCloser: f}, nil
 }
 
+// files of projects are visible in scopes of the projects,
+// files which aren't attached yet are visible only to their owners
+func (m *FileManager) visible(meta *file.Meta) (bool, error) {
+	sc := m.manager.scope
+	if sc == nil {
+		return true, nil
+	}
+	if meta.Project == "" {
+		return meta.Owner == sc.user.Id, nil
+	}
+	projects, err := sc.load(m.manager)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range projects {
+		if p == meta.Project {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Remove the file by id, files out of the scope aren't found
+func (m *FileManager) Remove(id string) error {
+	if m.manager.scope != nil {
+		f, err := m.GetById(id)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	return m.grid.RemoveId(id)
+}
+
+// Link files and their thumbnails to the project, so they are visible in its scope.
+// Files which are already linked to a project are kept, scoped managers link only files of their user.
+func (m *FileManager) Link(project bson.ObjectId, metas ...*file.Meta) error {
+	ids := file.Ids(metas...)
+	if project == "" || len(ids) == 0 {
+		return nil
+	}
+	query := bson.M{"_id": bson.M{"$in": ids}, "metadata.project": bson.M{"$exists": false}}
+	if sc := m.manager.scope; sc != nil {
+		query["metadata.owner"] = sc.user.Id
+	}
+	return m.manager.timed(m.grid.Files, "updateAll", query, func() error {
+		_, err := m.grid.Files.UpdateAll(query, bson.M{"$set": bson.M{"metadata.project": project}})
+		return err
+	})
+}
+
+// SetThumbnail saves the thumbnail which is made after the upload, like for files from archives.
+// mgo.ErrNotFound is returned if the file has got another thumbnail meanwhile.
+func (m *FileManager) SetThumbnail(meta *file.Meta, thumbnail string) error {
+	query := bson.M{"_id": meta.Id, "metadata.thumbnail": bson.M{"$in": []interface{}{"", nil}}}
+	err := m.manager.timed(m.grid.Files, "update", query, func() error {
+		return m.grid.Files.Update(query, bson.M{"$set": bson.M{"metadata.thumbnail": thumbnail}})
+	})
+	if err != nil {
+		return err
+	}
+	meta.Thumbnail = thumbnail
+	return nil
+}
+
+// CheckProject returns ErrForeignFile if any of files and their thumbnails isn't existed
+// or is linked to another project. Files which aren't linked yet can be attached to any project,
+// scoped managers accept only such files of their user.
+func (m *FileManager) CheckProject(project bson.ObjectId, metas ...*file.Meta) error {
+	ids := map[string]bool{}
+	for _, id := range file.Ids(metas...) {
+		ids[id] = true
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	unique := make([]string, 0, len(ids))
+	for id := range ids {
+		unique = append(unique, id)
+	}
+	unlinked := bson.M{"metadata.project": bson.M{"$exists": false}}
+	if sc := m.manager.scope; sc != nil {
+		unlinked["metadata.owner"] = sc.user.Id
+	}
+	query := bson.M{
+		"_id": bson.M{"$in": unique},
+		"$or": []bson.M{
+			{"metadata.project": project},
+			unlinked,
+		},
+	}
+	count, err := m.manager.count(m.grid.Files, query)
+	if err != nil {
+		return err
+	}
+	if count != len(unique) {
+		return ErrForeignFile
+	}
+	return nil
+}
+
 // create file with data
 func (m *FileManager) Create(r io.Reader, metaInfo *file.Meta) (*file.Meta, error) {
 	f, err := m.grid.Create("")
@@ -41,6 +159,9 @@ func (m *FileManager) Create(r io.Reader, metaInfo *file.Meta) (*file.Meta, erro
 	}
 	size, err := io.Copy(f, r)
 	if err != nil {
+		// written chunks are removed
+		f.Abort()
+		f.Close()
 		return nil, stackerr.Wrap(err)
 	}
 	meta := &file.Meta{
@@ -48,6 +169,9 @@ func (m *FileManager) Create(r io.Reader, metaInfo *file.Meta) (*file.Meta, erro
 		Size:        int(size),
 		ContentType: metaInfo.ContentType,
 		Name:        metaInfo.Name,
+		Thumbnail:   metaInfo.Thumbnail,
+		Owner:       metaInfo.Owner,
+		Project:     metaInfo.Project,
 	}
 	f.SetId(meta.Id)
 	f.SetMeta(meta)
@@ -60,3 +184,69 @@ func (m *FileManager) Create(r io.Reader, metaInfo *file.Meta) (*file.Meta, erro
 	meta.MD5 = f.MD5()
 	return meta, nil
 }
+
+// Link files which are stored before files had owners and projects to projects of issues, reports and targets
+// which they are attached to, returns the number of linked files. Files which aren't attached to anything
+// are marked as orphans, so they are visible only to admins and the migration isn't repeated.
+func (m *FileManager) MigrateProjects() (int, error) {
+	legacy := bson.M{
+		"metadata.owner":   bson.M{"$exists": false},
+		"metadata.project": bson.M{"$exists": false},
+		"metadata.orphan":  bson.M{"$exists": false},
+	}
+	before, err := m.grid.Files.Find(legacy).Count()
+	if err != nil || before == 0 {
+		return 0, err
+	}
+
+	iss := &issue.TargetIssue{}
+	iter := m.manager.Issues.col.Find(bson.M{"attachments.0": bson.M{"$exists": true}}).
+		Select(bson.M{"project": 1, "attachments": 1}).Iter()
+	for iter.Next(iss) {
+		if err := m.Link(iss.Project, iss.Attachments...); err != nil {
+			iter.Close()
+			return 0, err
+		}
+		iss = &issue.TargetIssue{}
+	}
+	if err := iter.Close(); err != nil {
+		return 0, err
+	}
+
+	rep := &report.Report{}
+	iter = m.manager.Reports.col.Find(bson.M{"$or": []bson.M{
+		{"files.0": bson.M{"$exists": true}},
+		{"issues.attachments.0": bson.M{"$exists": true}},
+		{"multi.0": bson.M{"$exists": true}},
+	}}).Select(bson.M{"project": 1, "type": 1, "files": 1, "issues": 1, "multi": 1}).Iter()
+	for iter.Next(rep) {
+		if err := m.Link(rep.Project, rep.AllFiles()...); err != nil {
+			iter.Close()
+			return 0, err
+		}
+		rep = &report.Report{}
+	}
+	if err := iter.Close(); err != nil {
+		return 0, err
+	}
+
+	t := &target.Target{}
+	iter = m.manager.Targets.col.Find(bson.M{"android.file": bson.M{"$ne": nil}}).
+		Select(bson.M{"project": 1, "android": 1}).Iter()
+	for iter.Next(t) {
+		if err := m.manager.Targets.linkFile(t); err != nil {
+			iter.Close()
+			return 0, err
+		}
+		t = &target.Target{}
+	}
+	if err := iter.Close(); err != nil {
+		return 0, err
+	}
+
+	info, err := m.grid.Files.UpdateAll(legacy, bson.M{"$set": bson.M{"metadata.orphan": true}})
+	if err != nil {
+		return 0, err
+	}
+	return before - info.Updated, nil
+}
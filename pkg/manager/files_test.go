@@ -5,7 +5,10 @@ import (
 	//	c "github.com/smartystreets/goconvey/convey"
 	"bytes"
 
+	"gopkg.in/mgo.v2/bson"
+
 	"github.com/bearded-web/bearded/models/file"
+	"github.com/bearded-web/bearded/models/user"
 	"github.com/bearded-web/bearded/pkg/tests"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -40,3 +43,66 @@ func TestFileManager(t *testing.T) {
 	_, err = mgr.Files.GetById("bad id")
 	require.Error(t, err)
 }
+
+func TestFileLink(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+
+	mgr := New(mongo.DB(dbName))
+	mgr.Cfg.Isolation = true
+	owner := &user.User{Id: bson.NewObjectId(), Email: "owner@example.com"}
+	other := &user.User{Id: bson.NewObjectId(), Email: "other@example.com"}
+	project := bson.NewObjectId()
+	meta, err := mgr.Files.Create(bytes.NewBufferString("data"), &file.Meta{Name: "a.txt", Owner: owner.Id})
+	require.NoError(t, err)
+
+	// files of other users can't be attached or linked
+	scoped := mgr.Copy().WithScope(mgr.ScopeFor(other))
+	defer scoped.Close()
+	require.Equal(t, ErrForeignFile, scoped.Files.CheckProject(project, meta))
+	require.NoError(t, scoped.Files.Link(project, meta))
+	f, err := mgr.Files.GetById(meta.Id)
+	require.NoError(t, err)
+	f.Close()
+	require.Empty(t, f.Meta.Project)
+
+	ownerMgr := mgr.Copy().WithScope(mgr.ScopeFor(owner))
+	defer ownerMgr.Close()
+	require.NoError(t, ownerMgr.Files.CheckProject(project, meta))
+	require.NoError(t, ownerMgr.Files.Link(project, meta))
+	f, err = mgr.Files.GetById(meta.Id)
+	require.NoError(t, err)
+	f.Close()
+	require.Equal(t, project, f.Meta.Project)
+
+	// unscoped managers, like ones of agents, link any files
+	meta, err = mgr.Files.Create(bytes.NewBufferString("data"), &file.Meta{Name: "b.txt", Owner: owner.Id})
+	require.NoError(t, err)
+	require.NoError(t, mgr.Files.CheckProject(project, meta))
+}
+
+func TestFileThumbnail(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+
+	mgr := New(mongo.DB(dbName))
+	meta, err := mgr.Files.Create(bytes.NewBufferString("image"), &file.Meta{Name: "a.png"})
+	require.NoError(t, err)
+	require.NoError(t, mgr.Files.SetThumbnail(meta, "thumb1"))
+	require.Equal(t, "thumb1", meta.Thumbnail)
+	f, err := mgr.Files.GetById(meta.Id)
+	require.NoError(t, err)
+	f.Close()
+	require.Equal(t, "thumb1", f.Meta.Thumbnail)
+
+	// the saved thumbnail isn't replaced
+	other := &file.Meta{Id: meta.Id}
+	require.True(t, mgr.IsNotFound(mgr.Files.SetThumbnail(other, "thumb2")))
+	require.Empty(t, other.Thumbnail)
+}
@@ -0,0 +1,95 @@
+package manager
+
+// Idempotency keys manager
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/idempotency"
+)
+
+const (
+	// records are removed by mongo after this time if ManagerConfig.IdempotencyExpire is not set
+	DefaultIdempotencyExpire = time.Hour * 24
+	// pending records of requests which are unfinished longer are abandoned, the dispatcher has crashed in the middle
+	IdempotencyPendingTimeout = time.Minute * 5
+)
+
+type IdempotencyManager struct {
+	manager *Manager
+	col     *mgo.Collection
+}
+
+func (s *IdempotencyManager) Init() error {
+	log.Infof("Initialize idempotency indexes")
+	err := s.col.EnsureIndex(mgo.Index{
+		Key:        []string{"user", "key"},
+		Unique:     true,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+	return s.manager.ensureTTLIndex(s.col, mgo.Index{
+		Key:         []string{"created"},
+		Background:  true,
+		ExpireAfter: s.Expire(),
+	})
+}
+
+// Expire returns the lifetime of records
+func (m *IdempotencyManager) Expire() time.Duration {
+	if m.manager.Cfg.IdempotencyExpire > 0 {
+		return m.manager.Cfg.IdempotencyExpire
+	}
+	return DefaultIdempotencyExpire
+}
+
+// IsStale returns true if the record is expired but isn't removed by mongo yet
+// or the original request is pending longer than IdempotencyPendingTimeout, so the key is free again.
+func (m *IdempotencyManager) IsStale(obj *idempotency.Record) bool {
+	if !obj.Completed {
+		return time.Since(obj.Updated) > IdempotencyPendingTimeout
+	}
+	return time.Since(obj.Created) > m.Expire()
+}
+
+func (m *IdempotencyManager) GetByKey(userId bson.ObjectId, key string) (*idempotency.Record, error) {
+	obj := &idempotency.Record{}
+	return obj, m.manager.GetBy(m.col, &bson.M{"user": userId, "key": key}, &obj)
+}
+
+// Create pending record for the key. Returns duplicate error if the key is already taken.
+func (m *IdempotencyManager) Create(raw *idempotency.Record) (*idempotency.Record, error) {
+	raw.Id = bson.NewObjectId()
+	raw.Created = time.Now().UTC()
+	raw.Updated = raw.Created
+	raw.Completed = false
+	if err := m.col.Insert(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// Save the response of the original request
+func (m *IdempotencyManager) Complete(obj *idempotency.Record) error {
+	obj.Updated = time.Now().UTC()
+	obj.Completed = true
+	return m.col.UpdateId(obj.Id, obj)
+}
+
+func (m *IdempotencyManager) Remove(obj *idempotency.Record) error {
+	return m.col.RemoveId(obj.Id)
+}
+
+// RemoveStale removes the stale record if it isn't changed by the concurrent request
+func (m *IdempotencyManager) RemoveStale(obj *idempotency.Record) error {
+	err := m.col.Remove(bson.M{"_id": obj.Id, "updated": obj.Updated})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
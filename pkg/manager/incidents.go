@@ -0,0 +1,62 @@
+package manager
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/incident"
+	"github.com/bearded-web/bearded/pkg/fltr"
+)
+
+// Operational incidents, they are never updated or removed
+
+type IncidentManager struct {
+	manager *Manager
+	col     *mgo.Collection
+}
+
+type IncidentFltr struct {
+	Type  incident.Type `fltr:"type,in"`
+	Agent bson.ObjectId `fltr:"agent"`
+	Scan  bson.ObjectId `fltr:"scan"`
+}
+
+func (m *IncidentManager) Init() error {
+	log.Infof("Initialize incident indexes")
+	for _, index := range []string{"created", "type", "agent", "scan"} {
+		err := m.col.EnsureIndex(mgo.Index{
+			Key:        []string{index},
+			Background: true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *IncidentManager) Fltr() *IncidentFltr {
+	return &IncidentFltr{}
+}
+
+func (m *IncidentManager) FilterBy(f *IncidentFltr, opts ...Opts) ([]*incident.Incident, int, error) {
+	query := fltr.GetQuery(f)
+	return m.FilterByQuery(query, opts...)
+}
+
+func (m *IncidentManager) FilterByQuery(query bson.M, opts ...Opts) ([]*incident.Incident, int, error) {
+	results := []*incident.Incident{}
+	count, err := m.manager.FilterBy(m.col, &query, &results, opts...)
+	return results, count, err
+}
+
+func (m *IncidentManager) Create(raw *incident.Incident) (*incident.Incident, error) {
+	raw.Id = bson.NewObjectId()
+	raw.Created = time.Now().UTC()
+	if err := m.col.Insert(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
@@ -3,13 +3,15 @@ package manager
 // TargetIssues manager
 
 import (
+	"fmt"
+	"sort"
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/stats"
 	"github.com/bearded-web/bearded/pkg/fltr"
 )
 
@@ -25,6 +27,7 @@ type IssueFltr struct {
 	ResolvedAt time.Time      `fltr:"resolvedAt,gte,gt,lte,lt,in"`
 	Target     bson.ObjectId  `fltr:"target,in"`
 	Project    bson.ObjectId  `fltr:"project"`
+	Scan       bson.ObjectId  `fltr:"scan" bson:"activities.report.scan" description:"issues reported by the scan"`
 	Confirmed  *bool          `fltr:"confirmed"`
 	Muted      *bool          `fltr:"muted"`
 	Resolved   *bool          `fltr:"resolved"`
@@ -33,7 +36,7 @@ type IssueFltr struct {
 }
 
 func (s *IssueManager) Init() error {
-	logrus.Infof("Initialize issue indexes")
+	log.Infof("Initialize issue indexes")
 	err := s.col.EnsureIndex(mgo.Index{
 		Key:        []string{"target", "uniqId"},
 		Unique:     true,
@@ -42,9 +45,17 @@ func (s *IssueManager) Init() error {
 	if err != nil {
 		return err
 	}
+	err = s.col.EnsureIndex(mgo.Index{
+		Key:        []string{"merged.target", "merged.uniqId"},
+		Background: true,
+	})
+	if err != nil {
+		return err
+	}
 
 	// TODO (m0sth8): check what indexes are really used
-	for _, index := range []string{"created", "updated", "target", "project", "resolvedAt"} {
+	for _, index := range []string{"created", "updated", "target", "project", "resolvedAt", "activities.report.scan", "tags", "merged.id",
+		"lastSeen", "summary", "cvss"} {
 		err := s.col.EnsureIndex(mgo.Index{
 			Key:        []string{index},
 			Background: true,
@@ -53,14 +64,34 @@ func (s *IssueManager) Init() error {
 			return err
 		}
 	}
+	// open issues of the target which weren't reported by the scan are counted by auto close
+	err = s.col.EnsureIndex(mgo.Index{
+		Key:        []string{"target", "resolved", "false", "activities.report.scan"},
+		Background: true,
+	})
+	if err != nil {
+		return err
+	}
+	// the default sort of issue lists
+	err = s.col.EnsureIndex(mgo.Index{
+		Key:        []string{"-level", "created", "_id"},
+		Background: true,
+	})
+	if err != nil {
+		return err
+	}
+	// issues of the scan are listed from the newest
+	err = s.col.EnsureIndex(mgo.Index{
+		Key:        []string{"activities.report.scan", "-created"},
+		Background: true,
+	})
+	if err != nil {
+		return err
+	}
 	if s.manager.Cfg.TextSearchEnable {
-		logrus.Infof("Create text indexes for issue")
-		err := s.col.EnsureIndex(mgo.Index{
-			Key:             []string{"$text:summary", "$text:desc"},
-			Weights:         map[string]int{"summary": 10, "desc": 1},
-			Background:      true,
-			DefaultLanguage: "english",
-		})
+		log.Infof("Create text indexes for issue")
+		index := s.manager.textIndex("issue", []string{"summary", "desc"}, map[string]int{"summary": 10, "desc": 1})
+		err := s.manager.ensureTextIndex(s.col, index)
 		if err != nil {
 			return err
 		}
@@ -83,6 +114,19 @@ func (m *IssueManager) GetByUniqId(target bson.ObjectId, uniqId string) (*issue.
 	return u, m.manager.GetBy(m.col, &bson.M{"target": target, "uniqId": uniqId}, &u)
 }
 
+// Get the issue which the issue with id was merged into
+func (m *IssueManager) GetByMergedId(id bson.ObjectId) (*issue.TargetIssue, error) {
+	u := &issue.TargetIssue{}
+	return u, m.manager.GetBy(m.col, &bson.M{"merged.id": id}, &u)
+}
+
+// Get the issue which the issue with uniqId for the target was merged into
+func (m *IssueManager) GetByMergedUniqId(target bson.ObjectId, uniqId string) (*issue.TargetIssue, error) {
+	u := &issue.TargetIssue{}
+	query := &bson.M{"merged": bson.M{"$elemMatch": bson.M{"target": target, "uniqId": uniqId}}}
+	return u, m.manager.GetBy(m.col, query, &u)
+}
+
 func (m *IssueManager) FilterBy(f *IssueFltr, opts ...Opts) ([]*issue.TargetIssue, int, error) {
 	query := fltr.GetQuery(f)
 	return m.FilterByQuery(query, opts...)
@@ -94,36 +138,816 @@ func (m *IssueManager) FilterByQuery(query bson.M, opts ...Opts) ([]*issue.Targe
 	return results, count, err
 }
 
+// Each calls fn for every issue of the query in the scope, issues are read one by one,
+// so exports of large projects aren't loaded into memory. The iteration is stopped when fn returns an error
+// or the manager context is done, the iteration isn't run in background like other reads, because fn usually
+// writes the response.
+func (m *IssueManager) Each(query bson.M, sort []string, fn func(*issue.TargetIssue) error) error {
+	query, err := m.manager.scopeQuery(m.col, query)
+	if err != nil {
+		return err
+	}
+	ctx := m.manager.Context()
+	iter := m.col.Find(query).Sort(sort...).Iter()
+	obj := &issue.TargetIssue{}
+	for iter.Next(obj) {
+		if err := ctx.Err(); err != nil {
+			iter.Close()
+			return err
+		}
+		if err := fn(obj); err != nil {
+			iter.Close()
+			return err
+		}
+		obj = &issue.TargetIssue{}
+	}
+	return iter.Close()
+}
+
 func (m *IssueManager) Create(raw *issue.TargetIssue) (*issue.TargetIssue, error) {
 	// TODO (m0sth8): add validation
 	raw.Id = bson.NewObjectId()
 	raw.Created = time.Now().UTC()
 	raw.Updated = raw.Created
+	raw.Version = 1
 	if len(raw.Severity) == 0 {
-		raw.Severity = issue.SeverityInfo
+		raw.Severity = issue.Severities[0]
 	}
 	if len(raw.UniqId) == 0 {
 		raw.UniqId = raw.Id.Hex()
 	}
+	raw.Level = raw.Severity.Level()
 	if err := m.col.Insert(raw); err != nil {
 		return nil, err
 	}
-	return raw, nil
+	return raw, m.manager.Files.Link(raw.Project, raw.Attachments...)
 }
 
+// Import inserts the issue as is, ids and dates are set by the archive import
+func (m *IssueManager) Import(raw *issue.TargetIssue) error {
+	raw.Level = raw.Severity.Level()
+	if err := m.col.Insert(raw); err != nil {
+		return err
+	}
+	return m.manager.Files.Link(raw.Project, raw.Attachments...)
+}
+
+// Update the issue and increment its version.
+// Returns ErrVersionConflict if the issue was updated since it had been read.
 func (m *IssueManager) Update(obj *issue.TargetIssue) error {
 	obj.Updated = time.Now().UTC()
-	return m.col.UpdateId(obj.Id, obj)
+	obj.Level = obj.Severity.Level()
+	version := obj.Version
+	obj.Version++
+	if err := m.manager.UpdateVersion(m.col, obj.Id, version, obj); err != nil {
+		obj.Version = version
+		return err
+	}
+	return m.manager.Files.Link(obj.Project, obj.Attachments...)
+}
+
+// AddActivity appends the activity to issues of the query, returns the number of updated issues
+func (m *IssueManager) AddActivity(query bson.M, act *issue.Activity) (int, error) {
+	info, err := m.manager.updateAll(m.col, query, bson.M{
+		"$push": bson.M{"activities": act},
+		"$set":  bson.M{"updated": time.Now().UTC()},
+		"$inc":  bson.M{"version": 1},
+	})
+	if info != nil {
+		return info.Updated, err
+	}
+	return 0, err
+}
+
+// Seen adds the report activity to open issues of the target with the uniq ids, directly or merged ones,
+// and resets their misses, so issues which aren't stored by the scan aren't closed.
+// Issues which already have the report aren't changed. Returns the number of updated issues
+func (m *IssueManager) Seen(target bson.ObjectId, uniqIds []string, act *issue.Activity) (int, error) {
+	if len(uniqIds) == 0 {
+		return 0, nil
+	}
+	info, err := m.manager.updateAll(m.col, bson.M{
+		"target":   target,
+		"resolved": false,
+		"false":    false,
+		// the report is uploaded again by the agent
+		"activities.report.report": bson.M{"$ne": act.Report.Report},
+		"$or": []bson.M{
+			{"uniqId": bson.M{"$in": uniqIds}},
+			{"merged": bson.M{"$elemMatch": bson.M{"target": target, "uniqId": bson.M{"$in": uniqIds}}}},
+		},
+	}, bson.M{
+		"$push":  bson.M{"activities": act},
+		"$set":   bson.M{"updated": act.Created, "lastSeen": act.Created},
+		"$unset": bson.M{"missed": ""},
+		"$inc":   bson.M{"version": 1},
+	})
+	if info != nil {
+		return info.Updated, err
+	}
+	return 0, err
+}
+
+// Mark issues of the query with the baseline id, returns the number of marked issues
+func (m *IssueManager) SetBaseline(query bson.M, baseline bson.ObjectId) (int, error) {
+	info, err := m.manager.updateAll(m.col, query, bson.M{
+		"$set": bson.M{"baseline": baseline, "updated": time.Now().UTC()},
+		"$inc": bson.M{"version": 1},
+	})
+	if info != nil {
+		return info.Updated, err
+	}
+	return 0, err
 }
 
 func (m *IssueManager) Remove(obj *issue.TargetIssue) error {
-	return m.col.RemoveId(obj.Id)
+	return m.manager.removeId(m.col, obj.Id)
 }
 
 func (m *IssueManager) RemoveAll(query bson.M) (int, error) {
-	info, err := m.col.RemoveAll(query)
+	info, err := m.manager.removeAll(m.col, query)
 	if info != nil {
 		return info.Removed, err
 	}
 	return 0, err
 }
+
+// Count issues by severity which were reported by the scan, false and muted issues are skipped.
+// Issues of the baseline aren't counted if it's set.
+func (m *IssueManager) GetScanSummary(scanId, baseline bson.ObjectId) (map[issue.Severity]int, error) {
+	query, err := m.scanIssuesQuery(scanId, baseline)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := []bson.M{
+		{"$match": query},
+		{"$group": bson.M{"_id": "$severity", "count": bson.M{"$sum": 1}}},
+	}
+	groups := []struct {
+		Severity issue.Severity `bson:"_id"`
+		Count    int
+	}{}
+	if err := m.manager.run(func() error { return m.col.Pipe(pipeline).All(&groups) }); err != nil {
+		return nil, err
+	}
+	summary := map[issue.Severity]int{}
+	for _, g := range groups {
+		summary[g.Severity] = g.Count
+	}
+	return summary, nil
+}
+
+// Get the number of issues reported by the scan with cvss score from each of the values,
+// issues without the score and issues of the baseline aren't counted
+func (m *IssueManager) GetScanCvssCounts(scanId, baseline bson.ObjectId, scores []float64) (map[float64]int, error) {
+	counts := map[float64]int{}
+	if len(scores) == 0 {
+		return counts, nil
+	}
+	query, err := m.scanIssuesQuery(scanId, baseline)
+	if err != nil {
+		return nil, err
+	}
+	group := bson.M{"_id": nil}
+	for i, score := range scores {
+		group[fmt.Sprintf("s%d", i)] = bson.M{"$sum": bson.M{"$cond": []interface{}{bson.M{"$gte": []interface{}{"$cvss", score}}, 1, 0}}}
+	}
+	pipeline := []bson.M{
+		{"$match": query},
+		{"$group": group},
+	}
+	results := []bson.M{}
+	if err := m.manager.run(func() error { return m.col.Pipe(pipeline).All(&results) }); err != nil {
+		return nil, err
+	}
+	for i, score := range scores {
+		counts[score] = 0
+		if len(results) > 0 {
+			switch n := results[0][fmt.Sprintf("s%d", i)].(type) {
+			case int:
+				counts[score] = n
+			case int64:
+				counts[score] = int(n)
+			}
+		}
+	}
+	return counts, nil
+}
+
+// Issues reported by the scan which are counted in results, false and muted issues are skipped
+func (m *IssueManager) scanIssuesQuery(scanId, baseline bson.ObjectId) (bson.M, error) {
+	query := bson.M{
+		"activities.report.scan": scanId,
+		"false":                  false,
+		"muted":                  false,
+	}
+	if baseline != "" {
+		query["baseline"] = bson.M{"$ne": baseline}
+	}
+	return m.manager.scopeQuery(m.col, query)
+}
+
+// Get only ids of issues
+func (m *IssueManager) GetIds(query bson.M) ([]bson.ObjectId, error) {
+	results := []struct {
+		Id bson.ObjectId `bson:"_id"`
+	}{}
+	query, err := m.manager.scopeQuery(m.col, query)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.manager.run(func() error { return m.col.Find(query).Select(bson.M{"_id": 1}).All(&results) }); err != nil {
+		return nil, err
+	}
+	ids := make([]bson.ObjectId, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.Id)
+	}
+	return ids, nil
+}
+
+// Get issues for the risk score which were open in [since, to) period, false and muted issues are skipped.
+// Issues are counted through aggregation by the target, the severity, the cvss and days when they were created
+// and resolved, times are rounded up to the next day, so scores at starts of days are exact.
+// Times of the last day before to are kept as is.
+func (m *IssueManager) GetRiskIssues(query bson.M, since, to time.Time) ([]*stats.RiskIssue, error) {
+	query, err := m.manager.scopeQuery(m.col, bson.M{"$and": []bson.M{query, {
+		"false": false,
+		"muted": false,
+		"$or": []bson.M{
+			{"resolved": false},
+			{"resolvedAt": bson.M{"$gte": since}},
+		},
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	last := stats.IntervalDay.Start(to)
+	pipeline := []bson.M{
+		{"$match": query},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"target":     "$target",
+				"severity":   "$severity",
+				"cvss":       "$cvss",
+				"created":    roundUpDay("$created", last),
+				"resolved":   "$resolved",
+				"resolvedAt": roundUpDay("$resolvedAt", last),
+			},
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+	groups := []struct {
+		Id    stats.RiskIssue `bson:"_id"`
+		Count int
+	}{}
+	if err := m.manager.run(func() error { return m.col.Pipe(pipeline).All(&groups) }); err != nil {
+		return nil, err
+	}
+	results := make([]*stats.RiskIssue, 0, len(groups))
+	for i := range groups {
+		obj := &groups[i].Id
+		obj.Count = groups[i].Count
+		results = append(results, obj)
+	}
+	return results, nil
+}
+
+// roundUpDay returns the aggregation expression of the time rounded up to the start of the next UTC day,
+// times since last are kept as is
+func roundUpDay(field string, last time.Time) bson.M {
+	day := int64(24 * time.Hour / time.Millisecond)
+	epoch := time.Unix(0, 0).UTC()
+	// milliseconds since the epoch, moved to the next day unless it's the start of the day
+	ms := bson.M{"$add": []interface{}{bson.M{"$subtract": []interface{}{field, epoch}}, day - 1}}
+	rounded := bson.M{"$add": []interface{}{epoch, bson.M{"$subtract": []interface{}{ms, bson.M{"$mod": []interface{}{ms, day}}}}}}
+	return bson.M{"$cond": []interface{}{bson.M{"$gte": []interface{}{field, last}}, field, rounded}}
+}
+
+// Get issue counts by status and open issue counts by severity through aggregation
+func (m *IssueManager) GetStats(query bson.M) (*stats.Issues, error) {
+	query, err := m.manager.scopeQuery(m.col, query)
+	if err != nil {
+		return nil, err
+	}
+	closed := bson.M{"$or": []interface{}{"$resolved", "$false", "$muted"}}
+	pipeline := []bson.M{
+		{"$match": query},
+		{"$group": bson.M{
+			"_id":       "$severity",
+			"total":     bson.M{"$sum": 1},
+			"open":      bson.M{"$sum": bson.M{"$cond": []interface{}{closed, 0, 1}}},
+			"confirmed": bson.M{"$sum": bson.M{"$cond": []interface{}{"$confirmed", 1, 0}}},
+			"resolved":  bson.M{"$sum": bson.M{"$cond": []interface{}{"$resolved", 1, 0}}},
+			"false":     bson.M{"$sum": bson.M{"$cond": []interface{}{"$false", 1, 0}}},
+			"muted":     bson.M{"$sum": bson.M{"$cond": []interface{}{"$muted", 1, 0}}},
+		}},
+	}
+	groups := []struct {
+		Severity  issue.Severity `bson:"_id"`
+		Total     int
+		Open      int
+		Confirmed int
+		Resolved  int
+		False     int
+		Muted     int
+	}{}
+	if err := m.manager.run(func() error { return m.col.Pipe(pipeline).All(&groups) }); err != nil {
+		return nil, err
+	}
+	result := &stats.Issues{Severity: map[issue.Severity]int{}}
+	for _, g := range groups {
+		result.Total += g.Total
+		result.Open += g.Open
+		result.Confirmed += g.Confirmed
+		result.Resolved += g.Resolved
+		result.False += g.False
+		result.Muted += g.Muted
+		if g.Open > 0 {
+			result.Severity[g.Severity] = g.Open
+		}
+	}
+	return result, nil
+}
+
+// GetComparison groups open issues matched by the query into rows by the kind and collects affected targets
+// of every row through aggregation. Rows are sorted by the number of affected targets, the severity and
+// the number of issues, no more than limit rows are returned.
+func (m *IssueManager) GetComparison(query bson.M, by stats.CompareBy, limit int) ([]*stats.ComparisonRow, error) {
+	query, err := m.manager.scopeQuery(m.col, query)
+	if err != nil {
+		return nil, err
+	}
+	query = copyQuery(query)
+	query["resolved"] = false
+	query["false"] = false
+	query["muted"] = false
+
+	var key bson.M
+	switch by {
+	case stats.CompareByIssue:
+		key = bson.M{"uniqId": "$uniqId"}
+	case stats.CompareByClass:
+		key = bson.M{"class": "$class"}
+	default:
+		key = vulnTypeKey()
+	}
+	pipeline := []bson.M{
+		{"$match": query},
+		// the first issue of every group has the highest severity
+		{"$sort": bson.M{"level": -1}},
+		{"$group": bson.M{
+			"_id":      bson.M{"key": key, "target": "$target"},
+			"issues":   bson.M{"$sum": 1},
+			"level":    bson.M{"$max": "$level"},
+			"severity": bson.M{"$first": "$severity"},
+			"summary":  bson.M{"$first": "$summary"},
+		}},
+		{"$sort": bson.M{"level": -1}},
+		{"$group": bson.M{
+			"_id":      "$_id.key",
+			"targets":  bson.M{"$push": "$_id.target"},
+			"count":    bson.M{"$sum": 1},
+			"issues":   bson.M{"$sum": "$issues"},
+			"level":    bson.M{"$max": "$level"},
+			"severity": bson.M{"$first": "$severity"},
+			"summary":  bson.M{"$first": "$summary"},
+		}},
+		{"$sort": bson.D{{Name: "count", Value: -1}, {Name: "level", Value: -1}, {Name: "issues", Value: -1}}},
+		{"$limit": limit},
+	}
+	groups := []struct {
+		Key struct {
+			VulnType int         `bson:"vulnType"`
+			UniqId   string      `bson:"uniqId"`
+			Class    issue.Class `bson:"class"`
+		} `bson:"_id"`
+		Targets  []bson.ObjectId
+		Count    int
+		Issues   int
+		Severity issue.Severity
+		Summary  string
+	}{}
+	if err := m.manager.run(func() error { return m.col.Pipe(pipeline).All(&groups) }); err != nil {
+		return nil, err
+	}
+	rows := make([]*stats.ComparisonRow, 0, len(groups))
+	for _, g := range groups {
+		row := &stats.ComparisonRow{
+			VulnType: g.Key.VulnType,
+			UniqId:   g.Key.UniqId,
+			Class:    g.Key.Class,
+			Severity: g.Severity,
+			Targets:  g.Targets,
+			Count:    g.Count,
+			Issues:   g.Issues,
+		}
+		// summaries of issues of the class are different
+		if by != stats.CompareByClass {
+			row.Summary = g.Summary
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// group key of issues by the vulndb type, issues without the type are grouped by summary
+func vulnTypeKey() bson.M {
+	return bson.M{
+		"vulnType": "$vulnType",
+		"summary":  bson.M{"$cond": []interface{}{bson.M{"$gt": []interface{}{"$vulnType", 0}}, "", "$summary"}},
+	}
+}
+
+// GetTopVulns counts issues matched by the query by vulndb types or their cwes through aggregation,
+// the most common ones go first. The total number of types or cwes is returned with the page.
+func (m *IssueManager) GetTopVulns(query bson.M, by stats.TopBy, skip, limit int) ([]*stats.TopVuln, int, error) {
+	query, err := m.manager.scopeQuery(m.col, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	if by == stats.TopByCwe {
+		query = copyQuery(query)
+		query["vulnType"] = bson.M{"$gt": 0}
+	}
+	// issues aren't sorted before grouping, so the sort isn't made in memory for big projects,
+	// the severity is taken from the highest level of the group
+	pipeline := []bson.M{
+		{"$match": query},
+		{"$group": bson.M{
+			"_id":     vulnTypeKey(),
+			"count":   bson.M{"$sum": 1},
+			"level":   bson.M{"$max": "$level"},
+			"summary": bson.M{"$first": "$summary"},
+			"targets": bson.M{"$addToSet": "$target"},
+		}},
+		{"$sort": bson.D{{Name: "count", Value: -1}, {Name: "level", Value: -1}}},
+	}
+	total := 0
+	if by == stats.TopByType {
+		counted := []struct {
+			Count int
+		}{}
+		countPipeline := []bson.M{
+			{"$match": query},
+			{"$group": bson.M{"_id": vulnTypeKey()}},
+			{"$group": bson.M{"_id": nil, "count": bson.M{"$sum": 1}}},
+		}
+		if err := m.manager.run(func() error { return m.col.Pipe(countPipeline).All(&counted) }); err != nil {
+			return nil, 0, err
+		}
+		if len(counted) > 0 {
+			total = counted[0].Count
+		}
+		pipeline = append(pipeline, bson.M{"$skip": skip})
+		if limit > 0 {
+			pipeline = append(pipeline, bson.M{"$limit": limit})
+		}
+	}
+	groups := []*topGroup{}
+	if err := m.manager.run(func() error { return m.col.Pipe(pipeline).All(&groups) }); err != nil {
+		return nil, 0, err
+	}
+
+	if by == stats.TopByType {
+		results := make([]*stats.TopVuln, 0, len(groups))
+		for _, g := range groups {
+			top := &stats.TopVuln{
+				VulnType: g.Key.VulnType,
+				Title:    g.Summary,
+				Severity: issue.LevelSeverity(g.Level),
+				Count:    g.Count,
+				Targets:  len(g.Targets),
+			}
+			if v := m.manager.Vulndb.GetById(g.Key.VulnType); v != nil {
+				top.Title = v.Title
+			}
+			results = append(results, top)
+		}
+		return results, total, nil
+	}
+
+	cwes := mergeCwes(groups, func(vulnType int) []string {
+		if v := m.manager.Vulndb.GetById(vulnType); v != nil {
+			return v.Cwe
+		}
+		return nil
+	})
+	total = len(cwes)
+	if skip > len(cwes) {
+		skip = len(cwes)
+	}
+	cwes = cwes[skip:]
+	if limit > 0 && len(cwes) > limit {
+		cwes = cwes[:limit]
+	}
+	results := make([]*stats.TopVuln, 0, len(cwes))
+	for _, cg := range cwes {
+		results = append(results, cg.top)
+	}
+	return results, total, nil
+}
+
+// issues of the vulndb type or the summary counted by the aggregation
+type topGroup struct {
+	Key struct {
+		VulnType int `bson:"vulnType"`
+	} `bson:"_id"`
+	Count   int
+	Level   int
+	Summary string
+	Targets []bson.ObjectId
+}
+
+// mergeCwes merges groups of types by their cwes, one issue could be counted in several cwes.
+// Types without cwes are skipped, cwes are sorted.
+func mergeCwes(groups []*topGroup, cwesOf func(vulnType int) []string) []*cweGroup {
+	byCwe := map[string]*cweGroup{}
+	for _, g := range groups {
+		for _, cwe := range cwesOf(g.Key.VulnType) {
+			cg, ok := byCwe[cwe]
+			if !ok {
+				cg = &cweGroup{top: &stats.TopVuln{Cwe: cwe, Title: "CWE-" + cwe}, targets: map[bson.ObjectId]bool{}}
+				byCwe[cwe] = cg
+			}
+			cg.top.Count += g.Count
+			if g.Level > cg.level {
+				cg.level = g.Level
+			}
+			for _, t := range g.Targets {
+				cg.targets[t] = true
+			}
+		}
+	}
+	cwes := make([]*cweGroup, 0, len(byCwe))
+	for _, cg := range byCwe {
+		cg.top.Targets = len(cg.targets)
+		cg.top.Severity = issue.LevelSeverity(cg.level)
+		cwes = append(cwes, cg)
+	}
+	sort.Sort(cweGroups(cwes))
+	return cwes
+}
+
+type cweGroup struct {
+	top     *stats.TopVuln
+	level   int
+	targets map[bson.ObjectId]bool
+}
+
+// the most common cwes go first, then the most dangerous ones, ids keep the order stable
+type cweGroups []*cweGroup
+
+func (g cweGroups) Len() int      { return len(g) }
+func (g cweGroups) Swap(i, j int) { g[i], g[j] = g[j], g[i] }
+func (g cweGroups) Less(i, j int) bool {
+	if g[i].top.Count != g[j].top.Count {
+		return g[i].top.Count > g[j].top.Count
+	}
+	if g[i].level != g[j].level {
+		return g[i].level > g[j].level
+	}
+	return g[i].top.Cwe < g[j].top.Cwe
+}
+
+// Get issues opened and resolved in every interval of [from, to) period, intervals are in UTC.
+// Issues are counted by day through aggregation and then summed up by intervals.
+func (m *IssueManager) GetTrend(query bson.M, from, to time.Time, interval stats.Interval) ([]*stats.TrendPoint, error) {
+	from = interval.Start(from)
+	opened, err := m.countByDay(query, "created", from, to)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := m.countByDay(query, "resolvedAt", from, to)
+	if err != nil {
+		return nil, err
+	}
+	// issues which were created before the period and weren't resolved then
+	openQuery := bson.M{"created": bson.M{"$lt": from}, "$or": []bson.M{
+		{"resolved": false},
+		{"resolvedAt": bson.M{"$gte": from}},
+	}}
+	for k, v := range query {
+		openQuery[k] = v
+	}
+	open, err := m.manager.count(m.col, openQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	points := []*stats.TrendPoint{}
+	for start := from; start.Before(to); start = interval.Next(start) {
+		point := &stats.TrendPoint{Date: start}
+		for day := start; day.Before(interval.Next(start)); day = day.AddDate(0, 0, 1) {
+			point.Opened += opened[day]
+			point.Resolved += resolved[day]
+		}
+		open += point.Opened - point.Resolved
+		point.Open = open
+		points = append(points, point)
+	}
+	return points, nil
+}
+func (m *IssueManager) countByDay(query bson.M, field string, from, to time.Time) (map[time.Time]int, error) {
+	match := bson.M{}
+	for k, v := range query {
+		match[k] = v
+	}
+	match[field] = bson.M{"$gte": from, "$lt": to}
+	match, err := m.manager.scopeQuery(m.col, match)
+	if err != nil {
+		return nil, err
+	}
+	value := "$" + field
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"year":  bson.M{"$year": value},
+				"month": bson.M{"$month": value},
+				"day":   bson.M{"$dayOfMonth": value},
+			},
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+	groups := []struct {
+		Id struct {
+			Year  int
+			Month int
+			Day   int
+		} `bson:"_id"`
+		Count int
+	}{}
+	if err := m.manager.run(func() error { return m.col.Pipe(pipeline).All(&groups) }); err != nil {
+		return nil, err
+	}
+	result := map[time.Time]int{}
+	for _, g := range groups {
+		day := time.Date(g.Id.Year, time.Month(g.Id.Month), g.Id.Day, 0, 0, 0, 0, time.UTC)
+		result[day] = g.Count
+	}
+	return result, nil
+}
+
+// Move issues with aliases or unknown severities to the current severity scheme, see issue.MapSeverity.
+// Summaries of affected targets are updated.
+func (m *IssueManager) MigrateSeverities() (int, error) {
+	known := append([]issue.Severity{issue.SeverityError}, issue.Severities...)
+	issues, _, err := m.FilterByQuery(bson.M{"severity": bson.M{"$nin": known}})
+	if err != nil {
+		return 0, err
+	}
+	targets := map[bson.ObjectId]bool{}
+	for _, obj := range issues {
+		obj.MapSeverity()
+		if err := m.Update(obj); err != nil {
+			return 0, err
+		}
+		targets[obj.Target] = true
+	}
+	for id := range targets {
+		if err := m.manager.Targets.UpdateSummaryById(id); err != nil && !m.manager.IsNotFound(err) {
+			return 0, err
+		}
+	}
+	return len(issues), nil
+}
+
+// Set sort keys of issues which are stored before they were kept or after the severity scheme is changed
+func (m *IssueManager) MigrateSortKeys() (int, error) {
+	count := 0
+	for _, sev := range append([]issue.Severity{issue.SeverityError}, issue.Severities...) {
+		info, err := m.manager.updateAll(m.col,
+			bson.M{"severity": sev, "level": bson.M{"$ne": sev.Level()}},
+			bson.M{"$set": bson.M{"level": sev.Level()}})
+		if err != nil {
+			return 0, err
+		}
+		count += info.Updated
+	}
+	obj := &issue.TargetIssue{}
+	iter := m.col.Find(bson.M{"lastSeen": bson.M{"$exists": false}}).Select(bson.M{"activities": 1, "created": 1}).Iter()
+	for iter.Next(obj) {
+		last := obj.GetLastSeen()
+		if last.IsZero() {
+			last = obj.Created
+		}
+		if err := m.manager.updateId(m.col, obj.Id, bson.M{"$set": bson.M{"lastSeen": last}}); err != nil {
+			iter.Close()
+			return 0, err
+		}
+		count++
+		obj = &issue.TargetIssue{}
+	}
+	return count, iter.Close()
+}
+
+// Mark issues with severities set by users before the mark was kept, so they aren't recomputed.
+// It's run before the first recompute, while severities of reported issues are still the reported ones.
+func (m *IssueManager) MigrateSeverityOverrides() (int, error) {
+	count := 0
+	obj := &issue.TargetIssue{}
+	iter := m.col.Find(bson.M{"vulnType": bson.M{"$gt": 0}, "severityOverride": bson.M{"$ne": true}}).
+		Select(bson.M{"activities": 1, "origin": 1, "severity": 1, "uniqId": 1}).Iter()
+	for iter.Next(obj) {
+		overridden, err := m.severityOverridden(obj)
+		if err != nil {
+			iter.Close()
+			return 0, err
+		}
+		if overridden {
+			if err := m.manager.updateId(m.col, obj.Id, bson.M{"$set": bson.M{"severityOverride": true}}); err != nil {
+				iter.Close()
+				return 0, err
+			}
+			count++
+		}
+		obj = &issue.TargetIssue{}
+	}
+	return count, iter.Close()
+}
+
+// The severity is set by a user if the issue is created by the user
+// or it differs from the severity of the first report
+func (m *IssueManager) severityOverridden(obj *issue.TargetIssue) (bool, error) {
+	first := obj.FirstReported()
+	if first == nil {
+		return false, nil
+	}
+	if first.Report == nil {
+		return true, nil
+	}
+	rep, err := m.manager.Reports.GetById(first.Report.Report)
+	if err != nil {
+		if m.manager.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, reported := range rep.GetAllIssues() {
+		if reported.UniqId == obj.UniqId {
+			return reportedSeverity(reported) != obj.Severity, nil
+		}
+	}
+	return false, nil
+}
+
+// severity of the reported issue as it's stored for the target
+func reportedSeverity(reported *issue.Issue) issue.Severity {
+	sev := *reported
+	sev.MapSeverity()
+	return sev.Severity
+}
+
+// Set new vulndb severities to issues of projects which opted in, issues with severities set by users are skipped.
+// Changes are added to the feed, summaries of affected targets are updated.
+func (m *IssueManager) RecomputeSeverities(changed map[int]issue.Severity) (int, error) {
+	if len(changed) == 0 {
+		return 0, nil
+	}
+	projects, _, err := m.manager.Projects.FilterByQuery(bson.M{"recomputeSeverity": true})
+	if err != nil || len(projects) == 0 {
+		return 0, err
+	}
+	projectIds := make([]bson.ObjectId, 0, len(projects))
+	for _, p := range projects {
+		projectIds = append(projectIds, p.Id)
+	}
+	vulnIds := make([]int, 0, len(changed))
+	for id := range changed {
+		vulnIds = append(vulnIds, id)
+	}
+	issues, _, err := m.FilterByQuery(bson.M{
+		"project":          bson.M{"$in": projectIds},
+		"vulnType":         bson.M{"$in": vulnIds},
+		"severityOverride": bson.M{"$ne": true},
+	})
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	targets := map[bson.ObjectId]bool{}
+	for _, obj := range issues {
+		from, to := obj.Severity, changed[obj.VulnType]
+		if from == to {
+			continue
+		}
+		obj.Severity = to
+		// the issue could be changed concurrently, others are recomputed anyway
+		if err := m.Update(obj); err != nil {
+			log.Errorf("Severity of issue %s isn't recomputed: %s", obj.Id.Hex(), err)
+			continue
+		}
+		if _, err := m.manager.Feed.AddSeverity(obj, from); err != nil {
+			log.Errorf("Severity change of issue %s isn't added to the feed: %s", obj.Id.Hex(), err)
+		}
+		targets[obj.Target] = true
+		count++
+	}
+	for id := range targets {
+		if err := m.manager.Targets.UpdateSummaryById(id); err != nil && !m.manager.IsNotFound(err) {
+			log.Errorf("Summary of target %s isn't updated: %s", id.Hex(), err)
+		}
+	}
+	return count, nil
+}
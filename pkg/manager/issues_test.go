@@ -0,0 +1,335 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/stats"
+	"github.com/bearded-web/bearded/pkg/tests"
+)
+
+func TestScanSummary(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := New(mongo.DB(dbName))
+
+	scanId, other := bson.NewObjectId(), bson.NewObjectId()
+	create := func(sc bson.ObjectId, severity issue.Severity, status issue.Status) *issue.TargetIssue {
+		obj, err := mgr.Issues.Create(&issue.TargetIssue{
+			Target:  bson.NewObjectId(),
+			Project: bson.NewObjectId(),
+			Issue:   issue.Issue{Severity: severity},
+			Status:  status,
+			Activities: []*issue.Activity{
+				{Type: issue.ActivityReported, Report: &issue.Report{Report: bson.NewObjectId(), Scan: sc}},
+			},
+		})
+		require.NoError(t, err)
+		return obj
+	}
+	create(scanId, issue.SeverityHigh, issue.Status{})
+	create(scanId, issue.SeverityHigh, issue.Status{Confirmed: true})
+	baseline := create(scanId, issue.SeverityMedium, issue.Status{})
+	create(scanId, issue.SeverityLow, issue.Status{Resolved: true})
+	// false and muted issues aren't counted, neither are issues of other scans
+	create(scanId, issue.SeverityHigh, issue.Status{False: true})
+	create(scanId, issue.SeverityHigh, issue.Status{Muted: true})
+	create(other, issue.SeverityHigh, issue.Status{})
+
+	summary, err := mgr.Issues.GetScanSummary(scanId, "")
+	require.NoError(t, err)
+	require.Equal(t, map[issue.Severity]int{
+		issue.SeverityHigh:   2,
+		issue.SeverityMedium: 1,
+		issue.SeverityLow:    1,
+	}, summary)
+
+	baselineId := bson.NewObjectId()
+	count, err := mgr.Issues.SetBaseline(bson.M{"_id": baseline.Id}, baselineId)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	summary, err = mgr.Issues.GetScanSummary(scanId, baselineId)
+	require.NoError(t, err)
+	require.Equal(t, map[issue.Severity]int{
+		issue.SeverityHigh: 2,
+		issue.SeverityLow:  1,
+	}, summary)
+
+	// issues of another baseline are counted
+	summary, err = mgr.Issues.GetScanSummary(scanId, bson.NewObjectId())
+	require.NoError(t, err)
+	require.Equal(t, 1, summary[issue.SeverityMedium])
+
+	summary, err = mgr.Issues.GetScanSummary(bson.NewObjectId(), "")
+	require.NoError(t, err)
+	require.Empty(t, summary)
+}
+
+func TestMigrateBaselines(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := New(mongo.DB(dbName))
+
+	p, err := mgr.Projects.Create(&project.Project{Name: "baseline", Owner: bson.NewObjectId()})
+	require.NoError(t, err)
+	known, err := mgr.Issues.Create(&issue.TargetIssue{Target: bson.NewObjectId(), Project: p.Id})
+	require.NoError(t, err)
+	other, err := mgr.Issues.Create(&issue.TargetIssue{Target: bson.NewObjectId(), Project: p.Id})
+	require.NoError(t, err)
+	// baselines were stored with issue ids in the project
+	require.NoError(t, mgr.Projects.col.UpdateId(p.Id, bson.M{"$set": bson.M{
+		"baseline": bson.M{"issues": []bson.ObjectId{known.Id}, "updated": time.Now().UTC()},
+	}}))
+
+	migrated, err := mgr.Projects.MigrateBaselines()
+	require.NoError(t, err)
+	require.Equal(t, 1, migrated)
+	p, err = mgr.Projects.GetById(p.Id)
+	require.NoError(t, err)
+	require.NotEqual(t, bson.ObjectId(""), p.Baseline.Id)
+	require.Equal(t, 1, p.Baseline.Count)
+	count, err := mgr.Projects.col.Find(bson.M{"baseline.issues": bson.M{"$exists": true}}).Count()
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	known, err = mgr.Issues.GetById(known.Id)
+	require.NoError(t, err)
+	require.Equal(t, p.Baseline.Id, known.Baseline)
+	other, err = mgr.Issues.GetById(other.Id)
+	require.NoError(t, err)
+	require.Equal(t, bson.ObjectId(""), other.Baseline)
+
+	migrated, err = mgr.Projects.MigrateBaselines()
+	require.NoError(t, err)
+	require.Equal(t, 0, migrated)
+}
+
+func TestMigrateSeverities(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := New(mongo.DB(dbName))
+
+	// issues are stored as is, like they were before the scheme
+	create := func(severity issue.Severity, cvss float64) bson.ObjectId {
+		id := bson.NewObjectId()
+		require.NoError(t, mgr.Issues.col.Insert(&issue.TargetIssue{
+			Id:     id,
+			Target: bson.NewObjectId(),
+			Issue:  issue.Issue{Severity: severity, Cvss: cvss},
+		}))
+		return id
+	}
+	expected := map[bson.ObjectId]issue.Severity{
+		create("critical", 0):            issue.SeverityHigh,
+		create("Moderate", 0):            issue.SeverityMedium,
+		create("urgent", 9.8):            issue.SeverityHigh,
+		create("urgent", 0):              issue.SeverityInfo,
+		create(issue.SeverityLow, 9.8):   issue.SeverityLow,
+		create(issue.SeverityError, 9.8): issue.SeverityError,
+	}
+
+	migrated, err := mgr.Issues.MigrateSeverities()
+	require.NoError(t, err)
+	require.Equal(t, 4, migrated)
+	for id, severity := range expected {
+		obj, err := mgr.Issues.GetById(id)
+		require.NoError(t, err)
+		require.Equal(t, severity, obj.Severity)
+		require.Equal(t, severity.Level(), obj.Level)
+	}
+
+	migrated, err = mgr.Issues.MigrateSeverities()
+	require.NoError(t, err)
+	require.Equal(t, 0, migrated)
+}
+
+func TestMigrateSeverityOverrides(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := New(mongo.DB(dbName))
+
+	rep, err := mgr.Reports.Create(&report.Report{Type: report.TypeIssues, Issues: []*issue.Issue{
+		{UniqId: "xss", VulnType: 1, Severity: "Moderate"},
+		{UniqId: "sqli", VulnType: 2, Severity: issue.SeverityHigh},
+	}})
+	require.NoError(t, err)
+	create := func(uniqId string, severity issue.Severity, reported bool) bson.ObjectId {
+		obj := &issue.TargetIssue{
+			Id:     bson.NewObjectId(),
+			Target: bson.NewObjectId(),
+			Issue:  issue.Issue{UniqId: uniqId, VulnType: 1, Severity: severity},
+		}
+		if reported {
+			obj.AddReportActivity(rep.Id, bson.NewObjectId(), bson.NewObjectId(), "barbudo/w3af:0.1")
+		} else {
+			obj.AddUserReportActivity(bson.NewObjectId())
+		}
+		require.NoError(t, mgr.Issues.col.Insert(obj))
+		return obj.Id
+	}
+	expected := map[bson.ObjectId]bool{
+		// the reported severity is mapped to the scheme
+		create("xss", issue.SeverityMedium, true): false,
+		create("sqli", issue.SeverityLow, true):   true,
+		create("user", issue.SeverityLow, false):  true,
+		create("gone", issue.SeverityLow, true):   false,
+	}
+
+	marked, err := mgr.Issues.MigrateSeverityOverrides()
+	require.NoError(t, err)
+	require.Equal(t, 2, marked)
+	for id, override := range expected {
+		obj, err := mgr.Issues.GetById(id)
+		require.NoError(t, err)
+		require.Equal(t, override, obj.SeverityOverride)
+	}
+
+	marked, err = mgr.Issues.MigrateSeverityOverrides()
+	require.NoError(t, err)
+	require.Equal(t, 0, marked)
+}
+
+func TestRecomputeSeverities(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := New(mongo.DB(dbName))
+
+	optedIn, err := mgr.Projects.Create(&project.Project{Name: "opted in", Owner: bson.NewObjectId(), RecomputeSeverity: true})
+	require.NoError(t, err)
+	other, err := mgr.Projects.Create(&project.Project{Name: "other", Owner: bson.NewObjectId()})
+	require.NoError(t, err)
+	create := func(p *project.Project, vulnType int, override bool) bson.ObjectId {
+		obj, err := mgr.Issues.Create(&issue.TargetIssue{
+			Project:          p.Id,
+			Target:           bson.NewObjectId(),
+			SeverityOverride: override,
+			Issue:            issue.Issue{Summary: bson.NewObjectId().Hex(), VulnType: vulnType, Severity: issue.SeverityLow},
+		})
+		require.NoError(t, err)
+		return obj.Id
+	}
+	expected := map[bson.ObjectId]issue.Severity{
+		create(optedIn, 1, false): issue.SeverityHigh,
+		create(optedIn, 1, true):  issue.SeverityLow,
+		create(optedIn, 2, false): issue.SeverityLow,
+		create(other, 1, false):   issue.SeverityLow,
+	}
+
+	updated, err := mgr.Issues.RecomputeSeverities(map[int]issue.Severity{1: issue.SeverityHigh})
+	require.NoError(t, err)
+	require.Equal(t, 1, updated)
+	for id, severity := range expected {
+		obj, err := mgr.Issues.GetById(id)
+		require.NoError(t, err)
+		require.Equal(t, severity, obj.Severity)
+	}
+}
+
+func TestRiskIssues(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := New(mongo.DB(dbName))
+
+	to := time.Date(2015, 6, 10, 12, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, -7)
+	targetId := bson.NewObjectId()
+	create := func(created time.Time, status issue.Status, resolvedAt time.Time) {
+		require.NoError(t, mgr.Issues.Import(&issue.TargetIssue{
+			Id:         bson.NewObjectId(),
+			Target:     targetId,
+			Project:    bson.NewObjectId(),
+			Issue:      issue.Issue{Severity: issue.SeverityHigh, UniqId: bson.NewObjectId().Hex()},
+			Created:    created,
+			Status:     status,
+			ResolvedAt: resolvedAt,
+		}))
+	}
+	// issues of the same day are counted together
+	create(time.Date(2015, 6, 5, 10, 0, 0, 0, time.UTC), issue.Status{}, time.Time{})
+	create(time.Date(2015, 6, 5, 15, 0, 0, 0, time.UTC), issue.Status{}, time.Time{})
+	// the start of the day isn't rounded, so it's in the same group
+	create(time.Date(2015, 6, 6, 0, 0, 0, 0, time.UTC), issue.Status{}, time.Time{})
+	// times of the last day are kept
+	create(time.Date(2015, 6, 10, 9, 0, 0, 0, time.UTC), issue.Status{}, time.Time{})
+	create(time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC), issue.Status{Resolved: true}, time.Date(2015, 6, 10, 11, 0, 0, 0, time.UTC))
+	// resolved before the period, false and muted issues aren't taken
+	create(time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC), issue.Status{Resolved: true}, time.Date(2015, 6, 2, 0, 0, 0, 0, time.UTC))
+	create(time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC), issue.Status{False: true}, time.Time{})
+	create(time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC), issue.Status{Muted: true}, time.Time{})
+
+	issues, err := mgr.Issues.GetRiskIssues(bson.M{"target": targetId}, from, to)
+	require.NoError(t, err)
+	require.Len(t, issues, 3)
+	found := map[time.Time]*stats.RiskIssue{}
+	for _, obj := range issues {
+		require.Equal(t, targetId, obj.Target)
+		require.Equal(t, issue.SeverityHigh, obj.Severity)
+		found[obj.Created.UTC()] = obj
+	}
+	require.Equal(t, 3, found[time.Date(2015, 6, 6, 0, 0, 0, 0, time.UTC)].Count, "times are rounded up to the next day")
+	require.Equal(t, 1, found[time.Date(2015, 6, 10, 9, 0, 0, 0, time.UTC)].Count)
+	resolved := found[time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)]
+	require.True(t, resolved.Resolved)
+	require.Equal(t, time.Date(2015, 6, 10, 11, 0, 0, 0, time.UTC), resolved.ResolvedAt.UTC())
+}
+
+func TestMergeCwes(t *testing.T) {
+	a, b, c := bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()
+	group := func(vulnType, count int, severity issue.Severity, targets ...bson.ObjectId) *topGroup {
+		g := &topGroup{Count: count, Level: severity.Level(), Targets: targets}
+		g.Key.VulnType = vulnType
+		return g
+	}
+	cwes := map[int][]string{
+		1: {"79"},
+		2: {"79", "80"},
+		3: {"89"},
+		4: {"352"},
+	}
+	merged := mergeCwes([]*topGroup{
+		group(1, 3, issue.SeverityMedium, a, b),
+		group(2, 2, issue.SeverityHigh, b, c),
+		group(3, 2, issue.SeverityHigh, a),
+		group(4, 5, issue.SeverityLow, a),
+		// types without cwes aren't counted
+		group(5, 10, issue.SeverityHigh, a),
+	}, func(vulnType int) []string { return cwes[vulnType] })
+
+	tops := []*stats.TopVuln{}
+	for _, cg := range merged {
+		tops = append(tops, cg.top)
+	}
+	require.Equal(t, []*stats.TopVuln{
+		{Cwe: "79", Title: "CWE-79", Severity: issue.SeverityHigh, Count: 5, Targets: 3},
+		{Cwe: "352", Title: "CWE-352", Severity: issue.SeverityLow, Count: 5, Targets: 1},
+		// the same count and severity are sorted by ids
+		{Cwe: "80", Title: "CWE-80", Severity: issue.SeverityHigh, Count: 2, Targets: 2},
+		{Cwe: "89", Title: "CWE-89", Severity: issue.SeverityHigh, Count: 2, Targets: 1},
+	}, tops, "types are merged into every their cwe, the most common and dangerous go first")
+
+	require.Empty(t, mergeCwes(nil, func(int) []string { return nil }))
+}
@@ -0,0 +1,95 @@
+package manager
+
+// Agent logs manager
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/agent"
+)
+
+// logs are removed by mongo after this time if ManagerConfig.AgentLogExpire is not set
+const DefaultAgentLogExpire = time.Hour * 24 * 7
+
+type LogManager struct {
+	manager *Manager
+	col     *mgo.Collection
+}
+
+func (s *LogManager) Init() error {
+	log.Infof("Initialize agent log indexes")
+	err := s.col.EnsureIndex(mgo.Index{
+		Key:        []string{"session", "_id"},
+		Background: true,
+	})
+	if err != nil {
+		return err
+	}
+	expire := s.manager.Cfg.AgentLogExpire
+	if expire == 0 {
+		expire = DefaultAgentLogExpire
+	}
+	return s.manager.ensureTTLIndex(s.col, mgo.Index{
+		Key:         []string{"created"},
+		Background:  true,
+		ExpireAfter: expire,
+	})
+}
+
+// Get session logs created after the log with id, ordered from the oldest. All logs are returned for empty id.
+func (m *LogManager) GetBySession(sessionId bson.ObjectId, after bson.ObjectId) ([]*agent.Log, error) {
+	query := bson.M{"session": sessionId}
+	if after != "" {
+		query["_id"] = bson.M{"$gt": after}
+	}
+	results := []*agent.Log{}
+	return results, m.manager.run(func() error { return m.col.Find(query).Sort("_id").All(&results) })
+}
+
+// Create the log chunk and remove the oldest chunks of the session if they are bigger than maxSize.
+// Zero maxSize means no limit.
+func (m *LogManager) Create(raw *agent.Log, maxSize int) (*agent.Log, error) {
+	raw.Id = bson.NewObjectId()
+	raw.Created = time.Now().UTC()
+	raw.Size = len(raw.Data)
+	if err := m.col.Insert(raw); err != nil {
+		return nil, err
+	}
+	if maxSize > 0 {
+		if err := m.rotate(raw.Session, maxSize); err != nil {
+			return nil, err
+		}
+	}
+	return raw, nil
+}
+
+func (m *LogManager) rotate(sessionId bson.ObjectId, maxSize int) error {
+	chunks := []struct {
+		Id   bson.ObjectId `bson:"_id"`
+		Size int
+	}{}
+	err := m.col.Find(bson.M{"session": sessionId}).
+		Select(bson.M{"_id": 1, "size": 1}).
+		Sort("-_id").
+		All(&chunks)
+	if err != nil {
+		return err
+	}
+	total := 0
+	old := []bson.ObjectId{}
+	for _, chunk := range chunks {
+		total += chunk.Size
+		// the last chunk is always kept
+		if total > maxSize && chunk.Id != chunks[0].Id {
+			old = append(old, chunk.Id)
+		}
+	}
+	if len(old) == 0 {
+		return nil
+	}
+	_, err = m.col.RemoveAll(bson.M{"_id": bson.M{"$in": old}})
+	return err
+}
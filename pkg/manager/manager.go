@@ -1,14 +1,48 @@
 package manager
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"time"
 
+	"github.com/facebookgo/stackerr"
+	"golang.org/x/net/context"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/pkg/logging"
 )
 
+var log = logging.Logger(logging.Manager)
+
+// returned by versioned updates when the object was changed after it had been read
+var ErrVersionConflict = errors.New("object version conflict")
+
 type ManagerConfig struct {
 	TextSearchEnable bool
+	// default language of text indexes, DefaultTextLanguage is used if empty
+	TextLanguage string
+	// weights of text index fields by collection.field
+	TextWeights map[string]int
+	// how long idempotency records are kept, DefaultIdempotencyExpire is used if zero
+	IdempotencyExpire time.Duration
+	// how long agent logs are kept, DefaultAgentLogExpire is used if zero
+	AgentLogExpire time.Duration
+	// deliveries kept for every webhook subscription, DefaultWebhookHistory is used if zero
+	WebhookHistory int
+	// plugin dry runs are removed by mongo after this time, DefaultDryRunExpire is used if zero
+	DryRunExpire time.Duration
+	// last use of a token is saved at most once per the interval, DefaultTokenTouchInterval is used if zero
+	TokenTouchInterval time.Duration
+	// tokens which aren't used longer are marked as stale in lists, they aren't marked if zero
+	TokenStaleAfter time.Duration
+	// queries which take longer are logged, nothing is logged if zero
+	SlowQuery time.Duration
+	// timings of queries, shared by copies of the manager, they aren't counted if nil
+	Queries *QueryStats
+	// reads of users are limited to their projects, see Scope
+	Isolation bool
 }
 
 // query options
@@ -23,8 +57,10 @@ type ManagerInterface interface {
 }
 
 type Manager struct {
-	db  *mgo.Database
-	Cfg ManagerConfig
+	db    *mgo.Database
+	ctx   context.Context
+	scope *Scope
+	Cfg   ManagerConfig
 
 	Users    *UserManager
 	Plugins  *PluginManager
@@ -33,6 +69,7 @@ type Manager struct {
 	Plans    *PlanManager
 	Scans    *ScanManager
 	Agents   *AgentManager
+	Logs     *LogManager
 	Reports  *ReportManager
 	Feed     *FeedManager
 	Files    *FileManager
@@ -40,6 +77,18 @@ type Manager struct {
 	Issues   *IssueManager
 	Techs    *TechManager
 	Tokens   *TokenManager
+	Searches *SearchManager
+
+	Idempotency  *IdempotencyManager
+	Audit        *AuditManager
+	Incidents    *IncidentManager
+	Webhooks     *WebhookManager
+	Campaigns    *CampaignManager
+	Shares       *ShareManager
+	Remediations *RemediationManager
+	Templates    *TemplateManager
+	Settings     *SettingsManager
+	Usage        *UsageManager
 
 	Permission *PermissionManager
 	Vulndb     *VulndbManager
@@ -66,6 +115,7 @@ func New(db *mgo.Database, cfg ...ManagerConfig) *Manager {
 	m.Plans = &PlanManager{manager: m, col: db.C("plans")}
 	m.Scans = &ScanManager{manager: m, col: db.C("scans")}
 	m.Agents = &AgentManager{manager: m, col: db.C("agents")}
+	m.Logs = &LogManager{manager: m, col: db.C("agent_logs")}
 	m.Reports = &ReportManager{manager: m, col: db.C("reports")}
 	m.Feed = &FeedManager{manager: m, col: db.C("feed")}
 	m.Files = &FileManager{manager: m, grid: db.GridFS("fs")}
@@ -73,9 +123,20 @@ func New(db *mgo.Database, cfg ...ManagerConfig) *Manager {
 	m.Issues = &IssueManager{manager: m, col: db.C("issues")}
 	m.Techs = &TechManager{manager: m, col: db.C("techs")}
 	m.Tokens = &TokenManager{manager: m, col: db.C("tokens")}
+	m.Searches = &SearchManager{manager: m, col: db.C("searches")}
+	m.Idempotency = &IdempotencyManager{manager: m, col: db.C("idempotency")}
+	m.Audit = &AuditManager{manager: m, col: db.C("audit"), state: db.C("audit_state")}
+	m.Incidents = &IncidentManager{manager: m, col: db.C("incidents")}
+	m.Webhooks = &WebhookManager{manager: m, col: db.C("webhook_deliveries")}
+	m.Campaigns = &CampaignManager{manager: m, col: db.C("campaigns")}
+	m.Shares = &ShareManager{manager: m, col: db.C("shares")}
+	m.Remediations = &RemediationManager{manager: m, col: db.C("remediations")}
+	m.Templates = &TemplateManager{manager: m, col: db.C("scan_templates")}
+	m.Settings = &SettingsManager{manager: m, col: db.C("settings")}
+	m.Usage = &UsageManager{manager: m, col: db.C("usage")}
 
 	m.Permission = &PermissionManager{manager: m}
-	m.Vulndb = &VulndbManager{manager: m}
+	m.Vulndb = &VulndbManager{manager: m, state: db.C("vulndb_state")}
 
 	m.managers = append(m.managers,
 		m.Users,
@@ -85,6 +146,7 @@ func New(db *mgo.Database, cfg ...ManagerConfig) *Manager {
 		m.Plans,
 		m.Scans,
 		m.Agents,
+		m.Logs,
 		m.Reports,
 		m.Feed,
 		m.Files,
@@ -92,6 +154,17 @@ func New(db *mgo.Database, cfg ...ManagerConfig) *Manager {
 		m.Issues,
 		m.Techs,
 		m.Tokens,
+		m.Searches,
+		m.Idempotency,
+		m.Audit,
+		m.Incidents,
+		m.Webhooks,
+		m.Campaigns,
+		m.Shares,
+		m.Remediations,
+		m.Templates,
+		m.Settings,
+		m.Usage,
 
 		m.Permission,
 		m.Vulndb,
@@ -110,6 +183,47 @@ func (m *Manager) Init() error {
 	return nil
 }
 
+// MissingIndexes returns collections which have only the default _id index, so Init wasn't run on the db
+func (m *Manager) MissingIndexes() ([]string, error) {
+	cols := []*mgo.Collection{
+		m.Users.col,
+		m.Plugins.col,
+		m.Projects.col,
+		m.Targets.col,
+		m.Plans.col,
+		m.Scans.col,
+		m.Agents.col,
+		m.Logs.col,
+		m.Reports.col,
+		m.Feed.col,
+		m.Comments.col,
+		m.Issues.col,
+		m.Techs.col,
+		m.Tokens.col,
+		m.Searches.col,
+		m.Idempotency.col,
+		m.Audit.col,
+		m.Incidents.col,
+		m.Webhooks.col,
+		m.Campaigns.col,
+		m.Shares.col,
+		m.Remediations.col,
+		m.Templates.col,
+		m.Usage.col,
+	}
+	missing := []string{}
+	for _, col := range cols {
+		indexes, err := col.Indexes()
+		if err != nil {
+			return nil, fmt.Errorf("can't get indexes of %s: %s", col.Name, err)
+		}
+		if len(indexes) <= 1 {
+			missing = append(missing, col.Name)
+		}
+	}
+	return missing, nil
+}
+
 // Get copy of manager with copied session, don't forget to call Close after
 func (m *Manager) Copy() *Manager {
 	sess := m.db.Session.Copy()
@@ -120,6 +234,31 @@ func (m *Manager) Copy() *Manager {
 	return copy
 }
 
+// operations get at least this time, so the deadline which is about to pass doesn't break the session
+const minSocketTimeout = 100 * time.Millisecond
+
+// CopyCtx works like Copy, but db operations fail after the context deadline
+func (m *Manager) CopyCtx(ctx context.Context) *Manager {
+	copy := m.Copy()
+	copy.ctx = ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := deadline.Sub(time.Now())
+		if timeout < minSocketTimeout {
+			timeout = minSocketTimeout
+		}
+		copy.db.Session.SetSocketTimeout(timeout)
+	}
+	return copy
+}
+
+// Context of the manager, background if the manager isn't created with CopyCtx
+func (m *Manager) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
 // Clone works just like Copy, but also reuses the same socket as the original
 // session, in case it had already reserved one due to its consistency
 // guarantees.  This behavior ensures that writes performed in the old session
@@ -128,7 +267,7 @@ func (m *Manager) Copy() *Manager {
 // may cause other goroutines using the original session to wait.
 func (m *Manager) Clone() *Manager {
 	sess := m.db.Session.Clone()
-	return New(m.db.With(sess))
+	return New(m.db.With(sess), m.Cfg)
 }
 
 // Close terminates the session.  It's a runtime error to use a session
@@ -139,9 +278,9 @@ func (m *Manager) Close() {
 
 // Different methods which help to hide all database things
 
-// Return true if object is not found
+// Return true if object is not found, errors of files are wrapped with stack
 func (m *Manager) IsNotFound(err error) bool {
-	return err == mgo.ErrNotFound
+	return err == mgo.ErrNotFound || stackerr.HasUnderlying(err, stackerr.Equals(mgo.ErrNotFound))
 }
 
 // IsDup returns whether err informs of a duplicate key error because
@@ -151,6 +290,24 @@ func (m *Manager) IsDup(err error) bool {
 	return mgo.IsDup(err)
 }
 
+// Return true if the operation failed because of the context deadline
+func (m *Manager) IsTimeout(err error) bool {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	return err == context.DeadlineExceeded || m.Context().Err() == context.DeadlineExceeded
+}
+
+// Return true if the operation is aborted because the context is canceled or its deadline is passed
+func (m *Manager) IsCanceled(err error) bool {
+	return err == context.Canceled || m.IsTimeout(err)
+}
+
+// Return true if object was modified by someone else
+func (m *Manager) IsVersionConflict(err error) bool {
+	return err == ErrVersionConflict
+}
+
 // IsId returns whether id is in a valid form (bson ObjectId hex format)
 func (m *Manager) IsId(id string) bool {
 	return bson.IsObjectIdHex(id)
@@ -172,10 +329,20 @@ func (m *Manager) All(col *mgo.Collection, results interface{}) (int, error) {
 }
 
 func (m *Manager) GetById(col *mgo.Collection, id bson.ObjectId, result interface{}) error {
-	return col.FindId(id).One(result)
+	query, err := m.scopeQuery(col, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	return m.timed(col, "findOne", query, func() error {
+		return col.Find(query).One(result)
+	})
 }
 
 func (m *Manager) GetBy(col *mgo.Collection, query *bson.M, result interface{}, opts ...Opts) error {
+	query, err := m.scopeQueryP(col, query)
+	if err != nil {
+		return err
+	}
 	q := col.Find(query)
 	for _, opt := range opts {
 		if opt.Limit != 0 {
@@ -188,7 +355,29 @@ func (m *Manager) GetBy(col *mgo.Collection, query *bson.M, result interface{},
 			q.Sort(opt.Sort...)
 		}
 	}
-	return q.One(result)
+	return m.timed(col, "findOne", query, func() error {
+		return q.One(result)
+	})
+}
+
+// UpdateVersion replaces the object only if its version in db is still equal to version.
+// Returns ErrVersionConflict if the object was updated by someone else and mgo.ErrNotFound if it's removed.
+func (m *Manager) UpdateVersion(col *mgo.Collection, id bson.ObjectId, version int, obj interface{}) error {
+	query := bson.M{"_id": id, "version": version}
+	if version == 0 {
+		// objects created before versioning don't have the field
+		query["version"] = bson.M{"$in": []interface{}{0, nil}}
+	}
+	err := m.update(col, query, obj)
+	if err == mgo.ErrNotFound {
+		// objects out of the scope are reported as not found
+		if existed, qErr := m.scopeQuery(col, bson.M{"_id": id}); qErr != nil {
+			return qErr
+		} else if count, cErr := m.count(col, existed); cErr == nil && count > 0 {
+			return ErrVersionConflict
+		}
+	}
+	return err
 }
 
 func (m *Manager) NewId() bson.ObjectId {
@@ -196,6 +385,10 @@ func (m *Manager) NewId() bson.ObjectId {
 }
 
 func (m *Manager) FilterBy(col *mgo.Collection, query *bson.M, results interface{}, opts ...Opts) (int, error) {
+	query, err := m.scopeQueryP(col, query)
+	if err != nil {
+		return 0, err
+	}
 	q := col.Find(query)
 	for _, opt := range opts {
 		if opt.Limit != 0 {
@@ -208,31 +401,75 @@ func (m *Manager) FilterBy(col *mgo.Collection, query *bson.M, results interface
 			q.Sort(opt.Sort...)
 		}
 	}
-	if err := q.All(results); err != nil {
-		return 0, err
-	}
-	q.Limit(0)
-	q.Skip(0)
-	count, err := q.Count()
-	if err != nil {
+	if err := m.timed(col, "find", query, func() error { return q.All(results) }); err != nil {
 		return 0, err
 	}
-	return count, nil
+	return m.count(col, query)
 }
 
 func (m *Manager) FilterAndSortBy(col *mgo.Collection, query *bson.M, sort []string, results interface{}) (int, error) {
+	query, err := m.scopeQueryP(col, query)
+	if err != nil {
+		return 0, err
+	}
 	q := col.Find(query)
 	if sort != nil && len(sort) > 0 {
 		q.Sort(sort...)
 	}
-	if err := q.All(results); err != nil {
+	if err := m.timed(col, "find", query, func() error { return q.All(results) }); err != nil {
 		return 0, err
 	}
-	count, err := q.Count()
-	if err != nil {
-		return 0, err
+	return m.count(col, query)
+}
+
+func (m *Manager) count(col *mgo.Collection, query interface{}) (int, error) {
+	count := 0
+	err := m.timed(col, "count", query, func() error {
+		var err error
+		count, err = col.Find(query).Count()
+		return err
+	})
+	return count, err
+}
+
+// run the db read until the manager context is done.
+// Mongo driver can't cancel the operation, so it's left in background until the socket timeout
+// set by CopyCtx and the caller gets the context error without waiting for it.
+// Writes should use write, so the caller doesn't get an error for changes which are still applied.
+func (m *Manager) run(op func() error) error {
+	ctx := m.Context()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		// background context is never done
+		return op()
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			// the session could be closed by the caller who doesn't wait for the operation anymore
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("db operation panic: %v", r)
+			}
+		}()
+		done <- op()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// write runs the db write if the manager context isn't done yet and waits for its result,
+// the write is limited by the socket timeout set by CopyCtx
+func (m *Manager) write(op func() error) error {
+	if err := m.Context().Err(); err != nil {
+		return err
 	}
-	return count, nil
+	return op()
 }
 
 func (m *Manager) Opts(skip, limit int, sort []string) Opts {
@@ -0,0 +1,259 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/token"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/tests"
+)
+
+func TestManagerContext(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+
+	mgr := New(mongo.DB(dbName))
+	col := mgr.db.C("slow")
+	for i := 0; i < 10; i++ {
+		require.NoError(t, col.Insert(bson.M{"i": i}))
+	}
+	// every document takes 200ms, so the whole query runs about 2 seconds
+	slow := &bson.M{"$where": "sleep(200) || true"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctxMgr := mgr.CopyCtx(ctx)
+	defer ctxMgr.Close()
+	time.AfterFunc(time.Millisecond*100, cancel)
+	start := time.Now()
+	results := []bson.M{}
+	_, err = ctxMgr.FilterBy(ctxMgr.db.C("slow"), slow, &results)
+	require.Equal(t, context.Canceled, err)
+	require.True(t, ctxMgr.IsCanceled(err))
+	require.True(t, time.Now().Sub(start) < time.Second, "canceled query should stop")
+
+	// canceled manager doesn't start new queries
+	_, err = ctxMgr.FilterBy(ctxMgr.db.C("slow"), &bson.M{}, &results)
+	require.Equal(t, context.Canceled, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	deadlineMgr := mgr.CopyCtx(ctx)
+	defer deadlineMgr.Close()
+	err = deadlineMgr.GetBy(deadlineMgr.db.C("slow"), slow, &bson.M{}, Opts{Skip: 9})
+	require.True(t, deadlineMgr.IsTimeout(err), "got %v", err)
+
+	// background context doesn't limit queries
+	count, err := mgr.FilterBy(col, &bson.M{}, &results)
+	require.NoError(t, err)
+	require.Equal(t, 10, count)
+
+	// started writes are waited for, so the caller doesn't get an error for applied changes
+	ctx, cancel = context.WithCancel(context.Background())
+	writeMgr := mgr.CopyCtx(ctx)
+	defer writeMgr.Close()
+	time.AfterFunc(time.Millisecond*100, cancel)
+	info, err := writeMgr.updateAll(writeMgr.db.C("slow"), bson.M{"$where": "sleep(50) || true"},
+		bson.M{"$set": bson.M{"done": true}})
+	require.NoError(t, err)
+	require.Equal(t, 10, info.Updated)
+	// writes aren't started after the context is done
+	_, err = writeMgr.updateAll(writeMgr.db.C("slow"), bson.M{}, bson.M{"$set": bson.M{"done": false}})
+	require.Equal(t, context.Canceled, err)
+	count, err = mgr.count(col, bson.M{"done": true})
+	require.NoError(t, err)
+	require.Equal(t, 10, count)
+}
+
+func TestTextIndex(t *testing.T) {
+	mgr := &Manager{}
+	index := mgr.textIndex("issue", []string{"summary", "desc"}, map[string]int{"summary": 10, "desc": 1})
+	require.Equal(t, []string{"$text:summary", "$text:desc"}, index.Key)
+	require.Equal(t, map[string]int{"summary": 10, "desc": 1}, index.Weights)
+	require.Equal(t, DefaultTextLanguage, index.DefaultLanguage)
+
+	mgr.Cfg.TextLanguage = "russian"
+	mgr.Cfg.TextWeights = map[string]int{"issue.desc": 5, "tech.name": 2}
+	index = mgr.textIndex("issue", []string{"summary", "desc"}, map[string]int{"summary": 10, "desc": 1})
+	require.Equal(t, map[string]int{"summary": 10, "desc": 5}, index.Weights)
+	require.Equal(t, "russian", index.DefaultLanguage)
+
+	require.False(t, isIndexConflict(nil))
+	require.True(t, isIndexConflict(&mgo.QueryError{Code: 85}))
+}
+
+func TestTTLIndex(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+
+	// the expiry setting is changed between starts
+	mgr := New(mongo.DB(dbName), ManagerConfig{IdempotencyExpire: time.Hour})
+	require.NoError(t, mgr.Idempotency.Init())
+	mgr = New(mongo.DB(dbName), ManagerConfig{IdempotencyExpire: 2 * time.Hour})
+	require.NoError(t, mgr.Idempotency.Init())
+
+	indexes, err := mgr.Idempotency.col.Indexes()
+	require.NoError(t, err)
+	for _, index := range indexes {
+		if index.Name == "created_1" {
+			require.Equal(t, 2*time.Hour, index.ExpireAfter)
+			return
+		}
+	}
+	t.Fatal("ttl index isn't found")
+}
+
+func TestIndexReports(t *testing.T) {
+	before := map[string][]string{"scans": {"_id_", "project_1"}}
+	after := map[string][]string{
+		"scans":  {"_id_", "project_1", "group_1"},
+		"issues": {"_id_"},
+	}
+	reports := indexReports(before, after)
+	require.Len(t, reports, 2)
+	require.Equal(t, &IndexReport{Collection: "issues", Created: []string{"_id_"}, Total: 1}, reports[0])
+	require.Equal(t, &IndexReport{Collection: "scans", Created: []string{"group_1"}, Total: 3}, reports[1])
+}
+
+func TestQueryShape(t *testing.T) {
+	query := &bson.M{
+		"project": bson.NewObjectId(),
+		"status":  bson.M{"$in": []interface{}{"open", "fixed"}},
+		"$or":     []bson.M{{"summary": "secret"}},
+	}
+	require.Equal(t, `{"$or":[{"summary":"?"}],"project":"?","status":{"$in":["?","?"]}}`, QueryShape(query))
+	require.Equal(t, `{"_id":"?"}`, QueryShape(bson.M{"_id": bson.NewObjectId()}))
+	require.Equal(t, "null", QueryShape(nil))
+}
+
+func TestQueryStats(t *testing.T) {
+	stats := NewQueryStats()
+	stats.add("scans", "find", 10*time.Millisecond, false)
+	stats.add("scans", "find", 30*time.Millisecond, true)
+	stats.add("issues", "count", 5*time.Millisecond, false)
+	list := stats.List()
+	require.Len(t, list, 2)
+	require.Equal(t, &QueryStat{Collection: "scans", Op: "find", Count: 2, Slow: 1, Total: 40, Max: 30}, list[0])
+	require.Equal(t, "issues", list[1].Collection)
+}
+
+func TestTokenTouchThrottled(t *testing.T) {
+	mgr := &Manager{}
+	tokens := &TokenManager{manager: mgr}
+	now := time.Now().UTC()
+	tkn := &token.Token{LastUsed: now.Add(-time.Minute), LastIp: "10.0.0.1"}
+	// the token is used recently, so the collection isn't touched
+	touched, err := tokens.Touch(tkn, "10.0.0.2", now)
+	require.NoError(t, err)
+	require.False(t, touched)
+	require.Equal(t, "10.0.0.1", tkn.LastIp)
+}
+
+func TestTokenIsStale(t *testing.T) {
+	now := time.Now().UTC()
+	since := now.Add(-24 * time.Hour)
+	require.True(t, (&token.Token{Created: now.Add(-48 * time.Hour)}).IsStale(since))
+	require.False(t, (&token.Token{Created: now.Add(-48 * time.Hour), LastUsed: now}).IsStale(since))
+	require.False(t, (&token.Token{Created: now}).IsStale(since))
+	require.False(t, (&token.Token{Created: now.Add(-48 * time.Hour), Removed: true}).IsStale(since))
+}
+
+func TestScopeQuery(t *testing.T) {
+	mgr := &Manager{Permission: &PermissionManager{}}
+	mgr.Permission.SetAdmins([]string{"admin@example.com"})
+	projectId := bson.NewObjectId()
+	service := &user.User{Id: bson.NewObjectId(), Project: projectId}
+	require.Nil(t, mgr.ScopeFor(service), "isolation is disabled")
+
+	mgr.Cfg.Isolation = true
+	require.Nil(t, mgr.ScopeFor(&user.User{Email: "admin@example.com"}))
+	mgr.WithScope(mgr.ScopeFor(service))
+	targets := &mgo.Collection{Name: "targets"}
+
+	query, err := mgr.scopeQuery(targets, bson.M{})
+	require.NoError(t, err)
+	require.Equal(t, bson.M{"project": bson.M{"$in": []bson.ObjectId{projectId}}}, query)
+
+	query, err = mgr.scopeQuery(targets, bson.M{"project": bson.NewObjectId()})
+	require.NoError(t, err)
+	require.Len(t, query["$and"], 2)
+
+	created := bson.NewObjectId()
+	mgr.Scope().Add(created)
+	mgr.Scope().Add(created)
+	query, err = mgr.scopeQuery(&mgo.Collection{Name: "projects"}, bson.M{})
+	require.NoError(t, err)
+	require.Equal(t, bson.M{"_id": bson.M{"$in": []bson.ObjectId{projectId, created}}}, query)
+
+	// collections without projects aren't limited
+	query, err = mgr.scopeQuery(&mgo.Collection{Name: "plugins"}, bson.M{"name": "wappalyzer"})
+	require.NoError(t, err)
+	require.Equal(t, bson.M{"name": "wappalyzer"}, query)
+
+	// global templates are available in every scope, webhook deliveries in none
+	inScope := bson.M{"$in": []bson.ObjectId{projectId, created}}
+	query, err = mgr.scopeQuery(&mgo.Collection{Name: "scan_templates"}, bson.M{})
+	require.NoError(t, err)
+	require.Equal(t, bson.M{"$or": []bson.M{{"project": inScope}, {"project": bson.M{"$exists": false}}}}, query)
+	query, err = mgr.scopeQuery(&mgo.Collection{Name: "webhook_deliveries"}, bson.M{})
+	require.NoError(t, err)
+	require.Equal(t, bson.M{"_id": bson.M{"$in": []bson.ObjectId{}}}, query)
+}
+
+func TestVulndbCve(t *testing.T) {
+	require.Equal(t, []string{"CVE-2014-6271", "CVE-2014-7169"},
+		appendCve([]string{"CVE-2014-6271"}, "cve-2014-6271 and https://nvd.nist.gov/vuln/detail/CVE-2014-7169"))
+	require.Empty(t, appendCve(nil, "https://cwe.mitre.org/data/definitions/79.html"))
+
+	vulndb := &VulndbManager{}
+	require.NoError(t, vulndb.Init())
+	shellshock := vulndb.GetByCve("cve-2014-6271")
+	require.Len(t, shellshock, 1)
+	require.Equal(t, []string{"CVE-2014-6271"}, shellshock[0].Cve)
+	require.Empty(t, vulndb.GetByCve("CVE-2000-0001"))
+}
+
+func TestProjectRemoveAll(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := New(mongo.DB(dbName))
+
+	removed, err := mgr.Projects.Create(&project.Project{Name: "removed", Owner: bson.NewObjectId()})
+	require.NoError(t, err)
+	kept, err := mgr.Projects.Create(&project.Project{Name: "kept", Owner: bson.NewObjectId()})
+	require.NoError(t, err)
+	for _, p := range []bson.ObjectId{removed.Id, kept.Id, ""} {
+		_, err := mgr.Templates.Create(&scan.Template{Name: "tmpl", Project: p, Plan: bson.NewObjectId()})
+		require.NoError(t, err)
+	}
+
+	count, err := mgr.Projects.RemoveAll(bson.M{"_id": removed.Id})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	_, count, err = mgr.Templates.FilterByQuery(bson.M{"project": removed.Id})
+	require.NoError(t, err)
+	require.Equal(t, 0, count, "templates of the removed project are removed")
+	_, count, err = mgr.Templates.FilterByQuery(bson.M{})
+	require.NoError(t, err)
+	require.Equal(t, 2, count, "templates of other projects and global ones are kept")
+
+	count, err = mgr.Projects.RemoveAll(bson.M{"_id": removed.Id})
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+}
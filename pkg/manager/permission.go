@@ -18,11 +18,17 @@ func (m *PermissionManager) Init() error {
 }
 
 func (m *PermissionManager) HasProjectAccess(p *project.Project, u *user.User) bool {
+	if u.IsService() {
+		return u.Project == p.Id
+	}
 	admin := m.IsAdmin(u)
 	return !(!admin && p.Owner != u.Id && p.GetMember(u.Id) == nil)
 }
 
 func (m *PermissionManager) IsAdmin(u *user.User) bool {
+	if u.IsService() {
+		return false
+	}
 	return m.IsAdminEmail(u.Email)
 }
 
@@ -40,6 +46,14 @@ func (m *PermissionManager) SetAdmins(emails []string) {
 	}
 }
 
+// Get emails of admins, including the agent
+func (m *PermissionManager) GetAdmins() []string {
+	if m.admins == nil {
+		return nil
+	}
+	return set.StringSlice(m.admins)
+}
+
 func (m *PermissionManager) Copy(new *PermissionManager) {
 	new.admins = m.admins
 }
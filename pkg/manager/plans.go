@@ -3,7 +3,6 @@ package manager
 import (
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
@@ -23,7 +22,7 @@ type PlanFltr struct {
 }
 
 func (s *PlanManager) Init() error {
-	logrus.Infof("Initialize plan indexes")
+	log.Infof("Initialize plan indexes")
 	err := s.col.EnsureIndex(mgo.Index{
 		Key:        []string{"name"},
 		Unique:     true,
@@ -80,17 +79,39 @@ func (m *PlanManager) Create(raw *plan.Plan) (*plan.Plan, error) {
 	raw.Id = bson.NewObjectId()
 	raw.Created = time.Now().UTC()
 	raw.Updated = raw.Created
+	raw.Version = 1
 	if err := m.col.Insert(raw); err != nil {
 		return nil, err
 	}
 	return raw, nil
 }
 
+// Import inserts the plan as is, ids and dates are set by the archive import
+func (m *PlanManager) Import(raw *plan.Plan) error {
+	return m.col.Insert(raw)
+}
+
+// Update the plan and increment its version.
+// Returns ErrVersionConflict if the plan was updated since it had been read.
 func (m *PlanManager) Update(obj *plan.Plan) error {
 	obj.Updated = time.Now().UTC()
-	return m.col.UpdateId(obj.Id, obj)
+	version := obj.Version
+	obj.Version++
+	if err := m.manager.UpdateVersion(m.col, obj.Id, version, obj); err != nil {
+		obj.Version = version
+		return err
+	}
+	return nil
 }
 
 func (m *PlanManager) Remove(obj *plan.Plan) error {
 	return m.col.RemoveId(obj.Id)
 }
+
+func (m *PlanManager) RemoveAll(query bson.M) (int, error) {
+	info, err := m.col.RemoveAll(query)
+	if info != nil {
+		return info.Removed, err
+	}
+	return 0, err
+}
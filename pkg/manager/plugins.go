@@ -3,7 +3,6 @@ package manager
 import (
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
@@ -27,7 +26,7 @@ type PluginFltr struct {
 }
 
 func (s *PluginManager) Init() error {
-	logrus.Infof("Initialize plugin indexes")
+	log.Infof("Initialize plugin indexes")
 	err := s.col.EnsureIndex(mgo.Index{
 		Key:        []string{"name", "version"},
 		Unique:     true,
@@ -120,3 +119,11 @@ func (m *PluginManager) Update(obj *plugin.Plugin) error {
 	obj.Updated = time.Now().UTC()
 	return m.col.UpdateId(obj.Id, obj)
 }
+
+func (m *PluginManager) RemoveAll(query bson.M) (int, error) {
+	info, err := m.col.RemoveAll(query)
+	if info != nil {
+		return info.Removed, err
+	}
+	return 0, err
+}
@@ -3,8 +3,8 @@ package manager
 import (
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/user"
 	"github.com/bearded-web/bearded/pkg/fltr"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -23,7 +23,7 @@ type ProjectManager struct {
 }
 
 func (m *ProjectManager) Init() error {
-	logrus.Infof("Initialize project indexes")
+	log.Infof("Initialize project indexes")
 	err := m.col.EnsureIndex(mgo.Index{
 		Key:        []string{"owner", "name"},
 		Unique:     true,
@@ -32,7 +32,7 @@ func (m *ProjectManager) Init() error {
 	if err != nil {
 		return err
 	}
-	for _, index := range []string{"owner", "members.user"} {
+	for _, index := range []string{"owner", "members.user", "tags", "compliance"} {
 		err := m.col.EnsureIndex(mgo.Index{
 			Key:        []string{index},
 			Background: true,
@@ -42,7 +42,7 @@ func (m *ProjectManager) Init() error {
 		}
 	}
 	// TODO (m0sth8): exclude to migration
-	_, err = m.col.UpdateAll(bson.M{"members": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"members": []*project.Member{}}})
+	_, err = m.manager.updateAll(m.col, bson.M{"members": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"members": []*project.Member{}}})
 	return err
 }
 
@@ -68,20 +68,43 @@ func (m *ProjectManager) FilterByQuery(query bson.M, opts ...Opts) ([]*project.P
 	return results, count, err
 }
 
+// Query for projects where the user is owner or member, service accounts see only their project
+func (m *ProjectManager) AccessQuery(u *user.User) bson.M {
+	if u.IsService() {
+		return bson.M{"_id": u.Project}
+	}
+	return Or(fltr.GetQuery(&ProjectFltr{Owner: u.Id, Member: u.Id}))
+}
+
 func (m *ProjectManager) Create(raw *project.Project) (*project.Project, error) {
 	// TODO (m0sth8): add validation
 	raw.Id = bson.NewObjectId()
 	raw.Created = time.Now().UTC()
 	raw.Updated = raw.Created
+	raw.Version = 1
 	if raw.Members == nil {
 		raw.Members = []*project.Member{}
 	}
 	if err := m.col.Insert(raw); err != nil {
 		return nil, err
 	}
+	if m.manager.scope != nil {
+		m.manager.scope.Add(raw.Id)
+	}
 	return raw, nil
 }
 
+// Import inserts the project as is, ids and dates are set by the archive import
+func (m *ProjectManager) Import(raw *project.Project) error {
+	if err := m.col.Insert(raw); err != nil {
+		return err
+	}
+	if m.manager.scope != nil {
+		m.manager.scope.Add(raw.Id)
+	}
+	return nil
+}
+
 func (m *ProjectManager) CreateDefault(owner bson.ObjectId) (*project.Project, error) {
 	p := &project.Project{
 		Owner: owner,
@@ -90,7 +113,107 @@ func (m *ProjectManager) CreateDefault(owner bson.ObjectId) (*project.Project, e
 	return m.Create(p)
 }
 
+// Update the project and increment its version.
+// Returns ErrVersionConflict if the project was updated since it had been read.
 func (m *ProjectManager) Update(obj *project.Project) error {
 	obj.Updated = time.Now().UTC()
-	return m.col.UpdateId(obj.Id, obj)
+	version := obj.Version
+	obj.Version++
+	if err := m.manager.UpdateVersion(m.col, obj.Id, version, obj); err != nil {
+		obj.Version = version
+		return err
+	}
+	return nil
+}
+
+// Replace the project baseline without version check, nil removes it
+func (m *ProjectManager) SetBaseline(obj *project.Project, baseline *project.Baseline) error {
+	now := time.Now().UTC()
+	update := bson.M{"$set": bson.M{"baseline": baseline, "updated": now}, "$inc": bson.M{"version": 1}}
+	if baseline == nil {
+		update["$set"] = bson.M{"updated": now}
+		update["$unset"] = bson.M{"baseline": ""}
+	}
+	if err := m.manager.updateId(m.col, obj.Id, update); err != nil {
+		return err
+	}
+	obj.Baseline = baseline
+	obj.Updated = now
+	obj.Version++
+	return nil
+}
+
+// RemoveAll removes projects of the query with their scan templates, returns the number of removed projects
+func (m *ProjectManager) RemoveAll(query bson.M) (int, error) {
+	results := []struct {
+		Id bson.ObjectId `bson:"_id"`
+	}{}
+	if err := m.manager.run(func() error { return m.col.Find(query).Select(bson.M{"_id": 1}).All(&results) }); err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	ids := make([]bson.ObjectId, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.Id)
+	}
+	info, err := m.manager.removeAll(m.col, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	// templates of removed projects aren't available for anyone
+	if _, err := m.manager.Templates.RemoveAll(bson.M{"project": bson.M{"$in": ids}}); err != nil {
+		return info.Removed, err
+	}
+	return info.Removed, nil
+}
+
+// how many issue ids are marked by one update when baselines are migrated
+const baselineMigrateBatch = 1000
+
+// Move issue ids of baselines stored in projects to the issues, the id list could outgrow the project document.
+// Returns the number of migrated projects.
+func (m *ProjectManager) MigrateBaselines() (int, error) {
+	obj := struct {
+		Id       bson.ObjectId `bson:"_id"`
+		Baseline struct {
+			Id     bson.ObjectId   `bson:"id"`
+			Issues []bson.ObjectId `bson:"issues"`
+		}
+	}{}
+	count := 0
+	iter := m.col.Find(bson.M{"baseline.issues": bson.M{"$exists": true}}).Select(bson.M{"baseline": 1}).Iter()
+	for iter.Next(&obj) {
+		id := obj.Baseline.Id
+		if id == "" {
+			id = bson.NewObjectId()
+		}
+		ids := obj.Baseline.Issues
+		for len(ids) > 0 {
+			batch := ids
+			if len(batch) > baselineMigrateBatch {
+				batch = batch[:baselineMigrateBatch]
+			}
+			ids = ids[len(batch):]
+			if _, err := m.manager.updateAll(m.manager.Issues.col,
+				bson.M{"_id": bson.M{"$in": batch}, "project": obj.Id},
+				bson.M{"$set": bson.M{"baseline": id}}); err != nil {
+				iter.Close()
+				return 0, err
+			}
+		}
+		err := m.manager.updateId(m.col, obj.Id, bson.M{
+			"$set":   bson.M{"baseline.id": id, "baseline.count": len(obj.Baseline.Issues)},
+			"$unset": bson.M{"baseline.issues": ""},
+			"$inc":   bson.M{"version": 1},
+		})
+		if err != nil {
+			iter.Close()
+			return 0, err
+		}
+		count++
+		obj.Baseline.Id, obj.Baseline.Issues = "", nil
+	}
+	return count, iter.Close()
 }
@@ -0,0 +1,155 @@
+package manager
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// QueryStat is timings of one operation on the collection since start
+type QueryStat struct {
+	Collection string `json:"collection"`
+	Op         string `json:"op" description:"one of find, findOne, count, update"`
+	Count      int    `json:"count"`
+	Slow       int    `json:"slow" description:"how many operations took longer than the slow query threshold"`
+	Total      int64  `json:"total" description:"total time in milliseconds"`
+	Max        int64  `json:"max" description:"the longest operation in milliseconds"`
+}
+
+// QueryStats keeps timings of operations by collections, it's safe for concurrent use
+type QueryStats struct {
+	mu    sync.Mutex
+	stats map[string]*QueryStat
+}
+
+func NewQueryStats() *QueryStats {
+	return &QueryStats{stats: map[string]*QueryStat{}}
+}
+
+func (s *QueryStats) add(col, op string, d time.Duration, slow bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := col + "." + op
+	stat, ok := s.stats[key]
+	if !ok {
+		stat = &QueryStat{Collection: col, Op: op}
+		s.stats[key] = stat
+	}
+	ms := int64(d / time.Millisecond)
+	stat.Count++
+	stat.Total += ms
+	if ms > stat.Max {
+		stat.Max = ms
+	}
+	if slow {
+		stat.Slow++
+	}
+}
+
+// List returns copies of stats sorted by the total time, the slowest first
+func (s *QueryStats) List() []*QueryStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*QueryStat, 0, len(s.stats))
+	for _, stat := range s.stats {
+		copied := *stat
+		list = append(list, &copied)
+	}
+	sort.Sort(queryStatList(list))
+	return list
+}
+
+type queryStatList []*QueryStat
+
+func (l queryStatList) Len() int { return len(l) }
+func (l queryStatList) Less(i, j int) bool {
+	if l[i].Total != l[j].Total {
+		return l[i].Total > l[j].Total
+	}
+	return l[i].Collection+l[i].Op < l[j].Collection+l[j].Op
+}
+func (l queryStatList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+// operations of timed which change data, they aren't left in background when the context is done
+var writeOps = map[string]bool{
+	"update":    true,
+	"updateAll": true,
+	"remove":    true,
+	"removeAll": true,
+}
+
+// timed runs the operation and logs it if it's slower than the configured threshold
+func (m *Manager) timed(col *mgo.Collection, op string, query interface{}, fn func() error) error {
+	start := time.Now()
+	var err error
+	if writeOps[op] {
+		err = m.write(fn)
+	} else {
+		err = m.run(fn)
+	}
+	d := time.Since(start)
+	slow := m.Cfg.SlowQuery > 0 && d >= m.Cfg.SlowQuery
+	if slow {
+		log.Warnf("Slow query %s.%s %s took %s", col.Name, op, QueryShape(query), d)
+	}
+	if m.Cfg.Queries != nil {
+		m.Cfg.Queries.add(col.Name, op, d, slow)
+	}
+	return err
+}
+
+// QueryShape returns the query with all values replaced by "?", so logs don't leak user data
+func QueryShape(query interface{}) string {
+	data, err := json.Marshal(shape(query))
+	if err != nil {
+		return "?"
+	}
+	return string(data)
+}
+
+func shape(val interface{}) interface{} {
+	switch v := val.(type) {
+	case *bson.M:
+		if v == nil {
+			return nil
+		}
+		return shape(*v)
+	case bson.M:
+		return shapeMap(v)
+	case map[string]interface{}:
+		return shapeMap(v)
+	case bson.D:
+		result := make(map[string]interface{}, len(v))
+		for _, elem := range v {
+			result[elem.Name] = shape(elem.Value)
+		}
+		return result
+	case []bson.M:
+		result := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			result = append(result, shape(elem))
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			result = append(result, shape(elem))
+		}
+		return result
+	case nil:
+		return nil
+	}
+	return "?"
+}
+
+func shapeMap(m map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for key, val := range m {
+		result[key] = shape(val)
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+package manager
+
+import (
+	"sort"
+	"strings"
+)
+
+type IndexReport struct {
+	Collection string   `json:"collection"`
+	Created    []string `json:"created" description:"names of indexes which were missed"`
+	Total      int      `json:"total" description:"number of indexes after the rebuild"`
+}
+
+// Reindex runs index creation of all managers again, e.g. to restore indexes which were dropped manually.
+// Text indexes are rebuilt if the language or weights are changed.
+// Managers which keep the state in memory aren't initialized again.
+func (m *Manager) Reindex() ([]*IndexReport, error) {
+	// the driver doesn't send createIndexes for indexes which were ensured by this process
+	m.db.Session.ResetIndexCache()
+
+	before, err := m.indexNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, manager := range m.managers {
+		if manager == ManagerInterface(m.Permission) || manager == ManagerInterface(m.Vulndb) {
+			continue
+		}
+		if err := manager.Init(); err != nil {
+			return nil, err
+		}
+	}
+	after, err := m.indexNames()
+	if err != nil {
+		return nil, err
+	}
+	return indexReports(before, after), nil
+}
+
+// index names by collections
+func (m *Manager) indexNames() (map[string][]string, error) {
+	names, err := m.db.CollectionNames()
+	if err != nil {
+		return nil, err
+	}
+	result := map[string][]string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, "system.") {
+			continue
+		}
+		indexes, err := m.db.C(name).Indexes()
+		if err != nil {
+			return nil, err
+		}
+		for _, index := range indexes {
+			result[name] = append(result[name], index.Name)
+		}
+	}
+	return result, nil
+}
+
+func indexReports(before, after map[string][]string) []*IndexReport {
+	reports := []*IndexReport{}
+	for col, names := range after {
+		existed := map[string]bool{}
+		for _, name := range before[col] {
+			existed[name] = true
+		}
+		report := &IndexReport{Collection: col, Created: []string{}, Total: len(names)}
+		for _, name := range names {
+			if !existed[name] {
+				report.Created = append(report.Created, name)
+			}
+		}
+		reports = append(reports, report)
+	}
+	sort.Sort(indexReportList(reports))
+	return reports
+}
+
+type indexReportList []*IndexReport
+
+func (l indexReportList) Len() int           { return len(l) }
+func (l indexReportList) Less(i, j int) bool { return l[i].Collection < l[j].Collection }
+func (l indexReportList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
@@ -0,0 +1,143 @@
+package manager
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/remediation"
+	"github.com/bearded-web/bearded/pkg/fltr"
+	"github.com/bearded-web/bearded/pkg/template"
+)
+
+type RemediationManager struct {
+	manager *Manager
+	col     *mgo.Collection
+}
+
+type RemediationFltr struct {
+	VulnType int    `fltr:"vulnType"`
+	Cwe      string `fltr:"cwe"`
+}
+
+func (m *RemediationManager) Init() error {
+	log.Infof("Initialize remediation indexes")
+	for _, index := range []string{"vulnType", "cwe"} {
+		err := m.col.EnsureIndex(mgo.Index{
+			Key:        []string{index},
+			Background: true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *RemediationManager) Fltr() *RemediationFltr {
+	return &RemediationFltr{}
+}
+
+func (m *RemediationManager) GetById(id bson.ObjectId) (*remediation.Template, error) {
+	u := &remediation.Template{}
+	return u, m.manager.GetById(m.col, id, u)
+}
+
+func (m *RemediationManager) FilterBy(f *RemediationFltr, opts ...Opts) ([]*remediation.Template, int, error) {
+	query := fltr.GetQuery(f)
+	return m.FilterByQuery(query, opts...)
+}
+
+func (m *RemediationManager) FilterByQuery(query bson.M, opts ...Opts) ([]*remediation.Template, int, error) {
+	results := []*remediation.Template{}
+	count, err := m.manager.FilterBy(m.col, &query, &results, opts...)
+	return results, count, err
+}
+
+func (m *RemediationManager) Create(raw *remediation.Template) (*remediation.Template, error) {
+	raw.Id = bson.NewObjectId()
+	raw.Created = time.Now().UTC()
+	raw.Updated = raw.Created
+	if err := m.col.Insert(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func (m *RemediationManager) Update(obj *remediation.Template) error {
+	obj.Updated = time.Now().UTC()
+	return m.col.UpdateId(obj.Id, obj)
+}
+
+func (m *RemediationManager) Remove(obj *remediation.Template) error {
+	return m.col.RemoveId(obj.Id)
+}
+
+// Match returns the template for the vulndb type, templates of its cwes are tried next.
+// The last updated template wins if there are several ones.
+func (m *RemediationManager) Match(vulnType int) (*remediation.Template, error) {
+	if vulnType == 0 {
+		return nil, nil
+	}
+	query := bson.M{"vulnType": vulnType}
+	if v := m.manager.Vulndb.GetById(vulnType); v != nil && len(v.Cwe) > 0 {
+		query = bson.M{"$or": []bson.M{query, {"cwe": bson.M{"$in": v.Cwe}}}}
+	}
+	results := []*remediation.Template{}
+	if err := m.col.Find(query).Sort("-updated").All(&results); err != nil {
+		return nil, err
+	}
+	for _, t := range results {
+		if t.VulnType == vulnType {
+			return t, nil
+		}
+	}
+	if len(results) > 0 {
+		return results[0], nil
+	}
+	return nil, nil
+}
+
+// Render the template with variables of the issue on the target
+func (m *RemediationManager) Render(t *remediation.Template, obj *issue.TargetIssue, target string) (*issue.Remediation, error) {
+	vars := remediation.Vars{
+		Target:  target,
+		Summary: obj.Summary,
+	}
+	if obj.Vector != nil {
+		vars.Url = obj.Vector.Url
+		for _, tr := range obj.Vector.HttpTransactions {
+			if vars.Url == "" {
+				vars.Url = tr.Url
+			}
+			if vars.Parameter == "" && len(tr.Params) > 0 {
+				vars.Parameter = tr.Params[0]
+			}
+		}
+	}
+	text, err := template.RenderText(t.Id.Hex(), t.Text, vars)
+	if err != nil {
+		return nil, err
+	}
+	return &issue.Remediation{Template: t.Id, Text: text}, nil
+}
+
+// Attach sets guidance of the matching template to the issue, the guidance which is edited for the issue is kept.
+// Returns false if there is no matching template.
+func (m *RemediationManager) Attach(obj *issue.TargetIssue, target string) (bool, error) {
+	if obj.Remediation != nil && obj.Remediation.Edited {
+		return false, nil
+	}
+	t, err := m.Match(obj.VulnType)
+	if err != nil || t == nil {
+		return false, err
+	}
+	rem, err := m.Render(t, obj, target)
+	if err != nil {
+		return false, err
+	}
+	obj.Remediation = rem
+	return true, nil
+}
@@ -3,10 +3,10 @@ package manager
 import (
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
+	"github.com/bearded-web/bearded/models/issue"
 	"github.com/bearded-web/bearded/models/report"
 	"github.com/bearded-web/bearded/models/scan"
 	"github.com/bearded-web/bearded/pkg/fltr"
@@ -22,7 +22,7 @@ type ReportFltr struct {
 }
 
 func (s *ReportManager) Init() error {
-	logrus.Infof("Initialize report indexes")
+	log.Infof("Initialize report indexes")
 	err := s.col.EnsureIndex(mgo.Index{
 		Key:        []string{"scanSession"},
 		Unique:     true,
@@ -31,7 +31,7 @@ func (s *ReportManager) Init() error {
 	if err != nil {
 		return err
 	}
-	for _, index := range []string{"type", "scan"} {
+	for _, index := range []string{"type", "scan", "project", "purgeAfter"} {
 		err := s.col.EnsureIndex(mgo.Index{
 			Key:        []string{index},
 			Background: true,
@@ -95,17 +95,115 @@ func (m *ReportManager) Create(raw *report.Report) (*report.Report, error) {
 	if err := m.col.Insert(raw); err != nil {
 		return nil, err
 	}
-	return raw, nil
+	return raw, m.manager.Files.Link(raw.Project, raw.AllFiles()...)
+}
+
+// Import inserts the report as is, ids and dates are set by the archive import
+func (m *ReportManager) Import(raw *report.Report) error {
+	if err := m.col.Insert(raw); err != nil {
+		return err
+	}
+	return m.manager.Files.Link(raw.Project, raw.AllFiles()...)
 }
 
 func (m *ReportManager) Update(obj *report.Report) error {
 	obj.Updated = time.Now().UTC()
 	UpdateMulti(obj)
-	return m.col.UpdateId(obj.Id, obj)
+	if err := m.manager.updateId(m.col, obj.Id, obj); err != nil {
+		return err
+	}
+	return m.manager.Files.Link(obj.Project, obj.AllFiles()...)
+}
+
+// ReportRef is the report without its content
+type ReportRef struct {
+	Id         bson.ObjectId `bson:"_id"`
+	Scan       bson.ObjectId `bson:"scan"`
+	Project    bson.ObjectId `bson:"project,omitempty"`
+	Created    time.Time     `bson:"created"`
+	PurgeAfter time.Time     `bson:"purgeAfter,omitempty"`
+}
+
+// GetUnpurged returns reports which should be purged before the date and which raw output isn't purged yet,
+// they are sorted by id and start after the id if it's set
+func (m *ReportManager) GetUnpurged(after bson.ObjectId, before time.Time, limit int) ([]*ReportRef, error) {
+	return m.refs(bson.M{"purgeAfter": bson.M{"$lt": before}, "purged": bson.M{"$exists": false}}, after, limit)
+}
+
+// GetUndated returns unpurged reports of the query without the purge date, like reports written before it's stored,
+// they are sorted by id and start after the id if it's set
+func (m *ReportManager) GetUndated(query bson.M, after bson.ObjectId, limit int) ([]*ReportRef, error) {
+	return m.refs(bson.M{"$and": []bson.M{copyQuery(query),
+		{"purgeAfter": bson.M{"$exists": false}, "purged": bson.M{"$exists": false}}}}, after, limit)
+}
+
+// GetStored returns reports of the query which raw output isn't purged yet, dated or not,
+// they are sorted by id and start after the id if it's set
+func (m *ReportManager) GetStored(query bson.M, after bson.ObjectId, limit int) ([]*ReportRef, error) {
+	return m.refs(bson.M{"$and": []bson.M{copyQuery(query), {"purged": bson.M{"$exists": false}}}}, after, limit)
+}
+
+func (m *ReportManager) refs(query bson.M, after bson.ObjectId, limit int) ([]*ReportRef, error) {
+	if after != "" {
+		query["_id"] = bson.M{"$gt": after}
+	}
+	query, err := m.manager.scopeQuery(m.col, query)
+	if err != nil {
+		return nil, err
+	}
+	results := []*ReportRef{}
+	err = m.manager.run(func() error {
+		return m.col.Find(query).Select(bson.M{"_id": 1, "scan": 1, "project": 1, "created": 1, "purgeAfter": 1}).
+			Sort("_id").Limit(limit).All(&results)
+	})
+	return results, err
+}
+
+// CountIssues counts stored issues of reports of the sessions in the scan, plugin errors aren't counted
+func (m *ReportManager) CountIssues(scanId bson.ObjectId, sessions []bson.ObjectId) (int, error) {
+	if len(sessions) == 0 {
+		return 0, nil
+	}
+	query, err := m.manager.scopeQuery(m.col, bson.M{"scan": scanId, "scanSession": bson.M{"$in": sessions}})
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = m.manager.run(func() error {
+		iter := m.col.Find(query).
+			Select(bson.M{"type": 1, "issues.severity": 1, "multi.type": 1, "multi.issues.severity": 1}).Iter()
+		rep := &report.Report{}
+		for iter.Next(rep) {
+			for _, iss := range rep.GetAllIssues() {
+				if iss.Severity != issue.SeverityError {
+					count++
+				}
+			}
+			rep = &report.Report{}
+		}
+		return iter.Close()
+	})
+	return count, err
+}
+
+// SetPurgeAfter sets when raw output of the report is purged, the zero time removes the date
+func (m *ReportManager) SetPurgeAfter(id bson.ObjectId, purgeAfter time.Time) error {
+	if purgeAfter.IsZero() {
+		return m.manager.updateId(m.col, id, bson.M{"$unset": bson.M{"purgeAfter": ""}})
+	}
+	return m.manager.updateId(m.col, id, bson.M{"$set": bson.M{"purgeAfter": purgeAfter}})
 }
 
 func (m *ReportManager) Remove(obj *report.Report) error {
-	return m.col.RemoveId(obj.Id)
+	return m.manager.removeId(m.col, obj.Id)
+}
+
+func (m *ReportManager) RemoveAll(query bson.M) (int, error) {
+	info, err := m.manager.removeAll(m.col, query)
+	if info != nil {
+		return info.Removed, err
+	}
+	return 0, err
 }
 
 // upgrade underneath multi reports with created/updated, scan, scanSession fields
@@ -138,3 +236,31 @@ func UpdateIssues(r *report.Report) {
 		}
 	}
 }
+
+// Set projects of reports which are stored before reports had them, returns the number of updated reports
+func (m *ReportManager) MigrateProjects() (int, error) {
+	missing := bson.M{"project": bson.M{"$exists": false}}
+	scans := []bson.ObjectId{}
+	if err := m.col.Find(missing).Distinct("scan", &scans); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, id := range scans {
+		sc := &struct {
+			Project bson.ObjectId `bson:"project"`
+		}{}
+		if err := m.manager.Scans.col.FindId(id).Select(bson.M{"project": 1}).One(sc); err != nil {
+			if err == mgo.ErrNotFound {
+				continue
+			}
+			return count, err
+		}
+		info, err := m.col.UpdateAll(bson.M{"scan": id, "project": missing["project"]},
+			bson.M{"$set": bson.M{"project": sc.Project}})
+		if err != nil {
+			return count, err
+		}
+		count += info.Updated
+	}
+	return count, nil
+}
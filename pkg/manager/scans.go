@@ -4,29 +4,36 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
+	"github.com/bearded-web/bearded/models/report"
 	"github.com/bearded-web/bearded/models/scan"
 	"github.com/bearded-web/bearded/pkg/fltr"
 )
 
+// plugin dry runs are removed by mongo after this time if ManagerConfig.DryRunExpire is not set
+const DefaultDryRunExpire = time.Hour
+
 type ScanManager struct {
 	manager *Manager
 	col     *mgo.Collection
 }
 
 type ScanFltr struct {
-	Status  scan.ScanStatus `fltr:"status,in,nin"`
-	Target  bson.ObjectId   `fltr:"target,in"`
-	Project bson.ObjectId   `fltr:"project"`
-	Plan    bson.ObjectId   `fltr:"plan,in"`
+	Status   scan.ScanStatus `fltr:"status,in,nin"`
+	Target   bson.ObjectId   `fltr:"target,in"`
+	Project  bson.ObjectId   `fltr:"project"`
+	Plan     bson.ObjectId   `fltr:"plan,in"`
+	Group    bson.ObjectId   `fltr:"group"`
+	Owner    bson.ObjectId   `fltr:"owner,in" description:"user who started the scan"`
+	Created  time.Time       `fltr:"created,gte,gt,lte,lt" bson:"dates.created"`
+	Finished time.Time       `fltr:"finished,gte,gt,lte,lt" bson:"dates.finished"`
 }
 
 func (s *ScanManager) Init() error {
-	logrus.Infof("Initialize scan indexes")
-	for _, index := range []string{"owner", "status"} {
+	log.Infof("Initialize scan indexes")
+	for _, index := range []string{"owner", "status", "group", "waitWindow", "target", "plan", "dates.finished"} {
 		err := s.col.EnsureIndex(mgo.Index{
 			Key:        []string{index},
 			Background: true,
@@ -35,7 +42,23 @@ func (s *ScanManager) Init() error {
 			return err
 		}
 	}
-	return nil
+	// scans of the project are listed from the newest ones
+	err := s.col.EnsureIndex(mgo.Index{
+		Key:        []string{"project", "-dates.created"},
+		Background: true,
+	})
+	if err != nil {
+		return err
+	}
+	expire := s.manager.Cfg.DryRunExpire
+	if expire == 0 {
+		expire = DefaultDryRunExpire
+	}
+	return s.manager.ensureTTLIndex(s.col, mgo.Index{
+		Key:         []string{"dryRun.created"},
+		Background:  true,
+		ExpireAfter: expire,
+	})
 }
 
 func (m *ScanManager) Fltr() *ScanFltr {
@@ -44,7 +67,7 @@ func (m *ScanManager) Fltr() *ScanFltr {
 
 func (m *ScanManager) GetById(id bson.ObjectId) (*scan.Scan, error) {
 	u := &scan.Scan{}
-	if err := m.col.FindId(id).One(u); err != nil {
+	if err := m.manager.GetById(m.col, id, u); err != nil {
 		return nil, err
 	}
 	return u, nil
@@ -52,10 +75,13 @@ func (m *ScanManager) GetById(id bson.ObjectId) (*scan.Scan, error) {
 
 func (m *ScanManager) GetByMulti(ids []bson.ObjectId) (map[bson.ObjectId]*scan.Scan, error) {
 	scans := []*scan.Scan{}
-	query := bson.M{
+	query, err := m.manager.scopeQuery(m.col, bson.M{
 		"id": bson.M{"$in": ids},
+	})
+	if err != nil {
+		return nil, err
 	}
-	if err := m.col.Find(query).All(&scans); err != nil {
+	if err := m.manager.run(func() error { return m.col.Find(query).All(&scans) }); err != nil {
 		return nil, err
 	}
 	results := map[bson.ObjectId]*scan.Scan{}
@@ -80,12 +106,31 @@ func (m *ScanManager) FilterBy(f *ScanFltr) ([]*scan.Scan, int, error) {
 
 }
 
-func (m *ScanManager) FilterByQuery(query bson.M) ([]*scan.Scan, int, error) {
+func (m *ScanManager) FilterByQuery(query bson.M, opts ...Opts) ([]*scan.Scan, int, error) {
 	results := []*scan.Scan{}
-	count, err := m.manager.FilterBy(m.col, &query, &results)
+	count, err := m.manager.FilterBy(m.col, &query, &results, opts...)
 	return results, count, err
 }
 
+// Get only ids of scans
+func (m *ScanManager) GetIds(query bson.M) ([]bson.ObjectId, error) {
+	results := []struct {
+		Id bson.ObjectId `bson:"_id"`
+	}{}
+	query, err := m.manager.scopeQuery(m.col, query)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.manager.run(func() error { return m.col.Find(query).Select(bson.M{"_id": 1}).All(&results) }); err != nil {
+		return nil, err
+	}
+	ids := make([]bson.ObjectId, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.Id)
+	}
+	return ids, nil
+}
+
 func (m *ScanManager) Create(raw *scan.Scan) (*scan.Scan, error) {
 	// TODO (m0sth8): add validation
 	raw.Id = bson.NewObjectId()
@@ -100,99 +145,522 @@ func (m *ScanManager) Create(raw *scan.Scan) (*scan.Scan, error) {
 	return raw, nil
 }
 
+// AddDryRunReport keeps the report of the dry run session inside the scan, reports of dry runs aren't stored
+func (m *ScanManager) AddDryRunReport(sc *scan.Scan, rep *report.Report) error {
+	rep.Id = bson.NewObjectId()
+	rep.Created = time.Now().UTC()
+	rep.Updated = rep.Created
+	update := bson.M{"$push": bson.M{"dryRun.reports": rep}}
+	if err := m.manager.update(m.col, bson.M{"_id": sc.Id, "dryRun": bson.M{"$exists": true}}, update); err != nil {
+		return err
+	}
+	sc.DryRun.Reports = append(sc.DryRun.Reports, rep)
+	return nil
+}
+
+// Import inserts the scan as is, ids and dates are set by the archive import
+func (m *ScanManager) Import(raw *scan.Scan) error {
+	return m.col.Insert(raw)
+}
+
 func (m *ScanManager) Update(obj *scan.Scan) error {
 	now := time.Now().UTC()
 	obj.Dates.Updated = &now
-	switch st := obj.Status; true {
-	case st == scan.StatusQueued:
-		if obj.Queued == nil {
-			obj.Queued = &now
+	setDates(&obj.Dates, obj.Status, now)
+	return m.manager.updateId(m.col, obj.Id, obj)
+}
+
+func (m *ScanManager) Remove(obj *scan.Scan) error {
+	return m.manager.removeId(m.col, obj.Id)
+}
+
+func (m *ScanManager) RemoveAll(query bson.M) (int, error) {
+	info, err := m.manager.removeAll(m.col, query)
+	if info != nil {
+		return info.Removed, err
+	}
+	return 0, err
+}
+
+// status changes
+
+// how many times the status change is retried when the scan is changed concurrently
+const transitionAttempts = 5
+
+// TransitionErr is returned when the status can't be changed, e.g. the finished scan can't be working again
+type TransitionErr struct {
+	From scan.ScanStatus
+	To   scan.ScanStatus
+}
+
+func (e *TransitionErr) Error() string {
+	return fmt.Sprintf("status can't be changed from %s to %s", e.From, e.To)
+}
+
+func (m *Manager) IsTransitionErr(err error) bool {
+	_, ok := err.(*TransitionErr)
+	return ok
+}
+
+// set the date of the status if it isn't set yet, the pause date is kept only while the scan is paused
+func setDates(dates *scan.Dates, st scan.ScanStatus, now time.Time) {
+	if st != scan.StatusPaused {
+		dates.Paused = nil
+	}
+	switch st {
+	case scan.StatusPaused:
+		dates.Paused = &now
+	case scan.StatusQueued:
+		if dates.Queued == nil {
+			dates.Queued = &now
 		}
-	case st == scan.StatusFinished || st == scan.StatusFailed:
-		if obj.Finished == nil {
-			obj.Finished = &now
+	case scan.StatusFinished, scan.StatusFailed:
+		if dates.Finished == nil {
+			dates.Finished = &now
 		}
-	case st == scan.StatusWorking:
-		if obj.Started == nil {
-			obj.Started = &now
+	case scan.StatusWorking:
+		if dates.Started == nil {
+			dates.Started = &now
 		}
 	}
-	return m.col.UpdateId(obj.Id, obj)
 }
 
-func (m *ScanManager) Remove(obj *scan.Scan) error {
-	return m.col.RemoveId(obj.Id)
+// fields for $set of the scan status, the date is set only if the scan doesn't have it
+func statusSet(set bson.M, sc *scan.Scan, to scan.ScanStatus, now time.Time) {
+	set["status"] = to
+	if to == scan.StatusPaused {
+		set["dates.paused"] = now
+	} else if sc.Paused != nil {
+		set["dates.paused"] = nil
+	}
+	switch {
+	case to == scan.StatusQueued && sc.Queued == nil:
+		set["dates.queued"] = now
+	case (to == scan.StatusFinished || to == scan.StatusFailed) && sc.Finished == nil:
+		set["dates.finished"] = now
+	case to == scan.StatusWorking && sc.Started == nil:
+		set["dates.started"] = now
+	}
 }
 
-// sessions
-
-func (m *ScanManager) UpdateSession(sc *scan.Scan, obj *scan.Session) error {
-	var index *int
-	isRootSession := !obj.HasParent()
-	if isRootSession {
-		// find session indx for updating, but only for root session
-		for i, s := range sc.Sessions {
-			if s.Id == obj.Id {
-				index = &i
-				break
-			}
+// Transition changes the scan status if the scan still has the status from the object.
+// If the scan is changed concurrently, the change is checked again from the actual status,
+// so the finished scan can't become working by a stale copy.
+func (m *ScanManager) Transition(sc *scan.Scan, to scan.ScanStatus) error {
+	for attempt := 0; attempt < transitionAttempts; attempt++ {
+		if !sc.Status.CanChange(to) {
+			return &TransitionErr{From: sc.Status, To: to}
+		}
+		if sc.Status == to {
+			return nil
+		}
+		now := time.Now().UTC()
+		set := bson.M{"dates.updated": now}
+		statusSet(set, sc, to, now)
+		err := m.manager.update(m.col, bson.M{"_id": sc.Id, "status": sc.Status}, bson.M{"$set": set})
+		if err == nil {
+			sc.Status = to
+			sc.Updated = &now
+			setDates(&sc.Dates, to, now)
+			return nil
+		}
+		if err != mgo.ErrNotFound {
+			return err
+		}
+		fresh, err := m.GetById(sc.Id)
+		if err != nil {
+			return err
 		}
+		*sc = *fresh
 	}
-	if isRootSession && index == nil {
+	return fmt.Errorf("scan %s is changed concurrently, status %s isn't set", sc.Id.Hex(), to)
+}
+
+// sessions
+
+// UpdateSessionProgress sets the progress of the working session, mgo.ErrNotFound is returned if the session isn't working
+func (m *ScanManager) UpdateSessionProgress(sc *scan.Scan, obj *scan.Session, progress *scan.Progress) error {
+	path := sessionPath(sc.Sessions, obj.Id, "sessions.")
+	if path == "" {
 		return mgo.ErrNotFound
 	}
-	now := time.Now().UTC()
-	switch st := obj.Status; true {
-	case st == scan.StatusQueued:
-		if obj.Queued == nil {
-			obj.Queued = &now
-		}
-	case st == scan.StatusFinished || st == scan.StatusFailed:
-		if obj.Finished == nil {
-			obj.Finished = &now
+	progress.Updated = time.Now().UTC()
+	query := bson.M{"_id": sc.Id, path + ".status": scan.StatusWorking}
+	if err := m.manager.update(m.col, query, bson.M{"$set": bson.M{path + ".progress": progress}}); err != nil {
+		return err
+	}
+	obj.Progress = progress
+	return nil
+}
+
+// path to the session in the scan document, like sessions.0.children.1
+func sessionPath(sessions []*scan.Session, id bson.ObjectId, prefix string) string {
+	for i, sess := range sessions {
+		path := fmt.Sprintf("%s%d", prefix, i)
+		if sess.Id == id {
+			return path
 		}
-	case st == scan.StatusWorking:
-		if obj.Started == nil {
-			obj.Started = &now
+		if child := sessionPath(sess.Children, id, path+".children."); child != "" {
+			return child
 		}
 	}
+	return ""
+}
 
-	scanModified := false
+// copy stored fields of the session to the same session of the scan tree, it could be reloaded
+func syncSession(sc *scan.Scan, obj *scan.Session) {
+	sess := sc.GetSession(obj.Id)
+	if sess == nil || sess == obj {
+		return
+	}
+	sess.Status, sess.Error, sess.Dates, sess.Agent = obj.Status, obj.Error, obj.Dates, obj.Agent
+	sess.TimedOut = obj.TimedOut
+}
 
-	// only root sessions have influence on scan
-	if isRootSession {
+// the scan status which follows from the root session status, empty if the scan isn't changed
+func sessionScanStatus(sc *scan.Scan, obj *scan.Session) scan.ScanStatus {
+	if obj.HasParent() {
+		// only root sessions have influence on scan
+		return ""
+	}
+	// paused scan doesn't start new sessions, it's resumed only by users
+	if sc.Status == scan.StatusPaused && obj.Status != scan.StatusFailed && obj.Status != scan.StatusFinished {
+		return ""
+	}
+	switch obj.Status {
+	case scan.StatusQueued:
 		// if session is queued then scan should also be queued
-		if obj.Status == scan.StatusQueued && (sc.Status == scan.StatusCreated || sc.Status == scan.StatusWorking) {
-			sc.Status = scan.StatusQueued
-			scanModified = true
+		if sc.Status == scan.StatusCreated || sc.Status == scan.StatusWorking {
+			return scan.StatusQueued
 		}
-
+	case scan.StatusWorking:
 		// if session is working then scan should also be working
-		if obj.Status == scan.StatusWorking && (sc.Status != scan.StatusWorking) {
-			sc.Status = scan.StatusWorking
-			scanModified = true
+		return scan.StatusWorking
+	case scan.StatusFailed:
+		// if session failed then scan should be failed too
+		return scan.StatusFailed
+	case scan.StatusFinished:
+		// if session was the last one
+		if last := sc.Sessions[len(sc.Sessions)-1]; last.Id == obj.Id {
+			return scan.StatusFinished
 		}
+	}
+	return ""
+}
 
-		// if session failed then scan should be failed too
-		if obj.Status == scan.StatusFailed {
-			sc.Status = scan.StatusFailed
-			scanModified = true
+// UpdateSession stores the session and changes the scan status if it follows from the root session.
+// Both are changed atomically only if the stored session and scan statuses allow it. The scan status isn't
+// changed if it's final, e.g. the failed scan stays failed when a late session is finished,
+// but finished and failed sessions can't be changed at all.
+func (m *ScanManager) UpdateSession(sc *scan.Scan, obj *scan.Session) error {
+	now := time.Now().UTC()
+	setDates(&obj.Dates, obj.Status, now)
+	obj.Updated = &now
+
+	for attempt := 0; attempt < transitionAttempts; attempt++ {
+		path := sessionPath(sc.Sessions, obj.Id, "sessions.")
+		if path == "" {
+			return mgo.ErrNotFound
 		}
-		// if session was the last one
-		if obj.Status == scan.StatusFinished && (*index+1) == len(sc.Sessions) {
-			sc.Status = scan.StatusFinished
-			scanModified = true
+		query := bson.M{"_id": sc.Id, path + ".status": bson.M{"$in": scan.StatusesTo(obj.Status)}}
+		// children aren't rewritten, they could be added concurrently
+		set := bson.M{
+			path + ".status":   obj.Status,
+			path + ".error":    obj.Error,
+			path + ".timedOut": obj.TimedOut,
+			path + ".dates":    obj.Dates,
+			"dates.updated":    now,
 		}
+		update := bson.M{"$set": set}
+		if obj.Agent != "" {
+			set[path+".agent"] = obj.Agent
+		} else {
+			update["$unset"] = bson.M{path + ".agent": ""}
+		}
+		to := sessionScanStatus(sc, obj)
+		changeScan := to != "" && to != sc.Status && sc.Status.CanChange(to)
+		if changeScan {
+			query["status"] = sc.Status
+			statusSet(set, sc, to, now)
+		}
+		err := m.manager.update(m.col, query, update)
+		if err == nil {
+			syncSession(sc, obj)
+			sc.Updated = &now
+			if changeScan {
+				sc.Status = to
+				setDates(&sc.Dates, to, now)
+			}
+			return nil
+		}
+		if err != mgo.ErrNotFound {
+			return err
+		}
+		// the scan or the session is changed concurrently, check the change again with the actual state
+		fresh, err := m.GetById(sc.Id)
+		if err != nil {
+			return err
+		}
+		current := fresh.GetSession(obj.Id)
+		if current == nil {
+			return mgo.ErrNotFound
+		}
+		if !current.Status.CanChange(obj.Status) {
+			*sc = *fresh
+			return &TransitionErr{From: current.Status, To: obj.Status}
+		}
+		*sc = *fresh
+	}
+	return fmt.Errorf("scan %s is changed concurrently, session %s isn't updated", sc.Id.Hex(), obj.Id.Hex())
+}
+
+// AddSession appends the child session to the parent one without rewriting the scan
+func (m *ScanManager) AddSession(sc *scan.Scan, parent, obj *scan.Session) error {
+	path := sessionPath(sc.Sessions, parent.Id, "sessions.")
+	if path == "" {
+		return mgo.ErrNotFound
+	}
+	now := time.Now().UTC()
+	err := m.manager.updateId(m.col, sc.Id, bson.M{
+		"$push": bson.M{path + ".children": obj},
+		"$set":  bson.M{"dates.updated": now},
+	})
+	if err != nil {
+		return err
+	}
+	parent.Children = append(parent.Children, obj)
+	sc.Updated = &now
+	return nil
+}
+
+// SetResult stores the policy result of the done scan without touching its status
+func (m *ScanManager) SetResult(sc *scan.Scan) error {
+	return m.manager.updateId(m.col, sc.Id, bson.M{"$set": bson.M{"passed": sc.Passed, "violations": sc.Violations}})
+}
+
+// Get scan counts by status through aggregation
+func (m *ScanManager) CountByStatus(query bson.M) (map[scan.ScanStatus]int, error) {
+	query, err := m.manager.scopeQuery(m.col, query)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := []bson.M{
+		{"$match": query},
+		{"$group": bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}},
+	}
+	groups := []struct {
+		Status scan.ScanStatus `bson:"_id"`
+		Count  int
+	}{}
+	if err := m.manager.run(func() error { return m.col.Pipe(pipeline).All(&groups) }); err != nil {
+		return nil, err
+	}
+	result := map[scan.ScanStatus]int{}
+	for _, g := range groups {
+		result[g.Status] = g.Count
+	}
+	return result, nil
+}
+
+// Get scans which are paused before the date
+func (m *ScanManager) GetPausedBefore(before time.Time) ([]*scan.Scan, error) {
+	results, _, err := m.FilterByQuery(bson.M{"status": scan.StatusPaused, "dates.paused": bson.M{"$lt": before}})
+	return results, err
+}
+
+// GetActive returns the latest scan of the target with the plan, the template and the config hash which isn't done
+// and is created after the date, ErrNotFound is returned if there is no such scan
+func (m *ScanManager) GetActive(target, plan, template bson.ObjectId, confHash string, since time.Time) (*scan.Scan, error) {
+	query := bson.M{
+		"target":        target,
+		"plan":          plan,
+		"confHash":      confHash,
+		"status":        bson.M{"$in": []scan.ScanStatus{scan.StatusCreated, scan.StatusQueued, scan.StatusWorking}},
+		"dates.created": bson.M{"$gte": since},
+	}
+	if template != "" {
+		query["template"] = template
+	} else {
+		query["template"] = bson.M{"$exists": false}
+	}
+	results, _, err := m.FilterByQuery(query, Opts{Sort: []string{"-dates.created"}, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	return results[0], nil
+}
+
+// GetPending returns scans of the target which aren't started yet,
+// including ones waiting for the group queue or the scan window
+func (m *ScanManager) GetPending(target bson.ObjectId) ([]*scan.Scan, error) {
+	results, _, err := m.FilterByQuery(bson.M{
+		"target":        target,
+		"status":        bson.M{"$in": []scan.ScanStatus{scan.StatusCreated, scan.StatusQueued}},
+		"dates.started": bson.M{"$exists": false},
+	})
+	return results, err
+}
+
+// Count scans of the group by status, the project is checked if it's set
+func (m *ScanManager) GetGroupStatus(group, project bson.ObjectId) (*scan.GroupStatus, error) {
+	query := bson.M{"group": group}
+	if project != "" {
+		query["project"] = project
+	}
+	query, err := m.manager.scopeQuery(m.col, query)
+	if err != nil {
+		return nil, err
 	}
+	result := &scan.GroupStatus{Group: group}
+	err = m.manager.run(func() error {
+		iter := m.col.Find(query).Select(bson.M{"status": 1, "waiting": 1, "waitWindow": 1}).Iter()
+		sc := &scan.Scan{}
+		for iter.Next(sc) {
+			result.Add(sc)
+			sc = &scan.Scan{}
+		}
+		return iter.Close()
+	})
+	return result, err
+}
+
+// Get groups which have waiting scans
+func (m *ScanManager) GetWaitingGroups() ([]bson.ObjectId, error) {
+	groups := []bson.ObjectId{}
+	query, err := m.manager.scopeQuery(m.col, bson.M{"waiting": true})
+	if err != nil {
+		return nil, err
+	}
+	err = m.manager.run(func() error {
+		return m.col.Find(query).Distinct("group", &groups)
+	})
+	return groups, err
+}
+
+// Get waiting scans of the group, the oldest first
+func (m *ScanManager) GetWaiting(group bson.ObjectId, limit int) ([]*scan.Scan, error) {
+	results := []*scan.Scan{}
+	query, err := m.manager.scopeQuery(m.col, bson.M{"group": group, "waiting": true})
+	if err != nil {
+		return nil, err
+	}
+	err = m.manager.run(func() error {
+		return m.col.Find(query).Sort("dates.created").Limit(limit).All(&results)
+	})
+	return results, err
+}
+
+// Count scans of the group which are started and not done yet
+func (m *ScanManager) CountActive(group bson.ObjectId) (int, error) {
+	query, err := m.manager.scopeQuery(m.col, bson.M{
+		"group":      group,
+		"waiting":    bson.M{"$ne": true},
+		"waitWindow": bson.M{"$ne": true},
+		"status":     bson.M{"$in": []scan.ScanStatus{scan.StatusCreated, scan.StatusQueued, scan.StatusWorking}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return m.manager.count(m.col, query)
+}
+
+// Mark the waiting scan as started, returns not found error if it's started by someone else
+func (m *ScanManager) StartWaiting(sc *scan.Scan) error {
+	err := m.manager.update(m.col, bson.M{"_id": sc.Id, "waiting": true}, bson.M{"$unset": bson.M{"waiting": ""}})
+	if err != nil {
+		return err
+	}
+	sc.Waiting = false
+	return nil
+}
+
+// Mark the scan as waiting for the scan window of the target
+func (m *ScanManager) WaitWindow(sc *scan.Scan) error {
+	err := m.manager.updateId(m.col, sc.Id, bson.M{"$set": bson.M{"waitWindow": true}})
+	if err != nil {
+		return err
+	}
+	sc.WaitWindow = true
+	return nil
+}
+
+// Get created scans which wait for scan windows, the oldest first
+func (m *ScanManager) GetWaitingWindow() ([]*scan.Scan, error) {
+	results := []*scan.Scan{}
+	query, err := m.manager.scopeQuery(m.col, bson.M{"waitWindow": true, "status": scan.StatusCreated})
+	if err != nil {
+		return nil, err
+	}
+	err = m.manager.run(func() error {
+		return m.col.Find(query).Sort("dates.created").All(&results)
+	})
+	return results, err
+}
 
-	// if scan modified then update the whole scan object
-	if scanModified || !isRootSession {
-		return m.Update(sc)
+// Mark the scan as started in the window, it's moved to the group queue if waiting is set.
+// Returns not found error if it's started by someone else.
+func (m *ScanManager) StartWindow(sc *scan.Scan, waiting bool) error {
+	set := bson.M{"windowed": true}
+	if waiting {
+		set["waiting"] = true
+	}
+	update := bson.M{"$unset": bson.M{"waitWindow": ""}, "$set": set}
+	err := m.manager.update(m.col, bson.M{"_id": sc.Id, "waitWindow": true, "status": scan.StatusCreated}, update)
+	if err != nil {
+		return err
 	}
+	sc.WaitWindow = false
+	sc.Windowed = true
+	sc.Waiting = waiting
+	return nil
+}
 
-	// TODO (m0sth8): update non root session with set
-	key := fmt.Sprintf("sessions.%d", *index)
-	update := bson.M{"$set": bson.M{key: obj, "updated": now}}
-	m.col.UpdateId(sc.Id, update)
-	return m.Update(sc)
+// Time of root sessions by plugin for done scans finished since the date, the slowest plugins first
+func (m *ScanManager) GetPluginTimings(query bson.M, from time.Time) ([]*scan.PluginTiming, error) {
+	match := bson.M{
+		"status":         bson.M{"$in": []scan.ScanStatus{scan.StatusFinished, scan.StatusFailed}},
+		"dates.finished": bson.M{"$gte": from},
+	}
+	for k, v := range query {
+		match[k] = v
+	}
+	match, err := m.manager.scopeQuery(m.col, match)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$unwind": "$sessions"},
+		{"$match": bson.M{"sessions.dates.started": bson.M{"$ne": nil}, "sessions.dates.finished": bson.M{"$ne": nil}}},
+		{"$group": bson.M{
+			"_id":      "$sessions.step.plugin",
+			"sessions": bson.M{"$sum": 1},
+			"duration": bson.M{"$sum": bson.M{"$subtract": []string{"$sessions.dates.finished", "$sessions.dates.started"}}},
+		}},
+	}
+	groups := []struct {
+		Plugin   string `bson:"_id"`
+		Sessions int
+		Duration int64 // milliseconds
+	}{}
+	if err := m.manager.run(func() error { return m.col.Pipe(pipeline).All(&groups) }); err != nil {
+		return nil, err
+	}
+	result := make([]*scan.PluginTiming, 0, len(groups))
+	for _, g := range groups {
+		pt := &scan.PluginTiming{
+			Plugin:   g.Plugin,
+			Sessions: g.Sessions,
+			Duration: float64(g.Duration) / 1000,
+		}
+		if pt.Sessions > 0 {
+			pt.Average = pt.Duration / float64(pt.Sessions)
+		}
+		result = append(result, pt)
+	}
+	scan.SortTimings(result)
+	return result, nil
 }
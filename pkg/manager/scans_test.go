@@ -0,0 +1,159 @@
+package manager
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/tests"
+)
+
+func TestSessionPath(t *testing.T) {
+	child := &scan.Session{Id: bson.NewObjectId()}
+	sc := &scan.Scan{Sessions: []*scan.Session{
+		{Id: bson.NewObjectId()},
+		{Id: bson.NewObjectId(), Children: []*scan.Session{{Id: bson.NewObjectId()}, child}},
+	}}
+	require.Equal(t, "sessions.0", sessionPath(sc.Sessions, sc.Sessions[0].Id, "sessions."))
+	require.Equal(t, "sessions.1.children.1", sessionPath(sc.Sessions, child.Id, "sessions."))
+	require.Equal(t, "", sessionPath(sc.Sessions, bson.NewObjectId(), "sessions."))
+
+	require.True(t, scan.StatusWorking.CanChange(scan.StatusFinished))
+	require.False(t, scan.StatusFinished.CanChange(scan.StatusWorking))
+	require.False(t, scan.StatusFailed.CanChange(scan.StatusFinished))
+}
+
+func TestScanTransitions(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := New(mongo.DB(dbName))
+
+	id := bson.NewObjectId()
+	children := []*scan.Session{}
+	for i := 0; i < 10; i++ {
+		children = append(children, &scan.Session{Id: bson.NewObjectId(), Scan: id, Plugin: id, Status: scan.StatusWorking})
+	}
+	root := &scan.Session{Id: bson.NewObjectId(), Plugin: id, Status: scan.StatusWorking, Children: children}
+	for _, child := range children {
+		child.Parent = root.Id
+	}
+	sc, err := mgr.Scans.Create(&scan.Scan{
+		Status:   scan.StatusWorking,
+		Plan:     id,
+		Owner:    id,
+		Target:   id,
+		Project:  id,
+		Sessions: []*scan.Session{root},
+	})
+	require.NoError(t, err)
+
+	// every update is made from its own stale copy of the scan, like from parallel requests
+	copies := []*scan.Scan{}
+	for i := 0; i < len(children)+3; i++ {
+		obj, err := mgr.Scans.GetById(sc.Id)
+		require.NoError(t, err)
+		copies = append(copies, obj)
+	}
+	wg := sync.WaitGroup{}
+	errs := make(chan error, len(copies))
+	update := func(obj *scan.Scan, id bson.ObjectId, status scan.ScanStatus) {
+		defer wg.Done()
+		sess := obj.GetSession(id)
+		sess.Status = status
+		if err := mgr.Scans.UpdateSession(obj, sess); err != nil && !mgr.IsTransitionErr(err) {
+			errs <- err
+		}
+	}
+	for i, child := range children {
+		wg.Add(1)
+		go update(copies[i], child.Id, scan.StatusFinished)
+	}
+	wg.Add(3)
+	go update(copies[len(children)], root.Id, scan.StatusFinished)
+	// late reports of the root session can't make the scan working again
+	go update(copies[len(children)+1], root.Id, scan.StatusWorking)
+	go update(copies[len(children)+2], root.Id, scan.StatusWorking)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	obj, err := mgr.Scans.GetById(sc.Id)
+	require.NoError(t, err)
+	require.Equal(t, scan.StatusFinished, obj.Status)
+	require.NotNil(t, obj.Finished)
+	require.Equal(t, scan.StatusFinished, obj.Sessions[0].Status)
+	require.Len(t, obj.Sessions[0].Children, len(children))
+	for _, child := range obj.Sessions[0].Children {
+		require.Equal(t, scan.StatusFinished, child.Status)
+	}
+
+	err = mgr.Scans.Transition(copies[0], scan.StatusWorking)
+	require.True(t, mgr.IsTransitionErr(err), "got %v", err)
+	require.Equal(t, scan.StatusFinished, copies[0].Status)
+}
+
+func TestPauseDates(t *testing.T) {
+	now := time.Now().UTC()
+	dates := &scan.Dates{}
+	setDates(dates, scan.StatusPaused, now)
+	require.Equal(t, &now, dates.Paused)
+	setDates(dates, scan.StatusWorking, now)
+	require.Nil(t, dates.Paused, "the pause date is removed on resume")
+
+	set := bson.M{}
+	statusSet(set, &scan.Scan{Status: scan.StatusWorking}, scan.StatusPaused, now)
+	require.Equal(t, now, set["dates.paused"])
+	set = bson.M{}
+	statusSet(set, &scan.Scan{Status: scan.StatusPaused, Dates: scan.Dates{Paused: &now}}, scan.StatusQueued, now)
+	require.Nil(t, set["dates.paused"])
+	_, ok := set["dates.paused"]
+	require.True(t, ok, "the pause date is unset")
+
+	// sessions of the paused scan don't make it working, but the last finished one finishes it
+	last := &scan.Session{Id: bson.NewObjectId(), Status: scan.StatusWorking}
+	sc := &scan.Scan{Status: scan.StatusPaused, Sessions: []*scan.Session{last}}
+	require.Equal(t, scan.ScanStatus(""), sessionScanStatus(sc, last))
+	last.Status = scan.StatusFinished
+	require.Equal(t, scan.StatusFinished, sessionScanStatus(sc, last))
+	last.Status = scan.StatusFailed
+	require.Equal(t, scan.StatusFailed, sessionScanStatus(sc, last))
+}
+
+func TestPausedBefore(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := New(mongo.DB(dbName))
+
+	id := bson.NewObjectId()
+	sc, err := mgr.Scans.Create(&scan.Scan{Status: scan.StatusWorking, Plan: id, Owner: id, Target: id, Project: id})
+	require.NoError(t, err)
+	require.NoError(t, mgr.Scans.Transition(sc, scan.StatusPaused))
+	require.NotNil(t, sc.Paused)
+
+	paused, err := mgr.Scans.GetPausedBefore(time.Now().UTC().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, paused, 1)
+	paused, err = mgr.Scans.GetPausedBefore(time.Now().UTC().Add(-time.Minute))
+	require.NoError(t, err)
+	require.Empty(t, paused, "the scan isn't paused long enough")
+
+	require.NoError(t, mgr.Scans.Transition(sc, scan.StatusQueued))
+	obj, err := mgr.Scans.GetById(sc.Id)
+	require.NoError(t, err)
+	require.Nil(t, obj.Paused)
+	paused, err = mgr.Scans.GetPausedBefore(time.Now().UTC().Add(time.Minute))
+	require.NoError(t, err)
+	require.Empty(t, paused, "resumed scans aren't expired")
+}
@@ -0,0 +1,196 @@
+package manager
+
+import (
+	"sync"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/user"
+)
+
+// fields with the project id of collections which are limited by the scope
+var scopedFields = map[string]string{
+	"projects":  "_id",
+	"targets":   "project",
+	"scans":     "project",
+	"issues":    "project",
+	"feed":      "project",
+	"techs":     "project",
+	"campaigns": "project",
+	"shares":    "project",
+	"reports":   "project",
+	"comments":  "project",
+	// global templates don't have the project, they are available in every scope
+	"scan_templates": "project",
+	// deliveries of admin alerts don't belong to projects, they are hidden in every scope
+	"webhook_deliveries": "",
+}
+
+// collections with objects without the project which are available in every scope
+var globalScoped = map[string]bool{
+	"scan_templates": true,
+}
+
+// Scope limits reads of project data to projects which are available for the user,
+// so the request can't get data of other projects even if the service forgets the filter.
+// Projects are loaded on the first scoped query and the scope is shared by managers of the request.
+type Scope struct {
+	user *user.User
+
+	mu       sync.Mutex
+	loaded   bool
+	projects []bson.ObjectId
+}
+
+// ScopeFor returns the scope for requests of the user, nil if isolation is disabled or the user is admin
+func (m *Manager) ScopeFor(u *user.User) *Scope {
+	if !m.Cfg.Isolation || u == nil || m.Permission.IsAdmin(u) {
+		return nil
+	}
+	sc := &Scope{user: u}
+	if u.IsService() {
+		sc.loaded = true
+		sc.projects = []bson.ObjectId{u.Project}
+	}
+	return sc
+}
+
+// WithScope limits reads of the manager to the scope, nil scope removes the limit
+func (m *Manager) WithScope(sc *Scope) *Manager {
+	m.scope = sc
+	return m
+}
+
+// Scope of the manager, nil if reads aren't limited
+func (m *Manager) Scope() *Scope {
+	return m.scope
+}
+
+// Add the project to the scope, like the project which is created by the user in the request
+func (s *Scope) Add(id bson.ObjectId) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.projects {
+		if p == id {
+			return
+		}
+	}
+	s.projects = append(s.projects, id)
+}
+
+func (s *Scope) load(m *Manager) ([]bson.ObjectId, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loaded {
+		return s.projects, nil
+	}
+	results := []struct {
+		Id bson.ObjectId `bson:"_id"`
+	}{}
+	query := m.Projects.AccessQuery(s.user)
+	err := m.timed(m.Projects.col, "find", query, func() error {
+		return m.Projects.col.Find(query).Select(bson.M{"_id": 1}).All(&results)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		s.projects = append(s.projects, r.Id)
+	}
+	s.loaded = true
+	return s.projects, nil
+}
+
+// scopeQuery adds the project condition of the scope to the query of a scoped collection
+func (m *Manager) scopeQuery(col *mgo.Collection, query bson.M) (bson.M, error) {
+	field, ok := scopedFields[col.Name]
+	if m.scope == nil || !ok {
+		return query, nil
+	}
+	projects, err := m.scope.load(m)
+	if err != nil {
+		return nil, err
+	}
+	cond := bson.M{field: bson.M{"$in": projects}}
+	if field == "" {
+		cond = bson.M{"_id": bson.M{"$in": []bson.ObjectId{}}}
+	} else if globalScoped[col.Name] {
+		cond = bson.M{"$or": []bson.M{cond, {field: bson.M{"$exists": false}}}}
+	}
+	if len(query) == 0 {
+		return cond, nil
+	}
+	return bson.M{"$and": []bson.M{query, cond}}, nil
+}
+
+func (m *Manager) scopeQueryP(col *mgo.Collection, query *bson.M) (*bson.M, error) {
+	if m.scope == nil || query == nil {
+		return query, nil
+	}
+	q, err := m.scopeQuery(col, *query)
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// update the object of the query, objects out of the scope aren't found
+func (m *Manager) update(col *mgo.Collection, query bson.M, update interface{}) error {
+	query, err := m.scopeQuery(col, query)
+	if err != nil {
+		return err
+	}
+	return m.timed(col, "update", query, func() error {
+		return col.Update(query, update)
+	})
+}
+
+func (m *Manager) updateId(col *mgo.Collection, id interface{}, update interface{}) error {
+	return m.update(col, bson.M{"_id": id}, update)
+}
+
+// updateAll updates objects of the query in the scope
+func (m *Manager) updateAll(col *mgo.Collection, query bson.M, update interface{}) (*mgo.ChangeInfo, error) {
+	query, err := m.scopeQuery(col, query)
+	if err != nil {
+		return nil, err
+	}
+	var info *mgo.ChangeInfo
+	err = m.timed(col, "updateAll", query, func() error {
+		var err error
+		info, err = col.UpdateAll(query, update)
+		return err
+	})
+	return info, err
+}
+
+// remove the object of the query, objects out of the scope aren't found
+func (m *Manager) remove(col *mgo.Collection, query bson.M) error {
+	query, err := m.scopeQuery(col, query)
+	if err != nil {
+		return err
+	}
+	return m.timed(col, "remove", query, func() error {
+		return col.Remove(query)
+	})
+}
+
+func (m *Manager) removeId(col *mgo.Collection, id interface{}) error {
+	return m.remove(col, bson.M{"_id": id})
+}
+
+// removeAll removes objects of the query in the scope
+func (m *Manager) removeAll(col *mgo.Collection, query bson.M) (*mgo.ChangeInfo, error) {
+	query, err := m.scopeQuery(col, query)
+	if err != nil {
+		return nil, err
+	}
+	var info *mgo.ChangeInfo
+	err = m.timed(col, "removeAll", query, func() error {
+		var err error
+		info, err = col.RemoveAll(query)
+		return err
+	})
+	return info, err
+}
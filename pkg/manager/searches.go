@@ -0,0 +1,107 @@
+package manager
+
+// Saved searches manager
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/search"
+	"github.com/bearded-web/bearded/pkg/fltr"
+)
+
+type SearchManager struct {
+	manager *Manager
+	col     *mgo.Collection
+}
+
+type SearchFltr struct {
+	User    bson.ObjectId `fltr:"user"`
+	Type    search.Type   `fltr:"type"`
+	Default bool          `fltr:"default"`
+}
+
+func (s *SearchManager) Init() error {
+	log.Infof("Initialize search indexes")
+	// names are unique for the user and type
+	return s.col.EnsureIndex(mgo.Index{
+		Key:        []string{"user", "type", "name"},
+		Unique:     true,
+		Background: true,
+	})
+}
+
+func (m *SearchManager) Fltr() *SearchFltr {
+	return &SearchFltr{}
+}
+
+func (m *SearchManager) GetById(id bson.ObjectId) (*search.Search, error) {
+	u := &search.Search{}
+	return u, m.manager.GetById(m.col, id, &u)
+}
+
+// Get the default search of the user for the type
+func (m *SearchManager) GetDefault(userId bson.ObjectId, t search.Type) (*search.Search, error) {
+	obj := &search.Search{}
+	return obj, m.manager.GetBy(m.col, &bson.M{"user": userId, "type": t, "default": true}, &obj)
+}
+
+func (m *SearchManager) FilterBy(f *SearchFltr, opts ...Opts) ([]*search.Search, int, error) {
+	query := fltr.GetQuery(f)
+	return m.FilterByQuery(query, opts...)
+}
+
+func (m *SearchManager) FilterByQuery(query bson.M, opts ...Opts) ([]*search.Search, int, error) {
+	results := []*search.Search{}
+	count, err := m.manager.FilterBy(m.col, &query, &results, opts...)
+	return results, count, err
+}
+
+func (m *SearchManager) Create(raw *search.Search) (*search.Search, error) {
+	raw.Id = bson.NewObjectId()
+	raw.Created = time.Now().UTC()
+	raw.Updated = raw.Created
+	raw.Version = 1
+	if raw.Default {
+		if err := m.resetDefault(raw); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.col.Insert(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// Update the search and increment its version.
+// Returns ErrVersionConflict if the search was updated since it had been read.
+func (m *SearchManager) Update(obj *search.Search) error {
+	obj.Updated = time.Now().UTC()
+	if obj.Default {
+		if err := m.resetDefault(obj); err != nil {
+			return err
+		}
+	}
+	version := obj.Version
+	obj.Version++
+	if err := m.manager.UpdateVersion(m.col, obj.Id, version, obj); err != nil {
+		obj.Version = version
+		return err
+	}
+	return nil
+}
+
+func (m *SearchManager) Remove(obj *search.Search) error {
+	return m.col.RemoveId(obj.Id)
+}
+
+// only one search could be the default for the user and type
+func (m *SearchManager) resetDefault(obj *search.Search) error {
+	_, err := m.col.UpdateAll(
+		bson.M{"user": obj.User, "type": obj.Type, "default": true, "_id": bson.M{"$ne": obj.Id}},
+		bson.M{"$set": bson.M{"default": false}, "$inc": bson.M{"version": 1}},
+	)
+	return err
+}
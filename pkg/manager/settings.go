@@ -0,0 +1,44 @@
+package manager
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// SettingsManager keeps settings which are changed by admins without restart,
+// they override the config of all dispatchers until they are reset
+type SettingsManager struct {
+	manager *Manager
+	col     *mgo.Collection
+}
+
+func (m *SettingsManager) Init() error {
+	return nil
+}
+
+// Get decodes the setting into the result, mgo.ErrNotFound is returned if the setting isn't changed
+func (m *SettingsManager) Get(key string, result interface{}) error {
+	doc := &struct {
+		Value bson.Raw
+	}{}
+	if err := m.manager.run(func() error { return m.col.FindId(key).One(doc) }); err != nil {
+		return err
+	}
+	return doc.Value.Unmarshal(result)
+}
+
+func (m *SettingsManager) Set(key string, value interface{}) error {
+	return m.manager.write(func() error {
+		_, err := m.col.UpsertId(key, bson.M{"value": value})
+		return err
+	})
+}
+
+// Reset removes the setting, so the config value is used again
+func (m *SettingsManager) Reset(key string) error {
+	err := m.manager.write(func() error { return m.col.RemoveId(key) })
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
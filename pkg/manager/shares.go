@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/share"
+	"github.com/bearded-web/bearded/pkg/fltr"
+	"github.com/bearded-web/bearded/pkg/utils"
+)
+
+type ShareManager struct {
+	manager *Manager
+	col     *mgo.Collection
+}
+
+type ShareFltr struct {
+	Created  time.Time      `fltr:"created,gte,gt,lte,lt"`
+	Resource share.Resource `fltr:"resource,in"`
+	Project  bson.ObjectId  `fltr:"project"`
+	Scan     bson.ObjectId  `fltr:"scan"`
+	Owner    bson.ObjectId  `fltr:"owner"`
+	Revoked  *bool          `fltr:"revoked"`
+}
+
+func (m *ShareManager) Init() error {
+	log.Infof("Initialize share indexes")
+	err := m.col.EnsureIndex(mgo.Index{
+		Key:        []string{"hash"},
+		Unique:     true,
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
+	for _, index := range []string{"created", "project", "scan", "owner"} {
+		err := m.col.EnsureIndex(mgo.Index{
+			Key:        []string{index},
+			Background: true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *ShareManager) Fltr() *ShareFltr {
+	return &ShareFltr{}
+}
+
+func (m *ShareManager) GetById(id bson.ObjectId) (*share.Share, error) {
+	s := &share.Share{}
+	return s, m.manager.GetById(m.col, id, &s)
+}
+
+// Get the link by the token, revoked and expired links are returned too
+func (m *ShareManager) GetByHash(hash string) (*share.Share, error) {
+	s := &share.Share{}
+	return s, m.manager.GetBy(m.col, &bson.M{"hash": hash}, &s)
+}
+
+func (m *ShareManager) FilterBy(f *ShareFltr, opts ...Opts) ([]*share.Share, int, error) {
+	query := fltr.GetQuery(f)
+	return m.FilterByQuery(query, opts...)
+}
+
+func (m *ShareManager) FilterByQuery(query bson.M, opts ...Opts) ([]*share.Share, int, error) {
+	results := []*share.Share{}
+	count, err := m.manager.FilterBy(m.col, &query, &results, opts...)
+	return results, count, err
+}
+
+func (m *ShareManager) Create(raw *share.Share) (*share.Share, error) {
+	raw.Id = bson.NewObjectId()
+	raw.Created = time.Now().UTC()
+	raw.Updated = raw.Created
+	if len(raw.Hash) == 0 {
+		raw.Hash = utils.RandomString(share.TokenLength)
+	}
+	if err := m.col.Insert(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func (m *ShareManager) Update(obj *share.Share) error {
+	obj.Updated = time.Now().UTC()
+	return m.manager.updateId(m.col, obj.Id, obj)
+}
+
+func (m *ShareManager) Revoke(obj *share.Share) error {
+	obj.Revoked = true
+	return m.Update(obj)
+}
+
+// Touch counts the use of the link
+func (m *ShareManager) Touch(obj *share.Share, now time.Time) error {
+	err := m.manager.updateId(m.col, obj.Id, bson.M{"$set": bson.M{"lastUsed": now}, "$inc": bson.M{"uses": 1}})
+	if err != nil {
+		return err
+	}
+	obj.LastUsed = now
+	obj.Uses++
+	return nil
+}
@@ -3,7 +3,6 @@ package manager
 import (
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
@@ -18,6 +17,14 @@ type TargetFltr struct {
 	Type    target.TargetType `fltr:"type,in"`
 	Updated time.Time         `fltr:"updated,gte,lte"`
 	Created time.Time         `fltr:"created,gte,lte"`
+	// inactive=false is replaced with ActiveQuery, because active targets don't have the field
+	Inactive *bool `fltr:"inactive"`
+}
+
+// ActiveQuery adds the condition for targets which aren't out of service, the query is changed
+func ActiveQuery(query bson.M) bson.M {
+	query["inactive"] = bson.M{"$ne": true}
+	return query
 }
 
 type TargetManager struct {
@@ -26,27 +33,41 @@ type TargetManager struct {
 }
 
 func (m *TargetManager) Init() error {
-	logrus.Infof("Initialize target indexes")
+	log.Infof("Initialize target indexes")
 	err := m.col.EnsureIndex(mgo.Index{
 		Key:        []string{"project"},
 		Background: false,
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	err = m.col.EnsureIndex(mgo.Index{
+		Key:        []string{"tags"},
+		Background: true,
+	})
+	if err != nil {
+		return err
+	}
+	err = m.col.EnsureIndex(mgo.Index{
+		Key:        []string{"compliance"},
+		Background: true,
+		Sparse:     true,
+	})
+	if err != nil {
+		return err
+	}
+	return m.col.EnsureIndex(mgo.Index{
+		Key:        []string{"inactive"},
+		Background: true,
+		Sparse:     true,
+	})
 }
 
 func (m *TargetManager) All() ([]*target.Target, int, error) {
 	results := []*target.Target{}
 
-	query := &bson.M{}
-	q := m.col.Find(query)
-	if err := q.All(&results); err != nil {
-		return nil, 0, err
-	}
-	count, err := q.Count()
-	if err != nil {
-		return nil, 0, err
-	}
-	return results, count, nil
+	count, err := m.manager.All(m.col, &results)
+	return results, count, err
 }
 
 func (m *TargetManager) GetById(id bson.ObjectId) (*target.Target, error) {
@@ -65,27 +86,99 @@ func (m *TargetManager) FilterByQuery(query bson.M, opts ...Opts) ([]*target.Tar
 	return results, count, err
 }
 
+// FilterActive returns only targets which aren't out of service, the query isn't changed
+func (m *TargetManager) FilterActive(query bson.M, opts ...Opts) ([]*target.Target, int, error) {
+	return m.FilterByQuery(ActiveQuery(copyQuery(query)), opts...)
+}
+
+// ComplianceQuery returns the query for targets in scope of the framework, they have it or their project has it.
+// The query isn't changed.
+func (m *TargetManager) ComplianceQuery(query bson.M, framework string) (bson.M, error) {
+	projects := []struct {
+		Id bson.ObjectId `bson:"_id"`
+	}{}
+	inFramework, err := m.manager.scopeQuery(m.manager.Projects.col, bson.M{"compliance": framework})
+	if err != nil {
+		return nil, err
+	}
+	err = m.manager.run(func() error {
+		return m.manager.Projects.col.Find(inFramework).Select(bson.M{"_id": 1}).All(&projects)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]bson.ObjectId, 0, len(projects))
+	for _, p := range projects {
+		ids = append(ids, p.Id)
+	}
+	inScope := bson.M{"$or": []bson.M{{"compliance": framework}, {"project": bson.M{"$in": ids}}}}
+	return bson.M{"$and": []bson.M{copyQuery(query), inScope}}, nil
+}
+
+// SetInactive takes the target out of service or returns it back, issues and scans of the target are kept
+func (m *TargetManager) SetInactive(obj *target.Target, inactive bool) error {
+	obj.Inactive = inactive
+	obj.Deactivated = time.Time{}
+	if inactive {
+		obj.Deactivated = time.Now().UTC()
+	}
+	return m.Update(obj)
+}
+
 func (m *TargetManager) Create(raw *target.Target) (*target.Target, error) {
 	// TODO (m0sth8): add validation
 	raw.Id = bson.NewObjectId()
 	raw.Created = time.Now().UTC()
 	raw.Updated = raw.Created
+	raw.Version = 1
 	raw.SummaryReport = &target.SummaryReport{
 		Issues: map[issue.Severity]int{},
 	}
 	if err := m.col.Insert(raw); err != nil {
 		return nil, err
 	}
-	return raw, nil
+	return raw, m.linkFile(raw)
+}
+
+// Import inserts the target as is, ids and dates are set by the archive import
+func (m *TargetManager) Import(raw *target.Target) error {
+	if err := m.col.Insert(raw); err != nil {
+		return err
+	}
+	return m.linkFile(raw)
 }
 
+// apk files of android targets are visible in the project of the target
+func (m *TargetManager) linkFile(obj *target.Target) error {
+	if obj.Android == nil {
+		return nil
+	}
+	return m.manager.Files.Link(obj.Project, obj.Android.File)
+}
+
+// Update the target and increment its version.
+// Returns ErrVersionConflict if the target was updated since it had been read.
 func (m *TargetManager) Update(obj *target.Target) error {
 	obj.Updated = time.Now().UTC()
-	return m.col.UpdateId(obj.Id, obj)
+	version := obj.Version
+	obj.Version++
+	if err := m.manager.UpdateVersion(m.col, obj.Id, version, obj); err != nil {
+		obj.Version = version
+		return err
+	}
+	return m.linkFile(obj)
 }
 
 func (m *TargetManager) Remove(obj *target.Target) error {
-	return m.col.RemoveId(obj.Id)
+	return m.manager.removeId(m.col, obj.Id)
+}
+
+func (m *TargetManager) RemoveAll(query bson.M) (int, error) {
+	info, err := m.manager.removeAll(m.col, query)
+	if info != nil {
+		return info.Removed, err
+	}
+	return 0, err
 }
 
 func (m *TargetManager) UpdateSummary(obj *target.Target) error {
@@ -97,8 +190,25 @@ func (m *TargetManager) UpdateSummary(obj *target.Target) error {
 		obj.SummaryReport = &target.SummaryReport{}
 	}
 	obj.SummaryReport.Issues = summary
-	// TODO(m0sth8): update only summary field
-	return m.Update(obj)
+	// only the summary is set, so the update doesn't conflict with changes of other fields
+	change := mgo.Change{
+		Update: bson.M{
+			"$set": bson.M{"summaryReport": obj.SummaryReport, "updated": time.Now().UTC()},
+			"$inc": bson.M{"version": 1},
+		},
+		ReturnNew: true,
+	}
+	updated := &target.Target{}
+	query, err := m.manager.scopeQuery(m.col, bson.M{"_id": obj.Id})
+	if err != nil {
+		return err
+	}
+	if _, err := m.col.Find(query).Apply(change, updated); err != nil {
+		return err
+	}
+	obj.Updated = updated.Updated
+	obj.Version = updated.Version
+	return nil
 }
 
 func (m *TargetManager) GetSummaryIssues(targetId bson.ObjectId) (map[issue.Severity]int, error) {
@@ -127,3 +237,20 @@ func (m *TargetManager) UpdateSummaryById(id bson.ObjectId) error {
 	}
 	return m.UpdateSummary(obj)
 }
+
+func (m *TargetManager) Count(query bson.M) (int, error) {
+	return m.manager.count(m.col, query)
+}
+
+// CountActive counts targets which aren't out of service, the query isn't changed
+func (m *TargetManager) CountActive(query bson.M) (int, error) {
+	return m.manager.count(m.col, ActiveQuery(copyQuery(query)))
+}
+
+func copyQuery(query bson.M) bson.M {
+	result := make(bson.M, len(query)+1)
+	for k, v := range query {
+		result[k] = v
+	}
+	return result
+}
@@ -5,7 +5,6 @@ package manager
 import (
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
@@ -27,7 +26,7 @@ type TechFltr struct {
 }
 
 func (s *TechManager) Init() error {
-	logrus.Infof("Initialize tech indexes")
+	log.Infof("Initialize tech indexes")
 	err := s.col.EnsureIndex(mgo.Index{
 		Key:        []string{"target", "name", "version"},
 		Unique:     true,
@@ -48,12 +47,8 @@ func (s *TechManager) Init() error {
 		}
 	}
 	if s.manager.Cfg.TextSearchEnable {
-		logrus.Infof("Create text indexes for tech")
-		err := s.col.EnsureIndex(mgo.Index{
-			Key:             []string{"$text:name"},
-			Background:      true,
-			DefaultLanguage: "english",
-		})
+		log.Infof("Create text indexes for tech")
+		err := s.manager.ensureTextIndex(s.col, s.manager.textIndex("tech", []string{"name"}, nil))
 		if err != nil {
 			return err
 		}
@@ -103,15 +98,15 @@ func (m *TechManager) Create(raw *tech.TargetTech) (*tech.TargetTech, error) {
 
 func (m *TechManager) Update(obj *tech.TargetTech) error {
 	obj.Updated = time.Now().UTC()
-	return m.col.UpdateId(obj.Id, obj)
+	return m.manager.updateId(m.col, obj.Id, obj)
 }
 
 func (m *TechManager) Remove(obj *tech.TargetTech) error {
-	return m.col.RemoveId(obj.Id)
+	return m.manager.removeId(m.col, obj.Id)
 }
 
 func (m *TechManager) RemoveAll(query bson.M) (int, error) {
-	info, err := m.col.RemoveAll(query)
+	info, err := m.manager.removeAll(m.col, query)
 	if info != nil {
 		return info.Removed, err
 	}
@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/fltr"
+)
+
+type TemplateManager struct {
+	manager *Manager
+	col     *mgo.Collection
+}
+
+type TemplateFltr struct {
+	Project bson.ObjectId `fltr:"project"`
+	Plan    bson.ObjectId `fltr:"plan"`
+}
+
+func (m *TemplateManager) Init() error {
+	log.Infof("Initialize scan template indexes")
+	return m.col.EnsureIndex(mgo.Index{
+		Key:        []string{"project"},
+		Background: true,
+	})
+}
+
+func (m *TemplateManager) Fltr() *TemplateFltr {
+	return &TemplateFltr{}
+}
+
+func (m *TemplateManager) GetById(id bson.ObjectId) (*scan.Template, error) {
+	u := &scan.Template{}
+	return u, m.manager.GetById(m.col, id, u)
+}
+
+func (m *TemplateManager) FilterBy(f *TemplateFltr, opts ...Opts) ([]*scan.Template, int, error) {
+	query := fltr.GetQuery(f)
+	return m.FilterByQuery(query, opts...)
+}
+
+func (m *TemplateManager) FilterByQuery(query bson.M, opts ...Opts) ([]*scan.Template, int, error) {
+	results := []*scan.Template{}
+	count, err := m.manager.FilterBy(m.col, &query, &results, opts...)
+	return results, count, err
+}
+
+func (m *TemplateManager) Create(raw *scan.Template) (*scan.Template, error) {
+	raw.Id = bson.NewObjectId()
+	raw.Created = time.Now().UTC()
+	raw.Updated = raw.Created
+	if err := m.col.Insert(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func (m *TemplateManager) Update(obj *scan.Template) error {
+	obj.Updated = time.Now().UTC()
+	return m.manager.updateId(m.col, obj.Id, obj)
+}
+
+func (m *TemplateManager) Remove(obj *scan.Template) error {
+	return m.manager.removeId(m.col, obj.Id)
+}
+
+func (m *TemplateManager) RemoveAll(query bson.M) (int, error) {
+	info, err := m.manager.removeAll(m.col, query)
+	if info != nil {
+		return info.Removed, err
+	}
+	return 0, err
+}
@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const DefaultTextLanguage = "english"
+
+// textIndex returns the text index of the fields with the configured language and weights,
+// weights are configured by collection.field, default ones are used for other fields
+func (m *Manager) textIndex(collection string, fields []string, weights map[string]int) mgo.Index {
+	index := mgo.Index{
+		Weights:         map[string]int{},
+		Background:      true,
+		DefaultLanguage: m.Cfg.TextLanguage,
+	}
+	if index.DefaultLanguage == "" {
+		index.DefaultLanguage = DefaultTextLanguage
+	}
+	for _, field := range fields {
+		index.Key = append(index.Key, "$text:"+field)
+		if w, ok := m.Cfg.TextWeights[collection+"."+field]; ok {
+			index.Weights[field] = w
+		} else if w, ok := weights[field]; ok {
+			index.Weights[field] = w
+		}
+	}
+	return index
+}
+
+// ensureTextIndex rebuilds the text index if it's existed with other options,
+// so changes of the language and weights are applied on start
+func (m *Manager) ensureTextIndex(col *mgo.Collection, index mgo.Index) error {
+	err := col.EnsureIndex(index)
+	if !isIndexConflict(err) {
+		return err
+	}
+	log.Infof("Rebuild text index of %s: %s", col.Name, err)
+	if err := col.DropIndex(index.Key...); err != nil {
+		return err
+	}
+	return col.EnsureIndex(index)
+}
+
+// ensureTTLIndex changes the expiration of the ttl index if it's existed with another one,
+// so changes of expiry settings are applied on start without rebuilding the index
+func (m *Manager) ensureTTLIndex(col *mgo.Collection, index mgo.Index) error {
+	err := col.EnsureIndex(index)
+	if !isIndexConflict(err) {
+		return err
+	}
+	log.Infof("Change ttl of %s index %v to %s", col.Name, index.Key, index.ExpireAfter)
+	keys := bson.D{}
+	for _, key := range index.Key {
+		keys = append(keys, bson.DocElem{Name: key, Value: 1})
+	}
+	return col.Database.Run(bson.D{
+		{Name: "collMod", Value: col.Name},
+		{Name: "index", Value: bson.M{"keyPattern": keys, "expireAfterSeconds": int(index.ExpireAfter.Seconds())}},
+	}, nil)
+}
+
+// mongo returns IndexOptionsConflict or IndexKeySpecsConflict if the index with the same name is existed
+func isIndexConflict(err error) bool {
+	switch e := err.(type) {
+	case *mgo.QueryError:
+		return e.Code == 85 || e.Code == 86
+	case *mgo.LastError:
+		return e.Code == 85 || e.Code == 86
+	case nil:
+		return false
+	}
+	return strings.Contains(err.Error(), "already exists with different options")
+}
+
+// mongo returns IndexNotFound or NamespaceNotFound if the index or the collection isn't existed
+func isIndexNotFound(err error) bool {
+	switch e := err.(type) {
+	case *mgo.QueryError:
+		return e.Code == 26 || e.Code == 27
+	case *mgo.LastError:
+		return e.Code == 26 || e.Code == 27
+	}
+	return strings.Contains(err.Error(), "index not found") || strings.Contains(err.Error(), "ns not found")
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
@@ -15,6 +14,9 @@ import (
 	"github.com/bearded-web/bearded/pkg/utils"
 )
 
+// last use of a token is saved at most once per this interval if ManagerConfig.TokenTouchInterval is not set
+const DefaultTokenTouchInterval = 5 * time.Minute
+
 type TokenManager struct {
 	manager *Manager
 	col     *mgo.Collection
@@ -24,14 +26,15 @@ type TokenFltr struct {
 	Updated time.Time     `fltr:"updated,gte,gt,lte,lt"`
 	Created time.Time     `fltr:"created,gte,gt,lte,lt"`
 	User    bson.ObjectId `fltr:"user"`
+	Project bson.ObjectId `fltr:"project"`
 	Removed bool          `fltr:"removed"`
 }
 
 func (s *TokenManager) Init() error {
-	logrus.Infof("Initialize token indexes")
+	log.Infof("Initialize token indexes")
 
 	// TODO (m0sth8): check what indexes are really used
-	for _, index := range []string{"created", "updated", "user"} {
+	for _, index := range []string{"created", "updated", "user", "project"} {
 		err := s.col.EnsureIndex(mgo.Index{
 			Key:        []string{index},
 			Background: true,
@@ -52,9 +55,10 @@ func (m *TokenManager) GetById(id bson.ObjectId) (*token.Token, error) {
 	return u, m.manager.GetById(m.col, id, &u)
 }
 
+// Get not removed token by hash
 func (m *TokenManager) GetByHash(hash string) (*token.Token, error) {
 	t := &token.Token{}
-	query := &bson.M{"hash": hash}
+	query := &bson.M{"hash": hash, "removed": bson.M{"$ne": true}}
 	return t, m.manager.GetBy(m.col, query, &t)
 }
 
@@ -79,9 +83,42 @@ func (m *TokenManager) FilterBy(f *TokenFltr, opts ...Opts) ([]*token.Token, int
 func (m *TokenManager) FilterByQuery(query bson.M, opts ...Opts) ([]*token.Token, int, error) {
 	results := []*token.Token{}
 	count, err := m.manager.FilterBy(m.col, &query, &results, opts...)
+	if staleAfter := m.manager.Cfg.TokenStaleAfter; staleAfter > 0 {
+		since := time.Now().UTC().Add(-staleAfter)
+		for _, t := range results {
+			t.Stale = t.IsStale(since)
+		}
+	}
 	return results, count, err
 }
 
+// Touch saves the time and the client ip of the token use, if the previous one is older than the touch interval.
+// The token is already read for authorization, so most of requests don't write anything.
+// Concurrent requests of all dispatchers save only one use, false is returned for the rest of them.
+func (m *TokenManager) Touch(t *token.Token, ip string, now time.Time) (bool, error) {
+	interval := m.manager.Cfg.TokenTouchInterval
+	if interval == 0 {
+		interval = DefaultTokenTouchInterval
+	}
+	if !t.LastUsed.IsZero() && now.Sub(t.LastUsed) < interval {
+		return false, nil
+	}
+	query := bson.M{"_id": t.Id, "$or": []bson.M{
+		{"lastUsed": bson.M{"$exists": false}},
+		{"lastUsed": bson.M{"$lt": now.Add(-interval)}},
+	}}
+	err := m.col.Update(query, bson.M{"$set": bson.M{"lastUsed": now, "lastIp": ip}})
+	if err != nil {
+		if m.manager.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	t.LastUsed = now
+	t.LastIp = ip
+	return true, nil
+}
+
 func (m *TokenManager) Create(raw *token.Token) (*token.Token, error) {
 	// TODO (m0sth8): add validation
 	raw.Id = bson.NewObjectId()
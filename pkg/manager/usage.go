@@ -0,0 +1,209 @@
+package manager
+
+// Usage of the api by users
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/usage"
+)
+
+type UsageManager struct {
+	manager *Manager
+	col     *mgo.Collection
+}
+
+func (m *UsageManager) Init() error {
+	log.Infof("Initialize usage indexes")
+	// buckets of tokens are kept apart from buckets of users, the old index of users is replaced
+	if err := m.col.DropIndex("user", "hour"); err != nil && !isIndexNotFound(err) {
+		return err
+	}
+	err := m.col.EnsureIndex(mgo.Index{
+		Key:        []string{"user", "token", "hour"},
+		Unique:     true,
+		Background: true,
+	})
+	if err != nil {
+		return err
+	}
+	// buckets are needed only for the longest window
+	return m.col.EnsureIndex(mgo.Index{
+		Key:         []string{"hour"},
+		Background:  true,
+		ExpireAfter: usage.WindowMonth.Duration() + time.Hour,
+	})
+}
+
+// bucket of the user in the hour, the token is empty for the bucket of the user itself
+func bucketKey(user, token bson.ObjectId, hour time.Time) bson.M {
+	key := bson.M{"user": user, "token": nil, "hour": hour.UTC().Truncate(time.Hour)}
+	if token != "" {
+		key["token"] = token
+	}
+	return key
+}
+
+// Add increments counters of the user with the token in the bucket of the hour,
+// the token is empty for requests of sessions and for scans
+func (m *UsageManager) Add(user, token bson.ObjectId, hour time.Time, requests, scans int) error {
+	return m.upsert(bucketKey(user, token, hour), bson.M{"$inc": bson.M{"requests": requests, "scans": scans}})
+}
+
+// upsert the bucket, concurrent upserts of the missing bucket could both insert it, so the loser
+// gets the duplicate key error and is applied again to the inserted bucket
+func (m *UsageManager) upsert(key, change bson.M) error {
+	_, err := m.col.Upsert(key, change)
+	if mgo.IsDup(err) {
+		_, err = m.col.Upsert(key, change)
+	}
+	return err
+}
+
+// AddScans increments scans of the user in the bucket of the hour if the user doesn't get over the limit
+// of scans in the day window, zero limit is unlimited. It returns false if nothing is added.
+// Only the bucket of the current hour is written, buckets of earlier hours are summed and the rest
+// of the limit is checked and incremented in the bucket by one update.
+func (m *UsageManager) AddScans(user bson.ObjectId, hour time.Time, n, limit int) (bool, error) {
+	key := bucketKey(user, "", hour)
+	if limit <= 0 {
+		err := m.upsert(key, bson.M{"$inc": bson.M{"scans": n}})
+		return err == nil, err
+	}
+	others, err := m.sum(bson.M{"user": user, "hour": bson.M{"$gte": usage.WindowDay.Since(hour)}, "$nor": []bson.M{key}})
+	if err != nil {
+		return false, err
+	}
+	left := limit - others.Scans - n
+	if left < 0 {
+		return false, nil
+	}
+	inc := func() error {
+		limited := bson.M{"scans": bson.M{"$lte": left}}
+		for k, v := range key {
+			limited[k] = v
+		}
+		return m.col.Update(limited, bson.M{"$inc": bson.M{"scans": n}})
+	}
+	if err := inc(); err != mgo.ErrNotFound {
+		return err == nil, err
+	}
+	// the bucket is missing or it's full
+	err = m.col.Insert(&usage.Bucket{Id: bson.NewObjectId(), User: user, Hour: hour.UTC().Truncate(time.Hour), Scans: n})
+	if err == nil || !mgo.IsDup(err) {
+		return err == nil, err
+	}
+	// the bucket is created meanwhile
+	if err := inc(); err != mgo.ErrNotFound {
+		return err == nil, err
+	}
+	return false, nil
+}
+
+// sum of buckets which match the query
+func (m *UsageManager) sum(query bson.M) (*usage.Counts, error) {
+	pipeline := []bson.M{
+		{"$match": query},
+		{"$group": bson.M{
+			"_id":      nil,
+			"requests": bson.M{"$sum": "$requests"},
+			"scans":    bson.M{"$sum": "$scans"},
+		}},
+	}
+	groups := []*usage.Counts{}
+	if err := m.manager.run(func() error { return m.col.Pipe(pipeline).All(&groups) }); err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return &usage.Counts{}, nil
+	}
+	return groups[0], nil
+}
+
+// CountTokens sums requests of tokens of the user since the hour, tokens without buckets are missed
+func (m *UsageManager) CountTokens(user bson.ObjectId, since time.Time) ([]*usage.TokenCounts, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"user": user, "token": bson.M{"$ne": nil}, "hour": bson.M{"$gte": since}}},
+		{"$group": bson.M{
+			"_id":      "$token",
+			"requests": bson.M{"$sum": "$requests"},
+		}},
+		{"$sort": bson.D{{Name: "requests", Value: -1}, {Name: "_id", Value: 1}}},
+	}
+	results := []*usage.TokenCounts{}
+	if err := m.manager.run(func() error { return m.col.Pipe(pipeline).All(&results) }); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// CountUsers sums buckets of users since the hour, users without buckets are missed
+func (m *UsageManager) CountUsers(users []bson.ObjectId, since time.Time) (map[bson.ObjectId]*usage.Counts, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"user": bson.M{"$in": users}, "hour": bson.M{"$gte": since}}},
+		{"$group": bson.M{
+			"_id":      "$user",
+			"requests": bson.M{"$sum": "$requests"},
+			"scans":    bson.M{"$sum": "$scans"},
+		}},
+	}
+	groups := []*usage.Consumer{}
+	if err := m.manager.run(func() error { return m.col.Pipe(pipeline).All(&groups) }); err != nil {
+		return nil, err
+	}
+	result := map[bson.ObjectId]*usage.Counts{}
+	for _, g := range groups {
+		result[g.User] = &usage.Counts{Requests: g.Requests, Scans: g.Scans}
+	}
+	return result, nil
+}
+
+// Count sums buckets of the user since the hour
+func (m *UsageManager) Count(user bson.ObjectId, since time.Time) (*usage.Counts, error) {
+	counts, err := m.CountUsers([]bson.ObjectId{user}, since)
+	if err != nil {
+		return nil, err
+	}
+	if c := counts[user]; c != nil {
+		return c, nil
+	}
+	return &usage.Counts{}, nil
+}
+
+// Top returns users with the most requests or scans since the hour and the number of active users
+func (m *UsageManager) Top(since time.Time, by string, skip, limit int) ([]*usage.Consumer, int, error) {
+	group := []bson.M{
+		{"$match": bson.M{"hour": bson.M{"$gte": since}}},
+		{"$group": bson.M{
+			"_id":      "$user",
+			"requests": bson.M{"$sum": "$requests"},
+			"scans":    bson.M{"$sum": "$scans"},
+		}},
+	}
+	counted := []struct {
+		Count int
+	}{}
+	countPipeline := append(append([]bson.M{}, group...), bson.M{"$group": bson.M{"_id": nil, "count": bson.M{"$sum": 1}}})
+	if err := m.manager.run(func() error { return m.col.Pipe(countPipeline).All(&counted) }); err != nil {
+		return nil, 0, err
+	}
+	count := 0
+	if len(counted) > 0 {
+		count = counted[0].Count
+	}
+	pipeline := append(group, bson.M{"$sort": bson.D{{Name: by, Value: -1}, {Name: "_id", Value: 1}}})
+	if skip > 0 {
+		pipeline = append(pipeline, bson.M{"$skip": skip})
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+	results := []*usage.Consumer{}
+	if err := m.manager.run(func() error { return m.col.Pipe(pipeline).All(&results) }); err != nil {
+		return nil, 0, err
+	}
+	return results, count, nil
+}
@@ -0,0 +1,49 @@
+package manager
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/usage"
+	"github.com/bearded-web/bearded/pkg/tests"
+)
+
+func TestUsageConcurrentUpsert(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := New(mongo.DB(dbName))
+	require.NoError(t, mgr.Usage.Init())
+
+	// the bucket is missing, so every goroutine tries to insert it
+	user, hour := bson.NewObjectId(), time.Now().UTC()
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				_, err := mgr.Usage.AddScans(user, hour, 1, 0)
+				errs <- err
+				return
+			}
+			errs <- mgr.Usage.Add(user, "", hour, 1, 1)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	bucket := &usage.Bucket{}
+	require.NoError(t, mgr.Usage.col.Find(bucketKey(user, "", hour)).One(bucket))
+	require.Equal(t, 20, bucket.Scans)
+	require.Equal(t, 10, bucket.Requests)
+}
@@ -3,7 +3,6 @@ package manager
 import (
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
@@ -16,6 +15,9 @@ import (
 
 const AgentEmail = "agent@local"
 
+// emails of service accounts for project tokens are generated in this domain
+const ServiceEmailDomain = "service.local"
+
 type UserManager struct {
 	manager *Manager
 	col     *mgo.Collection // default collection
@@ -28,7 +30,7 @@ type UserFltr struct {
 }
 
 func (m *UserManager) Init() error {
-	logrus.Infof("Initialize user indexes")
+	log.Infof("Initialize user indexes")
 	err := m.col.EnsureIndex(mgo.Index{
 		Key:        []string{"email"},
 		Unique:     true,
@@ -143,3 +145,11 @@ func (m *UserManager) Update(obj *user.User) error {
 	}
 	return m.col.UpdateId(obj.Id, obj)
 }
+
+func (m *UserManager) RemoveAll(query bson.M) (int, error) {
+	info, err := m.col.RemoveAll(query)
+	if info != nil {
+		return info.Removed, err
+	}
+	return 0, err
+}
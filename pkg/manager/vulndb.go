@@ -1,6 +1,13 @@
 package manager
 
 import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
 	"github.com/bearded-web/bearded/models/issue"
 	"github.com/bearded-web/bearded/models/vuln"
 	vulndb "github.com/vulndb/vulndb-go"
@@ -11,18 +18,43 @@ type VulndbManager struct {
 	manager *Manager
 
 	vulnList []*vuln.Vuln
+	// vulndb is loaded once, so lookups are indexed instead of cached
+	byId  map[int]*vuln.Vuln
+	byCwe map[string][]*vuln.Vuln
+	byCve map[string][]*vuln.Vuln
+	// severities of the last start to find changed entries
+	state *mgo.Collection
 }
 
+const vulndbSeveritiesState = "severities"
+
+// vulndb doesn't have cve ids, they are taken from urls and titles of references
+var cvePattern = regexp.MustCompile(`(?i)\bCVE-\d{4}-\d{4,}\b`)
+
 func (m *VulndbManager) Init() error {
 	vulnRawList, err := bindata.LoadFromBin()
 	if err != nil {
 		return err
 	}
 	vulnList := make([]*vuln.Vuln, 0, len(vulnRawList))
+	byId := make(map[int]*vuln.Vuln, len(vulnRawList))
+	byCwe := map[string][]*vuln.Vuln{}
+	byCve := map[string][]*vuln.Vuln{}
 	for _, rawVuln := range vulnRawList {
-		vulnList = append(vulnList, convertRawVuln(rawVuln))
+		v := convertRawVuln(rawVuln)
+		vulnList = append(vulnList, v)
+		byId[v.Id] = v
+		for _, cwe := range v.Cwe {
+			byCwe[cwe] = append(byCwe[cwe], v)
+		}
+		for _, cve := range v.Cve {
+			byCve[cve] = append(byCve[cve], v)
+		}
 	}
 	m.vulnList = vulnList
+	m.byId = byId
+	m.byCwe = byCwe
+	m.byCve = byCve
 	return nil
 }
 
@@ -31,16 +63,56 @@ func (m *VulndbManager) GetVulns() []*vuln.Vuln {
 }
 
 func (m *VulndbManager) GetById(id int) *vuln.Vuln {
-	for _, vuln := range m.vulnList {
-		if vuln.Id == id {
-			return vuln
+	return m.byId[id]
+}
+
+// GetByCwe returns vulns which are related to the cwe id, like 79
+func (m *VulndbManager) GetByCwe(cwe string) []*vuln.Vuln {
+	return m.byCwe[cwe]
+}
+
+// GetByCve returns vulns which reference the cve id, like CVE-2014-6271, the case of the id is ignored
+func (m *VulndbManager) GetByCve(cve string) []*vuln.Vuln {
+	return m.byCve[strings.ToUpper(cve)]
+}
+
+// Get severities of vulns which are changed since the last start, nil if it's the first start
+func (m *VulndbManager) GetChanged() (map[int]issue.Severity, error) {
+	doc := &struct {
+		Severities map[string]issue.Severity
+	}{}
+	err := m.state.FindId(vulndbSeveritiesState).One(doc)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	changed := map[int]issue.Severity{}
+	for _, v := range m.vulnList {
+		// new entries don't have linked issues yet
+		if prev, ok := doc.Severities[strconv.Itoa(v.Id)]; ok && prev != v.Severity {
+			changed[v.Id] = v.Severity
 		}
 	}
-	return nil
+	return changed, nil
+}
+
+// Remember current severities, keys are strings because mongo doesn't support int keys
+func (m *VulndbManager) SaveSeverities() error {
+	severities := make(map[string]issue.Severity, len(m.vulnList))
+	for _, v := range m.vulnList {
+		severities[strconv.Itoa(v.Id)] = v.Severity
+	}
+	_, err := m.state.UpsertId(vulndbSeveritiesState, bson.M{"severities": severities})
+	return err
 }
 
 func (m *VulndbManager) Copy(new *VulndbManager) {
 	new.vulnList = m.vulnList
+	new.byId = m.byId
+	new.byCwe = m.byCwe
+	new.byCve = m.byCve
 }
 
 func convertRawVuln(rawVuln *vulndb.Vuln) *vuln.Vuln {
@@ -57,20 +129,29 @@ func convertRawVuln(rawVuln *vulndb.Vuln) *vuln.Vuln {
 	}
 	for _, ref := range rawVuln.References {
 		v.References = append(v.References, vuln.Reference{Url: ref.Url, Title: ref.Title})
+		v.Cve = appendCve(v.Cve, ref.Url+" "+ref.Title)
 	}
 	return v
 }
 
-var severityMap = map[string]issue.Severity{
-	"info":          issue.SeverityInfo,
-	"informational": issue.SeverityInfo,
-	"low":           issue.SeverityLow,
-	"medium":        issue.SeverityMedium,
-	"high":          issue.SeverityHigh,
+// add cve ids of the text which aren't in the list yet
+func appendCve(list []string, text string) []string {
+outer:
+	for _, cve := range cvePattern.FindAllString(text, -1) {
+		cve = strings.ToUpper(cve)
+		for _, existed := range list {
+			if existed == cve {
+				continue outer
+			}
+		}
+		list = append(list, cve)
+	}
+	return list
 }
 
+// vulndb severities are mapped into the current severity scheme
 func convertVulnSeverity(sev string) issue.Severity {
-	if severity, ok := severityMap[sev]; ok {
+	if severity, ok := issue.MapSeverity(issue.Severity(sev)); ok {
 		return severity
 	}
 	return issue.SeverityError
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/webhook"
+	"github.com/bearded-web/bearded/pkg/fltr"
+)
+
+// deliveries kept for every subscription if ManagerConfig.WebhookHistory is not set
+const DefaultWebhookHistory = 200
+
+// Webhook deliveries, only recent ones are kept for every subscription
+
+type WebhookManager struct {
+	manager *Manager
+	col     *mgo.Collection
+}
+
+type DeliveryFltr struct {
+	Status webhook.Status `fltr:"status"`
+	Type   string         `fltr:"type,in"`
+}
+
+func (m *WebhookManager) Init() error {
+	log.Infof("Initialize webhook delivery indexes")
+	return m.col.EnsureIndex(mgo.Index{
+		Key:        []string{"subscription", "-_id"},
+		Background: true,
+	})
+}
+
+func (m *WebhookManager) Fltr() *DeliveryFltr {
+	return &DeliveryFltr{}
+}
+
+func (m *WebhookManager) GetById(id bson.ObjectId) (*webhook.Delivery, error) {
+	u := &webhook.Delivery{}
+	return u, m.manager.GetById(m.col, id, u)
+}
+
+func (m *WebhookManager) FilterBy(f *DeliveryFltr, opts ...Opts) ([]*webhook.Delivery, int, error) {
+	query := fltr.GetQuery(f)
+	return m.FilterByQuery(query, opts...)
+}
+
+func (m *WebhookManager) FilterByQuery(query bson.M, opts ...Opts) ([]*webhook.Delivery, int, error) {
+	results := []*webhook.Delivery{}
+	count, err := m.manager.FilterBy(m.col, &query, &results, opts...)
+	return results, count, err
+}
+
+// Create the delivery and remove the oldest deliveries of the subscription above the history size
+func (m *WebhookManager) Create(raw *webhook.Delivery) (*webhook.Delivery, error) {
+	raw.Id = bson.NewObjectId()
+	raw.Created = time.Now().UTC()
+	if err := m.col.Insert(raw); err != nil {
+		return nil, err
+	}
+	if err := m.rotate(raw.Subscription); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func (m *WebhookManager) rotate(subscription string) error {
+	history := m.manager.Cfg.WebhookHistory
+	if history == 0 {
+		history = DefaultWebhookHistory
+	}
+	last := &struct {
+		Id bson.ObjectId `bson:"_id"`
+	}{}
+	err := m.col.Find(bson.M{"subscription": subscription}).
+		Select(bson.M{"_id": 1}).
+		Sort("-_id").
+		Skip(history - 1).
+		One(last)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	_, err = m.manager.removeAll(m.col, bson.M{"subscription": subscription, "_id": bson.M{"$lt": last.Id}})
+	return err
+}
@@ -0,0 +1,197 @@
+package normalize
+
+// Plugins report the same vulnerabilities in different shapes. Issues are normalized before they are stored,
+// so merging and reports don't depend on the plugin: a plugin adapter maps its specific raw fields
+// to the canonical ones, then the class, the severity and the location are brought to the common form.
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+// Adapter maps plugin specific output into the canonical issue, mapped fields should be removed from Raw
+type Adapter interface {
+	Normalize(*issue.Issue)
+}
+
+type AdapterFunc func(*issue.Issue)
+
+func (f AdapterFunc) Normalize(iss *issue.Issue) {
+	f(iss)
+}
+
+// Canonical fields for Fields adapter
+const (
+	FieldSummary  = "summary"
+	FieldDesc     = "desc"
+	FieldSeverity = "severity"
+	FieldCvss     = "cvss"
+	FieldClass    = "class"
+	FieldVulnType = "vulnType"
+	FieldUrl      = "url"
+)
+
+// Fields adapter moves raw fields to canonical ones by name, e.g. {"risk": "severity"}.
+// Canonical fields which are already reported by the plugin aren't overwritten.
+type Fields map[string]string
+
+func (f Fields) Normalize(iss *issue.Issue) {
+	for rawName, field := range f {
+		val, ok := iss.Raw[rawName]
+		if !ok {
+			continue
+		}
+		if set(iss, field, val) {
+			delete(iss.Raw, rawName)
+		}
+	}
+}
+
+// set the canonical field if it's empty, returns false if the value can't be used
+func set(iss *issue.Issue, field string, val interface{}) bool {
+	str := toString(val)
+	switch field {
+	case FieldSummary:
+		if iss.Summary == "" {
+			iss.Summary = str
+		}
+	case FieldDesc:
+		if iss.Desc == "" {
+			iss.Desc = str
+		}
+	case FieldSeverity:
+		if iss.Severity == "" {
+			iss.Severity = issue.Severity(str)
+		}
+	case FieldClass:
+		if iss.Class == "" {
+			iss.Class = issue.Class(str)
+		}
+	case FieldUrl:
+		if iss.Vector == nil {
+			iss.Vector = &issue.Vector{}
+		}
+		if iss.Vector.Url == "" {
+			iss.Vector.Url = str
+		}
+	case FieldCvss:
+		score, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return false
+		}
+		if iss.Cvss == 0 {
+			iss.Cvss = score
+		}
+	case FieldVulnType:
+		vulnType, err := strconv.Atoi(str)
+		if err != nil {
+			return false
+		}
+		if iss.VulnType == 0 {
+			iss.VulnType = vulnType
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func toString(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// Registry keeps adapters by plugin name, it's safe for concurrent use
+type Registry struct {
+	mu       sync.RWMutex
+	adapters map[string]Adapter
+}
+
+func NewRegistry() *Registry {
+	return &Registry{adapters: map[string]Adapter{}}
+}
+
+// Register the adapter for the plugin name without version, the previous one is replaced
+func (r *Registry) Register(plugin string, a Adapter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.adapters[plugin] = a
+}
+
+func (r *Registry) Get(plugin string) (Adapter, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	a, ok := r.adapters[plugin]
+	return a, ok
+}
+
+// Normalize issues reported by the plugin, plugins without adapters get only the common normalization
+func (r *Registry) Normalize(plugin string, issues ...*issue.Issue) {
+	a, _ := r.Get(plugin)
+	for _, iss := range issues {
+		if a != nil {
+			a.Normalize(iss)
+		}
+		Issue(iss)
+	}
+}
+
+// Issue brings the class, the severity and the location of the issue to the common form
+func Issue(iss *issue.Issue) {
+	iss.Class = issue.ClassOf(string(iss.Class))
+	iss.MapSeverity()
+	if iss.Vector != nil {
+		iss.Vector.Url = Url(iss.Vector.Url)
+	}
+	if len(iss.Raw) == 0 {
+		iss.Raw = nil
+	} else {
+		iss.Raw = rawKeys(iss.Raw)
+	}
+}
+
+// Url is lowercased in the scheme and the host, default ports and fragments are removed.
+// Urls which can't be parsed are only trimmed.
+func Url(raw string) string {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && strings.HasSuffix(u.Host, ":80")) ||
+		(u.Scheme == "https" && strings.HasSuffix(u.Host, ":443")) {
+		u.Host = u.Host[:strings.LastIndex(u.Host, ":")]
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// keys with dots or starting with $ can't be stored in mongo
+func rawKeys(raw map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(raw))
+	for key, val := range raw {
+		key = strings.Replace(key, ".", "_", -1)
+		if strings.HasPrefix(key, "$") {
+			key = "_" + key[1:]
+		}
+		if m, ok := val.(map[string]interface{}); ok {
+			val = rawKeys(m)
+		}
+		result[key] = val
+	}
+	return result
+}
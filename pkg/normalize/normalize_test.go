@@ -0,0 +1,49 @@
+package normalize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+func TestFields(t *testing.T) {
+	r := NewRegistry()
+	r.Register("barbudo/w3af", Fields{
+		"name":     FieldSummary,
+		"severity": FieldSeverity,
+		"url":      FieldUrl,
+		"type":     FieldClass,
+		"cvss":     FieldCvss,
+	})
+	iss := &issue.Issue{Raw: map[string]interface{}{
+		"name":        "Cross site scripting vulnerability",
+		"severity":    "Critical",
+		"url":         "HTTP://Example.com:80/search?q=1#top",
+		"type":        "Cross Site Scripting",
+		"cvss":        "bad",
+		"plugin.name": "xss",
+	}}
+	r.Normalize("barbudo/w3af", iss)
+
+	require.Equal(t, "Cross site scripting vulnerability", iss.Summary)
+	require.Equal(t, issue.SeverityHigh, iss.Severity)
+	require.Equal(t, issue.ClassXss, iss.Class)
+	require.Equal(t, "http://example.com/search?q=1", iss.Vector.Url)
+	require.Equal(t, map[string]interface{}{"cvss": "bad", "plugin_name": "xss"}, iss.Raw)
+}
+
+func TestNormalizeWithoutAdapter(t *testing.T) {
+	r := NewRegistry()
+	iss := &issue.Issue{Summary: "sqli", Severity: "moderate", Class: "SQL Injection", Raw: map[string]interface{}{}}
+	r.Normalize("unknown", iss)
+	require.Equal(t, issue.SeverityMedium, iss.Severity)
+	require.Equal(t, issue.ClassSqli, iss.Class)
+	require.Nil(t, iss.Raw)
+
+	iss = &issue.Issue{Summary: "strange", Class: "something"}
+	r.Normalize("unknown", iss)
+	require.Equal(t, issue.ClassOther, iss.Class)
+	require.Nil(t, iss.Vector)
+}
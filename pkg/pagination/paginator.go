@@ -13,6 +13,9 @@ const (
 	DefaultSkipName     = "skip"
 	DefaultLimitDefault = 20
 	DefaultLimitMax     = 100
+
+	// set when the requested limit is greater than the max one
+	LimitHeader = "X-Pagination-Limit"
 )
 
 type Paginator struct {
@@ -32,6 +35,20 @@ func New() *Paginator {
 	}
 }
 
+// Create paginator with limits, the default limit can't be greater than the max one
+func NewWithLimits(limitDefault, limitMax int) (*Paginator, error) {
+	if limitDefault <= 0 || limitMax <= 0 {
+		return nil, fmt.Errorf("limits must be positive, got default %d and max %d", limitDefault, limitMax)
+	}
+	if limitDefault > limitMax {
+		return nil, fmt.Errorf("default limit %d is greater than max %d", limitDefault, limitMax)
+	}
+	p := New()
+	p.LimitDefault = limitDefault
+	p.LimitMax = limitMax
+	return p, nil
+}
+
 func (p *Paginator) LimitParam() *restful.Parameter {
 	return restful.QueryParameter(p.LimitName, "limit objects").DataType("integer")
 }
@@ -98,8 +115,14 @@ func (p *Paginator) ParseLimit(req *restful.Request) int {
 			limit = val
 		}
 	}
-	if limit < 0 {
-		limit = p.LimitDefault
+	return p.Clamp(limit)
+}
+
+// Clamp the limit to the max one, zero or negative limits are replaced with the default one,
+// because zero limit means no limit for mongo
+func (p *Paginator) Clamp(limit int) int {
+	if limit <= 0 {
+		return p.LimitDefault
 	}
 	if limit > p.LimitMax {
 		limit = p.LimitMax
@@ -107,6 +130,14 @@ func (p *Paginator) ParseLimit(req *restful.Request) int {
 	return limit
 }
 
+// Container filter which tells clients about the effective limit if the requested one is clamped
+func (p *Paginator) LimitFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	if val, err := strconv.Atoi(req.QueryParameter(p.LimitName)); err == nil && val > p.LimitMax {
+		resp.Header().Set(LimitHeader, strconv.Itoa(p.LimitMax))
+	}
+	chain.ProcessFilter(req, resp)
+}
+
 func (p *Paginator) PreviousUrl(req *restful.Request) string {
 	skip := p.ParseSkip(req)
 	limit := p.ParseLimit(req)
@@ -0,0 +1,63 @@
+package pagination
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWithLimits(t *testing.T) {
+	_, err := NewWithLimits(50, 10)
+	require.Error(t, err)
+	_, err = NewWithLimits(0, 10)
+	require.Error(t, err)
+
+	p, err := NewWithLimits(10, 50)
+	require.NoError(t, err)
+	require.Equal(t, 10, p.LimitDefault)
+	require.Equal(t, 50, p.LimitMax)
+}
+
+func TestParseLimit(t *testing.T) {
+	p, err := NewWithLimits(10, 50)
+	require.NoError(t, err)
+
+	ws := &restful.WebService{}
+	ws.Route(ws.GET("/items").Filter(p.LimitFilter).To(func(req *restful.Request, resp *restful.Response) {
+		_, limit := p.Parse(req)
+		resp.Write([]byte(strconv.Itoa(limit)))
+	}))
+	container := restful.NewContainer()
+	container.Add(ws)
+
+	get := func(query string) (*httptest.ResponseRecorder, string) {
+		req, err := http.NewRequest("GET", "/items"+query, nil)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		container.ServeHTTP(w, req)
+		return w, w.Body.String()
+	}
+
+	w, body := get("")
+	require.Equal(t, "10", body)
+	require.Empty(t, w.Header().Get(LimitHeader))
+
+	w, body = get("?limit=30")
+	require.Equal(t, "30", body)
+	require.Empty(t, w.Header().Get(LimitHeader))
+
+	w, body = get("?limit=100000")
+	require.Equal(t, "50", body)
+	require.Equal(t, "50", w.Header().Get(LimitHeader))
+
+	// zero limit isn't unlimited
+	_, body = get("?limit=0")
+	require.Equal(t, "10", body)
+	_, body = get("?limit=-5")
+	require.Equal(t, "10", body)
+	require.Equal(t, 10, p.Clamp(0))
+}
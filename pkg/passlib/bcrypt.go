@@ -37,3 +37,12 @@ func (a *BcryptAlgo) Verify(password, hash string) (bool, error) {
 	}
 	return verified, err
 }
+
+// NeedsUpdate returns true if the hash is made with lower cost
+func (a *BcryptAlgo) NeedsUpdate(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false
+	}
+	return cost < a.cost
+}
@@ -10,6 +10,8 @@ package passlib
 import (
 	"fmt"
 	"strings"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
@@ -24,16 +26,56 @@ type Algo interface {
 	//	Compatible(hash string) bool // is hash compatible with this algo?
 }
 
+// Updater is implemented by algorithms which could find hashes made with weaker parameters
+type Updater interface {
+	NeedsUpdate(hash string) bool
+}
+
+// Policy describes how new passwords are hashed
+type Policy struct {
+	Scheme string `json:"scheme" description:"hashing algorithm for new passwords"`
+	Cost   int    `json:"cost" description:"work factor of the algorithm"`
+}
+
+var DefaultPolicy = Policy{
+	Scheme: bcryptName,
+	Cost:   bcrypt.DefaultCost,
+}
+
 type Context struct {
 	Default Algo
+	policy  Policy
 }
 
 func NewContext() *Context {
 	return &Context{
 		Default: NewBcrypt(0),
+		policy:  DefaultPolicy,
+	}
+}
+
+// New creates context with the policy, returns error if the policy is invalid
+func New(p Policy) (*Context, error) {
+	switch p.Scheme {
+	case bcryptName:
+		if p.Cost == 0 {
+			p.Cost = bcrypt.DefaultCost
+		}
+		if p.Cost < bcrypt.MinCost || p.Cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("Bcrypt cost should be in range [%d, %d], but got %d",
+				bcrypt.MinCost, bcrypt.MaxCost, p.Cost)
+		}
+		return &Context{Default: NewBcrypt(p.Cost), policy: p}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported hashing scheme: %s", p.Scheme)
 	}
 }
 
+// Policy returns the effective policy for new passwords
+func (c *Context) Policy() Policy {
+	return c.policy
+}
+
 type EncOpts struct {
 }
 
@@ -51,15 +93,40 @@ func (c *Context) Encrypt(password string, _ ...EncOpts) (string, error) {
 
 func (c *Context) Verify(password string, hash string, _ ...VerOpts) (bool, error) {
 	algo := c.Default
+	name, algoHash, err := splitHash(hash)
+	if err != nil {
+		return false, err
+	}
+	if name != algo.Name() {
+		return false, fmt.Errorf("Unsupported algorithm: %s", name)
+	}
+	return c.Default.Verify(password, algoHash)
+}
+
+// NeedsUpdate returns true if the hash should be regenerated with the current policy,
+// because it's made by another algorithm or with weaker parameters.
+func (c *Context) NeedsUpdate(hash string) bool {
+	name, algoHash, err := splitHash(hash)
+	if err != nil {
+		return false
+	}
+	if name != c.Default.Name() {
+		return true
+	}
+	if updater, ok := c.Default.(Updater); ok {
+		return updater.NeedsUpdate(algoHash)
+	}
+	return false
+}
+
+// split hash to the algorithm name and the hash made by the algorithm
+func splitHash(hash string) (string, string, error) {
 	if strings.HasPrefix(hash, Divider) {
 		hash = hash[1:]
 	}
 	parts := strings.SplitN(hash, Divider, 2)
 	if len(parts) < 2 {
-		return false, fmt.Errorf("Bad hash format")
-	}
-	if parts[0] != algo.Name() {
-		return false, fmt.Errorf("Unsupported algorithm: %s", parts[0])
+		return "", "", fmt.Errorf("Bad hash format")
 	}
-	return c.Default.Verify(password, fmt.Sprintf("$%s", parts[1]))
+	return parts[0], fmt.Sprintf("$%s", parts[1]), nil
 }
@@ -1 +1,43 @@
 package passlib
+
+import "testing"
+
+func TestNewPolicy(t *testing.T) {
+	if _, err := New(Policy{Scheme: "md5"}); err == nil {
+		t.Error("New should return error for unsupported scheme")
+	}
+	if _, err := New(Policy{Scheme: bcryptName, Cost: 50}); err == nil {
+		t.Error("New should return error for bcrypt cost out of range")
+	}
+	ctx, err := New(Policy{Scheme: bcryptName})
+	if err != nil {
+		t.Fatalf("New returns error %v", err)
+	}
+	if actual := ctx.Policy(); actual != DefaultPolicy {
+		t.Errorf("Policy should be %v, but actual is %v", DefaultPolicy, actual)
+	}
+}
+
+func TestNeedsUpdate(t *testing.T) {
+	weak, err := New(Policy{Scheme: bcryptName, Cost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	strong, err := New(Policy{Scheme: bcryptName, Cost: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := weak.Encrypt("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if weak.NeedsUpdate(hash) {
+		t.Error("hash made with the current policy shouldn't be updated")
+	}
+	if !strong.NeedsUpdate(hash) {
+		t.Error("hash made with lower cost should be updated")
+	}
+	if ok, err := strong.Verify("password", hash); !ok || err != nil {
+		t.Errorf("hash made with lower cost should be verified, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,182 @@
+// Package proxy routes outbound http requests through the configured proxy.
+//
+// Credentials of authenticated proxies are set in the proxy url, http transports send them
+// in the Proxy-Authorization header, for https requests too. Loopback addresses are always requested directly.
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bearded-web/bearded/pkg/config"
+)
+
+// IsSet returns true if the proxy is configured, otherwise the proxy env is used
+func IsSet(cfg config.Proxy) bool {
+	return cfg.Http != "" || cfg.Https != ""
+}
+
+// Func returns the proxy function of http transports for the config, http.ProxyFromEnvironment if it isn't set
+func Func(cfg config.Proxy) (func(*http.Request) (*url.URL, error), error) {
+	if !IsSet(cfg) {
+		return http.ProxyFromEnvironment, nil
+	}
+	httpUrl, err := parse(cfg.Http)
+	if err != nil {
+		return nil, err
+	}
+	httpsUrl, err := parse(cfg.Https)
+	if err != nil {
+		return nil, err
+	}
+	if httpsUrl == nil {
+		httpsUrl = httpUrl
+	}
+	noProxy := cfg.NoProxy
+	return func(req *http.Request) (*url.URL, error) {
+		proxyUrl := httpUrl
+		if req.URL.Scheme == "https" {
+			proxyUrl = httpsUrl
+		}
+		if proxyUrl == nil || !UseProxy(noProxy, canonicalAddr(req.URL)) {
+			return nil, nil
+		}
+		return proxyUrl, nil
+	}, nil
+}
+
+// Configure sets the proxy of the transport
+func Configure(t *http.Transport, cfg config.Proxy) error {
+	fn, err := Func(cfg)
+	if err != nil {
+		return err
+	}
+	t.Proxy = fn
+	return nil
+}
+
+// ConfigureDefault sets the proxy of http.DefaultTransport which is used by clients of integrations
+func ConfigureDefault(cfg config.Proxy) error {
+	t, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("default transport isn't http.Transport")
+	}
+	return Configure(t, cfg)
+}
+
+// UseProxy returns false if the address (host:port) should be requested directly.
+// No proxy entries are hosts with or without ports, domains which match subdomains too,
+// like corp.com or .corp.com, ips and cidrs, * matches everything.
+func UseProxy(noProxy, addr string) bool {
+	addr = strings.ToLower(addr)
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "localhost" {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip != nil && ip.IsLoopback() {
+		return false
+	}
+	for _, p := range strings.Split(noProxy, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if p == "*" {
+			return false
+		}
+		if _, cidr, err := net.ParseCIDR(p); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return false
+			}
+			continue
+		}
+		match := host
+		if _, _, err := net.SplitHostPort(p); err == nil {
+			match = addr
+		}
+		if match == p || match == strings.TrimPrefix(p, ".") {
+			return false
+		}
+		if strings.HasSuffix(match, "."+strings.TrimPrefix(p, ".")) {
+			return false
+		}
+	}
+	return true
+}
+
+// Env returns proxy env for plugin containers, the proxy env of the process is passed if the config isn't set
+func Env(cfg config.Proxy) []string {
+	values := map[string]string{}
+	if IsSet(cfg) {
+		values["HTTP_PROXY"] = cfg.Http
+		values["HTTPS_PROXY"] = cfg.Https
+		if cfg.Https == "" {
+			values["HTTPS_PROXY"] = cfg.Http
+		}
+		values["NO_PROXY"] = cfg.NoProxy
+	} else {
+		for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"} {
+			values[key] = os.Getenv(key)
+			if values[key] == "" {
+				values[key] = os.Getenv(strings.ToLower(key))
+			}
+		}
+	}
+	env := []string{}
+	// tools read either of cases
+	for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"} {
+		if val := values[key]; val != "" {
+			env = append(env, fmt.Sprintf("%s=%s", key, val), fmt.Sprintf("%s=%s", strings.ToLower(key), val))
+		}
+	}
+	return env
+}
+
+// Redacted returns the proxy url without the password for logs, empty if it's wrong
+func Redacted(raw string) string {
+	u, err := parse(raw)
+	if err != nil || u == nil {
+		return ""
+	}
+	if u.User != nil {
+		u.User = url.User(u.User.Username())
+	}
+	return u.String()
+}
+
+// proxy urls without the scheme are http proxies, like proxy:3128,
+// errors don't contain the url, so credentials aren't logged
+func parse(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || !strings.HasPrefix(u.Scheme, "http") {
+		if u, err = url.Parse("http://" + raw); err != nil {
+			return nil, fmt.Errorf("wrong proxy url")
+		}
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("wrong proxy url: host is empty")
+	}
+	return u, nil
+}
+
+// host with the port of the request url, the default port of the scheme is added if it's missing
+func canonicalAddr(u *url.URL) string {
+	if _, _, err := net.SplitHostPort(u.Host); err == nil {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return u.Host + ":443"
+	}
+	return u.Host + ":80"
+}
@@ -0,0 +1,222 @@
+// Package quota counts api usage of users and enforces quotas over the last 24 hours.
+//
+// Requests are counted in memory and saved to hourly buckets of the usage collection every flush interval,
+// so one request doesn't cost a db write. Requests with api tokens are counted in buckets of the tokens too.
+// Scans are reserved in the db before they are created, they are rare and their quota is strict.
+// Admins aren't limited, but their usage is counted too.
+package quota
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/usage"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+// Kinds of quotas
+const (
+	KindRequests = "requests"
+	KindScans    = "scans"
+)
+
+// Exceeded describes the hit quota
+type Exceeded struct {
+	Kind  string
+	Quota int
+}
+
+func (e *Exceeded) Error() string {
+	return fmt.Sprintf("quota of %d %s in 24 hours is exceeded", e.Quota, e.Kind)
+}
+
+// consumer of requests, the token is empty for requests of sessions
+type consumer struct {
+	user, token bson.ObjectId
+}
+
+type Tracker struct {
+	mgr *manager.Manager
+	cfg config.Quota
+
+	mu sync.Mutex
+	// requests which aren't saved yet by consumers and by users
+	pending map[consumer]int
+	unsaved map[bson.ObjectId]int
+	// saved requests of recently active users in the day window
+	saved map[bson.ObjectId]int
+	now   func() time.Time
+}
+
+func New(mgr *manager.Manager, cfg config.Quota) *Tracker {
+	return &Tracker{
+		mgr:     mgr,
+		cfg:     cfg,
+		pending: map[consumer]int{},
+		unsaved: map[bson.ObjectId]int{},
+		saved:   map[bson.ObjectId]int{},
+		now:     time.Now,
+	}
+}
+
+// Quota of the user, admins aren't limited
+func (t *Tracker) Quota(u *user.User) usage.Quota {
+	if t.mgr.Permission.IsAdmin(u) {
+		return usage.Quota{}
+	}
+	return usage.Quota{Requests: t.cfg.Requests, Scans: t.cfg.Scans}
+}
+
+// Request counts the request of the user with the token, the token is empty for requests of sessions.
+// The request isn't counted and the exceeded quota is returned if the user is over the requests quota,
+// requests with all tokens of the user are limited together. Requests aren't counted if the flush interval isn't set.
+func (t *Tracker) Request(u *user.User, tokenId bson.ObjectId) *Exceeded {
+	if t.cfg.FlushInterval <= 0 {
+		return nil
+	}
+	quota := t.Quota(u).Requests
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if quota > 0 && t.saved[u.Id]+t.unsaved[u.Id] >= quota {
+		return &Exceeded{Kind: KindRequests, Quota: quota}
+	}
+	t.pending[consumer{u.Id, tokenId}]++
+	t.unsaved[u.Id]++
+	return nil
+}
+
+// Pending returns requests of the user which aren't saved yet
+func (t *Tracker) Pending(userId bson.ObjectId) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.unsaved[userId]
+}
+
+// PendingTokens returns requests with tokens of the user which aren't saved yet by tokens
+func (t *Tracker) PendingTokens(userId bson.ObjectId) map[bson.ObjectId]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := map[bson.ObjectId]int{}
+	for c, n := range t.pending {
+		if c.user == userId && c.token != "" {
+			result[c.token] += n
+		}
+	}
+	return result
+}
+
+// ReserveScans counts n scans of the owner before they are created, the exceeded quota is returned
+// and nothing is counted if the owner can't start all of them. The check and the count are done
+// by a single update, so concurrent starts don't exceed the quota.
+func (t *Tracker) ReserveScans(mgr *manager.Manager, owner bson.ObjectId, n int) (*Exceeded, error) {
+	quota := 0
+	if t.cfg.Scans > 0 {
+		u, err := mgr.Users.GetById(owner)
+		if err != nil && !mgr.IsNotFound(err) {
+			return nil, err
+		}
+		if u != nil {
+			quota = t.Quota(u).Scans
+		}
+	}
+	added, err := mgr.Usage.AddScans(owner, t.now(), n, quota)
+	if err != nil {
+		return nil, err
+	}
+	if !added {
+		return &Exceeded{Kind: KindScans, Quota: quota}, nil
+	}
+	return nil, nil
+}
+
+// ReleaseScans uncounts reserved scans of the owner which aren't created
+func (t *Tracker) ReleaseScans(mgr *manager.Manager, owner bson.ObjectId, n int) error {
+	return mgr.Usage.Add(owner, "", t.now(), 0, -n)
+}
+
+// Flush saves pending requests and reloads saved requests of active users,
+// requests which aren't saved are kept for the next flush
+func (t *Tracker) Flush() error {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = map[consumer]int{}
+	unsaved := t.unsaved
+	t.unsaved = map[bson.ObjectId]int{}
+	users := make([]bson.ObjectId, 0, len(unsaved)+len(t.saved))
+	for id := range unsaved {
+		users = append(users, id)
+	}
+	for id := range t.saved {
+		if _, ok := unsaved[id]; !ok {
+			users = append(users, id)
+		}
+	}
+	t.mu.Unlock()
+	if len(users) == 0 {
+		return nil
+	}
+
+	mgr := t.mgr.Copy()
+	defer mgr.Close()
+	now := t.now()
+	for c, n := range pending {
+		if err := mgr.Usage.Add(c.user, c.token, now, n, 0); err != nil {
+			t.restore(pending)
+			return err
+		}
+		delete(pending, c)
+	}
+	counts, err := mgr.Usage.CountUsers(users, usage.WindowDay.Since(now))
+	if err != nil {
+		return err
+	}
+	saved := map[bson.ObjectId]int{}
+	for id, c := range counts {
+		// users without requests in the window are forgotten
+		if c.Requests > 0 {
+			saved[id] = c.Requests
+		}
+	}
+	t.mu.Lock()
+	t.saved = saved
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *Tracker) restore(pending map[consumer]int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for c, n := range pending {
+		t.pending[c] += n
+		t.unsaved[c.user] += n
+	}
+}
+
+// Run flushes requests every flush interval, the last flush is done when the context is done
+func (t *Tracker) Run(ctx context.Context) {
+	if t.cfg.FlushInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(t.cfg.FlushInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := t.Flush(); err != nil {
+				logrus.Errorf("Usage flush error: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := t.Flush(); err != nil {
+				logrus.Errorf("Usage flush error: %v", err)
+			}
+		}
+	}
+}
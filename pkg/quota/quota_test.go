@@ -0,0 +1,123 @@
+package quota
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/usage"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/tests"
+)
+
+func TestRequest(t *testing.T) {
+	mgr := manager.New(&mgo.Database{Name: "test"})
+	mgr.Permission.SetAdmins([]string{"admin@example.com"})
+	tr := New(mgr, config.Quota{Requests: 3, Scans: 1, FlushInterval: 10})
+
+	u := &user.User{Id: bson.NewObjectId(), Email: "user@example.com"}
+	admin := &user.User{Id: bson.NewObjectId(), Email: "admin@example.com"}
+	require.Equal(t, usage.Quota{Requests: 3, Scans: 1}, tr.Quota(u))
+	require.Equal(t, usage.Quota{}, tr.Quota(admin))
+
+	// saved requests of the window are counted too
+	tr.saved[u.Id] = 1
+	require.Nil(t, tr.Request(u, ""))
+	require.Nil(t, tr.Request(u, ""))
+	ex := tr.Request(u, "")
+	require.NotNil(t, ex)
+	require.Equal(t, KindRequests, ex.Kind)
+	require.Equal(t, "quota of 3 requests in 24 hours is exceeded", ex.Error())
+	// rejected requests aren't counted
+	require.Equal(t, 2, tr.Pending(u.Id))
+
+	// requests with tokens are limited together with requests of the user
+	tkn := bson.NewObjectId()
+	require.NotNil(t, tr.Request(u, tkn))
+	tr.saved[u.Id] = 0
+	require.Nil(t, tr.Request(u, tkn))
+	require.Equal(t, 3, tr.Pending(u.Id))
+	require.Equal(t, map[bson.ObjectId]int{tkn: 1}, tr.PendingTokens(u.Id))
+
+	for i := 0; i < 5; i++ {
+		require.Nil(t, tr.Request(admin, ""))
+	}
+	require.Equal(t, 5, tr.Pending(admin.Id))
+
+	// requests aren't counted without the flush interval
+	tr = New(mgr, config.Quota{Requests: 1})
+	require.Nil(t, tr.Request(u, ""))
+	require.Nil(t, tr.Request(u, ""))
+	require.Equal(t, 0, tr.Pending(u.Id))
+}
+
+func TestReserveScans(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := manager.New(mongo.DB(dbName))
+	require.NoError(t, mgr.Init())
+	tr := New(mgr, config.Quota{Requests: 100, Scans: 5, FlushInterval: 10})
+
+	u, err := mgr.Users.Create(&user.User{Email: "user@example.com"})
+	require.NoError(t, err)
+	// scans of earlier hours are counted in the window
+	require.NoError(t, mgr.Usage.Add(u.Id, "", time.Now().Add(-time.Hour), 0, 1))
+
+	ex, err := tr.ReserveScans(mgr, u.Id, 5)
+	require.NoError(t, err)
+	require.NotNil(t, ex)
+	require.Equal(t, KindScans, ex.Kind)
+
+	// concurrent reservations don't exceed the quota
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ex, err := tr.ReserveScans(mgr, u.Id, 1)
+			require.NoError(t, err)
+			if ex == nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	require.True(t, reserved <= 4, "reserved %d", reserved)
+	counts, err := mgr.Usage.Count(u.Id, usage.WindowDay.Since(time.Now()))
+	require.NoError(t, err)
+	require.Equal(t, 1+reserved, counts.Scans)
+
+	require.NoError(t, tr.ReleaseScans(mgr, u.Id, reserved))
+	ex, err = tr.ReserveScans(mgr, u.Id, 4)
+	require.NoError(t, err)
+	require.Nil(t, ex)
+
+	// requests are saved by tokens and summed for the user
+	tkn := bson.NewObjectId()
+	require.Nil(t, tr.Request(u, ""))
+	require.Nil(t, tr.Request(u, tkn))
+	require.Nil(t, tr.Request(u, tkn))
+	require.NoError(t, tr.Flush())
+	counts, err = mgr.Usage.Count(u.Id, usage.WindowDay.Since(time.Now()))
+	require.NoError(t, err)
+	require.Equal(t, 3, counts.Requests)
+	require.Equal(t, 5, counts.Scans)
+	tokens, err := mgr.Usage.CountTokens(u.Id, usage.WindowDay.Since(time.Now()))
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	require.Equal(t, tkn, tokens[0].Token)
+	require.Equal(t, 2, tokens[0].Requests)
+}
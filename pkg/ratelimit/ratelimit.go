@@ -0,0 +1,192 @@
+package ratelimit
+
+// Requests are counted in fixed windows by the client ip, the api token and the project,
+// so heavy automation on one project doesn't slow down others. Only ip is counted before authentication,
+// tokens and projects are counted for authenticated users, so anonymous clients can't spend limits of others. Counters are kept in the shared store,
+// so dispatchers behind a balancer share limits.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/token"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/store"
+	"github.com/bearded-web/bearded/services"
+)
+
+// Scopes of limits
+const (
+	ScopeIp      = "ip"
+	ScopeToken   = "token"
+	ScopeProject = "project"
+)
+
+const (
+	LimitHeader      = "X-RateLimit-Limit"
+	ScopeHeader      = "X-RateLimit-Scope"
+	RetryAfterHeader = "Retry-After"
+)
+
+const projectsPath = "/api/v1/projects/"
+
+// Exceeded describes the hit limit
+type Exceeded struct {
+	Scope string
+	Limit int
+	// when the window is over
+	Reset time.Time
+}
+
+type Limiter struct {
+	store  store.Store
+	mgr    *manager.Manager
+	cfg    config.RateLimit
+	window time.Duration
+	// limits of specific projects by hex id
+	projects map[string]int
+	now      func() time.Time
+	// checks access of users to projects of requests
+	member func(u *user.User, project bson.ObjectId) bool
+}
+
+// New creates limiter, the manager is used to check access of users to projects
+func New(st store.Store, mgr *manager.Manager, cfg config.RateLimit) (*Limiter, error) {
+	if cfg.Window <= 0 {
+		return nil, fmt.Errorf("window should be positive")
+	}
+	projects := map[string]int{}
+	for _, pl := range cfg.Projects {
+		if !bson.IsObjectIdHex(pl.Project) {
+			return nil, fmt.Errorf("project %q should be an id in hex form", pl.Project)
+		}
+		projects[pl.Project] = pl.Limit
+	}
+	l := &Limiter{
+		store:    st,
+		mgr:      mgr,
+		cfg:      cfg,
+		window:   time.Duration(cfg.Window) * time.Second,
+		projects: projects,
+		now:      time.Now,
+	}
+	l.member = l.isMember
+	return l, nil
+}
+
+// Enabled returns true if any limit is set
+func (l *Limiter) Enabled() bool {
+	return l.cfg.Ip > 0 || l.cfg.Token > 0 || l.cfg.Project > 0 || len(l.projects) > 0
+}
+
+// Hit counts the request for the scope and returns the exceeded limit, zero limit is never exceeded.
+// Requests aren't limited if the store is broken.
+func (l *Limiter) Hit(scope, id string, limit int) *Exceeded {
+	if limit <= 0 || id == "" {
+		return nil
+	}
+	now := l.now().UTC()
+	start := now.Truncate(l.window)
+	key := fmt.Sprintf("ratelimit:%s:%s:%d", scope, id, start.Unix())
+	count, err := l.store.Incr(key, l.window)
+	if err != nil {
+		logrus.Errorf("Rate limit counter %s: %v", key, err)
+		return nil
+	}
+	if int(count) <= limit {
+		return nil
+	}
+	return &Exceeded{Scope: scope, Limit: limit, Reset: start.Add(l.window)}
+}
+
+// ProjectLimit returns the limit of the project, specific limits are preferred to the common one
+func (l *Limiter) ProjectLimit(project string) int {
+	if limit, ok := l.projects[project]; ok {
+		return limit
+	}
+	return l.cfg.Project
+}
+
+// Filter checks the limit of the client ip. It's a container filter, so requests are counted before authentication.
+func (l *Limiter) Filter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	if ex := l.Hit(ScopeIp, filters.ClientIp(req.Request), l.cfg.Ip); ex != nil {
+		l.reject(resp, ex)
+		return
+	}
+	chain.ProcessFilter(req, resp)
+}
+
+// Check checks limits of the api token and the project of the authenticated request, in this order.
+// The project is taken from the project token, /projects/{project-id} path or the project query parameter,
+// projects of paths and queries are counted only if the user has access to them.
+func (l *Limiter) Check(req *restful.Request, resp *restful.Response, u *user.User) bool {
+	tkn := filters.GetToken(req)
+	if tkn != nil {
+		if ex := l.Hit(ScopeToken, tkn.Id.Hex(), l.cfg.Token); ex != nil {
+			l.reject(resp, ex)
+			return false
+		}
+	}
+	if l.cfg.Project > 0 || len(l.projects) > 0 {
+		if project := l.project(req, u, tkn); project != "" {
+			if ex := l.Hit(ScopeProject, project.Hex(), l.ProjectLimit(project.Hex())); ex != nil {
+				l.reject(resp, ex)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (l *Limiter) project(req *restful.Request, u *user.User, tkn *token.Token) bson.ObjectId {
+	if tkn != nil && tkn.Project != "" {
+		return tkn.Project
+	}
+	id := ""
+	if path := req.Request.URL.Path; strings.HasPrefix(path, projectsPath) {
+		id = strings.SplitN(strings.TrimPrefix(path, projectsPath), "/", 2)[0]
+	}
+	if !bson.IsObjectIdHex(id) {
+		id = req.Request.URL.Query().Get("project")
+	}
+	if !bson.IsObjectIdHex(id) || !l.member(u, bson.ObjectIdHex(id)) {
+		return ""
+	}
+	return bson.ObjectIdHex(id)
+}
+
+// isMember returns true if the user is the owner or a member of the project
+func (l *Limiter) isMember(u *user.User, project bson.ObjectId) bool {
+	if u.IsService() {
+		return u.Project == project
+	}
+	mgr := l.mgr.Copy()
+	defer mgr.Close()
+	query := bson.M{"$and": []bson.M{mgr.Projects.AccessQuery(u), {"_id": project}}}
+	_, count, err := mgr.Projects.FilterByQuery(query, manager.Opts{Limit: 1})
+	if err != nil {
+		logrus.Errorf("Rate limit project %s: %v", project.Hex(), err)
+		return false
+	}
+	return count > 0
+}
+
+func (l *Limiter) reject(resp *restful.Response, ex *Exceeded) {
+	retry := int(ex.Reset.Sub(l.now()).Seconds()) + 1
+	resp.AddHeader(LimitHeader, strconv.Itoa(ex.Limit))
+	resp.AddHeader(ScopeHeader, ex.Scope)
+	resp.AddHeader(RetryAfterHeader, strconv.Itoa(retry))
+	// routes aren't selected yet in the ip filter, so the entity is written as json explicitly
+	resp.WriteHeader(services.StatusTooManyRequests)
+	resp.WriteAsJson(services.NewError(services.CodeRateLimited,
+		fmt.Sprintf("%s rate limit is exceeded, %d requests per %s", ex.Scope, ex.Limit, l.window)))
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/token"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/store"
+)
+
+func TestHit(t *testing.T) {
+	l, err := New(store.NewMemory(), nil, config.RateLimit{Window: 60})
+	require.NoError(t, err)
+	now := time.Date(2015, 6, 1, 10, 0, 30, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	require.Nil(t, l.Hit(ScopeIp, "127.0.0.1", 2))
+	require.Nil(t, l.Hit(ScopeIp, "127.0.0.1", 2))
+	ex := l.Hit(ScopeIp, "127.0.0.1", 2)
+	require.NotNil(t, ex)
+	require.Equal(t, ScopeIp, ex.Scope)
+	require.Equal(t, time.Date(2015, 6, 1, 10, 1, 0, 0, time.UTC), ex.Reset)
+	// another ip and zero limits
+	require.Nil(t, l.Hit(ScopeIp, "127.0.0.2", 2))
+	require.Nil(t, l.Hit(ScopeToken, "token", 0))
+
+	// the next window
+	now = now.Add(time.Minute)
+	require.Nil(t, l.Hit(ScopeIp, "127.0.0.1", 2))
+}
+
+func TestFilter(t *testing.T) {
+	l, err := New(store.NewMemory(), nil, config.RateLimit{Window: 60, Ip: 1, Token: 1})
+	require.NoError(t, err)
+
+	container := restful.NewContainer()
+	container.Filter(l.Filter)
+	ws := &restful.WebService{}
+	ws.Route(ws.GET("/scans").To(func(req *restful.Request, resp *restful.Response) {}))
+	container.Add(ws)
+
+	get := func(ip string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/scans", nil)
+		req.RemoteAddr = ip + ":1234"
+		// tokens aren't counted before authentication
+		req.Header.Set("Authorization", "Bearer unknown")
+		rec := httptest.NewRecorder()
+		container.ServeHTTP(rec, req)
+		return rec
+	}
+	require.Equal(t, http.StatusOK, get("127.0.0.1").Code)
+	rec := get("127.0.0.1")
+	require.Equal(t, 429, rec.Code)
+	require.Equal(t, ScopeIp, rec.Header().Get(ScopeHeader))
+	require.Contains(t, rec.Body.String(), "RATE_LIMITED")
+	require.Equal(t, http.StatusOK, get("127.0.0.2").Code)
+}
+
+func TestCheck(t *testing.T) {
+	project, other, foreign := bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()
+	l, err := New(store.NewMemory(), nil, config.RateLimit{
+		Window:   60,
+		Token:    3,
+		Project:  1,
+		Projects: []config.ProjectRateLimit{{Project: other.Hex(), Limit: 2}},
+	})
+	require.NoError(t, err)
+	require.True(t, l.Enabled())
+	l.member = func(u *user.User, p bson.ObjectId) bool {
+		return p == project || p == other
+	}
+
+	u := &user.User{Id: bson.NewObjectId()}
+	tkn := &token.Token{Id: bson.NewObjectId(), User: u.Id}
+	container := restful.NewContainer()
+	ws := &restful.WebService{}
+	ws.Path("/api/v1")
+	// the user is authenticated by the token if the test header is set
+	ws.Filter(func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		if req.Request.Header.Get("X-Token") != "" {
+			req.SetAttribute(filters.AttrTokenKey, tkn)
+		}
+		if l.Check(req, resp, u) {
+			chain.ProcessFilter(req, resp)
+		}
+	})
+	ws.Route(ws.GET("/projects/{project-id}").To(func(req *restful.Request, resp *restful.Response) {}))
+	ws.Route(ws.GET("/scans").To(func(req *restful.Request, resp *restful.Response) {}))
+	container.Add(ws)
+
+	get := func(url string, withToken bool) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", url, nil)
+		if withToken {
+			req.Header.Set("X-Token", "1")
+		}
+		rec := httptest.NewRecorder()
+		container.ServeHTTP(rec, req)
+		return rec
+	}
+	require.Equal(t, http.StatusOK, get("/api/v1/projects/"+project.Hex(), false).Code)
+	rec := get("/api/v1/scans?project="+project.Hex(), false)
+	require.Equal(t, 429, rec.Code)
+	require.Equal(t, ScopeProject, rec.Header().Get(ScopeHeader))
+	require.Equal(t, "1", rec.Header().Get(LimitHeader))
+	require.Contains(t, rec.Body.String(), "RATE_LIMITED")
+
+	require.Equal(t, http.StatusOK, get("/api/v1/scans?project="+other.Hex(), false).Code)
+	require.Equal(t, http.StatusOK, get("/api/v1/scans?project="+other.Hex(), false).Code)
+	require.Equal(t, 429, get("/api/v1/scans?project="+other.Hex(), false).Code)
+	// requests without project and to projects of others aren't limited by projects
+	require.Equal(t, http.StatusOK, get("/api/v1/scans", false).Code)
+	require.Equal(t, http.StatusOK, get("/api/v1/scans?project="+foreign.Hex(), false).Code)
+	require.Equal(t, http.StatusOK, get("/api/v1/scans?project="+foreign.Hex(), false).Code)
+
+	// token requests are counted by the token
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusOK, get("/api/v1/scans", true).Code)
+	}
+	rec = get("/api/v1/scans", true)
+	require.Equal(t, 429, rec.Code)
+	require.Equal(t, ScopeToken, rec.Header().Get(ScopeHeader))
+
+	// the project of the project token is counted regardless of the path
+	l2, err := New(store.NewMemory(), nil, config.RateLimit{Window: 60, Project: 1})
+	require.NoError(t, err)
+	l2.member = func(*user.User, bson.ObjectId) bool { return false }
+	tkn.Project = foreign
+	l = l2
+	require.Equal(t, http.StatusOK, get("/api/v1/scans", true).Code)
+	require.Equal(t, 429, get("/api/v1/scans", true).Code)
+
+	_, err = New(store.NewMemory(), nil, config.RateLimit{Window: 60, Projects: []config.ProjectRateLimit{{Project: "web"}}})
+	require.Error(t, err)
+}
@@ -0,0 +1,257 @@
+package redis
+
+// Minimal redis client, it supports only commands which are needed by the store:
+// plain strings, integers and errors, requests are made over a small pool of connections.
+// Read more about the protocol http://redis.io/topics/protocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultTimeout  = time.Second
+	DefaultPoolSize = 10
+)
+
+// returned when the key doesn't exist
+var ErrNil = errors.New("redis: nil reply")
+
+// Error is returned by redis server, the connection stays usable
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+type Opts struct {
+	Addr     string
+	Password string
+	Database int
+	Timeout  time.Duration
+	PoolSize int
+}
+
+type Client struct {
+	opts Opts
+	idle chan *conn
+}
+
+type conn struct {
+	net.Conn
+	rd *bufio.Reader
+}
+
+// New creates client, connections are established on demand
+func New(opts Opts) *Client {
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.PoolSize == 0 {
+		opts.PoolSize = DefaultPoolSize
+	}
+	return &Client{
+		opts: opts,
+		idle: make(chan *conn, opts.PoolSize),
+	}
+}
+
+// Do sends the command and returns the reply: string, []byte, int64, []interface{} or nil
+func (c *Client) Do(args ...string) (interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.do(c.opts.Timeout, args...)
+	if _, ok := err.(Error); err != nil && !ok {
+		// the connection state is unknown after network errors
+		cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+func (c *Client) Ping() error {
+	_, err := c.Do("PING")
+	return err
+}
+
+func (c *Client) Get(key string) ([]byte, error) {
+	reply, err := c.Do("GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrNil
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %T", reply)
+	}
+	return data, nil
+}
+
+// Set the value, zero ttl means the key doesn't expire
+func (c *Client) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	}
+	_, err := c.Do(args...)
+	return err
+}
+
+// Set the value only if the key doesn't exist, returns false if it exists
+func (c *Client) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	args := []string{"SET", key, string(value), "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	}
+	reply, err := c.Do(args...)
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+// the counter and its expiration are set by one script, so the counter never stays without ttl
+const incrScript = `local n = redis.call("INCR", KEYS[1])
+if n == 1 and tonumber(ARGV[1]) > 0 then redis.call("PEXPIRE", KEYS[1], ARGV[1]) end
+return n`
+
+// Incr increments the counter, ttl is set when the counter is created
+func (c *Client) Incr(key string, ttl time.Duration) (int64, error) {
+	reply, err := c.Do("EVAL", incrScript, "1", key, strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	if err != nil {
+		return 0, err
+	}
+	value, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected reply %T", reply)
+	}
+	return value, nil
+}
+
+func (c *Client) Del(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := c.Do(append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// Close idle connections
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *Client) get() (*conn, error) {
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+	nc, err := net.DialTimeout("tcp", c.opts.Addr, c.opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, rd: bufio.NewReader(nc)}
+	if c.opts.Password != "" {
+		if _, err := cn.do(c.opts.Timeout, "AUTH", c.opts.Password); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	if c.opts.Database != 0 {
+		if _, err := cn.do(c.opts.Timeout, "SELECT", strconv.Itoa(c.opts.Database)); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+func (c *Client) put(cn *conn) {
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+func (cn *conn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	cn.SetDeadline(time.Now().Add(timeout))
+	buf := []byte(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, arg := range args {
+		buf = append(buf, fmt.Sprintf("$%d\r\n", len(arg))...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := cn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(cn.rd)
+}
+
+func readReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: wrong reply line %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, Error(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		size, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		result := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			item, err := readReply(rd)
+			if _, ok := err.(Error); err != nil && !ok {
+				return nil, err
+			}
+			result = append(result, item)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
@@ -0,0 +1,133 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fake server supports only a few commands without expiration, EVAL runs only the counter script
+func fakeServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	data := map[string]string{}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			rd := bufio.NewReader(c)
+			for {
+				args, err := readCommand(rd)
+				if err != nil {
+					c.Close()
+					break
+				}
+				switch strings.ToUpper(args[0]) {
+				case "PING":
+					io.WriteString(c, "+PONG\r\n")
+				case "SET":
+					if _, ok := data[args[1]]; ok && len(args) > 3 && strings.ToUpper(args[3]) == "NX" {
+						io.WriteString(c, "$-1\r\n")
+						continue
+					}
+					data[args[1]] = args[2]
+					io.WriteString(c, "+OK\r\n")
+				case "GET":
+					if v, ok := data[args[1]]; ok {
+						fmt.Fprintf(c, "$%d\r\n%s\r\n", len(v), v)
+					} else {
+						io.WriteString(c, "$-1\r\n")
+					}
+				case "EVAL":
+					if args[1] != incrScript || args[2] != "1" || len(args) != 5 {
+						io.WriteString(c, "-ERR unknown script\r\n")
+						continue
+					}
+					v, _ := strconv.Atoi(data[args[3]])
+					data[args[3]] = strconv.Itoa(v + 1)
+					fmt.Fprintf(c, ":%d\r\n", v+1)
+				case "DEL":
+					for _, key := range args[1:] {
+						delete(data, key)
+					}
+					io.WriteString(c, ":1\r\n")
+				case "PEXPIRE":
+					io.WriteString(c, ":1\r\n")
+				default:
+					io.WriteString(c, "-ERR unknown command\r\n")
+				}
+			}
+		}
+	}()
+	return l
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	reply, err := readReply(rd)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{}
+	for _, arg := range reply.([]interface{}) {
+		args = append(args, string(arg.([]byte)))
+	}
+	return args, nil
+}
+
+func TestClient(t *testing.T) {
+	l := fakeServer(t)
+	defer l.Close()
+
+	c := New(Opts{Addr: l.Addr().String()})
+	defer c.Close()
+
+	require.NoError(t, c.Ping())
+
+	_, err := c.Get("key")
+	require.Equal(t, ErrNil, err)
+
+	require.NoError(t, c.Set("key", []byte("multi\r\nline"), time.Second))
+	value, err := c.Get("key")
+	require.NoError(t, err)
+	require.Equal(t, "multi\r\nline", string(value))
+
+	for i := 1; i <= 3; i++ {
+		n, err := c.Incr("counter", time.Second)
+		require.NoError(t, err)
+		require.Equal(t, int64(i), n)
+	}
+	require.NoError(t, c.Del("key", "counter"))
+
+	ok, err := c.SetNX("lock", []byte("first"), time.Second)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = c.SetNX("lock", []byte("second"), time.Second)
+	require.NoError(t, err)
+	require.False(t, ok)
+	value, err = c.Get("lock")
+	require.NoError(t, err)
+	require.Equal(t, "first", string(value))
+
+	_, err = c.Do("UNKNOWN")
+	require.IsType(t, Error(""), err)
+	// the connection is still usable after redis errors
+	require.NoError(t, c.Ping())
+}
+
+func TestClientUnreachable(t *testing.T) {
+	l := fakeServer(t)
+	addr := l.Addr().String()
+	l.Close()
+
+	c := New(Opts{Addr: addr, Timeout: time.Millisecond * 100})
+	require.Error(t, c.Ping())
+}
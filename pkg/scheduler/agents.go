@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/agent"
+	"github.com/bearded-web/bearded/models/incident"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/alert"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+// AgentCleaner marks agents which are offline as stale and retires them after a while.
+// Retired agents are kept, so scans still show which agent ran them.
+type AgentCleaner struct {
+	mgr   *manager.Manager
+	sched Scheduler
+
+	// zero durations disable marking and retiring
+	StaleAfter  time.Duration
+	RetireAfter time.Duration
+
+	// stale and retired agents are reported as incidents
+	Incidents *alert.Reporter
+}
+
+func NewAgentCleaner(mgr *manager.Manager, sched Scheduler, staleAfter, retireAfter time.Duration) *AgentCleaner {
+	return &AgentCleaner{
+		mgr:         mgr,
+		sched:       sched,
+		StaleAfter:  staleAfter,
+		RetireAfter: retireAfter,
+	}
+}
+
+// Run cleans agents every interval until the context is done
+func (c *AgentCleaner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Clean(); err != nil {
+				log.Errorf("Agent cleanup error: %v", err)
+				c.Incidents.Report(&incident.Incident{
+					Type:    incident.TypeSchedulerError,
+					Error:   err.Error(),
+					Message: "Offline agents aren't cleaned up",
+				})
+			}
+		}
+	}
+}
+
+func (c *AgentCleaner) Clean() error {
+	now := time.Now().UTC()
+	if c.StaleAfter > 0 {
+		marked, err := c.mgr.Agents.MarkStale(now.Add(-c.StaleAfter))
+		if err != nil {
+			return err
+		}
+		if len(marked) > 0 {
+			log.Infof("%d agents are stale", len(marked))
+		}
+		for _, ag := range marked {
+			c.Incidents.Report(&incident.Incident{
+				Type:    incident.TypeAgentOffline,
+				Agent:   ag.Id,
+				Message: fmt.Sprintf("Agent %s is offline since %s", ag, ag.LastSeen),
+			})
+		}
+	}
+	if c.RetireAfter > 0 {
+		agents, err := c.mgr.Agents.GetOffline(now.Add(-c.RetireAfter))
+		if err != nil {
+			return err
+		}
+		for _, ag := range agents {
+			released, err := Retire(c.mgr, c.sched, ag)
+			if err != nil {
+				return err
+			}
+			log.Infof("Agent %s is retired after being offline since %s, %d sessions are released",
+				ag, ag.LastSeen, released)
+			c.Incidents.Report(&incident.Incident{
+				Type:  incident.TypeAgentRetired,
+				Agent: ag.Id,
+				Message: fmt.Sprintf("Agent %s is retired after being offline since %s, %d sessions are returned to the queue",
+					ag, ag.LastSeen, released),
+			})
+		}
+	}
+	return nil
+}
+
+// Retire the agent and return sessions which it took to the queue, returns number of released sessions
+func Retire(mgr *manager.Manager, sched Scheduler, ag *agent.Agent) (int, error) {
+	ag.Status = agent.StatusRetired
+	ag.Stale = false
+	ag.Retired = time.Now().UTC()
+	if err := mgr.Agents.Update(ag); err != nil {
+		return 0, err
+	}
+	return releaseSessions(mgr, sched, ag.Id)
+}
+
+// Queued and working sessions of the agent become created, so other agents could take them
+func releaseSessions(mgr *manager.Manager, sched Scheduler, agentId bson.ObjectId) (int, error) {
+	active := []scan.ScanStatus{scan.StatusQueued, scan.StatusWorking}
+	scans, _, err := mgr.Scans.FilterByQuery(bson.M{"status": bson.M{"$in": active}})
+	if err != nil {
+		return 0, err
+	}
+	released := 0
+	for _, sc := range scans {
+		for _, sess := range sc.GetAllSessions() {
+			if sess.Agent != agentId || (sess.Status != scan.StatusQueued && sess.Status != scan.StatusWorking) {
+				continue
+			}
+			sess.Status = scan.StatusCreated
+			sess.Queued = nil
+			sess.Started = nil
+			if err := mgr.Scans.UpdateSession(sc, sess); err != nil {
+				if mgr.IsNotFound(err) {
+					continue
+				}
+				return released, err
+			}
+			released++
+			if err := sched.UpdateScan(sc); err != nil {
+				return released, err
+			}
+		}
+	}
+	return released, nil
+}
+
+// Release returns the session which is taken but isn't sent to the agent, so it's taken again
+func Release(mgr *manager.Manager, sched Scheduler, sess *scan.Session) error {
+	sc, err := mgr.Scans.GetById(sess.Scan)
+	if err != nil {
+		return err
+	}
+	obj := sc.GetSession(sess.Id)
+	if obj == nil || obj.Status != scan.StatusQueued {
+		return nil
+	}
+	obj.Status = scan.StatusCreated
+	obj.Queued = nil
+	obj.Agent = ""
+	if err := mgr.Scans.UpdateSession(sc, obj); err != nil {
+		return err
+	}
+	return sched.UpdateScan(sc)
+}
@@ -0,0 +1,177 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/agent"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/alert"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+// CheckDispatch tells the owner of the unattended scan if no agent can take it.
+// Nothing is checked if the notifier is nil.
+func CheckDispatch(mgr *manager.Manager, n *alert.ScanNotifier, sc *scan.Scan) {
+	if n == nil || !sc.Unattended() {
+		return
+	}
+	d, err := Diagnose(mgr, sc, false)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if d.Reason != "" {
+		n.Failed(sc, "the scan isn't dispatched, "+d.Reason)
+	}
+}
+
+// Diagnose explains why the scan isn't dispatched, agents are returned only with details
+func Diagnose(mgr *manager.Manager, sc *scan.Scan, details bool) (*agent.Dispatch, error) {
+	agents, _, err := mgr.Agents.All()
+	if err != nil {
+		return nil, err
+	}
+	caps, err := requiredCapabilities(mgr, sc)
+	if err != nil {
+		return nil, err
+	}
+	var working map[bson.ObjectId]int
+	if details {
+		if working, err = workingSessions(mgr); err != nil {
+			return nil, err
+		}
+	}
+	d := diagnose(sc, agents, caps, working, time.Now().UTC())
+	if !details {
+		d.Agents = nil
+	}
+	return d, nil
+}
+
+func diagnose(sc *scan.Scan, agents []*agent.Agent, caps []string, working map[bson.ObjectId]int, now time.Time) *agent.Dispatch {
+	d := &agent.Dispatch{
+		Scan:         sc.Id,
+		Status:       sc.Status,
+		Capabilities: caps,
+		Agents:       []*agent.Candidate{},
+	}
+	available := 0
+	// counts of rejections in order of appearance for the reason
+	rejections := []string{}
+	counts := map[string]int{}
+	for _, ag := range agents {
+		c := &agent.Candidate{
+			Id:           ag.Id,
+			Name:         ag.Name,
+			Status:       ag.Status,
+			LastSeen:     ag.LastSeen,
+			Capabilities: ag.Capabilities,
+			Working:      working[ag.Id],
+		}
+		c.Rejected = rejectReasons(ag, caps, now)
+		if len(c.Rejected) == 0 {
+			available++
+		} else {
+			// the first reason is the main one, blocked agents are offline too for example
+			reason := c.Rejected[0]
+			if counts[reason] == 0 {
+				rejections = append(rejections, reason)
+			}
+			counts[reason]++
+		}
+		d.Agents = append(d.Agents, c)
+	}
+
+	switch {
+	case sc.Status != scan.StatusCreated && sc.Status != scan.StatusQueued && sc.Status != scan.StatusPaused:
+	case sc.Status == scan.StatusPaused:
+		d.Reason = "the scan is paused"
+	case sc.Waiting:
+		d.Reason = "the scan waits until other scans of the group are done"
+	case sc.WaitWindow:
+		d.Reason = "the scan waits for the scan window of the target"
+	case len(agents) == 0:
+		d.Reason = "no agents are registered"
+	case available == 0:
+		parts := []string{}
+		for _, reason := range rejections {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[reason], reason))
+		}
+		d.Reason = "no agent can take the scan: " + strings.Join(parts, ", ")
+	}
+	return d
+}
+
+func rejectReasons(ag *agent.Agent, caps []string, now time.Time) []string {
+	reasons := []string{}
+	switch ag.Status {
+	case agent.StatusBlocked:
+		reasons = append(reasons, agent.RejectBlocked)
+	case agent.StatusRetired:
+		reasons = append(reasons, agent.RejectRetired)
+	}
+	if ag.Stale || now.Sub(ag.LastSeen) > agent.OfflineAfter {
+		reasons = append(reasons, agent.RejectOffline)
+	}
+caps:
+	for _, c := range caps {
+		for _, has := range ag.Capabilities {
+			if has == c {
+				continue caps
+			}
+		}
+		reasons = append(reasons, agent.RejectCapability+" "+c)
+	}
+	return reasons
+}
+
+// capabilities which are needed for plugins of sessions that aren't done yet
+func requiredCapabilities(mgr *manager.Manager, sc *scan.Scan) ([]string, error) {
+	sessions := []*scan.Session{}
+	for _, sess := range sc.Sessions {
+		sessions = append(sessions, sess)
+		sessions = append(sessions, sess.GetAllChildren()...)
+	}
+	seen := map[bson.ObjectId]bool{}
+	for _, sess := range sessions {
+		if sess.IsDone() || sess.Plugin == "" || seen[sess.Plugin] {
+			continue
+		}
+		seen[sess.Plugin] = true
+		pl, err := mgr.Plugins.GetById(sess.Plugin.Hex())
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		// plugins are run in containers
+		if pl.Container != nil {
+			return []string{agent.CapabilityDocker}, nil
+		}
+	}
+	return []string{}, nil
+}
+
+// number of working sessions by agents
+func workingSessions(mgr *manager.Manager) (map[bson.ObjectId]int, error) {
+	scans, _, err := mgr.Scans.FilterByQuery(bson.M{"status": scan.StatusWorking})
+	if err != nil {
+		return nil, err
+	}
+	working := map[bson.ObjectId]int{}
+	for _, sc := range scans {
+		for _, sess := range sc.Sessions {
+			for _, s := range append([]*scan.Session{sess}, sess.GetAllChildren()...) {
+				if s.Status == scan.StatusWorking && s.Agent != "" {
+					working[s.Agent]++
+				}
+			}
+		}
+	}
+	return working, nil
+}
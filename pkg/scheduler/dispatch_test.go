@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/agent"
+	"github.com/bearded-web/bearded/models/scan"
+)
+
+func TestDiagnose(t *testing.T) {
+	now := time.Now().UTC()
+	docker := []string{agent.CapabilityDocker}
+	online := &agent.Agent{Id: bson.NewObjectId(), Status: agent.StatusApproved, LastSeen: now, Capabilities: docker}
+	offline := &agent.Agent{Id: bson.NewObjectId(), Status: agent.StatusApproved, LastSeen: now.Add(-time.Hour), Capabilities: docker}
+	blocked := &agent.Agent{Id: bson.NewObjectId(), Status: agent.StatusBlocked, LastSeen: now.Add(-time.Hour)}
+	noDocker := &agent.Agent{Id: bson.NewObjectId(), Status: agent.StatusApproved, LastSeen: now}
+	sc := &scan.Scan{Id: bson.NewObjectId(), Status: scan.StatusQueued}
+
+	d := diagnose(sc, []*agent.Agent{online, offline}, docker, map[bson.ObjectId]int{online.Id: 2}, now)
+	require.Equal(t, "", d.Reason)
+	require.Len(t, d.Agents, 2)
+	require.Empty(t, d.Agents[0].Rejected)
+	require.Equal(t, 2, d.Agents[0].Working)
+	require.Equal(t, []string{agent.RejectOffline}, d.Agents[1].Rejected)
+
+	d = diagnose(sc, []*agent.Agent{offline, blocked, noDocker}, docker, nil, now)
+	require.Equal(t, []string{agent.RejectBlocked, agent.RejectOffline, "missing capability docker"}, d.Agents[1].Rejected)
+	require.Equal(t, "no agent can take the scan: 1 offline, 1 blocked, 1 missing capability docker", d.Reason)
+
+	d = diagnose(sc, nil, docker, nil, now)
+	require.Equal(t, "no agents are registered", d.Reason)
+
+	sc.WaitWindow = true
+	d = diagnose(sc, []*agent.Agent{online}, docker, nil, now)
+	require.Equal(t, "the scan waits for the scan window of the target", d.Reason)
+
+	sc.Status = scan.StatusWorking
+	d = diagnose(sc, nil, docker, nil, now)
+	require.Equal(t, "", d.Reason)
+}
@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/incident"
+	"github.com/bearded-web/bearded/pkg/alert"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+// GroupQueue starts waiting scans of groups, so only Limit scans of a group are run at once
+type GroupQueue struct {
+	mgr   *manager.Manager
+	sched Scheduler
+	// scans are counted and started under the lock, so the limit isn't exceeded by concurrent calls
+	mu sync.Mutex
+
+	Limit int
+
+	// failures of starting are reported as incidents
+	Incidents *alert.Reporter
+	// owners are notified if no agent can take started scans
+	Notifier *alert.ScanNotifier
+}
+
+func NewGroupQueue(mgr *manager.Manager, sched Scheduler, limit int) *GroupQueue {
+	return &GroupQueue{
+		mgr:   mgr,
+		sched: sched,
+		Limit: limit,
+	}
+}
+
+// Run starts waiting scans every interval until the context is done
+func (q *GroupQueue) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := q.QueueAll(); err != nil {
+				log.Errorf("Waiting scans queueing error: %v", err)
+				q.Incidents.Report(&incident.Incident{
+					Type:    incident.TypeSchedulerError,
+					Error:   err.Error(),
+					Message: "Waiting scans of groups aren't queued",
+				})
+			}
+		}
+	}
+}
+
+// QueueAll starts waiting scans of all groups
+func (q *GroupQueue) QueueAll() error {
+	groups, err := q.mgr.Scans.GetWaitingGroups()
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if err := q.Queue(group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Queue starts waiting scans of the group while the group has less than Limit active scans
+func (q *GroupQueue) Queue(group bson.ObjectId) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	active, err := q.mgr.Scans.CountActive(group)
+	if err != nil {
+		return err
+	}
+	free := q.Limit - active
+	if free <= 0 {
+		return nil
+	}
+	scans, err := q.mgr.Scans.GetWaiting(group, free)
+	if err != nil {
+		return err
+	}
+	for _, sc := range scans {
+		if err := q.mgr.Scans.StartWaiting(sc); err != nil {
+			if q.mgr.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		in, err := InWindow(q.mgr, sc, time.Now())
+		if err != nil {
+			return err
+		}
+		if !in {
+			// the scan doesn't take the place of the group until the window
+			if err := q.mgr.Scans.WaitWindow(sc); err != nil {
+				return err
+			}
+			log.Infof("Waiting scan %s of group %s waits for the scan window", sc, group.Hex())
+			continue
+		}
+		log.Infof("Waiting scan %s of group %s is queued", sc, group.Hex())
+		if err := q.sched.AddScan(sc); err != nil {
+			return err
+		}
+		CheckDispatch(q.mgr, q.Notifier, sc)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/tests"
+)
+
+// recordScheduler keeps ids of added scans
+type recordScheduler struct {
+	Fake
+	added []bson.ObjectId
+}
+
+func (s *recordScheduler) AddScan(sc *scan.Scan) error {
+	s.added = append(s.added, sc.Id)
+	return nil
+}
+
+func TestGroupQueue(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := manager.New(mongo.DB(dbName))
+
+	group, id := bson.NewObjectId(), bson.NewObjectId()
+	waiting := []bson.ObjectId{}
+	for i := 0; i < 3; i++ {
+		sc, err := mgr.Scans.Create(&scan.Scan{Status: scan.StatusCreated, Group: group, Waiting: true,
+			Plan: id, Owner: id, Target: bson.NewObjectId(), Project: id})
+		require.NoError(t, err)
+		waiting = append(waiting, sc.Id)
+	}
+	sched := &recordScheduler{}
+	q := NewGroupQueue(mgr, sched, 2)
+
+	require.NoError(t, q.QueueAll())
+	require.Equal(t, waiting[:2], sched.added, "the oldest scans are started up to the limit")
+	status, err := mgr.Scans.GetGroupStatus(group, "")
+	require.NoError(t, err)
+	require.Equal(t, 1, status.Waiting)
+	require.Equal(t, 2, status.Queued)
+
+	// the group is full until one of the scans is done
+	require.NoError(t, q.Queue(group))
+	require.Len(t, sched.added, 2)
+	first, err := mgr.Scans.GetById(waiting[0])
+	require.NoError(t, err)
+	require.NoError(t, mgr.Scans.Transition(first, scan.StatusFinished))
+	require.NoError(t, q.Queue(group))
+	require.Equal(t, waiting, sched.added)
+
+	groups, err := mgr.Scans.GetWaitingGroups()
+	require.NoError(t, err)
+	require.Empty(t, groups)
+}
@@ -0,0 +1,213 @@
+package scheduler
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/comment"
+	"github.com/bearded-web/bearded/models/incident"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
+	"github.com/bearded-web/bearded/pkg/alert"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+// HistoryPruner removes the oldest done scans of targets beyond the history cap with their reports.
+// The baseline scan of the project is always kept and isn't counted in the cap.
+type HistoryPruner struct {
+	mgr *manager.Manager
+
+	// cap of targets which don't have their own or project one, zero keeps all scans
+	Default int
+
+	// failures of pruning are reported as incidents
+	Incidents *alert.Reporter
+}
+
+func NewHistoryPruner(mgr *manager.Manager, def int) *HistoryPruner {
+	return &HistoryPruner{
+		mgr:     mgr,
+		Default: def,
+	}
+}
+
+// Run prunes scan history every interval until the context is done
+func (p *HistoryPruner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.Prune(); err != nil {
+				log.Errorf("Scan history pruning error: %v", err)
+				p.Incidents.Report(&incident.Incident{
+					Type:    incident.TypeSchedulerError,
+					Error:   err.Error(),
+					Message: "Scan history isn't pruned",
+				})
+			}
+		}
+	}
+}
+
+// HistoryCap returns the number of kept scans of the target, the target cap is preferred to the project one
+func HistoryCap(t *target.Target, p *project.Project, def int) int {
+	if t.History > 0 {
+		return t.History
+	}
+	if p != nil && p.History > 0 {
+		return p.History
+	}
+	return def
+}
+
+// Prune scans of all targets, returns the number of removed scans
+func (p *HistoryPruner) Prune() (int, error) {
+	targets, _, err := p.mgr.Targets.All()
+	if err != nil {
+		return 0, err
+	}
+	projects := map[bson.ObjectId]*project.Project{}
+	total := 0
+	for _, t := range targets {
+		pr, found := projects[t.Project]
+		if !found {
+			if pr, err = p.mgr.Projects.GetById(t.Project); err != nil && !p.mgr.IsNotFound(err) {
+				return total, err
+			}
+			projects[t.Project] = pr
+		}
+		limit := HistoryCap(t, pr, p.Default)
+		if limit <= 0 {
+			continue
+		}
+		removed, err := p.PruneTarget(t, pr, limit)
+		total += removed
+		if err != nil {
+			return total, err
+		}
+		if removed > 0 {
+			log.Infof("%d old scans of target %s are pruned, %d scans are kept", removed, t.Id.Hex(), limit)
+		}
+	}
+	return total, nil
+}
+
+// PruneTarget removes done scans of the target except the most recent ones and the baseline scan
+func (p *HistoryPruner) PruneTarget(t *target.Target, pr *project.Project, limit int) (int, error) {
+	query := bson.M{
+		"target": t.Id,
+		"status": bson.M{"$in": []scan.ScanStatus{scan.StatusFinished, scan.StatusFailed}},
+	}
+	var baseline bson.ObjectId
+	if pr != nil && pr.Baseline != nil {
+		if pr.Baseline.Scan != "" {
+			query["_id"] = bson.M{"$ne": pr.Baseline.Scan}
+		}
+		baseline = pr.Baseline.Id
+	}
+	scans, _, err := p.mgr.Scans.FilterByQuery(query, manager.Opts{Sort: []string{"-dates.created"}, Skip: limit})
+	if err != nil || len(scans) == 0 {
+		return 0, err
+	}
+	pruned := map[bson.ObjectId]bool{}
+	ids := make([]bson.ObjectId, 0, len(scans))
+	for _, sc := range scans {
+		pruned[sc.Id] = true
+		ids = append(ids, sc.Id)
+	}
+
+	reports, _, err := p.mgr.Reports.FilterByQuery(bson.M{"scan": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	files := map[string]bool{}
+	for _, rep := range reports {
+		for _, f := range rep.Files {
+			files[f.Id] = true
+		}
+	}
+
+	issues, _, err := p.mgr.Issues.FilterByQuery(bson.M{"target": t.Id, "activities.report.scan": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	for _, obj := range issues {
+		prunable := PrunableIssue(obj, pruned, baseline)
+		if prunable {
+			// commented issues are preserved too
+			_, comments, err := p.mgr.Comments.FilterByQuery(bson.M{"type": comment.Issue, "link": obj.Id}, manager.Opts{Limit: 1})
+			if err != nil {
+				return 0, err
+			}
+			prunable = comments == 0
+		}
+		if !prunable {
+			// evidence of kept issues is kept too
+			for _, f := range obj.Attachments {
+				delete(files, f.Id)
+			}
+			continue
+		}
+		for _, f := range obj.Attachments {
+			files[f.Id] = true
+		}
+		if err := p.mgr.Issues.Remove(obj); err != nil && !p.mgr.IsNotFound(err) {
+			return 0, err
+		}
+	}
+	// files of the rest issues of the target could be shared with pruned reports
+	kept, _, err := p.mgr.Issues.FilterByQuery(bson.M{"target": t.Id, "attachments.id": bson.M{"$in": fileIds(files)}})
+	if err != nil {
+		return 0, err
+	}
+	for _, obj := range kept {
+		for _, f := range obj.Attachments {
+			delete(files, f.Id)
+		}
+	}
+	for id := range files {
+		if err := p.mgr.Files.Remove(id); err != nil && !p.mgr.IsNotFound(err) {
+			return 0, err
+		}
+	}
+
+	if _, err := p.mgr.Reports.RemoveAll(bson.M{"scan": bson.M{"$in": ids}}); err != nil {
+		return 0, err
+	}
+	if _, err := p.mgr.Feed.RemoveScans(ids); err != nil {
+		return 0, err
+	}
+	return p.mgr.Scans.RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+}
+
+// PrunableIssue returns true if the issue is reported only by pruned scans and nobody triaged it.
+// Confirmed, false, muted, merged and baseline issues and issues with activities of users are preserved.
+func PrunableIssue(obj *issue.TargetIssue, pruned map[bson.ObjectId]bool, baseline bson.ObjectId) bool {
+	if (baseline != "" && obj.Baseline == baseline) || obj.Confirmed || obj.False || obj.Muted || len(obj.Merged) > 0 {
+		return false
+	}
+	for _, act := range obj.Activities {
+		if act.User != "" {
+			return false
+		}
+		if act.Report != nil && !pruned[act.Report.Scan] {
+			return false
+		}
+	}
+	return true
+}
+
+func fileIds(files map[string]bool) []string {
+	ids := make([]string, 0, len(files))
+	for id := range files {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/comment"
+	"github.com/bearded-web/bearded/models/file"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/tests"
+)
+
+func TestHistoryCap(t *testing.T) {
+	require.Equal(t, 3, HistoryCap(&target.Target{History: 3}, &project.Project{History: 5}, 10))
+	require.Equal(t, 5, HistoryCap(&target.Target{}, &project.Project{History: 5}, 10))
+	require.Equal(t, 10, HistoryCap(&target.Target{}, &project.Project{}, 10))
+	require.Equal(t, 10, HistoryCap(&target.Target{}, nil, 10))
+	require.Equal(t, 0, HistoryCap(&target.Target{}, nil, 0))
+}
+
+func TestPrunableIssue(t *testing.T) {
+	old, recent, baseline := bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()
+	pruned := map[bson.ObjectId]bool{old: true}
+	reported := func(scans ...bson.ObjectId) []*issue.Activity {
+		acts := []*issue.Activity{}
+		for _, id := range scans {
+			acts = append(acts, &issue.Activity{Type: issue.ActivityReported, Report: &issue.Report{Scan: id}})
+		}
+		return acts
+	}
+
+	require.True(t, PrunableIssue(&issue.TargetIssue{Activities: reported(old)}, pruned, baseline))
+	require.True(t, PrunableIssue(&issue.TargetIssue{Activities: reported(old), Baseline: bson.NewObjectId()}, pruned, baseline))
+	require.True(t, PrunableIssue(&issue.TargetIssue{Activities: reported(old)}, pruned, ""))
+
+	kept := map[string]*issue.TargetIssue{
+		"reported by kept scan": {Activities: reported(old, recent)},
+		"baseline":              {Activities: reported(old), Baseline: baseline},
+		"confirmed":             {Activities: reported(old), Confirmed: true},
+		"false":                 {Activities: reported(old), False: true},
+		"muted":                 {Activities: reported(old), Muted: true},
+		"merged":                {Activities: reported(old), Merged: []*issue.Merged{{Id: bson.NewObjectId()}}},
+		"changed by user": {Activities: append(reported(old),
+			&issue.Activity{Type: issue.ActivityReopened, User: bson.NewObjectId()})},
+	}
+	for name, obj := range kept {
+		require.False(t, PrunableIssue(obj, pruned, baseline), name)
+	}
+}
+
+func TestPruneTarget(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := manager.New(mongo.DB(dbName))
+	require.NoError(t, mgr.Init())
+
+	pr, err := mgr.Projects.Create(&project.Project{Name: "history"})
+	require.NoError(t, err)
+	tgt, err := mgr.Targets.Create(&target.Target{Project: pr.Id, Type: target.TypeWeb})
+	require.NoError(t, err)
+
+	// scans from the oldest to the newest, the oldest is the baseline
+	now := time.Now().UTC()
+	scans := []*scan.Scan{}
+	for i := 0; i < 5; i++ {
+		created := now.Add(time.Duration(i-5) * time.Hour)
+		sc := &scan.Scan{Id: bson.NewObjectId(), Project: pr.Id, Target: tgt.Id, Status: scan.StatusFinished,
+			Dates: scan.Dates{Created: &created}}
+		require.NoError(t, mgr.Scans.Import(sc))
+		scans = append(scans, sc)
+	}
+	created := now.Add(-10 * time.Hour)
+	working := &scan.Scan{Id: bson.NewObjectId(), Project: pr.Id, Target: tgt.Id, Status: scan.StatusWorking,
+		Dates: scan.Dates{Created: &created}}
+	require.NoError(t, mgr.Scans.Import(working))
+	baselineId := bson.NewObjectId()
+	pr.Baseline = &project.Baseline{Id: baselineId, Scan: scans[0].Id}
+
+	newFile := func() *file.Meta {
+		meta, err := mgr.Files.Create(bytes.NewBufferString("data"), &file.Meta{Name: "data.txt"})
+		require.NoError(t, err)
+		return meta
+	}
+	reports := map[bson.ObjectId]*report.Report{}
+	output := newFile()
+	for i, sc := range scans {
+		rep := &report.Report{Type: report.TypeRaw, Scan: sc.Id, ScanSession: bson.NewObjectId(), Project: pr.Id}
+		if i == 1 {
+			rep.Files = []*file.Meta{output}
+		}
+		rep, err := mgr.Reports.Create(rep)
+		require.NoError(t, err)
+		reports[sc.Id] = rep
+	}
+
+	newIssue := func(obj *issue.TargetIssue, scans ...*scan.Scan) *issue.TargetIssue {
+		obj.Project, obj.Target = pr.Id, tgt.Id
+		for _, sc := range scans {
+			obj.Activities = append(obj.Activities, &issue.Activity{Type: issue.ActivityReported,
+				Report: &issue.Report{Scan: sc.Id, Report: reports[sc.Id].Id}})
+		}
+		obj, err := mgr.Issues.Create(obj)
+		require.NoError(t, err)
+		return obj
+	}
+	evidence, confirmedEvidence := newFile(), newFile()
+	stale := newIssue(&issue.TargetIssue{Issue: issue.Issue{Summary: "stale", Attachments: []*file.Meta{evidence}}}, scans[1])
+	confirmed := newIssue(&issue.TargetIssue{Confirmed: true,
+		Issue: issue.Issue{Summary: "confirmed", Attachments: []*file.Meta{confirmedEvidence}}}, scans[1])
+	commented := newIssue(&issue.TargetIssue{Issue: issue.Issue{Summary: "commented"}}, scans[2])
+	_, err = mgr.Comments.Create(&comment.Comment{Type: comment.Issue, Link: commented.Id, Project: pr.Id, Text: "keep"})
+	require.NoError(t, err)
+	recurring := newIssue(&issue.TargetIssue{Issue: issue.Issue{Summary: "recurring"}}, scans[1], scans[4])
+	inBaseline := newIssue(&issue.TargetIssue{Baseline: baselineId, Issue: issue.Issue{Summary: "baseline"}}, scans[2])
+
+	p := NewHistoryPruner(mgr, 0)
+	removed, err := p.PruneTarget(tgt, pr, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+
+	// the newest scans, the baseline scan and not done scans are kept
+	left, _, err := mgr.Scans.FilterByQuery(bson.M{"target": tgt.Id})
+	require.NoError(t, err)
+	ids := map[bson.ObjectId]bool{}
+	for _, sc := range left {
+		ids[sc.Id] = true
+	}
+	require.Equal(t, map[bson.ObjectId]bool{scans[0].Id: true, scans[3].Id: true, scans[4].Id: true, working.Id: true}, ids)
+
+	for i, sc := range scans {
+		_, err := mgr.Reports.GetById(reports[sc.Id].Id)
+		if i == 1 || i == 2 {
+			require.True(t, mgr.IsNotFound(err), "report of pruned scan %d", i)
+		} else {
+			require.NoError(t, err, "report of kept scan %d", i)
+		}
+	}
+
+	_, err = mgr.Issues.GetById(stale.Id)
+	require.True(t, mgr.IsNotFound(err))
+	for _, obj := range []*issue.TargetIssue{confirmed, commented, recurring, inBaseline} {
+		_, err := mgr.Issues.GetById(obj.Id)
+		require.NoError(t, err, obj.Summary)
+	}
+
+	// output of pruned reports and evidence of removed issues are removed, evidence of kept issues is kept
+	for _, meta := range []*file.Meta{output, evidence} {
+		_, err := mgr.Files.GetById(meta.Id)
+		require.True(t, mgr.IsNotFound(err), meta.Id)
+	}
+	f, err := mgr.Files.GetById(confirmedEvidence.Id)
+	require.NoError(t, err)
+	f.Close()
+
+	// the second run doesn't find anything to prune
+	removed, err = p.PruneTarget(tgt, pr, 2)
+	require.NoError(t, err)
+	require.Equal(t, 0, removed)
+}
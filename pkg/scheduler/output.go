@@ -0,0 +1,313 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/incident"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/alert"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+// reports are checked by batches of this size
+const outputBatch = 100
+
+// OutputPruner purges raw plugin output and files of reports after the output retention of their scans,
+// issues and the rest of reports are kept. Issues reported by the purged report get the tombstone activity.
+// Files which are attachments of issues are kept as their evidence.
+// The purge date is stored in the report when it's written and it's recomputed when the retention of the plan
+// or the project of its scan is changed.
+type OutputPruner struct {
+	mgr *manager.Manager
+
+	// days of scans which plans and projects don't set, zero keeps their output
+	Default int
+
+	// failures of purging are reported as incidents
+	Incidents *alert.Reporter
+}
+
+func NewOutputPruner(mgr *manager.Manager, def int) *OutputPruner {
+	return &OutputPruner{
+		mgr:     mgr,
+		Default: def,
+	}
+}
+
+// Run purges raw output every interval until the context is done
+func (p *OutputPruner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.Prune(); err != nil {
+				log.Errorf("Raw output purging error: %v", err)
+				p.Incidents.Report(&incident.Incident{
+					Type:    incident.TypeSchedulerError,
+					Error:   err.Error(),
+					Message: "Raw plugin output isn't purged",
+				})
+			}
+		}
+	}
+}
+
+// OutputDays returns days the raw output of scans is kept, the plan setting is preferred to the project one
+func OutputDays(pl *plan.Plan, pr *project.Project, def int) int {
+	if pl != nil && pl.OutputDays > 0 {
+		return pl.OutputDays
+	}
+	if pr != nil && pr.OutputDays > 0 {
+		return pr.OutputDays
+	}
+	return def
+}
+
+// SetPurgeAfter sets the purge date of the new report by the retention of its scan, the report isn't purged
+// if the retention isn't set. It does nothing if the pruner is nil.
+func (p *OutputPruner) SetPurgeAfter(mgr *manager.Manager, sc *scan.Scan, rep *report.Report) error {
+	if p == nil {
+		return nil
+	}
+	pl, err := mgr.Plans.GetById(sc.Plan)
+	if err != nil && !mgr.IsNotFound(err) {
+		return err
+	}
+	pr, err := mgr.Projects.GetById(sc.Project)
+	if err != nil && !mgr.IsNotFound(err) {
+		return err
+	}
+	if keep := OutputDays(pl, pr, p.Default); keep > 0 {
+		rep.PurgeAfter = time.Now().UTC().Add(days(keep))
+	}
+	return nil
+}
+
+// Migrate sets purge dates of reports which are written without them, returns the number of dated reports.
+// Reports of scans without the retention are left undated, so only reports which can be dated are checked:
+// all of them if the default retention is set, otherwise ones of plans and projects with the retention.
+func (p *OutputPruner) Migrate() (int, error) {
+	query := bson.M{}
+	if p.Default <= 0 {
+		plans, _, err := p.mgr.Plans.FilterByQuery(bson.M{"outputDays": bson.M{"$gt": 0}})
+		if err != nil {
+			return 0, err
+		}
+		projects, _, err := p.mgr.Projects.FilterByQuery(bson.M{"outputDays": bson.M{"$gt": 0}})
+		if err != nil {
+			return 0, err
+		}
+		if len(plans) == 0 && len(projects) == 0 {
+			return 0, nil
+		}
+		planIds := make([]bson.ObjectId, 0, len(plans))
+		for _, pl := range plans {
+			planIds = append(planIds, pl.Id)
+		}
+		projectIds := make([]bson.ObjectId, 0, len(projects))
+		for _, pr := range projects {
+			projectIds = append(projectIds, pr.Id)
+		}
+		scanIds, err := p.mgr.Scans.GetIds(bson.M{"plan": bson.M{"$in": planIds}})
+		if err != nil {
+			return 0, err
+		}
+		query = bson.M{"$or": []bson.M{{"project": bson.M{"$in": projectIds}}, {"scan": bson.M{"$in": scanIds}}}}
+	}
+	return p.date(p.mgr, func(after bson.ObjectId) ([]*manager.ReportRef, error) {
+		return p.mgr.Reports.GetUndated(query, after, outputBatch)
+	})
+}
+
+// Redate recomputes purge dates of unpurged reports of the query by the current retention of their scans,
+// it's called when the retention of a plan or a project is changed, so the change applies to stored reports too.
+// Dates are counted from creation of reports, they are removed if the output is kept now.
+// Returns the number of dated reports, it does nothing if the pruner is nil.
+func (p *OutputPruner) Redate(mgr *manager.Manager, query bson.M) (int, error) {
+	if p == nil {
+		return 0, nil
+	}
+	return p.date(mgr, func(after bson.ObjectId) ([]*manager.ReportRef, error) {
+		return mgr.Reports.GetStored(query, after, outputBatch)
+	})
+}
+
+// date sets purge dates of reports which are returned by batches, plans and projects of their scans are loaded once
+func (p *OutputPruner) date(mgr *manager.Manager, next func(after bson.ObjectId) ([]*manager.ReportRef, error)) (int, error) {
+	plans := map[bson.ObjectId]*plan.Plan{}
+	projects := map[bson.ObjectId]*project.Project{}
+	total := 0
+	after := bson.ObjectId("")
+	for {
+		refs, err := next(after)
+		if err != nil {
+			return total, err
+		}
+		if len(refs) == 0 {
+			break
+		}
+		after = refs[len(refs)-1].Id
+		ids := make([]bson.ObjectId, 0, len(refs))
+		for _, ref := range refs {
+			ids = append(ids, ref.Scan)
+		}
+		scans, _, err := mgr.Scans.FilterByQuery(bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return total, err
+		}
+		scanById := map[bson.ObjectId]*scan.Scan{}
+		for _, sc := range scans {
+			scanById[sc.Id] = sc
+		}
+		for _, ref := range refs {
+			sc := scanById[ref.Scan]
+			if sc == nil {
+				// the scan is removed, so only the project retention is known
+				sc = &scan.Scan{Project: ref.Project}
+			}
+			keep, err := scanDays(mgr, sc, plans, projects, p.Default)
+			if err != nil {
+				return total, err
+			}
+			purgeAfter := time.Time{}
+			if keep > 0 {
+				purgeAfter = ref.Created.Add(days(keep))
+			}
+			if purgeAfter.Equal(ref.PurgeAfter) {
+				continue
+			}
+			if err := mgr.Reports.SetPurgeAfter(ref.Id, purgeAfter); err != nil {
+				return total, err
+			}
+			if keep > 0 {
+				total++
+			}
+		}
+	}
+	return total, nil
+}
+
+// scanDays returns days the raw output of the scan is kept, plans and projects are cached in the maps
+func scanDays(mgr *manager.Manager, sc *scan.Scan, plans map[bson.ObjectId]*plan.Plan,
+	projects map[bson.ObjectId]*project.Project, def int) (int, error) {
+
+	pl, ok := plans[sc.Plan]
+	if !ok {
+		obj, err := mgr.Plans.GetById(sc.Plan)
+		if err != nil && !mgr.IsNotFound(err) {
+			return 0, err
+		}
+		pl = obj
+		plans[sc.Plan] = pl
+	}
+	pr, ok := projects[sc.Project]
+	if !ok {
+		obj, err := mgr.Projects.GetById(sc.Project)
+		if err != nil && !mgr.IsNotFound(err) {
+			return 0, err
+		}
+		pr = obj
+		projects[sc.Project] = pr
+	}
+	return OutputDays(pl, pr, def), nil
+}
+
+// Prune purges output of reports which purge dates are passed, returns the number of purged reports
+func (p *OutputPruner) Prune() (int, error) {
+	now := time.Now().UTC()
+	total := 0
+	after := bson.ObjectId("")
+	for {
+		refs, err := p.mgr.Reports.GetUnpurged(after, now, outputBatch)
+		if err != nil {
+			return total, err
+		}
+		if len(refs) == 0 {
+			break
+		}
+		after = refs[len(refs)-1].Id
+		for _, ref := range refs {
+			purged, err := p.PurgeReport(ref.Id, now)
+			if err != nil {
+				return total, err
+			}
+			if purged {
+				total++
+			}
+		}
+	}
+	if total > 0 {
+		log.Infof("Raw output of %d reports is purged", total)
+	}
+	return total, nil
+}
+
+// PurgeReport removes raw output and files of the report, returns true if there was something to purge
+func (p *OutputPruner) PurgeReport(id bson.ObjectId, now time.Time) (bool, error) {
+	rep, err := p.mgr.Reports.GetById(id)
+	if err != nil {
+		if p.mgr.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	files, size := rep.PurgeOutput()
+	removed := map[string]bool{}
+	for _, f := range files {
+		removed[f.Id] = true
+	}
+	if len(removed) > 0 {
+		// evidence of issues is kept with them
+		kept, _, err := p.mgr.Issues.FilterByQuery(bson.M{"attachments.id": bson.M{"$in": fileIds(removed)}})
+		if err != nil {
+			return false, err
+		}
+		for _, obj := range kept {
+			for _, f := range obj.Attachments {
+				delete(removed, f.Id)
+			}
+		}
+		for id := range removed {
+			if err := p.mgr.Files.Remove(id); err != nil && !p.mgr.IsNotFound(err) {
+				return false, err
+			}
+		}
+	}
+	rep.Purged = now
+	rep.PurgedSize = size
+	if err := p.mgr.Reports.Update(rep); err != nil {
+		return false, err
+	}
+	if size == 0 && len(files) == 0 {
+		return false, nil
+	}
+	// issues are found by the indexed scan of their reports
+	_, err = p.mgr.Issues.AddActivity(bson.M{"activities.report.scan": rep.Scan, "activities.report.report": rep.Id}, &issue.Activity{
+		Type:    issue.ActivityOutputPurged,
+		Created: now,
+		Report:  &issue.Report{Report: rep.Id, Scan: rep.Scan, ScanSession: rep.ScanSession},
+		Note: fmt.Sprintf("raw plugin output of %d bytes and %d files is purged after %d days",
+			size, len(files), keptDays(rep)),
+	})
+	return true, err
+}
+
+// days the output of the report is kept, the purge date is set a moment before the report is created
+func keptDays(rep *report.Report) int {
+	return int((rep.PurgeAfter.Sub(rep.Created) + time.Hour*12) / days(1))
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * time.Hour * 24
+}
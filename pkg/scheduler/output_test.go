@@ -0,0 +1,208 @@
+package scheduler
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/file"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/tests"
+)
+
+func TestOutputDays(t *testing.T) {
+	require.Equal(t, 3, OutputDays(&plan.Plan{OutputDays: 3}, &project.Project{OutputDays: 5}, 10))
+	require.Equal(t, 5, OutputDays(&plan.Plan{}, &project.Project{OutputDays: 5}, 10))
+	require.Equal(t, 10, OutputDays(&plan.Plan{}, &project.Project{}, 10))
+	require.Equal(t, 10, OutputDays(nil, nil, 10))
+	require.Equal(t, 0, OutputDays(nil, &project.Project{}, 0))
+}
+
+func TestPurgeReport(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := manager.New(mongo.DB(dbName))
+	require.NoError(t, mgr.Init())
+
+	pr, err := mgr.Projects.Create(&project.Project{Name: "output", OutputDays: 2})
+	require.NoError(t, err)
+	tgt, err := mgr.Targets.Create(&target.Target{Project: pr.Id, Type: target.TypeWeb})
+	require.NoError(t, err)
+	sc, err := mgr.Scans.Create(&scan.Scan{Project: pr.Id, Target: tgt.Id, Plan: bson.NewObjectId()})
+	require.NoError(t, err)
+
+	newFile := func() *file.Meta {
+		meta, err := mgr.Files.Create(bytes.NewBufferString("data"), &file.Meta{Name: "data.txt"})
+		require.NoError(t, err)
+		return meta
+	}
+	output, evidence := newFile(), newFile()
+	p := NewOutputPruner(mgr, 7)
+
+	// the purge date is set by the retention of the project when the report is written
+	rep := &report.Report{Type: report.TypeRaw, Scan: sc.Id, ScanSession: bson.NewObjectId(), Project: pr.Id,
+		Raw: report.Raw{Raw: "raw output", Files: []*file.Meta{output, evidence}}}
+	before := time.Now().UTC()
+	require.NoError(t, p.SetPurgeAfter(mgr, sc, rep))
+	require.False(t, rep.PurgeAfter.Before(before.Add(days(2))))
+	require.True(t, rep.PurgeAfter.Before(time.Now().UTC().Add(days(3))))
+	rep, err = mgr.Reports.Create(rep)
+	require.NoError(t, err)
+
+	// a nil pruner doesn't date reports
+	undated := &report.Report{}
+	require.NoError(t, (*OutputPruner)(nil).SetPurgeAfter(mgr, sc, undated))
+	require.True(t, undated.PurgeAfter.IsZero())
+
+	// the attachment of the issue is kept as its evidence
+	obj, err := mgr.Issues.Create(&issue.TargetIssue{Project: pr.Id, Target: tgt.Id,
+		Issue: issue.Issue{Summary: "reported", Attachments: []*file.Meta{evidence}},
+		Activities: []*issue.Activity{{Type: issue.ActivityReported,
+			Report: &issue.Report{Scan: sc.Id, Report: rep.Id, ScanSession: rep.ScanSession}}},
+	})
+	require.NoError(t, err)
+
+	// the report isn't purged before its purge date
+	purged, err := p.Prune()
+	require.NoError(t, err)
+	require.Equal(t, 0, purged)
+
+	now := rep.PurgeAfter.Add(time.Minute)
+	ok, err := p.PurgeReport(rep.Id, now)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	stored, err := mgr.Reports.GetById(rep.Id)
+	require.NoError(t, err)
+	require.Empty(t, stored.Raw.Raw)
+	require.Empty(t, stored.Files)
+	require.Equal(t, len("raw output"), stored.PurgedSize)
+	require.False(t, stored.Purged.IsZero())
+
+	_, err = mgr.Files.GetById(output.Id)
+	require.True(t, mgr.IsNotFound(err))
+	f, err := mgr.Files.GetById(evidence.Id)
+	require.NoError(t, err)
+	f.Close()
+
+	// the issue is kept with the tombstone of the report
+	obj, err = mgr.Issues.GetById(obj.Id)
+	require.NoError(t, err)
+	require.Len(t, obj.Activities, 2)
+	tomb := obj.Activities[1]
+	require.Equal(t, issue.ActivityOutputPurged, tomb.Type)
+	require.Equal(t, rep.Id, tomb.Report.Report)
+	require.Contains(t, tomb.Note, "after 2 days")
+
+	// purged reports aren't purged again
+	ok, err = p.PurgeReport(rep.Id, now)
+	require.NoError(t, err)
+	require.False(t, ok)
+	refs, err := mgr.Reports.GetUnpurged("", now, outputBatch)
+	require.NoError(t, err)
+	require.Empty(t, refs)
+}
+
+func TestPruneOutput(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := manager.New(mongo.DB(dbName))
+	require.NoError(t, mgr.Init())
+
+	pl, err := mgr.Plans.Create(&plan.Plan{Name: "short", TargetType: target.TypeWeb, OutputDays: 1})
+	require.NoError(t, err)
+	pr, err := mgr.Projects.Create(&project.Project{Name: "output"})
+	require.NoError(t, err)
+	short, err := mgr.Scans.Create(&scan.Scan{Project: pr.Id, Target: bson.NewObjectId(), Plan: pl.Id})
+	require.NoError(t, err)
+	other, err := mgr.Scans.Create(&scan.Scan{Project: pr.Id, Target: bson.NewObjectId(), Plan: bson.NewObjectId()})
+	require.NoError(t, err)
+
+	// reports written before purge dates are stored are dated by the migration
+	now := time.Now().UTC()
+	imported := func(sc *scan.Scan, age time.Duration) *report.Report {
+		rep := &report.Report{Id: bson.NewObjectId(), Type: report.TypeRaw, Scan: sc.Id, ScanSession: bson.NewObjectId(),
+			Project: pr.Id, Raw: report.Raw{Raw: "raw output"}, Created: now.Add(-age)}
+		require.NoError(t, mgr.Reports.Import(rep))
+		return rep
+	}
+	expired := imported(short, days(2))
+	fresh := imported(short, time.Hour)
+	kept := imported(other, days(3))
+
+	p := NewOutputPruner(mgr, 5)
+	migrated, err := p.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, 3, migrated)
+	migrated, err = p.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, 0, migrated)
+
+	purged, err := p.Prune()
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+	for rep, isPurged := range map[*report.Report]bool{expired: true, fresh: false, kept: false} {
+		stored, err := mgr.Reports.GetById(rep.Id)
+		require.NoError(t, err)
+		require.Equal(t, isPurged, !stored.Purged.IsZero(), rep.Created.String())
+	}
+
+	// the stored date is used, later changes of the default retention don't move it
+	p.Default = 1
+	purged, err = p.Prune()
+	require.NoError(t, err)
+	require.Equal(t, 0, purged)
+
+	// changes of the plan retention are applied to stored reports, purged ones aren't changed
+	p.Default = 5
+	pl.OutputDays = 0
+	require.NoError(t, mgr.Plans.Update(pl))
+	redated, err := p.Redate(mgr, bson.M{"scan": short.Id})
+	require.NoError(t, err)
+	require.Equal(t, 1, redated)
+	stored, err := mgr.Reports.GetById(fresh.Id)
+	require.NoError(t, err)
+	require.Equal(t, days(5), stored.PurgeAfter.Sub(stored.Created), "the date is counted from the creation")
+
+	// the date is removed if the output is kept now
+	p.Default = 0
+	redated, err = p.Redate(mgr, bson.M{"project": pr.Id})
+	require.NoError(t, err)
+	require.Equal(t, 0, redated)
+	stored, err = mgr.Reports.GetById(fresh.Id)
+	require.NoError(t, err)
+	require.True(t, stored.PurgeAfter.IsZero())
+
+	// undated reports of scans without the retention aren't checked by the migration
+	refs, err := mgr.Reports.GetUndated(bson.M{}, "", outputBatch)
+	require.NoError(t, err)
+	require.Len(t, refs, 2)
+	migrated, err = p.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, 0, migrated)
+	pr.OutputDays = 2
+	require.NoError(t, mgr.Projects.Update(pr))
+	migrated, err = p.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, 2, migrated, "reports of the project with the retention are dated")
+
+	// a nil pruner doesn't change dates
+	redated, err = (*OutputPruner)(nil).Redate(mgr, bson.M{})
+	require.NoError(t, err)
+	require.Equal(t, 0, redated)
+}
@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/bearded-web/bearded/models/incident"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/alert"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+// PauseExpirer fails scans which aren't resumed during the ttl
+type PauseExpirer struct {
+	mgr   *manager.Manager
+	sched Scheduler
+
+	Ttl time.Duration
+
+	// failures of expiring are reported as incidents
+	Incidents *alert.Reporter
+	// owners of unattended scans are notified about expired ones
+	Notifier *alert.ScanNotifier
+}
+
+func NewPauseExpirer(mgr *manager.Manager, sched Scheduler, ttl time.Duration) *PauseExpirer {
+	return &PauseExpirer{
+		mgr:   mgr,
+		sched: sched,
+		Ttl:   ttl,
+	}
+}
+
+// Run expires paused scans every interval until the context is done
+func (e *PauseExpirer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Expire(); err != nil {
+				log.Errorf("Paused scans expiration error: %v", err)
+				e.Incidents.Report(&incident.Incident{
+					Type:    incident.TypeSchedulerError,
+					Error:   err.Error(),
+					Message: "Paused scans aren't expired",
+				})
+			}
+		}
+	}
+}
+
+// Expire fails scans which are paused longer than the ttl
+func (e *PauseExpirer) Expire() error {
+	scans, err := e.mgr.Scans.GetPausedBefore(time.Now().UTC().Add(-e.Ttl))
+	if err != nil {
+		return err
+	}
+	for _, sc := range scans {
+		paused := sc.Dates.Paused
+		if err := e.mgr.Scans.Transition(sc, scan.StatusFailed); err != nil {
+			// the scan is resumed meanwhile
+			if e.mgr.IsTransitionErr(err) || e.mgr.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		log.Infof("Scan %s is failed after being paused since %s", sc, paused)
+		if err := e.sched.UpdateScan(sc); err != nil {
+			return err
+		}
+		if err := e.mgr.Feed.UpdateScan(sc); err != nil {
+			return err
+		}
+		e.Notifier.Failed(sc, fmt.Sprintf("the paused scan isn't resumed in %s", e.Ttl))
+	}
+	return nil
+}
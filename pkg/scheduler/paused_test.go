@@ -0,0 +1,51 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/tests"
+)
+
+func TestPauseExpirer(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := manager.New(mongo.DB(dbName))
+
+	id := bson.NewObjectId()
+	create := func() *scan.Scan {
+		sc, err := mgr.Scans.Create(&scan.Scan{Status: scan.StatusWorking, Plan: id, Owner: id, Target: id, Project: id})
+		require.NoError(t, err)
+		_, err = mgr.Feed.AddScan(sc)
+		require.NoError(t, err)
+		require.NoError(t, mgr.Scans.Transition(sc, scan.StatusPaused))
+		return sc
+	}
+	expired, resumed := create(), create()
+	require.NoError(t, mgr.Scans.Transition(resumed, scan.StatusQueued))
+
+	e := NewPauseExpirer(mgr, NewFake(), -time.Minute)
+	require.NoError(t, e.Expire())
+	obj, err := mgr.Scans.GetById(expired.Id)
+	require.NoError(t, err)
+	require.Equal(t, scan.StatusFailed, obj.Status)
+	obj, err = mgr.Scans.GetById(resumed.Id)
+	require.NoError(t, err)
+	require.Equal(t, scan.StatusQueued, obj.Status)
+
+	// scans paused during the ttl are kept
+	kept := create()
+	e.Ttl = time.Hour
+	require.NoError(t, e.Expire())
+	obj, err = mgr.Scans.GetById(kept.Id)
+	require.NoError(t, err)
+	require.Equal(t, scan.StatusPaused, obj.Status)
+}
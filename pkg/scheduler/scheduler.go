@@ -1,13 +1,24 @@
 package scheduler
 
 import (
+	"fmt"
 	"sync"
 
-	"github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/incident"
 	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/alert"
+	"github.com/bearded-web/bearded/pkg/logging"
 	"github.com/bearded-web/bearded/pkg/manager"
 )
 
+var log = logging.Logger(logging.Scheduler)
+
+// sessions are queued again on every poll of agents, so the incident is reported
+// only after this number of consecutive failures of the session and only once
+const incidentAfterFailures = 3
+
 type Scheduler interface {
 	// this method blocks until context is done or returns pack of jobs
 	//	GetJobs(context.Context, *agent.Agent) ([]*agent.Job, error)
@@ -21,6 +32,12 @@ type MemoryScheduler struct {
 	mgr   *manager.Manager
 	scans map[string]*scan.Scan
 	rw    sync.RWMutex
+
+	// failures of queueing sessions are reported as incidents
+	Incidents *alert.Reporter
+	// consecutive failures of queueing by session
+	failures   map[bson.ObjectId]int
+	failuresMu sync.Mutex
 }
 
 var _ Scheduler = &MemoryScheduler{} // check interface compatibility
@@ -28,8 +45,9 @@ var _ Scheduler = &MemoryScheduler{} // check interface compatibility
 // Memory scheduler is just a prototype of scheduler, it mustn't be used in production environment
 func NewMemoryScheduler(mgr *manager.Manager) *MemoryScheduler {
 	return &MemoryScheduler{
-		scans: map[string]*scan.Scan{},
-		mgr:   mgr,
+		scans:    map[string]*scan.Scan{},
+		mgr:      mgr,
+		failures: map[bson.ObjectId]int{},
 	}
 }
 
@@ -54,6 +72,10 @@ func (s *MemoryScheduler) GetSession() (*scan.Session, error) {
 
 scans:
 	for id, sc := range s.scans {
+		if sc.Status == scan.StatusPaused || sc.WaitWindow {
+			// paused scans are kept until they are resumed or failed, held ones until the window queue starts them
+			continue scans
+		}
 	sessions:
 		for _, sess := range sc.Sessions {
 			switch sess.Status {
@@ -66,9 +88,10 @@ scans:
 						delete(s.scans, id)
 						continue scans
 					}
-					logrus.Error(err)
+					s.reportErr(sc, sess, err)
 					continue scans
 				}
+				s.resetFailures(sess.Id)
 				return sess, nil
 			case scan.StatusQueued:
 				// all scans session run in sequence order
@@ -88,9 +111,10 @@ scans:
 								delete(s.scans, id)
 								continue scans
 							}
-							logrus.Error(err)
+							s.reportErr(sc, child, err)
 							continue scans
 						}
+						s.resetFailures(child.Id)
 						return child, nil
 					}
 				}
@@ -123,9 +147,10 @@ sessions:
 					delete(s.scans, id)
 					return nil
 				}
-				logrus.Error(err)
+				s.reportErr(sc, sess, err)
 				return nil
 			}
+			s.resetFailures(sess.Id)
 			return sess
 		case scan.StatusQueued:
 			// all scans session run in sequence order
@@ -148,3 +173,33 @@ sessions:
 	}
 	return nil
 }
+
+func (s *MemoryScheduler) reportErr(sc *scan.Scan, sess *scan.Session, err error) {
+	log.Error(err)
+	if !s.countFailure(sess.Id) {
+		return
+	}
+	s.Incidents.Report(&incident.Incident{
+		Type:    incident.TypeSchedulerError,
+		Project: sc.Project,
+		Scan:    sc.Id,
+		Session: sess.Id,
+		Error:   err.Error(),
+		Message: fmt.Sprintf("Session %s of scan %s isn't queued", sess.Id.Hex(), sc.Id.Hex()),
+	})
+}
+
+// count the failure of the session, returns true when the failure should be reported as the incident
+func (s *MemoryScheduler) countFailure(id bson.ObjectId) bool {
+	s.failuresMu.Lock()
+	defer s.failuresMu.Unlock()
+	s.failures[id]++
+	return s.failures[id] == incidentAfterFailures
+}
+
+// the session is queued, so the next failure is counted from the start
+func (s *MemoryScheduler) resetFailures(id bson.ObjectId) {
+	s.failuresMu.Lock()
+	delete(s.failures, id)
+	s.failuresMu.Unlock()
+}
@@ -0,0 +1,27 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestCountFailure(t *testing.T) {
+	s := NewMemoryScheduler(nil)
+	id := bson.NewObjectId()
+	reported := 0
+	for i := 0; i < incidentAfterFailures*2; i++ {
+		if s.countFailure(id) {
+			reported++
+		}
+	}
+	require.Equal(t, 1, reported, "the incident is reported once for consecutive failures")
+
+	// the queued session is counted from the start again
+	s.resetFailures(id)
+	for i := 1; i < incidentAfterFailures; i++ {
+		require.False(t, s.countFailure(id))
+	}
+	require.True(t, s.countFailure(id))
+}
@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/incident"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/alert"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+// InWindow returns false if the target of the scan is outside of its scan windows.
+// Scans of removed targets aren't kept waiting.
+func InWindow(mgr *manager.Manager, sc *scan.Scan, now time.Time) (bool, error) {
+	t, err := mgr.Targets.GetById(sc.Target)
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return t.InWindow(now), nil
+}
+
+// WindowQueue starts scans which wait for scan windows of their targets
+type WindowQueue struct {
+	mgr   *manager.Manager
+	sched Scheduler
+
+	// scans of groups are moved to the group queue, so the group limit isn't exceeded when the window opens
+	Groups *GroupQueue
+
+	// failures of starting are reported as incidents
+	Incidents *alert.Reporter
+	// owners are notified if no agent can take started scans
+	Notifier *alert.ScanNotifier
+}
+
+func NewWindowQueue(mgr *manager.Manager, sched Scheduler) *WindowQueue {
+	return &WindowQueue{
+		mgr:   mgr,
+		sched: sched,
+	}
+}
+
+// Run starts scans in windows every interval until the context is done
+func (q *WindowQueue) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := q.QueueAll(time.Now()); err != nil {
+				log.Errorf("Scans in windows queueing error: %v", err)
+				q.Incidents.Report(&incident.Incident{
+					Type:    incident.TypeSchedulerError,
+					Error:   err.Error(),
+					Message: "Scans waiting for scan windows aren't queued",
+				})
+			}
+		}
+	}
+}
+
+// QueueAll starts waiting scans which targets are in scan windows at the time
+func (q *WindowQueue) QueueAll(now time.Time) error {
+	scans, err := q.mgr.Scans.GetWaitingWindow()
+	if err != nil {
+		return err
+	}
+	groups := map[bson.ObjectId]bool{}
+	for _, sc := range scans {
+		in, err := InWindow(q.mgr, sc, now)
+		if err != nil {
+			return err
+		}
+		if !in {
+			continue
+		}
+		grouped := sc.Group != "" && q.Groups != nil
+		if err := q.mgr.Scans.StartWindow(sc, grouped); err != nil {
+			if q.mgr.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		log.Infof("Scan %s is in the scan window", sc)
+		if grouped {
+			groups[sc.Group] = true
+			continue
+		}
+		if err := q.sched.AddScan(sc); err != nil {
+			return err
+		}
+		CheckDispatch(q.mgr, q.Notifier, sc)
+	}
+	for group := range groups {
+		if err := q.Groups.Queue(group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Hold returns the taken first session to the window queue if the scan isn't started yet and the target is out
+// of its scan windows, e.g. the window is closed while the scan was queued. Sessions of started scans
+// and scans started with the override are dispatched anyway. True is returned if the session is held.
+func Hold(mgr *manager.Manager, sched Scheduler, sess *scan.Session, now time.Time) (bool, error) {
+	if sess.HasParent() {
+		return false, nil
+	}
+	sc, err := mgr.Scans.GetById(sess.Scan)
+	if err != nil {
+		return false, err
+	}
+	if sc.WindowOverride || sc.Started != nil {
+		return false, nil
+	}
+	in, err := InWindow(mgr, sc, now)
+	if err != nil || in {
+		return false, err
+	}
+	obj := sc.GetSession(sess.Id)
+	if obj == nil {
+		return false, nil
+	}
+	obj.Status = scan.StatusCreated
+	obj.Queued = nil
+	obj.Agent = ""
+	if err := mgr.Scans.UpdateSession(sc, obj); err != nil {
+		return false, err
+	}
+	if err := mgr.Scans.Transition(sc, scan.StatusCreated); err != nil {
+		return false, err
+	}
+	if err := mgr.Scans.WaitWindow(sc); err != nil {
+		return false, err
+	}
+	log.Infof("Scan %s is held until the scan window of target %s", sc, sc.Target.Hex())
+	return true, sched.UpdateScan(sc)
+}
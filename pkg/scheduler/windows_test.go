@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/tests"
+)
+
+func TestHold(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+	mgr := manager.New(mongo.DB(dbName))
+
+	id := bson.NewObjectId()
+	tgt, err := mgr.Targets.Create(&target.Target{Project: id, Type: target.TypeWeb,
+		Web:     &target.WebTarget{Domain: "http://example.com"},
+		Windows: []*target.Window{{Start: "01:00", End: "02:00"}}})
+	require.NoError(t, err)
+	// the window is closed at noon
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	create := func(override bool) (*scan.Scan, *scan.Session) {
+		sc, err := mgr.Scans.Create(&scan.Scan{Status: scan.StatusCreated, Plan: id, Owner: id, Target: tgt.Id,
+			Project: id, WindowOverride: override,
+			Sessions: []*scan.Session{{Id: bson.NewObjectId(), Plugin: id, Status: scan.StatusCreated}}})
+		require.NoError(t, err)
+		sess := sc.Sessions[0]
+		sess.Scan = sc.Id
+		sess.Status = scan.StatusQueued
+		require.NoError(t, mgr.Scans.UpdateSession(sc, sess))
+		return sc, sess
+	}
+	sched := &recordScheduler{}
+
+	sc, sess := create(false)
+	held, err := Hold(mgr, sched, sess, now)
+	require.NoError(t, err)
+	require.True(t, held)
+	obj, err := mgr.Scans.GetById(sc.Id)
+	require.NoError(t, err)
+	require.True(t, obj.WaitWindow)
+	require.Equal(t, scan.StatusCreated, obj.Status)
+	require.Equal(t, scan.StatusCreated, obj.Sessions[0].Status)
+	waiting, err := mgr.Scans.GetWaitingWindow()
+	require.NoError(t, err)
+	require.Len(t, waiting, 1, "the window queue starts the scan again")
+
+	// the scan is dispatched in the window
+	sc, sess = create(false)
+	held, err = Hold(mgr, sched, sess, time.Date(2015, 6, 1, 1, 30, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.False(t, held)
+
+	_, sess = create(true)
+	held, err = Hold(mgr, sched, sess, now)
+	require.NoError(t, err)
+	require.False(t, held, "overridden scans are dispatched outside of windows")
+}
@@ -1,6 +1,7 @@
 package script
 
 import (
+	"github.com/bearded-web/bearded/models/file"
 	"github.com/bearded-web/bearded/models/plan"
 	"github.com/bearded-web/bearded/models/report"
 	"golang.org/x/net/context"
@@ -13,4 +14,8 @@ type ClientV1 interface {
 	RunPlugin(ctx context.Context, step *plan.WorkflowStep) (*report.Report, error)
 	SendReport(ctx context.Context, rep *report.Report) error
 	DownloadFile(ctx context.Context, fileId string) ([]byte, error)
+	// upload artifact, add the returned meta to issue attachments
+	UploadFile(ctx context.Context, name string, data []byte) (*file.Meta, error)
+	// report the percent of the work 0-100 with an optional message, like "crawling"
+	SendProgress(ctx context.Context, percent int, message string) error
 }
@@ -3,6 +3,7 @@ package script
 import (
 	"fmt"
 
+	"github.com/bearded-web/bearded/models/file"
 	"github.com/bearded-web/bearded/models/plan"
 	"github.com/bearded-web/bearded/models/report"
 	"golang.org/x/net/context"
@@ -38,3 +39,11 @@ func (f *FakeClient) GetConfig(ctx context.Context) (*plan.Conf, error) {
 func (f *FakeClient) DownloadFile(ctx context.Context, fileId string) ([]byte, error) {
 	return nil, nil
 }
+
+func (f *FakeClient) SendProgress(ctx context.Context, percent int, message string) error {
+	return nil
+}
+
+func (f *FakeClient) UploadFile(ctx context.Context, name string, data []byte) (*file.Meta, error) {
+	return nil, nil
+}
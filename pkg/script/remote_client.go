@@ -3,8 +3,10 @@ package script
 import (
 	"fmt"
 
+	"github.com/bearded-web/bearded/models/file"
 	"github.com/bearded-web/bearded/models/plan"
 	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
 	"github.com/bearded-web/bearded/pkg/agent/api"
 	"github.com/bearded-web/bearded/pkg/transport"
 	"golang.org/x/net/context"
@@ -112,3 +114,24 @@ func (c *RemoteClient) DownloadFile(ctx context.Context, fileId string) ([]byte,
 	}
 	return resp.DownloadFile, nil
 }
+
+func (c *RemoteClient) UploadFile(ctx context.Context, name string, data []byte) (*file.Meta, error) {
+	req := api.RequestV1{
+		Method:     api.UploadFile,
+		UploadFile: &api.File{Name: name, Data: data},
+	}
+	resp := api.ResponseV1{}
+	if err := c.transp.Request(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.UploadFile, nil
+}
+
+func (c *RemoteClient) SendProgress(ctx context.Context, percent int, message string) error {
+	req := api.RequestV1{
+		Method:       api.SendProgress,
+		SendProgress: &scan.Progress{Percent: percent, Message: message},
+	}
+	resp := api.ResponseV1{}
+	return c.transp.Request(ctx, req, &resp)
+}
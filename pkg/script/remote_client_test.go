@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/scan"
 	"github.com/bearded-web/bearded/pkg/agent/api"
 	"github.com/bearded-web/bearded/pkg/transport"
 	"github.com/stretchr/testify/mock"
@@ -47,3 +48,20 @@ func TestRemoteClient(t *testing.T) {
 	require.Equal(t, actualCfg, conf)
 
 }
+
+func TestRemoteClientSendProgress(t *testing.T) {
+	transp := &MockTransport{}
+
+	client, err := NewRemoteClient(transp)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	transp.Mock.On("Request", ctx,
+		api.RequestV1{Method: api.SendProgress, SendProgress: &scan.Progress{Percent: 40, Message: "crawling"}},
+		&api.ResponseV1{}).Return(nil, &api.ResponseV1{}).Once()
+
+	require.NoError(t, client.SendProgress(ctx, 40, "crawling"))
+	transp.Mock.AssertExpectations(t)
+}
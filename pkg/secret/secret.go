@@ -0,0 +1,163 @@
+package secret
+
+// Secret values of the config are referenced as secret://<backend>/<key> instead of being inlined,
+// references are resolved on start, so secrets are kept out of config files and rotated in one place:
+//
+//	secret://env/SMTP_PASSWORD             environment variable
+//	secret://file/run/secrets/smtp         content of the file /run/secrets/smtp without trailing newlines
+//	secret://vault/secret/bearded#smtp     field smtp of the vault secret secret/bearded
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const Prefix = "secret://"
+
+// Backend returns the secret value by the key
+type Backend interface {
+	Get(key string) (string, error)
+}
+
+// BackendFunc is an adapter to use ordinary functions as backends
+type BackendFunc func(key string) (string, error)
+
+func (f BackendFunc) Get(key string) (string, error) {
+	return f(key)
+}
+
+// Env takes secrets from environment variables
+var Env = BackendFunc(func(key string) (string, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return "", fmt.Errorf("env %s is empty", key)
+	}
+	return value, nil
+})
+
+// File takes secrets from files, keys are absolute paths, like mounted docker or kubernetes secrets
+var File = BackendFunc(func(key string) (string, error) {
+	data, err := ioutil.ReadFile("/" + strings.TrimPrefix(key, "/"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+})
+
+type Resolver struct {
+	backends map[string]Backend
+}
+
+// NewResolver creates a resolver with env and file backends
+func NewResolver() *Resolver {
+	return &Resolver{
+		backends: map[string]Backend{
+			"env":  Env,
+			"file": File,
+		},
+	}
+}
+
+// Register adds the backend or replaces the backend with the same name
+func (r *Resolver) Register(name string, b Backend) {
+	r.backends[name] = b
+}
+
+// IsRef returns true if the value is a secret reference
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Get resolves the reference, values which aren't references are returned as is
+func (r *Resolver) Get(value string) (string, error) {
+	if !IsRef(value) {
+		return value, nil
+	}
+	ref := strings.TrimPrefix(value, Prefix)
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("wrong secret reference %s, it must be %s<backend>/<key>", value, Prefix)
+	}
+	b, ok := r.backends[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("unknown secret backend %s", parts[0])
+	}
+	secret, err := b.Get(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("can't get secret %s: %s", ref, err)
+	}
+	return secret, nil
+}
+
+// Resolve replaces references in all string fields, slices and maps of the struct
+// which the pointer points to. Errors have the path of the field, but never the secret.
+func (r *Resolver) Resolve(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("pointer is required, got %T", v)
+	}
+	return r.resolve(rv.Elem(), "")
+}
+
+func (r *Resolver) resolve(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return r.resolve(v.Elem(), path)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if !field.CanSet() {
+				continue
+			}
+			if err := r.resolve(field, join(path, t.Field(i).Name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.resolve(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		for _, key := range v.MapKeys() {
+			value, err := r.value(v.MapIndex(key).String(), fmt.Sprintf("%s[%v]", path, key.Interface()))
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(key, reflect.ValueOf(value).Convert(v.Type().Elem()))
+		}
+	case reflect.String:
+		value, err := r.value(v.String(), path)
+		if err != nil {
+			return err
+		}
+		v.SetString(value)
+	}
+	return nil
+}
+
+func (r *Resolver) value(value, path string) (string, error) {
+	secret, err := r.Get(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", path, err)
+	}
+	return secret, nil
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,104 @@
+package secret
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSmtp struct {
+	User     string
+	Password string
+}
+
+type testConfig struct {
+	Smtp    testSmtp
+	Admins  []string
+	Weights map[string]string
+	Ptr     *testSmtp
+	Port    int
+	hidden  string
+}
+
+func TestResolve(t *testing.T) {
+	os.Setenv("BEARDED_TEST_SECRET", "env-secret")
+	defer os.Setenv("BEARDED_TEST_SECRET", "")
+
+	f, err := ioutil.TempFile("", "secret")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("file-secret\n")
+	f.Close()
+
+	cfg := &testConfig{
+		Smtp:    testSmtp{User: "admin", Password: "secret://env/BEARDED_TEST_SECRET"},
+		Admins:  []string{"secret://file" + f.Name()},
+		Weights: map[string]string{"key": "secret://env/BEARDED_TEST_SECRET"},
+		Ptr:     &testSmtp{Password: "secret://file" + f.Name()},
+		Port:    25,
+		hidden:  "secret://env/UNKNOWN",
+	}
+	require.NoError(t, NewResolver().Resolve(cfg))
+	assert.Equal(t, "admin", cfg.Smtp.User)
+	assert.Equal(t, "env-secret", cfg.Smtp.Password)
+	assert.Equal(t, []string{"file-secret"}, cfg.Admins)
+	assert.Equal(t, "env-secret", cfg.Weights["key"])
+	assert.Equal(t, "file-secret", cfg.Ptr.Password)
+}
+
+func TestResolveErrors(t *testing.T) {
+	for _, ref := range []string{"secret://env/BEARDED_TEST_UNKNOWN", "secret://unknown/key", "secret://env"} {
+		cfg := &testConfig{Smtp: testSmtp{Password: ref}}
+		err := NewResolver().Resolve(cfg)
+		if assert.Error(t, err, ref) {
+			assert.Contains(t, err.Error(), "Smtp.Password")
+		}
+	}
+	assert.Error(t, NewResolver().Resolve(testConfig{}))
+}
+
+func TestVault(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		require.Equal(t, "token", r.Header.Get("X-Vault-Token"))
+		switch r.URL.Path {
+		case "/v1/secret/bearded":
+			fmt.Fprint(w, `{"data": {"smtp": "v1-secret", "port": 25}}`)
+		case "/v1/secret/data/bearded":
+			fmt.Fprint(w, `{"data": {"data": {"smtp": "v2-secret"}, "metadata": {"version": 2}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	r := NewResolver()
+	r.Register("vault", NewVault(ts.URL+"/", "token", 0))
+	cfg := &testConfig{
+		Smtp:   testSmtp{User: "secret://vault/secret/bearded#smtp", Password: "secret://vault/secret/data/bearded#smtp"},
+		Admins: []string{"secret://vault/secret/bearded#smtp"},
+	}
+	require.NoError(t, r.Resolve(cfg))
+	assert.Equal(t, "v1-secret", cfg.Smtp.User)
+	assert.Equal(t, "v2-secret", cfg.Smtp.Password)
+	assert.Equal(t, "v1-secret", cfg.Admins[0])
+	// every path is read once
+	assert.Equal(t, 2, calls)
+
+	for _, ref := range []string{
+		"secret://vault/secret/bearded#unknown",
+		"secret://vault/secret/bearded#port",
+		"secret://vault/secret/bearded",
+		"secret://vault/secret/unknown#smtp",
+	} {
+		_, err := r.Get(ref)
+		assert.Error(t, err, ref)
+	}
+}
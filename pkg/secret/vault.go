@@ -0,0 +1,95 @@
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultVaultTimeout = time.Second * 5
+
+// Vault takes secrets from vault kv engines, keys are in form of <path>#<field>.
+// Both versions of the kv engine are supported, for the second one the path has the data segment,
+// e.g. secret/data/bearded#smtp. Secrets are read once per path.
+type Vault struct {
+	Addr  string
+	Token string
+	http  *http.Client
+
+	mu    sync.Mutex
+	paths map[string]map[string]interface{}
+}
+
+// NewVault creates vault backend, the default timeout is used if it's zero
+func NewVault(addr, token string, timeout time.Duration) *Vault {
+	if timeout == 0 {
+		timeout = DefaultVaultTimeout
+	}
+	return &Vault{
+		Addr:  strings.TrimRight(addr, "/"),
+		Token: token,
+		http:  &http.Client{Timeout: timeout},
+		paths: map[string]map[string]interface{}{},
+	}
+}
+
+func (v *Vault) Get(key string) (string, error) {
+	parts := strings.SplitN(key, "#", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("vault key must be <path>#<field>")
+	}
+	data, err := v.read(parts[0])
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[parts[1]]
+	if !ok {
+		return "", fmt.Errorf("field %s isn't found", parts[1])
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("field %s isn't a string", parts[1])
+	}
+	return s, nil
+}
+
+func (v *Vault) read(path string) (map[string]interface{}, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if data, ok := v.paths[path]; ok {
+		return data, nil
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/v1/%s", v.Addr, strings.TrimLeft(path, "/")), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned %d status", resp.StatusCode)
+	}
+
+	body := struct {
+		Data map[string]interface{} `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("can't decode vault response: %s", err)
+	}
+	data := body.Data
+	// the second version of kv engine keeps the secret in data.data next to data.metadata
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+	v.paths[path] = data
+	return data, nil
+}
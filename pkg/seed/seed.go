@@ -0,0 +1,361 @@
+// Package seed fills a development database with fake but realistic data for demos and UI development.
+// The same seed gives the same data, seeded objects are namespaced, so they are cleared without
+// touching anything else. Only databases with seed_ or test_ prefix are seeded.
+package seed
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/plugin"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/passlib"
+	"github.com/bearded-web/bearded/pkg/tests"
+)
+
+// namespace of seeded objects
+const (
+	DbPrefix     = "seed_"
+	EmailDomain  = "seed.bearded.local"
+	PluginPrefix = "seed/"
+	PlanPrefix   = "seed-"
+)
+
+// Opts set the volume of data, numbers of projects, targets, scans and issues are for every parent object
+type Opts struct {
+	Seed     int64
+	Password string // of every seeded user
+
+	Users    int
+	Projects int
+	Targets  int
+	Scans    int
+	Issues   int
+}
+
+var DefaultOpts = Opts{
+	Seed:     1,
+	Password: "password",
+	Users:    3,
+	Projects: 2,
+	Targets:  3,
+	Scans:    2,
+	Issues:   10,
+}
+
+// Result has numbers of created objects
+type Result struct {
+	Users    int `json:"users"`
+	Projects int `json:"projects"`
+	Targets  int `json:"targets"`
+	Plugins  int `json:"plugins"`
+	Plans    int `json:"plans"`
+	Scans    int `json:"scans"`
+	Issues   int `json:"issues"`
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("%d users, %d projects, %d targets, %d plugins, %d plans, %d scans, %d issues",
+		r.Users, r.Projects, r.Targets, r.Plugins, r.Plans, r.Scans, r.Issues)
+}
+
+// Check returns an error if the database isn't for development, so production data is never seeded or cleared
+func Check(dbName string) error {
+	if !strings.HasPrefix(dbName, DbPrefix) && !strings.HasPrefix(dbName, tests.TestDbPrefix) {
+		return fmt.Errorf("database %q should have %s or %s prefix to be seeded", dbName, DbPrefix, tests.TestDbPrefix)
+	}
+	return nil
+}
+
+// Seed clears previously seeded data and creates it again, so it's safe to run it several times
+func Seed(mgr *manager.Manager, dbName string, opts Opts) (*Result, error) {
+	if err := Check(dbName); err != nil {
+		return nil, err
+	}
+	if _, err := Clear(mgr, dbName); err != nil {
+		return nil, err
+	}
+	g := &generator{
+		mgr:    mgr,
+		rnd:    rand.New(rand.NewSource(opts.Seed)),
+		opts:   opts,
+		result: &Result{},
+	}
+	return g.result, g.run()
+}
+
+// Clear removes seeded objects and returns the number of removed ones
+func Clear(mgr *manager.Manager, dbName string) (int, error) {
+	if err := Check(dbName); err != nil {
+		return 0, err
+	}
+	seedEmails := "@" + strings.Replace(EmailDomain, ".", `\.`, -1) + "$"
+	users, _, err := mgr.Users.FilterByQuery(bson.M{"email": bson.M{"$regex": seedEmails}})
+	if err != nil {
+		return 0, err
+	}
+	userIds := []bson.ObjectId{}
+	for _, u := range users {
+		userIds = append(userIds, u.Id)
+	}
+	projects, _, err := mgr.Projects.FilterByQuery(bson.M{"owner": bson.M{"$in": userIds}})
+	if err != nil {
+		return 0, err
+	}
+	projectIds := []bson.ObjectId{}
+	for _, p := range projects {
+		projectIds = append(projectIds, p.Id)
+	}
+	scans, _, err := mgr.Scans.FilterByQuery(bson.M{"project": bson.M{"$in": projectIds}})
+	if err != nil {
+		return 0, err
+	}
+	scanIds := []bson.ObjectId{}
+	for _, sc := range scans {
+		scanIds = append(scanIds, sc.Id)
+	}
+
+	inProjects := bson.M{"project": bson.M{"$in": projectIds}}
+	seedPlans := bson.M{"name": bson.M{"$regex": "^" + PlanPrefix}}
+	seedPlugins := bson.M{"name": bson.M{"$regex": "^" + PluginPrefix}}
+	removers := []func() (int, error){
+		func() (int, error) { return mgr.Reports.RemoveAll(bson.M{"scan": bson.M{"$in": scanIds}}) },
+		func() (int, error) { return mgr.Issues.RemoveAll(inProjects) },
+		func() (int, error) { return mgr.Techs.RemoveAll(inProjects) },
+		func() (int, error) { return mgr.Scans.RemoveAll(inProjects) },
+		func() (int, error) { return mgr.Targets.RemoveAll(inProjects) },
+		func() (int, error) { return mgr.Projects.RemoveAll(bson.M{"_id": bson.M{"$in": projectIds}}) },
+		func() (int, error) { return mgr.Users.RemoveAll(bson.M{"_id": bson.M{"$in": userIds}}) },
+		func() (int, error) { return mgr.Plans.RemoveAll(seedPlans) },
+		func() (int, error) { return mgr.Plugins.RemoveAll(seedPlugins) },
+	}
+	total := 0
+	for _, remove := range removers {
+		removed, err := remove()
+		if err != nil {
+			return total, err
+		}
+		total += removed
+	}
+	return total, nil
+}
+
+// vocabulary of fake data
+var (
+	firstNames = []string{"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi", "ivan", "judy"}
+	projects   = []string{"shop", "blog", "intranet", "billing", "mobile api", "landing", "crm", "wiki"}
+	domains    = []string{"shop", "blog", "admin", "api", "static", "mail", "portal", "dev", "staging", "beta"}
+	paths      = []string{"/", "/login", "/search", "/cart", "/admin/users", "/api/v1/items", "/profile/edit", "/upload"}
+	findings   = []struct {
+		Summary string
+		Class   issue.Class
+	}{
+		{"Reflected cross-site scripting in the query", issue.ClassXss},
+		{"Stored cross-site scripting in comments", issue.ClassXss},
+		{"Blind SQL injection", issue.ClassSqli},
+		{"Missing CSRF token", issue.ClassCsrf},
+		{"Directory traversal in download", issue.ClassPathTraversal},
+		{"Open redirect after login", issue.ClassOpenRedirect},
+		{"Server version disclosure", issue.ClassInfoLeak},
+		{"Directory listing is enabled", issue.ClassMisconfig},
+		{"Outdated jQuery version", issue.ClassOutdated},
+		{"Cookie without secure flag", issue.ClassMisconfig},
+	}
+	plugins = []*plugin.Plugin{
+		{Name: PluginPrefix + "wappalyzer", Version: "0.0.1", Type: plugin.Util, Weight: plugin.Light,
+			Desc: &plugin.Desc{Title: "Technologies detector"}},
+		{Name: PluginPrefix + "nikto", Version: "0.0.1", Type: plugin.Util, Weight: plugin.Middle,
+			Desc: &plugin.Desc{Title: "Web server scanner"}},
+		{Name: PluginPrefix + "w3af", Version: "0.0.1", Type: plugin.Script, Weight: plugin.Heavy,
+			Desc: &plugin.Desc{Title: "Web application attack framework"}},
+	}
+)
+
+type generator struct {
+	mgr    *manager.Manager
+	rnd    *rand.Rand
+	opts   Opts
+	result *Result
+
+	hash    string
+	plugins []*plugin.Plugin
+	plans   []*plan.Plan
+}
+
+func (g *generator) pick(list []string) string {
+	return list[g.rnd.Intn(len(list))]
+}
+
+func (g *generator) run() error {
+	if err := g.createPlugins(); err != nil {
+		return err
+	}
+	hash, err := passlib.NewContext().Encrypt(g.opts.Password)
+	if err != nil {
+		return err
+	}
+	g.hash = hash
+	for i := 0; i < g.opts.Users; i++ {
+		if err := g.createUser(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) createPlugins() error {
+	for _, src := range plugins {
+		pl := *src
+		pl.Container = &plugin.Container{Image: "bearded/" + strings.TrimPrefix(pl.Name, PluginPrefix)}
+		pl.TargetType = target.TypeWeb
+		pl.Enabled = true
+		created, err := g.mgr.Plugins.Create(&pl)
+		if err != nil {
+			return err
+		}
+		g.plugins = append(g.plugins, created)
+		g.result.Plugins++
+	}
+	// a quick plan with one plugin and a full plan with all of them
+	quick := &plan.Plan{Name: PlanPrefix + "quick", Desc: "Detect technologies", TargetType: target.TypeWeb,
+		Workflow: []*plan.WorkflowStep{{Plugin: g.plugins[0].Ref(), Name: "technologies"}}}
+	full := &plan.Plan{Name: PlanPrefix + "full", Desc: "Scan with all plugins", TargetType: target.TypeWeb}
+	for _, pl := range g.plugins {
+		full.Workflow = append(full.Workflow, &plan.WorkflowStep{Plugin: pl.Ref(), Name: pl.Desc.Title})
+	}
+	for _, pl := range []*plan.Plan{quick, full} {
+		created, err := g.mgr.Plans.Create(pl)
+		if err != nil {
+			return err
+		}
+		g.plans = append(g.plans, created)
+		g.result.Plans++
+	}
+	return nil
+}
+
+func (g *generator) createUser(n int) error {
+	name := firstNames[n%len(firstNames)]
+	if n >= len(firstNames) {
+		name = fmt.Sprintf("%s%d", name, n/len(firstNames))
+	}
+	u, err := g.mgr.Users.Create(&user.User{
+		Email:    fmt.Sprintf("%s@%s", name, EmailDomain),
+		Password: g.hash,
+	})
+	if err != nil {
+		return err
+	}
+	g.result.Users++
+	for i := 0; i < g.opts.Projects; i++ {
+		p, err := g.mgr.Projects.Create(&project.Project{
+			Name:  fmt.Sprintf("%s %d", g.pick(projects), i+1),
+			Owner: u.Id,
+		})
+		if err != nil {
+			return err
+		}
+		g.result.Projects++
+		for j := 0; j < g.opts.Targets; j++ {
+			if err := g.createTarget(u, p, j); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *generator) createTarget(u *user.User, p *project.Project, n int) error {
+	t, err := g.mgr.Targets.Create(&target.Target{
+		Type:    target.TypeWeb,
+		Project: p.Id,
+		Web:     &target.WebTarget{Domain: fmt.Sprintf("http://%s%d.example.com", g.pick(domains), n+1)},
+	})
+	if err != nil {
+		return err
+	}
+	g.result.Targets++
+
+	var last *scan.Scan
+	for i := 0; i < g.opts.Scans; i++ {
+		pl := g.plans[g.rnd.Intn(len(g.plans))]
+		sc := &scan.Scan{
+			Status:  scan.StatusFinished,
+			Conf:    scan.ScanConf{Target: t.Web.Domain},
+			Plan:    pl.Id,
+			Owner:   u.Id,
+			Target:  t.Id,
+			Project: p.Id,
+		}
+		for _, step := range pl.Workflow {
+			sc.Sessions = append(sc.Sessions, &scan.Session{
+				Id:     bson.NewObjectId(),
+				Status: scan.StatusFinished,
+				Step:   step,
+				Plugin: g.pluginOf(step).Id,
+			})
+		}
+		if last, err = g.mgr.Scans.Create(sc); err != nil {
+			return err
+		}
+		g.result.Scans++
+	}
+	if last == nil || g.opts.Issues == 0 {
+		return nil
+	}
+	return g.createIssues(t, last)
+}
+
+func (g *generator) pluginOf(step *plan.WorkflowStep) *plugin.Plugin {
+	for _, pl := range g.plugins {
+		if pl.Ref() == step.Plugin {
+			return pl
+		}
+	}
+	return g.plugins[0]
+}
+
+// issues are reported by the last session of the last scan
+func (g *generator) createIssues(t *target.Target, sc *scan.Scan) error {
+	sess := sc.Sessions[len(sc.Sessions)-1]
+	rep := &report.Report{Type: report.TypeIssues, Scan: sc.Id, ScanSession: sess.Id, Project: sc.Project}
+	for i := 0; i < g.opts.Issues; i++ {
+		finding := findings[g.rnd.Intn(len(findings))]
+		iss := &issue.Issue{
+			Summary:  finding.Summary,
+			Class:    finding.Class,
+			Severity: issue.Severities[g.rnd.Intn(len(issue.Severities))],
+			Vector:   &issue.Vector{Url: t.Web.Domain + g.pick(paths)},
+		}
+		iss.UniqId = iss.GenerateUniqId()
+		rep.Issues = append(rep.Issues, iss)
+	}
+	rep, err := g.mgr.Reports.Create(rep)
+	if err != nil {
+		return err
+	}
+	pluginRef := sess.Step.Plugin
+	for _, iss := range rep.Issues {
+		targetIssue := &issue.TargetIssue{Target: t.Id, Project: t.Project, Issue: *iss}
+		targetIssue.AddReportActivity(rep.Id, sc.Id, sess.Id, pluginRef)
+		if _, err := g.mgr.Issues.Create(targetIssue); err != nil {
+			// the same finding could be picked twice for the target
+			if g.mgr.IsDup(err) {
+				continue
+			}
+			return err
+		}
+		g.result.Issues++
+	}
+	return g.mgr.Targets.UpdateSummary(t)
+}
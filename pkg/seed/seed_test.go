@@ -0,0 +1,14 @@
+package seed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	require.NoError(t, Check("seed_bearded"))
+	require.NoError(t, Check("test_bearded"))
+	require.Error(t, Check("bearded"))
+	require.Error(t, Check("bearded_seed_"))
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// expired keys are removed not more often than this
+const memoryCleanupInterval = time.Minute
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// Memory store is local for the process
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	cleaned time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]*entry{}}
+}
+
+func (s *Memory) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || e.expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return e.value, nil
+}
+
+func (s *Memory) Set(key string, value []byte, ttl time.Duration) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cleanup(now)
+	e := &entry{value: value}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	s.entries[key] = e
+	return nil
+}
+
+func (s *Memory) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cleanup(now)
+	if e, ok := s.entries[key]; ok && !e.expired(now) {
+		return false, nil
+	}
+	e := &entry{value: value}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	s.entries[key] = e
+	return true, nil
+}
+
+func (s *Memory) Incr(key string, ttl time.Duration) (int64, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cleanup(now)
+	e, ok := s.entries[key]
+	if !ok || e.expired(now) {
+		e = &entry{}
+		if ttl > 0 {
+			e.expires = now.Add(ttl)
+		}
+		s.entries[key] = e
+	}
+	value, _ := strconv.ParseInt(string(e.value), 10, 64)
+	value++
+	e.value = []byte(strconv.FormatInt(value, 10))
+	return value, nil
+}
+
+func (s *Memory) Delete(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// remove expired entries, so the store doesn't grow forever
+func (s *Memory) cleanup(now time.Time) {
+	if now.Sub(s.cleaned) < memoryCleanupInterval {
+		return
+	}
+	s.cleaned = now
+	for k, e := range s.entries {
+		if e.expired(now) {
+			delete(s.entries, k)
+		}
+	}
+}
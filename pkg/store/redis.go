@@ -0,0 +1,45 @@
+package store
+
+import (
+	"time"
+
+	"github.com/bearded-web/bearded/pkg/redis"
+)
+
+// Redis store is shared between dispatchers, keys are prefixed, so the database could be shared too
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+func (s *Redis) Get(key string) ([]byte, error) {
+	value, err := s.client.Get(s.prefix + key)
+	if err == redis.ErrNil {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (s *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(s.prefix+key, value, ttl)
+}
+
+func (s *Redis) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(s.prefix+key, value, ttl)
+}
+
+func (s *Redis) Incr(key string, ttl time.Duration) (int64, error) {
+	return s.client.Incr(s.prefix+key, ttl)
+}
+
+func (s *Redis) Delete(keys ...string) error {
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, s.prefix+key)
+	}
+	return s.client.Del(prefixed...)
+}
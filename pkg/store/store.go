@@ -0,0 +1,125 @@
+package store
+
+// Store keeps short-lived shared state, like caches and rate limit counters.
+// Redis is used when several dispatchers run together, otherwise memory is enough.
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/redis"
+)
+
+// returned by Get when the key doesn't exist or is expired
+var ErrNotFound = errors.New("store: key not found")
+
+type Store interface {
+	Get(key string) ([]byte, error)
+	// zero ttl means the key doesn't expire
+	Set(key string, value []byte, ttl time.Duration) error
+	// set the value only if the key doesn't exist, returns false if it exists, e.g. to take a lock
+	SetNX(key string, value []byte, ttl time.Duration) (bool, error)
+	// increment the counter, ttl is set when the counter is created
+	Incr(key string, ttl time.Duration) (int64, error)
+	Delete(keys ...string) error
+}
+
+// New returns redis store if the address is set, memory store otherwise.
+// Memory is used also when redis is unreachable, so the dispatcher keeps working with its own state.
+func New(cfg config.Redis) Store {
+	mem := NewMemory()
+	if cfg.Addr == "" {
+		return mem
+	}
+	client := redis.New(redis.Opts{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		Database: cfg.Database,
+		Timeout:  time.Duration(cfg.Timeout) * time.Millisecond,
+		PoolSize: cfg.PoolSize,
+	})
+	if err := client.Ping(); err != nil {
+		logrus.Warnf("Redis %s is unreachable, memory is used until it's back: %v", cfg.Addr, err)
+	} else {
+		logrus.Infof("Redis %s is used for shared state", cfg.Addr)
+	}
+	return NewFallback(NewRedis(client, cfg.Prefix), mem)
+}
+
+// Fallback uses the secondary store while the primary one returns errors
+type Fallback struct {
+	primary   Store
+	secondary Store
+
+	mu     sync.Mutex
+	warned time.Time
+}
+
+// warnings about the primary store aren't logged more often than this
+const fallbackWarnInterval = time.Minute
+
+func NewFallback(primary, secondary Store) *Fallback {
+	return &Fallback{primary: primary, secondary: secondary}
+}
+
+func (s *Fallback) Get(key string) ([]byte, error) {
+	value, err := s.primary.Get(key)
+	if err == nil || err == ErrNotFound {
+		return value, err
+	}
+	s.warn(err)
+	return s.secondary.Get(key)
+}
+
+func (s *Fallback) Set(key string, value []byte, ttl time.Duration) error {
+	if err := s.primary.Set(key, value, ttl); err != nil {
+		s.warn(err)
+		return s.secondary.Set(key, value, ttl)
+	}
+	return nil
+}
+
+func (s *Fallback) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	ok, err := s.primary.SetNX(key, value, ttl)
+	if err != nil {
+		s.warn(err)
+		return s.secondary.SetNX(key, value, ttl)
+	}
+	return ok, nil
+}
+
+func (s *Fallback) Incr(key string, ttl time.Duration) (int64, error) {
+	value, err := s.primary.Incr(key, ttl)
+	if err != nil {
+		s.warn(err)
+		return s.secondary.Incr(key, ttl)
+	}
+	return value, nil
+}
+
+func (s *Fallback) Delete(keys ...string) error {
+	// keys could be set in the secondary store while the primary one was unavailable
+	err := s.primary.Delete(keys...)
+	if sErr := s.secondary.Delete(keys...); err == nil {
+		err = sErr
+	}
+	if err != nil {
+		s.warn(err)
+	}
+	return nil
+}
+
+func (s *Fallback) warn(err error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.warned) < fallbackWarnInterval {
+		return
+	}
+	s.warned = now
+	logrus.Warnf("Store error, memory is used instead: %v", err)
+}
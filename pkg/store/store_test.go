@@ -0,0 +1,83 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory(t *testing.T) {
+	s := NewMemory()
+
+	_, err := s.Get("key")
+	require.Equal(t, ErrNotFound, err)
+
+	require.NoError(t, s.Set("key", []byte("value"), 0))
+	value, err := s.Get("key")
+	require.NoError(t, err)
+	require.Equal(t, "value", string(value))
+
+	require.NoError(t, s.Set("expired", []byte("value"), time.Millisecond))
+	time.Sleep(time.Millisecond * 2)
+	_, err = s.Get("expired")
+	require.Equal(t, ErrNotFound, err)
+
+	for i := 1; i <= 3; i++ {
+		n, err := s.Incr("counter", time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, int64(i), n)
+	}
+
+	require.NoError(t, s.Delete("key", "counter"))
+	_, err = s.Get("key")
+	require.Equal(t, ErrNotFound, err)
+	n, _ := s.Incr("counter", time.Minute)
+	require.Equal(t, int64(1), n)
+
+	ok, err := s.SetNX("lock", []byte("first"), time.Millisecond*10)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = s.SetNX("lock", []byte("second"), time.Millisecond*10)
+	require.NoError(t, err)
+	require.False(t, ok)
+	value, _ = s.Get("lock")
+	require.Equal(t, "first", string(value))
+	// the lock is taken again when it's expired
+	time.Sleep(time.Millisecond * 20)
+	ok, _ = s.SetNX("lock", []byte("second"), time.Minute)
+	require.True(t, ok)
+}
+
+type brokenStore struct{}
+
+var errBroken = errors.New("broken")
+
+func (brokenStore) Get(string) ([]byte, error)                { return nil, errBroken }
+func (brokenStore) Set(string, []byte, time.Duration) error   { return errBroken }
+func (brokenStore) Incr(string, time.Duration) (int64, error) { return 0, errBroken }
+func (brokenStore) Delete(...string) error                    { return errBroken }
+
+func (brokenStore) SetNX(string, []byte, time.Duration) (bool, error) { return false, errBroken }
+
+func TestFallback(t *testing.T) {
+	s := NewFallback(brokenStore{}, NewMemory())
+
+	require.NoError(t, s.Set("key", []byte("value"), time.Minute))
+	value, err := s.Get("key")
+	require.NoError(t, err)
+	require.Equal(t, "value", string(value))
+
+	n, err := s.Incr("counter", time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	ok, err := s.SetNX("lock", []byte("value"), time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, s.Delete("key"))
+	_, err = s.Get("key")
+	require.Equal(t, ErrNotFound, err)
+}
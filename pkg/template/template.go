@@ -6,16 +6,22 @@ package template
 import (
 	"bytes"
 	"fmt"
+	"html"
 	"html/template"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 )
 
+var localeRe = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
 type Renderer interface {
 	Render(wr io.Writer, name string, binding interface{}, opts ...RenderOptions) error
+	Text(name string, binding interface{}, locale string) (string, error)
 }
 
 // Included helper functions for use when rendering HTML.
@@ -26,6 +32,21 @@ var helperFuncs = template.FuncMap{
 	"current": func() (string, error) {
 		return "", nil
 	},
+	"inZone": func(t time.Time, timezone string) string {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		return FormatTime(t, loc)
+	},
+}
+
+// TimeLayout is used for times in emails, api responses are always in UTC
+const TimeLayout = "2006-01-02 15:04 MST"
+
+// FormatTime formats the time for humans in the timezone of the reader
+func FormatTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(TimeLayout)
 }
 
 // Delims represents a set of Left and Right delimiters for HTML template rendering.
@@ -54,12 +75,19 @@ type Opts struct {
 
 	// reload templates automatically
 	ReloadTemplates bool
+
+	// Locale used if templates of the requested locale aren't found, e.g. "en".
+	// Localized templates are kept in locale directories, like ru/email/reset-password.html,
+	// templates in the root of the directory are used if there is no localized one.
+	DefaultLocale string
 }
 
 // RenderOptions is a struct for overriding some rendering Options for specific Render call.
 type RenderOptions struct {
 	// Layout template name. Overrides Options.Layout.
 	Layout string
+	// Locale of templates, e.g. "pt-br", the language "pt" and the default locale are tried next.
+	Locale string
 }
 
 type Template struct {
@@ -178,15 +206,79 @@ func (t *Template) Render(wr io.Writer, name string, binding interface{}, opts .
 	}
 
 	opt := t.prepareRenderOptions(opts)
+	name = t.Localized(name, opt.Locale)
 
 	// Assign a layout if there is one.
 	if len(opt.Layout) > 0 {
 		t.addYield(name, binding)
-		name = opt.Layout
+		name = t.Localized(opt.Layout, opt.Locale)
 	}
 	return t.templates.ExecuteTemplate(wr, name, binding)
 }
 
+// Text renders the localized template without the layout as plain text, like email subjects.
+// Templates are html, so the result is unescaped and trimmed.
+func (t *Template) Text(name string, binding interface{}, locale string) (string, error) {
+	if t.opt.ReloadTemplates {
+		t.compileTemplates()
+	}
+	buf, err := t.execute(t.Localized(name, locale), binding)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(html.UnescapeString(buf.String())), nil
+}
+
+// Localized returns the name of the template for the locale,
+// the name is returned as is if there are no localized templates
+func (t *Template) Localized(name, locale string) string {
+	for _, l := range Fallbacks(locale, t.opt.DefaultLocale) {
+		localized := l + "/" + name
+		if t.templates.Lookup(localized) != nil {
+			return localized
+		}
+	}
+	return name
+}
+
+// Has returns true if the template is compiled for the default locale or without locale
+func (t *Template) Has(name string) bool {
+	return t.templates.Lookup(t.Localized(name, t.opt.DefaultLocale)) != nil
+}
+
+// Fallbacks returns locales in the lookup order: the locale, its language and the default locale
+func Fallbacks(locale, defaultLocale string) []string {
+	result := []string{}
+	add := func(l string) {
+		if l == "" {
+			return
+		}
+		for _, v := range result {
+			if v == l {
+				return
+			}
+		}
+		result = append(result, l)
+	}
+	locale = NormalizeLocale(locale)
+	add(locale)
+	if i := strings.Index(locale, "-"); i > 0 {
+		add(locale[:i])
+	}
+	add(NormalizeLocale(defaultLocale))
+	return result
+}
+
+// NormalizeLocale brings locales like pt_BR to the form of template directories, pt-br
+func NormalizeLocale(locale string) string {
+	return strings.Replace(strings.ToLower(strings.TrimSpace(locale)), "_", "-", -1)
+}
+
+// IsLocale checks the locale is a language code with an optional region, like en or pt-br
+func IsLocale(locale string) bool {
+	return localeRe.MatchString(NormalizeLocale(locale))
+}
+
 func (t *Template) execute(name string, binding interface{}) (*bytes.Buffer, error) {
 	buf := new(bytes.Buffer)
 	return buf, t.templates.ExecuteTemplate(buf, name, binding)
@@ -208,7 +300,12 @@ func (t *Template) addYield(name string, binding interface{}) {
 
 func (t *Template) prepareRenderOptions(htmlOpt []RenderOptions) RenderOptions {
 	if len(htmlOpt) > 0 {
-		return htmlOpt[0]
+		opt := htmlOpt[0]
+		// options without the layout keep the default one
+		if opt.Layout == "" {
+			opt.Layout = t.opt.Layout
+		}
+		return opt
 	}
 
 	return RenderOptions{
@@ -6,6 +6,7 @@ import (
 
 	"fmt"
 	"html/template"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -154,3 +155,91 @@ func TestRenderFromAsset(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "head\n<h1>gophers</h1>\n\nfoot\n", buf.String())
 }
+
+func TestRenderLocale(t *testing.T) {
+	render := New(&Opts{
+		Directory:  "testdata/locale",
+		Extensions: []string{".tmpl"},
+	})
+
+	for locale, expected := range map[string]string{
+		"":      "<h1>Hello gophers</h1>\n",
+		"ru":    "<h1>Привет gophers</h1>\n",
+		"pt_BR": "<h1>Olá gophers</h1>\n",
+		"de":    "<h1>Hello gophers</h1>\n",
+	} {
+		buf := bytes.NewBuffer(nil)
+		err := render.Render(buf, "hello", "gophers", RenderOptions{Locale: locale})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, buf.String(), locale)
+	}
+
+	render = New(&Opts{
+		Directory:     "testdata/locale",
+		Extensions:    []string{".tmpl"},
+		Layout:        "layout",
+		DefaultLocale: "pt",
+	})
+	buf := bytes.NewBuffer(nil)
+	err := render.Render(buf, "hello", "gophers", RenderOptions{Locale: "ru"})
+	assert.NoError(t, err)
+	assert.Equal(t, "шапка\n<h1>Привет gophers</h1>\n\nподвал\n", buf.String())
+
+	buf = bytes.NewBuffer(nil)
+	err = render.Render(buf, "hello", "gophers", RenderOptions{Locale: "de"})
+	assert.NoError(t, err)
+	assert.Equal(t, "head\n<h1>Olá gophers</h1>\n\nfoot\n", buf.String())
+
+	// the layout is applied without the locale too
+	buf = bytes.NewBuffer(nil)
+	err = render.Render(buf, "hello", "gophers", RenderOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "head\n<h1>Olá gophers</h1>\n\nfoot\n", buf.String())
+
+	// plain text is rendered without the layout and unescaped
+	text, err := render.Text("hello", "<gophers>", "ru")
+	assert.NoError(t, err)
+	assert.Equal(t, "<h1>Привет <gophers></h1>", text)
+	_, err = render.Text("unknown", nil, "ru")
+	assert.Error(t, err)
+}
+
+func TestLocale(t *testing.T) {
+	assert.Equal(t, []string{"pt-br", "pt", "en"}, Fallbacks("pt_BR", "en"))
+	assert.Equal(t, []string{"en"}, Fallbacks("", "en"))
+	assert.Equal(t, []string{"en"}, Fallbacks("en", "en"))
+	assert.True(t, IsLocale("ru"))
+	assert.True(t, IsLocale("pt_BR"))
+	assert.False(t, IsLocale("russian"))
+	assert.False(t, IsLocale("../en"))
+}
+
+func TestRenderInZone(t *testing.T) {
+	render := New(&Opts{
+		Directory:  "testdata/basic",
+		Extensions: []string{".tmpl"},
+	})
+	moment := time.Date(2015, 3, 29, 1, 30, 0, 0, time.UTC)
+	for zone, expected := range map[string]string{
+		"Europe/Berlin": "2015-03-29 03:30 CEST\n",
+		"":              "2015-03-29 01:30 UTC\n",
+		"Wrong/Zone":    "2015-03-29 01:30 UTC\n",
+	} {
+		buf := bytes.NewBuffer(nil)
+		err := render.Render(buf, "zone", map[string]interface{}{"Time": moment, "Zone": zone})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, buf.String(), zone)
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	vars := struct{ Target, Parameter string }{"example.com", "q"}
+	text, err := RenderText("remediation", "Encode <{{.Parameter}}> on {{.Target}}", vars)
+	assert.Nil(t, err)
+	assert.Equal(t, "Encode <q> on example.com", text)
+
+	_, err = RenderText("remediation", "{{.Unknown}}", vars)
+	assert.NotNil(t, err)
+	_, err = RenderText("remediation", "{{.Target", vars)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,20 @@
+package template
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// RenderText renders the template from the string, like remediation guidance stored in the db.
+// Text templates don't escape html, the result is markdown which is escaped where it's shown.
+func RenderText(name, text string, binding interface{}) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := tmpl.Execute(buf, binding); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+
+	"github.com/bearded-web/bearded/pkg/utils"
+)
+
+// Address of an already running mongo for integration tests, e.g. mongodb://localhost:27017
+const MongoEnv = "BEARDED_TEST_MONGO"
+
+// Image of the mongo container which is started if mongod isn't installed
+const MongoImage = "mongo:3.0"
+
+// ErrNoMongo is returned if there is no way to run mongo, integration tests should be skipped
+var ErrNoMongo = errors.New("mongo isn't available: set " + MongoEnv + ", install mongod or docker")
+
+// time for mongod or the container to start accepting connections
+const mongoStartTimeout = time.Second * 30
+
+// Mongo is an ephemeral mongo server for integration tests, data is removed when the server is stopped
+type Mongo struct {
+	// mongodb address without database, e.g. mongodb://127.0.0.1:41234
+	Addr string
+
+	stop func()
+}
+
+// Start an ephemeral mongo. The server from MongoEnv is used if it's set,
+// otherwise mongod is started on a free port with a temporary db path,
+// otherwise a docker container is run. ErrNoMongo is returned if nothing is available.
+func StartMongo() (*Mongo, error) {
+	if addr := os.Getenv(MongoEnv); addr != "" {
+		return &Mongo{Addr: addr, stop: func() {}}, nil
+	}
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	m := &Mongo{Addr: fmt.Sprintf("mongodb://127.0.0.1:%d", port)}
+	if path, err := exec.LookPath("mongod"); err == nil {
+		if m.stop, err = startMongod(path, port); err != nil {
+			return nil, err
+		}
+	} else if path, err := exec.LookPath("docker"); err == nil {
+		if m.stop, err = startContainer(path, port); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, ErrNoMongo
+	}
+	if err := m.wait(); err != nil {
+		m.Stop()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Create db with randomly generated name: the same as RandomTestMongoUp, but on the ephemeral server
+func (m *Mongo) RandomDb() (*mgo.Session, string, error) {
+	dbName := fmt.Sprintf("%s%s", TestDbPrefix, utils.UuidV4String())
+	session, err := PrepareTestDb(fmt.Sprintf("%s/%s", m.Addr, dbName))
+	return session, dbName, err
+}
+
+// Stop the server and remove its data, the server from MongoEnv isn't touched
+func (m *Mongo) Stop() {
+	m.stop()
+}
+
+func (m *Mongo) wait() error {
+	deadline := time.Now().Add(mongoStartTimeout)
+	for {
+		session, err := mgo.DialWithTimeout(m.Addr, time.Second)
+		if err == nil {
+			session.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("mongo on %s isn't started: %s", m.Addr, err)
+		}
+		time.Sleep(time.Millisecond * 200)
+	}
+}
+
+func startMongod(path string, port int) (func(), error) {
+	dir, err := ioutil.TempDir("", "bearded-mongo")
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(path,
+		"--port", fmt.Sprintf("%d", port),
+		"--bind_ip", "127.0.0.1",
+		"--dbpath", dir,
+		"--nojournal",
+		"--quiet")
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("can't start mongod: %s", err)
+	}
+	return func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(dir)
+	}, nil
+}
+
+func startContainer(path string, port int) (func(), error) {
+	out, err := exec.Command(path, "run", "-d",
+		"-p", fmt.Sprintf("127.0.0.1:%d:27017", port),
+		MongoImage, "--nojournal").Output()
+	if err != nil {
+		return nil, fmt.Errorf("can't run mongo container: %s", err)
+	}
+	id := strings.TrimSpace(string(out))
+	return func() {
+		exec.Command(path, "rm", "-f", "-v", id).Run()
+	}, nil
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,117 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"mime"
+	"sync"
+)
+
+// images with more pixels aren't decoded, so a small file can't take all memory
+const MaxPixels = 50 * 1000 * 1000
+
+var ErrTooLarge = errors.New("image is too large for the thumbnail")
+
+// IsImage returns true if thumbnails could be made for the content type
+func IsImage(contentType string) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Make decodes png, jpeg or gif image and scales it down to fit the size, the thumbnail is png.
+// Images which are smaller than the size aren't scaled up.
+func Make(data []byte, size int) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, scale(src, size)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scale the image with averaging of source pixels which are covered by every thumbnail pixel
+func scale(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	tw, th := size, size
+	if w > h {
+		th = h * size / w
+	} else {
+		tw = w * size / h
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+var (
+	iconOnce sync.Once
+	icon     []byte
+)
+
+// Icon returns the generic png icon for files which aren't images
+func Icon() []byte {
+	iconOnce.Do(func() {
+		const size = 64
+		img := image.NewRGBA(image.Rect(0, 0, size, size))
+		// a grey page with a folded corner and text lines
+		page := image.Rect(12, 4, 52, 60)
+		draw.Draw(img, page, &image.Uniform{color.RGBA{0xe0, 0xe0, 0xe0, 0xff}}, image.ZP, draw.Src)
+		for i := 0; i < 12; i++ {
+			draw.Draw(img, image.Rect(52-12+i, 4, 52, 4+i+1), image.Transparent, image.ZP, draw.Src)
+		}
+		line := &image.Uniform{color.RGBA{0x9e, 0x9e, 0x9e, 0xff}}
+		for y := 24; y < 56; y += 8 {
+			draw.Draw(img, image.Rect(18, y, 46, y+2), line, image.ZP, draw.Src)
+		}
+		buf := &bytes.Buffer{}
+		png.Encode(buf, img)
+		icon = buf.Bytes()
+	})
+	return icon
+}
@@ -0,0 +1,55 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsImage(t *testing.T) {
+	assert.True(t, IsImage("image/png"))
+	assert.True(t, IsImage("image/jpeg; charset=binary"))
+	assert.False(t, IsImage("image/svg+xml"))
+	assert.False(t, IsImage("application/json"))
+}
+
+func TestMake(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	for x := 0; x < 400; x++ {
+		for y := 0; y < 100; y++ {
+			src.Set(x, y, color.RGBA{0xff, 0, 0, 0xff})
+		}
+	}
+	buf := &bytes.Buffer{}
+	require.NoError(t, jpeg.Encode(buf, src, nil))
+
+	data, err := Make(buf.Bytes(), 100)
+	require.NoError(t, err)
+	thumb, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 100, 25), thumb.Bounds())
+	r, _, _, _ := thumb.At(50, 10).RGBA()
+	assert.True(t, r > 0xf000, "color is kept")
+
+	// small images aren't scaled up
+	data, err = Make(buf.Bytes(), 1000)
+	require.NoError(t, err)
+	thumb, err = png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 400, 100), thumb.Bounds())
+
+	_, err = Make([]byte("not an image"), 100)
+	assert.Error(t, err)
+}
+
+func TestIcon(t *testing.T) {
+	img, err := png.Decode(bytes.NewReader(Icon()))
+	require.NoError(t, err)
+	assert.Equal(t, 64, img.Bounds().Dx())
+}
@@ -0,0 +1,28 @@
+package websocket
+
+import (
+	"github.com/bearded-web/bearded/pkg/transport"
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/context"
+)
+
+type conn struct {
+	ws *websocket.Conn
+}
+
+// NewConn returns the transport over the established connection, e.g. upgraded by an api handler.
+// Serve returns when the connection is lost, the caller closes the connection.
+func NewConn(ws *websocket.Conn) transport.Transport {
+	return transport.NewLoopTransport(&conn{ws: ws})
+}
+
+func (c *conn) Loop(ctx context.Context,
+	in chan<- *transport.Message, out <-chan *transport.Message) <-chan error {
+	ch := make(chan error, 1)
+
+	go func(ch chan<- error) {
+		defer close(ch)
+		handleConnection(ctx, c.ws, in, out)
+	}(ch)
+	return ch
+}
@@ -0,0 +1,75 @@
+package async
+
+import (
+	"runtime"
+
+	"golang.org/x/net/context"
+)
+
+// Pool limits the number of goroutines of parallel work, like bulk scans.
+// The pool is shared by callers, so the limit is global. Functions which run in the pool
+// shouldn't wait for other work in the same pool, otherwise they could wait forever.
+type Pool struct {
+	slots chan struct{}
+}
+
+// NewPool creates the pool with the size, the number of cpus is used if the size isn't positive
+func NewPool(size int) *Pool {
+	if size <= 0 {
+		size = runtime.NumCPU()
+	}
+	return &Pool{slots: make(chan struct{}, size)}
+}
+
+func (p *Pool) Size() int {
+	return cap(p.slots)
+}
+
+// Go blocks until a slot is free and runs the function in the goroutine.
+// The async returns the context error without running the function if the context is done earlier.
+func (p *Pool) Go(parent context.Context, f func(ctx context.Context) error) Async {
+	ctx, cancel := context.WithCancel(parent)
+	if err := p.acquire(ctx); err != nil {
+		cancel()
+		ch := make(chan error, 1)
+		ch <- err
+		return &asyncImpl{promise: ch, cancel: cancel}
+	}
+	return &asyncImpl{
+		promise: Promise(func() error {
+			defer p.release()
+			defer cancel()
+			return f(ctx)
+		}),
+		cancel: cancel,
+	}
+}
+
+// Map calls the function for every index from 0 to n in the pool and waits for all calls.
+// Errors are returned as GroupError, indexes which aren't started because of the done context get its error.
+func (p *Pool) Map(ctx context.Context, n int, f func(ctx context.Context, i int) error) error {
+	asyncs := make([]Async, 0, n)
+	for i := 0; i < n; i++ {
+		i := i
+		asyncs = append(asyncs, p.Go(ctx, func(ctx context.Context) error {
+			return f(ctx, i)
+		}))
+	}
+	return <-All(asyncs...).Result()
+}
+
+func (p *Pool) acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) release() {
+	<-p.slots
+}
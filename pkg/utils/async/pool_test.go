@@ -0,0 +1,84 @@
+package async
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestPoolMap(t *testing.T) {
+	p := NewPool(3)
+	require.Equal(t, 3, p.Size())
+
+	var mu sync.Mutex
+	running, max := 0, 0
+	done := make([]bool, 20)
+	err := p.Map(context.Background(), len(done), func(ctx context.Context, i int) error {
+		mu.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond * 5)
+		mu.Lock()
+		running--
+		done[i] = true
+		mu.Unlock()
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, max)
+	for i, ok := range done {
+		assert.True(t, ok, "index %d", i)
+	}
+}
+
+func TestPoolMapErrors(t *testing.T) {
+	p := NewPool(2)
+	err := p.Map(context.Background(), 5, func(ctx context.Context, i int) error {
+		if i%2 == 1 {
+			return errors.New("odd")
+		}
+		return nil
+	})
+	require.IsType(t, &GroupError{}, err)
+	assert.Len(t, err.(*GroupError).Errs, 2)
+
+	// nothing is started after the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	err = p.Map(ctx, 3, func(ctx context.Context, i int) error {
+		calls++
+		return nil
+	})
+	require.IsType(t, &GroupError{}, err)
+	assert.Len(t, err.(*GroupError).Errs, 3)
+	assert.Equal(t, 0, calls)
+}
+
+func TestPoolGoWaitsForSlot(t *testing.T) {
+	p := NewPool(1)
+	release := make(chan struct{})
+	first := p.Go(context.Background(), func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	second := p.Go(ctx, func(ctx context.Context) error {
+		return nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, <-second.Result())
+
+	close(release)
+	assert.NoError(t, <-first.Result())
+	assert.NoError(t, <-p.Go(context.Background(), func(ctx context.Context) error { return nil }).Result())
+}
@@ -7,3 +7,7 @@ func BoolP(v bool) *bool {
 func StringP(s string) *string {
 	return &s
 }
+
+func IntP(v int) *int {
+	return &v
+}
@@ -0,0 +1,20 @@
+package validate
+
+// CommonPasswords are the most used passwords from public leaks, they are blocked by default.
+// Only passwords which satisfy the default length are listed.
+var CommonPasswords = []string{
+	"1234567", "12345678", "123456789", "1234567890", "0123456789",
+	"7777777", "1111111", "11111111", "00000000", "87654321", "88888888",
+	"12341234", "11223344", "123123123", "112233445566", "123qweasd",
+	"password", "password1", "password123", "passw0rd", "p@ssw0rd", "p@ssword",
+	"qwertyu", "qwertyui", "qwertyuiop", "qwerty123", "1q2w3e4r", "1q2w3e4r5t",
+	"1qaz2wsx", "zaq12wsx", "q1w2e3r4", "q1w2e3r4t5", "asdfghjkl", "zxcvbnm",
+	"abc12345", "abcd1234", "abcdefg", "abcdefgh", "aa123456", "a1234567",
+	"iloveyou", "iloveyou1", "sunshine", "princess", "football", "baseball",
+	"welcome", "welcome1", "letmein1", "trustno1", "whatever", "starwars",
+	"superman", "batman123", "michael1", "jennifer", "jordan23", "computer",
+	"internet", "monkey123", "dragon123", "master123", "shadow123", "freedom",
+	"charlie1", "liverpool", "chelsea1", "arsenal1", "mustang1", "changeme",
+	"administrator", "admin123", "admin1234", "root1234", "secret123",
+	"loveme1", "lovely1", "babygirl", "butterfly", "pokemon1", "samsung1",
+}
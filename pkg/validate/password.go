@@ -1,19 +1,130 @@
 package validate
 
-import "fmt"
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
 
 const (
 	PasswordMinLength = 7
 	PasswordMaxLength = 100
 )
 
-func Password(password string) (bool, string) {
-	// TODO (m0sth8): check for weak password
-	if len(password) < PasswordMinLength {
-		return false, fmt.Sprintf("length must be more then %d symbols", PasswordMinLength)
+// PasswordPolicy describes requirements for new passwords
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+
+	RequireLower   bool
+	RequireUpper   bool
+	RequireDigit   bool
+	RequireSpecial bool
+
+	// lowercased passwords which are too common to be used
+	Blocklist map[string]struct{}
+}
+
+// NewPasswordPolicy returns policy with default length limits and the builtin blocklist
+func NewPasswordPolicy() *PasswordPolicy {
+	p := &PasswordPolicy{
+		MinLength: PasswordMinLength,
+		MaxLength: PasswordMaxLength,
+		Blocklist: map[string]struct{}{},
 	}
-	if len(password) > PasswordMaxLength {
-		return false, fmt.Sprintf("length must be less then %d symbols", PasswordMaxLength)
+	p.Block(CommonPasswords...)
+	return p
+}
+
+var DefaultPasswordPolicy = NewPasswordPolicy()
+
+// Block adds passwords to the blocklist
+func (p *PasswordPolicy) Block(passwords ...string) {
+	if p.Blocklist == nil {
+		p.Blocklist = map[string]struct{}{}
+	}
+	for _, password := range passwords {
+		if password = strings.TrimSpace(password); password != "" {
+			p.Blocklist[strings.ToLower(password)] = struct{}{}
+		}
+	}
+}
+
+// LoadBlocklist adds passwords from the file to the blocklist, one password per line
+func (p *PasswordPolicy) LoadBlocklist(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		p.Block(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Check the policy itself, so misconfiguration is found on start
+func (p *PasswordPolicy) Validate() error {
+	if p.MinLength < 1 {
+		return fmt.Errorf("min length must be positive, got %d", p.MinLength)
+	}
+	if p.MaxLength < p.MinLength {
+		return fmt.Errorf("max length %d is less than min length %d", p.MaxLength, p.MinLength)
+	}
+	return nil
+}
+
+// Check returns all reasons why the password doesn't satisfy the policy, nil if the password is good
+func (p *PasswordPolicy) Check(password string) []string {
+	reasons := []string{}
+	length := len([]rune(password))
+	if length < p.MinLength {
+		reasons = append(reasons, fmt.Sprintf("length must be at least %d symbols", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		reasons = append(reasons, fmt.Sprintf("length must be at most %d symbols", p.MaxLength))
+	}
+	var lower, upper, digit, special bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			special = true
+		}
+	}
+	if p.RequireLower && !lower {
+		reasons = append(reasons, "must contain a lowercase letter")
+	}
+	if p.RequireUpper && !upper {
+		reasons = append(reasons, "must contain an uppercase letter")
+	}
+	if p.RequireDigit && !digit {
+		reasons = append(reasons, "must contain a digit")
+	}
+	if p.RequireSpecial && !special {
+		reasons = append(reasons, "must contain a special symbol")
+	}
+	if _, blocked := p.Blocklist[strings.ToLower(password)]; blocked {
+		reasons = append(reasons, "is too common")
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	return reasons
+}
+
+// Password checks the password with the default policy and returns the first reason
+func Password(password string) (bool, string) {
+	if reasons := DefaultPasswordPolicy.Check(password); len(reasons) > 0 {
+		return false, reasons[0]
 	}
 	return true, ""
 }
@@ -0,0 +1,38 @@
+package validate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	p := NewPasswordPolicy()
+	assert.Nil(t, p.Check("correct horse"))
+	assert.Equal(t, []string{"length must be at least 7 symbols"}, p.Check("short"))
+	assert.Equal(t, []string{"is too common"}, p.Check("PassWord1"))
+
+	p.RequireUpper = true
+	p.RequireDigit = true
+	p.RequireSpecial = true
+	assert.Equal(t, []string{
+		"must contain an uppercase letter",
+		"must contain a digit",
+		"must contain a special symbol",
+	}, p.Check("lowercase"))
+	assert.Nil(t, p.Check("Lower-case1"))
+
+	p.Block("Lower-case1")
+	assert.Equal(t, []string{"is too common"}, p.Check("lower-CASE1"))
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	p := NewPasswordPolicy()
+	require.NoError(t, p.Validate())
+	p.MinLength = 0
+	assert.Error(t, p.Validate())
+	p.MinLength = 10
+	p.MaxLength = 8
+	assert.Error(t, p.Validate())
+}
@@ -0,0 +1,40 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Build information is injected with ldflags by make build
+var (
+	Version = "0.0.1"
+	Commit  = ""
+	Date    = ""
+)
+
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit" description:"git commit of the build, empty if it's unknown"`
+	Date    string `json:"date" description:"build date, empty if it's unknown"`
+	Go      string `json:"go" description:"go version of the build"`
+}
+
+func Get() *Info {
+	return &Info{
+		Version: Version,
+		Commit:  Commit,
+		Date:    Date,
+		Go:      runtime.Version(),
+	}
+}
+
+func (i *Info) String() string {
+	str := i.Version
+	if i.Commit != "" {
+		str = fmt.Sprintf("%s (%s)", str, i.Commit)
+	}
+	if i.Date != "" {
+		str = fmt.Sprintf("%s built at %s", str, i.Date)
+	}
+	return fmt.Sprintf("%s %s", str, i.Go)
+}
@@ -0,0 +1,14 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestString(t *testing.T) {
+	i := &Info{Version: "0.1.0", Go: "go1.4"}
+	require.Equal(t, "0.1.0 go1.4", i.String())
+	i.Commit, i.Date = "1c5e793", "2015-06-01"
+	require.Equal(t, "0.1.0 (1c5e793) built at 2015-06-01 go1.4", i.String())
+}
@@ -0,0 +1,179 @@
+// Package webhook signs deliveries of bearded webhooks and verifies them on the receiver side.
+//
+// The signature is the hex hmac-sha256 of "<timestamp>.<nonce>.<body>" with the webhook secret,
+// it's sent in the X-Bearded-Signature header as "sha256=<hex>" with the unix timestamp and the nonce
+// in X-Bearded-Timestamp and X-Bearded-Nonce. Receivers reject deliveries which are older than the window,
+// so captured requests can't be replayed later, and could reject already seen nonces within the window.
+//
+// A receiver in Go:
+//
+//	v := webhook.NewVerifier(secret, 5*time.Minute)
+//	v.Nonces = webhook.NewMemoryNonces()
+//	body, err := v.VerifyRequest(req)
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderSignature = "X-Bearded-Signature"
+	HeaderTimestamp = "X-Bearded-Timestamp"
+	HeaderNonce     = "X-Bearded-Nonce"
+
+	signaturePrefix = "sha256="
+
+	// DefaultWindow is the max age of deliveries which are accepted
+	DefaultWindow = time.Minute * 5
+)
+
+var (
+	ErrNoSignature = errors.New("webhook signature is missing")
+	ErrSignature   = errors.New("webhook signature is wrong")
+	ErrExpired     = errors.New("webhook delivery is outside of the time window")
+	ErrReplayed    = errors.New("webhook nonce is already used")
+)
+
+// Sign returns the signature of the body with the timestamp and the nonce, in the form of the header
+func Sign(secret []byte, timestamp int64, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d.%s.", timestamp, nonce)
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest sets signature headers of the request with the body, a new nonce is generated for every call
+func SignRequest(req *http.Request, secret []byte, body []byte, now time.Time) error {
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	timestamp := now.Unix()
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, nonce, body))
+	return nil
+}
+
+func newNonce() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Nonces remember nonces of accepted deliveries until they expire
+type Nonces interface {
+	// Seen returns true if the nonce is already used, otherwise the nonce is kept until expire
+	Seen(nonce string, expire time.Time) bool
+}
+
+type Verifier struct {
+	Secret []byte
+	// deliveries with timestamps which differ from now more than the window are rejected
+	Window time.Duration
+	// nonces aren't checked if it's nil
+	Nonces Nonces
+	// time source for tests, time.Now if nil
+	Now func() time.Time
+}
+
+// NewVerifier creates the verifier, the default window is used if it's zero
+func NewVerifier(secret []byte, window time.Duration) *Verifier {
+	if window == 0 {
+		window = DefaultWindow
+	}
+	return &Verifier{Secret: secret, Window: window}
+}
+
+// Verify the signature headers of the delivery with the body
+func (v *Verifier) Verify(header http.Header, body []byte) error {
+	signature := header.Get(HeaderSignature)
+	if signature == "" || !strings.HasPrefix(signature, signaturePrefix) {
+		return ErrNoSignature
+	}
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrNoSignature
+	}
+	nonce := header.Get(HeaderNonce)
+	if !hmac.Equal([]byte(signature), []byte(Sign(v.Secret, timestamp, nonce, body))) {
+		return ErrSignature
+	}
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	sent := time.Unix(timestamp, 0)
+	if sent.Before(now.Add(-v.Window)) || sent.After(now.Add(v.Window)) {
+		return ErrExpired
+	}
+	if v.Nonces != nil {
+		if nonce == "" {
+			return ErrNoSignature
+		}
+		// a nonce older than the window is rejected by the timestamp, so it's kept only for the window
+		if v.Nonces.Seen(nonce, sent.Add(v.Window)) {
+			return ErrReplayed
+		}
+	}
+	return nil
+}
+
+// VerifyRequest reads the body and verifies the request, the body is returned and could be read from the request again
+func (v *Verifier) VerifyRequest(req *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := v.Verify(req.Header, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// MemoryNonces keeps nonces in memory, it's enough for receivers with one process
+type MemoryNonces struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	// time source for tests, time.Now if nil
+	Now func() time.Time
+}
+
+func NewMemoryNonces() *MemoryNonces {
+	return &MemoryNonces{nonces: map[string]time.Time{}}
+}
+
+func (n *MemoryNonces) Seen(nonce string, expire time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := time.Now()
+	if n.Now != nil {
+		now = n.Now()
+	}
+	for key, exp := range n.nonces {
+		if exp.Before(now) {
+			delete(n.nonces, key)
+		}
+	}
+	if _, found := n.nonces[nonce]; found {
+		return true
+	}
+	n.nonces[nonce] = expire
+	return false
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"event":{}}`)
+	now := time.Now()
+	req, err := http.NewRequest("POST", "http://example.com/hook", bytes.NewReader(body))
+	require.NoError(t, err)
+	require.NoError(t, SignRequest(req, secret, body, now))
+
+	v := NewVerifier(secret, time.Minute)
+	v.Now = func() time.Time { return now }
+	data, err := v.VerifyRequest(req)
+	require.NoError(t, err)
+	require.Equal(t, body, data)
+	// the body could be read again by the handler
+	data, err = ioutil.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.Equal(t, body, data)
+
+	require.Equal(t, ErrSignature, v.Verify(req.Header, []byte(`{"event":{"forged":true}}`)))
+	require.Equal(t, ErrSignature, NewVerifier([]byte("other"), 0).Verify(req.Header, body))
+	require.Equal(t, ErrNoSignature, v.Verify(http.Header{}, body))
+
+	// the timestamp is signed, so old deliveries can't be sent again with a new one
+	v.Now = func() time.Time { return now.Add(time.Minute * 2) }
+	require.Equal(t, ErrExpired, v.Verify(req.Header, body))
+	header := http.Header{}
+	for k, vals := range req.Header {
+		header[k] = vals
+	}
+	header.Set(HeaderTimestamp, "1")
+	require.Equal(t, ErrSignature, v.Verify(header, body))
+}
+
+func TestVerifyNonce(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{}`)
+	req, err := http.NewRequest("POST", "http://example.com/hook", bytes.NewReader(body))
+	require.NoError(t, err)
+	require.NoError(t, SignRequest(req, secret, body, time.Now()))
+
+	v := NewVerifier(secret, 0)
+	v.Nonces = NewMemoryNonces()
+	require.NoError(t, v.Verify(req.Header, body))
+	require.Equal(t, ErrReplayed, v.Verify(req.Header, body))
+
+	// every request gets a new nonce
+	require.NoError(t, SignRequest(req, secret, body, time.Now()))
+	require.NoError(t, v.Verify(req.Header, body))
+}
+
+func TestMemoryNoncesExpire(t *testing.T) {
+	now := time.Now()
+	n := NewMemoryNonces()
+	n.Now = func() time.Time { return now }
+	require.False(t, n.Seen("a", now.Add(time.Minute)))
+	require.True(t, n.Seen("a", now.Add(time.Minute)))
+	n.Now = func() time.Time { return now.Add(time.Minute * 2) }
+	require.False(t, n.Seen("a", now.Add(time.Minute*3)))
+}
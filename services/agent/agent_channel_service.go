@@ -0,0 +1,192 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/context"
+
+	"github.com/bearded-web/bearded/models/agent"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/scheduler"
+	"github.com/bearded-web/bearded/pkg/transport"
+	wsTransport "github.com/bearded-web/bearded/pkg/transport/websocket"
+	"github.com/bearded-web/bearded/pkg/utils"
+	"github.com/bearded-web/bearded/services"
+)
+
+const (
+	// how often the queue is checked for agents with a channel
+	channelDispatchInterval = time.Second
+	// the channel is closed if the agent doesn't send heartbeats for this time
+	channelHeartbeatTimeout = time.Minute
+	// time for the agent to accept pushed jobs
+	channelRequestTimeout = time.Second * 10
+)
+
+// Agents keep a websocket channel to get jobs without polling, heartbeats and logs are sent over the channel.
+// Agents which can't connect the channel poll jobs over http.
+func (s *AgentService) RegisterChannel(ws *restful.WebService) {
+	r := ws.GET(fmt.Sprintf("{%s}/channel", ParamId)).To(s.TakeAgent(s.channel))
+	// the channel is open while the agent is running
+	r.Filter(services.Timeout(0))
+	addDefaults(r)
+	r.Doc("channel")
+	r.Operation("channel")
+	r.Notes("Authorization required. Upgrade the connection to websocket, jobs are pushed to the agent, " +
+		"the agent sends heartbeats and logs")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Do(services.Returns(
+		http.StatusSwitchingProtocols,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusForbidden))
+	ws.Route(r)
+}
+
+func (s *AgentService) channel(req *restful.Request, resp *restful.Response, ag *agent.Agent) {
+	mgr := s.RequestManager(req)
+	admin := mgr.Permission.IsAdmin(filters.GetUser(req))
+	mgr.Close()
+	if !admin {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(resp.ResponseWriter, req.Request, nil)
+	if err != nil {
+		// the upgrader responds with the error itself
+		logrus.Warnf("Can't upgrade channel of agent %s: %v", ag, err)
+		return
+	}
+	defer conn.Close()
+	logrus.Infof("Agent %s is connected to the channel", ag)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := &agentChannel{
+		s:         s,
+		agent:     ag,
+		transp:    wsTransport.NewConn(conn),
+		heartbeat: time.Now(),
+	}
+	go func() {
+		if err := ch.transp.Serve(ctx, ch); err != nil && !utils.IsCanceled(err) {
+			logrus.Warnf("Channel of agent %s is broken: %v", ag, err)
+		}
+		cancel()
+	}()
+	ch.dispatch(ctx)
+	logrus.Infof("Agent %s is disconnected from the channel", ag)
+}
+
+type agentChannel struct {
+	s      *AgentService
+	transp transport.Transport
+
+	mu        sync.Mutex
+	agent     *agent.Agent
+	heartbeat time.Time
+}
+
+// dispatch pushes jobs to the agent until the channel is closed or the agent is silent for too long
+func (c *agentChannel) dispatch(ctx context.Context) {
+	ticker := time.NewTicker(channelDispatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		ag, heartbeat := c.agent, c.heartbeat
+		c.mu.Unlock()
+		if time.Since(heartbeat) > channelHeartbeatTimeout {
+			logrus.Warnf("Agent %s doesn't send heartbeats, the channel is closed", ag)
+			return
+		}
+
+		mgr := c.s.BackgroundManager()
+		jobs, err := c.s.takeJobs(mgr, ag)
+		if err != nil {
+			mgr.Close()
+			logrus.Error(stackerr.Wrap(err))
+			continue
+		}
+		if len(jobs) == 0 {
+			mgr.Close()
+			continue
+		}
+		err = c.transp.Request(utils.JustTimeout(ctx, channelRequestTimeout),
+			&agent.ChannelRequest{Method: agent.ChannelJobs, Jobs: jobs}, &agent.ChannelResponse{})
+		if err != nil {
+			logrus.Errorf("Can't push %d jobs to agent %s: %v", len(jobs), ag, err)
+			// the agent hasn't got the jobs, so sessions are returned to the queue for other agents
+			c.release(mgr, jobs)
+			mgr.Close()
+			return
+		}
+		mgr.Close()
+	}
+}
+
+// release returns sessions of jobs which aren't delivered to the queue
+func (c *agentChannel) release(mgr *manager.Manager, jobs []*agent.Job) {
+	for _, job := range jobs {
+		if job.Scan == nil {
+			continue
+		}
+		if err := scheduler.Release(mgr, c.s.Scheduler(), job.Scan); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		}
+	}
+}
+
+// Handle requests of the agent
+func (c *agentChannel) Handle(ctx context.Context, msg transport.Extractor) (interface{}, error) {
+	req := &agent.ChannelRequest{}
+	if err := msg.Extract(req); err != nil {
+		return nil, err
+	}
+	mgr := c.s.BackgroundManager()
+	defer mgr.Close()
+
+	c.mu.Lock()
+	ag := c.agent
+	c.mu.Unlock()
+
+	switch req.Method {
+	case agent.ChannelHeartbeat:
+		c.s.touch(mgr, ag)
+		// approve, block and retire of the agent are noticed by the heartbeat
+		updated, err := mgr.Agents.GetById(ag.Id)
+		if err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			return nil, fmt.Errorf("can't get the agent")
+		}
+		c.mu.Lock()
+		c.agent, c.heartbeat = updated, time.Now()
+		c.mu.Unlock()
+		return &agent.ChannelResponse{Agent: updated}, nil
+	case agent.ChannelLog:
+		if req.Log == nil {
+			return nil, fmt.Errorf("log is required")
+		}
+		req.Log.Agent = ag.Id
+		if _, sErr := c.s.addLog(mgr, req.Log); sErr != nil {
+			return nil, sErr.Err
+		}
+		return &agent.ChannelResponse{}, nil
+	}
+	return nil, fmt.Errorf("unknown method %s", req.Method)
+}
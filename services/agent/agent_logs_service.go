@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/agent"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/pagination"
+	"github.com/bearded-web/bearded/services"
+)
+
+const (
+	// agents send logs in chunks, so a single request stays small
+	MaxLogChunkSize = 64 << 10
+	// how often new logs are checked while following
+	logPollInterval = time.Second
+)
+
+type LogEntity struct {
+	Scan    string `json:"scan" description:"scan id"`
+	Session string `json:"session" description:"session id"`
+	Data    string `json:"data" description:"plugin output"`
+}
+
+// Agents stream plugin output of running sessions, so operators don't need access to agent hosts.
+// Only admins, including the internal agent user, have access to logs.
+func (s *AgentService) RegisterLogs(ws *restful.WebService) {
+	r := ws.POST(fmt.Sprintf("{%s}/logs", ParamId)).To(s.TakeAgent(s.logsAdd))
+	addDefaults(r)
+	r.Doc("logsAdd")
+	r.Operation("logsAdd")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Reads(LogEntity{})
+	r.Writes(agent.Log{})
+	r.Do(services.Returns(
+		http.StatusCreated,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusForbidden,
+		http.StatusRequestEntityTooLarge))
+	ws.Route(r)
+
+	r = ws.GET(fmt.Sprintf("{%s}/logs", ParamId)).To(s.TakeAgent(s.logs))
+	// logs are followed until the session is done
+	r.Filter(services.Timeout(0))
+	addDefaults(r)
+	r.Doc("logs")
+	r.Operation("logs")
+	r.Notes("Authorization required. Returns session logs, use follow parameter to get new logs " +
+		"as server-sent events until the session is done")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.QueryParameter("scan", "scan id, required"))
+	r.Param(ws.QueryParameter("session", "session id, required"))
+	r.Param(ws.QueryParameter("follow", "stream logs as text/event-stream").DataType("boolean"))
+	r.Writes(agent.LogList{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusForbidden))
+	ws.Route(r)
+}
+
+func (s *AgentService) logsAdd(req *restful.Request, resp *restful.Response, ag *agent.Agent) {
+	raw := &LogEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if !s.IsId(raw.Scan) || !s.IsId(raw.Session) {
+		services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if !mgr.Permission.IsAdmin(filters.GetUser(req)) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+	obj, sErr := s.addLog(mgr, &agent.Log{
+		Agent:   ag.Id,
+		Scan:    mgr.ToId(raw.Scan),
+		Session: mgr.ToId(raw.Session),
+		Data:    raw.Data,
+	})
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(obj)
+}
+
+// addLog stores the chunk of logs sent by the agent over http or the channel
+func (s *AgentService) addLog(mgr *manager.Manager, chunk *agent.Log) (*agent.Log, *services.ErrResp) {
+	if len(chunk.Data) > MaxLogChunkSize {
+		return nil, &services.ErrResp{Code: http.StatusRequestEntityTooLarge,
+			Err: services.NewBadReq("log chunk should be less than %d bytes", MaxLogChunkSize)}
+	}
+	sess, sErr := getSession(mgr, chunk.Scan, chunk.Session)
+	if sErr != nil {
+		return nil, sErr
+	}
+	// agents write logs only of sessions which they took
+	if sess.Agent != chunk.Agent {
+		return nil, &services.ErrResp{Code: http.StatusForbidden, Err: services.AuthForbidErr}
+	}
+	obj, err := mgr.Logs.Create(chunk, s.ApiCfg().AgentLog.MaxSize)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return nil, &services.ErrResp{Code: http.StatusInternalServerError, Err: services.DbErr}
+	}
+	return obj, nil
+}
+
+func (s *AgentService) logs(req *restful.Request, resp *restful.Response, ag *agent.Agent) {
+	scanId, sessionId := req.QueryParameter("scan"), req.QueryParameter("session")
+	if !s.IsId(scanId) || !s.IsId(sessionId) {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("scan and session are required"))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if !mgr.Permission.IsAdmin(filters.GetUser(req)) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+	sess, sErr := getSession(mgr, mgr.ToId(scanId), mgr.ToId(sessionId))
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	results, err := mgr.Logs.GetBySession(sess.Id, "")
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+
+	if req.QueryParameter("follow") != "true" || sess.IsDone() {
+		resp.WriteEntity(&agent.LogList{
+			Meta:    pagination.Meta{Count: len(results)},
+			Results: results,
+		})
+		return
+	}
+	s.followLogs(services.Context(req), resp, mgr, mgr.ToId(scanId), sess.Id, results)
+}
+
+// Send logs as server-sent events, new logs are polled until the session is done or the client is gone
+func (s *AgentService) followLogs(ctx context.Context, resp *restful.Response, mgr *manager.Manager,
+	scanId, sessionId bson.ObjectId, results []*agent.Log) {
+
+	flusher, ok := resp.ResponseWriter.(http.Flusher)
+	if !ok {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("streaming isn't supported"))
+		return
+	}
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.WriteHeader(http.StatusOK)
+
+	var last bson.ObjectId
+	send := func(logs []*agent.Log) error {
+		for _, l := range logs {
+			data, err := json.Marshal(l)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(resp, "id: %s\nevent: log\ndata: %s\n\n", l.Id.Hex(), data); err != nil {
+				return err
+			}
+			last = l.Id
+		}
+		flusher.Flush()
+		return nil
+	}
+	if err := send(results); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// the session status is taken before logs, so the last logs aren't lost
+		done := true
+		if current, sErr := getSession(mgr, scanId, sessionId); sErr == nil {
+			done = current.IsDone()
+		}
+		logs, err := mgr.Logs.GetBySession(sessionId, last)
+		if err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			return
+		}
+		if err := send(logs); err != nil {
+			return
+		}
+		if done {
+			fmt.Fprint(resp, "event: end\ndata: {}\n\n")
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+// helpers
+
+func getSession(mgr *manager.Manager, scanId, sessionId bson.ObjectId) (*scan.Session, *services.ErrResp) {
+	sc, err := mgr.Scans.GetById(scanId)
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			return nil, &services.ErrResp{Code: http.StatusNotFound, Err: services.NewNotFound("Scan not found")}
+		}
+		logrus.Error(stackerr.Wrap(err))
+		return nil, &services.ErrResp{Code: http.StatusInternalServerError, Err: services.DbErr}
+	}
+	sess := sc.GetSession(sessionId)
+	if sess == nil {
+		return nil, &services.ErrResp{Code: http.StatusNotFound, Err: services.NewNotFound("Session not found")}
+	}
+	return sess, nil
+}
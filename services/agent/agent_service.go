@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
@@ -10,15 +11,21 @@ import (
 	"github.com/facebookgo/stackerr"
 
 	"github.com/bearded-web/bearded/models/agent"
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/scan"
 	"github.com/bearded-web/bearded/pkg/filters"
 	"github.com/bearded-web/bearded/pkg/fltr"
 	"github.com/bearded-web/bearded/pkg/manager"
 	"github.com/bearded-web/bearded/pkg/pagination"
+	"github.com/bearded-web/bearded/pkg/scheduler"
 	"github.com/bearded-web/bearded/services"
 )
 
 const ParamId = "agent-id"
 
+// last seen time of the agent is updated not more often than this, so polling for jobs doesn't write every time
+const lastSeenInterval = time.Minute
+
 type AgentService struct {
 	*services.BaseService
 }
@@ -44,7 +51,7 @@ func (s *AgentService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
-	ws.Filter(filters.AuthRequiredFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
 
 	r := ws.GET("").To(s.list)
 	addDefaults(r)
@@ -117,6 +124,20 @@ func (s *AgentService) Register(container *restful.Container) {
 	r.Do(services.ReturnsE(http.StatusBadRequest))
 	ws.Route(r)
 
+	r = ws.POST(fmt.Sprintf("{%s}/deregister", ParamId)).To(s.TakeAgent(s.deregister))
+	addDefaults(r)
+	r.Doc("deregister")
+	r.Operation("deregister")
+	r.Notes("Authorization required. Retire the agent, its queued and working sessions are returned to the queue")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Reads(struct{}{})
+	r.Writes(agent.Agent{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusForbidden))
+	ws.Route(r)
+
 	r = ws.GET(fmt.Sprintf("{%s}/jobs", ParamId)).To(s.TakeAgent(s.jobs))
 	addDefaults(r)
 	r.Doc("jobs")
@@ -128,6 +149,9 @@ func (s *AgentService) Register(container *restful.Container) {
 	r.Do(services.ReturnsE(http.StatusBadRequest))
 	ws.Route(r)
 
+	s.RegisterLogs(ws)
+	s.RegisterChannel(ws)
+
 	container.Add(ws)
 }
 
@@ -139,11 +163,11 @@ func (s *AgentService) create(req *restful.Request, resp *restful.Response) {
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	raw.Type = agent.System
@@ -158,13 +182,13 @@ func (s *AgentService) create(req *restful.Request, resp *restful.Response) {
 	obj, err := mgr.Agents.Create(raw)
 	if err != nil {
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.DuplicateErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -175,17 +199,17 @@ func (s *AgentService) create(req *restful.Request, resp *restful.Response) {
 func (s *AgentService) list(req *restful.Request, resp *restful.Response) {
 	query, err := fltr.FromRequest(req, manager.AgentFltr{})
 	if err != nil {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	results, count, err := mgr.Agents.FilterByQuery(query)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -207,15 +231,15 @@ func (s *AgentService) update(req *restful.Request, resp *restful.Response, pl *
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	raw.Id = pl.Id
 
-	if err := s.updateAgent(resp, raw); err != nil {
+	if err := s.updateAgent(req, resp, raw); err != nil {
 		return
 	}
 
@@ -223,46 +247,63 @@ func (s *AgentService) update(req *restful.Request, resp *restful.Response, pl *
 	resp.WriteEntity(raw)
 }
 
-func (s *AgentService) delete(_ *restful.Request, resp *restful.Response, obj *agent.Agent) {
+func (s *AgentService) delete(req *restful.Request, resp *restful.Response, obj *agent.Agent) {
 	// TODO (m0sth8): Check permissions
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	mgr.Agents.Remove(obj)
 	resp.WriteHeader(http.StatusNoContent)
 }
 
-func (s *AgentService) approve(_ *restful.Request, resp *restful.Response, ag *agent.Agent) {
+func (s *AgentService) approve(req *restful.Request, resp *restful.Response, ag *agent.Agent) {
 	// TODO (m0sth8): Check permissions
 
-	if ag.Status == agent.StatusRegistered {
+	// retired agents could be approved again, when they are back online
+	if ag.Status == agent.StatusRegistered || ag.Status == agent.StatusRetired {
 		ag.Status = agent.StatusApproved
-		s.updateAgent(resp, ag)
+		ag.Retired = time.Time{}
+		s.updateAgent(req, resp, ag)
 	}
 	resp.WriteEntity(ag)
 }
 
-func (s *AgentService) jobs(_ *restful.Request, resp *restful.Response, _ *agent.Agent) {
-	jobs := []*agent.Job{}
+func (s *AgentService) deregister(req *restful.Request, resp *restful.Response, ag *agent.Agent) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
 
-	sess, err := s.Scheduler().GetSession()
+	u := filters.GetUser(req)
+	if !mgr.Permission.IsAdmin(u) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+	released, err := scheduler.Retire(mgr, s.Scheduler(), ag)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.AppErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
-	if sess == nil {
-		time.Sleep(2 * time.Second)
-		sess, err = s.Scheduler().GetSession()
+	logrus.Infof("User %s deregistered agent %s, %d sessions are released", u, ag, released)
+	resp.WriteEntity(ag)
+}
+
+func (s *AgentService) jobs(req *restful.Request, resp *restful.Response, ag *agent.Agent) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
 
+	s.touch(mgr, ag)
+	jobs, err := s.takeJobs(mgr, ag)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.AppErr)
+		return
 	}
-	if sess != nil {
-		job := agent.Job{
-			Cmd:  agent.CmdScan,
-			Scan: sess,
+	if len(jobs) == 0 && takesJobs(ag) {
+		time.Sleep(2 * time.Second)
+		if jobs, err = s.takeJobs(mgr, ag); err != nil {
+			logrus.Error(stackerr.Wrap(err))
 		}
-		jobs = append(jobs, &job)
 	}
 
 	resp.WriteEntity(jobs)
@@ -270,23 +311,179 @@ func (s *AgentService) jobs(_ *restful.Request, resp *restful.Response, _ *agent
 
 // helpers
 
-func (s *AgentService) updateAgent(resp *restful.Response, ag *agent.Agent) error {
-	mgr := s.Manager()
+// retired agents don't get new sessions, even if they are still running
+func takesJobs(ag *agent.Agent) bool {
+	return ag.Status != agent.StatusRetired && ag.Status != agent.StatusBlocked
+}
+
+func (s *AgentService) touch(mgr *manager.Manager, ag *agent.Agent) {
+	if ag.Stale || time.Since(ag.LastSeen) > lastSeenInterval {
+		if err := mgr.Agents.Touch(ag.Id); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		}
+	}
+}
+
+// takeJobs takes the next session from the queue for the agent, the result is empty if there is nothing to do
+func (s *AgentService) takeJobs(mgr *manager.Manager, ag *agent.Agent) ([]*agent.Job, error) {
+	jobs := []*agent.Job{}
+	if !takesJobs(ag) {
+		return jobs, nil
+	}
+	sess, err := s.Scheduler().GetSession()
+	if err != nil || sess == nil {
+		return jobs, err
+	}
+	// windows are checked again, the scan could be queued longer than the window is open
+	if held, err := scheduler.Hold(mgr, s.Scheduler(), sess, time.Now()); err != nil || held {
+		return jobs, err
+	}
+	// the session keeps the agent for history, even if the agent is retired later
+	sess.Agent = ag.Id
+	if err := s.setSessionAgent(mgr, sess); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+	job := agent.Job{
+		Cmd:  agent.CmdScan,
+		Scan: sess,
+	}
+	// the plugin can't work without inputs, so the session is taken again later
+	if job.Scan, err = s.shareInputs(mgr, sess); err != nil {
+		if err := scheduler.Release(mgr, s.Scheduler(), sess); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		}
+		return jobs, err
+	}
+	if throttled, err := throttleSession(mgr, job.Scan); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	} else {
+		job.Scan = throttled
+	}
+	return append(jobs, &job), nil
+}
+
+// throttleSession returns the copy of the session with the throttle of the step, the plugin and the target,
+// the step throttle is preferred to the plugin one and the target makes them stricter
+func throttleSession(mgr *manager.Manager, sess *scan.Session) (*scan.Session, error) {
+	if sess.Step == nil {
+		return sess, nil
+	}
+	throttle := sess.Step.Throttle
+	if throttle == nil && sess.Plugin != "" {
+		pl, err := mgr.Plugins.GetById(sess.Plugin.Hex())
+		if err != nil && !mgr.IsNotFound(err) {
+			return nil, err
+		}
+		if err == nil {
+			throttle = pl.Throttle
+		}
+	}
+	sc, err := mgr.Scans.GetById(sess.Scan)
+	if err != nil {
+		return nil, err
+	}
+	// dry runs don't have a target
+	if sc.Target != "" {
+		t, err := mgr.Targets.GetById(sc.Target)
+		if err != nil && !mgr.IsNotFound(err) {
+			return nil, err
+		}
+		if err == nil {
+			throttle = throttle.Stricter(t.Throttle)
+		}
+	}
+	if throttle.IsZero() {
+		return sess, nil
+	}
+	step := *sess.Step
+	step.Throttle = throttle
+	result := *sess
+	result.Step = &step
+	return &result, nil
+}
+
+// shareInputs returns the copy of the session with outputs of prior steps in shared files of the step,
+// the scheduler keeps the session as is
+func (s *AgentService) shareInputs(mgr *manager.Manager, sess *scan.Session) (*scan.Session, error) {
+	if sess.Step == nil || len(sess.Step.Inputs) == 0 {
+		return sess, nil
+	}
+	sc, err := mgr.Scans.GetById(sess.Scan)
+	if err != nil {
+		return nil, err
+	}
+	step := *sess.Step
+	conf := plan.Conf{}
+	if step.Conf != nil {
+		conf = *step.Conf
+	}
+	conf.SharedFiles = append([]*plan.SharedFile{}, conf.SharedFiles...)
+	for _, in := range step.Inputs {
+		text := "null"
+		if prior := outputSession(sc, in.Output); prior != nil {
+			rep, err := mgr.Reports.GetBySession(prior.Id)
+			if err != nil && !mgr.IsNotFound(err) {
+				return nil, err
+			}
+			if err == nil {
+				data, err := json.Marshal(rep)
+				if err != nil {
+					return nil, err
+				}
+				text = string(data)
+			}
+		}
+		if text == "null" {
+			logrus.Warnf("Output %s for session %s of scan %s isn't reported", in.Output, sess.Id.Hex(), sc)
+		}
+		conf.SharedFiles = append(conf.SharedFiles, &plan.SharedFile{Path: in.SharePath(), Text: text})
+	}
+	step.Conf = &conf
+	result := *sess
+	result.Step = &step
+	return &result, nil
+}
+
+// root session of the step which produces the output
+func outputSession(sc *scan.Scan, output string) *scan.Session {
+	for _, sess := range sc.Sessions {
+		if sess.Step != nil && sess.Step.Output == output {
+			return sess
+		}
+	}
+	return nil
+}
+
+func (s *AgentService) setSessionAgent(mgr *manager.Manager, sess *scan.Session) error {
+	sc, err := mgr.Scans.GetById(sess.Scan)
+	if err != nil {
+		return err
+	}
+	obj := sc.GetSession(sess.Id)
+	if obj == nil {
+		return nil
+	}
+	obj.Agent = sess.Agent
+	return mgr.Scans.UpdateSession(sc, obj)
+}
+
+func (s *AgentService) updateAgent(req *restful.Request, resp *restful.Response, ag *agent.Agent) error {
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	if err := mgr.Agents.Update(ag); err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 			return err
 		}
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.DuplicateErr)
 			return err
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return err
 	}
 	return nil
@@ -297,22 +494,22 @@ func (s *AgentService) TakeAgent(fn func(*restful.Request,
 	return func(req *restful.Request, resp *restful.Response) {
 		id := req.PathParameter(ParamId)
 		if !s.IsId(id) {
-			resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 			return
 		}
 
-		mgr := s.Manager()
+		mgr := s.RequestManager(req)
 		defer mgr.Close()
 
 		obj, err := mgr.Agents.GetById(mgr.ToId(id))
 		mgr.Close()
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteErrorString(http.StatusNotFound, "Not found")
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 		fn(req, resp, obj)
@@ -3,6 +3,8 @@ package auth
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -10,11 +12,13 @@ import (
 	"github.com/emicklei/go-restful"
 	"github.com/facebookgo/stackerr"
 
+	"github.com/bearded-web/bearded/models/audit"
 	"github.com/bearded-web/bearded/models/user"
 	"github.com/bearded-web/bearded/pkg/email"
 	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/manager"
 	"github.com/bearded-web/bearded/pkg/passlib/reset"
-	"github.com/bearded-web/bearded/pkg/validate"
+	"github.com/bearded-web/bearded/pkg/template"
 	"github.com/bearded-web/bearded/services"
 )
 
@@ -36,7 +40,7 @@ func addDefaults(r *restful.RouteBuilder) {
 }
 
 func (s *AuthService) Register(container *restful.Container) {
-	authRequired := filters.AuthRequiredFilter(s.BaseManager())
+	authRequired := filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...)
 
 	ws := &restful.WebService{}
 	ws.Path("/api/v1/auth")
@@ -70,13 +74,57 @@ func (s *AuthService) Register(container *restful.Container) {
 	addDefaults(r)
 	ws.Route(r)
 
+	r = ws.POST("impersonate").To(s.impersonate)
+	r.Doc("impersonate")
+	r.Operation("impersonate")
+	r.Notes("Authorization required, available only for admins. " +
+		"The session acts as the user until impersonation is stopped, every request is logged with the admin.")
+	r.Filter(authRequired)
+	r.Reads(impersonateEntity{})
+	r.Writes(user.User{})
+	r.Do(services.Returns(http.StatusCreated))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusForbidden,
+		http.StatusNotFound))
+	addDefaults(r)
+	ws.Route(r)
+
+	r = ws.DELETE("impersonate").To(s.stopImpersonate)
+	r.Doc("stop impersonate")
+	r.Operation("stopImpersonate")
+	r.Notes("Returns the session to the admin")
+	r.Filter(authRequired)
+	r.Do(services.Returns(http.StatusNoContent))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	addDefaults(r)
+	ws.Route(r)
+
 	// registration actions
 	r = ws.POST("reset-password").To(s.resetPassword)
 	r.Doc("reset user password")
 	r.Operation("resetPassword")
 	r.Reads(resetPasswordEntity{})
+	r.Notes("Returns 503 if email is disabled, admins could create the link with reset-link")
 	r.Returns(http.StatusCreated, "Token created", "")
-	r.Do(services.ReturnsE(http.StatusBadRequest))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusServiceUnavailable))
+	addDefaults(r)
+	ws.Route(r)
+
+	r = ws.POST("reset-link").To(s.resetLink)
+	r.Doc("create reset password link")
+	r.Operation("resetLink")
+	r.Notes("Authorization required, available only for admins. " +
+		"The link is returned instead of sending by email, so the admin could pass it to the user out of band.")
+	r.Filter(authRequired)
+	r.Reads(resetPasswordEntity{})
+	r.Writes(resetLinkEntity{})
+	r.Do(services.Returns(http.StatusCreated))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusForbidden))
 	addDefaults(r)
 	ws.Route(r)
 
@@ -94,8 +142,10 @@ func (s *AuthService) Register(container *restful.Container) {
 	r.Doc("register")
 	r.Operation("register")
 	r.Reads(registerEntity{})
+	r.Notes("Registration could be disabled or limited to email domains by admins, " +
+		"users are invited by admins then.")
 	r.Returns(http.StatusCreated, "User registered", sessionEntity{})
-	r.Do(services.ReturnsE(http.StatusBadRequest))
+	r.Do(services.ReturnsE(http.StatusBadRequest, http.StatusForbidden))
 	addDefaults(r)
 	ws.Route(r)
 
@@ -109,21 +159,21 @@ func (s *AuthService) login(req *restful.Request, resp *restful.Response) {
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 	// TODO (m0sth8): extract user login and logout, this helps to login in other services
 	// TODO (m0sth8): validate password and email, type, max length etc
 	if raw.Email == "" {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("password shouldn't be empty"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("password shouldn't be empty"))
 		return
 	}
 	if raw.Password == "" {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("password shouldn't be empty"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("password shouldn't be empty"))
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	// get user
@@ -131,16 +181,16 @@ func (s *AuthService) login(req *restful.Request, resp *restful.Response) {
 	if err != nil {
 		if mgr.IsNotFound(err) {
 			// TODO (m0sth8): add captcha to protect against bruteforce
-			resp.WriteServiceError(http.StatusUnauthorized, services.AuthFailedErr)
+			services.WriteError(resp, http.StatusUnauthorized, services.AuthFailedErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 	// users without password can't login
 	if u.Password == "" {
-		resp.WriteServiceError(http.StatusUnauthorized, services.AuthFailedErr)
+		services.WriteError(resp, http.StatusUnauthorized, services.AuthFailedErr)
 		return
 	}
 
@@ -148,31 +198,137 @@ func (s *AuthService) login(req *restful.Request, resp *restful.Response) {
 	verified, err := s.PassCtx().Verify(raw.Password, u.Password)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.AppErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.AppErr)
 		return
 	}
 	if !verified {
-		resp.WriteServiceError(http.StatusUnauthorized, services.AuthFailedErr)
+		services.WriteError(resp, http.StatusUnauthorized, services.AuthFailedErr)
 		return
 	}
+	s.rehashPassword(mgr, u, raw.Password)
 
 	// TODO (m0sth8): extract auth methods, like login or logout.
 	// set user id to session
+	session.Del(filters.SessionImpersonatorKey)
 	session.Set(filters.SessionUserKey, u.Id.Hex())
 	resp.WriteHeader(http.StatusCreated)
 	resp.WriteEntity(sessionEntity{Token: "not ready"})
 }
 
+// rehash the password if it was hashed with weaker parameters than the current policy,
+// the user is logged in anyway, so errors are only logged
+func (s *AuthService) rehashPassword(mgr *manager.Manager, u *user.User, password string) {
+	if !s.PassCtx().NeedsUpdate(u.Password) {
+		return
+	}
+	hash, err := s.PassCtx().Encrypt(password)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return
+	}
+	u.Password = hash
+	if err := mgr.Users.Update(u); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return
+	}
+	logrus.Infof("Password hash for user %s is updated to the current policy", u)
+}
+
 func (s *AuthService) status(_ *restful.Request, _ *restful.Response) {
 	// do nothing, just return 200 ok, cause authorization was checked in filter
 }
 
 func (s *AuthService) logout(req *restful.Request, resp *restful.Response) {
 	session := filters.GetSession(req)
+	if admin := filters.GetImpersonator(req); admin != nil {
+		mgr := s.RequestManager(req)
+		defer mgr.Close()
+		s.auditImpersonation(mgr, audit.TypeImpersonationStopped, admin, filters.GetUser(req))
+	}
+	session.Del(filters.SessionImpersonatorKey)
 	session.Del(filters.SessionUserKey)
 	resp.WriteHeader(http.StatusNoContent)
 }
 
+func (s *AuthService) impersonate(req *restful.Request, resp *restful.Response) {
+	raw := &impersonateEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if !s.IsId(raw.User) {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("user should be an id"))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	admin := filters.GetUser(req)
+	if filters.GetImpersonator(req) != nil || !mgr.Permission.IsAdmin(admin) {
+		logrus.Warnf("User %s try to impersonate %s without admin permission", admin, raw.User)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	u, err := mgr.Users.GetById(mgr.ToId(raw.User))
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	// admins and agents aren't impersonated, their sessions have more privileges than the admin needs for support
+	if u.Id == admin.Id || u.IsService() || mgr.Permission.IsAdmin(u) {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("only regular users could be impersonated"))
+		return
+	}
+
+	s.auditImpersonation(mgr, audit.TypeImpersonationStarted, admin, u)
+
+	session := filters.GetSession(req)
+	session.Set(filters.SessionImpersonatorKey, admin.Id.Hex())
+	session.Set(filters.SessionUserKey, u.Id.Hex())
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(u)
+}
+
+func (s *AuthService) stopImpersonate(req *restful.Request, resp *restful.Response) {
+	admin := filters.GetImpersonator(req)
+	if admin == nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("session isn't impersonated"))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	s.auditImpersonation(mgr, audit.TypeImpersonationStopped, admin, filters.GetUser(req))
+
+	session := filters.GetSession(req)
+	session.Del(filters.SessionImpersonatorKey)
+	session.Set(filters.SessionUserKey, admin.Id.Hex())
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (s *AuthService) auditImpersonation(mgr *manager.Manager, t audit.Type, admin, u *user.User) {
+	action := "started"
+	if t == audit.TypeImpersonationStopped {
+		action = "stopped"
+	}
+	s.Audit(mgr, &audit.Event{
+		Type:    t,
+		Actor:   admin.Id,
+		User:    u.Id,
+		Email:   admin.Email,
+		Message: fmt.Sprintf("Admin %s %s impersonating user %s", admin.Email, action, u.Email),
+	})
+}
+
 func (s *AuthService) register(req *restful.Request, resp *restful.Response) {
 	session := filters.GetSession(req)
 
@@ -180,7 +336,7 @@ func (s *AuthService) register(req *restful.Request, resp *restful.Response) {
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 
@@ -188,22 +344,39 @@ func (s *AuthService) register(req *restful.Request, resp *restful.Response) {
 
 	// check email
 	if valid, err := govalidator.ValidateStruct(raw); !valid {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
 		return
 	}
 	// check password
-	if valid, reason := validate.Password(raw.Password); !valid {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("Password %s", reason))
+	if sErr := s.CheckPassword("password", raw.Password); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
+	signup, err := s.Signup(mgr)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	if signup.Disable {
+		services.WriteError(resp, http.StatusForbidden, services.SignupDisabledErr)
+		return
+	}
+	if !allowedDomain(signup.Domains, raw.Email) {
+		services.WriteError(resp, http.StatusForbidden, services.NewError(services.CodeDomainDenied,
+			fmt.Sprintf("registration is allowed only for emails of %s, ask the administrator to invite you",
+				strings.Join(signup.Domains, ", "))))
+		return
+	}
+
 	pass, err := s.PassCtx().Encrypt(raw.Password)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.AppErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.AppErr)
 		return
 	}
 
@@ -215,72 +388,92 @@ func (s *AuthService) register(req *restful.Request, resp *restful.Response) {
 	u, err = mgr.Users.Create(u)
 	if err != nil {
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.NewError(services.CodeDuplicate, "user with this email is existed"))
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
+	session.Del(filters.SessionImpersonatorKey)
 	session.Set(filters.SessionUserKey, u.Id.Hex())
 	resp.WriteHeader(http.StatusCreated)
 	resp.WriteEntity(sessionEntity{Token: "not ready"})
 }
 
+// allowedDomain returns true if the email belongs to one of domains, any email is allowed if domains are empty
+func allowedDomain(domains []string, email string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, d := range domains {
+		if strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@")) == domain {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *AuthService) resetPassword(req *restful.Request, resp *restful.Response) {
 
 	raw := &resetPasswordEntity{}
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Warn(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 
 	if ok, err := govalidator.ValidateStruct(raw); !ok {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
+	if email.IsDisabled(s.Mailer()) {
+		services.WriteError(resp, http.StatusServiceUnavailable, services.EmailDisabledErr)
+		return
+	}
+
 	// TODO (m0sth8): add captcha support
 	u, err := mgr.Users.GetByEmail(raw.Email)
 	if err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("Email is not found"))
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Email is not found"))
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
-	reqUrl := req.Request.URL
 	// TODO (m0sth8): send email in worker
 	go func() {
 		cfg := s.ApiCfg()
-		dur := time.Second * time.Duration(cfg.ResetPasswordDuration)
-		token := reset.NewToken(u.Email, dur, []byte(u.Password), []byte(cfg.ResetPasswordSecret))
+		link := s.newResetLink(u)
 		msg := email.NewMessage()
 		msg.SetHeader("From", msg.FormatAddress(cfg.SystemEmail, "Bearded"))
 		msg.SetHeader("To", msg.FormatAddress(u.Email, u.Nickname))
-		msg.SetHeader("Subject", "Reset password in bearded-web service")
-		reqUrlVal := reqUrl.Query()
-		reqUrlVal.Add("token", token)
-		reqUrl.RawQuery = reqUrlVal.Encode()
+		msg.SetHeader("Subject", s.Subject("email/reset-password-subject", u.Locale, "Reset password in bearded-web service"))
 		wr := msg.GetBodyWriter("text/html")
 		data := map[string]string{
-			"ReqUrl":       fmt.Sprintf("%s%s", cfg.Host, reqUrl.String()),
+			"ReqUrl":       link.Url,
 			"Nickname":     u.Nickname,
 			"SystemEmail":  cfg.SystemEmail,
 			"ContactEmail": cfg.ContactEmail,
+			"Expire":       template.FormatTime(link.Expire, u.Location()),
 		}
-		if err := s.Template.Render(wr, "email/reset-password", data); err != nil {
+		if err := s.Template.Render(wr, "email/reset-password", data, template.RenderOptions{Locale: u.Locale}); err != nil {
 			logrus.Error(err)
 			return
 		}
@@ -294,10 +487,67 @@ func (s *AuthService) resetPassword(req *restful.Request, resp *restful.Response
 
 }
 
+func (s *AuthService) resetLink(req *restful.Request, resp *restful.Response) {
+	raw := &resetPasswordEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Warn(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(raw); !ok {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	admin := filters.GetUser(req)
+	if !mgr.Permission.IsAdmin(admin) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	u, err := mgr.Users.GetByEmail(raw.Email)
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Email is not found"))
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+
+	link := s.newResetLink(u)
+	s.Audit(mgr, &audit.Event{
+		Type:    audit.TypeResetLinkCreated,
+		Actor:   admin.Id,
+		User:    u.Id,
+		Email:   admin.Email,
+		Message: fmt.Sprintf("Admin %s created reset password link for user %s", admin.Email, u.Email),
+	})
+
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(link)
+}
+
+// newResetLink returns the link with the token to create the new password.
+// The token is signed with the current password hash, so it stops working after the password is changed.
+func (s *AuthService) newResetLink(u *user.User) *resetLinkEntity {
+	cfg := s.ApiCfg()
+	dur := time.Second * time.Duration(cfg.ResetPasswordDuration)
+	token := reset.NewToken(u.Email, dur, []byte(u.Password), []byte(cfg.ResetPasswordSecret))
+	return &resetLinkEntity{
+		Url:    fmt.Sprintf("%s/api/v1/auth/reset-password?%s", cfg.Host, url.Values{"token": {token}}.Encode()),
+		Expire: time.Now().Add(dur),
+	}
+}
+
 func (s *AuthService) checkResetToken(req *restful.Request, resp *restful.Response) {
 	token := req.QueryParameter("token")
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	// TODO (m0sth8: take variables from config
@@ -330,11 +580,12 @@ func (s *AuthService) checkResetToken(req *restful.Request, resp *restful.Respon
 		return
 	}
 	if u == nil {
-		resp.WriteServiceError(http.StatusInternalServerError, services.AppErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.AppErr)
 		return
 	}
 	// is that a good way to login user here?
 	session := filters.GetSession(req)
+	session.Del(filters.SessionImpersonatorKey)
 	session.Set(filters.SessionUserKey, u.Id.Hex())
 
 	redirect(req, resp, token)
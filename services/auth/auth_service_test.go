@@ -11,13 +11,16 @@ import (
 
 	"github.com/emicklei/go-restful"
 	c "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
 
 	"io/ioutil"
 	"time"
 
+	"github.com/bearded-web/bearded/models/audit"
 	"github.com/bearded-web/bearded/models/user"
 	"github.com/bearded-web/bearded/pkg/config"
 	"github.com/bearded-web/bearded/pkg/email"
+	"github.com/bearded-web/bearded/pkg/filters"
 	"github.com/bearded-web/bearded/pkg/manager"
 	"github.com/bearded-web/bearded/pkg/passlib"
 	"github.com/bearded-web/bearded/pkg/scheduler"
@@ -64,7 +67,7 @@ func TestResetPassword(t *testing.T) {
 				c.So(err, c.ShouldBeNil)
 				c.So(resp.StatusCode, c.ShouldEqual, http.StatusBadRequest)
 				sErr := getServiceError(t, resp)
-				c.So(sErr.Code, c.ShouldEqual, services.CodeWrongData)
+				c.So(sErr.Errno, c.ShouldEqual, services.CodeWrongData)
 				c.So(sErr.Message, c.ShouldContainSubstring, "non zero value required")
 			})
 		})
@@ -74,7 +77,7 @@ func TestResetPassword(t *testing.T) {
 				c.So(err, c.ShouldBeNil)
 				c.So(resp.StatusCode, c.ShouldEqual, http.StatusBadRequest)
 				sErr := getServiceError(t, resp)
-				c.So(sErr.Code, c.ShouldEqual, services.CodeWrongData)
+				c.So(sErr.Errno, c.ShouldEqual, services.CodeWrongData)
 				c.So(sErr.Message, c.ShouldContainSubstring, "does not validate as email")
 
 			})
@@ -85,7 +88,7 @@ func TestResetPassword(t *testing.T) {
 				c.So(err, c.ShouldBeNil)
 				c.So(resp.StatusCode, c.ShouldEqual, http.StatusBadRequest)
 				sErr := getServiceError(t, resp)
-				c.So(sErr.Code, c.ShouldEqual, services.CodeWrongData)
+				c.So(sErr.Errno, c.ShouldEqual, services.CodeWrongData)
 				c.So(sErr.Message, c.ShouldContainSubstring, "not found")
 			})
 		})
@@ -112,6 +115,91 @@ func TestResetPassword(t *testing.T) {
 
 }
 
+func TestImpersonate(t *testing.T) {
+	mongo, dbName, err := tests.RandomTestMongoUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tests.RandomTestMongoDown(mongo, dbName)
+
+	mgr := manager.New(mongo.DB(dbName))
+	mgr.Permission.SetAdmins([]string{"admin@example.com"})
+
+	admin, err := mgr.Users.Create(&user.User{Email: "admin@example.com"})
+	require.NoError(t, err)
+	u, err := mgr.Users.Create(&user.User{Email: "user@example.com"})
+	require.NoError(t, err)
+
+	sess := filters.NewSession()
+	service := New(services.New(mgr, passlib.NewContext(), scheduler.NewFake(),
+		email.NewMemoryBackend(100), config.NewDispatcher().Api))
+	wsContainer := restful.NewContainer()
+	wsContainer.Router(restful.CurlyRouter{})
+	wsContainer.Filter(filters.SessionFilterMock(sess))
+	service.Register(wsContainer)
+
+	ts := httptest.NewServer(wsContainer)
+	defer ts.Close()
+
+	// regular users can't impersonate
+	sess.Set(filters.SessionUserKey, u.Id.Hex())
+	resp, err := impersonate(ts.URL, "POST", &impersonateEntity{User: admin.Id.Hex()})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// admins can't impersonate admins
+	sess.Set(filters.SessionUserKey, admin.Id.Hex())
+	resp, err = impersonate(ts.URL, "POST", &impersonateEntity{User: admin.Id.Hex()})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = impersonate(ts.URL, "POST", &impersonateEntity{User: u.Id.Hex()})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	userId, _ := sess.Get(filters.SessionUserKey)
+	require.Equal(t, u.Id.Hex(), userId)
+	adminId, _ := sess.Get(filters.SessionImpersonatorKey)
+	require.Equal(t, admin.Id.Hex(), adminId)
+
+	// impersonated user can't impersonate again
+	resp, err = impersonate(ts.URL, "POST", &impersonateEntity{User: u.Id.Hex()})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err = impersonate(ts.URL, "DELETE", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	userId, _ = sess.Get(filters.SessionUserKey)
+	require.Equal(t, admin.Id.Hex(), userId)
+	_, existed := sess.Get(filters.SessionImpersonatorKey)
+	require.False(t, existed)
+
+	events, count, err := mgr.Audit.FilterByQuery(bson.M{"user": u.Id}, mgr.Opts(0, 0, []string{"_id"}))
+	require.NoError(t, err)
+	// both requests of the impersonated session are recorded
+	require.Equal(t, 4, count)
+	require.Equal(t, audit.TypeImpersonationStarted, events[0].Type)
+	require.Equal(t, audit.TypeImpersonatedRequest, events[1].Type)
+	require.Equal(t, "POST /api/v1/auth/impersonate", events[1].Request)
+	require.Equal(t, admin.Id, events[1].Actor)
+	require.Equal(t, audit.TypeImpersonatedRequest, events[2].Type)
+	require.Equal(t, "DELETE /api/v1/auth/impersonate", events[2].Request)
+	require.Equal(t, audit.TypeImpersonationStopped, events[3].Type)
+}
+
+func impersonate(baseUrl, method string, entity *impersonateEntity) (*http.Response, error) {
+	buf := bytes.NewBuffer(nil)
+	if entity != nil {
+		if err := json.NewEncoder(buf).Encode(entity); err != nil {
+			return nil, err
+		}
+	}
+	req, _ := http.NewRequest(method, fmt.Sprintf("%s/api/v1/auth/impersonate", baseUrl), buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	return http.DefaultClient.Do(req)
+}
+
 func resetPassword(baseUrl string, entity *resetPasswordEntity) (*http.Response, error) {
 	u, err := url.Parse(fmt.Sprintf("%s/api/v1/auth/reset-password", baseUrl))
 	if err != nil {
@@ -129,11 +217,22 @@ func resetPassword(baseUrl string, entity *resetPasswordEntity) (*http.Response,
 	return resp, err
 }
 
-func getServiceError(t *testing.T, res *http.Response) *restful.ServiceError {
-	e := &restful.ServiceError{}
+func getServiceError(t *testing.T, res *http.Response) *services.ServiceError {
+	e := &services.ServiceError{}
 	err := json.NewDecoder(res.Body).Decode(e)
 	if err != nil {
 		t.Fatal(err)
 	}
 	return e
 }
+
+func TestAllowedDomain(t *testing.T) {
+	require.True(t, allowedDomain(nil, "user@example.com"))
+	domains := []string{"corp.com", "@Dev.Corp.com"}
+	require.True(t, allowedDomain(domains, "user@corp.com"))
+	require.True(t, allowedDomain(domains, "user@CORP.com"))
+	require.True(t, allowedDomain(domains, "user@dev.corp.com"))
+	require.False(t, allowedDomain(domains, "user@evilcorp.com"))
+	require.False(t, allowedDomain(domains, "user@corp.com.evil.com"))
+	require.False(t, allowedDomain(domains, "corp.com"))
+}
@@ -1,5 +1,7 @@
 package auth
 
+import "time"
+
 type authEntity struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -21,3 +23,12 @@ type registerEntity struct {
 type resetPasswordEntity struct {
 	Email string `json:"email" valid:"email,required"`
 }
+
+type resetLinkEntity struct {
+	Url    string    `json:"url" description:"link to create the new password"`
+	Expire time.Time `json:"expire"`
+}
+
+type impersonateEntity struct {
+	User string `json:"user" description:"id of the user to impersonate"`
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/authz"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+// Action is what the subject is going to do with the resource
+type Action string
+
+const (
+	// resource is *project.Project
+	ActionProjectAccess Action = "project.access"
+)
+
+// Authorizer is consulted for access decisions, resource type depends on the action
+type Authorizer interface {
+	Authorize(mgr *manager.Manager, u *user.User, action Action, resource interface{}) (bool, error)
+}
+
+type AuthorizerFunc func(*manager.Manager, *user.User, Action, interface{}) (bool, error)
+
+func (f AuthorizerFunc) Authorize(mgr *manager.Manager, u *user.User, action Action, resource interface{}) (bool, error) {
+	return f(mgr, u, action, resource)
+}
+
+// DefaultAuthorizer makes decisions with built-in permissions
+type DefaultAuthorizer struct{}
+
+func (DefaultAuthorizer) Authorize(mgr *manager.Manager, u *user.User, action Action, resource interface{}) (bool, error) {
+	switch action {
+	case ActionProjectAccess:
+		p, ok := resource.(*project.Project)
+		if !ok {
+			return false, fmt.Errorf("%s expects project, got %T", action, resource)
+		}
+		return mgr.Permission.HasProjectAccess(p, u), nil
+	}
+	return false, fmt.Errorf("unknown action %s", action)
+}
+
+// PolicyAuthorizer asks the external policy engine, the decision of Default is passed in the input
+type PolicyAuthorizer struct {
+	Client  *authz.Client
+	Default Authorizer
+}
+
+func (a *PolicyAuthorizer) Authorize(mgr *manager.Manager, u *user.User, action Action, resource interface{}) (bool, error) {
+	allowed, err := a.Default.Authorize(mgr, u, action, resource)
+	if err != nil {
+		return false, err
+	}
+	input := &authz.Input{
+		Subject: authz.Subject{
+			Id:      u.Id.Hex(),
+			Email:   u.Email,
+			Admin:   mgr.Permission.IsAdmin(u),
+			Service: u.IsService(),
+		},
+		Action:   string(action),
+		Resource: policyResource(resource),
+		Default:  allowed,
+	}
+	return a.Client.Allow(input)
+}
+
+func policyResource(resource interface{}) authz.Resource {
+	switch r := resource.(type) {
+	case *project.Project:
+		return authz.Resource{Type: "project", Id: r.Id.Hex(), Project: r.Id.Hex()}
+	}
+	return authz.Resource{Type: fmt.Sprintf("%T", resource)}
+}
+
+var authorizer Authorizer = DefaultAuthorizer{}
+
+// SetAuthorizer replaces built-in permissions for all services, it should be called before serving.
+// The default authorizer is restored if nil.
+func SetAuthorizer(a Authorizer) {
+	if a == nil {
+		a = DefaultAuthorizer{}
+	}
+	authorizer = a
+}
+
+func Authorize(mgr *manager.Manager, u *user.User, action Action, resource interface{}) (bool, error) {
+	return authorizer.Authorize(mgr, u, action, resource)
+}
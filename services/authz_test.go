@@ -0,0 +1,43 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+func TestSetAuthorizer(t *testing.T) {
+	defer SetAuthorizer(nil)
+	u := &user.User{Id: bson.NewObjectId()}
+	p := &project.Project{Id: bson.NewObjectId(), Owner: u.Id}
+
+	calls := 0
+	SetAuthorizer(AuthorizerFunc(func(_ *manager.Manager, subject *user.User, action Action, resource interface{}) (bool, error) {
+		calls++
+		require.Equal(t, u, subject)
+		require.Equal(t, ActionProjectAccess, action)
+		require.Equal(t, p, resource)
+		return false, nil
+	}))
+	ok, sErr := HasProjectPermission(nil, u, p)
+	require.False(t, ok)
+	require.Nil(t, sErr)
+	require.Equal(t, 1, calls)
+
+	SetAuthorizer(AuthorizerFunc(func(*manager.Manager, *user.User, Action, interface{}) (bool, error) {
+		return true, fmt.Errorf("engine is down")
+	}))
+	ok, sErr = HasProjectPermission(nil, u, p)
+	require.False(t, ok)
+	require.Equal(t, http.StatusInternalServerError, sErr.Code)
+
+	SetAuthorizer(nil)
+	require.Equal(t, DefaultAuthorizer{}, authorizer)
+}
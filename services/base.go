@@ -1,13 +1,30 @@
 package services
 
 import (
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/audit"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/alert"
+	"github.com/bearded-web/bearded/pkg/antivirus"
+	"github.com/bearded-web/bearded/pkg/cache"
 	"github.com/bearded-web/bearded/pkg/config"
 	"github.com/bearded-web/bearded/pkg/email"
+	"github.com/bearded-web/bearded/pkg/hibp"
 	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/normalize"
 	"github.com/bearded-web/bearded/pkg/pagination"
 	"github.com/bearded-web/bearded/pkg/passlib"
+	"github.com/bearded-web/bearded/pkg/quota"
 	"github.com/bearded-web/bearded/pkg/scheduler"
+	"github.com/bearded-web/bearded/pkg/store"
 	"github.com/bearded-web/bearded/pkg/template"
+	"github.com/bearded-web/bearded/pkg/utils/async"
+	"github.com/bearded-web/bearded/pkg/validate"
 	"github.com/emicklei/go-restful"
 )
 
@@ -19,8 +36,38 @@ type BaseService struct {
 	apiCfg    config.Api
 	Template  template.Renderer
 	Paginator *pagination.Paginator
+
+	PasswordPolicy *validate.PasswordPolicy
+	// optional check of passwords against known breaches, disabled if nil
+	Pwned *hibp.Client
+	// optional check of uploaded files, they aren't checked if nil
+	Antivirus antivirus.Scanner
+	// state shared between dispatchers, like caches
+	Store store.Store
+	// optional alerts about privilege changes
+	Alerter *alert.Alerter
+	// operational incidents, like failed sessions, they are only logged if nil
+	Incidents *alert.Reporter
+	// owners of unattended scans which are failed or aren't dispatched, they aren't notified if nil
+	Notifier *alert.ScanNotifier
+	// starts waiting scans of groups, scans of groups aren't limited if nil
+	Groups *scheduler.GroupQueue
+	// sets purge dates of raw output of new reports, output isn't purged if nil
+	Outputs *scheduler.OutputPruner
+	// adapters of plugin output, they are registered by the plugin service
+	Normalizer *normalize.Registry
+	// bounds goroutines of bulk operations
+	Pool *async.Pool
+	// usage of users and their quotas, usage isn't counted if nil
+	Quota *quota.Tracker
+	// checks of authenticated users, they are passed to the auth filter of services
+	AuthChecks []AuthCheck
 }
 
+// AuthCheck is called by the auth filter after the user is authenticated,
+// it writes the error and returns false if the request is rejected
+type AuthCheck func(req *restful.Request, resp *restful.Response, u *user.User) bool
+
 func New(mgr *manager.Manager, passCtx *passlib.Context,
 	sch scheduler.Scheduler, mailer email.Mailer, cfg config.Api) *BaseService {
 
@@ -31,14 +78,49 @@ func New(mgr *manager.Manager, passCtx *passlib.Context,
 		mailer:    mailer,
 		apiCfg:    cfg,
 		Paginator: pagination.New(),
+
+		PasswordPolicy: validate.DefaultPasswordPolicy,
+		Store:          store.NewMemory(),
+		Normalizer:     normalize.NewRegistry(),
+		Pool:           async.NewPool(cfg.Concurrency),
 	}
 }
 
-// Get copy of the manager, don't forget to close it
-func (s *BaseService) Manager() *manager.Manager {
+// Get copy of the manager for work outside of requests, like agent channels and processing of reports,
+// reads aren't limited by the scope. Handlers use RequestManager. Don't forget to close it.
+func (s *BaseService) BackgroundManager() *manager.Manager {
 	return s.manager.Copy()
 }
 
+// Get copy of the manager which gives up on the request deadline, don't forget to close it.
+// Reads of the manager are limited to the request scope if it's set.
+func (s *BaseService) RequestManager(req *restful.Request) *manager.Manager {
+	mgr := s.manager.CopyCtx(Context(req))
+	if sc, ok := req.Attribute(scopeAttr).(*manager.Scope); ok {
+		mgr.WithScope(sc)
+	}
+	return mgr
+}
+
+const scopeAttr = "__scope"
+
+// SetScope limits reads of request managers to projects of the scope, nil scope doesn't limit them
+func SetScope(req *restful.Request, sc *manager.Scope) {
+	if sc != nil {
+		req.SetAttribute(scopeAttr, sc)
+	}
+}
+
+// Route filter for known long requests, like reports
+func (s *BaseService) LongTimeout() restful.FilterFunction {
+	return Timeout(time.Duration(s.apiCfg.LongRequestTimeout) * time.Second)
+}
+
+// LargeBody raises the body limit for uploads
+func (s *BaseService) LargeBody() restful.FilterFunction {
+	return BodyLimit(int64(s.apiCfg.LargeBodySize))
+}
+
 // Get the original manager, don't close it!
 func (s *BaseService) BaseManager() *manager.Manager {
 	return s.manager
@@ -60,6 +142,88 @@ func (s *BaseService) ApiCfg() config.Api {
 	return s.apiCfg
 }
 
+const signupSetting = "signup"
+
+// Signup returns signup settings, the ones which are changed by admins are preferred to the config
+func (s *BaseService) Signup(mgr *manager.Manager) (config.Signup, error) {
+	result := config.Signup{}
+	if err := mgr.Settings.Get(signupSetting, &result); err != nil {
+		if mgr.IsNotFound(err) {
+			return s.apiCfg.Signup, nil
+		}
+		return s.apiCfg.Signup, err
+	}
+	return result, nil
+}
+
+// SetSignup changes signup settings of all dispatchers, nil resets them to the config
+func (s *BaseService) SetSignup(mgr *manager.Manager, signup *config.Signup) error {
+	if signup == nil {
+		return mgr.Settings.Reset(signupSetting)
+	}
+	return mgr.Settings.Set(signupSetting, signup)
+}
+
+// Cache for hot reads shared through the store, entries live for the configured cache duration
+func (s *BaseService) Cache(name string) *cache.Cache {
+	return cache.New(s.Store, name, time.Duration(s.apiCfg.CacheDuration)*time.Second)
+}
+
+// Audit records the privilege change and sends alerts about it.
+// The change is already done, so errors are only logged.
+func (s *BaseService) Audit(mgr *manager.Manager, ev *audit.Event) {
+	logrus.Warnf("Audit %s: %s", ev.Type, ev.Message)
+	if _, err := mgr.Audit.Create(ev); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+	if s.Alerter != nil {
+		s.Alerter.Send(alert.AuditAlert(ev))
+	}
+}
+
+// Record stores the event in the audit log without alerting admins,
+// it's used for changes which aren't privilege ones
+func (s *BaseService) Record(mgr *manager.Manager, ev *audit.Event) {
+	logrus.Infof("Audit %s: %s", ev.Type, ev.Message)
+	if _, err := mgr.Audit.Create(ev); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+}
+
+// Subject renders the localized email subject from the template, the fallback is used if there is no template
+func (s *BaseService) Subject(name, locale, fallback string) string {
+	if s.Template == nil {
+		return fallback
+	}
+	subject, err := s.Template.Text(name, nil, locale)
+	if err != nil || subject == "" {
+		return fallback
+	}
+	return subject
+}
+
+// Check the new password with the password policy, every violation is returned as a field error
+func (s *BaseService) CheckPassword(field, password string) *ErrResp {
+	reasons := s.PasswordPolicy.Check(password)
+	if len(reasons) == 0 && s.Pwned != nil {
+		pwned, err := s.Pwned.IsPwned(password)
+		if err != nil {
+			// breach check is optional, users shouldn't be blocked while the api is unavailable
+			logrus.Warnf("Password isn't checked against breaches: %s", err)
+		} else if pwned {
+			reasons = append(reasons, "was found in data breaches, choose another one")
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	fields := make([]*FieldError, 0, len(reasons))
+	for _, reason := range reasons {
+		fields = append(fields, &FieldError{Field: field, Reason: reason})
+	}
+	return &ErrResp{Code: http.StatusBadRequest, Err: NewFieldsErr(fields...)}
+}
+
 func (s *BaseService) Init() error {
 	return nil
 }
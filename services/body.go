@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+)
+
+// Request bodies are limited, so large payloads don't exhaust memory.
+// The dispatcher sets the default limit for every request, routes which accept large bodies raise it with BodyLimit.
+
+// LimitedBody reads the request body through http.MaxBytesReader, the limit can be changed until the body is read
+type LimitedBody struct {
+	io.ReadCloser
+	orig     io.ReadCloser
+	w        http.ResponseWriter
+	size     int64
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+// LimitBody replaces the body of the request, zero limit reads the body as is
+func LimitBody(w http.ResponseWriter, r *http.Request, limit int64) *LimitedBody {
+	b := &LimitedBody{orig: r.Body, w: w, size: r.ContentLength}
+	b.set(limit)
+	r.Body = b
+	return b
+}
+
+func (b *LimitedBody) set(limit int64) {
+	b.limit = limit
+	switch {
+	case limit > 0 && b.size > limit:
+		// the body isn't read at all if the client tells its size
+		b.ReadCloser = tooLargeBody{b.orig}
+	case limit > 0:
+		b.ReadCloser = http.MaxBytesReader(b.w, b.orig, limit)
+	default:
+		b.ReadCloser = b.orig
+	}
+}
+
+func (b *LimitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.limit > 0 && (b.size > b.limit || b.read >= b.limit) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+func (b *LimitedBody) Close() error {
+	return b.orig.Close()
+}
+
+// Exceeded returns true if the body is read over the limit
+func (b *LimitedBody) Exceeded() bool {
+	return b.exceeded
+}
+
+var errTooLarge = errors.New("http: request body too large")
+
+type tooLargeBody struct {
+	io.ReadCloser
+}
+
+func (tooLargeBody) Read([]byte) (int, error) {
+	return 0, errTooLarge
+}
+
+// BodyLimit is a route filter which overrides the default body limit for uploads and imports,
+// zero limit disables it.
+func BodyLimit(limit int64) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		if b, ok := req.Request.Body.(*LimitedBody); ok && b.read == 0 {
+			b.set(limit)
+		}
+		chain.ProcessFilter(req, resp)
+	}
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+const (
+	CacheControlHeader = "Cache-Control"
+	ExpiresHeader      = "Expires"
+)
+
+// CacheFor is a route filter of cacheable reads, browsers keep successful responses for max age seconds
+// and shared caches keep only public ones. Zero max age keeps the default header of the api.
+func CacheFor(maxAge int, public bool) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		if maxAge > 0 {
+			scope := "private"
+			if public {
+				scope = "public"
+			}
+			ttl := time.Duration(maxAge) * time.Second
+			resp.Header().Set(CacheControlHeader, fmt.Sprintf("%s, max-age=%d", scope, maxAge))
+			resp.Header().Set(ExpiresHeader, time.Now().Add(ttl).UTC().Format(http.TimeFormat))
+		}
+		chain.ProcessFilter(req, resp)
+	}
+}
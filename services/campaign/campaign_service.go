@@ -0,0 +1,405 @@
+package campaign
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/campaign"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/fltr"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/pagination"
+	"github.com/bearded-web/bearded/services"
+	scanService "github.com/bearded-web/bearded/services/scan"
+)
+
+const ParamId = "campaign-id"
+
+type CampaignService struct {
+	*services.BaseService
+	sorter *fltr.Sorter
+}
+
+func New(base *services.BaseService) *CampaignService {
+	return &CampaignService{
+		BaseService: base,
+		sorter:      fltr.NewSorter("created", "updated"),
+	}
+}
+
+func addDefaults(r *restful.RouteBuilder) {
+	r.Notes("Authorization required")
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusInternalServerError,
+	))
+}
+
+func (s *CampaignService) Register(container *restful.Container) {
+	ws := &restful.WebService{}
+	ws.Path("/api/v1/campaigns")
+	ws.Doc("Manage Campaigns")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+
+	r := ws.GET("").To(s.list)
+	r.Doc("list")
+	r.Operation("list")
+	r.Notes("Authorization required. Project is required.")
+	s.SetParams(r, fltr.GetParams(ws, manager.CampaignFltr{}))
+	r.Writes(campaign.CampaignList{})
+	r.Param(s.sorter.Param())
+	r.Param(s.Paginator.SkipParam())
+	r.Param(s.Paginator.LimitParam())
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	addDefaults(r)
+	ws.Route(r)
+
+	r = ws.POST("").To(s.create)
+	r.Doc("create")
+	r.Operation("create")
+	r.Notes("Authorization required. Create the campaign and start scans of its targets in the group with the campaign id.")
+	r.Reads(CampaignEntity{})
+	r.Writes(campaign.Campaign{})
+	r.Do(services.Returns(http.StatusCreated))
+	r.Do(services.ReturnsE(http.StatusBadRequest, services.StatusTooManyRequests))
+	addDefaults(r)
+	ws.Route(r)
+
+	r = ws.GET(fmt.Sprintf("{%s}", ParamId)).To(s.TakeCampaign(s.get))
+	r.Doc("get")
+	r.Operation("get")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Writes(campaign.Campaign{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	addDefaults(r)
+	ws.Route(r)
+
+	r = ws.GET(fmt.Sprintf("{%s}/issues", ParamId)).To(s.TakeCampaign(s.issues))
+	r.Doc("issues")
+	r.Operation("issues")
+	r.Notes("Authorization required. Issues reported by campaign scans.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(s.Paginator.SkipParam())
+	r.Param(s.Paginator.LimitParam())
+	r.Writes(issue.TargetIssueList{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	addDefaults(r)
+	ws.Route(r)
+
+	r = ws.GET(fmt.Sprintf("{%s}/report", ParamId)).To(s.TakeCampaign(s.report))
+	r.Doc("report")
+	r.Operation("report")
+	r.Notes("Authorization required. Combined report of campaign scans with issues by severity.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Writes(campaign.Report{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	addDefaults(r)
+	ws.Route(r)
+
+	container.Add(ws)
+}
+
+func (s *CampaignService) list(req *restful.Request, resp *restful.Response) {
+	query, err := fltr.FromRequest(req, manager.CampaignFltr{})
+	if err != nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
+		return
+	}
+	projectId, ok := query["project"].(bson.ObjectId)
+	if !ok {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("project is required"))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if _, sErr := s.takeProject(mgr, req, projectId); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	skip, limit := s.Paginator.Parse(req)
+	opt := manager.Opts{
+		Sort:  s.sorter.Parse(req),
+		Limit: limit,
+		Skip:  skip,
+	}
+	results, count, err := mgr.Campaigns.FilterByQuery(query, opt)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	previous, next := s.Paginator.Urls(req, skip, limit, count)
+	resp.WriteEntity(&campaign.CampaignList{
+		Meta:    pagination.Meta{Count: count, Previous: previous, Next: next},
+		Results: results,
+	})
+}
+
+func (s *CampaignService) create(req *restful.Request, resp *restful.Response) {
+	raw := &CampaignEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	for _, id := range raw.Targets {
+		if !s.IsId(id) {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("wrong target id %s", id))
+			return
+		}
+	}
+	u := filters.GetUser(req)
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	p, sErr := s.takeProject(mgr, req, mgr.ToId(raw.Project))
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	planObj, sErr := scanService.TakePlan(mgr, p, raw.Plan)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	targets := []bson.ObjectId{}
+	if len(raw.Targets) > 0 {
+		seen := map[string]bool{}
+		for _, id := range raw.Targets {
+			if !seen[id] {
+				seen[id] = true
+				targets = append(targets, mgr.ToId(id))
+			}
+		}
+	} else {
+		found, _, err := mgr.Targets.FilterActive(bson.M{"project": p.Id, "type": planObj.TargetType})
+		if err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		for _, t := range found {
+			targets = append(targets, t.Id)
+		}
+	}
+	if len(targets) == 0 {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("project has no targets for the plan"))
+		return
+	}
+
+	// scans are built before the campaign is saved, so wrong targets don't leave an empty campaign
+	scans := make([]*scan.Scan, 0, len(targets))
+	for _, id := range targets {
+		sc, errResp := scanService.NewScan(mgr, u.Id, &scan.Scan{Project: p.Id, Target: id, Plan: planObj.Id})
+		if errResp != nil {
+			errResp.Write(resp)
+			return
+		}
+		scans = append(scans, sc)
+	}
+
+	obj, err := mgr.Campaigns.Create(&campaign.Campaign{
+		Name:    raw.Name,
+		Project: p.Id,
+		Owner:   u.Id,
+		Plan:    planObj.Id,
+		Targets: targets,
+	})
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	if err := scanService.StartGroup(s.BaseService, mgr, obj.Id, scans); err != nil {
+		if sErr, ok := err.(*services.ErrResp); ok {
+			// nothing is started over the quota, so the campaign isn't kept
+			if err := mgr.Campaigns.Remove(obj); err != nil {
+				logrus.Error(stackerr.Wrap(err))
+			}
+			sErr.Write(resp)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	logrus.Infof("Campaign %s of project %s is started by %s with %d scans", obj, p, u, len(scans))
+
+	if obj.Status, err = mgr.Scans.GetGroupStatus(obj.Id, p.Id); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(obj)
+}
+
+func (s *CampaignService) get(req *restful.Request, resp *restful.Response, obj *campaign.Campaign) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	status, err := mgr.Scans.GetGroupStatus(obj.Id, obj.Project)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	obj.Status = status
+	resp.WriteEntity(obj)
+}
+
+func (s *CampaignService) issues(req *restful.Request, resp *restful.Response, obj *campaign.Campaign) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	scans, _, err := mgr.Scans.FilterByQuery(bson.M{"group": obj.Id, "project": obj.Project})
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	ids := make([]bson.ObjectId, 0, len(scans))
+	for _, sc := range scans {
+		ids = append(ids, sc.Id)
+	}
+
+	skip, limit := s.Paginator.Parse(req)
+	query := bson.M{"activities.report.scan": bson.M{"$in": ids}}
+	results, count, err := mgr.Issues.FilterByQuery(query, mgr.Opts(skip, limit, []string{"-created"}))
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	previous, next := s.Paginator.Urls(req, skip, limit, count)
+	resp.WriteEntity(&issue.TargetIssueList{
+		Meta:    pagination.Meta{Count: count, Previous: previous, Next: next},
+		Results: results,
+	})
+}
+
+func (s *CampaignService) report(req *restful.Request, resp *restful.Response, obj *campaign.Campaign) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	scans, _, err := mgr.Scans.FilterByQuery(bson.M{"group": obj.Id, "project": obj.Project})
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	status := &scan.GroupStatus{Group: obj.Id}
+	result := &campaign.Report{
+		Campaign: obj,
+		Issues:   map[issue.Severity]int{},
+		Targets:  make([]*campaign.TargetReport, 0, len(scans)),
+	}
+	for _, sc := range scans {
+		status.Add(sc)
+		// every issue belongs to one target, so summaries of scans of different targets are summed up
+		summary, err := mgr.Issues.GetScanSummary(sc.Id, "")
+		if err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		for severity, count := range summary {
+			result.Issues[severity] += count
+		}
+		result.Targets = append(result.Targets, &campaign.TargetReport{
+			Target: sc.Target,
+			Scan:   sc.Id,
+			Status: sc.Status,
+			Passed: sc.Passed,
+			Issues: summary,
+		})
+	}
+	obj.Status = status
+	resp.WriteEntity(result)
+}
+
+// takeProject checks that the project exists and the user has permission to it
+func (s *CampaignService) takeProject(mgr *manager.Manager, req *restful.Request, id bson.ObjectId) (*project.Project, *services.ErrResp) {
+	p, err := mgr.Projects.GetById(id)
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			return nil, &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("project not found")}
+		}
+		logrus.Error(stackerr.Wrap(err))
+		return nil, &services.ErrResp{Err: services.DbErr}
+	}
+	if sErr := services.Must(services.HasProjectPermission(mgr, filters.GetUser(req), p)); sErr != nil {
+		return nil, sErr
+	}
+	return p, nil
+}
+
+type CampaignFunction func(*restful.Request, *restful.Response, *campaign.Campaign)
+
+func (s *CampaignService) TakeCampaign(fn CampaignFunction) restful.RouteFunction {
+	return func(req *restful.Request, resp *restful.Response) {
+		id := req.PathParameter(ParamId)
+		if !s.IsId(id) {
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+			return
+		}
+
+		mgr := s.RequestManager(req)
+		defer mgr.Close()
+
+		obj, err := mgr.Campaigns.GetById(mgr.ToId(id))
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusNotFound, services.NewNotFound("Campaign not found"))
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		p, err := mgr.Projects.GetById(obj.Project)
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusNotFound, services.NewNotFound("Project not found"))
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		if sErr := services.Must(services.HasProjectPermission(mgr, filters.GetUser(req), p)); sErr != nil {
+			sErr.Write(resp)
+			return
+		}
+
+		mgr.Close()
+
+		fn(req, resp, obj)
+	}
+}
@@ -0,0 +1,130 @@
+package campaign
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/campaign"
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/plugin"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/email"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/scheduler"
+	"github.com/bearded-web/bearded/pkg/tests"
+	"github.com/bearded-web/bearded/services"
+)
+
+var (
+	testMgr *manager.Manager
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(func() int {
+		mongo, dbName, err := tests.RandomTestMongoUp()
+		if err != nil {
+			println(err)
+			os.Exit(1)
+		}
+		defer tests.RandomTestMongoDown(mongo, dbName)
+		testMgr = manager.New(mongo.DB(dbName))
+		return m.Run()
+	}())
+}
+
+func TestCampaigns(t *testing.T) {
+	sess := filters.NewSession()
+	u, err := testMgr.Users.Create(&user.User{})
+	require.NoError(t, err)
+	sess.Set(filters.SessionUserKey, u.Id.Hex())
+
+	service := New(services.New(testMgr, nil, scheduler.NewFake(),
+		email.NewConsoleBackend(), config.NewDispatcher().Api))
+	wsContainer := restful.NewContainer()
+	wsContainer.Router(restful.CurlyRouter{})
+	wsContainer.Filter(filters.SessionFilterMock(sess))
+	service.Register(wsContainer)
+	ts := httptest.NewServer(wsContainer)
+	defer ts.Close()
+
+	_, err = testMgr.Plugins.Create(&plugin.Plugin{Name: "campaign/plugin", Version: "0.1", Enabled: true})
+	require.NoError(t, err)
+	planObj, err := testMgr.Plans.Create(&plan.Plan{Name: "campaign", TargetType: target.TypeWeb,
+		Workflow: []*plan.WorkflowStep{{Plugin: "campaign/plugin:0.1", Name: "step"}}})
+	require.NoError(t, err)
+	p, err := testMgr.Projects.Create(&project.Project{Name: "campaign", Owner: u.Id, Plan: planObj.Id})
+	require.NoError(t, err)
+	targets := []bson.ObjectId{}
+	for _, domain := range []string{"http://a.example.com", "http://b.example.com"} {
+		obj, err := testMgr.Targets.Create(&target.Target{Project: p.Id, Type: target.TypeWeb,
+			Web: &target.WebTarget{Domain: domain}})
+		require.NoError(t, err)
+		targets = append(targets, obj.Id)
+	}
+	// targets of other types aren't scanned with the plan
+	_, err = testMgr.Targets.Create(&target.Target{Project: p.Id, Type: target.TypeAndroid})
+	require.NoError(t, err)
+
+	do := func(method, path string, body interface{}) *http.Response {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		req, err := http.NewRequest(method, ts.URL+"/api/v1/campaigns"+path, bytes.NewBuffer(data))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := do("POST", "", &CampaignEntity{Name: "quarterly", Project: p.Id.Hex()})
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	obj := &campaign.Campaign{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(obj))
+	require.Equal(t, planObj.Id, obj.Plan, "the default plan of the project is used")
+	require.Len(t, obj.Targets, 2)
+	require.Equal(t, 2, obj.Status.Total)
+
+	scans, count, err := testMgr.Scans.FilterByQuery(bson.M{"group": obj.Id})
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	scanned := map[bson.ObjectId]bool{}
+	for _, sc := range scans {
+		scanned[sc.Target] = true
+	}
+	require.Equal(t, map[bson.ObjectId]bool{targets[0]: true, targets[1]: true}, scanned)
+
+	require.NoError(t, testMgr.Scans.Transition(scans[0], scan.StatusFinished))
+	res = do("GET", "/"+obj.Id.Hex()+"/report", nil)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	rep := &campaign.Report{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(rep))
+	require.Len(t, rep.Targets, 2)
+	require.Equal(t, 1, rep.Campaign.Status.Done)
+
+	res = do("POST", "", &CampaignEntity{Name: "wrong", Project: p.Id.Hex(), Targets: []string{"wrong"}})
+	defer res.Body.Close()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	// wrong targets don't leave a campaign
+	_, count, err = testMgr.Campaigns.FilterByQuery(bson.M{"project": p.Id})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	res = do("GET", "?project="+bson.NewObjectId().Hex(), nil)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode, "project isn't found")
+}
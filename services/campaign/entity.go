@@ -0,0 +1,8 @@
+package campaign
+
+type CampaignEntity struct {
+	Name    string   `json:"name" description:"campaign name, 80 symbols max" validate:"nonzero,max=80"`
+	Project string   `json:"project" validate:"nonzero,bsonId"`
+	Plan    string   `json:"plan,omitempty" description:"the default plan of the project if empty"`
+	Targets []string `json:"targets,omitempty" description:"target ids, all project targets compatible with the plan if empty"`
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+
+	"github.com/bearded-web/bearded/models/compliance"
+)
+
+// Compliance scope of targets and projects is a set of framework ids, e.g. pci or soc2
+
+const ComplianceParam = "compliance"
+
+// ComplianceQueryParam describes query parameter for filtering by the compliance framework
+func ComplianceQueryParam(ws *restful.WebService) *restful.Parameter {
+	return ws.QueryParameter(ComplianceParam, fmt.Sprintf("filter by the compliance framework, one of %v", compliance.Ids()))
+}
+
+// ParseCompliance checks framework ids, the result is sorted without duplicates
+func ParseCompliance(ids []string) ([]string, *ErrResp) {
+	set := map[string]struct{}{}
+	for _, id := range ids {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if compliance.Get(id) == nil {
+			return nil, &ErrResp{Code: http.StatusBadRequest,
+				Err: NewBadReq("Compliance: framework %q should be one of %v", id, compliance.Ids())}
+		}
+		set[id] = struct{}{}
+	}
+	result := make([]string, 0, len(set))
+	for id := range set {
+		result = append(result, id)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// ComplianceFramework returns the framework from the query parameter, nil if it isn't set
+func ComplianceFramework(req *restful.Request) (*compliance.Framework, *ErrResp) {
+	id := req.QueryParameter(ComplianceParam)
+	if id == "" {
+		return nil, nil
+	}
+	f := compliance.Get(strings.ToLower(id))
+	if f == nil {
+		return nil, &ErrResp{Code: http.StatusBadRequest,
+			Err: NewBadReq("%s should be one of %v", ComplianceParam, compliance.Ids())}
+	}
+	return f, nil
+}
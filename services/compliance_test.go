@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bearded-web/bearded/models/compliance"
+	"github.com/bearded-web/bearded/models/issue"
+)
+
+func TestParseCompliance(t *testing.T) {
+	frameworks, sErr := ParseCompliance([]string{"soc2", " PCI ", "pci"})
+	assert.Nil(t, sErr)
+	assert.Equal(t, []string{"pci", "soc2"}, frameworks)
+
+	frameworks, sErr = ParseCompliance([]string{})
+	assert.Nil(t, sErr)
+	assert.Equal(t, []string{}, frameworks)
+
+	_, sErr = ParseCompliance([]string{"pci", "gdpr"})
+	assert.NotNil(t, sErr)
+}
+
+func TestComplianceMatch(t *testing.T) {
+	pci := compliance.Get(compliance.FrameworkPci)
+	ids := func(controls []*compliance.Control) []string {
+		result := []string{}
+		for _, c := range controls {
+			result = append(result, c.Id)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"6.2.4"}, ids(pci.Match([]string{"79"}, "")))
+	assert.Equal(t, []string{"2.2", "4.2.1"}, ids(pci.Match([]string{"16", "319"}, issue.ClassXss)))
+	// classes are used only for issues without cwes
+	assert.Equal(t, []string{"8.3"}, ids(pci.Match(nil, issue.ClassAuth)))
+	assert.Empty(t, pci.Match([]string{"1"}, issue.ClassAuth))
+	assert.Empty(t, pci.Match(nil, issue.ClassOther))
+}
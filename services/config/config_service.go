@@ -1,10 +1,23 @@
 package config
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
 
+	"github.com/bearded-web/bearded/models/audit"
+	"github.com/bearded-web/bearded/models/compliance"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/logging"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/passlib"
 	"github.com/bearded-web/bearded/services"
 )
 
@@ -33,17 +46,129 @@ func (s *ConfigService) Register(container *restful.Container) {
 		http.StatusOK))
 	ws.Route(r)
 
+	r = ws.GET("/password").To(s.password)
+	r.Doc("password")
+	r.Operation("password")
+	r.Notes("Effective password hashing policy, available only for admins")
+	r.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	r.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+	r.Writes(passlib.Policy{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusForbidden))
+	ws.Route(r)
+
+	r = ws.GET("/log").To(s.log)
+	r.Doc("log")
+	r.Operation("log")
+	r.Notes("Current log levels of the dispatcher, available only for admins")
+	r.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	r.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+	r.Writes(LogEntity{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusForbidden))
+	ws.Route(r)
+
+	r = ws.PUT("/log").To(s.logUpdate)
+	r.Doc("logUpdate")
+	r.Operation("logUpdate")
+	r.Notes("Change log levels until restart, only levels in the request are changed. " +
+		"Every dispatcher has own levels. Available only for admins")
+	r.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	r.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+	r.Reads(LogEntity{})
+	r.Writes(LogEntity{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusUnauthorized,
+		http.StatusForbidden))
+	ws.Route(r)
+
+	r = ws.PUT("/signup").To(s.signupUpdate)
+	r.Doc("signupUpdate")
+	r.Operation("signupUpdate")
+	r.Notes("Disable self-registration or limit it to email domains for all dispatchers, " +
+		"the settings are preferred to the config until they are reset. Available only for admins")
+	r.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	r.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+	r.Reads(Signup{})
+	r.Writes(Signup{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusUnauthorized,
+		http.StatusForbidden))
+	ws.Route(r)
+
+	r = ws.DELETE("/signup").To(s.signupReset)
+	r.Doc("signupReset")
+	r.Operation("signupReset")
+	r.Notes("Reset signup settings to the config. Available only for admins")
+	r.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	r.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+	r.Writes(Signup{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusForbidden))
+	ws.Route(r)
+
+	r = ws.GET("/queries").To(s.queries)
+	r.Doc("queries")
+	r.Operation("queries")
+	r.Notes("Timings of db operations by collections since start, the slowest first. " +
+		"Every dispatcher has own timings. Available only for admins")
+	r.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	r.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+	r.Writes([]*manager.QueryStat{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusForbidden))
+	ws.Route(r)
+
+	r = ws.POST("/reindex").To(s.reindex)
+	r.Doc("reindex")
+	r.Operation("reindex")
+	r.Notes("Create missed indexes and rebuild changed text indexes without restart. " +
+		"With background=true the request isn't waiting for large collections, the result is logged. " +
+		"Available only for admins")
+	r.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	r.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+	r.Filter(s.LongTimeout())
+	r.Param(ws.QueryParameter("background", "return immediately and rebuild indexes in background").DataType("boolean"))
+	r.Writes([]*manager.IndexReport{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusAccepted))
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusForbidden))
+	ws.Route(r)
+
 	container.Add(ws)
 }
 
 // ====== service operations
 
-func (s *ConfigService) get(_ *restful.Request, resp *restful.Response) {
+func (s *ConfigService) get(req *restful.Request, resp *restful.Response) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
 	cfg := s.ApiCfg()
+	signup, err := s.Signup(mgr)
+	if err != nil {
+		// the config is still usable with signup settings of the dispatcher
+		logrus.Error(stackerr.Wrap(err))
+	}
 	ent := &ConfigEntity{
-		Signup: Signup{
-			Disable: cfg.Signup.Disable,
-		},
+		Signup:     signupEntity(signup),
+		Severities: issue.GetScheme(),
+		Compliance: compliance.Frameworks,
 	}
 	if cfg.Raven != "" {
 		ent.Raven.Enable = true
@@ -53,5 +178,217 @@ func (s *ConfigService) get(_ *restful.Request, resp *restful.Response) {
 		ent.GA.Enable = true
 		ent.GA.Id = cfg.GA
 	}
+	// config is read from the file on start, so it's kept in memory already,
+	// clients like the website could cache it instead of asking on every page
+	if cfg.CacheDuration > 0 {
+		resp.AddHeader("Cache-Control", fmt.Sprintf("public, max-age=%d", cfg.CacheDuration))
+	}
 	resp.WriteEntity(ent)
 }
+
+func (s *ConfigService) password(req *restful.Request, resp *restful.Response) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	if !mgr.Permission.IsAdmin(u) {
+		logrus.Warnf("User %s try to get password policy without admin permission", u)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+	resp.WriteEntity(s.PassCtx().Policy())
+}
+
+func (s *ConfigService) log(req *restful.Request, resp *restful.Response) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	if !mgr.Permission.IsAdmin(u) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+	resp.WriteEntity(logLevels())
+}
+
+func (s *ConfigService) logUpdate(req *restful.Request, resp *restful.Response) {
+	raw := &LogEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	if !mgr.Permission.IsAdmin(u) {
+		logrus.Warnf("User %s try to change log levels without admin permission", u)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	levels := map[string]string{}
+	for name, level := range raw.Subsystems {
+		if name == "" {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("subsystem name is required"))
+			return
+		}
+		levels[name] = level
+	}
+	if raw.Level != "" {
+		levels[""] = raw.Level
+	}
+	if err := logging.SetLevels(levels); err != nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("%s", err.Error()))
+		return
+	}
+	logrus.Warnf("User %s changed log levels to %v", u, levels)
+	resp.WriteEntity(logLevels())
+}
+
+func logLevels() *LogEntity {
+	levels := logging.Levels()
+	ent := &LogEntity{Level: levels[""], Subsystems: map[string]string{}}
+	for _, name := range logging.Names() {
+		ent.Subsystems[name] = levels[name]
+	}
+	return ent
+}
+
+func (s *ConfigService) signupUpdate(req *restful.Request, resp *restful.Response) {
+	raw := &Signup{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	signup := &config.Signup{Disable: raw.Disable}
+	for _, domain := range raw.Domains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain == "" || strings.ContainsAny(domain, "@ /") {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("wrong domain %q", domain))
+			return
+		}
+		signup.Domains = append(signup.Domains, domain)
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	if !mgr.Permission.IsAdmin(u) {
+		logrus.Warnf("User %s try to change signup settings without admin permission", u)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+	if err := s.SetSignup(mgr, signup); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	s.auditSignup(mgr, u, *signup)
+	resp.WriteEntity(signupEntity(*signup))
+}
+
+func (s *ConfigService) signupReset(req *restful.Request, resp *restful.Response) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	if !mgr.Permission.IsAdmin(u) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+	if err := s.SetSignup(mgr, nil); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	signup := s.ApiCfg().Signup
+	s.auditSignup(mgr, u, signup)
+	resp.WriteEntity(signupEntity(signup))
+}
+
+func (s *ConfigService) auditSignup(mgr *manager.Manager, u *user.User, signup config.Signup) {
+	state := "enabled"
+	if signup.Disable {
+		state = "disabled"
+	} else if len(signup.Domains) > 0 {
+		state = fmt.Sprintf("limited to %s", strings.Join(signup.Domains, ", "))
+	}
+	s.Audit(mgr, &audit.Event{
+		Type:    audit.TypeSignupChanged,
+		Actor:   u.Id,
+		Email:   u.Email,
+		Message: fmt.Sprintf("Admin %s changed signup, it's %s", u.Email, state),
+	})
+}
+
+func signupEntity(signup config.Signup) Signup {
+	return Signup{Disable: signup.Disable, Domains: signup.Domains}
+}
+
+func (s *ConfigService) queries(req *restful.Request, resp *restful.Response) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	if !mgr.Permission.IsAdmin(u) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+	stats := []*manager.QueryStat{}
+	if mgr.Cfg.Queries != nil {
+		stats = mgr.Cfg.Queries.List()
+	}
+	resp.WriteEntity(stats)
+}
+
+func (s *ConfigService) reindex(req *restful.Request, resp *restful.Response) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	if !mgr.Permission.IsAdmin(u) {
+		logrus.Warnf("User %s try to rebuild indexes without admin permission", u)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+	logrus.Warnf("User %s rebuilds indexes", u)
+
+	if req.QueryParameter("background") == "true" {
+		// the request manager is closed with the request
+		bgMgr := s.BackgroundManager()
+		go func() {
+			defer bgMgr.Close()
+			reports, err := bgMgr.Reindex()
+			if err != nil {
+				logrus.Error(stackerr.Wrap(err))
+				return
+			}
+			logReindex(reports)
+		}()
+		resp.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	reports, err := mgr.Reindex()
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	logReindex(reports)
+	resp.WriteEntity(reports)
+}
+
+func logReindex(reports []*manager.IndexReport) {
+	for _, report := range reports {
+		if len(report.Created) > 0 {
+			logrus.Infof("Indexes of %s are created: %v", report.Collection, report.Created)
+		}
+	}
+	logrus.Infof("Indexes of %d collections are rebuilt", len(reports))
+}
@@ -1,5 +1,10 @@
 package config
 
+import (
+	"github.com/bearded-web/bearded/models/compliance"
+	"github.com/bearded-web/bearded/models/issue"
+)
+
 type Raven struct {
 	Enable  bool   `json:"enable"`
 	Address string `json:"address"`
@@ -11,11 +16,21 @@ type GA struct {
 }
 
 type Signup struct {
-	Disable bool `json:"disable"`
+	Disable bool     `json:"disable"`
+	Domains []string `json:"domains,omitempty" description:"email domains which are allowed to sign up, any domain if empty"`
 }
 
 type ConfigEntity struct {
 	Raven  Raven  `json:"raven"`
 	GA     GA     `json:"ga"`
 	Signup Signup `json:"signup"`
+
+	Severities issue.Scheme `json:"severities" description:"severities from the least to the most dangerous"`
+
+	Compliance []*compliance.Framework `json:"compliance" description:"compliance frameworks of targets and projects with their controls"`
+}
+
+type LogEntity struct {
+	Level      string            `json:"level" description:"level of the main logger, one of debug, info, warning, error"`
+	Subsystems map[string]string `json:"subsystems,omitempty" description:"levels of subsystems like manager, scheduler and agent, empty level resets to the main one"`
 }
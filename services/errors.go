@@ -15,40 +15,143 @@ const (
 	CodeDb        CodeErr = 18
 	CodeIdHex     CodeErr = 19
 	CodeDuplicate CodeErr = 20
+	CodeVersion   CodeErr = 21
+	CodeStatus    CodeErr = 22
 
 	// Bad Request
 	CodeWrongData   CodeErr = 40
 	CodeWrongEntity CodeErr = 41
+	CodeNotFound    CodeErr = 44
+	CodeNoVersion   CodeErr = 45
 
 	// error codes related to auth
 	CodeAuthReq    CodeErr = 60
 	CodeAuthFailed CodeErr = 61
 	CodeAuthForbid CodeErr = 62
+
+	CodeRateLimited CodeErr = 70
+	CodeTimeout     CodeErr = 71
+	CodeTooLarge    CodeErr = 72
+	CodeInfected    CodeErr = 73
+	CodeOverQuota   CodeErr = 74
+
+	CodeEmailDisabled  CodeErr = 80
+	CodeSignupDisabled CodeErr = 81
+	CodeDomainDenied   CodeErr = 82
+)
+
+// ErrCode is a stable machine readable error code, clients should rely on it instead of messages
+type ErrCode string
+
+const (
+	ErrApp            ErrCode = "APP_ERROR"
+	ErrDb             ErrCode = "DB_ERROR"
+	ErrInvalidId      ErrCode = "INVALID_ID"
+	ErrDuplicate      ErrCode = "DUPLICATE"
+	ErrVersion        ErrCode = "VERSION_CONFLICT"
+	ErrStatus         ErrCode = "STATUS_CONFLICT"
+	ErrValidation     ErrCode = "VALIDATION_FAILED"
+	ErrWrongEntity    ErrCode = "WRONG_ENTITY"
+	ErrNotFound       ErrCode = "NOT_FOUND"
+	ErrNoVersion      ErrCode = "VERSION_REQUIRED"
+	ErrAuthRequired   ErrCode = "AUTH_REQUIRED"
+	ErrAuthFailed     ErrCode = "AUTH_FAILED"
+	ErrForbidden      ErrCode = "FORBIDDEN"
+	ErrRateLimited    ErrCode = "RATE_LIMITED"
+	ErrTimeout        ErrCode = "TIMEOUT"
+	ErrTooLarge       ErrCode = "TOO_LARGE"
+	ErrInfected       ErrCode = "FILE_INFECTED"
+	ErrOverQuota      ErrCode = "QUOTA_EXCEEDED"
+	ErrEmailDisabled  ErrCode = "EMAIL_DISABLED"
+	ErrSignupDisabled ErrCode = "SIGNUP_DISABLED"
+	ErrDomainDenied   ErrCode = "DOMAIN_DENIED"
 )
 
+var errCodes = map[CodeErr]ErrCode{
+	CodeApp:            ErrApp,
+	CodeDb:             ErrDb,
+	CodeIdHex:          ErrInvalidId,
+	CodeDuplicate:      ErrDuplicate,
+	CodeVersion:        ErrVersion,
+	CodeStatus:         ErrStatus,
+	CodeWrongData:      ErrValidation,
+	CodeWrongEntity:    ErrWrongEntity,
+	CodeNotFound:       ErrNotFound,
+	CodeNoVersion:      ErrNoVersion,
+	CodeAuthReq:        ErrAuthRequired,
+	CodeAuthFailed:     ErrAuthFailed,
+	CodeAuthForbid:     ErrForbidden,
+	CodeRateLimited:    ErrRateLimited,
+	CodeTimeout:        ErrTimeout,
+	CodeTooLarge:       ErrTooLarge,
+	CodeInfected:       ErrInfected,
+	CodeOverQuota:      ErrOverQuota,
+	CodeEmailDisabled:  ErrEmailDisabled,
+	CodeSignupDisabled: ErrSignupDisabled,
+	CodeDomainDenied:   ErrDomainDenied,
+}
+
+// ErrCode returns the string form of the numeric code, unknown codes are application errors
+func (c CodeErr) ErrCode() ErrCode {
+	if code, ok := errCodes[c]; ok {
+		return code
+	}
+	return ErrApp
+}
+
 var (
-	AppErr         = NewError(CodeApp, "application error")
-	DbErr          = NewError(CodeDb, "db error")
-	IdHexErr       = NewError(CodeIdHex, "id should be bson uuid in hex form")
-	WrongEntityErr = NewError(CodeWrongEntity, "wrong entity")
-	DuplicateErr   = NewError(CodeDuplicate, "object with the same indexes is existed")
-	AuthReqErr     = NewError(CodeAuthReq, "authorization required")
-	AuthFailedErr  = NewError(CodeAuthFailed, "authorization failed")
-	AuthForbidErr  = NewError(CodeAuthForbid, "you have no permission to this resource")
+	AppErr            = NewError(CodeApp, "application error")
+	DbErr             = NewError(CodeDb, "db error")
+	IdHexErr          = NewError(CodeIdHex, "id should be bson uuid in hex form")
+	WrongEntityErr    = NewError(CodeWrongEntity, "wrong entity")
+	DuplicateErr      = NewError(CodeDuplicate, "object with the same indexes is existed")
+	NotFoundErr       = NewError(CodeNotFound, "Not found")
+	VersionErr        = NewError(CodeVersion, "object was modified by someone else, reload it and try again")
+	NoVersionErr      = NewError(CodeNoVersion, "version is required, send it with If-Match header or version field")
+	AuthReqErr        = NewError(CodeAuthReq, "authorization required")
+	AuthFailedErr     = NewError(CodeAuthFailed, "authorization failed")
+	AuthForbidErr     = NewError(CodeAuthForbid, "you have no permission to this resource")
+	TimeoutErr        = NewError(CodeTimeout, "request took too long, try again later")
+	TooLargeErr       = NewError(CodeTooLarge, "request body is too large")
+	EmailDisabledErr  = NewError(CodeEmailDisabled, "email is disabled, ask the administrator")
+	SignupDisabledErr = NewError(CodeSignupDisabled, "registration is disabled, ask the administrator to invite you")
 )
 
-func NewError(c CodeErr, msg string) restful.ServiceError {
-	return restful.NewError(int(c), msg)
+// ServiceError is the error envelope for all api responses
+type ServiceError struct {
+	Code    ErrCode `json:"code" description:"stable machine readable error code, e.g. VALIDATION_FAILED"`
+	Message string  `json:"message" description:"human readable message"`
+	Errno   CodeErr `json:"errno" description:"numeric error code, kept for backward compatibility"`
+
+	Fields []*FieldError `json:"fields,omitempty" description:"invalid fields for validation errors"`
+}
+
+func (s ServiceError) Error() string {
+	return fmt.Sprintf("[ServiceError:%s] %s", s.Code, s.Message)
+}
+
+func NewError(c CodeErr, msg string) ServiceError {
+	return ServiceError{Code: c.ErrCode(), Message: msg, Errno: c}
 }
 
-func NewBadReq(msg string, args ...interface{}) restful.ServiceError {
+func NewBadReq(msg string, args ...interface{}) ServiceError {
 	return NewError(CodeWrongData, fmt.Sprintf(msg, args...))
 }
 
-func NewAppErr(msg string) restful.ServiceError {
+func NewAppErr(msg string) ServiceError {
 	return NewError(CodeApp, msg)
 }
 
+func NewNotFound(msg string) ServiceError {
+	return NewError(CodeNotFound, msg)
+}
+
+// WriteError writes the error envelope with http status
+func WriteError(resp *restful.Response, httpStatus int, err ServiceError) error {
+	resp.WriteHeader(httpStatus)
+	return resp.WriteEntity(err)
+}
+
 type ErrResp struct {
 	Code int
 	Err  error
@@ -59,8 +162,8 @@ func (e *ErrResp) Write(rw *restful.Response) {
 	if code == 0 {
 		code = http.StatusInternalServerError
 	}
-	if sErr, casted := e.Err.(restful.ServiceError); casted {
-		rw.WriteServiceError(code, sErr)
+	if sErr, casted := e.Err.(ServiceError); casted {
+		WriteError(rw, code, sErr)
 	} else {
 		rw.WriteError(code, e.Err)
 	}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceErrorJson(t *testing.T) {
+	data, err := json.Marshal(NewBadReq("wrong %s", "email"))
+	require.NoError(t, err)
+
+	raw := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(data, &raw))
+	assert.Equal(t, "VALIDATION_FAILED", raw["code"])
+	assert.Equal(t, "wrong email", raw["message"])
+	assert.Equal(t, float64(CodeWrongData), raw["errno"])
+	// only the lowercase keys are sent, so case-insensitive decoders don't mix code and Code
+	_, legacy := raw["Code"]
+	assert.False(t, legacy)
+	_, legacy = raw["Message"]
+	assert.False(t, legacy)
+
+	sErr := ServiceError{}
+	require.NoError(t, json.Unmarshal(data, &sErr))
+	assert.Equal(t, ErrValidation, sErr.Code)
+	assert.Equal(t, CodeWrongData, sErr.Errno)
+	assert.Equal(t, "wrong email", sErr.Message)
+}
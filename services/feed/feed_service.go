@@ -45,7 +45,7 @@ func (s *FeedService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
-	ws.Filter(filters.AuthRequiredFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
 
 	r := ws.GET("").To(s.list)
 	addDefaults(r)
@@ -90,37 +90,37 @@ func (s *FeedService) Register(container *restful.Container) {
 
 func (s *FeedService) list(req *restful.Request, resp *restful.Response) {
 	// TODO (m0sth8): check if this user has access to feed items
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	query, err := fltr.FromRequest(req, manager.FeedItemFltr{})
 	if err != nil {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
 		return
 	}
 	skip := 0
 	if p := req.QueryParameter("skip"); p != "" {
 		if val, err := strconv.Atoi(p); err != nil {
-			resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(fmt.Sprintf("skip: %s", err.Error())))
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(fmt.Sprintf("skip: %s", err.Error())))
 			return
 		} else {
 			skip = val
 		}
 	}
-	limit := 20
+	limit := s.Paginator.LimitDefault
 	if p := req.QueryParameter("limit"); p != "" {
 		if val, err := strconv.Atoi(p); err != nil {
-			resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(fmt.Sprintf("limit: %s", err.Error())))
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(fmt.Sprintf("limit: %s", err.Error())))
 			return
 		} else {
-			limit = val
+			limit = s.Paginator.Clamp(val)
 		}
 	}
 	sort := []string{"-updated"}
 	results, count, err := mgr.Feed.FilterByQuery(query, mgr.Opts(skip, limit, sort))
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -135,8 +135,8 @@ func (s *FeedService) get(_ *restful.Request, resp *restful.Response, pl *feed.F
 	resp.WriteEntity(pl)
 }
 
-func (s *FeedService) delete(_ *restful.Request, resp *restful.Response, obj *feed.FeedItem) {
-	mgr := s.Manager()
+func (s *FeedService) delete(req *restful.Request, resp *restful.Response, obj *feed.FeedItem) {
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	mgr.Feed.Remove(obj)
@@ -148,22 +148,22 @@ func (s *FeedService) TakeFeed(fn func(*restful.Request,
 	return func(req *restful.Request, resp *restful.Response) {
 		id := req.PathParameter(ParamId)
 		if !s.IsId(id) {
-			resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 			return
 		}
 
-		mgr := s.Manager()
+		mgr := s.RequestManager(req)
 		defer mgr.Close()
 
 		obj, err := mgr.Feed.GetById(mgr.ToId(id))
 		mgr.Close()
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteErrorString(http.StatusNotFound, "Not found")
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 		fn(req, resp, obj)
@@ -1,21 +1,31 @@
 package file
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/facebookgo/stackerr"
 
 	"github.com/bearded-web/bearded/models/file"
+	"github.com/bearded-web/bearded/pkg/antivirus"
 	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/thumbnail"
 	"github.com/bearded-web/bearded/services"
 )
 
-const ParamId = "file-id"
+const (
+	ParamId = "file-id"
+
+	octetStream = "application/octet-stream"
+)
 
 type FileService struct {
 	*services.BaseService
@@ -44,16 +54,23 @@ func (s *FileService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
-	ws.Filter(filters.AuthRequiredFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
 
 	r := ws.POST("").To(s.create)
+	r.Filter(s.LargeBody())
 	r.Doc("create")
 	r.Operation("create")
 	r.Consumes("multipart/form-data")
 	r.Param(ws.FormParameter("file", "file to upload").DataType("File"))
+	r.Notes(fmt.Sprintf("Authorization required. Files are limited to %d bytes. "+
+		"Files are checked by the antivirus if it's configured, thumbnails are made for images.", s.ApiCfg().File.MaxSize))
 	r.Writes(file.Meta{})
 	r.Do(services.Returns(http.StatusCreated))
-	r.Do(services.ReturnsE(http.StatusConflict))
+	r.Do(services.ReturnsE(
+		http.StatusConflict,
+		http.StatusRequestEntityTooLarge,
+		http.StatusUnsupportedMediaType,
+		http.StatusServiceUnavailable))
 	addDefaults(r)
 	ws.Route(r)
 
@@ -76,6 +93,17 @@ func (s *FileService) Register(container *restful.Container) {
 		http.StatusNotFound))
 	ws.Route(r)
 
+	r = ws.GET(fmt.Sprintf("{%s}/thumbnail", ParamId)).To(s.TakeFile(s.thumbnail))
+	r.Doc("thumbnail")
+	r.Operation("thumbnail")
+	r.Notes("Authorization required. Png preview of the image, files which aren't images get the generic icon")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Produces("image/png")
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	ws.Route(r)
+
 	container.Add(ws)
 }
 
@@ -85,25 +113,91 @@ func (s *FileService) create(req *restful.Request, resp *restful.Response) {
 	f, header, err := req.Request.FormFile("file")
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("Couldn't read file"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Couldn't read file"))
 		return
 	}
 
+	defer f.Close()
+
+	limits := s.ApiCfg().File
+	data, err := readLimited(f, limits.MaxSize)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Couldn't read file"))
+		return
+	}
+	if limits.MaxSize > 0 && len(data) > limits.MaxSize {
+		services.WriteError(resp, http.StatusRequestEntityTooLarge,
+			services.NewBadReq("file is larger than %d bytes", limits.MaxSize))
+		return
+	}
+
+	// clients, like the agent, don't always know the type, so it's detected by content
 	contentType := header.Header.Get("Content-Type")
+	if contentType == "" || contentType == octetStream {
+		contentType = http.DetectContentType(data)
+	}
+	if !isAllowedType(contentType, limits.ContentTypes) {
+		services.WriteError(resp, http.StatusUnsupportedMediaType,
+			services.NewBadReq("file type %s isn't allowed", contentType))
+		return
+	}
+
+	if s.Antivirus != nil {
+		virus, err := s.Antivirus.Scan(bytes.NewReader(data))
+		if err == antivirus.ErrTooLarge {
+			services.WriteError(resp, http.StatusRequestEntityTooLarge,
+				services.NewBadReq("file is larger than the antivirus could check"))
+			return
+		}
+		if err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusServiceUnavailable,
+				services.NewAppErr("antivirus is unavailable, try again later"))
+			return
+		}
+		if virus != "" {
+			logrus.Warnf("File %s uploaded by %s is infected with %s", header.Filename, filters.GetUser(req), virus)
+			services.WriteError(resp, http.StatusBadRequest,
+				services.NewError(services.CodeInfected, fmt.Sprintf("file is infected with %s", virus)))
+			return
+		}
+	}
 
 	// TODO (m0sth8): reduce filename length
+	// the file is visible only to the owner until it's attached to an object of a project
+	owner := filters.GetUser(req).Id
 	meta := &file.Meta{
 		Name:        header.Filename,
 		ContentType: contentType,
+		Owner:       owner,
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
-	obj, err := mgr.Files.Create(f, meta)
+	if size := limits.ThumbnailSize; size > 0 && thumbnail.IsImage(contentType) {
+		// the file is useful without the preview, so errors are only logged
+		if thumb, err := thumbnail.Make(data, size); err != nil {
+			logrus.Warnf("Thumbnail for %s isn't made: %s", header.Filename, err)
+		} else if thumbMeta, err := mgr.Files.Create(bytes.NewReader(thumb),
+			&file.Meta{Name: "thumbnail.png", ContentType: "image/png", Owner: owner}); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		} else {
+			meta.Thumbnail = thumbMeta.Id
+		}
+	}
+
+	obj, err := mgr.Files.Create(bytes.NewReader(data), meta)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		// the thumbnail isn't needed without the file
+		if meta.Thumbnail != "" {
+			if err := mgr.Files.Remove(meta.Thumbnail); err != nil {
+				logrus.Error(stackerr.Wrap(err))
+			}
+		}
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -126,23 +220,108 @@ func (s *FileService) download(_ *restful.Request, resp *restful.Response, obj *
 	io.Copy(resp.ResponseWriter, obj)
 }
 
+func (s *FileService) thumbnail(req *restful.Request, resp *restful.Response, obj *file.File) {
+	resp.AddHeader("Content-Type", "image/png")
+	resp.Write(s.thumbnailData(req, obj))
+}
+
+// the saved thumbnail is returned, it's made once and saved for images which don't have it,
+// like files from archives
+func (s *FileService) thumbnailData(req *restful.Request, obj *file.File) []byte {
+	limits := s.ApiCfg().File
+	if limits.ThumbnailSize <= 0 || !thumbnail.IsImage(obj.Meta.ContentType) {
+		return thumbnail.Icon()
+	}
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if id := obj.Meta.Thumbnail; id != "" {
+		thumb, err := mgr.Files.GetById(id)
+		if err == nil {
+			var data []byte
+			data, err = ioutil.ReadAll(thumb)
+			thumb.Close()
+			if err == nil {
+				return data
+			}
+		}
+		logrus.Warnf("Thumbnail %s of file %s isn't read: %s", id, obj.Meta.Id, err)
+	}
+	data, err := readLimited(obj, limits.MaxSize)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return thumbnail.Icon()
+	}
+	// files which are too large for uploads aren't decoded
+	if limits.MaxSize > 0 && len(data) > limits.MaxSize {
+		return thumbnail.Icon()
+	}
+	thumb, err := thumbnail.Make(data, limits.ThumbnailSize)
+	if err != nil {
+		logrus.Warnf("Thumbnail for file %s isn't made: %s", obj.Meta.Id, err)
+		return thumbnail.Icon()
+	}
+	// the thumbnail is saved, so the image isn't decoded on every request
+	thumbMeta, err := mgr.Files.Create(bytes.NewReader(thumb),
+		&file.Meta{Name: "thumbnail.png", ContentType: "image/png", Owner: obj.Meta.Owner, Project: obj.Meta.Project})
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return thumb
+	}
+	if err := mgr.Files.SetThumbnail(obj.Meta, thumbMeta.Id); err != nil {
+		// another request could save the thumbnail first
+		if !mgr.IsNotFound(err) {
+			logrus.Error(stackerr.Wrap(err))
+		}
+		if err := mgr.Files.Remove(thumbMeta.Id); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		}
+	}
+	return thumb
+}
+
+// read the whole file, one more byte than the max size is read to know that the file is too large.
+// Zero max size disables the limit.
+func readLimited(r io.Reader, maxSize int) ([]byte, error) {
+	if maxSize > 0 {
+		r = io.LimitReader(r, int64(maxSize)+1)
+	}
+	return ioutil.ReadAll(r)
+}
+
+// content type is allowed if it's matched exactly or by prefix ended with slash, e.g. image/
+func isAllowedType(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	for _, t := range allowed {
+		if t == contentType || strings.HasSuffix(t, "/") && strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *FileService) TakeFile(fn func(*restful.Request,
 	*restful.Response, *file.File)) restful.RouteFunction {
 	return func(req *restful.Request, resp *restful.Response) {
 		// TODO (m0sth8): Add token for file to close access to file for everyone
 		id := req.PathParameter(ParamId)
 
-		mgr := s.Manager()
+		mgr := s.RequestManager(req)
 		defer mgr.Close()
 
 		obj, err := mgr.Files.GetById(id)
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteErrorString(http.StatusNotFound, "Not found")
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 		defer obj.Close()
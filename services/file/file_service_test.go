@@ -0,0 +1,39 @@
+package file
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsAllowedType(t *testing.T) {
+	allowed := []string{"image/", "application/json"}
+	testData := []struct {
+		contentType string
+		allowed     []string
+		result      bool
+	}{
+		{"application/zip", nil, true},
+		{"image/png", allowed, true},
+		{"application/json; charset=utf-8", allowed, true},
+		{"text/plain; charset=utf-8", allowed, false},
+		{"application/json-seq", allowed, false},
+		{"imagex/png", allowed, false},
+	}
+	for _, data := range testData {
+		assert.Equal(t, data.result, isAllowedType(data.contentType, data.allowed), data.contentType)
+	}
+}
+
+func TestReadLimited(t *testing.T) {
+	data, err := readLimited(strings.NewReader("12345"), 3)
+	require.NoError(t, err)
+	assert.Equal(t, "1234", string(data), "one more byte is read to detect too large files")
+
+	// zero size disables the limit
+	data, err = readLimited(strings.NewReader("12345"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "12345", string(data))
+}
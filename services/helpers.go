@@ -2,8 +2,11 @@ package services
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
 	"github.com/facebookgo/stackerr"
 	"gopkg.in/mgo.v2/bson"
 
@@ -31,7 +34,12 @@ func HasProjectPermission(mgr *manager.Manager, u *user.User,
 	p *project.Project) (bool, *ErrResp) {
 
 	//	current user should have a permission to create issue there
-	if !mgr.Permission.HasProjectAccess(p, u) {
+	allowed, err := Authorize(mgr, u, ActionProjectAccess, p)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return false, &ErrResp{Code: http.StatusInternalServerError, Err: AppErr}
+	}
+	if !allowed {
 		logrus.Warnf("User %s try to access to project %s", u, p)
 		return false, nil
 	}
@@ -47,3 +55,39 @@ func Must(ok bool, sErr *ErrResp) *ErrResp {
 	}
 	return nil
 }
+
+const (
+	IfMatchHeader = "If-Match"
+	ETagHeader    = "ETag"
+
+	// net/http doesn't have these statuses yet
+	StatusPreconditionRequired = 428
+	StatusPermanentRedirect    = 308
+	StatusTooManyRequests      = 429
+)
+
+// CheckVersion compares the version expected by the client with the current version of the object.
+// The expected version is taken from If-Match header or, if the header is empty, from the entity field.
+func CheckVersion(req *restful.Request, entityVersion *int, current int) *ErrResp {
+	expected := entityVersion
+	if header := req.HeaderParameter(IfMatchHeader); header != "" {
+		v, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+		if err != nil {
+			return &ErrResp{Code: http.StatusBadRequest,
+				Err: NewBadReq("%s header should contain the object version", IfMatchHeader)}
+		}
+		expected = &v
+	}
+	if expected == nil {
+		return &ErrResp{Code: StatusPreconditionRequired, Err: NoVersionErr}
+	}
+	if *expected != current {
+		return &ErrResp{Code: http.StatusConflict, Err: VersionErr}
+	}
+	return nil
+}
+
+// SetVersion adds ETag header with the object version, clients send it back with If-Match header
+func SetVersion(resp *restful.Response, version int) {
+	resp.AddHeader(ETagHeader, strconv.Quote(strconv.Itoa(version)))
+}
@@ -0,0 +1,91 @@
+package incident
+
+import (
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/incident"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/fltr"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/pagination"
+	"github.com/bearded-web/bearded/services"
+)
+
+type IncidentService struct {
+	*services.BaseService
+}
+
+func New(base *services.BaseService) *IncidentService {
+	return &IncidentService{
+		BaseService: base,
+	}
+}
+
+func addDefaults(r *restful.RouteBuilder) {
+	r.Notes("Authorization required, available only for admins")
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusInternalServerError,
+	))
+}
+
+func (s *IncidentService) Register(container *restful.Container) {
+	ws := &restful.WebService{}
+	ws.Path("/api/v1/incidents")
+	ws.Doc("Operational incidents, like offline agents and failed sessions")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+
+	r := ws.GET("").To(s.list)
+	addDefaults(r)
+	r.Doc("list")
+	r.Operation("list")
+	s.SetParams(r, fltr.GetParams(ws, manager.IncidentFltr{}))
+	r.Param(s.Paginator.SkipParam())
+	r.Param(s.Paginator.LimitParam())
+	r.Writes(incident.IncidentList{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	container.Add(ws)
+}
+
+func (s *IncidentService) list(req *restful.Request, resp *restful.Response) {
+	query, err := fltr.FromRequest(req, manager.IncidentFltr{})
+	if err != nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("%s", err.Error()))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	if !mgr.Permission.IsAdmin(u) {
+		logrus.Warnf("User %s try to read incidents without admin permission", u)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	skip, limit := s.Paginator.Parse(req)
+	results, count, err := mgr.Incidents.FilterByQuery(query, mgr.Opts(skip, limit, []string{"-created"}))
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+
+	previous, next := s.Paginator.Urls(req, skip, limit, count)
+	resp.WriteEntity(&incident.IncidentList{
+		Meta:    pagination.Meta{Count: count, Previous: previous, Next: next},
+		Results: results,
+	})
+}
@@ -4,7 +4,9 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bearded-web/bearded/models/file"
 	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/pkg/pagination"
 )
 
 type StatusEntity struct {
@@ -19,6 +21,25 @@ type HeaderMyEntity struct {
 	Values []string `json:"values,omitempty"`
 }
 
+type AttachEntity struct {
+	File string `json:"file" description:"id of the uploaded file" validate:"nonzero"`
+}
+
+type Attachment struct {
+	*file.Meta `json:",inline"`
+	Download   string `json:"download" description:"url for downloading the file"`
+	Preview    string `json:"preview" description:"url of the png preview, files which aren't images have the generic icon"`
+}
+
+type AttachmentList struct {
+	pagination.Meta `json:",inline"`
+	Results         []*Attachment `json:"results"`
+}
+
+type MergeEntity struct {
+	Issues []string `json:"issues" description:"ids of issues which are merged into this one and removed"`
+}
+
 type CommentEntity struct {
 	Text string `json:"text" description:"raw markdown text"`
 }
@@ -89,33 +110,29 @@ func (v *VectorEntity) Transform() *issue.Vector {
 	return vec
 }
 
+type RemediationEntity struct {
+	Text *string `json:"text,omitempty" description:"guidance edited for the issue, empty text restores the guidance of the matching template"`
+}
+
 type IssueEntity struct {
 	Summary    *string            `json:"summary,omitempty" creating:"nonzero,min=3,max=120"`
 	VulnType   *int               `json:"vulnType,omitempty" bson:"vulnType" description:"vulnerability type from vulndb"`
-	Severity   *issue.Severity    `json:"severity,omitempty" description:"one of [high medium low info]"`
+	Severity   *issue.Severity    `json:"severity,omitempty" description:"one of the configured severities or their aliases"`
 	References []*issue.Reference `json:"references,omitempty" bson:"references" description:"information about vulnerability"`
 	Desc       *string            `json:"desc,omitempty"`
 	Vector     *VectorEntity      `json:"vector,omitempty"`
+
+	Remediation *RemediationEntity `json:"remediation,omitempty"`
 }
 
 type TargetIssueEntity struct {
-	Target string `json:"target,omitempty" creating:"nonzero,bsonId"`
+	Target  string `json:"target,omitempty" creating:"nonzero,bsonId"`
+	Version *int   `json:"version,omitempty" description:"current issue version, required for updates if If-Match header isn't set"`
 
 	StatusEntity `json:",inline"`
 	IssueEntity  `json:",inline"`
 }
 
-func isValidSeverity(sev issue.Severity) bool {
-	if sev == issue.SeverityHigh ||
-		sev == issue.SeverityMedium ||
-		sev == issue.SeverityLow ||
-		sev == issue.SeverityInfo {
-
-		return true
-	}
-	return false
-}
-
 // Update all fields for dst with entity data if they present
 // Return true if target should rebuild summary for issues
 func updateTargetIssue(raw *TargetIssueEntity, dst *issue.TargetIssue) bool {
@@ -135,6 +152,19 @@ func updateTargetIssue(raw *TargetIssueEntity, dst *issue.TargetIssue) bool {
 	if raw.Vector != nil {
 		dst.Vector = raw.Vector.Transform()
 	}
+	if raw.Remediation != nil && raw.Remediation.Text != nil {
+		text := *raw.Remediation.Text
+		switch {
+		case text == "":
+			// the guidance is rendered from the template again
+			dst.Remediation = nil
+		case dst.Remediation == nil:
+			dst.Remediation = &issue.Remediation{Text: text, Edited: true}
+		case dst.Remediation.Text != text:
+			dst.Remediation.Text = text
+			dst.Remediation.Edited = true
+		}
+	}
 	if raw.Confirmed != nil {
 		dst.Confirmed = *raw.Confirmed
 	}
@@ -149,6 +179,7 @@ func updateTargetIssue(raw *TargetIssueEntity, dst *issue.TargetIssue) bool {
 			dst.ResolvedAt = time.Now()
 		} else {
 			dst.ResolvedAt = time.Time{}
+			dst.Missed = 0
 		}
 	}
 	if raw.Muted != nil {
@@ -156,9 +187,11 @@ func updateTargetIssue(raw *TargetIssueEntity, dst *issue.TargetIssue) bool {
 		dst.Muted = *raw.Muted
 	}
 	if raw.Severity != nil {
-		if isValidSeverity(*raw.Severity) {
+		// aliases are accepted, unknown severities are ignored
+		if sev, ok := issue.MapSeverity(*raw.Severity); ok {
 			rebuildSummary = true
-			dst.Severity = *raw.Severity
+			dst.Severity = sev
+			dst.SeverityOverride = true
 		}
 	}
 	return rebuildSummary
@@ -3,33 +3,38 @@ package issue
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/facebookgo/stackerr"
 	"gopkg.in/mgo.v2/bson"
-	"gopkg.in/validator.v2"
 
 	"github.com/bearded-web/bearded/models/comment"
 	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/search"
+	"github.com/bearded-web/bearded/pkg/exporter"
 	"github.com/bearded-web/bearded/pkg/filters"
 	"github.com/bearded-web/bearded/pkg/fltr"
 	"github.com/bearded-web/bearded/pkg/manager"
 	"github.com/bearded-web/bearded/pkg/pagination"
 	"github.com/bearded-web/bearded/services"
+	searchService "github.com/bearded-web/bearded/services/search"
 )
 
 const ParamId = "issueId"
 
 type IssueService struct {
 	*services.BaseService
-	sorter *fltr.Sorter
+	sorter   *fltr.Sorter
+	searches *searchService.SearchService
 }
 
 func New(base *services.BaseService) *IssueService {
 	return &IssueService{
 		BaseService: base,
-		sorter:      fltr.NewSorter("created", "updated"),
+		sorter:      fltr.NewSorter("severity", "firstSeen", "lastSeen", "title", "cvss", "created", "updated"),
+		searches:    searchService.New(base, search.TypeIssue, manager.IssueFltr{}),
 	}
 }
 
@@ -49,14 +54,17 @@ func (s *IssueService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
-	ws.Filter(filters.AuthRequiredFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
 
 	r := ws.GET("").To(s.list)
 	addDefaults(r)
 	r.Doc("list")
 	r.Operation("list")
 	s.SetParams(r, fltr.GetParams(ws, manager.IssueFltr{}))
+	r.Param(s.searches.Param(ws))
+	r.Param(services.TagsParam(ws))
 	r.Param(ws.QueryParameter("search", "search by summary and description"))
+	r.Param(ws.QueryParameter("new", "show only issues which aren't in the project baseline, project is required").DataType("boolean"))
 	r.Param(s.sorter.Param())
 	r.Param(s.Paginator.SkipParam())
 	r.Param(s.Paginator.LimitParam())
@@ -64,12 +72,32 @@ func (s *IssueService) Register(container *restful.Container) {
 	r.Do(services.Returns(http.StatusOK))
 	ws.Route(r)
 
+	r = ws.GET("export").To(s.export)
+	r.Filter(s.LongTimeout())
+	addDefaults(r)
+	r.Doc("export")
+	r.Operation("export")
+	r.Notes("Authorization required. Issues of the list filters as a csv file or a SARIF log, " +
+		"issues have the scan, the session and the plugin which reported them first.")
+	s.SetParams(r, fltr.GetParams(ws, manager.IssueFltr{}))
+	r.Param(s.searches.Param(ws))
+	r.Param(services.TagsParam(ws))
+	r.Param(ws.QueryParameter("search", "search by summary and description"))
+	r.Param(ws.QueryParameter("new", "export only issues which aren't in the project baseline, project is required").DataType("boolean"))
+	r.Param(s.sorter.Param())
+	r.Param(ws.QueryParameter("format", "csv or sarif (SARIF 2.1.0), csv by default"))
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
 	r = ws.POST("").To(s.create)
 	addDefaults(r)
 	r.Doc("create")
 	r.Operation("create")
 	r.Writes(issue.TargetIssue{})
 	r.Reads(TargetIssueEntity{})
+	r.Filter(filters.IdempotencyFilter(s.BaseManager()))
+	r.Param(filters.IdempotencyParam(ws))
 	r.Do(services.Returns(http.StatusCreated))
 	r.Do(services.ReturnsE(
 		http.StatusBadRequest,
@@ -94,12 +122,17 @@ func (s *IssueService) Register(container *restful.Container) {
 	r.Doc("update")
 	r.Operation("update")
 	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.HeaderParameter(services.IfMatchHeader, "issue version, required if version field isn't set"))
 	r.Writes(issue.TargetIssue{})
 	r.Reads(TargetIssueEntity{})
 	r.Do(services.Returns(
 		http.StatusOK,
 		http.StatusNotFound))
-	r.Do(services.ReturnsE(http.StatusBadRequest))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusConflict,
+		services.StatusPreconditionRequired,
+	))
 	ws.Route(r)
 
 	r = ws.DELETE(fmt.Sprintf("{%s}", ParamId)).To(s.TakeIssue(s.delete))
@@ -135,6 +168,76 @@ func (s *IssueService) Register(container *restful.Container) {
 		http.StatusNotFound))
 	ws.Route(r)
 
+	r = ws.POST(fmt.Sprintf("{%s}/tags", ParamId)).To(s.TakeIssue(s.tagsAdd))
+	r.Doc("tagsAdd")
+	r.Operation("tagsAdd")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Reads(services.TagsEntity{})
+	r.Writes(issue.TargetIssue{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusConflict))
+	ws.Route(r)
+
+	r = ws.DELETE(fmt.Sprintf("{%s}/tags/{%s}", ParamId, services.TagParam)).To(s.TakeIssue(s.tagsDelete))
+	r.Doc("tagsDelete")
+	r.Operation("tagsDelete")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.PathParameter(services.TagParam, ""))
+	r.Writes(issue.TargetIssue{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusConflict))
+	ws.Route(r)
+
+	r = ws.GET(fmt.Sprintf("{%s}/attachments", ParamId)).To(s.TakeIssue(s.attachments))
+	r.Doc("attachments")
+	r.Operation("attachments")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Writes(AttachmentList{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	ws.Route(r)
+
+	r = ws.POST(fmt.Sprintf("{%s}/attachments", ParamId)).To(s.TakeIssue(s.attachmentsAdd))
+	r.Doc("attachmentsAdd")
+	r.Operation("attachmentsAdd")
+	r.Notes("Authorization required. Attach file uploaded through the file service")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Reads(AttachEntity{})
+	r.Writes(issue.TargetIssue{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusConflict))
+	ws.Route(r)
+
+	r = ws.POST(fmt.Sprintf("{%s}/merge", ParamId)).To(s.TakeIssue(s.merge))
+	r.Doc("merge")
+	r.Operation("merge")
+	r.Notes("Authorization required. Merge issues from the same project into this one, merged issues are removed " +
+		"and their links are redirected to this issue")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.HeaderParameter(services.IfMatchHeader, "optional version of the issue"))
+	r.Reads(MergeEntity{})
+	r.Writes(issue.TargetIssue{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusConflict))
+	ws.Route(r)
+
+	s.searches.RegisterSearches(ws)
+
 	container.Add(ws)
 }
 
@@ -146,7 +249,7 @@ func (s *IssueService) create(req *restful.Request, resp *restful.Response) {
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(
+		services.WriteError(resp,
 			http.StatusBadRequest,
 			services.WrongEntityErr,
 		)
@@ -154,33 +257,30 @@ func (s *IssueService) create(req *restful.Request, resp *restful.Response) {
 	}
 	// check target field, it must be present
 	if !s.IsId(raw.Target) {
-		resp.WriteServiceError(
+		services.WriteError(resp,
 			http.StatusBadRequest,
 			services.NewBadReq("Target is wrong"),
 		)
 		return
 	}
 	// validate other fields
-	if err := validator.WithTag("creating").Validate(raw); err != nil {
-		resp.WriteServiceError(
-			http.StatusBadRequest,
-			services.NewBadReq("Validation error: %s", err.Error()),
-		)
+	if sErr := services.Validate(raw, "creating"); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	// load target and project
 	t, err := mgr.Targets.GetById(mgr.ToId(raw.Target))
 	if err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("Target not found"))
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Target not found"))
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -198,17 +298,20 @@ func (s *IssueService) create(req *restful.Request, resp *restful.Response) {
 	}
 	updateTargetIssue(raw, newObj)
 	newObj.AddUserReportActivity(u.Id)
+	if _, err := mgr.Remediations.Attach(newObj, t.Addr()); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
 
 	obj, err := mgr.Issues.Create(newObj)
 	if err != nil {
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.DuplicateErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 	// TODO (m0sth8): extract to worker
@@ -223,39 +326,33 @@ func (s *IssueService) create(req *restful.Request, resp *restful.Response) {
 			logrus.Error(stackerr.Wrap(err))
 			return
 		}
-	}(s.Manager())
+	}(mgr)
 	resp.WriteHeader(http.StatusCreated)
 	resp.WriteEntity(obj)
 }
 
 func (s *IssueService) list(req *restful.Request, resp *restful.Response) {
 	// TODO (m0sth8): show issues only if user has permissions
-	query, err := fltr.FromRequest(req, manager.IssueFltr{})
-	if err != nil {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
-		return
-	}
-
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
-	if search := req.QueryParameter("search"); search != "" {
-		if mgr.Cfg.TextSearchEnable {
-			query["$text"] = &bson.M{"$search": search}
-		}
+	query, sErr := s.listQuery(req, mgr)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
 	}
 
 	skip, limit := s.Paginator.Parse(req)
 
 	opt := manager.Opts{
-		Sort:  s.sorter.Parse(req),
+		Sort:  issueSort(s.sorter.Parse(req)),
 		Limit: limit,
 		Skip:  skip,
 	}
 	results, count, err := mgr.Issues.FilterByQuery(query, opt)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 	previous, next := s.Paginator.Urls(req, skip, limit, count)
@@ -270,7 +367,123 @@ func (s *IssueService) list(req *restful.Request, resp *restful.Response) {
 	resp.WriteEntity(result)
 }
 
+func (s *IssueService) export(req *restful.Request, resp *restful.Response) {
+	format := exporter.Format(req.QueryParameter("format"))
+	if format == "" {
+		format = exporter.FormatCsv
+	}
+	if !format.IsValid() {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("format should be one of %v", format.Enum()))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	query, sErr := s.listQuery(req, mgr)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	resp.AddHeader("Content-Type", format.ContentType())
+	resp.AddHeader("Content-Disposition", fmt.Sprintf("attachment; filename=\"issues.%s\"", format.Ext()))
+	w, err := exporter.NewWriter(format, resp.ResponseWriter, s.csvTitles(filters.GetUser(req).Locale))
+	if err == nil {
+		err = mgr.Issues.Each(query, issueSort(s.sorter.Parse(req)), w.Write)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	// the status is already sent, so the broken export is only logged
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+}
+
+// titles of csv columns in the locale, columns are named by keys if there is no translation
+func (s *IssueService) csvTitles(locale string) []string {
+	if s.Template == nil {
+		return nil
+	}
+	line, err := s.Template.Text("report/issues-csv-header", nil, locale)
+	if err != nil {
+		return nil
+	}
+	return exporter.Titles(line)
+}
+
+// query of issue lists and exports from filters, saved searches and text search of the request
+func (s *IssueService) listQuery(req *restful.Request, mgr *manager.Manager) (bson.M, *services.ErrResp) {
+	if sErr := s.searches.Apply(req); sErr != nil {
+		return nil, sErr
+	}
+	query, err := fltr.FromRequest(req, manager.IssueFltr{})
+	if err != nil {
+		return nil, &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq(err.Error())}
+	}
+	services.TagsQuery(req, query)
+
+	if search := req.QueryParameter("search"); search != "" {
+		if mgr.Cfg.TextSearchEnable {
+			query["$text"] = &bson.M{"$search": search}
+		}
+	}
+
+	if req.QueryParameter("new") == "true" {
+		projectId := req.QueryParameter("project")
+		if !s.IsId(projectId) {
+			return nil, &services.ErrResp{Code: http.StatusBadRequest,
+				Err: services.NewBadReq("project is required for new issues")}
+		}
+		p, err := mgr.Projects.GetById(mgr.ToId(projectId))
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				return nil, &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("Project not found")}
+			}
+			logrus.Error(stackerr.Wrap(err))
+			return nil, &services.ErrResp{Code: http.StatusInternalServerError, Err: services.DbErr}
+		}
+		if sErr := services.Must(services.HasProjectPermission(mgr, filters.GetUser(req), p)); sErr != nil {
+			return nil, sErr
+		}
+		if p.Baseline != nil {
+			query["baseline"] = bson.M{"$ne": p.Baseline.Id}
+		}
+	}
+	return query, nil
+}
+
+// db fields of issue sort keys
+var sortFields = map[string]string{
+	"severity":  "level",
+	"firstSeen": "created",
+	"title":     "summary",
+}
+
+// issueSort maps sort keys to db fields, the id is added as a tiebreaker, so pages are stable.
+// The most dangerous and the oldest issues are the first by default.
+func issueSort(keys []string) []string {
+	if len(keys) == 0 {
+		return []string{"-level", "created", "_id"}
+	}
+	result := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		desc := strings.HasPrefix(key, "-")
+		name := strings.TrimPrefix(key, "-")
+		if field, ok := sortFields[name]; ok {
+			name = field
+		}
+		if desc {
+			name = "-" + name
+		}
+		result = append(result, name)
+	}
+	return append(result, "_id")
+}
+
 func (s *IssueService) get(_ *restful.Request, resp *restful.Response, issueObj *issue.TargetIssue) {
+	services.SetVersion(resp, issueObj.Version)
 	resp.WriteEntity(issueObj)
 }
 
@@ -281,28 +494,39 @@ func (s *IssueService) update(req *restful.Request, resp *restful.Response, issu
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
-	mgr := s.Manager()
+	// reject changes made to a stale copy of the issue
+	if sErr := services.CheckVersion(req, raw.Version, issueObj.Version); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	// update issue object from entity
 	rebuildSummary := updateTargetIssue(raw, issueObj)
+	// the vuln type could be changed or the guidance could be restored
+	attachRemediation(mgr, issueObj)
 
 	if err := mgr.Issues.Update(issueObj); err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		if mgr.IsVersionConflict(err) {
+			services.WriteError(resp, http.StatusConflict, services.VersionErr)
 			return
 		}
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.DuplicateErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 	if rebuildSummary {
@@ -318,30 +542,216 @@ func (s *IssueService) update(req *restful.Request, resp *restful.Response, issu
 				logrus.Error(stackerr.Wrap(err))
 				return
 			}
-		}(s.Manager())
+		}(mgr)
 	}
 
+	services.SetVersion(resp, issueObj.Version)
 	resp.WriteHeader(http.StatusOK)
 	resp.WriteEntity(issueObj)
 }
 
-func (s *IssueService) delete(_ *restful.Request, resp *restful.Response, obj *issue.TargetIssue) {
-	mgr := s.Manager()
+func (s *IssueService) tagsAdd(req *restful.Request, resp *restful.Response, obj *issue.TargetIssue) {
+	tags, sErr := services.AddTags(req, obj.Tags)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	obj.Tags = tags
+	s.save(req, resp, obj)
+}
+
+func (s *IssueService) tagsDelete(req *restful.Request, resp *restful.Response, obj *issue.TargetIssue) {
+	tags, found := services.RemoveTag(obj.Tags, req.PathParameter(services.TagParam))
+	if !found {
+		services.WriteError(resp, http.StatusNotFound, services.NewNotFound("Tag not found"))
+		return
+	}
+	obj.Tags = tags
+	s.save(req, resp, obj)
+}
+
+func (s *IssueService) save(req *restful.Request, resp *restful.Response, obj *issue.TargetIssue) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if err := mgr.Issues.Update(obj); err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		if mgr.IsVersionConflict(err) {
+			services.WriteError(resp, http.StatusConflict, services.VersionErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	services.SetVersion(resp, obj.Version)
+	resp.WriteEntity(obj)
+}
+
+func (s *IssueService) attachments(_ *restful.Request, resp *restful.Response, obj *issue.TargetIssue) {
+	results := []*Attachment{}
+	for _, f := range obj.Attachments {
+		results = append(results, &Attachment{
+			Meta:     f,
+			Download: fmt.Sprintf("%s/api/v1/files/%s/download", s.ApiCfg().Host, f.Id),
+			Preview:  fmt.Sprintf("%s/api/v1/files/%s/thumbnail", s.ApiCfg().Host, f.Id),
+		})
+	}
+	resp.WriteEntity(&AttachmentList{
+		Meta:    pagination.Meta{Count: len(results)},
+		Results: results,
+	})
+}
+
+func (s *IssueService) attachmentsAdd(req *restful.Request, resp *restful.Response, obj *issue.TargetIssue) {
+	raw := &AttachEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	f, err := mgr.Files.GetById(raw.File)
+	if err != nil {
+		// file manager wraps errors, so not found file can't be distinguished
+		logrus.Error(err)
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("File not found"))
+		return
+	}
+	f.Close()
+	if f.Meta.Project != "" && f.Meta.Project != obj.Project {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("File belongs to another project"))
+		return
+	}
+
+	if !obj.AddAttachments(f.Meta) {
+		resp.WriteEntity(obj)
+		return
+	}
+	s.save(req, resp, obj)
+}
+
+func (s *IssueService) merge(req *restful.Request, resp *restful.Response, obj *issue.TargetIssue) {
+	raw := &MergeEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if len(raw.Issues) == 0 {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Issues are required"))
+		return
+	}
+	// the version is optional for merges, it's checked only if the client sends it
+	if req.HeaderParameter(services.IfMatchHeader) != "" {
+		if sErr := services.CheckVersion(req, nil, obj.Version); sErr != nil {
+			sErr.Write(resp)
+			return
+		}
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	ids := []bson.ObjectId{}
+	others := []*issue.TargetIssue{}
+	for _, id := range raw.Issues {
+		if !s.IsId(id) {
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+			return
+		}
+		if mgr.ToId(id) == obj.Id {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Issue can't be merged into itself"))
+			return
+		}
+		if inIds(ids, mgr.ToId(id)) {
+			continue
+		}
+		other, err := mgr.Issues.GetById(mgr.ToId(id))
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Issue %s not found", id))
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		if other.Project != obj.Project {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Issue %s is from another project", id))
+			return
+		}
+		ids = append(ids, other.Id)
+		others = append(others, other)
+	}
+
+	u := filters.GetUser(req)
+	obj.Merge(u.Id, others...)
+	// the merged issue is saved first, so a version conflict leaves everything untouched
+	if err := mgr.Issues.Update(obj); err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		if mgr.IsVersionConflict(err) {
+			services.WriteError(resp, http.StatusConflict, services.VersionErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	if _, err := mgr.Comments.Relink(comment.Issue, ids, obj.Id); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+	targets := map[bson.ObjectId]struct{}{obj.Target: struct{}{}}
+	for _, other := range others {
+		if err := mgr.Issues.Remove(other); err != nil && !mgr.IsNotFound(err) {
+			logrus.Error(stackerr.Wrap(err))
+		}
+		targets[other.Target] = struct{}{}
+	}
+	for targetId := range targets {
+		if err := mgr.Targets.UpdateSummaryById(targetId); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		}
+	}
+	if _, err := mgr.Feed.AddMerge(obj, ids, u.Id); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+	logrus.Infof("User %s merged issues %v into %s", u, ids, obj.Id.Hex())
+
+	services.SetVersion(resp, obj.Version)
+	resp.WriteEntity(obj)
+}
+
+func (s *IssueService) delete(req *restful.Request, resp *restful.Response, obj *issue.TargetIssue) {
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	mgr.Issues.Remove(obj)
 	resp.WriteHeader(http.StatusNoContent)
 }
 
-func (s *IssueService) comments(_ *restful.Request, resp *restful.Response, obj *issue.TargetIssue) {
-	mgr := s.Manager()
+func (s *IssueService) comments(req *restful.Request, resp *restful.Response, obj *issue.TargetIssue) {
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	results, count, err := mgr.Comments.FilterBy(&manager.CommentFltr{Type: comment.Issue, Link: obj.Id})
 
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -356,30 +766,31 @@ func (s *IssueService) commentsAdd(req *restful.Request, resp *restful.Response,
 	ent := &CommentEntity{}
 	if err := req.ReadEntity(ent); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 
 	if len(ent.Text) == 0 {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("Text is required"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Text is required"))
 		return
 	}
 
 	u := filters.GetUser(req)
 	raw := &comment.Comment{
-		Owner: u.Id,
-		Type:  comment.Issue,
-		Link:  t.Id,
-		Text:  ent.Text,
+		Owner:   u.Id,
+		Type:    comment.Issue,
+		Link:    t.Id,
+		Project: t.Project,
+		Text:    ent.Text,
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	obj, err := mgr.Comments.Create(raw)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -389,26 +800,41 @@ func (s *IssueService) commentsAdd(req *restful.Request, resp *restful.Response,
 
 // Helpers
 
+// Attach guidance of the matching template, the guidance edited for the issue is kept
+func attachRemediation(mgr *manager.Manager, obj *issue.TargetIssue) {
+	if obj.Remediation != nil && obj.Remediation.Edited {
+		return
+	}
+	t, err := mgr.Targets.GetById(obj.Target)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return
+	}
+	if _, err := mgr.Remediations.Attach(obj, t.Addr()); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+}
+
 func (s *IssueService) TakeIssue(fn func(*restful.Request,
 	*restful.Response, *issue.TargetIssue)) restful.RouteFunction {
 	return func(req *restful.Request, resp *restful.Response) {
 		id := req.PathParameter(ParamId)
 		if !s.IsId(id) {
-			resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 			return
 		}
 
-		mgr := s.Manager()
+		mgr := s.RequestManager(req)
 		defer mgr.Close()
 
 		obj, err := mgr.Issues.GetById(mgr.ToId(id))
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteErrorString(http.StatusNotFound, "Not found")
+				s.redirectMerged(req, resp, mgr, id)
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 
@@ -423,3 +849,39 @@ func (s *IssueService) TakeIssue(fn func(*restful.Request,
 		fn(req, resp, obj)
 	}
 }
+
+// Links to merged issues lead to the issue they were merged into
+func (s *IssueService) redirectMerged(req *restful.Request, resp *restful.Response, mgr *manager.Manager, id string) {
+	obj, err := mgr.Issues.GetByMergedId(mgr.ToId(id))
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	if sErr := services.Must(services.HasProjectIdPermission(mgr, filters.GetUser(req), obj.Project)); sErr != nil {
+		services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+		return
+	}
+	u := *req.Request.URL
+	u.Path = strings.Replace(u.Path, id, obj.Id.Hex(), 1)
+	code := http.StatusMovedPermanently
+	if req.Request.Method != "GET" && req.Request.Method != "HEAD" {
+		// keep the method and the body
+		code = services.StatusPermanentRedirect
+	}
+	resp.Header().Set("Location", u.RequestURI())
+	resp.WriteHeader(code)
+}
+
+func inIds(ids []bson.ObjectId, id bson.ObjectId) bool {
+	for _, existed := range ids {
+		if existed == id {
+			return true
+		}
+	}
+	return false
+}
@@ -14,6 +14,7 @@ import (
 	c "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
 
+	"github.com/bearded-web/bearded/models/comment"
 	"github.com/bearded-web/bearded/models/issue"
 	"github.com/bearded-web/bearded/models/project"
 	"github.com/bearded-web/bearded/models/target"
@@ -231,6 +232,19 @@ func TestTargetIssues(t *testing.T) {
 				c.So(issueObj.Resolved, c.ShouldEqual, true)
 			})
 
+			c.Convey("Update issue with stale version", func() {
+				res, _ := updateIssue(t, ts.URL, testMgr.FromId(targetIssue.Id), &TargetIssueEntity{
+					Version: utils.IntP(targetIssue.Version - 1),
+					StatusEntity: StatusEntity{
+						Muted: utils.BoolP(true),
+					},
+				})
+				c.So(res.StatusCode, c.ShouldEqual, http.StatusConflict)
+				issueObj, err := testMgr.Issues.GetById(targetIssue.Id)
+				c.So(err, c.ShouldBeNil)
+				c.So(issueObj.Muted, c.ShouldEqual, false)
+			})
+
 			c.Convey("Create issue ", func() {
 				res, issueObj, err := createIssue(t, ts.URL, &TargetIssueEntity{
 					IssueEntity: IssueEntity{
@@ -307,12 +321,218 @@ func TestTargetIssues(t *testing.T) {
 
 }
 
+func TestNewIssues(t *testing.T) {
+	ts, u := newIssueServer(t)
+	defer ts.Close()
+
+	c.Convey("Given the project with a baseline", t, func() {
+		projectObj, err := testMgr.Projects.Create(&project.Project{Name: "baseline", Owner: u.Id})
+		c.So(err, c.ShouldBeNil)
+		create := func(severity issue.Severity) *issue.TargetIssue {
+			obj, err := testMgr.Issues.Create(&issue.TargetIssue{
+				Target:  bson.NewObjectId(),
+				Project: projectObj.Id,
+				Issue:   issue.Issue{Severity: severity, UniqId: bson.NewObjectId().Hex()},
+			})
+			c.So(err, c.ShouldBeNil)
+			return obj
+		}
+		known := create(issue.SeverityHigh)
+		knownLow := create(issue.SeverityLow)
+		baseline := &project.Baseline{Id: bson.NewObjectId()}
+		count, err := testMgr.Issues.SetBaseline(bson.M{"project": projectObj.Id}, baseline.Id)
+		c.So(err, c.ShouldBeNil)
+		c.So(count, c.ShouldEqual, 2)
+		baseline.Count = count
+		c.So(testMgr.Projects.SetBaseline(projectObj, baseline), c.ShouldBeNil)
+		fresh := create(issue.SeverityHigh)
+		query := url.Values{"project": {projectObj.Id.Hex()}, "new": {"true"}}
+
+		c.Convey("Only issues which aren't in the baseline are new", func() {
+			res, issues := getIssues(t, ts.URL, query)
+			c.So(res.StatusCode, c.ShouldEqual, http.StatusOK)
+			c.So(issues.Count, c.ShouldEqual, 1)
+			c.So(issues.Results[0].Id, c.ShouldEqual, fresh.Id)
+		})
+		c.Convey("Other filters are applied with the baseline", func() {
+			query.Set("severity", string(issue.SeverityLow))
+			res, issues := getIssues(t, ts.URL, query)
+			c.So(res.StatusCode, c.ShouldEqual, http.StatusOK)
+			c.So(issues.Count, c.ShouldEqual, 0)
+		})
+		c.Convey("Issues of the previous baseline are new after it's replaced", func() {
+			next := &project.Baseline{Id: bson.NewObjectId()}
+			_, err := testMgr.Issues.SetBaseline(bson.M{"_id": known.Id}, next.Id)
+			c.So(err, c.ShouldBeNil)
+			c.So(testMgr.Projects.SetBaseline(projectObj, next), c.ShouldBeNil)
+			_, issues := getIssues(t, ts.URL, query)
+			c.So(issues.Count, c.ShouldEqual, 2)
+			ids := []bson.ObjectId{issues.Results[0].Id, issues.Results[1].Id}
+			c.So(ids, c.ShouldContain, fresh.Id)
+			c.So(ids, c.ShouldContain, knownLow.Id)
+		})
+		c.Convey("All issues are new without the baseline", func() {
+			c.So(testMgr.Projects.SetBaseline(projectObj, nil), c.ShouldBeNil)
+			_, issues := getIssues(t, ts.URL, query)
+			c.So(issues.Count, c.ShouldEqual, 3)
+		})
+	})
+}
+
+func TestMergeIssues(t *testing.T) {
+	ts, u := newIssueServer(t)
+	defer ts.Close()
+
+	c.Convey("Given duplicate issues of the project", t, func() {
+		projectObj, err := testMgr.Projects.Create(&project.Project{Name: bson.NewObjectId().Hex(), Owner: u.Id})
+		c.So(err, c.ShouldBeNil)
+		create := func(projectId bson.ObjectId) *issue.TargetIssue {
+			obj, err := testMgr.Issues.Create(&issue.TargetIssue{
+				Target:  bson.NewObjectId(),
+				Project: projectId,
+				Issue:   issue.Issue{Severity: issue.SeverityHigh, UniqId: bson.NewObjectId().Hex()},
+			})
+			c.So(err, c.ShouldBeNil)
+			return obj
+		}
+		obj, dup := create(projectObj.Id), create(projectObj.Id)
+		note, err := testMgr.Comments.Create(&comment.Comment{Owner: u.Id, Type: comment.Issue, Link: dup.Id, Text: "dup"})
+		c.So(err, c.ShouldBeNil)
+
+		c.Convey("Issues of another project aren't merged", func() {
+			foreign := create(bson.NewObjectId())
+			res, _ := mergeIssues(t, ts.URL, obj.Id, "", foreign.Id)
+			c.So(res.StatusCode, c.ShouldEqual, http.StatusBadRequest)
+			_, err := testMgr.Issues.GetById(foreign.Id)
+			c.So(err, c.ShouldBeNil)
+		})
+		c.Convey("Stale version isn't merged", func() {
+			res, _ := mergeIssues(t, ts.URL, obj.Id, fmt.Sprintf("%d", obj.Version+1), dup.Id)
+			c.So(res.StatusCode, c.ShouldEqual, http.StatusConflict)
+			_, err := testMgr.Issues.GetById(dup.Id)
+			c.So(err, c.ShouldBeNil)
+			current, err := testMgr.Issues.GetById(obj.Id)
+			c.So(err, c.ShouldBeNil)
+			c.So(current.Merged, c.ShouldBeEmpty)
+		})
+
+		c.Convey("Merged issue is removed and its comments are moved", func() {
+			res, merged := mergeIssues(t, ts.URL, obj.Id, fmt.Sprintf("%d", obj.Version), dup.Id)
+			c.So(res.StatusCode, c.ShouldEqual, http.StatusOK)
+			c.So(len(merged.Merged), c.ShouldEqual, 1)
+			c.So(merged.Merged[0].Id, c.ShouldEqual, dup.Id)
+			_, err := testMgr.Issues.GetById(dup.Id)
+			c.So(testMgr.IsNotFound(err), c.ShouldBeTrue)
+			moved, err := testMgr.Comments.GetById(note.Id)
+			c.So(err, c.ShouldBeNil)
+			c.So(moved.Link, c.ShouldEqual, obj.Id)
+
+			c.Convey("Links to the merged issue are redirected", func() {
+				res := rawIssueRequest(t, "GET", fmt.Sprintf("%s/api/v1/issues/%s?x=1", ts.URL, dup.Id.Hex()))
+				c.So(res.StatusCode, c.ShouldEqual, http.StatusMovedPermanently)
+				c.So(res.Header.Get("Location"), c.ShouldEqual, fmt.Sprintf("/api/v1/issues/%s?x=1", obj.Id.Hex()))
+
+				res = rawIssueRequest(t, "POST", fmt.Sprintf("%s/api/v1/issues/%s/comments", ts.URL, dup.Id.Hex()))
+				c.So(res.StatusCode, c.ShouldEqual, services.StatusPermanentRedirect)
+				c.So(res.Header.Get("Location"), c.ShouldEqual, fmt.Sprintf("/api/v1/issues/%s/comments", obj.Id.Hex()))
+
+				res = rawIssueRequest(t, "GET", fmt.Sprintf("%s/api/v1/issues/%s", ts.URL, bson.NewObjectId().Hex()))
+				c.So(res.StatusCode, c.ShouldEqual, http.StatusNotFound)
+			})
+			c.Convey("Links aren't redirected for non members", func() {
+				stranger, err := testMgr.Projects.Create(&project.Project{Name: bson.NewObjectId().Hex(), Owner: bson.NewObjectId()})
+				c.So(err, c.ShouldBeNil)
+				other, gone := create(stranger.Id), create(stranger.Id)
+				other.Merge(u.Id, gone)
+				c.So(testMgr.Issues.Update(other), c.ShouldBeNil)
+				c.So(testMgr.Issues.Remove(gone), c.ShouldBeNil)
+				res := rawIssueRequest(t, "GET", fmt.Sprintf("%s/api/v1/issues/%s", ts.URL, gone.Id.Hex()))
+				c.So(res.StatusCode, c.ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
 func TestIssuePermissions(t *testing.T) {
 	// TODO (m0sth8): implement
 }
 
+func TestIssueSort(t *testing.T) {
+	c.Convey("Given sort keys", t, func() {
+		c.Convey("Default sort is by severity and first seen", func() {
+			c.So(issueSort(nil), c.ShouldResemble, []string{"-level", "created", "_id"})
+		})
+		c.Convey("Keys are mapped to fields with the id tiebreaker", func() {
+			c.So(issueSort([]string{"-severity", "title", "lastSeen"}), c.ShouldResemble,
+				[]string{"-level", "summary", "lastSeen", "_id"})
+			c.So(issueSort([]string{"-firstSeen"}), c.ShouldResemble, []string{"-created", "_id"})
+		})
+	})
+}
+
 // Helpers
 
+// serves issues for the new user
+func newIssueServer(t *testing.T) (*httptest.Server, *user.User) {
+	sess := filters.NewSession()
+	u, err := testMgr.Users.Create(&user.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Set(filters.SessionUserKey, u.Id.Hex())
+
+	service := New(services.New(testMgr, nil, scheduler.NewFake(),
+		email.NewConsoleBackend(), config.NewDispatcher().Api))
+	wsContainer := restful.NewContainer()
+	wsContainer.Router(restful.CurlyRouter{})
+	wsContainer.Filter(filters.SessionFilterMock(sess))
+	service.Register(wsContainer)
+	return httptest.NewServer(wsContainer), u
+}
+
+func mergeIssues(t *testing.T, baseUrl string, id bson.ObjectId, version string, others ...bson.ObjectId) (*http.Response, *issue.TargetIssue) {
+	entity := &MergeEntity{}
+	for _, other := range others {
+		entity.Issues = append(entity.Issues, other.Hex())
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := json.NewEncoder(buf).Encode(entity); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", fmt.Sprintf("%s/api/v1/issues/%s/merge", baseUrl, id.Hex()), buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if version != "" {
+		req.Header.Set(services.IfMatchHeader, version)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	obj := &issue.TargetIssue{}
+	if err := json.NewDecoder(resp.Body).Decode(obj); err != nil {
+		t.Fatal(err)
+	}
+	return resp, obj
+}
+
+// the request isn't redirected, so the redirect response is returned
+func rawIssueRequest(t *testing.T, method, url string) *http.Response {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
 func getIssues(t *testing.T, baseUrl string, val url.Values) (*http.Response, *issue.TargetIssueList) {
 	u, err := url.Parse(fmt.Sprintf("%s/api/v1/issues", baseUrl))
 	if err != nil {
@@ -350,6 +570,14 @@ func updateIssue(t *testing.T, baseUrl string, id string, entity *TargetIssueEnt
 	req, _ := http.NewRequest("PUT", u.String(), buf)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
+	if entity.Version == nil {
+		// send the current version, like clients do after reading the issue
+		current, err := testMgr.Issues.GetById(testMgr.ToId(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(services.IfMatchHeader, fmt.Sprintf("%d", current.Version))
+	}
 	resp, err := http.DefaultClient.Do(req)
 	defer resp.Body.Close()
 	if err != nil {
@@ -399,16 +627,43 @@ func shouldBeBadRequest(t *testing.T, res *http.Response, code services.CodeErr,
 	c.Convey("Response should be 400 (Bad request)", func() {
 		c.So(res.StatusCode, c.ShouldEqual, http.StatusBadRequest)
 		e := getServiceError(t, res)
-		c.So(e.Code, c.ShouldEqual, code)
+		c.So(e.Errno, c.ShouldEqual, code)
 		c.So(e.Message, c.ShouldEqual, message)
 	})
 }
 
-func getServiceError(t *testing.T, res *http.Response) *restful.ServiceError {
-	e := &restful.ServiceError{}
+func getServiceError(t *testing.T, res *http.Response) *services.ServiceError {
+	e := &services.ServiceError{}
 	err := json.NewDecoder(res.Body).Decode(e)
 	if err != nil {
 		t.Fatal(err)
 	}
 	return e
 }
+
+func TestUpdateRemediation(t *testing.T) {
+	text := func(s string) *TargetIssueEntity {
+		return &TargetIssueEntity{IssueEntity: IssueEntity{Remediation: &RemediationEntity{Text: &s}}}
+	}
+	c.Convey("Given the issue with guidance of the template", t, func() {
+		tmplId := bson.NewObjectId()
+		obj := &issue.TargetIssue{Remediation: &issue.Remediation{Template: tmplId, Text: "Encode output"}}
+
+		c.Convey("The same text doesn't mark the guidance as edited", func() {
+			updateTargetIssue(text("Encode output"), obj)
+			c.So(obj.Remediation.Edited, c.ShouldBeFalse)
+		})
+		c.Convey("New text is kept as edited with the template", func() {
+			updateTargetIssue(text("Encode the q parameter"), obj)
+			c.So(obj.Remediation, c.ShouldResemble, &issue.Remediation{Template: tmplId, Text: "Encode the q parameter", Edited: true})
+		})
+		c.Convey("Empty text removes the guidance, so it's rendered again", func() {
+			updateTargetIssue(text(""), obj)
+			c.So(obj.Remediation, c.ShouldBeNil)
+		})
+		c.Convey("Updates without remediation keep it", func() {
+			updateTargetIssue(&TargetIssueEntity{}, obj)
+			c.So(obj.Remediation.Text, c.ShouldEqual, "Encode output")
+		})
+	})
+}
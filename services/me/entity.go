@@ -1,5 +1,10 @@
 package me
 
+type SettingsEntity struct {
+	Locale   *string `json:"locale,omitempty" description:"preferred language of emails, like en or pt-br, empty for the default one"`
+	Timezone *string `json:"timezone,omitempty" description:"IANA timezone like Europe/Berlin, api responses are always in UTC"`
+}
+
 type ChangePasswordEntity struct {
 	Token string `json:"token,omitempty" description:"reset password token"`
 	Old   string `json:"old,omitempty"`
@@ -2,17 +2,18 @@ package me
 
 import (
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/facebookgo/stackerr"
 
 	"github.com/bearded-web/bearded/models/me"
+	"github.com/bearded-web/bearded/models/user"
 	"github.com/bearded-web/bearded/pkg/filters"
-	"github.com/bearded-web/bearded/pkg/fltr"
-	"github.com/bearded-web/bearded/pkg/manager"
 	"github.com/bearded-web/bearded/pkg/passlib/reset"
-	"github.com/bearded-web/bearded/pkg/validate"
+	"github.com/bearded-web/bearded/pkg/template"
 	"github.com/bearded-web/bearded/services"
 )
 
@@ -45,7 +46,7 @@ func (s *MeService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
-	ws.Filter(filters.AuthRequiredFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
 
 	r := ws.GET("").To(s.info)
 	r.Doc("info")
@@ -56,23 +57,36 @@ func (s *MeService) Register(container *restful.Container) {
 	ws.Route(r)
 
 	r = ws.PUT("/password").To(s.changePassword)
+	r.Filter(filters.ForbidImpersonated)
 	r.Doc("changePassword")
 	r.Operation("changePassword")
+	r.Do(services.ReturnsE(http.StatusForbidden))
 	r.Reads(ChangePasswordEntity{})
 	r.Do(services.Returns(http.StatusOK))
 	addDefaults(r)
 	ws.Route(r)
 
+	r = ws.PUT("/settings").To(s.settings)
+	r.Filter(filters.ForbidImpersonated)
+	r.Doc("settings")
+	r.Operation("settings")
+	r.Do(services.ReturnsE(http.StatusForbidden))
+	r.Reads(SettingsEntity{})
+	r.Writes(user.User{})
+	r.Do(services.Returns(http.StatusOK))
+	addDefaults(r)
+	ws.Route(r)
+
 	container.Add(ws)
 }
 
 func (s *MeService) info(req *restful.Request, resp *restful.Response) {
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	u := filters.GetUser(req)
 
-	query := manager.Or(fltr.GetQuery(&manager.ProjectFltr{Owner: u.Id, Member: u.Id}))
+	query := mgr.Projects.AccessQuery(u)
 
 	projects, count, err := mgr.Projects.FilterByQuery(query)
 	if err != nil {
@@ -86,7 +100,7 @@ func (s *MeService) info(req *restful.Request, resp *restful.Response) {
 				logrus.Error(stackerr.Wrap(err))
 				// It might be possible, that default project is already created
 				// So, client should repeat request
-				resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+				services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 				return
 			} else {
 				projects = append(projects, p)
@@ -97,20 +111,59 @@ func (s *MeService) info(req *restful.Request, resp *restful.Response) {
 	u.Admin = mgr.Permission.IsAdmin(u)
 
 	info := me.Info{
-		User:     u,
-		Projects: projects,
+		User:         u,
+		Projects:     projects,
+		Impersonator: filters.GetImpersonator(req),
 	}
 
 	resp.WriteEntity(info)
 }
 
+func (s *MeService) settings(req *restful.Request, resp *restful.Response) {
+	raw := &SettingsEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+
+	u := filters.GetUser(req)
+	if raw.Locale != nil {
+		locale := template.NormalizeLocale(*raw.Locale)
+		if locale != "" && !template.IsLocale(locale) {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("locale should be a language code like en or pt-br"))
+			return
+		}
+		u.Locale = locale
+	}
+	if raw.Timezone != nil {
+		timezone := strings.TrimSpace(*raw.Timezone)
+		// Local depends on the dispatcher host, so it isn't allowed
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("unknown timezone %q", timezone))
+			return
+		}
+		u.Timezone = timezone
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if err := mgr.Users.Update(u); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.WriteEntity(u)
+}
+
 func (s *MeService) changePassword(req *restful.Request, resp *restful.Response) {
 	// TODO (m0sth8): add captcha support
 	raw := &ChangePasswordEntity{}
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 
@@ -131,10 +184,10 @@ func (s *MeService) changePassword(req *restful.Request, resp *restful.Response)
 		_, err := reset.VerifyToken(raw.Token, getUser, []byte(cfg.ResetPasswordSecret))
 		if err != nil {
 			if err == reset.ErrExpiredToken {
-				resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("Token expired, try again"))
+				services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Token expired, try again"))
 
 			}
-			resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("Wrong token, try again"))
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Wrong token, try again"))
 			return
 		}
 	} else {
@@ -142,36 +195,36 @@ func (s *MeService) changePassword(req *restful.Request, resp *restful.Response)
 		verified, err := s.PassCtx().Verify(raw.Old, u.Password)
 		if err != nil {
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.AppErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.AppErr)
 			return
 		}
 		if !verified {
-			resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("old password is incorrect"))
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("old password is incorrect"))
 			return
 		}
 
 	}
 
-	if valid, reason := validate.Password(raw.New); !valid {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("New password %s", reason))
+	if sErr := s.CheckPassword("new", raw.New); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 
 	pass, err := s.PassCtx().Encrypt(raw.New)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.AppErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.AppErr)
 		return
 	}
 	u.Password = pass
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	err = mgr.Users.Update(u)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 	resp.WriteHeader(http.StatusOK)
@@ -67,7 +67,7 @@ func TestChangePassword(t *testing.T) {
 			c.So(err, c.ShouldBeNil)
 			c.So(resp.StatusCode, c.ShouldEqual, http.StatusBadRequest)
 			c.So(sErr, c.ShouldNotBeNil)
-			c.So(sErr.Code, c.ShouldEqual, services.CodeWrongEntity)
+			c.So(sErr.Errno, c.ShouldEqual, services.CodeWrongEntity)
 		})
 
 		c.Convey("Change password with wrong old password", func() {
@@ -75,7 +75,7 @@ func TestChangePassword(t *testing.T) {
 			c.So(err, c.ShouldBeNil)
 			c.So(resp.StatusCode, c.ShouldEqual, http.StatusBadRequest)
 			c.So(sErr, c.ShouldNotBeNil)
-			c.So(sErr.Code, c.ShouldEqual, services.CodeWrongData)
+			c.So(sErr.Errno, c.ShouldEqual, services.CodeWrongData)
 		})
 
 		c.Convey("Change password with right old password, but new is short", func() {
@@ -83,7 +83,7 @@ func TestChangePassword(t *testing.T) {
 			c.So(err, c.ShouldBeNil)
 			c.So(resp.StatusCode, c.ShouldEqual, http.StatusBadRequest)
 			c.So(sErr, c.ShouldNotBeNil)
-			c.So(sErr.Code, c.ShouldEqual, services.CodeWrongData)
+			c.So(sErr.Errno, c.ShouldEqual, services.CodeWrongData)
 		})
 
 		c.Convey("Change password with right old password, and good new password", func() {
@@ -105,7 +105,7 @@ func TestChangePassword(t *testing.T) {
 	})
 }
 
-func changePassword(baseUrl string, entity interface{}) (error, *http.Response, *restful.ServiceError) {
+func changePassword(baseUrl string, entity interface{}) (error, *http.Response, *services.ServiceError) {
 	u, err := url.Parse(fmt.Sprintf("%s/api/v1/me/password", baseUrl))
 	if err != nil {
 		return err, nil, nil
@@ -124,7 +124,7 @@ func changePassword(baseUrl string, entity interface{}) (error, *http.Response,
 		return err, nil, nil
 	}
 	if resp.StatusCode != http.StatusOK {
-		sErr := &restful.ServiceError{}
+		sErr := &services.ServiceError{}
 		err = json.NewDecoder(resp.Body).Decode(sErr)
 		if err != nil {
 			return err, nil, nil
@@ -7,6 +7,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
 
 	"github.com/bearded-web/bearded/models/plan"
 	"github.com/bearded-web/bearded/pkg/filters"
@@ -44,7 +45,7 @@ func (s *PlanService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
-	ws.Filter(filters.AuthRequiredFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
 
 	r := ws.GET("").To(s.list)
 	addDefaults(r)
@@ -85,12 +86,17 @@ func (s *PlanService) Register(container *restful.Container) {
 	r.Doc("update")
 	r.Operation("update")
 	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.HeaderParameter(services.IfMatchHeader, "plan version, required if version field isn't set"))
 	r.Writes(plan.Plan{})
 	r.Reads(plan.Plan{})
 	r.Do(services.Returns(
 		http.StatusOK,
 		http.StatusNotFound))
-	r.Do(services.ReturnsE(http.StatusBadRequest))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusConflict,
+		services.StatusPreconditionRequired,
+	))
 	ws.Route(r)
 
 	r = ws.DELETE(fmt.Sprintf("{%s}", ParamId)).To(s.TakePlan(s.delete))
@@ -115,23 +121,47 @@ func (s *PlanService) create(req *restful.Request, resp *restful.Response) {
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if sErr := services.Validate(raw, "creating"); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	if raw.Policy != nil {
+		if err := raw.Policy.Validate(); err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Policy: %s", err))
+			return
+		}
+	}
+	if raw.Retention != nil {
+		if err := raw.Retention.Validate(); err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Retention: %s", err))
+			return
+		}
+	}
+	if raw.OutputDays < 0 {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("OutputDays can't be negative"))
+		return
+	}
+	if err := raw.Validate(); err != nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Workflow: %s", err))
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	obj, err := mgr.Plans.Create(raw)
 	if err != nil {
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.DuplicateErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -142,17 +172,17 @@ func (s *PlanService) create(req *restful.Request, resp *restful.Response) {
 func (s *PlanService) list(req *restful.Request, resp *restful.Response) {
 	query, err := fltr.FromRequest(req, manager.PlanFltr{})
 	if err != nil {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	results, count, err := mgr.Plans.FilterByQuery(query)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -164,6 +194,7 @@ func (s *PlanService) list(req *restful.Request, resp *restful.Response) {
 }
 
 func (s *PlanService) get(_ *restful.Request, resp *restful.Response, pl *plan.Plan) {
+	services.SetVersion(resp, pl.Version)
 	resp.WriteEntity(pl)
 }
 
@@ -174,36 +205,87 @@ func (s *PlanService) update(req *restful.Request, resp *restful.Response, pl *p
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if sErr := services.Validate(raw, "creating"); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
-	mgr := s.Manager()
+	// reject changes made to a stale copy of the plan, zero version is the same as missing
+	var version *int
+	if raw.Version != 0 {
+		version = &raw.Version
+	}
+	if sErr := services.CheckVersion(req, version, pl.Version); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	if raw.Policy != nil {
+		if err := raw.Policy.Validate(); err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Policy: %s", err))
+			return
+		}
+	}
+	if raw.Retention != nil {
+		if err := raw.Retention.Validate(); err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Retention: %s", err))
+			return
+		}
+	}
+	if raw.OutputDays < 0 {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("OutputDays can't be negative"))
+		return
+	}
+	if err := raw.Validate(); err != nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Workflow: %s", err))
+		return
+	}
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	raw.Id = pl.Id
+	raw.Version = pl.Version
 
 	if err := mgr.Plans.Update(raw); err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		if mgr.IsVersionConflict(err) {
+			services.WriteError(resp, http.StatusConflict, services.VersionErr)
 			return
 		}
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.DuplicateErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
+	// purge dates of stored reports are recomputed by the new retention
+	if raw.OutputDays != pl.OutputDays && s.Outputs != nil {
+		ids, err := mgr.Scans.GetIds(bson.M{"plan": pl.Id})
+		if err == nil {
+			_, err = s.Outputs.Redate(mgr, bson.M{"scan": bson.M{"$in": ids}})
+		}
+		if err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+	}
+
 	resp.WriteHeader(http.StatusOK)
 	resp.WriteEntity(raw)
 }
 
-func (s *PlanService) delete(_ *restful.Request, resp *restful.Response, obj *plan.Plan) {
-	mgr := s.Manager()
+func (s *PlanService) delete(req *restful.Request, resp *restful.Response, obj *plan.Plan) {
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	mgr.Plans.Remove(obj)
@@ -215,22 +297,22 @@ func (s *PlanService) TakePlan(fn func(*restful.Request,
 	return func(req *restful.Request, resp *restful.Response) {
 		id := req.PathParameter(ParamId)
 		if !s.IsId(id) {
-			resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 			return
 		}
 
-		mgr := s.Manager()
+		mgr := s.RequestManager(req)
 		defer mgr.Close()
 
 		obj, err := mgr.Plans.GetById(mgr.ToId(id))
 		mgr.Close()
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteErrorString(http.StatusNotFound, "Not found")
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 		fn(req, resp, obj)
@@ -0,0 +1,38 @@
+package plugin
+
+import (
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/pkg/normalize"
+)
+
+// Adapters of known plugins by name. Plugins put their native fields to raw, the mapped ones are moved
+// to the canonical issue and the rest is kept in raw.
+var adapters = map[string]normalize.Adapter{
+	// w3af json output
+	"barbudo/w3af": normalize.Fields{
+		"name":             normalize.FieldSummary,
+		"long_description": normalize.FieldDesc,
+		"severity":         normalize.FieldSeverity,
+		"url":              normalize.FieldUrl,
+	},
+	// wpscan json output
+	"barbudo/wpscan": normalize.Fields{
+		"title":     normalize.FieldSummary,
+		"vuln_type": normalize.FieldClass,
+		"cvss":      normalize.FieldCvss,
+	},
+	// retire.js reports outdated libraries only
+	"barbudo/retirejs": normalize.AdapterFunc(func(iss *issue.Issue) {
+		normalize.Fields{"severity": normalize.FieldSeverity}.Normalize(iss)
+		if iss.Class == "" {
+			iss.Class = issue.ClassOutdated
+		}
+	}),
+}
+
+func init() {
+	// script versions report the same output
+	for _, name := range []string{"barbudo/w3af", "barbudo/wpscan", "barbudo/retirejs"} {
+		adapters[name+"-script"] = adapters[name]
+	}
+}
@@ -0,0 +1,218 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/agent"
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/plugin"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/services"
+	scanService "github.com/bearded-web/bearded/services/scan"
+)
+
+const (
+	ParamScanId = "scan-id"
+	// path of the built-in echo target, it's used if the test target isn't set
+	echoPath    = "/api/v1/echo"
+	dryRunScope = "dry-run"
+)
+
+type DryRunEntity struct {
+	Target      string `json:"target,omitempty" description:"http or https url of a safe test target, the built-in echo target is used if empty"`
+	CommandArgs string `json:"commandArgs,omitempty" description:"plugin command args, {{.Target}} is replaced with the target"`
+	FormData    string `json:"formData,omitempty"`
+}
+
+type DryRunResult struct {
+	Scan    *scan.Scan       `json:"scan" description:"dry run scan, it isn't listed"`
+	Reports []*report.Report `json:"reports" description:"raw reports of the plugin, issues aren't created"`
+	Logs    []*agent.Log     `json:"logs" description:"output of plugin sessions"`
+}
+
+type EchoResult struct {
+	Method  string              `json:"method"`
+	Path    string              `json:"path"`
+	Query   string              `json:"query"`
+	Headers map[string][]string `json:"headers"`
+}
+
+func (s *PluginService) RegisterDryRun(ws *restful.WebService) {
+	r := ws.POST(fmt.Sprintf("{%s}/dry-run", ParamId)).To(s.TakePlugin(s.dryRun))
+	addDefaults(r)
+	r.Doc("dryRun")
+	r.Operation("dryRun")
+	r.Notes("Admin only. Run the plugin against the test target through an agent, scans and issues aren't created. " +
+		"Dry runs are rate limited for every admin.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Reads(DryRunEntity{})
+	r.Writes(DryRunResult{})
+	r.Do(services.Returns(
+		http.StatusCreated,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusForbidden,
+		services.StatusTooManyRequests,
+	))
+	ws.Route(r)
+
+	r = ws.GET(fmt.Sprintf("{%s}/dry-run/{%s}", ParamId, ParamScanId)).To(s.TakePlugin(s.dryRunGet))
+	addDefaults(r)
+	r.Doc("dryRunGet")
+	r.Operation("dryRunGet")
+	r.Notes("Admin only. Status and raw output of the dry run.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.PathParameter(ParamScanId, ""))
+	r.Writes(DryRunResult{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusForbidden,
+	))
+	ws.Route(r)
+}
+
+// RegisterEcho adds the built-in test target, it returns the request back and doesn't require authorization
+func (s *PluginService) RegisterEcho(container *restful.Container) {
+	ws := &restful.WebService{}
+	ws.Path(echoPath)
+	ws.Doc("Echo target for plugin dry runs")
+	ws.Produces(restful.MIME_JSON)
+
+	for _, method := range []string{"GET", "POST", "HEAD"} {
+		r := ws.Method(method).Path("").To(s.echo)
+		r.Doc("echo")
+		r.Operation("echo" + strings.Title(strings.ToLower(method)))
+		r.Writes(EchoResult{})
+		ws.Route(r)
+	}
+	container.Add(ws)
+}
+
+// credentials of the caller aren't echoed, the echo target doesn't require authorization
+var echoHidden = []string{"Authorization", "Cookie"}
+
+func (s *PluginService) echo(req *restful.Request, resp *restful.Response) {
+	headers := http.Header{}
+	for name, values := range req.Request.Header {
+		headers[name] = values
+	}
+	for _, name := range echoHidden {
+		headers.Del(name)
+	}
+	resp.WriteEntity(&EchoResult{
+		Method:  req.Request.Method,
+		Path:    req.Request.URL.Path,
+		Query:   req.Request.URL.RawQuery,
+		Headers: headers,
+	})
+}
+
+func (s *PluginService) dryRun(req *restful.Request, resp *restful.Response, pl *plugin.Plugin) {
+	u := filters.GetUser(req)
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if !mgr.Permission.IsAdmin(u) {
+		logrus.Warnf("User %s try to run plugin %s", u, pl)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	raw := &DryRunEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if raw.Target == "" {
+		raw.Target = strings.TrimRight(s.ApiCfg().Host, "/") + echoPath
+	} else if !strings.HasPrefix(raw.Target, "http://") && !strings.HasPrefix(raw.Target, "https://") {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("target scheme must be http or https"))
+		return
+	}
+
+	if limit := s.ApiCfg().DryRun.Limit; limit > 0 {
+		if ex := s.dryRuns.Hit(dryRunScope, u.Id.Hex(), limit); ex != nil {
+			services.WriteError(resp, services.StatusTooManyRequests,
+				services.NewError(services.CodeRateLimited, fmt.Sprintf("%d dry runs per hour are allowed", limit)))
+			return
+		}
+	}
+
+	conf := &plan.Conf{Target: raw.Target, CommandArgs: raw.CommandArgs, FormData: raw.FormData}
+	sc, err := scanService.NewDryRun(mgr, u.Id, pl, conf)
+	if err != nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("wrong template: %s", err))
+		return
+	}
+	if sc, err = mgr.Scans.Create(sc); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	s.Scheduler().AddScan(sc)
+	logrus.Infof("User %s started dry run %s of plugin %s against %s", u, sc.Id.Hex(), pl, raw.Target)
+
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(&DryRunResult{Scan: sc, Reports: []*report.Report{}, Logs: []*agent.Log{}})
+}
+
+func (s *PluginService) dryRunGet(req *restful.Request, resp *restful.Response, pl *plugin.Plugin) {
+	u := filters.GetUser(req)
+	id := req.PathParameter(ParamScanId)
+	if !s.IsId(id) {
+		services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+		return
+	}
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if !mgr.Permission.IsAdmin(u) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	sc, err := mgr.Scans.GetById(mgr.ToId(id))
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	if sc.DryRun == nil || sc.DryRun.Plugin != pl.Id {
+		services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+		return
+	}
+
+	result := &DryRunResult{Scan: sc, Reports: sc.DryRun.Reports, Logs: []*agent.Log{}}
+	if result.Reports == nil {
+		result.Reports = []*report.Report{}
+	}
+	for _, sess := range sc.GetAllSessions() {
+		logs, err := mgr.Logs.GetBySession(sess.Id, "")
+		if err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		result.Logs = append(result.Logs, logs...)
+	}
+	sc.Timing = sc.GetTiming(time.Now().UTC())
+	resp.WriteEntity(result)
+}
@@ -9,17 +9,26 @@ import (
 	"github.com/facebookgo/stackerr"
 
 	"github.com/bearded-web/bearded/models/plugin"
+	"github.com/bearded-web/bearded/pkg/cache"
+	"github.com/bearded-web/bearded/pkg/config"
 	"github.com/bearded-web/bearded/pkg/filters"
 	"github.com/bearded-web/bearded/pkg/fltr"
 	"github.com/bearded-web/bearded/pkg/manager"
 	"github.com/bearded-web/bearded/pkg/pagination"
+	"github.com/bearded-web/bearded/pkg/ratelimit"
 	"github.com/bearded-web/bearded/services"
 )
 
-const ParamId = "plugin-id"
+const (
+	ParamId = "plugin-id"
+	// plugins are the same for every user, so the cache key depends only on the query
+	cacheName = "plugins"
+)
 
 type PluginService struct {
 	*services.BaseService
+	// dry runs of every admin are counted in hour windows
+	dryRuns *ratelimit.Limiter
 }
 
 func New(base *services.BaseService) *PluginService {
@@ -36,6 +45,19 @@ func addDefaults(r *restful.RouteBuilder) {
 	))
 }
 
+// Register adapters for output of known plugins
+func (s *PluginService) Init() error {
+	for name, a := range adapters {
+		s.Normalizer.Register(name, a)
+	}
+	limiter, err := ratelimit.New(s.Store, nil, config.RateLimit{Window: 3600})
+	if err != nil {
+		return err
+	}
+	s.dryRuns = limiter
+	return nil
+}
+
 func (s *PluginService) Register(container *restful.Container) {
 	ws := &restful.WebService{}
 	ws.Path("/api/v1/plugins")
@@ -43,9 +65,13 @@ func (s *PluginService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
-	ws.Filter(filters.AuthRequiredFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+
+	// plugins are changed rarely, so browsers of the dashboard keep them for a while
+	cache := services.CacheFor(s.ApiCfg().Caching.Plugins, false)
 
 	r := ws.GET("").To(s.list)
+	r.Filter(cache)
 	addDefaults(r)
 	r.Doc("list")
 	r.Operation("list")
@@ -64,11 +90,13 @@ func (s *PluginService) Register(container *restful.Container) {
 	r.Do(services.Returns(http.StatusCreated))
 	r.Do(services.ReturnsE(
 		http.StatusBadRequest,
+		http.StatusForbidden,
 		http.StatusConflict,
 	))
 	ws.Route(r)
 
 	r = ws.GET(fmt.Sprintf("{%s}", ParamId)).To(s.TakePlugin(s.get))
+	r.Filter(cache)
 	addDefaults(r)
 	r.Doc("get")
 	r.Operation("get")
@@ -93,37 +121,63 @@ func (s *PluginService) Register(container *restful.Container) {
 	r.Do(services.ReturnsE(http.StatusBadRequest))
 	ws.Route(r)
 
+	s.RegisterDryRun(ws)
+
 	container.Add(ws)
+
+	s.RegisterEcho(container)
 }
 
 // ====== service operations
 
 func (s *PluginService) create(req *restful.Request, resp *restful.Response) {
-	// TODO (m0sth8): Check permissions
 	raw := &plugin.Plugin{}
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
+	// plugins are run by agents of every project, so only admins add them
+	u := filters.GetUser(req)
+	if !mgr.Permission.IsAdmin(u) {
+		logrus.Warnf("User %s try to create plugin without admin permission", u)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	if raw.Container != nil {
+		if err := raw.Container.Validate(raw.Type, true); err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("container: %s", err))
+			return
+		}
+	}
+	if raw.Throttle != nil {
+		if err := raw.Throttle.Validate(); err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("throttle: %s", err))
+			return
+		}
+	}
+
 	obj, err := mgr.Plugins.Create(raw)
 	if err != nil {
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.NewError(services.CodeDuplicate, "plugin with this name and version is existed"))
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
+	s.Cache(cacheName).Invalidate()
+
 	resp.WriteHeader(http.StatusCreated)
 	resp.WriteEntity(obj)
 }
@@ -131,24 +185,34 @@ func (s *PluginService) create(req *restful.Request, resp *restful.Response) {
 func (s *PluginService) list(req *restful.Request, resp *restful.Response) {
 	query, err := fltr.FromRequest(req, manager.PluginFltr{})
 	if err != nil {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
+		return
+	}
+
+	c := s.Cache(cacheName)
+	// encoded values are sorted, so the same query has the same key
+	key := cache.Key("list", req.Request.URL.Query().Encode())
+	result := &plugin.PluginList{}
+	if c.Get(key, result) {
+		resp.WriteEntity(result)
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	results, count, err := mgr.Plugins.FilterByQuery(query)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
-	result := &plugin.PluginList{
+	result = &plugin.PluginList{
 		Meta:    pagination.Meta{Count: count},
 		Results: results,
 	}
+	c.Set(key, result)
 	resp.WriteEntity(result)
 }
 
@@ -163,30 +227,45 @@ func (s *PluginService) update(req *restful.Request, resp *restful.Response, pl
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
+	if raw.Container != nil {
+		if err := raw.Container.Validate(raw.Type, mgr.Permission.IsAdmin(filters.GetUser(req))); err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("container: %s", err))
+			return
+		}
+	}
+	if raw.Throttle != nil {
+		if err := raw.Throttle.Validate(); err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("throttle: %s", err))
+			return
+		}
+	}
+
 	raw.Id = pl.Id
 
 	if err := mgr.Plugins.Update(raw); err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 			return
 		}
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.NewError(services.CodeDuplicate, "plugin with this name and version is existed"))
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
+	s.Cache(cacheName).Invalidate()
+
 	resp.WriteHeader(http.StatusOK)
 	resp.WriteEntity(raw)
 }
@@ -196,22 +275,22 @@ func (s *PluginService) TakePlugin(fn func(*restful.Request,
 	return func(req *restful.Request, resp *restful.Response) {
 		pluginId := req.PathParameter(ParamId)
 		if !s.IsId(pluginId) {
-			resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 			return
 		}
 
-		mgr := s.Manager()
+		mgr := s.RequestManager(req)
 		defer mgr.Close()
 
 		pl, err := mgr.Plugins.GetById(pluginId)
 		mgr.Close()
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteErrorString(http.StatusNotFound, "Not found")
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 		fn(req, resp, pl)
@@ -1,5 +1,52 @@
 package project
 
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/policy"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
+)
+
 type ProjectEntity struct {
-	Name string `json:"name"`
+	Name   string         `json:"name" description:"project name, 80 symbols max" validate:"nonzero,max=80"`
+	Policy *policy.Policy `json:"policy,omitempty" description:"scan policy, empty rules remove the policy"`
+
+	RecomputeSeverity *bool `json:"recomputeSeverity,omitempty" description:"update severities of issues when their vulndb entries are changed"`
+
+	Plan *string `json:"plan,omitempty" description:"default plan for scans which are started without a plan, empty string removes it"`
+
+	AutoClose *project.AutoClose `json:"autoClose,omitempty" description:"resolve issues missed by scans of their target, zero thresholds disable it"`
+
+	History *int `json:"history,omitempty" description:"done scans which are kept per target, zero uses the cap of the dispatcher"`
+
+	OutputDays *int `json:"outputDays,omitempty" description:"raw plugin output of scans is purged after this number of days, zero uses the dispatcher setting"`
+
+	Coalesce *int `json:"coalesce,omitempty" description:"seconds, new scans attach to the active scan of the same target and plan started within the window, zero disables it"`
+
+	Compliance []string `json:"compliance,omitempty" description:"compliance frameworks which all targets of the project are in scope of, send an empty list to remove them"`
+
+	Version *int `json:"version,omitempty" description:"current project version, required for updates if If-Match header isn't set"`
+}
+
+type ProjectTokenEntity struct {
+	Name string `json:"name,omitempty" description:"token name" validate:"max=256"`
+	Role string `json:"role,omitempty" description:"one of: [member|viewer], member by default"`
+}
+
+type BaselineEntity struct {
+	Scan bson.ObjectId `json:"scan,omitempty" description:"take issues reported by the scan, all open issues of the project are taken if empty"`
+}
+
+type ImportEntity struct {
+	File string `json:"file" description:"id of the uploaded archive"`
+}
+
+type BulkScanEntity struct {
+	Plan string `json:"plan,omitempty" description:"plan for scans of all compatible targets, the default plan of the project if empty"`
+}
+
+type BulkScanResult struct {
+	scan.GroupStatus `json:",inline"`
+	Skipped          []bson.ObjectId `json:"skipped" description:"targets which type isn't compatible with the plan"`
 }
@@ -0,0 +1,143 @@
+package project
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/file"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/pkg/archive"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/services"
+)
+
+func (s *ProjectService) RegisterArchive(ws *restful.WebService) {
+	r := ws.POST(fmt.Sprintf("{%s}/export", ParamId)).To(s.TakeProject(s.export))
+	// projects with many scans and files take a while
+	r.Filter(s.LongTimeout())
+	r.Doc("export")
+	r.Operation("export")
+	r.Notes("Authorization required. Pack the project with targets, finished scans, issues, used plans and files " +
+		"to zip archive, download it with the files service.")
+	addDefaults(r)
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Writes(file.Meta{})
+	r.Do(services.Returns(
+		http.StatusCreated,
+		http.StatusNotFound))
+	ws.Route(r)
+
+	r = ws.POST("import").To(s.importArchive)
+	r.Filter(s.LongTimeout())
+	r.Doc("import")
+	r.Operation("import")
+	r.Notes("Authorization required. Create the project from the archive uploaded with the files service, " +
+		"the user becomes the owner. Plugins which aren't found are reported.")
+	addDefaults(r)
+	r.Reads(ImportEntity{})
+	r.Writes(archive.Result{})
+	r.Do(services.Returns(http.StatusCreated))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusConflict))
+	ws.Route(r)
+}
+
+func (s *ProjectService) export(req *restful.Request, resp *restful.Response, p *project.Project) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	a, err := archive.Export(mgr, p)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	// the archive is streamed to the file, so it isn't kept in memory
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(archive.Write(pw, a))
+	}()
+	meta, err := mgr.Files.Create(pr, &file.Meta{
+		Name:        fmt.Sprintf("project-%s-%s.zip", p.Id.Hex(), time.Now().UTC().Format("20060102")),
+		ContentType: archive.ContentType,
+		Owner:       filters.GetUser(req).Id,
+		Project:     p.Id,
+	})
+	// the writer is stopped if the file isn't created
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	logrus.Infof("Project %s is exported to %s by %s, %d scans, %d issues, %d files",
+		p, meta.Id, filters.GetUser(req), len(a.Scans), len(a.Issues), len(a.Files))
+
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(meta)
+}
+
+func (s *ProjectService) importArchive(req *restful.Request, resp *restful.Response) {
+	raw := &ImportEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if raw.File == "" {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("file is required"))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	f, err := mgr.Files.GetById(raw.File)
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("file is not found"))
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	a, err := archive.Read(data, int64(s.ApiCfg().ImportMaxSize))
+	if err != nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("%s", err.Error()))
+		return
+	}
+
+	u := filters.GetUser(req)
+	result, err := archive.Import(mgr, a, u.Id)
+	if err != nil {
+		if err == archive.ErrProjectExists {
+			services.WriteError(resp, http.StatusConflict,
+				services.NewError(services.CodeDuplicate, "project with this name and owner is existed"))
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	logrus.Infof("Project %s is imported from %s by %s, missing plugins: %v",
+		result.Project, raw.File, u, result.MissingPlugins)
+
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(result)
+}
@@ -0,0 +1,108 @@
+package project
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/services"
+)
+
+func (s *ProjectService) RegisterBaseline(ws *restful.WebService) {
+	r := ws.PUT(fmt.Sprintf("{%s}/baseline", ParamId)).To(s.TakeProject(s.baselineUpdate))
+	r.Doc("baselineUpdate")
+	r.Operation("baselineUpdate")
+	r.Notes("Authorization required. Replace the baseline with issues from the scan or with all open issues.")
+	addDefaults(r)
+	r.Reads(BaselineEntity{})
+	r.Writes(project.Project{})
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	r = ws.DELETE(fmt.Sprintf("{%s}/baseline", ParamId)).To(s.TakeProject(s.baselineDelete))
+	r.Doc("baselineDelete")
+	r.Operation("baselineDelete")
+	addDefaults(r)
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Do(services.Returns(
+		http.StatusNoContent,
+		http.StatusNotFound))
+	ws.Route(r)
+}
+
+func (s *ProjectService) baselineUpdate(req *restful.Request, resp *restful.Response, p *project.Project) {
+	raw := &BaselineEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	query := bson.M{"project": p.Id, "false": false}
+	if raw.Scan != "" {
+		sc, err := mgr.Scans.GetById(raw.Scan)
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Scan not found"))
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		if sc.Project != p.Id {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Scan is from another project"))
+			return
+		}
+		query["activities.report.scan"] = sc.Id
+	} else {
+		query["resolved"] = false
+	}
+	// issues are marked before the project is updated, so they belong to the baseline as soon as it's set,
+	// issues of the previous baseline keep its id and become new
+	baseline := &project.Baseline{
+		Id:      mgr.NewId(),
+		Scan:    raw.Scan,
+		Updated: time.Now().UTC(),
+	}
+	count, err := mgr.Issues.SetBaseline(query, baseline.Id)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	baseline.Count = count
+	if err := mgr.Projects.SetBaseline(p, baseline); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	logrus.Infof("User %s set baseline for project %s with %d issues", filters.GetUser(req), p, count)
+	resp.WriteEntity(p)
+}
+
+func (s *ProjectService) baselineDelete(req *restful.Request, resp *restful.Response, p *project.Project) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if err := mgr.Projects.SetBaseline(p, nil); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.ResponseWriter.WriteHeader(http.StatusNoContent)
+}
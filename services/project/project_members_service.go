@@ -8,6 +8,7 @@ import (
 	"github.com/emicklei/go-restful"
 	"github.com/facebookgo/stackerr"
 
+	"github.com/bearded-web/bearded/models/audit"
 	"github.com/bearded-web/bearded/models/project"
 	"github.com/bearded-web/bearded/pkg/filters"
 	"github.com/bearded-web/bearded/pkg/manager"
@@ -69,38 +70,38 @@ func (s *ProjectService) membersCreate(req *restful.Request, resp *restful.Respo
 	raw := &project.Member{}
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 	if raw.User == "" {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("user is required"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("user is required"))
 		return
 	}
 
 	u := filters.GetUser(req)
 	if p.Owner != u.Id {
-		resp.WriteServiceError(http.StatusForbidden, services.AuthForbidErr)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
 		return
 	}
 
 	for _, member := range p.Members {
 		if member.User == raw.User {
-			resp.WriteServiceError(http.StatusConflict, services.NewError(services.CodeDuplicate, "User is already member"))
+			services.WriteError(resp, http.StatusConflict, services.NewError(services.CodeDuplicate, "User is already member"))
 			return
 		}
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	mUser, err := mgr.Users.GetById(raw.User)
 	if err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "User not found")
+			services.WriteError(resp, http.StatusNotFound, services.NewNotFound("User not found"))
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 	member := &project.Member{User: mUser.Id}
@@ -109,14 +110,26 @@ func (s *ProjectService) membersCreate(req *restful.Request, resp *restful.Respo
 	err = mgr.Projects.Update(p)
 	if err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		if mgr.IsVersionConflict(err) {
+			services.WriteError(resp, http.StatusConflict, services.VersionErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
+	s.Audit(mgr, &audit.Event{
+		Type:    audit.TypeMemberAdded,
+		Actor:   u.Id,
+		User:    mUser.Id,
+		Project: p.Id,
+		Message: fmt.Sprintf("User %s added %s to project %s", u, mUser, p),
+	})
+
 	resp.WriteHeader(http.StatusCreated)
 	resp.WriteEntity(member)
 }
@@ -130,20 +143,33 @@ func (s *ProjectService) membersDelete(req *restful.Request, resp *restful.Respo
 	}
 	p.Members = members
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	err := mgr.Projects.Update(p)
 	if err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		if mgr.IsVersionConflict(err) {
+			services.WriteError(resp, http.StatusConflict, services.VersionErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
+	u := filters.GetUser(req)
+	s.Audit(mgr, &audit.Event{
+		Type:    audit.TypeMemberRemoved,
+		Actor:   u.Id,
+		User:    m.User,
+		Project: p.Id,
+		Message: fmt.Sprintf("User %s removed member %s from project %s", u, m.User.Hex(), p),
+	})
+
 	resp.ResponseWriter.WriteHeader(http.StatusNoContent)
 }
 
@@ -157,7 +183,7 @@ func (s *ProjectService) TakeMember(fn MemberFunction) ProjectFunction {
 	return func(req *restful.Request, resp *restful.Response, p *project.Project) {
 		id := req.PathParameter(MemberParamId)
 		if !s.IsId(id) {
-			resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 			return
 		}
 
@@ -165,7 +191,7 @@ func (s *ProjectService) TakeMember(fn MemberFunction) ProjectFunction {
 
 		member := p.GetMember(objId)
 		if member == nil {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 			return
 		}
 		fn(req, resp, p, member)
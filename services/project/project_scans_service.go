@@ -0,0 +1,142 @@
+package project
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/services"
+	scanService "github.com/bearded-web/bearded/services/scan"
+)
+
+const ParamGroupId = "group-id"
+
+func (s *ProjectService) RegisterScans(ws *restful.WebService) {
+	r := ws.POST(fmt.Sprintf("{%s}/scans", ParamId)).To(s.TakeProject(s.scanAll))
+	r.Doc("scanAll")
+	r.Operation("scanAll")
+	r.Notes("Authorization required. Start scans of all project targets with the plan in one group, " +
+		"targets of other types are skipped, inactive targets aren't scanned. Scans of the group are listed with ?group= in the scans service.")
+	addDefaults(r)
+	r.Reads(BulkScanEntity{})
+	r.Writes(BulkScanResult{})
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Do(services.Returns(
+		http.StatusCreated,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest, services.StatusTooManyRequests))
+	ws.Route(r)
+
+	r = ws.GET(fmt.Sprintf("{%s}/scan-groups/{%s}", ParamId, ParamGroupId)).To(s.TakeProject(s.scanGroup))
+	r.Doc("scanGroup")
+	r.Operation("scanGroup")
+	r.Notes("Authorization required. Count scans of the group by status.")
+	addDefaults(r)
+	r.Writes(scan.GroupStatus{})
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.PathParameter(ParamGroupId, ""))
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	ws.Route(r)
+}
+
+func (s *ProjectService) scanAll(req *restful.Request, resp *restful.Response, p *project.Project) {
+	raw := &BulkScanEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	u := filters.GetUser(req)
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	planObj, sErr := scanService.TakePlan(mgr, p, raw.Plan)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	targets, _, err := mgr.Targets.FilterActive(bson.M{"project": p.Id})
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+
+	result := &BulkScanResult{Skipped: []bson.ObjectId{}}
+	// all scans are built before the first one is saved, so the group isn't started partially
+	scans := []*scan.Scan{}
+	for _, t := range targets {
+		if t.Type != planObj.TargetType {
+			result.Skipped = append(result.Skipped, t.Id)
+			continue
+		}
+		sc, errResp := scanService.NewScan(mgr, u.Id, &scan.Scan{Project: p.Id, Target: t.Id, Plan: planObj.Id})
+		if errResp != nil {
+			errResp.Write(resp)
+			return
+		}
+		scans = append(scans, sc)
+	}
+	if len(scans) == 0 {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("project has no targets for the plan"))
+		return
+	}
+
+	group := mgr.NewId()
+	if err := scanService.StartGroup(s.BaseService, mgr, group, scans); err != nil {
+		if sErr, ok := err.(*services.ErrResp); ok {
+			sErr.Write(resp)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	logrus.Infof("%d scans of project %s are started by %s in group %s", len(scans), p, u, group.Hex())
+
+	status, err := mgr.Scans.GetGroupStatus(group, p.Id)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	result.GroupStatus = *status
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(result)
+}
+
+func (s *ProjectService) scanGroup(req *restful.Request, resp *restful.Response, p *project.Project) {
+	id := req.PathParameter(ParamGroupId)
+	if !s.IsId(id) {
+		services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+		return
+	}
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	status, err := mgr.Scans.GetGroupStatus(mgr.ToId(id), p.Id)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	if status.Total == 0 {
+		services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+		return
+	}
+	resp.WriteEntity(status)
+}
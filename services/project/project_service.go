@@ -7,6 +7,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
 
 	"github.com/bearded-web/bearded/models/project"
 	"github.com/bearded-web/bearded/pkg/filters"
@@ -14,6 +15,7 @@ import (
 	"github.com/bearded-web/bearded/pkg/manager"
 	"github.com/bearded-web/bearded/pkg/pagination"
 	"github.com/bearded-web/bearded/services"
+	scanService "github.com/bearded-web/bearded/services/scan"
 )
 
 const ParamId = "project-id"
@@ -45,13 +47,15 @@ func (s *ProjectService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
-	ws.Filter(filters.AuthRequiredFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
 
 	r := ws.GET("").To(s.list)
 	r.Doc("list")
 	r.Operation("list")
 	r.Writes(project.ProjectList{})
 	s.SetParams(r, fltr.GetParams(ws, manager.ProjectFltr{}))
+	r.Param(services.TagsParam(ws))
+	r.Param(services.ComplianceQueryParam(ws))
 	r.Do(services.Returns(http.StatusOK))
 	r.Param(s.sorter.Param())
 	r.Param(s.Paginator.SkipParam())
@@ -86,6 +90,7 @@ func (s *ProjectService) Register(container *restful.Container) {
 	r.Doc("update")
 	r.Operation("update")
 	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.HeaderParameter(services.IfMatchHeader, "project version, required if version field isn't set"))
 	r.Reads(ProjectEntity{})
 	r.Writes(project.Project{})
 	r.Do(services.Returns(
@@ -93,10 +98,17 @@ func (s *ProjectService) Register(container *restful.Container) {
 		http.StatusNotFound))
 	r.Do(services.ReturnsE(
 		http.StatusBadRequest,
+		http.StatusConflict,
+		services.StatusPreconditionRequired,
 		http.StatusInternalServerError))
 	ws.Route(r)
 
 	s.RegisterMembers(ws)
+	s.RegisterTokens(ws)
+	s.RegisterBaseline(ws)
+	s.RegisterTags(ws)
+	s.RegisterArchive(ws)
+	s.RegisterScans(ws)
 
 	container.Add(ws)
 }
@@ -108,29 +120,48 @@ func (s *ProjectService) create(req *restful.Request, resp *restful.Response) {
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 
 	user := filters.GetUser(req)
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	obj := &project.Project{
 		Name:  raw.Name,
 		Owner: user.Id,
 	}
+	if raw.Policy != nil && len(raw.Policy.Rules) > 0 {
+		if err := raw.Policy.Validate(); err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Policy: %s", err))
+			return
+		}
+		obj.Policy = raw.Policy
+	}
+	if raw.Compliance != nil {
+		frameworks, sErr := services.ParseCompliance(raw.Compliance)
+		if sErr != nil {
+			sErr.Write(resp)
+			return
+		}
+		obj.Compliance = frameworks
+	}
 	obj, err := mgr.Projects.Create(obj)
 	if err != nil {
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.NewError(services.CodeDuplicate, "project with this name and owner is existed"))
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -143,18 +174,28 @@ func (s *ProjectService) list(req *restful.Request, resp *restful.Response) {
 
 	query, err := fltr.FromRequest(req, manager.ProjectFltr{})
 	if err != nil {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
 		return
 	}
 
 	u := filters.GetUser(req)
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
 	admin := false
 	// if user is not admin then show him only his projects or where he has membership
 	if !admin {
-		query = manager.Or(fltr.GetQuery(&manager.ProjectFltr{Owner: u.Id, Member: u.Id}))
+		query = mgr.Projects.AccessQuery(u)
+	}
+	services.TagsQuery(req, query)
+	framework, sErr := services.ComplianceFramework(req)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	if framework != nil {
+		query["compliance"] = framework.Id
 	}
-	mgr := s.Manager()
-	defer mgr.Close()
 
 	skip, limit := s.Paginator.Parse(req)
 
@@ -167,7 +208,7 @@ func (s *ProjectService) list(req *restful.Request, resp *restful.Response) {
 	results, count, err := mgr.Projects.FilterByQuery(query, opt)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 	previous, next := s.Paginator.Urls(req, skip, limit, count)
@@ -183,6 +224,7 @@ func (s *ProjectService) list(req *restful.Request, resp *restful.Response) {
 }
 
 func (s *ProjectService) get(_ *restful.Request, resp *restful.Response, p *project.Project) {
+	services.SetVersion(resp, p.Version)
 	resp.WriteEntity(p)
 }
 
@@ -191,34 +233,122 @@ func (s *ProjectService) update(req *restful.Request, resp *restful.Response, p
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 
 	user := filters.GetUser(req)
 
 	if p.Owner != user.Id {
-		resp.WriteServiceError(http.StatusForbidden, services.AuthForbidErr)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+	// reject changes made to a stale copy of the project
+	if sErr := services.CheckVersion(req, raw.Version, p.Version); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	if raw.Name != "" {
 		p.Name = raw.Name
 	}
+	if raw.Policy != nil {
+		if err := raw.Policy.Validate(); err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Policy: %s", err))
+			return
+		}
+		p.Policy = raw.Policy
+		if len(raw.Policy.Rules) == 0 {
+			p.Policy = nil
+		}
+	}
+	if raw.RecomputeSeverity != nil {
+		p.RecomputeSeverity = *raw.RecomputeSeverity
+	}
+	if raw.AutoClose != nil {
+		if raw.AutoClose.Scans < 0 || raw.AutoClose.Days < 0 {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("AutoClose: thresholds can't be negative"))
+			return
+		}
+		p.AutoClose = raw.AutoClose
+		if !raw.AutoClose.Enabled() {
+			p.AutoClose = nil
+		}
+	}
+	if raw.History != nil {
+		if *raw.History < 0 {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("History can't be negative"))
+			return
+		}
+		p.History = *raw.History
+	}
+	if raw.Coalesce != nil {
+		if *raw.Coalesce < 0 {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Coalesce can't be negative"))
+			return
+		}
+		p.Coalesce = *raw.Coalesce
+	}
+	// purge dates of stored reports are recomputed by the new retention
+	redate := false
+	if raw.OutputDays != nil {
+		if *raw.OutputDays < 0 {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("OutputDays can't be negative"))
+			return
+		}
+		redate = p.OutputDays != *raw.OutputDays
+		p.OutputDays = *raw.OutputDays
+	}
+	if raw.Compliance != nil {
+		frameworks, sErr := services.ParseCompliance(raw.Compliance)
+		if sErr != nil {
+			sErr.Write(resp)
+			return
+		}
+		p.Compliance = frameworks
+	}
+	if raw.Plan != nil {
+		// scans keep their plan, so the new default is used only for next scans
+		p.Plan = ""
+		if *raw.Plan != "" {
+			planObj, sErr := scanService.TakePlan(mgr, p, *raw.Plan)
+			if sErr != nil {
+				sErr.Write(resp)
+				return
+			}
+			p.Plan = planObj.Id
+		}
+	}
 	if err := mgr.Projects.Update(p); err != nil {
+		if mgr.IsVersionConflict(err) {
+			services.WriteError(resp, http.StatusConflict, services.VersionErr)
+			return
+		}
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.NewError(services.CodeDuplicate, "project with this name and owner is existed"))
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
+	if redate {
+		if _, err := s.Outputs.Redate(mgr, bson.M{"project": p.Id}); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+	}
+	services.SetVersion(resp, p.Version)
 	resp.WriteEntity(p)
 }
 
@@ -231,20 +361,20 @@ func (s *ProjectService) TakeProject(fn ProjectFunction) restful.RouteFunction {
 		// TODO (m0sth8): check permissions for the user
 		id := req.PathParameter(ParamId)
 		if !s.IsId(id) {
-			resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 			return
 		}
-		mgr := s.Manager()
+		mgr := s.RequestManager(req)
 		defer mgr.Close()
 
 		p, err := mgr.Projects.GetById(mgr.ToId(id))
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteErrorString(http.StatusNotFound, "Not found")
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 
@@ -0,0 +1,80 @@
+package project
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/services"
+)
+
+func (s *ProjectService) RegisterTags(ws *restful.WebService) {
+	r := ws.POST(fmt.Sprintf("{%s}/tags", ParamId)).To(s.TakeProject(s.tagsAdd))
+	r.Doc("tagsAdd")
+	r.Operation("tagsAdd")
+	addDefaults(r)
+	r.Reads(services.TagsEntity{})
+	r.Writes(project.Project{})
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	r = ws.DELETE(fmt.Sprintf("{%s}/tags/{%s}", ParamId, services.TagParam)).To(s.TakeProject(s.tagsDelete))
+	r.Doc("tagsDelete")
+	r.Operation("tagsDelete")
+	addDefaults(r)
+	r.Writes(project.Project{})
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.PathParameter(services.TagParam, ""))
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	ws.Route(r)
+}
+
+func (s *ProjectService) tagsAdd(req *restful.Request, resp *restful.Response, p *project.Project) {
+	tags, sErr := services.AddTags(req, p.Tags)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	p.Tags = tags
+	s.saveTags(req, resp, p)
+}
+
+func (s *ProjectService) tagsDelete(req *restful.Request, resp *restful.Response, p *project.Project) {
+	tags, found := services.RemoveTag(p.Tags, req.PathParameter(services.TagParam))
+	if !found {
+		services.WriteError(resp, http.StatusNotFound, services.NewNotFound("Tag not found"))
+		return
+	}
+	p.Tags = tags
+	s.saveTags(req, resp, p)
+}
+
+func (s *ProjectService) saveTags(req *restful.Request, resp *restful.Response, p *project.Project) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if err := mgr.Projects.Update(p); err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		if mgr.IsVersionConflict(err) {
+			services.WriteError(resp, http.StatusConflict, services.VersionErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.WriteEntity(p)
+}
@@ -0,0 +1,241 @@
+package project
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/audit"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/token"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/pagination"
+	"github.com/bearded-web/bearded/services"
+)
+
+const (
+	TokenParamId = "token-id"
+)
+
+// Project tokens are used by automation, like CI. Every token has its own service account,
+// which has access only to the project, so the token could be revoked without affecting people.
+func (s *ProjectService) RegisterTokens(ws *restful.WebService) {
+	r := ws.GET(fmt.Sprintf("{%s}/tokens", ParamId)).To(s.TakeProject(s.tokens))
+	r.Doc("tokens")
+	r.Operation("tokens")
+	addDefaults(r)
+	r.Writes(token.TokenList{})
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusForbidden))
+	ws.Route(r)
+
+	r = ws.POST(fmt.Sprintf("{%s}/tokens", ParamId)).To(s.TakeProject(s.tokensCreate))
+	r.Doc("tokensCreate")
+	r.Operation("tokensCreate")
+	addDefaults(r)
+	r.Reads(ProjectTokenEntity{})
+	r.Writes(token.Token{})
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Do(services.Returns(
+		http.StatusCreated,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusForbidden))
+	ws.Route(r)
+
+	r = ws.DELETE(fmt.Sprintf("{%s}/tokens/{%s}", ParamId, TokenParamId)).To(s.TakeProject(s.TakeToken(s.tokensDelete)))
+	r.Doc("tokensDelete")
+	r.Operation("tokensDelete")
+	addDefaults(r)
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.PathParameter(TokenParamId, ""))
+	r.Do(services.Returns(
+		http.StatusNoContent,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusForbidden))
+	ws.Route(r)
+}
+
+func (s *ProjectService) tokens(req *restful.Request, resp *restful.Response, p *project.Project) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if !canManageTokens(mgr, filters.GetUser(req), p) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	results, count, err := mgr.Tokens.FilterByQuery(bson.M{"project": p.Id, "removed": false})
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.WriteEntity(&token.TokenList{
+		Meta:    pagination.Meta{Count: count},
+		Results: results,
+	})
+}
+
+func (s *ProjectService) tokensCreate(req *restful.Request, resp *restful.Response, p *project.Project) {
+	raw := &ProjectTokenEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	if raw.Role == "" {
+		raw.Role = token.RoleMember
+	}
+	if !isTokenRole(raw.Role) {
+		services.WriteError(resp, http.StatusBadRequest,
+			services.NewBadReq("role should be one of %v", token.Roles))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	if !canManageTokens(mgr, u, p) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	tokenId := bson.NewObjectId()
+	account, err := mgr.Users.Create(&user.User{
+		Email:    fmt.Sprintf("%s@%s", tokenId.Hex(), manager.ServiceEmailDomain),
+		Nickname: fmt.Sprintf("%s token", p.Name),
+		Project:  p.Id,
+	})
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	obj, err := mgr.Tokens.Create(&token.Token{
+		User:    account.Id,
+		Name:    raw.Name,
+		Project: p.Id,
+		Role:    raw.Role,
+	})
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	s.Audit(mgr, &audit.Event{
+		Type:    audit.TypeTokenCreated,
+		Actor:   u.Id,
+		User:    account.Id,
+		Project: p.Id,
+		Token:   obj.Id,
+		Role:    obj.Role,
+		Message: fmt.Sprintf("User %s created %s token %s for project %s", u, obj.Role, obj.Id.Hex(), p),
+	})
+	obj.HashValue = obj.Hash // show token hash after creation only
+
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(obj)
+}
+
+func (s *ProjectService) tokensDelete(req *restful.Request, resp *restful.Response, p *project.Project, t *token.Token) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	if !canManageTokens(mgr, u, p) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	if err := mgr.Tokens.Remove(t); err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	s.Audit(mgr, &audit.Event{
+		Type:    audit.TypeTokenRevoked,
+		Actor:   u.Id,
+		User:    t.User,
+		Project: p.Id,
+		Token:   t.Id,
+		Role:    t.Role,
+		Message: fmt.Sprintf("User %s revoked %s token %s for project %s", u, t.Role, t.Id.Hex(), p),
+	})
+
+	resp.ResponseWriter.WriteHeader(http.StatusNoContent)
+}
+
+// Helpers
+
+// only people who own the project could manage its tokens, tokens can't create other tokens
+func canManageTokens(mgr *manager.Manager, u *user.User, p *project.Project) bool {
+	if u.IsService() {
+		return false
+	}
+	return p.Owner == u.Id || mgr.Permission.IsAdmin(u)
+}
+
+func isTokenRole(role string) bool {
+	for _, r := range token.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type TokenFunction func(*restful.Request, *restful.Response, *project.Project, *token.Token)
+
+// Decorate ProjectFunction. Look for not removed project token by TokenParamId
+// and add token object in the end. If token is not found then return Not Found.
+func (s *ProjectService) TakeToken(fn TokenFunction) ProjectFunction {
+	return func(req *restful.Request, resp *restful.Response, p *project.Project) {
+		id := req.PathParameter(TokenParamId)
+		if !s.IsId(id) {
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+			return
+		}
+		mgr := s.RequestManager(req)
+		defer mgr.Close()
+
+		t, err := mgr.Tokens.GetById(mgr.ToId(id))
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		if t.Project != p.Id || t.Removed {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		mgr.Close()
+
+		fn(req, resp, p, t)
+	}
+}
@@ -0,0 +1,8 @@
+package remediation
+
+type TemplateEntity struct {
+	Title    string `json:"title" validate:"nonzero,max=256"`
+	VulnType int    `json:"vulnType,omitempty" description:"vulnerability type from vulndb, vulnType or cwe is required"`
+	Cwe      string `json:"cwe,omitempty" description:"cwe id, like 79"`
+	Text     string `json:"text" description:"markdown with variables: {{.Target}}, {{.Url}}, {{.Parameter}}, {{.Summary}}" validate:"nonzero"`
+}
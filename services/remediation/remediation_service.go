@@ -0,0 +1,293 @@
+package remediation
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/remediation"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/fltr"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/pagination"
+	"github.com/bearded-web/bearded/pkg/template"
+	"github.com/bearded-web/bearded/services"
+)
+
+const ParamId = "remediation-id"
+
+type RemediationService struct {
+	*services.BaseService
+}
+
+func New(base *services.BaseService) *RemediationService {
+	return &RemediationService{
+		BaseService: base,
+	}
+}
+
+func addDefaults(r *restful.RouteBuilder) {
+	r.Notes("Authorization required")
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusInternalServerError,
+	))
+}
+
+func (s *RemediationService) Register(container *restful.Container) {
+	ws := &restful.WebService{}
+	ws.Path("/api/v1/remediations")
+	ws.Doc("Manage remediation templates")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+
+	r := ws.GET("").To(s.list)
+	addDefaults(r)
+	r.Doc("list")
+	r.Operation("list")
+	s.SetParams(r, fltr.GetParams(ws, manager.RemediationFltr{}))
+	r.Param(s.Paginator.SkipParam())
+	r.Param(s.Paginator.LimitParam())
+	r.Writes(remediation.TemplateList{})
+	r.Do(services.Returns(http.StatusOK))
+	ws.Route(r)
+
+	r = ws.POST("").To(s.create)
+	addDefaults(r)
+	r.Doc("create")
+	r.Operation("create")
+	r.Notes("Admin permission required")
+	r.Writes(remediation.Template{})
+	r.Reads(TemplateEntity{})
+	r.Do(services.Returns(http.StatusCreated))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusForbidden,
+	))
+	ws.Route(r)
+
+	r = ws.GET(fmt.Sprintf("{%s}", ParamId)).To(s.TakeTemplate(s.get))
+	addDefaults(r)
+	r.Doc("get")
+	r.Operation("get")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Writes(remediation.Template{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	r = ws.PUT(fmt.Sprintf("{%s}", ParamId)).To(s.TakeTemplate(s.update))
+	addDefaults(r)
+	r.Doc("update")
+	r.Operation("update")
+	r.Notes("Admin permission required. Issues get the new guidance when they are updated, edited guidance is kept.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Writes(remediation.Template{})
+	r.Reads(TemplateEntity{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusForbidden,
+	))
+	ws.Route(r)
+
+	r = ws.DELETE(fmt.Sprintf("{%s}", ParamId)).To(s.TakeTemplate(s.delete))
+	addDefaults(r)
+	r.Doc("delete")
+	r.Operation("delete")
+	r.Notes("Admin permission required. Issues keep the guidance rendered from the template.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Do(services.Returns(
+		http.StatusNoContent,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusForbidden,
+	))
+	ws.Route(r)
+
+	container.Add(ws)
+}
+
+// ====== service operations
+
+func (s *RemediationService) create(req *restful.Request, resp *restful.Response) {
+	raw, sErr := s.readEntity(req)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	if !mgr.Permission.IsAdmin(u) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	obj, err := mgr.Remediations.Create(&remediation.Template{
+		Title:    raw.Title,
+		VulnType: raw.VulnType,
+		Cwe:      raw.Cwe,
+		Text:     raw.Text,
+		Owner:    u.Id,
+	})
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(obj)
+}
+
+func (s *RemediationService) list(req *restful.Request, resp *restful.Response) {
+	query, err := fltr.FromRequest(req, manager.RemediationFltr{})
+	if err != nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	skip, limit := s.Paginator.Parse(req)
+	opt := manager.Opts{
+		Sort:  []string{"vulnType", "cwe"},
+		Limit: limit,
+		Skip:  skip,
+	}
+
+	results, count, err := mgr.Remediations.FilterByQuery(query, opt)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	previous, next := s.Paginator.Urls(req, skip, limit, count)
+	result := &remediation.TemplateList{
+		Meta: pagination.Meta{
+			Count:    count,
+			Previous: previous,
+			Next:     next,
+		},
+		Results: results,
+	}
+	resp.WriteEntity(result)
+}
+
+func (s *RemediationService) get(_ *restful.Request, resp *restful.Response, obj *remediation.Template) {
+	resp.WriteEntity(obj)
+}
+
+func (s *RemediationService) update(req *restful.Request, resp *restful.Response, obj *remediation.Template) {
+	raw, sErr := s.readEntity(req)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if !mgr.Permission.IsAdmin(filters.GetUser(req)) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	obj.Title = raw.Title
+	obj.VulnType = raw.VulnType
+	obj.Cwe = raw.Cwe
+	obj.Text = raw.Text
+	if err := mgr.Remediations.Update(obj); err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+
+	resp.WriteHeader(http.StatusOK)
+	resp.WriteEntity(obj)
+}
+
+func (s *RemediationService) delete(req *restful.Request, resp *restful.Response, obj *remediation.Template) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if !mgr.Permission.IsAdmin(filters.GetUser(req)) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	if err := mgr.Remediations.Remove(obj); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// Helpers
+
+// Read and validate the entity, the text must be a valid template with known variables
+func (s *RemediationService) readEntity(req *restful.Request) (*TemplateEntity, *services.ErrResp) {
+	raw := &TemplateEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return nil, &services.ErrResp{Code: http.StatusBadRequest, Err: services.WrongEntityErr}
+	}
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		return nil, sErr
+	}
+	raw.Cwe = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(raw.Cwe)), "CWE-")
+	if raw.VulnType == 0 && raw.Cwe == "" {
+		return nil, &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("VulnType or cwe is required")}
+	}
+	if _, err := template.RenderText("remediation", raw.Text, remediation.Vars{}); err != nil {
+		return nil, &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("Wrong text: %s", err)}
+	}
+	return raw, nil
+}
+
+func (s *RemediationService) TakeTemplate(fn func(*restful.Request,
+	*restful.Response, *remediation.Template)) restful.RouteFunction {
+	return func(req *restful.Request, resp *restful.Response) {
+		id := req.PathParameter(ParamId)
+		if !s.IsId(id) {
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+			return
+		}
+
+		mgr := s.RequestManager(req)
+		defer mgr.Close()
+
+		obj, err := mgr.Remediations.GetById(mgr.ToId(id))
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		mgr.Close()
+		fn(req, resp, obj)
+	}
+}
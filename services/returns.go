@@ -45,7 +45,7 @@ func Returns(codes ...int) func(*restful.RouteBuilder) {
 func ReturnsE(codes ...int) func(*restful.RouteBuilder) {
 	return func(b *restful.RouteBuilder) {
 		for _, code := range codes {
-			b.Returns(code, http.StatusText(code), restful.ServiceError{})
+			b.Returns(code, http.StatusText(code), ServiceError{})
 		}
 	}
 }
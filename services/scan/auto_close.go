@@ -0,0 +1,111 @@
+package scan
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
+)
+
+// autoClose counts the finished scan for open issues of the target which it didn't report
+// and resolves ones which reach the auto close threshold of the project
+func (s *ScanService) autoClose(sc *scan.Scan) error {
+	if sc.Status != scan.StatusFinished || sc.Project == "" {
+		return nil
+	}
+	mgr := s.BackgroundManager()
+	defer mgr.Close()
+
+	p, err := mgr.Projects.GetById(sc.Project)
+	if err != nil {
+		return stackerr.Wrap(err)
+	}
+	if !p.AutoClose.Enabled() {
+		return nil
+	}
+	ran := scanPlugins(sc, func(id bson.ObjectId) string {
+		if pl, err := mgr.Plugins.GetById(id.Hex()); err == nil {
+			return pl.Name
+		}
+		return ""
+	})
+	issues, _, err := mgr.Issues.FilterByQuery(bson.M{
+		"target":                 sc.Target,
+		"resolved":               false,
+		"false":                  false,
+		"activities.report.scan": bson.M{"$ne": sc.Id},
+	})
+	if err != nil {
+		return stackerr.Wrap(err)
+	}
+	now := time.Now().UTC()
+	resolved := 0
+	for _, obj := range issues {
+		if !missIssue(obj, ran, p.AutoClose, now) {
+			continue
+		}
+		if err := mgr.Issues.Update(obj); err != nil {
+			// the issue is changed concurrently, it's counted by the next scan
+			logrus.Warnf("Issue %s isn't updated by auto close: %s", obj.Id.Hex(), err)
+			continue
+		}
+		if obj.Resolved {
+			resolved++
+		}
+	}
+	if resolved > 0 {
+		logrus.Infof("%d issues of target %s are resolved by scan %s", resolved, sc.Target.Hex(), sc)
+		if err := mgr.Targets.UpdateSummaryById(sc.Target); err != nil && !mgr.IsNotFound(err) {
+			return stackerr.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// missIssue counts the scan for the issue if the scan run plugins which reported the issue,
+// so plans with other plugins don't close it. Returns true if the issue is changed.
+func missIssue(obj *issue.TargetIssue, ran map[string]bool, ac *project.AutoClose, now time.Time) bool {
+	counted := false
+	for _, name := range obj.ReportPlugins() {
+		if ran[name] {
+			counted = true
+			break
+		}
+	}
+	if !counted {
+		return false
+	}
+	obj.Missed++
+	lastSeen := obj.LastSeen
+	if lastSeen.IsZero() {
+		lastSeen = obj.GetLastSeen()
+	}
+	if ac.Due(obj.Missed, lastSeen, now) {
+		obj.Resolve(now)
+	}
+	return true
+}
+
+// names of plugins which sessions of the scan are finished, timed out sessions are finished without results,
+// so they don't count misses of issues
+func scanPlugins(sc *scan.Scan, nameOf func(bson.ObjectId) string) map[string]bool {
+	names := map[string]bool{}
+	ids := map[bson.ObjectId]bool{}
+	for _, sess := range sc.Sessions {
+		for _, s := range append([]*scan.Session{sess}, sess.GetAllChildren()...) {
+			if s.Status != scan.StatusFinished || s.TimedOut || s.Plugin == "" || ids[s.Plugin] {
+				continue
+			}
+			ids[s.Plugin] = true
+			if name := nameOf(s.Plugin); name != "" {
+				names[name] = true
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,112 @@
+package scan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/email"
+	"github.com/bearded-web/bearded/pkg/scheduler"
+	"github.com/bearded-web/bearded/services"
+)
+
+func TestMissIssue(t *testing.T) {
+	now := time.Now().UTC()
+	obj := &issue.TargetIssue{}
+	obj.AddReportActivity(bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId(), "barbudo/wappalyzer:0.0.2")
+	ran := map[string]bool{"barbudo/wappalyzer": true}
+	ac := &project.AutoClose{Scans: 2}
+
+	// scans of other plugins aren't counted
+	require.False(t, missIssue(obj, map[string]bool{"barbudo/nmap": true}, ac, now))
+	require.Equal(t, 0, obj.Missed)
+
+	require.True(t, missIssue(obj, ran, ac, now))
+	require.Equal(t, 1, obj.Missed)
+	require.False(t, obj.Resolved)
+
+	require.True(t, missIssue(obj, ran, ac, now))
+	require.True(t, obj.Resolved)
+	require.Equal(t, now, obj.ResolvedAt)
+	require.Equal(t, issue.ActivityResolved, obj.Activities[len(obj.Activities)-1].Type)
+
+	// both thresholds should be reached
+	obj = &issue.TargetIssue{}
+	obj.AddReportActivity(bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId(), "barbudo/wappalyzer:0.0.2")
+	ac = &project.AutoClose{Scans: 1, Days: 7}
+	require.True(t, missIssue(obj, ran, ac, now))
+	require.False(t, obj.Resolved)
+	require.True(t, missIssue(obj, ran, ac, now.Add(time.Hour*24*8)))
+	require.True(t, obj.Resolved)
+}
+
+func TestScanPlugins(t *testing.T) {
+	finished, failed, timedOut := bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()
+	sc := &scan.Scan{Sessions: []*scan.Session{
+		{Plugin: finished, Status: scan.StatusFinished},
+		{Plugin: failed, Status: scan.StatusFailed},
+		// the step timeout is exceeded, the plugin didn't check the target
+		{Plugin: timedOut, Status: scan.StatusFinished, TimedOut: true},
+	}}
+	nameOf := func(id bson.ObjectId) string {
+		switch id {
+		case finished:
+			return "finished"
+		case timedOut:
+			return "timedOut"
+		}
+		return "failed"
+	}
+	require.Equal(t, map[string]bool{"finished": true}, scanPlugins(sc, nameOf))
+
+	// the plugin counts if another session of it isn't timed out
+	sc.Sessions = append(sc.Sessions, &scan.Session{Plugin: timedOut, Status: scan.StatusFinished})
+	require.Equal(t, map[string]bool{"finished": true, "timedOut": true}, scanPlugins(sc, nameOf))
+}
+
+func TestSeeTargetIssues(t *testing.T) {
+	service := New(services.New(testMgr, nil, scheduler.NewFake(),
+		email.NewConsoleBackend(), config.NewDispatcher().Api))
+	targetId := testMgr.NewId()
+	create := func(uniqId string, resolved bool) *issue.TargetIssue {
+		obj := &issue.TargetIssue{Target: targetId, Project: testMgr.NewId(), Issue: issue.Issue{UniqId: uniqId}}
+		obj.AddReportActivity(testMgr.NewId(), testMgr.NewId(), testMgr.NewId(), "barbudo/wappalyzer:0.0.2")
+		obj.Missed = 2
+		obj.Resolved = resolved
+		obj, err := testMgr.Issues.Create(obj)
+		require.NoError(t, err)
+		return obj
+	}
+	open, resolved, other := create("open", false), create("resolved", true), create("other", false)
+	sc := &scan.Scan{Id: testMgr.NewId(), Target: targetId}
+	sess := &scan.Session{Id: testMgr.NewId()}
+	rep := &report.Report{Id: testMgr.NewId()}
+
+	dropped := []*issue.Issue{{UniqId: "open"}, {UniqId: "resolved"}, {UniqId: "new"}, {}}
+	require.NoError(t, service.seeTargetIssues(dropped, rep, sc, sess, "barbudo/wappalyzer:0.0.2"))
+
+	obj, err := testMgr.Issues.GetById(open.Id)
+	require.NoError(t, err)
+	require.Equal(t, 0, obj.Missed, "dropped issues are seen by the scan")
+	require.Equal(t, sc.Id, obj.Activities[len(obj.Activities)-1].Report.Scan)
+	require.Equal(t, open.Version+1, obj.Version)
+
+	obj, err = testMgr.Issues.GetById(resolved.Id)
+	require.NoError(t, err)
+	require.True(t, obj.Resolved, "resolved issues aren't reopened")
+	require.Len(t, obj.Activities, 1)
+
+	obj, err = testMgr.Issues.GetById(other.Id)
+	require.NoError(t, err)
+	require.Equal(t, 2, obj.Missed)
+
+	_, err = testMgr.Issues.GetByUniqId(targetId, "new")
+	require.True(t, testMgr.IsNotFound(err), "issues aren't created for dropped ones")
+}
@@ -0,0 +1,89 @@
+package scan
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/services"
+)
+
+const (
+	// the lock is held while the scan is created, it expires if the dispatcher is gone in the middle
+	coalesceLockTtl = time.Second * 10
+	// how long concurrent requests wait for the scan of the lock holder
+	coalesceWait    = time.Millisecond * 100
+	coalesceRetries = 50
+)
+
+// Coalesce returns the active scan of the same target, plan, template and effective config which is created within
+// the coalescing window of the project, so the new scan isn't started twice. Scans with other overrides aren't coalesced.
+// If there is no such scan, the lock for this kind of scans is taken and unlock should be called
+// after the scan is created, concurrent requests wait for it and attach to the created scan.
+// Waiting is stopped when the context of the manager is done.
+func Coalesce(base *services.BaseService, mgr *manager.Manager, sc *scan.Scan) (*scan.Scan, func(), error) {
+	unlock := func() {}
+	if sc.DryRun != nil || sc.Target == "" || sc.Project == "" {
+		return nil, unlock, nil
+	}
+	p, err := mgr.Projects.GetById(sc.Project)
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			return nil, unlock, nil
+		}
+		return nil, unlock, err
+	}
+	if p.Coalesce <= 0 {
+		return nil, unlock, nil
+	}
+	window := time.Duration(p.Coalesce) * time.Second
+	sc.ConfHash = sc.GetConfHash()
+	active := func() (*scan.Scan, error) {
+		obj, err := mgr.Scans.GetActive(sc.Target, sc.Plan, sc.Template, sc.ConfHash, time.Now().UTC().Add(-window))
+		if err != nil && mgr.IsNotFound(err) {
+			return nil, nil
+		}
+		return obj, err
+	}
+
+	key := fmt.Sprintf("scan-coalesce:%s:%s:%s:%s", sc.Target.Hex(), sc.Plan.Hex(), sc.Template.Hex(), sc.ConfHash)
+	for i := 0; ; i++ {
+		if obj, err := active(); obj != nil || err != nil {
+			return obj, unlock, err
+		}
+		locked, err := base.Store.SetNX(key, []byte(sc.Id.Hex()), coalesceLockTtl)
+		if err != nil {
+			// the scan is started without the lock, at worst it's a duplicate
+			logrus.Error(stackerr.Wrap(err))
+			return nil, unlock, nil
+		}
+		if locked {
+			unlock = func() {
+				if err := base.Store.Delete(key); err != nil {
+					logrus.Error(stackerr.Wrap(err))
+				}
+			}
+			// the previous holder could create the scan between the check and the lock
+			obj, err := active()
+			if obj != nil || err != nil {
+				unlock()
+				return obj, func() {}, err
+			}
+			return nil, unlock, nil
+		}
+		if i >= coalesceRetries {
+			// the holder is stuck, so the scan is started anyway
+			return nil, unlock, nil
+		}
+		select {
+		case <-mgr.Context().Done():
+			// the request is gone, nothing waits for the scan
+			return nil, unlock, mgr.Context().Err()
+		case <-time.After(coalesceWait):
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package scan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/email"
+	"github.com/bearded-web/bearded/pkg/scheduler"
+	"github.com/bearded-web/bearded/services"
+)
+
+func TestCoalesce(t *testing.T) {
+	base := services.New(testMgr, nil, scheduler.NewFake(), email.NewConsoleBackend(), config.NewDispatcher().Api)
+	p, err := testMgr.Projects.Create(&project.Project{Name: "coalesce", Owner: testMgr.NewId(), Coalesce: 60})
+	require.NoError(t, err)
+	targetId, planId := testMgr.NewId(), testMgr.NewId()
+	newScan := func(args string) *scan.Scan {
+		return &scan.Scan{
+			Id: testMgr.NewId(), Status: scan.StatusCreated, Project: p.Id, Target: targetId, Plan: planId,
+			Sessions: []*scan.Session{{Id: testMgr.NewId(), Step: &plan.WorkflowStep{Plugin: "barbudo/nmap:0.0.1", Conf: &plan.Conf{CommandArgs: args}}}},
+		}
+	}
+
+	first := newScan("-sV")
+	active, unlock, err := Coalesce(base, testMgr, first)
+	require.NoError(t, err)
+	require.Nil(t, active)
+	require.NotEmpty(t, first.ConfHash)
+	_, err = testMgr.Scans.Create(first)
+	require.NoError(t, err)
+	unlock()
+
+	active, unlock, err = Coalesce(base, testMgr, newScan("-sV"))
+	require.NoError(t, err)
+	require.NotNil(t, active, "the scan with the same config is coalesced")
+	require.Equal(t, first.Id, active.Id)
+	unlock()
+
+	other := newScan("-sS")
+	active, unlock, err = Coalesce(base, testMgr, other)
+	require.NoError(t, err)
+	require.Nil(t, active, "scans with other overrides aren't coalesced")
+
+	// the lock is held, so the next scan with the same config waits until the request is gone
+	ctx, cancel := context.WithCancel(context.Background())
+	ctxMgr := testMgr.CopyCtx(ctx)
+	defer ctxMgr.Close()
+	time.AfterFunc(coalesceWait*2, cancel)
+	start := time.Now()
+	active, _, err = Coalesce(base, ctxMgr, newScan("-sS"))
+	require.Equal(t, context.Canceled, err)
+	require.Nil(t, active)
+	require.True(t, time.Now().Sub(start) < coalesceWait*coalesceRetries/2, "waiting is stopped with the request")
+	unlock()
+}
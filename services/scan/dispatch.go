@@ -0,0 +1,45 @@
+package scan
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/agent"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/scheduler"
+	"github.com/bearded-web/bearded/services"
+)
+
+func (s *ScanService) RegisterDispatch(ws *restful.WebService) {
+	r := ws.GET(fmt.Sprintf("{%s}/dispatch", ParamId)).To(s.TakeScan(s.dispatch))
+	r.Doc("dispatch")
+	r.Operation("dispatch")
+	r.Param(ws.PathParameter(ParamId, ""))
+	addDefaults(r)
+	r.Notes("Authorization required. Why the scan isn't taken by agents. " +
+		"Admins get agents with reasons why every one of them can't take the scan.")
+	r.Writes(agent.Dispatch{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+}
+
+func (s *ScanService) dispatch(req *restful.Request, resp *restful.Response, sc *scan.Scan) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	d, err := scheduler.Diagnose(mgr, sc, mgr.Permission.IsAdmin(filters.GetUser(req)))
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.WriteEntity(d)
+}
@@ -0,0 +1,61 @@
+package scan
+
+import (
+	"bytes"
+	"text/template"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/plugin"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+const dryRunStep = "dry run"
+
+// NewDryRun builds the scan with one session of the plugin against the test target.
+// Command args and form data are templates like in plan steps, so configs are tested as is.
+func NewDryRun(mgr *manager.Manager, owner bson.ObjectId, pl *plugin.Plugin, conf *plan.Conf) (*scan.Scan, error) {
+	scanConf := scan.ScanConf{Target: conf.Target}
+	var err error
+	if conf.CommandArgs, err = renderConf(conf.CommandArgs, scanConf); err != nil {
+		return nil, err
+	}
+	if conf.FormData, err = renderConf(conf.FormData, scanConf); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return &scan.Scan{
+		Status: scan.StatusCreated,
+		Owner:  owner,
+		Conf:   scanConf,
+		Sessions: []*scan.Session{{
+			Id:     mgr.NewId(),
+			Status: scan.StatusCreated,
+			Step:   &plan.WorkflowStep{Plugin: pl.Ref(), Name: dryRunStep, Conf: conf},
+			Plugin: pl.Id,
+			Dates: scan.Dates{
+				Created: &now,
+				Updated: &now,
+			},
+		}},
+		DryRun: &scan.DryRun{Plugin: pl.Id, Created: now},
+	}, nil
+}
+
+func renderConf(text string, conf scan.ScanConf) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	t, err := template.New("").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := t.Execute(buf, conf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,41 @@
+package scan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/plugin"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/manager"
+)
+
+func TestNewDryRun(t *testing.T) {
+	pl := &plugin.Plugin{Id: bson.NewObjectId(), Name: "barbudo/wappalyzer", Version: "0.0.2"}
+	owner := bson.NewObjectId()
+	conf := &plan.Conf{Target: "http://127.0.0.1/api/v1/echo", CommandArgs: "--url {{.Target}}"}
+
+	sc, err := NewDryRun(&manager.Manager{}, owner, pl, conf)
+	require.NoError(t, err)
+	require.Equal(t, scan.StatusCreated, sc.Status)
+	require.Equal(t, owner, sc.Owner)
+	require.Equal(t, bson.ObjectId(""), sc.Project)
+	require.NotNil(t, sc.DryRun)
+	require.Equal(t, pl.Id, sc.DryRun.Plugin)
+	require.Len(t, sc.Sessions, 1)
+	sess := sc.Sessions[0]
+	require.Equal(t, pl.Id, sess.Plugin)
+	require.Equal(t, "barbudo/wappalyzer:0.0.2", sess.Step.Plugin)
+	require.Equal(t, "--url http://127.0.0.1/api/v1/echo", sess.Step.Conf.CommandArgs)
+
+	_, err = NewDryRun(&manager.Manager{}, owner, pl, &plan.Conf{CommandArgs: "{{.Target"})
+	require.Error(t, err)
+
+	rep := &report.Report{ScanSession: sess.Id}
+	sc.DryRun.Reports = []*report.Report{rep}
+	require.Equal(t, rep, sc.DryRun.GetReport(sess.Id))
+	require.Nil(t, sc.DryRun.GetReport(bson.NewObjectId()))
+}
@@ -1,7 +1,24 @@
 package scan
 
-import "github.com/bearded-web/bearded/models/scan"
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/scan"
+)
 
 type SessionUpdateEntity struct {
 	Status scan.ScanStatus `json:"status" description:"one of [working|finished|failed]"`
+	Error  string          `json:"error,omitempty" description:"error of the failed or timed out session, it's reported to ops"`
+
+	TimedOut bool `json:"timedOut,omitempty" description:"the step timeout is exceeded, it's only set with the finished status"`
+}
+
+type ProgressEntity struct {
+	Percent int    `json:"percent" description:"0-100"`
+	Message string `json:"message,omitempty" description:"what the plugin is doing, 256 symbols max" validate:"max=256"`
+}
+
+type CloneEntity struct {
+	Target bson.ObjectId `json:"target,omitempty" description:"target of the same project, the original one by default"`
+	Plan   bson.ObjectId `json:"plan,omitempty" description:"plan for the new scan, the original one by default"`
 }
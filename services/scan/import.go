@@ -0,0 +1,182 @@
+package scan
+
+import (
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/importer"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/services"
+)
+
+const importStep = "import"
+
+func (s *ScanService) RegisterImport(ws *restful.WebService) {
+	r := ws.POST("import").To(s.importResults)
+	r.Filter(s.LongTimeout())
+	r.Filter(s.LargeBody())
+	r.Doc("import")
+	r.Operation("import")
+	r.Notes("Authorization required. The body is results of the third-party scanner in the format, like ZAP json report " +
+		"or SARIF log. The finished scan of the target is created with the session for every tool, issues are merged " +
+		"with known ones of the target, fields which aren't mapped are kept in issue raw.")
+	r.Param(ws.QueryParameter("target", "target id").Required(true))
+	r.Param(ws.QueryParameter("format", "one of [zap|sarif]").Required(true))
+	addDefaults(r)
+	r.Writes(scan.Scan{})
+	r.Do(services.Returns(http.StatusCreated))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusRequestEntityTooLarge))
+	ws.Route(r)
+}
+
+func (s *ScanService) importResults(req *restful.Request, resp *restful.Response) {
+	format := scan.ImportFormat(req.QueryParameter("format"))
+	if !format.IsValid() {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("format should be one of [zap|sarif]"))
+		return
+	}
+	targetId := req.QueryParameter("target")
+	if !s.IsId(targetId) {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("target should be an id"))
+		return
+	}
+	data, err := ioutil.ReadAll(req.Request.Body)
+	if err != nil {
+		logrus.Warn(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	runs, err := importer.Parse(format, data)
+	if err != nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
+		return
+	}
+	u := filters.GetUser(req)
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	t, err := mgr.Targets.GetById(mgr.ToId(targetId))
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("target not found"))
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	p, err := mgr.Projects.GetById(t.Project)
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("project not found"))
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	if sErr := services.Must(services.HasProjectPermission(mgr, u, p)); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	sc, err := mgr.Scans.Create(NewImport(mgr, u.Id, t, format, runs))
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	if _, err := mgr.Feed.AddScan(sc); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+	for i, run := range runs {
+		if err := s.importRun(mgr, sc, sc.Sessions[i], run); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+	}
+	// external tools scan only a part of the target, so missing issues aren't closed by imports
+	if err := s.evaluateScan(mgr, sc); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+	logrus.Infof("Scan %s is imported from %s results by %s", sc, format, u)
+
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(sc)
+}
+
+// importRun stores the report of the tool and creates issues of the target like reports of plugins
+func (s *ScanService) importRun(mgr *manager.Manager, sc *scan.Scan, sess *scan.Session, run *importer.Run) error {
+	raw := &report.Report{Type: report.TypeIssues, Issues: run.Issues}
+	if len(run.Issues) == 0 {
+		raw.Type = report.TypeEmpty
+	}
+	raw.SetScan(sc.Id)
+	raw.SetScanSession(sess.Id)
+	raw.Project = sc.Project
+	// adapters could be registered for tools like for plugins
+	s.Normalizer.Normalize(run.Tool, raw.GetAllIssues()...)
+	if err := s.Outputs.SetPurgeAfter(mgr, sc, raw); err != nil {
+		return err
+	}
+	rep, err := mgr.Reports.Create(raw)
+	if err != nil {
+		return err
+	}
+	if err := s.createTargetIssues(rep, sc, sess, run.Ref()); err != nil {
+		return err
+	}
+	if err := mgr.Feed.UpdateScanReport(sc, rep); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+	return nil
+}
+
+// NewImport builds the finished scan of the target with the session for every run of tools, it isn't queued
+func NewImport(mgr *manager.Manager, owner bson.ObjectId, t *target.Target, format scan.ImportFormat,
+	runs []*importer.Run) *scan.Scan {
+	now := time.Now().UTC()
+	sc := &scan.Scan{
+		Status:   scan.StatusFinished,
+		Owner:    owner,
+		Project:  t.Project,
+		Target:   t.Id,
+		Conf:     scan.ScanConf{Target: t.Addr()},
+		Sessions: []*scan.Session{},
+		Import:   &scan.Import{Format: format, Created: now},
+		Dates: scan.Dates{
+			Started:  &now,
+			Finished: &now,
+		},
+	}
+	for _, run := range runs {
+		sc.Import.Tools = append(sc.Import.Tools, run.Ref())
+		sc.Sessions = append(sc.Sessions, &scan.Session{
+			Id:     mgr.NewId(),
+			Status: scan.StatusFinished,
+			Step:   &plan.WorkflowStep{Plugin: run.Tool, Name: importStep},
+			Dates: scan.Dates{
+				Created:  &now,
+				Updated:  &now,
+				Started:  &now,
+				Finished: &now,
+			},
+		})
+	}
+	return sc
+}
@@ -0,0 +1,113 @@
+package scan
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/feed"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/services"
+)
+
+func (s *ScanService) RegisterPause(ws *restful.WebService) {
+	r := ws.POST(fmt.Sprintf("{%s}/pause", ParamId)).To(s.TakeScan(s.pause))
+	r.Doc("pause")
+	r.Operation("pause")
+	r.Notes("Authorization required. New sessions of the paused scan aren't started, working ones are finished. " +
+		"Paused scans are failed if they aren't resumed in time.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	addDefaults(r)
+	r.Writes(scan.Scan{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusConflict))
+	ws.Route(r)
+
+	r = ws.POST(fmt.Sprintf("{%s}/resume", ParamId)).To(s.TakeScan(s.resume))
+	r.Doc("resume")
+	r.Operation("resume")
+	r.Notes("Authorization required. The scan continues from the next session.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	addDefaults(r)
+	r.Writes(scan.Scan{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusConflict))
+	ws.Route(r)
+}
+
+func (s *ScanService) pause(req *restful.Request, resp *restful.Response, sc *scan.Scan) {
+	if sc.Status != scan.StatusQueued && sc.Status != scan.StatusWorking {
+		services.WriteError(resp, http.StatusConflict,
+			services.NewError(services.CodeStatus, "only queued or working scan could be paused"))
+		return
+	}
+	s.changeStatus(req, resp, sc, scan.StatusPaused, feed.TypePause)
+}
+
+func (s *ScanService) resume(req *restful.Request, resp *restful.Response, sc *scan.Scan) {
+	if sc.Status != scan.StatusPaused {
+		services.WriteError(resp, http.StatusConflict,
+			services.NewError(services.CodeStatus, "scan isn't paused"))
+		return
+	}
+	s.changeStatus(req, resp, sc, resumeStatus(sc), feed.TypeResume)
+}
+
+// The resumed scan is working if it has a working session, it's queued if there are sessions to start,
+// otherwise the sessions were finished during the pause.
+func resumeStatus(sc *scan.Scan) scan.ScanStatus {
+	to := scan.StatusFinished
+	for _, sess := range sc.Sessions {
+		switch sess.Status {
+		case scan.StatusWorking:
+			return scan.StatusWorking
+		case scan.StatusCreated, scan.StatusQueued:
+			to = scan.StatusQueued
+		}
+	}
+	return to
+}
+
+func (s *ScanService) changeStatus(req *restful.Request, resp *restful.Response, sc *scan.Scan,
+	to scan.ScanStatus, event feed.ItemType) {
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if err := mgr.Scans.Transition(sc, to); err != nil {
+		if mgr.IsTransitionErr(err) {
+			services.WriteError(resp, http.StatusConflict, services.NewError(services.CodeStatus, err.Error()))
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	logrus.Infof("Scan %s is %s by %s", sc, event, filters.GetUser(req))
+	s.afterStatus(mgr, sc)
+	if _, err := mgr.Feed.AddScanEvent(sc, event, filters.GetUser(req).Id); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+	resp.WriteEntity(sc)
+}
+
+// the scheduler and the feed get the new status, done scans are evaluated
+func (s *ScanService) afterStatus(mgr *manager.Manager, sc *scan.Scan) {
+	if err := s.evaluateScan(mgr, sc); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+	s.Scheduler().UpdateScan(sc)
+	s.queueGroup(sc)
+	if err := mgr.Feed.UpdateScan(sc); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+}
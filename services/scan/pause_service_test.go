@@ -0,0 +1,24 @@
+package scan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/models/scan"
+)
+
+func TestResumeStatus(t *testing.T) {
+	sessions := func(statuses ...scan.ScanStatus) *scan.Scan {
+		sc := &scan.Scan{Status: scan.StatusPaused}
+		for _, st := range statuses {
+			sc.Sessions = append(sc.Sessions, &scan.Session{Status: st})
+		}
+		return sc
+	}
+	require.Equal(t, scan.StatusWorking, resumeStatus(sessions(scan.StatusFinished, scan.StatusWorking, scan.StatusCreated)))
+	require.Equal(t, scan.StatusQueued, resumeStatus(sessions(scan.StatusFinished, scan.StatusCreated)))
+	require.Equal(t, scan.StatusQueued, resumeStatus(sessions(scan.StatusQueued)))
+	require.Equal(t, scan.StatusFinished, resumeStatus(sessions(scan.StatusFinished, scan.StatusFinished)),
+		"sessions were finished during the pause")
+}
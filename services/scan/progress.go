@@ -0,0 +1,159 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+	"golang.org/x/net/context"
+
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/services"
+)
+
+// how often the progress of the followed scan is checked
+const progressPollInterval = time.Second
+
+func (s *ScanService) RegisterProgress(ws *restful.WebService) {
+	r := ws.PUT(fmt.Sprintf("{%s}/sessions/{%s}/progress", ParamId, SessionParamId)).To(s.TakeScan(s.TakeSession(s.sessionProgress)))
+	r.Doc("sessionProgress")
+	r.Operation("sessionProgress")
+	addDefaults(r)
+	r.Notes("Authorization required. Progress of the working session which is reported by the plugin.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.PathParameter(SessionParamId, ""))
+	r.Reads(ProgressEntity{})
+	r.Writes(scan.Session{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest, http.StatusConflict))
+	ws.Route(r)
+
+	r = ws.GET(fmt.Sprintf("{%s}/progress", ParamId)).To(s.TakeScan(s.progress))
+	r.Doc("progress")
+	r.Operation("progress")
+	addDefaults(r)
+	r.Notes("Authorization required. Estimated progress of the scan and its sessions, " +
+		"sessions which don't report progress are estimated by their status.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.QueryParameter("follow", "stream progress as text/event-stream until the scan is done").DataType("boolean"))
+	r.Writes(scan.ScanProgress{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	ws.Route(r)
+}
+
+func (s *ScanService) sessionProgress(req *restful.Request, resp *restful.Response, sc *scan.Scan, sess *scan.Session) {
+	raw := &ProgressEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Warn(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	if raw.Percent < 0 || raw.Percent > 100 {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("percent should be in 0-100"))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	err := mgr.Scans.UpdateSessionProgress(sc, sess, &scan.Progress{Percent: raw.Percent, Message: raw.Message})
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusConflict, services.NewError(services.CodeStatus, "session isn't working"))
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.WriteEntity(sess)
+}
+
+func (s *ScanService) progress(req *restful.Request, resp *restful.Response, sc *scan.Scan) {
+	if req.QueryParameter("follow") != "true" || sc.IsDone() {
+		resp.WriteEntity(sc.GetProgress())
+		return
+	}
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	s.followProgress(services.Context(req), resp, mgr, sc)
+}
+
+// Send the progress as server-sent events when it's changed, the scan is polled until it's done or the client is gone
+func (s *ScanService) followProgress(ctx context.Context, resp *restful.Response, mgr *manager.Manager, sc *scan.Scan) {
+	flusher, ok := resp.ResponseWriter.(http.Flusher)
+	if !ok {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("streaming isn't supported"))
+		return
+	}
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.WriteHeader(http.StatusOK)
+
+	var last []byte
+	send := func(sc *scan.Scan) error {
+		data, err := json.Marshal(sc.GetProgress())
+		if err != nil {
+			return err
+		}
+		if string(data) == string(last) {
+			return nil
+		}
+		last = data
+		if _, err := fmt.Fprintf(resp, "event: progress\ndata: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	if err := send(sc); err != nil {
+		return
+	}
+
+	id := sc.Id
+	ticker := time.NewTicker(progressPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current, err := mgr.Scans.GetById(id)
+		if err != nil {
+			if !mgr.IsNotFound(err) {
+				logrus.Error(stackerr.Wrap(err))
+			}
+			return
+		}
+		if err := send(current); err != nil {
+			return
+		}
+		if current.IsDone() {
+			fmt.Fprint(resp, "event: end\ndata: {}\n\n")
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+// setProgress estimates progress of scans for responses
+func setProgress(scans ...*scan.Scan) {
+	for _, sc := range scans {
+		sc.Progress = sc.EstimateProgress()
+	}
+}
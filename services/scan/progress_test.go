@@ -0,0 +1,45 @@
+package scan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/scan"
+)
+
+func TestScanProgress(t *testing.T) {
+	sc := &scan.Scan{
+		Id:     bson.NewObjectId(),
+		Status: scan.StatusWorking,
+		Sessions: []*scan.Session{
+			{Id: bson.NewObjectId(), Status: scan.StatusFinished, Step: &plan.WorkflowStep{Plugin: "crawler", Name: "crawl"}},
+			{Id: bson.NewObjectId(), Status: scan.StatusWorking, Step: &plan.WorkflowStep{Plugin: "wpscan", Name: "wp"},
+				Progress: &scan.Progress{Percent: 50, Message: "plugins"}},
+			{Id: bson.NewObjectId(), Status: scan.StatusCreated},
+		},
+	}
+	// plugins which don't report progress are estimated by done sessions
+	setProgress(sc)
+	require.Equal(t, 50, sc.Progress)
+
+	p := sc.GetProgress()
+	require.Equal(t, 50, p.Percent)
+	require.Len(t, p.Sessions, 3)
+	require.Equal(t, 100, p.Sessions[0].Percent)
+	require.Equal(t, "crawler", p.Sessions[0].Plugin)
+	require.Equal(t, 50, p.Sessions[1].Percent)
+	require.Equal(t, "plugins", p.Sessions[1].Message)
+	require.Equal(t, 0, p.Sessions[2].Percent)
+
+	// done sessions are complete and their messages are dropped
+	sc.Sessions[1].Status = scan.StatusFailed
+	sc.Sessions[2].Status = scan.StatusFinished
+	sc.Status = scan.StatusFinished
+	require.Equal(t, 100, sc.EstimateProgress())
+	require.Equal(t, "", sc.GetProgress().Sessions[1].Message)
+
+	require.Equal(t, 0, (&scan.Scan{Status: scan.StatusCreated}).EstimateProgress())
+}
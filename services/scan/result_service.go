@@ -0,0 +1,181 @@
+package scan
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/policy"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/services"
+)
+
+const (
+	// long polling is limited, so connections aren't closed by proxies
+	MaxResultWait = 60
+	// how often the scan is checked while waiting
+	resultPollInterval = time.Second
+)
+
+func (s *ScanService) RegisterResult(ws *restful.WebService) {
+	r := ws.GET(fmt.Sprintf("{%s}/result", ParamId)).To(s.TakeScan(s.result))
+	// waiting for the result could take up to MaxResultWait
+	r.Filter(s.LongTimeout())
+	r.Doc("result")
+	r.Operation("result")
+	r.Notes("Authorization required. Returns counts of issues by severity and if the scan passed the threshold. " +
+		"Use wait parameter to block until the scan is done.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.QueryParameter("wait", fmt.Sprintf("wait until the scan is done up to this number of seconds, %d max", MaxResultWait)))
+	addDefaults(r)
+	r.Writes(scan.Result{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+}
+
+func (s *ScanService) result(req *restful.Request, resp *restful.Response, sc *scan.Scan) {
+	wait := 0
+	if raw := req.QueryParameter("wait"); raw != "" {
+		val, err := strconv.Atoi(raw)
+		if err != nil || val < 0 {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("wait should be a positive number of seconds"))
+			return
+		}
+		wait = val
+		if wait > MaxResultWait {
+			wait = MaxResultWait
+		}
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if wait > 0 && !sc.IsDone() {
+		// the request context is done when the client is gone
+		closed := services.Context(req).Done()
+		deadline := time.After(time.Duration(wait) * time.Second)
+		ticker := time.NewTicker(resultPollInterval)
+		defer ticker.Stop()
+	loop:
+		for !sc.IsDone() {
+			select {
+			case <-closed:
+				return
+			case <-deadline:
+				break loop
+			case <-ticker.C:
+				obj, err := mgr.Scans.GetById(sc.Id)
+				if err != nil {
+					if mgr.IsNotFound(err) {
+						services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+						return
+					}
+					logrus.Error(stackerr.Wrap(err))
+					services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+					return
+				}
+				sc = obj
+			}
+		}
+	}
+
+	result, err := s.getResult(mgr, sc)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.WriteEntity(result)
+}
+
+// Get issue counts for the scan and evaluate the scan policy.
+// The stored result is used for scans which were evaluated when they had been finished.
+func (s *ScanService) getResult(mgr *manager.Manager, sc *scan.Scan) (*scan.Result, error) {
+	p, err := s.getPolicy(mgr, sc)
+	if err != nil {
+		return nil, err
+	}
+	// issues from the baseline are known, so they don't break the policy
+	var baseline bson.ObjectId
+	if p.NewOnly {
+		projectObj, err := mgr.Projects.GetById(sc.Project)
+		if err != nil && !mgr.IsNotFound(err) {
+			return nil, err
+		}
+		if err == nil && projectObj.Baseline != nil {
+			baseline = projectObj.Baseline.Id
+		}
+	}
+	summary, err := mgr.Issues.GetScanSummary(sc.Id, baseline)
+	if err != nil {
+		return nil, err
+	}
+	cvss, err := mgr.Issues.GetScanCvssCounts(sc.Id, baseline, p.CvssScores())
+	if err != nil {
+		return nil, err
+	}
+	cfg := s.ApiCfg()
+	result := &scan.Result{
+		Scan:   sc.Id,
+		Status: sc.Status,
+		Done:   sc.IsDone(),
+		Issues: summary,
+		Policy: p,
+		Url:    cfg.Host + strings.Replace(cfg.ScanPath, "%s", sc.Id.Hex(), 1),
+	}
+	if sc.Passed != nil {
+		result.Passed = *sc.Passed
+		result.Violations = sc.Violations
+		return result, nil
+	}
+	passed, violations := p.Evaluate(summary, cvss)
+	result.Passed = passed && sc.Status == scan.StatusFinished
+	result.Violations = violations
+	return result, nil
+}
+
+// Scan policy is taken from the plan, then from the project, otherwise the default one is used
+func (s *ScanService) getPolicy(mgr *manager.Manager, sc *scan.Scan) (*policy.Policy, error) {
+	planObj, err := mgr.Plans.GetById(sc.Plan)
+	if err != nil && !mgr.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil && planObj.Policy != nil {
+		return planObj.Policy, nil
+	}
+	projectObj, err := mgr.Projects.GetById(sc.Project)
+	if err != nil && !mgr.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil && projectObj.Policy != nil {
+		return projectObj.Policy, nil
+	}
+	return policy.Default(issue.Severity(s.ApiCfg().ScanFailSeverity)), nil
+}
+
+// Evaluate the policy when the scan is done and save the result to the scan
+func (s *ScanService) evaluateScan(mgr *manager.Manager, sc *scan.Scan) error {
+	if !sc.IsDone() || sc.Passed != nil {
+		return nil
+	}
+	result, err := s.getResult(mgr, sc)
+	if err != nil {
+		return err
+	}
+	sc.Passed = &result.Passed
+	sc.Violations = result.Violations
+	logrus.Infof("Scan %s is done, passed: %v %v", sc, result.Passed, result.Violations)
+	return mgr.Scans.SetResult(sc)
+}
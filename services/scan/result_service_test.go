@@ -0,0 +1,218 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/policy"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/email"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/scheduler"
+	"github.com/bearded-web/bearded/services"
+)
+
+// serves scans for the new user with the own project
+func newTestScanServer(t *testing.T) (*httptest.Server, *user.User, *project.Project) {
+	logrus.SetLevel(logrus.PanicLevel)
+	u, err := testMgr.Users.Create(&user.User{})
+	require.NoError(t, err)
+	p, err := testMgr.Projects.Create(&project.Project{Name: "result", Owner: u.Id})
+	require.NoError(t, err)
+
+	sess := filters.NewSession()
+	sess.Set(filters.SessionUserKey, u.Id.Hex())
+	service := New(services.New(testMgr, nil, scheduler.NewFake(),
+		email.NewConsoleBackend(), config.NewDispatcher().Api))
+	container := restful.NewContainer()
+	container.Router(restful.CurlyRouter{})
+	container.Filter(filters.SessionFilterMock(sess))
+	service.Register(container)
+	return httptest.NewServer(container), u, p
+}
+
+func createTestScan(t *testing.T, p *project.Project, status scan.ScanStatus) *scan.Scan {
+	sc, err := testMgr.Scans.Create(&scan.Scan{
+		Status:  status,
+		Plan:    testMgr.NewId(),
+		Target:  testMgr.NewId(),
+		Owner:   p.Owner,
+		Project: p.Id,
+	})
+	require.NoError(t, err)
+	return sc
+}
+
+func reportTestIssue(t *testing.T, sc *scan.Scan, severity issue.Severity, status issue.Status) *issue.TargetIssue {
+	obj, err := testMgr.Issues.Create(&issue.TargetIssue{
+		Target:  sc.Target,
+		Project: sc.Project,
+		Issue:   issue.Issue{Severity: severity, UniqId: bson.NewObjectId().Hex()},
+		Status:  status,
+		Activities: []*issue.Activity{
+			{Type: issue.ActivityReported, Report: &issue.Report{Report: testMgr.NewId(), Scan: sc.Id}},
+		},
+	})
+	require.NoError(t, err)
+	return obj
+}
+
+func getTestResult(t *testing.T, url string, sc *scan.Scan, query string) (int, *scan.Result) {
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/scans/%s/result%s", url, sc.Id.Hex(), query))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	result := &scan.Result{}
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp.StatusCode, result
+}
+
+func TestScanResult(t *testing.T) {
+	ts, _, p := newTestScanServer(t)
+	defer ts.Close()
+
+	sc := createTestScan(t, p, scan.StatusFinished)
+	reportTestIssue(t, sc, issue.SeverityHigh, issue.Status{})
+	reportTestIssue(t, sc, issue.SeverityLow, issue.Status{})
+	reportTestIssue(t, sc, issue.SeverityLow, issue.Status{Confirmed: true})
+	reportTestIssue(t, sc, issue.SeverityHigh, issue.Status{False: true})
+
+	code, result := getTestResult(t, ts.URL, sc, "")
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, result.Done)
+	require.Equal(t, map[issue.Severity]int{issue.SeverityHigh: 1, issue.SeverityLow: 2}, result.Issues)
+	// the default policy fails on high issues
+	require.False(t, result.Passed)
+	require.NotEmpty(t, result.Violations)
+
+	clean := createTestScan(t, p, scan.StatusFinished)
+	reportTestIssue(t, clean, issue.SeverityLow, issue.Status{})
+	code, result = getTestResult(t, ts.URL, clean, "")
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, result.Passed)
+
+	code, _ = getTestResult(t, ts.URL, sc, "?wait=soon")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = getTestResult(t, ts.URL, sc, "?wait=-1")
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestScanResultWait(t *testing.T) {
+	ts, _, p := newTestScanServer(t)
+	defer ts.Close()
+
+	// the scan isn't done before the deadline
+	working := createTestScan(t, p, scan.StatusWorking)
+	started := time.Now()
+	code, result := getTestResult(t, ts.URL, working, "?wait=1")
+	require.Equal(t, http.StatusOK, code)
+	require.False(t, result.Done)
+	require.False(t, result.Passed)
+	require.True(t, time.Since(started) >= time.Second)
+
+	// the request returns as soon as the scan is done
+	sc := createTestScan(t, p, scan.StatusWorking)
+	reportTestIssue(t, sc, issue.SeverityLow, issue.Status{})
+	go func() {
+		time.Sleep(resultPollInterval / 2)
+		obj, err := testMgr.Scans.GetById(sc.Id)
+		if err == nil {
+			testMgr.Scans.Transition(obj, scan.StatusFinished)
+		}
+	}()
+	started = time.Now()
+	code, result = getTestResult(t, ts.URL, sc, fmt.Sprintf("?wait=%d", MaxResultWait))
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, result.Done)
+	require.True(t, result.Passed)
+	require.Equal(t, map[issue.Severity]int{issue.SeverityLow: 1}, result.Issues)
+	require.True(t, time.Since(started) < resultPollInterval*5)
+}
+
+func TestEvaluateScan(t *testing.T) {
+	logrus.SetLevel(logrus.PanicLevel)
+	service := New(services.New(testMgr, nil, scheduler.NewFake(),
+		email.NewConsoleBackend(), config.NewDispatcher().Api))
+	u, err := testMgr.Users.Create(&user.User{})
+	require.NoError(t, err)
+	p, err := testMgr.Projects.Create(&project.Project{
+		Name:   "evaluate",
+		Owner:  u.Id,
+		Policy: &policy.Policy{Rules: []*policy.Rule{{Severity: issue.SeverityMedium, Max: 1}}},
+	})
+	require.NoError(t, err)
+
+	evaluate := func(sc *scan.Scan) *scan.Scan {
+		require.NoError(t, service.evaluateScan(testMgr, sc))
+		obj, err := testMgr.Scans.GetById(sc.Id)
+		require.NoError(t, err)
+		return obj
+	}
+	reportCvss := func(sc *scan.Scan, score float64) {
+		obj := reportTestIssue(t, sc, issue.CvssSeverity(score), issue.Status{})
+		obj.Cvss = score
+		require.NoError(t, testMgr.Issues.Update(obj))
+	}
+
+	// the project policy allows one medium issue
+	sc := createTestScan(t, p, scan.StatusFinished)
+	reportTestIssue(t, sc, issue.SeverityMedium, issue.Status{})
+	reportTestIssue(t, sc, issue.SeverityHigh, issue.Status{False: true})
+	sc = evaluate(sc)
+	require.NotNil(t, sc.Passed)
+	require.True(t, *sc.Passed)
+	require.Empty(t, sc.Violations)
+
+	reportTestIssue(t, sc, issue.SeverityMedium, issue.Status{})
+	// the result is evaluated only once
+	require.True(t, *evaluate(sc).Passed)
+	sc.Passed = nil
+	sc = evaluate(sc)
+	require.False(t, *sc.Passed)
+	require.Equal(t, []string{"2 medium issues, 1 allowed"}, sc.Violations)
+
+	// the plan policy is preferred and counts issues by cvss score
+	pl, err := testMgr.Plans.Create(&plan.Plan{
+		Name:   "cvss",
+		Policy: &policy.Policy{Rules: []*policy.Rule{{Cvss: 9.0, Max: 0}}},
+	})
+	require.NoError(t, err)
+	sc = createTestScan(t, p, scan.StatusFinished)
+	sc.Plan = pl.Id
+	require.NoError(t, testMgr.Scans.Update(sc))
+	reportTestIssue(t, sc, issue.SeverityMedium, issue.Status{})
+	reportTestIssue(t, sc, issue.SeverityMedium, issue.Status{})
+	reportCvss(sc, 8.9)
+	require.True(t, *evaluate(sc).Passed)
+
+	sc = createTestScan(t, p, scan.StatusFinished)
+	sc.Plan = pl.Id
+	require.NoError(t, testMgr.Scans.Update(sc))
+	reportCvss(sc, 9.0)
+	reportCvss(sc, 9.8)
+	sc = evaluate(sc)
+	require.False(t, *sc.Passed)
+	require.Equal(t, []string{"2 cvss 9+ issues, 0 allowed"}, sc.Violations)
+
+	// failed scans never pass, scans in progress aren't evaluated
+	sc = evaluate(createTestScan(t, p, scan.StatusFailed))
+	require.False(t, *sc.Passed)
+	require.Empty(t, sc.Violations)
+	sc = evaluate(createTestScan(t, p, scan.StatusWorking))
+	require.Nil(t, sc.Passed)
+}
@@ -4,21 +4,30 @@ import (
 	"bytes"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 	"text/template"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/facebookgo/stackerr"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
 
+	"github.com/bearded-web/bearded/models/issue"
 	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/project"
 	"github.com/bearded-web/bearded/models/report"
 	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/search"
 	"github.com/bearded-web/bearded/pkg/filters"
 	"github.com/bearded-web/bearded/pkg/fltr"
 	"github.com/bearded-web/bearded/pkg/manager"
 	"github.com/bearded-web/bearded/pkg/pagination"
+	"github.com/bearded-web/bearded/pkg/scheduler"
 	"github.com/bearded-web/bearded/services"
+	searchService "github.com/bearded-web/bearded/services/search"
 )
 
 const (
@@ -28,14 +37,25 @@ const (
 
 type ScanService struct {
 	*services.BaseService
+	searches *searchService.SearchService
+	sorter   *fltr.Sorter
 }
 
 func New(base *services.BaseService) *ScanService {
 	return &ScanService{
 		BaseService: base,
+		searches:    searchService.New(base, search.TypeScan, manager.ScanFltr{}),
+		sorter:      fltr.NewSorter("created", "updated", "finished", "status"),
 	}
 }
 
+func (s *ScanService) Init() error {
+	if severity := s.ApiCfg().ScanFailSeverity; issue.Severity(severity).Level() == 0 {
+		return fmt.Errorf("wrong scan fail severity %q", severity)
+	}
+	return nil
+}
+
 func addDefaults(r *restful.RouteBuilder) {
 	r.Notes("Authorization required")
 	r.Do(services.ReturnsE(
@@ -52,13 +72,18 @@ func (s *ScanService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
-	ws.Filter(filters.AuthRequiredFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
 
 	r := ws.GET("").To(s.list)
 	r.Doc("list")
 	r.Operation("list")
 	s.SetParams(r, fltr.GetParams(ws, manager.ScanFltr{}))
+	r.Param(s.searches.Param(ws))
+	r.Param(s.sorter.Param())
+	r.Param(s.Paginator.SkipParam())
+	r.Param(s.Paginator.LimitParam())
 	addDefaults(r)
+	r.Notes("Authorization required. Newest scans are listed first by default.")
 	r.Writes(scan.ScanList{})
 	r.Do(services.Returns(http.StatusOK))
 	ws.Route(r)
@@ -69,13 +94,36 @@ func (s *ScanService) Register(container *restful.Container) {
 	addDefaults(r)
 	r.Writes(scan.Scan{})
 	r.Reads(scan.Scan{})
-	r.Do(services.Returns(http.StatusCreated))
+	r.Notes("Scans of targets outside of their scan windows wait for them, waitWindow is set in the response. " +
+		"The default plan of the project is used if the plan is empty. " +
+		"If coalescing is enabled in the project, the active scan of the same target and plan is returned with 200.")
+	r.Filter(filters.IdempotencyFilter(s.BaseManager()))
+	r.Param(filters.IdempotencyParam(ws))
+	r.Param(OverrideParam(ws))
+	r.Do(services.Returns(http.StatusCreated, http.StatusOK))
 	r.Do(services.ReturnsE(
 		http.StatusBadRequest,
 		http.StatusConflict,
+		services.StatusTooManyRequests,
 	))
 	ws.Route(r)
 
+	r = ws.POST(fmt.Sprintf("{%s}/clone", ParamId)).To(s.TakeScan(s.clone))
+	r.Doc("clone")
+	r.Operation("clone")
+	r.Notes("Authorization required. Starts a new scan with the target, the plan and plugin configs of this one. " +
+		"Changing the target or the plan builds plugin configs from the plan again.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(OverrideParam(ws))
+	addDefaults(r)
+	r.Reads(CloneEntity{})
+	r.Writes(scan.Scan{})
+	r.Do(services.Returns(
+		http.StatusCreated,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
 	r = ws.GET(fmt.Sprintf("{%s}", ParamId)).To(s.TakeScan(s.get))
 	r.Doc("get")
 	r.Operation("get")
@@ -112,6 +160,7 @@ func (s *ScanService) Register(container *restful.Container) {
 	ws.Route(r)
 
 	r = ws.GET(fmt.Sprintf("{%s}/reports", ParamId)).To(s.TakeScan(s.reports))
+	r.Filter(s.LongTimeout())
 	r.Doc("reports")
 	r.Operation("reports")
 	r.Param(ws.PathParameter(ParamId, ""))
@@ -120,7 +169,25 @@ func (s *ScanService) Register(container *restful.Container) {
 	r.Do(services.Returns(http.StatusOK))
 	ws.Route(r)
 
+	r = ws.GET(fmt.Sprintf("{%s}/issues", ParamId)).To(s.TakeScan(s.issues))
+	r.Doc("issues")
+	r.Operation("issues")
+	r.Notes("Authorization required. Issues reported by sessions of the scan, including already known ones.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(s.Paginator.SkipParam())
+	r.Param(s.Paginator.LimitParam())
+	addDefaults(r)
+	r.Writes(issue.TargetIssueList{})
+	r.Do(services.Returns(http.StatusOK))
+	ws.Route(r)
+
 	s.RegisterSessions(ws)
+	s.RegisterResult(ws)
+	s.RegisterPause(ws)
+	s.RegisterDispatch(ws)
+	s.RegisterProgress(ws)
+	s.RegisterImport(ws)
+	s.searches.RegisterSearches(ws)
 
 	container.Add(ws)
 }
@@ -133,62 +200,129 @@ func (s *ScanService) create(req *restful.Request, resp *restful.Response) {
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 	u := filters.GetUser(req)
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	// TODO (m0sth8): check project and target permissions for this user
 
-	// validations
-	project, err := mgr.Projects.GetById(raw.Project)
-	if err != nil {
-		resp.WriteServiceError(http.StatusBadRequest,
-			services.NewBadReq("project not found"))
+	sc, errResp := NewScan(mgr, u.Id, raw)
+	if errResp != nil {
+		errResp.Write(resp)
 		return
 	}
+	s.startScan(req, resp, mgr, sc)
+}
 
-	target, err := mgr.Targets.GetById(raw.Target)
-	if err != nil {
-		if mgr.IsNotFound(err) {
-			resp.WriteServiceError(http.StatusBadRequest,
-				services.NewBadReq("target not found"))
+func (s *ScanService) clone(req *restful.Request, resp *restful.Response, orig *scan.Scan) {
+	raw := &CloneEntity{}
+	// the body is optional, the scan is cloned as is without it
+	if req.Request.ContentLength != 0 {
+		if err := req.ReadEntity(raw); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 			return
 		}
-		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
-		return
 	}
-	if target.Project != project.Id {
-		resp.WriteServiceError(http.StatusBadRequest,
-			services.NewBadReq("this target is not from this project"))
+	u := filters.GetUser(req)
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	fields := &scan.Scan{Project: orig.Project, Target: orig.Target, Plan: orig.Plan}
+	if raw.Target != "" {
+		fields.Target = raw.Target
+	}
+	if raw.Plan != "" {
+		fields.Plan = raw.Plan
+	}
+	sc, errResp := NewScan(mgr, u.Id, fields)
+	if errResp != nil {
+		errResp.Write(resp)
 		return
 	}
+	// steps of the original scan are already rendered for its target, so they are reused only for the same target and plan
+	if fields.Target == orig.Target && fields.Plan == orig.Plan {
+		sc.Conf = orig.Conf
+		sc.Sessions = cloneSessions(mgr, orig.Sessions)
+	}
+	logrus.Infof("Scan %s is cloned by %s", orig, u)
+	s.startScan(req, resp, mgr, sc)
+}
 
-	planObj, err := mgr.Plans.GetById(raw.Plan)
+// root sessions of the scan are copied with new ids and created status, children are created by plugins again
+func cloneSessions(mgr *manager.Manager, sessions []*scan.Session) []*scan.Session {
+	now := time.Now().UTC()
+	result := make([]*scan.Session, 0, len(sessions))
+	for _, orig := range sessions {
+		if orig.Step == nil {
+			continue
+		}
+		step := *orig.Step
+		if orig.Step.Conf != nil {
+			conf := *orig.Step.Conf
+			step.Conf = &conf
+		}
+		result = append(result, &scan.Session{
+			Id:     mgr.NewId(),
+			Step:   &step,
+			Plugin: orig.Plugin,
+			Status: scan.StatusCreated,
+			Dates: scan.Dates{
+				Created: &now,
+				Updated: &now,
+			},
+		})
+	}
+	return result
+}
+
+// NewScan validates the project, the target and the plan of raw and builds the scan with sessions from plan steps
+func NewScan(mgr *manager.Manager, owner bson.ObjectId, raw *scan.Scan) (*scan.Scan, *services.ErrResp) {
+	return NewTemplateScan(mgr, owner, raw, nil)
+}
+
+// NewTemplateScan builds the scan like NewScan with plugin configs, params and the scope of the template, tmpl could be nil
+func NewTemplateScan(mgr *manager.Manager, owner bson.ObjectId, raw *scan.Scan, tmpl *scan.Template) (*scan.Scan, *services.ErrResp) {
+	project, err := mgr.Projects.GetById(raw.Project)
+	if err != nil {
+		return nil, &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("project not found")}
+	}
+
+	target, err := mgr.Targets.GetById(raw.Target)
 	if err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteServiceError(http.StatusBadRequest,
-				services.NewBadReq("plan not found"))
-			return
+			return nil, &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("target not found")}
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
-		return
+		return nil, &services.ErrResp{Code: http.StatusInternalServerError, Err: services.DbErr}
+	}
+	if target.Project != project.Id {
+		return nil, &services.ErrResp{Code: http.StatusBadRequest,
+			Err: services.NewBadReq("this target is not from this project")}
+	}
+	if target.Inactive {
+		return nil, &services.ErrResp{Code: http.StatusBadRequest,
+			Err: services.NewBadReq("target is inactive, reactivate it to scan")}
+	}
+
+	planObj, sErr := TakePlan(mgr, project, raw.Plan.Hex())
+	if sErr != nil {
+		return nil, sErr
 	}
 	if planObj.TargetType != target.Type {
-		resp.WriteServiceError(http.StatusBadRequest,
-			services.NewBadReq("target.type and plan.targetType is not compatible"))
-		return
+		return nil, &services.ErrResp{Code: http.StatusBadRequest,
+			Err: services.NewBadReq("target.type and plan.targetType is not compatible")}
 	}
 
 	sc := &scan.Scan{
 		Status:  scan.StatusCreated,
-		Owner:   u.Id,
-		Plan:    raw.Plan,
+		Owner:   owner,
+		Plan:    planObj.Id,
 		Project: project.Id,
 		Target:  target.Id,
 		Conf: scan.ScanConf{
@@ -196,19 +330,27 @@ func (s *ScanService) create(req *restful.Request, resp *restful.Response) {
 		},
 		Sessions: []*scan.Session{},
 	}
+	if tmpl != nil {
+		sc.Template = tmpl.Id
+		sc.Conf.Params = tmpl.ScanParams()
+		sc.Conf.Target = tmpl.Scope.Address(target)
+	}
 	now := time.Now().UTC()
 	// Add session from plans workflow steps
 	for _, step := range planObj.Workflow {
 		plugin, err := mgr.Plugins.GetByName(step.Plugin)
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteServiceError(http.StatusBadRequest,
-					services.NewBadReq(fmt.Sprintf("plugin %s is not found", step.Plugin)))
-				return
+				return nil, &services.ErrResp{Code: http.StatusBadRequest,
+					Err: services.NewBadReq("plugin %s is not found", step.Plugin)}
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
-			return
+			return nil, &services.ErrResp{Code: http.StatusInternalServerError, Err: services.DbErr}
+		}
+		if tmpl != nil {
+			if p := tmpl.Plugin(step.Plugin); p != nil {
+				p.Apply(step)
+			}
 		}
 		// TODO (m0sth8): extract template execution
 		if step.Conf != nil {
@@ -216,15 +358,13 @@ func (s *ScanService) create(req *restful.Request, resp *restful.Response) {
 				t, err := template.New("").Parse(command)
 				if err != nil {
 					logrus.Error(stackerr.Wrap(err))
-					resp.WriteServiceError(http.StatusInternalServerError, services.NewAppErr("Wrong command args template"))
-					return
+					return nil, &services.ErrResp{Err: services.NewAppErr("Wrong command args template")}
 				}
 				buf := bytes.NewBuffer(nil)
 				err = t.Execute(buf, sc.Conf)
 				if err != nil {
 					logrus.Error(stackerr.Wrap(err))
-					resp.WriteServiceError(http.StatusInternalServerError, services.NewAppErr("Wrong command args template"))
-					return
+					return nil, &services.ErrResp{Err: services.NewAppErr("Wrong command args template")}
 				}
 				step.Conf.CommandArgs = buf.String()
 			}
@@ -232,15 +372,13 @@ func (s *ScanService) create(req *restful.Request, resp *restful.Response) {
 				t, err := template.New("").Parse(formData)
 				if err != nil {
 					logrus.Error(stackerr.Wrap(err))
-					resp.WriteServiceError(http.StatusInternalServerError, services.NewAppErr("Wrong form data template"))
-					return
+					return nil, &services.ErrResp{Err: services.NewAppErr("Wrong form data template")}
 				}
 				buf := bytes.NewBuffer(nil)
 				err = t.Execute(buf, sc.Conf)
 				if err != nil {
 					logrus.Error(stackerr.Wrap(err))
-					resp.WriteServiceError(http.StatusInternalServerError, services.NewAppErr("Wrong form data template"))
-					return
+					return nil, &services.ErrResp{Err: services.NewAppErr("Wrong form data template")}
 				}
 				step.Conf.FormData = buf.String()
 			}
@@ -265,15 +403,86 @@ func (s *ScanService) create(req *restful.Request, resp *restful.Response) {
 		}
 		sc.Sessions = append(sc.Sessions, &sess)
 	}
+	return sc, nil
+}
+
+// TakePlan returns the plan for scans of the project, the default plan of the project is used if id is empty
+func TakePlan(mgr *manager.Manager, p *project.Project, id string) (*plan.Plan, *services.ErrResp) {
+	if id == "" {
+		if p.Plan == "" {
+			return nil, &services.ErrResp{Code: http.StatusBadRequest,
+				Err: services.NewBadReq("plan is required, the project has no default plan")}
+		}
+		id = p.Plan.Hex()
+	}
+	if !mgr.IsId(id) {
+		return nil, &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("plan should be an id")}
+	}
+	planObj, err := mgr.Plans.GetById(mgr.ToId(id))
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			return nil, &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("plan not found")}
+		}
+		logrus.Error(stackerr.Wrap(err))
+		return nil, &services.ErrResp{Code: http.StatusInternalServerError, Err: services.DbErr}
+	}
+	return planObj, nil
+}
+
+// OverrideParam is the query parameter of routes which start scans
+func OverrideParam(ws *restful.WebService) *restful.Parameter {
+	return ws.QueryParameter("override", "start the scan now even if the target is outside of its scan windows").DataType("boolean")
+}
+
+// startScan starts the scan, scan windows are skipped with the override query parameter
+func (s *ScanService) startScan(req *restful.Request, resp *restful.Response, mgr *manager.Manager, sc *scan.Scan) {
+	override := req.QueryParameter("override") == "true"
+	if override {
+		logrus.Warnf("Scan windows of target %s are overridden by %s", sc.Target.Hex(), filters.GetUser(req))
+	}
+	StartScan(s.BaseService, resp, mgr, sc, override)
+}
+
+// StartScan saves the scan and puts it to the queue, scan windows of the target aren't checked if override is set,
+// the active scan is written instead if the scan is coalesced with it
+func StartScan(base *services.BaseService, resp *restful.Response, mgr *manager.Manager, sc *scan.Scan, override bool) {
+	active, unlock, err := Coalesce(base, mgr, sc)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	defer unlock()
+	if active != nil {
+		logrus.Infof("Scan of target %s is coalesced with the active scan %s", sc.Target.Hex(), active.Id.Hex())
+		setProgress(active)
+		resp.WriteEntity(active)
+		return
+	}
 
+	if override {
+		sc.WindowOverride = true
+	} else {
+		if sErr := waitWindow(mgr, sc); sErr != nil {
+			sErr.Write(resp)
+			return
+		}
+	}
+	if sErr := reserveScans(base, mgr, sc.Owner, 1); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
 	obj, err := mgr.Scans.Create(sc)
 	if err != nil {
+		releaseScans(base, mgr, sc.Owner, 1)
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
-	// put scan to queue
-	s.Scheduler().AddScan(obj)
+	// put scan to queue, scans outside of windows are queued by the window queue
+	if !obj.WaitWindow {
+		base.Scheduler().AddScan(obj)
+	}
 	if _, err := mgr.Feed.AddScan(obj); err != nil {
 		logrus.Error(stackerr.Wrap(err))
 	}
@@ -282,31 +491,199 @@ func (s *ScanService) create(req *restful.Request, resp *restful.Response) {
 	resp.WriteEntity(obj)
 }
 
+// StartGroup saves scans of the group and queues them, they wait for the group queue if it's set.
+// Scans are counted in quotas of their owners before any of them is saved, *services.ErrResp is returned
+// if an owner is over the scans quota.
+func StartGroup(base *services.BaseService, mgr *manager.Manager, group bson.ObjectId, scans []*scan.Scan) error {
+	owners := map[bson.ObjectId]int{}
+	for _, sc := range scans {
+		owners[sc.Owner]++
+	}
+	reserved := map[bson.ObjectId]int{}
+	for owner, n := range owners {
+		if sErr := reserveScans(base, mgr, owner, n); sErr != nil {
+			for owner, n := range reserved {
+				releaseScans(base, mgr, owner, n)
+			}
+			return sErr
+		}
+		reserved[owner] = n
+	}
+
+	waiting := base.Groups != nil
+	var mu sync.Mutex
+	// scans are created in parallel, the pool bounds goroutines of all bulk operations
+	err := base.Pool.Map(mgr.Context(), len(scans), func(_ context.Context, i int) error {
+		sc := scans[i]
+		sc.Group = group
+		sc.Waiting = waiting
+		// scan windows of waiting scans are checked by the group queue
+		if !waiting {
+			in, err := scheduler.InWindow(mgr, sc, time.Now())
+			if err != nil {
+				return err
+			}
+			sc.WaitWindow = !in
+		}
+		obj, err := mgr.Scans.Create(sc)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		reserved[sc.Owner]--
+		mu.Unlock()
+		if !waiting && !obj.WaitWindow {
+			base.Scheduler().AddScan(obj)
+			scheduler.CheckDispatch(mgr, base.Notifier, obj)
+		}
+		if _, err := mgr.Feed.AddScan(obj); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		}
+		return nil
+	})
+	if err != nil {
+		// scans which aren't saved are released
+		for owner, n := range reserved {
+			releaseScans(base, mgr, owner, n)
+		}
+		return err
+	}
+	if waiting {
+		return base.Groups.Queue(group)
+	}
+	return nil
+}
+
+// reserveScans counts n scans of the owner in its quota before they are saved,
+// scans without owners and scans without the quota tracker aren't counted
+func reserveScans(base *services.BaseService, mgr *manager.Manager, owner bson.ObjectId, n int) *services.ErrResp {
+	if base.Quota == nil || owner == "" || n <= 0 {
+		return nil
+	}
+	ex, err := base.Quota.ReserveScans(mgr, owner, n)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return &services.ErrResp{Code: http.StatusInternalServerError, Err: services.DbErr}
+	}
+	if ex != nil {
+		return &services.ErrResp{Code: services.StatusTooManyRequests, Err: services.NewError(services.CodeOverQuota, ex.Error())}
+	}
+	return nil
+}
+
+// releaseScans uncounts reserved scans which aren't saved
+func releaseScans(base *services.BaseService, mgr *manager.Manager, owner bson.ObjectId, n int) {
+	if base.Quota == nil || owner == "" || n <= 0 {
+		return
+	}
+	if err := base.Quota.ReleaseScans(mgr, owner, n); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+}
+
+// waitWindow marks the new scan as waiting if its target is outside of scan windows
+func waitWindow(mgr *manager.Manager, sc *scan.Scan) *services.ErrResp {
+	in, err := scheduler.InWindow(mgr, sc, time.Now())
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return &services.ErrResp{Code: http.StatusInternalServerError, Err: services.DbErr}
+	}
+	sc.WaitWindow = !in
+	return nil
+}
+
+// the done or paused scan of the group frees the place for a waiting one
+func (s *ScanService) queueGroup(sc *scan.Scan) {
+	if s.Groups == nil || sc.Group == "" || !(sc.IsDone() || sc.Status == scan.StatusPaused) {
+		return
+	}
+	if err := s.Groups.Queue(sc.Group); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+}
+
 func (s *ScanService) list(req *restful.Request, resp *restful.Response) {
+	if sErr := s.searches.Apply(req); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
 	query, err := fltr.FromRequest(req, manager.ScanFltr{})
 	if err != nil {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
 		return
 	}
 
-	mgr := s.Manager()
+	// dry runs are listed only by the plugin test
+	query["dryRun"] = bson.M{"$exists": false}
+
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
-	results, count, err := mgr.Scans.FilterByQuery(query)
+	skip, limit := s.Paginator.Parse(req)
+	opt := manager.Opts{
+		Sort:  scanSort(s.sorter.Parse(req)),
+		Limit: limit,
+		Skip:  skip,
+	}
+
+	results, count, err := mgr.Scans.FilterByQuery(query, opt)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
+	setProgress(results...)
 
+	previous, next := s.Paginator.Urls(req, skip, limit, count)
 	result := &scan.ScanList{
-		Meta:    pagination.Meta{Count: count},
+		Meta: pagination.Meta{
+			Count:    count,
+			Previous: previous,
+			Next:     next,
+		},
 		Results: results,
 	}
 	resp.WriteEntity(result)
 }
 
-func (s *ScanService) get(_ *restful.Request, resp *restful.Response, pl *scan.Scan) {
+// sort keys of the api are mapped to fields of scan dates
+var sortFields = map[string]string{
+	"created":  "dates.created",
+	"updated":  "dates.updated",
+	"finished": "dates.finished",
+}
+
+func scanSort(keys []string) []string {
+	if len(keys) == 0 {
+		return []string{"-dates.created", "_id"}
+	}
+	result := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		desc := strings.HasPrefix(key, "-")
+		name := strings.TrimPrefix(key, "-")
+		if field, ok := sortFields[name]; ok {
+			name = field
+		}
+		if desc {
+			name = "-" + name
+		}
+		result = append(result, name)
+	}
+	return append(result, "_id")
+}
+
+func (s *ScanService) get(req *restful.Request, resp *restful.Response, pl *scan.Scan) {
+	pl.Timing = pl.GetTiming(time.Now().UTC())
+	setProgress(pl)
+	if pl.Status == scan.StatusCreated || pl.Status == scan.StatusQueued {
+		mgr := s.RequestManager(req)
+		defer mgr.Close()
+		if d, err := scheduler.Diagnose(mgr, pl, false); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		} else {
+			pl.QueueReason = d.Reason
+		}
+	}
 	resp.WriteEntity(pl)
 }
 
@@ -319,27 +696,27 @@ func (s *ScanService) update(req *restful.Request, resp *restful.Response, pl *s
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	raw.Id = pl.Id
 
 	if err := mgr.Scans.Update(raw); err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 			return
 		}
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.NewError(services.CodeDuplicate, "scan with this name and version is existed"))
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -347,19 +724,19 @@ func (s *ScanService) update(req *restful.Request, resp *restful.Response, pl *s
 	resp.WriteEntity(raw)
 }
 
-func (s *ScanService) delete(_ *restful.Request, resp *restful.Response, obj *scan.Scan) {
+func (s *ScanService) delete(req *restful.Request, resp *restful.Response, obj *scan.Scan) {
 	// TODO (m0sth8): Forbid to remove scan after queued status
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	mgr.Scans.Remove(obj)
 	resp.WriteHeader(http.StatusNoContent)
 }
 
-func (s *ScanService) reports(_ *restful.Request, resp *restful.Response, sc *scan.Scan) {
+func (s *ScanService) reports(req *restful.Request, resp *restful.Response, sc *scan.Scan) {
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	results := []*report.Report{}
@@ -367,7 +744,7 @@ func (s *ScanService) reports(_ *restful.Request, resp *restful.Response, sc *sc
 	results, count, err := mgr.Reports.FilterBySessions(sc.GetAllSessions())
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -379,6 +756,25 @@ func (s *ScanService) reports(_ *restful.Request, resp *restful.Response, sc *sc
 	resp.WriteEntity(reportList)
 }
 
+func (s *ScanService) issues(req *restful.Request, resp *restful.Response, sc *scan.Scan) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	skip, limit := s.Paginator.Parse(req)
+	results, count, err := mgr.Issues.FilterBy(&manager.IssueFltr{Scan: sc.Id}, mgr.Opts(skip, limit, []string{"-created"}))
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+
+	previous, next := s.Paginator.Urls(req, skip, limit, count)
+	resp.WriteEntity(&issue.TargetIssueList{
+		Meta:    pagination.Meta{Count: count, Previous: previous, Next: next},
+		Results: results,
+	})
+}
+
 // Helpers
 
 type ScanFunction func(*restful.Request, *restful.Response, *scan.Scan)
@@ -390,26 +786,32 @@ func (s *ScanService) TakeScan(fn ScanFunction) restful.RouteFunction {
 	return func(req *restful.Request, resp *restful.Response) {
 		id := req.PathParameter(ParamId)
 		if !s.IsId(id) {
-			resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 			return
 		}
 
-		mgr := s.Manager()
+		mgr := s.RequestManager(req)
 		defer mgr.Close()
 
 		obj, err := mgr.Scans.GetById(mgr.ToId(id))
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteErrorString(http.StatusNotFound, "Not found")
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 
-		sErr := services.Must(services.HasProjectIdPermission(mgr, filters.GetUser(req), obj.Project))
-		if sErr != nil {
+		// dry runs don't have a project, they are started by admins and run by the internal agent
+		if obj.DryRun != nil {
+			if u := filters.GetUser(req); !mgr.Permission.IsAdmin(u) {
+				logrus.Warnf("User %s try to access to dry run %s", u, obj)
+				services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+				return
+			}
+		} else if sErr := services.Must(services.HasProjectIdPermission(mgr, filters.GetUser(req), obj.Project)); sErr != nil {
 			sErr.Write(resp)
 			return
 		}
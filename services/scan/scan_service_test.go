@@ -0,0 +1,124 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/plugin"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/email"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/scheduler"
+	"github.com/bearded-web/bearded/services"
+)
+
+func TestCloneSessions(t *testing.T) {
+	orig := []*scan.Session{
+		{Id: bson.NewObjectId(), Status: scan.StatusFinished, Plugin: bson.NewObjectId(),
+			Step:     &plan.WorkflowStep{Plugin: "barbudo/wpscan:0.1", Conf: &plan.Conf{CommandArgs: "--url example.com"}},
+			Children: []*scan.Session{{Id: bson.NewObjectId()}}},
+		// sessions without steps aren't started from the plan
+		{Id: bson.NewObjectId(), Status: scan.StatusFailed},
+	}
+	sessions := cloneSessions(&manager.Manager{}, orig)
+	require.Len(t, sessions, 1)
+	sess := sessions[0]
+	require.NotEqual(t, orig[0].Id, sess.Id)
+	require.Equal(t, scan.StatusCreated, sess.Status)
+	require.Equal(t, orig[0].Plugin, sess.Plugin)
+	require.Empty(t, sess.Children)
+	require.NotNil(t, sess.Created)
+	require.Nil(t, sess.Finished)
+	require.Equal(t, "--url example.com", sess.Step.Conf.CommandArgs)
+
+	// the step is copied, so the original scan isn't changed
+	sess.Step.Conf.CommandArgs = ""
+	require.Equal(t, "--url example.com", orig[0].Step.Conf.CommandArgs)
+}
+
+func TestScanClone(t *testing.T) {
+	sess := filters.NewSession()
+	u, err := testMgr.Users.Create(&user.User{})
+	require.NoError(t, err)
+	sess.Set(filters.SessionUserKey, u.Id.Hex())
+
+	service := New(services.New(testMgr, nil, scheduler.NewFake(),
+		email.NewConsoleBackend(), config.NewDispatcher().Api))
+	wsContainer := restful.NewContainer()
+	wsContainer.Router(restful.CurlyRouter{})
+	wsContainer.Filter(filters.SessionFilterMock(sess))
+	service.Register(wsContainer)
+	ts := httptest.NewServer(wsContainer)
+	defer ts.Close()
+
+	_, err = testMgr.Plugins.Create(&plugin.Plugin{Name: "clone/plugin", Version: "0.1", Enabled: true})
+	require.NoError(t, err)
+	projectObj, err := testMgr.Projects.Create(&project.Project{Name: "clone", Owner: u.Id})
+	require.NoError(t, err)
+	targetObj, err := testMgr.Targets.Create(&target.Target{Project: projectObj.Id, Type: target.TypeWeb,
+		Web: &target.WebTarget{Domain: "http://example.com"}})
+	require.NoError(t, err)
+	planObj, err := testMgr.Plans.Create(&plan.Plan{Name: "clone", TargetType: target.TypeWeb,
+		Workflow: []*plan.WorkflowStep{{Plugin: "clone/plugin:0.1", Name: "plan step"}}})
+	require.NoError(t, err)
+	orig, err := testMgr.Scans.Create(&scan.Scan{
+		Status:  scan.StatusFinished,
+		Owner:   u.Id,
+		Project: projectObj.Id,
+		Target:  targetObj.Id,
+		Plan:    planObj.Id,
+		Conf:    scan.ScanConf{Target: "http://example.com"},
+		Sessions: []*scan.Session{{Id: testMgr.NewId(), Status: scan.StatusFinished,
+			Step: &plan.WorkflowStep{Plugin: "clone/plugin:0.1", Name: "rendered step"}}},
+	})
+	require.NoError(t, err)
+
+	clone := func(body []byte) *scan.Scan {
+		url := fmt.Sprintf("%s/api/v1/scans/%s/clone", ts.URL, orig.Id.Hex())
+		req, _ := http.NewRequest("POST", url, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+		sc := &scan.Scan{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(sc))
+		return sc
+	}
+
+	// steps of the original scan are reused as is
+	sc := clone(nil)
+	require.NotEqual(t, orig.Id, sc.Id)
+	require.Equal(t, u.Id, sc.Owner)
+	require.Equal(t, orig.Target, sc.Target)
+	require.Len(t, sc.Sessions, 1)
+	require.Equal(t, "rendered step", sc.Sessions[0].Step.Name)
+	require.NotEqual(t, orig.Sessions[0].Id, sc.Sessions[0].Id)
+	require.Equal(t, scan.StatusCreated, sc.Sessions[0].Status)
+	require.NoError(t, testMgr.Scans.Transition(sc, scan.StatusFailed))
+
+	// another plan builds steps again
+	other, err := testMgr.Plans.Create(&plan.Plan{Name: "other", TargetType: target.TypeWeb,
+		Workflow: []*plan.WorkflowStep{{Plugin: "clone/plugin:0.1", Name: "other step"}}})
+	require.NoError(t, err)
+	body, err := json.Marshal(&CloneEntity{Plan: other.Id})
+	require.NoError(t, err)
+	sc = clone(body)
+	require.Equal(t, other.Id, sc.Plan)
+	require.Len(t, sc.Sessions, 1)
+	require.Equal(t, "other step", sc.Sessions[0].Step.Name)
+}
@@ -8,8 +8,12 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
 
+	"github.com/bearded-web/bearded/models/incident"
 	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/plugin"
 	"github.com/bearded-web/bearded/models/report"
 	"github.com/bearded-web/bearded/models/scan"
 	"github.com/bearded-web/bearded/models/tech"
@@ -55,12 +59,13 @@ func (s *ScanService) RegisterSessions(ws *restful.WebService) {
 	r.Do(services.Returns(
 		http.StatusOK,
 		http.StatusNotFound))
-	r.Do(services.ReturnsE(http.StatusBadRequest))
+	r.Do(services.ReturnsE(http.StatusBadRequest, http.StatusConflict))
 	ws.Route(r)
 
 	// TODO (m0sth8): exclude reports to it's own service
 
 	r = ws.GET(fmt.Sprintf("{%s}/sessions/{%s}/report", ParamId, SessionParamId)).To(s.TakeScan(s.TakeSession(s.sessionReportGet)))
+	r.Filter(s.LongTimeout())
 	r.Doc("sessionReportGet")
 	r.Operation("sessionReportGet")
 	addDefaults(r)
@@ -74,14 +79,18 @@ func (s *ScanService) RegisterSessions(ws *restful.WebService) {
 	ws.Route(r)
 
 	r = ws.POST(fmt.Sprintf("{%s}/sessions/{%s}/report", ParamId, SessionParamId)).To(s.TakeScan(s.TakeSession(s.sessionReportCreate)))
+	r.Filter(s.LongTimeout())
+	r.Filter(s.LargeBody())
 	r.Doc("sessionReportCreate")
 	r.Operation("sessionReportCreate")
 	addDefaults(r)
+	r.Notes("Authorization required. The session has one report, the stored one is returned with 200 " +
+		"if the report with the same resultId is uploaded again.")
 	r.Param(ws.PathParameter(ParamId, ""))
 	r.Param(ws.PathParameter(SessionParamId, ""))
 	r.Reads(report.Report{})
 	r.Writes(report.Report{})
-	r.Do(services.Returns(http.StatusCreated))
+	r.Do(services.Returns(http.StatusCreated, http.StatusOK))
 	r.Do(services.ReturnsE(
 		http.StatusBadRequest,
 		http.StatusConflict))
@@ -95,59 +104,60 @@ func (s *ScanService) sessionCreate(req *restful.Request, resp *restful.Response
 	raw := &scan.Session{}
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Warn(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 
 	if raw.Step == nil {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("step is required"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("step is required"))
 		return
 	}
 
 	if raw.Step.Plugin == "" {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("step.plugin is required"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("step.plugin is required"))
 		return
 	}
 
 	//	if raw.Step.Conf == nil {
-	//		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("step.conf is required"))
+	//		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("step.conf is required"))
 	//		return
 	//	}
 
 	if raw.Scan != sc.Id {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("wrong scan id"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("wrong scan id"))
 		return
 	}
-	if sc.Status != scan.StatusWorking {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("scan should have working status"))
+	// plugins of the paused scan finish their sessions, so they could add children
+	if sc.Status != scan.StatusWorking && sc.Status != scan.StatusPaused {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("scan should have working or paused status"))
 		return
 	}
 	if raw.Parent == "" {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("parent field is required"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("parent field is required"))
 		return
 	}
 	parent := sc.GetSession(raw.Parent)
 	if parent == nil {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("parent not found"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("parent not found"))
 		return
 	}
 	if parent.Status != scan.StatusWorking {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("parent should have working status"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("parent should have working status"))
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	pl, err := mgr.Plugins.GetByName(raw.Step.Plugin)
 	if err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteServiceError(http.StatusBadRequest,
+			services.WriteError(resp, http.StatusBadRequest,
 				services.NewBadReq(fmt.Sprintf("plugin %s is not found", raw.Step.Plugin)))
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -165,10 +175,9 @@ func (s *ScanService) sessionCreate(req *restful.Request, resp *restful.Response
 		},
 	}
 
-	parent.Children = append(parent.Children, &sess)
-	if err := mgr.Scans.Update(sc); err != nil {
+	if err := mgr.Scans.AddSession(sc, parent, &sess); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -191,26 +200,69 @@ func (s *ScanService) sessionUpdate(req *restful.Request, resp *restful.Response
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Warn(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 	if !(raw.Status == scan.StatusWorking || raw.Status == scan.StatusFinished || raw.Status == scan.StatusFailed) {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("status should be one of [working|finished|failed]"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("status should be one of [working|finished|failed]"))
 		return
 	}
 
-	mgr := s.Manager()
+	// agents repeat the last status until it's acknowledged, so the repeated one isn't handled again
+	if sess.IsDone() && sess.Status == raw.Status {
+		resp.WriteEntity(sess)
+		return
+	}
+
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	logrus.Debugf("Update session %s status from %s to %s", mgr.FromId(sess.Id), sess.Status, raw.Status)
 
 	sess.Status = raw.Status
+	// the timed out session is finished, so next steps are run, but the error is kept
+	timedOut := raw.Status == scan.StatusFinished && raw.TimedOut
+	if raw.Status == scan.StatusFailed || timedOut {
+		sess.Error = raw.Error
+	}
+	sess.TimedOut = timedOut
 	if err := mgr.Scans.UpdateSession(sc, sess); err != nil {
+		if mgr.IsTransitionErr(err) {
+			logrus.Warnf("Session %s of scan %s isn't updated: %s", mgr.FromId(sess.Id), sc, err)
+			services.WriteError(resp, http.StatusConflict, services.NewError(services.CodeStatus, err.Error()))
+			return
+		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	// dry runs are only tested by admins, so they aren't reported, evaluated and shown in the feed
+	if sc.DryRun != nil {
+		s.Scheduler().UpdateScan(sc)
+		resp.WriteEntity(sess)
 		return
 	}
+	if raw.Status == scan.StatusFailed {
+		s.reportFailed(mgr, sc, sess)
+	}
+	if timedOut {
+		s.reportTimedOut(mgr, sc, sess)
+	}
+	// the scan is done by this update if it isn't evaluated yet
+	done := sc.IsDone() && sc.Passed == nil
+	if err := s.evaluateScan(mgr, sc); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+	if done {
+		if err := s.autoClose(sc); err != nil {
+			logrus.Error(err)
+		}
+		if sc.Status == scan.StatusFailed {
+			s.Notifier.Failed(sc, fmt.Sprintf("session %s is failed: %s", sess.Id.Hex(), sess.Error))
+		}
+	}
 	s.Scheduler().UpdateScan(sc)
+	s.queueGroup(sc)
 
 	if err := mgr.Feed.UpdateScan(sc); err != nil {
 		logrus.Error(stackerr.Wrap(err))
@@ -219,19 +271,63 @@ func (s *ScanService) sessionUpdate(req *restful.Request, resp *restful.Response
 	resp.WriteEntity(sess)
 }
 
-func (s *ScanService) sessionReportGet(_ *restful.Request, resp *restful.Response, _ *scan.Scan, sess *scan.Session) {
+// failed sessions are operational errors, not findings, so they are reported to ops
+func (s *ScanService) reportFailed(mgr *manager.Manager, sc *scan.Scan, sess *scan.Session) {
+	inc := &incident.Incident{
+		Type:    incident.TypeSessionFailed,
+		Agent:   sess.Agent,
+		Project: sc.Project,
+		Scan:    sc.Id,
+		Session: sess.Id,
+		Error:   sess.Error,
+		Message: fmt.Sprintf("Session %s of scan %s is failed", sess.Id.Hex(), sc.Id.Hex()),
+	}
+	if pl := sessionPlugin(mgr, sess); pl != nil {
+		inc.Plugin = fmt.Sprintf("%s v.%s", pl.Name, pl.Version)
+	}
+	s.Incidents.Report(inc)
+}
+
+// the scan continues without results of the timed out plugin, ops should look at the plugin
+func (s *ScanService) reportTimedOut(mgr *manager.Manager, sc *scan.Scan, sess *scan.Session) {
+	inc := &incident.Incident{
+		Type:    incident.TypePluginTimeout,
+		Agent:   sess.Agent,
+		Project: sc.Project,
+		Scan:    sc.Id,
+		Session: sess.Id,
+		Error:   sess.Error,
+		Message: fmt.Sprintf("Session %s of scan %s is timed out, the scan continues", sess.Id.Hex(), sc.Id.Hex()),
+	}
+	if pl := sessionPlugin(mgr, sess); pl != nil {
+		inc.Plugin = fmt.Sprintf("%s v.%s", pl.Name, pl.Version)
+	}
+	s.Incidents.Report(inc)
+}
+
+func (s *ScanService) sessionReportGet(req *restful.Request, resp *restful.Response, sc *scan.Scan, sess *scan.Session) {
+
+	if sc.DryRun != nil {
+		rep := sc.DryRun.GetReport(sess.Id)
+		if rep == nil {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		resp.WriteEntity(rep)
+		return
+	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	rep, err := mgr.Reports.GetBySession(sess.Id)
 	if err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -247,68 +343,154 @@ func (s *ScanService) sessionReportCreate(req *restful.Request, resp *restful.Re
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 
 	raw.SetScan(sc.Id)
 	raw.SetScanSession(sess.Id)
+	raw.Project = sc.Project
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
+	// issues are normalized before they are stored, so uniq ids don't depend on the plugin shape
+	pl := sessionPlugin(mgr, sess)
+	pluginName, pluginRef := "", ""
+	if pl != nil {
+		pluginName, pluginRef = pl.Name, pl.Ref()
+	}
+	s.Normalizer.Normalize(pluginName, raw.GetAllIssues()...)
+	dropped := []*issue.Issue{}
+	if ret, shared := retentionOf(mgr, sc, sess); ret != nil {
+		stored, err := mgr.Reports.CountIssues(sc.Id, shared)
+		if err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		dropped = ret.Drop(raw.GetAllIssues(), stored)
+		raw.Drop(dropped)
+		if len(dropped) > 0 {
+			logrus.Infof("%d issues of session %s in scan %s are dropped by retention", len(dropped), sess.Id.Hex(), sc)
+		}
+	}
+
+	// the agent can attach only its uploads or files of the scan project
+	if err := mgr.Files.CheckProject(sc.Project, raw.AllFiles()...); err != nil {
+		if err == manager.ErrForeignFile {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Attached files aren't found"))
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+
+	// reports of dry runs are kept in the scan, issues and techs aren't created
+	if sc.DryRun != nil {
+		if existed := sc.DryRun.GetReport(sess.Id); existed != nil {
+			if sameResult(existed, raw) {
+				resp.WriteEntity(existed)
+				return
+			}
+			services.WriteError(resp,
+				http.StatusConflict,
+				services.NewError(services.CodeDuplicate, "report with this scan session is existed"))
+			return
+		}
+		if err := mgr.Scans.AddDryRunReport(sc, raw); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		resp.WriteHeader(http.StatusCreated)
+		resp.WriteEntity(raw)
+		return
+	}
+
+	if err := s.Outputs.SetPurgeAfter(mgr, sc, raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
 	// TODO (m0sth8): for raw reports check metadata for files (check if file existed, set right md5, size etc)
 	rep, err := mgr.Reports.Create(raw)
 
 	if err != nil {
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			// the agent uploads the result again if the response is lost
+			if existed, err := mgr.Reports.GetBySession(sess.Id); err == nil && sameResult(existed, raw) {
+				logrus.Infof("Result %s of session %s in scan %s is already stored", raw.ResultId, sess.Id.Hex(), sc)
+				// the previous upload could fail after the report is stored, processing is idempotent
+				if err := s.processReport(mgr, existed, sc, sess, pluginRef, dropped); err != nil {
+					logrus.Error(stackerr.Wrap(err))
+					services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+					return
+				}
+				resp.WriteEntity(existed)
+				return
+			}
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.NewError(services.CodeDuplicate, "report with this scan session is existed"))
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
-	// create target issues from report
-	// TODO (m0sth8): exclude to another process (maybe push to queue)
-	err = s.createTargetIssues(rep, sc, sess)
-	if err != nil {
+	if err := s.processReport(mgr, rep, sc, sess, pluginRef, dropped); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
-	// create target techs from report
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(rep)
+}
+
+// processReport creates target issues and techs from the stored report and updates the feed item.
+// It's safe to run it again for the same report: issues get one activity of the report and known techs are skipped.
+func (s *ScanService) processReport(mgr *manager.Manager, rep *report.Report, sc *scan.Scan, sess *scan.Session,
+	plugin string, dropped []*issue.Issue) error {
 	// TODO (m0sth8): exclude to another process (maybe push to queue)
-	err = s.createTargetTechs(rep, sc, sess)
-	if err != nil {
+	if err := s.createTargetIssues(rep, sc, sess, plugin); err != nil {
+		return err
+	}
+	if err := s.createTargetTechs(rep, sc, sess); err != nil {
+		return err
+	}
+	// dropped issues are still found by the scan, so existed ones aren't closed as missed
+	if err := s.seeTargetIssues(dropped, rep, sc, sess, plugin); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
-		return
 	}
-
-	// update feed item
-	err = mgr.Feed.UpdateScanReport(sc, rep)
-	if err != nil {
+	if err := mgr.Feed.UpdateScanReport(sc, rep); err != nil {
 		logrus.Error(stackerr.Wrap(err))
 	}
+	return nil
+}
 
-	resp.WriteHeader(http.StatusCreated)
-	resp.WriteEntity(rep)
+// the report is uploaded again with the same result id by the agent
+func sameResult(existed, raw *report.Report) bool {
+	return raw.ResultId != "" && existed.ResultId == raw.ResultId
 }
 
-func (s *ScanService) createTargetIssues(rep *report.Report, sc *scan.Scan, sess *scan.Session) error {
+func (s *ScanService) createTargetIssues(rep *report.Report, sc *scan.Scan, sess *scan.Session, plugin string) error {
 	issues := rep.GetAllIssues()
 	if len(issues) == 0 {
 		return nil
 	}
 
-	mgr := s.Manager()
+	mgr := s.BackgroundManager()
 	defer mgr.Close()
 
+	targetObj, err := mgr.Targets.GetById(sc.Target)
+	if err != nil {
+		return stackerr.Wrap(err)
+	}
+
 	isIssuesAdded := false
 
 	for _, issueObj := range issues {
@@ -320,7 +502,22 @@ func (s *ScanService) createTargetIssues(rep *report.Report, sc *scan.Scan, sess
 			Project: sc.Project,
 			Issue:   *issueObj,
 		}
-		targetIssue.AddReportActivity(rep.Id, sc.Id, sess.Id)
+		targetIssue.AddReportActivity(rep.Id, sc.Id, sess.Id, plugin)
+		if targetIssue.UniqId != "" {
+			// the issue could be merged into another one earlier
+			merged, err := mgr.Issues.GetByMergedUniqId(sc.Target, targetIssue.UniqId)
+			if err == nil {
+				s.updateTargetIssue(mgr, merged, issueObj, rep, sc, sess, plugin)
+				continue
+			}
+			if !mgr.IsNotFound(err) {
+				return stackerr.Wrap(err)
+			}
+		}
+		// guidance of the matching template is attached to new issues, reported again ones keep theirs
+		if _, err := mgr.Remediations.Attach(targetIssue, targetObj.Addr()); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		}
 		_, err := mgr.Issues.Create(targetIssue)
 		if err != nil {
 			if mgr.IsDup(err) {
@@ -328,26 +525,9 @@ func (s *ScanService) createTargetIssues(rep *report.Report, sc *scan.Scan, sess
 					targetIssue, err = mgr.Issues.GetByUniqId(sc.Target, targetIssue.UniqId)
 					if err != nil {
 						logrus.Error(stackerr.Wrap(err))
-					}
-					if targetIssue.False {
 						continue
 					}
-					updateSummary := false
-					targetIssue.AddReportActivity(rep.Id, sc.Id, sess.Id)
-					if targetIssue.Resolved {
-						targetIssue.Resolved = false
-						updateSummary = true
-					}
-					err := mgr.Issues.Update(targetIssue)
-					if err != nil {
-						logrus.Error(stackerr.Wrap(err))
-					}
-					if updateSummary {
-						err := mgr.Targets.UpdateSummaryById(sc.Target)
-						if err != nil {
-							logrus.Error(stackerr.Wrap(err))
-						}
-					}
+					s.updateTargetIssue(mgr, targetIssue, issueObj, rep, sc, sess, plugin)
 				}
 				continue
 			} else {
@@ -358,10 +538,6 @@ func (s *ScanService) createTargetIssues(rep *report.Report, sc *scan.Scan, sess
 	}
 	if isIssuesAdded {
 		// TODO(m0sth8): exclude summary updating
-		targetObj, err := mgr.Targets.GetById(sc.Target)
-		if err != nil {
-			return stackerr.Wrap(err)
-		}
 		err = mgr.Targets.UpdateSummary(targetObj)
 		if err != nil {
 			return stackerr.Wrap(err)
@@ -371,13 +547,126 @@ func (s *ScanService) createTargetIssues(rep *report.Report, sc *scan.Scan, sess
 	return nil
 }
 
+// Add the report activity to open target issues with uniq ids of the issues which aren't stored,
+// new issues aren't created for them
+func (s *ScanService) seeTargetIssues(issues []*issue.Issue, rep *report.Report, sc *scan.Scan, sess *scan.Session, plugin string) error {
+	uniqIds := []string{}
+	for _, obj := range issues {
+		if obj.UniqId != "" {
+			uniqIds = append(uniqIds, obj.UniqId)
+		}
+	}
+	if len(uniqIds) == 0 {
+		return nil
+	}
+	mgr := s.BackgroundManager()
+	defer mgr.Close()
+
+	act := &issue.Activity{
+		Created: time.Now().UTC(),
+		Type:    issue.ActivityReported,
+		Report:  &issue.Report{Report: rep.Id, Scan: sc.Id, ScanSession: sess.Id, Plugin: plugin},
+	}
+	_, err := mgr.Issues.Seen(sc.Target, uniqIds, act)
+	return err
+}
+
+// how many times the report activity is added again when the issue is changed concurrently
+const issueUpdateAttempts = 5
+
+// Add report activity to the already existed issue, resolved issues are reopened.
+// If the issue is changed by someone else, it's reloaded and the activity is added to the fresh copy.
+func (s *ScanService) updateTargetIssue(mgr *manager.Manager, targetIssue *issue.TargetIssue, issueObj *issue.Issue,
+	rep *report.Report, sc *scan.Scan, sess *scan.Session, plugin string) {
+	updateSummary := false
+	for attempt := 0; ; attempt++ {
+		// false issues aren't reopened, issues with the report are already updated by the previous upload
+		if targetIssue.False || targetIssue.HasReport(rep.Id) {
+			return
+		}
+		targetIssue.AddReportActivity(rep.Id, sc.Id, sess.Id, plugin)
+		// new evidence is kept with the old one
+		targetIssue.AddAttachments(issueObj.Attachments...)
+		targetIssue.Missed = 0
+		if targetIssue.Resolved {
+			targetIssue.Resolved = false
+			updateSummary = true
+		}
+		err := mgr.Issues.Update(targetIssue)
+		if err == nil {
+			break
+		}
+		if !mgr.IsVersionConflict(err) || attempt+1 >= issueUpdateAttempts {
+			logrus.Error(stackerr.Wrap(err))
+			return
+		}
+		if targetIssue, err = mgr.Issues.GetById(targetIssue.Id); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			return
+		}
+	}
+	if updateSummary {
+		err := mgr.Targets.UpdateSummaryById(targetIssue.Target)
+		if err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		}
+	}
+}
+
+// Retention of the session and other sessions of the scan which share its cap,
+// step retention is preferred to the plan one and it's shared by sessions of the same plugin
+func retentionOf(mgr *manager.Manager, sc *scan.Scan, sess *scan.Session) (*plan.Retention, []bson.ObjectId) {
+	if sess.Step != nil && sess.Step.Retention != nil {
+		return sess.Step.Retention, sharedSessions(sc.Sessions, sess, true)
+	}
+	if sc.Plan == "" {
+		return nil, nil
+	}
+	planObj, err := mgr.Plans.GetById(sc.Plan)
+	if err != nil {
+		if !mgr.IsNotFound(err) {
+			logrus.Error(stackerr.Wrap(err))
+		}
+		return nil, nil
+	}
+	if planObj.Retention == nil {
+		return nil, nil
+	}
+	return planObj.Retention, sharedSessions(sc.Sessions, sess, false)
+}
+
+// sharedSessions returns ids of sessions and their children except the session,
+// only sessions of the same plugin are returned if samePlugin is set
+func sharedSessions(sessions []*scan.Session, sess *scan.Session, samePlugin bool) []bson.ObjectId {
+	ids := []bson.ObjectId{}
+	for _, obj := range sessions {
+		if obj.Id != sess.Id && (!samePlugin || obj.Plugin == sess.Plugin) {
+			ids = append(ids, obj.Id)
+		}
+		ids = append(ids, sharedSessions(obj.Children, sess, samePlugin)...)
+	}
+	return ids
+}
+
+// Plugin of the session, nil if the plugin is removed
+func sessionPlugin(mgr *manager.Manager, sess *scan.Session) *plugin.Plugin {
+	pl, err := mgr.Plugins.GetById(mgr.FromId(sess.Plugin))
+	if err != nil {
+		if !mgr.IsNotFound(err) {
+			logrus.Error(stackerr.Wrap(err))
+		}
+		return nil
+	}
+	return pl
+}
+
 func (s *ScanService) createTargetTechs(rep *report.Report, sc *scan.Scan, sess *scan.Session) error {
 	techs := rep.GetAllTechs()
 	if len(techs) == 0 {
 		return nil
 	}
 
-	mgr := s.Manager()
+	mgr := s.BackgroundManager()
 	defer mgr.Close()
 
 	for _, techObj := range techs {
@@ -409,7 +698,7 @@ func (s *ScanService) TakeSession(fn SessionFunction) ScanFunction {
 	return func(req *restful.Request, resp *restful.Response, sc *scan.Scan) {
 		id := req.PathParameter(SessionParamId)
 		if !s.IsId(id) {
-			resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 			return
 		}
 
@@ -417,7 +706,7 @@ func (s *ScanService) TakeSession(fn SessionFunction) ScanFunction {
 
 		sess := sc.GetSession(objId)
 		if sess == nil {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 			return
 		}
 		fn(req, resp, sc, sess)
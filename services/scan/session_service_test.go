@@ -12,10 +12,13 @@ import (
 	"testing"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/bearded-web/bearded/models/issue"
 	"github.com/bearded-web/bearded/models/plan"
 	"github.com/bearded-web/bearded/models/plugin"
 	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/report"
 	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
 	"github.com/bearded-web/bearded/models/user"
 	"github.com/bearded-web/bearded/pkg/config"
 	"github.com/bearded-web/bearded/pkg/email"
@@ -26,6 +29,8 @@ import (
 	"github.com/bearded-web/bearded/services"
 	"github.com/emicklei/go-restful"
 	c "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
 )
 
 var (
@@ -150,7 +155,7 @@ func TestSessionCreate(t *testing.T) {
 				return
 			}
 			res := sessionCreate(t, ts.URL, scanId, marshalSession(sess))
-			shouldBeBadRequest(t, res, services.CodeWrongData, "scan should have working status")
+			shouldBeBadRequest(t, res, services.CodeWrongData, "scan should have working or paused status")
 		})
 
 		c.Convey("When parent is empty", func() {
@@ -201,7 +206,7 @@ func shouldBeBadRequest(t *testing.T, res *http.Response, code services.CodeErr,
 	c.Convey("Response should be 400 (Bad request)", func() {
 		c.So(res.StatusCode, c.ShouldEqual, http.StatusBadRequest)
 		e := getServiceError(t, res)
-		c.So(e.Code, c.ShouldEqual, code)
+		c.So(e.Errno, c.ShouldEqual, code)
 		c.So(e.Message, c.ShouldEqual, message)
 	})
 }
@@ -218,8 +223,8 @@ func sessionCreate(t *testing.T, baseUrl string, scanId string, body []byte) *ht
 	return resp
 }
 
-func getServiceError(t *testing.T, res *http.Response) *restful.ServiceError {
-	e := &restful.ServiceError{}
+func getServiceError(t *testing.T, res *http.Response) *services.ServiceError {
+	e := &services.ServiceError{}
 	err := json.NewDecoder(res.Body).Decode(e)
 	if err != nil {
 		t.Fatal(err)
@@ -267,3 +272,59 @@ func loadTestData(filename string) []byte {
 	}
 	return raw
 }
+
+func TestSharedSessions(t *testing.T) {
+	w3af, nmap := bson.NewObjectId(), bson.NewObjectId()
+	child := &scan.Session{Id: bson.NewObjectId(), Plugin: w3af}
+	first := &scan.Session{Id: bson.NewObjectId(), Plugin: w3af, Children: []*scan.Session{child}}
+	second := &scan.Session{Id: bson.NewObjectId(), Plugin: nmap}
+	current := &scan.Session{Id: bson.NewObjectId(), Plugin: w3af}
+	sessions := []*scan.Session{first, second, current}
+
+	require.Equal(t, []bson.ObjectId{first.Id, child.Id, second.Id}, sharedSessions(sessions, current, false),
+		"the plan cap is shared by all other sessions")
+	require.Equal(t, []bson.ObjectId{first.Id, child.Id}, sharedSessions(sessions, current, true),
+		"the step cap is shared by sessions of the plugin")
+	require.Empty(t, sharedSessions([]*scan.Session{current}, current, false))
+}
+
+func TestSessionReportUploadedAgain(t *testing.T) {
+	ts, _, p := newTestScanServer(t)
+	defer ts.Close()
+	targetObj, err := testMgr.Targets.Create(&target.Target{Project: p.Id, Type: target.TypeWeb,
+		Web: &target.WebTarget{Domain: "http://example.com"}})
+	require.NoError(t, err)
+	sess := &scan.Session{Id: testMgr.NewId(), Status: scan.StatusWorking}
+	sc, err := testMgr.Scans.Create(&scan.Scan{Status: scan.StatusWorking, Plan: testMgr.NewId(), Target: targetObj.Id,
+		Owner: p.Owner, Project: p.Id, Sessions: []*scan.Session{sess}})
+	require.NoError(t, err)
+
+	raw := &report.Report{Type: report.TypeIssues, ResultId: "result", Issues: []*issue.Issue{
+		{UniqId: "xss", Summary: "xss", Severity: issue.SeverityHigh},
+	}}
+	// the dispatcher is gone after the report is stored, issues aren't created
+	stored := *raw
+	stored.Scan, stored.ScanSession, stored.Project = sc.Id, sess.Id, p.Id
+	_, err = testMgr.Reports.Create(&stored)
+	require.NoError(t, err)
+
+	url := fmt.Sprintf("%s/api/v1/scans/%s/sessions/%s/report", ts.URL, sc.Id.Hex(), sess.Id.Hex())
+	upload := func() {
+		data, err := json.Marshal(raw)
+		require.NoError(t, err)
+		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode, "the stored report is returned")
+	}
+	upload()
+	obj, err := testMgr.Issues.GetByUniqId(targetObj.Id, "xss")
+	require.NoError(t, err, "issues of the stored report are created by the next upload")
+	require.Len(t, obj.Activities, 1)
+	require.Equal(t, stored.Id, obj.Activities[0].Report.Report)
+
+	upload()
+	obj, err = testMgr.Issues.GetByUniqId(targetObj.Id, "xss")
+	require.NoError(t, err)
+	require.Len(t, obj.Activities, 1, "the report activity isn't added twice")
+}
@@ -0,0 +1,8 @@
+package search
+
+type SearchEntity struct {
+	Name    string `json:"name" description:"search name, 80 symbols max" validate:"nonzero,max=80"`
+	Query   string `json:"query" description:"url encoded list parameters, e.g. severity=high&status=0" validate:"max=2048"`
+	Default bool   `json:"default,omitempty" description:"use the search as the default view"`
+	Version *int   `json:"version,omitempty" description:"current search version, required for updates if If-Match header isn't set"`
+}
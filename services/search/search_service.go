@@ -0,0 +1,335 @@
+package search
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/search"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/fltr"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/pagination"
+	"github.com/bearded-web/bearded/services"
+)
+
+const (
+	ParamId = "search-id"
+	// list parameter which runs the saved search
+	ParamSaved = "saved"
+	// value of ParamSaved which runs the default search of the user
+	SavedDefault = "default"
+)
+
+// SearchService manages saved searches of one type. It isn't a standalone service,
+// services which have list endpoints register its routes in their web service.
+type SearchService struct {
+	*services.BaseService
+	Type search.Type
+	// filter struct of the list endpoint, it's used to check saved queries
+	fltr interface{}
+}
+
+func New(base *services.BaseService, t search.Type, listFltr interface{}) *SearchService {
+	return &SearchService{
+		BaseService: base,
+		Type:        t,
+		fltr:        listFltr,
+	}
+}
+
+func addDefaults(r *restful.RouteBuilder) {
+	r.Notes("Authorization required")
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusInternalServerError,
+	))
+}
+
+// Param describes list parameter which runs the saved search
+func (s *SearchService) Param(ws *restful.WebService) *restful.Parameter {
+	return ws.QueryParameter(ParamSaved,
+		fmt.Sprintf("run the saved search by id or %q for the default one, request parameters are preferred", SavedDefault))
+}
+
+func (s *SearchService) RegisterSearches(ws *restful.WebService) {
+	r := ws.GET("searches").To(s.list)
+	r.Doc("searches")
+	r.Operation("searches")
+	addDefaults(r)
+	r.Writes(search.SearchList{})
+	r.Do(services.Returns(http.StatusOK))
+	ws.Route(r)
+
+	r = ws.POST("searches").To(s.create)
+	r.Doc("searchesCreate")
+	r.Operation("searchesCreate")
+	addDefaults(r)
+	r.Reads(SearchEntity{})
+	r.Writes(search.Search{})
+	r.Do(services.Returns(http.StatusCreated))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusConflict))
+	ws.Route(r)
+
+	r = ws.PUT(fmt.Sprintf("searches/{%s}", ParamId)).To(s.TakeSearch(s.update))
+	r.Doc("searchesUpdate")
+	r.Operation("searchesUpdate")
+	addDefaults(r)
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.HeaderParameter(services.IfMatchHeader, "search version, required if version field isn't set"))
+	r.Reads(SearchEntity{})
+	r.Writes(search.Search{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusConflict,
+		services.StatusPreconditionRequired))
+	ws.Route(r)
+
+	r = ws.DELETE(fmt.Sprintf("searches/{%s}", ParamId)).To(s.TakeSearch(s.delete))
+	r.Doc("searchesDelete")
+	r.Operation("searchesDelete")
+	addDefaults(r)
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Do(services.Returns(
+		http.StatusNoContent,
+		http.StatusNotFound))
+	ws.Route(r)
+}
+
+// Apply merges query of the saved search into the request, so list handlers work as usual.
+// Parameters passed in the request are preferred over saved ones.
+func (s *SearchService) Apply(req *restful.Request) *services.ErrResp {
+	saved := req.QueryParameter(ParamSaved)
+	if saved == "" {
+		return nil
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	var obj *search.Search
+	var err error
+	if saved == SavedDefault {
+		obj, err = mgr.Searches.GetDefault(u.Id, s.Type)
+		if mgr.IsNotFound(err) {
+			// there is no default view, so everything is shown
+			return nil
+		}
+	} else {
+		if !s.IsId(saved) {
+			return &services.ErrResp{Code: http.StatusBadRequest, Err: services.IdHexErr}
+		}
+		obj, err = mgr.Searches.GetById(mgr.ToId(saved))
+		if err == nil && (obj.User != u.Id || obj.Type != s.Type) {
+			err = manager.ErrNotFound
+		}
+		if mgr.IsNotFound(err) {
+			return &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("Saved search not found")}
+		}
+	}
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return &services.ErrResp{Code: http.StatusInternalServerError, Err: services.DbErr}
+	}
+
+	values := req.Request.URL.Query()
+	savedValues, err := url.ParseQuery(obj.Query)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("Saved search query is broken")}
+	}
+	for key, val := range savedValues {
+		if _, ok := values[key]; !ok {
+			values[key] = val
+		}
+	}
+	req.Request.URL.RawQuery = values.Encode()
+	// parsed form is cached by the request, so it should be parsed again
+	req.Request.Form = nil
+	return nil
+}
+
+func (s *SearchService) list(req *restful.Request, resp *restful.Response) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	results, count, err := mgr.Searches.FilterBy(&manager.SearchFltr{User: filters.GetUser(req).Id, Type: s.Type},
+		manager.Opts{Sort: []string{"name"}})
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.WriteEntity(&search.SearchList{
+		Meta:    pagination.Meta{Count: count},
+		Results: results,
+	})
+}
+
+func (s *SearchService) create(req *restful.Request, resp *restful.Response) {
+	raw, sErr := s.readEntity(req)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	obj, err := mgr.Searches.Create(&search.Search{
+		User:    filters.GetUser(req).Id,
+		Type:    s.Type,
+		Name:    raw.Name,
+		Query:   raw.Query,
+		Default: raw.Default,
+	})
+	if err != nil {
+		if mgr.IsDup(err) {
+			services.WriteError(resp, http.StatusConflict, services.DuplicateErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(obj)
+}
+
+func (s *SearchService) update(req *restful.Request, resp *restful.Response, obj *search.Search) {
+	raw, sErr := s.readEntity(req)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	// reject changes made to a stale copy of the search
+	if sErr := services.CheckVersion(req, raw.Version, obj.Version); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	obj.Name = raw.Name
+	obj.Query = raw.Query
+	obj.Default = raw.Default
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if err := mgr.Searches.Update(obj); err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		if mgr.IsVersionConflict(err) {
+			services.WriteError(resp, http.StatusConflict, services.VersionErr)
+			return
+		}
+		if mgr.IsDup(err) {
+			services.WriteError(resp, http.StatusConflict, services.DuplicateErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	services.SetVersion(resp, obj.Version)
+	resp.WriteEntity(obj)
+}
+
+func (s *SearchService) delete(req *restful.Request, resp *restful.Response, obj *search.Search) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if err := mgr.Searches.Remove(obj); err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.ResponseWriter.WriteHeader(http.StatusNoContent)
+}
+
+// Helpers
+
+func (s *SearchService) readEntity(req *restful.Request) (*SearchEntity, *services.ErrResp) {
+	raw := &SearchEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return nil, &services.ErrResp{Code: http.StatusBadRequest, Err: services.WrongEntityErr}
+	}
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		return nil, sErr
+	}
+	if sErr := s.checkQuery(raw.Query); sErr != nil {
+		return nil, sErr
+	}
+	return raw, nil
+}
+
+// saved query is checked by the list filter, so broken searches aren't saved
+func (s *SearchService) checkQuery(query string) *services.ErrResp {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("query should be url encoded")}
+	}
+	if _, ok := values[ParamSaved]; ok {
+		return &services.ErrResp{Code: http.StatusBadRequest,
+			Err: services.NewBadReq("query can't contain %s parameter", ParamSaved)}
+	}
+	if s.fltr == nil {
+		return nil
+	}
+	fake := restful.NewRequest(&http.Request{URL: &url.URL{RawQuery: query}})
+	if _, err := fltr.FromRequest(fake, s.fltr); err != nil {
+		return &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("query %s", err.Error())}
+	}
+	return nil
+}
+
+type SearchFunction func(*restful.Request, *restful.Response, *search.Search)
+
+// Decorate route function: take the search of the current user by ParamId
+func (s *SearchService) TakeSearch(fn SearchFunction) restful.RouteFunction {
+	return func(req *restful.Request, resp *restful.Response) {
+		id := req.PathParameter(ParamId)
+		if !s.IsId(id) {
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+			return
+		}
+
+		mgr := s.RequestManager(req)
+		defer mgr.Close()
+
+		obj, err := mgr.Searches.GetById(mgr.ToId(id))
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		// searches are private
+		if obj.User != filters.GetUser(req).Id || obj.Type != s.Type {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		mgr.Close()
+
+		fn(req, resp, obj)
+	}
+}
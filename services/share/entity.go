@@ -0,0 +1,25 @@
+package share
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/share"
+)
+
+type ShareEntity struct {
+	Resource share.Resource `json:"resource" description:"one of: [scan|project]"`
+	Project  bson.ObjectId  `json:"project,omitempty" description:"required for project links"`
+	Scan     bson.ObjectId  `json:"scan,omitempty" description:"required for scan links"`
+	Duration int            `json:"duration,omitempty" description:"lifetime of the link in hours, the configured default is used if empty" validate:"min=0"`
+}
+
+// SharedEntity is shown to anyone who has the link
+type SharedEntity struct {
+	Resource share.Resource `json:"resource"`
+	Project  bson.ObjectId  `json:"project"`
+	Expire   time.Time      `json:"expire"`
+	Scan     *scan.Scan     `json:"scan,omitempty"`
+}
@@ -0,0 +1,429 @@
+package share
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/audit"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/report"
+	"github.com/bearded-web/bearded/models/share"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/fltr"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/pagination"
+	"github.com/bearded-web/bearded/services"
+)
+
+const (
+	ParamId    = "share-id"
+	ParamToken = "token"
+)
+
+type ShareService struct {
+	*services.BaseService
+}
+
+func New(base *services.BaseService) *ShareService {
+	return &ShareService{
+		BaseService: base,
+	}
+}
+
+func addDefaults(r *restful.RouteBuilder) {
+	r.Notes("Authorization required")
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusInternalServerError,
+	))
+}
+
+func addSharedDefaults(r *restful.RouteBuilder) {
+	r.Notes("Authorization isn't required, the token of the link gives access")
+	r.Param(restful.PathParameter(ParamToken, "token of the share link"))
+	r.Do(services.Returns(http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusInternalServerError))
+}
+
+func (s *ShareService) Register(container *restful.Container) {
+	ws := &restful.WebService{}
+	ws.Path("/api/v1/shares")
+	ws.Doc("Manage share links")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+
+	r := ws.GET("").To(s.list)
+	addDefaults(r)
+	r.Doc("list")
+	r.Operation("list")
+	s.SetParams(r, fltr.GetParams(ws, manager.ShareFltr{}))
+	r.Writes(share.ShareList{})
+	r.Do(services.Returns(http.StatusOK))
+	ws.Route(r)
+
+	r = ws.POST("").To(s.create)
+	addDefaults(r)
+	r.Doc("create")
+	r.Operation("create")
+	r.Notes("Authorization required. Token of the link is shown only in this response.")
+	r.Writes(share.Share{})
+	r.Reads(ShareEntity{})
+	r.Do(services.Returns(http.StatusCreated))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	r = ws.DELETE(fmt.Sprintf("{%s}", ParamId)).To(s.TakeShare(s.revoke))
+	addDefaults(r)
+	r.Doc("revoke")
+	r.Operation("revoke")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Do(services.Returns(
+		http.StatusNoContent,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	container.Add(ws)
+
+	// links are opened without login, so there are no auth filters
+	shared := &restful.WebService{}
+	shared.Path("/api/v1/shared")
+	shared.Doc("Read only access by share links")
+	shared.Produces(restful.MIME_JSON)
+
+	r = shared.GET(fmt.Sprintf("{%s}", ParamToken)).To(s.TakeShared(s.get))
+	addSharedDefaults(r)
+	r.Doc("get")
+	r.Operation("get")
+	r.Writes(SharedEntity{})
+	r.Do(services.Returns(http.StatusOK))
+	shared.Route(r)
+
+	r = shared.GET(fmt.Sprintf("{%s}/reports", ParamToken)).To(s.TakeShared(s.reports))
+	addSharedDefaults(r)
+	r.Doc("reports")
+	r.Operation("reports")
+	r.Notes("Reports of the shared scan, not found for project links")
+	r.Writes(report.ReportList{})
+	r.Do(services.Returns(http.StatusOK))
+	shared.Route(r)
+
+	r = shared.GET(fmt.Sprintf("{%s}/issues", ParamToken)).To(s.TakeShared(s.issues))
+	addSharedDefaults(r)
+	r.Doc("issues")
+	r.Operation("issues")
+	r.Notes("Issues reported by the shared scan or issues of the shared project")
+	r.Param(s.Paginator.SkipParam())
+	r.Param(s.Paginator.LimitParam())
+	r.Writes(issue.TargetIssueList{})
+	r.Do(services.Returns(http.StatusOK))
+	shared.Route(r)
+
+	container.Add(shared)
+}
+
+// ====== service operations
+
+func (s *ShareService) create(req *restful.Request, resp *restful.Response) {
+	raw := &ShareEntity{}
+
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	// validate fields
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	cfg := s.ApiCfg().Share
+	duration := raw.Duration
+	if duration == 0 {
+		duration = cfg.Duration
+	}
+	if cfg.MaxDuration > 0 && duration > cfg.MaxDuration {
+		services.WriteError(resp, http.StatusBadRequest,
+			services.NewBadReq("Duration must be less than %d hours", cfg.MaxDuration+1))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	// links are created by people, the access of project tokens isn't shared further
+	if u.IsService() {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	newObj := &share.Share{
+		Resource: raw.Resource,
+		Owner:    u.Id,
+		Expire:   time.Now().UTC().Add(time.Duration(duration) * time.Hour),
+	}
+	switch raw.Resource {
+	case share.ResourceScan:
+		if raw.Scan == "" {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Scan is required"))
+			return
+		}
+		sc, err := mgr.Scans.GetById(raw.Scan)
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Scan not found"))
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		newObj.Scan = sc.Id
+		newObj.Project = sc.Project
+	case share.ResourceProject:
+		if raw.Project == "" {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Project is required"))
+			return
+		}
+		newObj.Project = raw.Project
+	default:
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Resource must be one of: scan, project"))
+		return
+	}
+
+	if sErr := services.Must(services.HasProjectIdPermission(mgr, u, newObj.Project)); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	obj, err := mgr.Shares.Create(newObj)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	s.Audit(mgr, &audit.Event{
+		Type:    audit.TypeShareCreated,
+		Actor:   u.Id,
+		Project: obj.Project,
+		Share:   obj.Id,
+		Message: fmt.Sprintf("User %s shared the %s of project %s until %s", u, obj.Resource, obj.Project.Hex(), obj.Expire),
+	})
+	obj.HashValue = obj.Hash // show the token after creation only
+
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(obj)
+}
+
+func (s *ShareService) list(req *restful.Request, resp *restful.Response) {
+	query, err := fltr.FromRequest(req, manager.ShareFltr{})
+	if err != nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("%s", err))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	// non admins see only their own links
+	if !mgr.Permission.IsAdmin(u) {
+		query["owner"] = u.Id
+	}
+
+	results, count, err := mgr.Shares.FilterByQuery(query)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+
+	result := &share.ShareList{
+		Meta:    pagination.Meta{Count: count},
+		Results: results,
+	}
+	resp.WriteEntity(result)
+}
+
+func (s *ShareService) revoke(req *restful.Request, resp *restful.Response, obj *share.Share) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if !obj.Revoked {
+		if err := mgr.Shares.Revoke(obj); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		u := filters.GetUser(req)
+		s.Audit(mgr, &audit.Event{
+			Type:    audit.TypeShareRevoked,
+			Actor:   u.Id,
+			Project: obj.Project,
+			Share:   obj.Id,
+			Message: fmt.Sprintf("User %s revoked share link %s", u, obj.Id.Hex()),
+		})
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (s *ShareService) get(req *restful.Request, resp *restful.Response, obj *share.Share, mgr *manager.Manager) {
+	result := &SharedEntity{
+		Resource: obj.Resource,
+		Project:  obj.Project,
+		Expire:   obj.Expire,
+	}
+	if obj.Resource == share.ResourceScan {
+		sc, err := mgr.Scans.GetById(obj.Scan)
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		result.Scan = sc
+	}
+	resp.WriteEntity(result)
+}
+
+func (s *ShareService) reports(req *restful.Request, resp *restful.Response, obj *share.Share, mgr *manager.Manager) {
+	if obj.Resource != share.ResourceScan {
+		services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+		return
+	}
+	sc, err := mgr.Scans.GetById(obj.Scan)
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	results, count, err := mgr.Reports.FilterBySessions(sc.GetAllSessions())
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.WriteEntity(&report.ReportList{
+		Meta:    pagination.Meta{Count: count},
+		Results: results,
+	})
+}
+
+func (s *ShareService) issues(req *restful.Request, resp *restful.Response, obj *share.Share, mgr *manager.Manager) {
+	f := &manager.IssueFltr{Project: obj.Project}
+	if obj.Resource == share.ResourceScan {
+		f = &manager.IssueFltr{Scan: obj.Scan}
+	}
+
+	skip, limit := s.Paginator.Parse(req)
+	opt := manager.Opts{
+		Sort:  []string{"-created"},
+		Limit: limit,
+		Skip:  skip,
+	}
+
+	results, count, err := mgr.Issues.FilterBy(f, opt)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	previous, next := s.Paginator.Urls(req, skip, limit, count)
+	resp.WriteEntity(&issue.TargetIssueList{
+		Meta: pagination.Meta{
+			Count:    count,
+			Previous: previous,
+			Next:     next,
+		},
+		Results: results,
+	})
+}
+
+// Helpers
+
+func (s *ShareService) TakeShare(fn func(*restful.Request,
+	*restful.Response, *share.Share)) restful.RouteFunction {
+	return func(req *restful.Request, resp *restful.Response) {
+		id := req.PathParameter(ParamId)
+		if !s.IsId(id) {
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+			return
+		}
+
+		mgr := s.RequestManager(req)
+		defer mgr.Close()
+
+		obj, err := mgr.Shares.GetById(mgr.ToId(id))
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		u := filters.GetUser(req)
+		if obj.Owner != u.Id && !mgr.Permission.IsAdmin(u) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		mgr.Close()
+		fn(req, resp, obj)
+	}
+}
+
+// TakeShared finds the active link by the token, audits the access and counts the use of the link
+func (s *ShareService) TakeShared(fn func(*restful.Request,
+	*restful.Response, *share.Share, *manager.Manager)) restful.RouteFunction {
+	return func(req *restful.Request, resp *restful.Response) {
+		mgr := s.RequestManager(req)
+		defer mgr.Close()
+
+		now := time.Now().UTC()
+		obj, err := mgr.Shares.GetByHash(req.PathParameter(ParamToken))
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		// expired and revoked links look like unknown ones
+		if !obj.IsActive(now) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		if err := mgr.Shares.Touch(obj, now); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		}
+		s.Record(mgr, &audit.Event{
+			Type:    audit.TypeShareAccessed,
+			Project: obj.Project,
+			Share:   obj.Id,
+			// the route is saved instead of the path, so the token doesn't get into the audit
+			Request: fmt.Sprintf("%s %s", req.Request.Method, req.SelectedRoutePath()),
+			Message: fmt.Sprintf("Share link %s is opened from %s", obj.Id.Hex(), req.Request.RemoteAddr),
+		})
+		fn(req, resp, obj, mgr)
+	}
+}
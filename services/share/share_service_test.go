@@ -0,0 +1,258 @@
+package share
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/audit"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/share"
+	"github.com/bearded-web/bearded/models/token"
+	"github.com/bearded-web/bearded/models/user"
+	"github.com/bearded-web/bearded/pkg/config"
+	"github.com/bearded-web/bearded/pkg/email"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/scheduler"
+	"github.com/bearded-web/bearded/pkg/tests"
+	"github.com/bearded-web/bearded/services"
+)
+
+var (
+	testMgr *manager.Manager
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(func() int {
+		mongo, dbName, err := tests.RandomTestMongoUp()
+		if err != nil {
+			println(err)
+			os.Exit(1)
+		}
+		defer tests.RandomTestMongoDown(mongo, dbName)
+		testMgr = manager.New(mongo.DB(dbName))
+		return m.Run()
+	}())
+}
+
+// the server is opened by the user of the session
+func newShareServer(t *testing.T, u *user.User) *httptest.Server {
+	sess := filters.NewSession()
+	sess.Set(filters.SessionUserKey, u.Id.Hex())
+
+	service := New(services.New(testMgr, nil, scheduler.NewFake(),
+		email.NewConsoleBackend(), config.NewDispatcher().Api))
+	wsContainer := restful.NewContainer()
+	wsContainer.Router(restful.CurlyRouter{})
+	wsContainer.Filter(filters.SessionFilterMock(sess))
+	service.Register(wsContainer)
+	return httptest.NewServer(wsContainer)
+}
+
+func shareRequest(t *testing.T, method, url, bearer string, body interface{}) (*http.Response, []byte) {
+	buf := bytes.NewBuffer(nil)
+	if body != nil {
+		require.NoError(t, json.NewEncoder(buf).Encode(body))
+	}
+	req, _ := http.NewRequest(method, url, buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data := bytes.NewBuffer(nil)
+	_, err = data.ReadFrom(resp.Body)
+	require.NoError(t, err)
+	return resp, data.Bytes()
+}
+
+type shareFixture struct {
+	owner   *user.User
+	project *project.Project
+	scan    *scan.Scan
+	// issues reported by the scan and by another scan of the project
+	scanIssue, otherIssue *issue.TargetIssue
+}
+
+func newShareFixture(t *testing.T) *shareFixture {
+	f := &shareFixture{}
+	var err error
+	f.owner, err = testMgr.Users.Create(&user.User{Email: bson.NewObjectId().Hex() + "@example.com"})
+	require.NoError(t, err)
+	f.project, err = testMgr.Projects.Create(&project.Project{Name: "shared", Owner: f.owner.Id})
+	require.NoError(t, err)
+	f.scan, err = testMgr.Scans.Create(&scan.Scan{Project: f.project.Id, Target: bson.NewObjectId(), Owner: f.owner.Id})
+	require.NoError(t, err)
+	reported := func(scanId bson.ObjectId) *issue.TargetIssue {
+		iss, err := testMgr.Issues.Create(&issue.TargetIssue{
+			Project: f.project.Id,
+			Target:  f.scan.Target,
+			Issue:   issue.Issue{Summary: "issue of " + scanId.Hex()},
+			Activities: []*issue.Activity{{
+				Type:   issue.ActivityReported,
+				Report: &issue.Report{Scan: scanId, Report: bson.NewObjectId()},
+			}},
+		})
+		require.NoError(t, err)
+		return iss
+	}
+	f.scanIssue = reported(f.scan.Id)
+	f.otherIssue = reported(bson.NewObjectId())
+	return f
+}
+
+func createShare(t *testing.T, baseUrl, bearer string, entity *ShareEntity) (*http.Response, *share.Share) {
+	resp, body := shareRequest(t, "POST", baseUrl+"/api/v1/shares", bearer, entity)
+	if resp.StatusCode != http.StatusCreated {
+		return resp, nil
+	}
+	obj := &share.Share{}
+	require.NoError(t, json.Unmarshal(body, obj))
+	return resp, obj
+}
+
+func TestSharedScan(t *testing.T) {
+	f := newShareFixture(t)
+	ts := newShareServer(t, f.owner)
+	defer ts.Close()
+
+	resp, obj := createShare(t, ts.URL, "", &ShareEntity{Resource: share.ResourceScan, Scan: f.scan.Id})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.NotEmpty(t, obj.HashValue)
+	require.Equal(t, f.project.Id, obj.Project)
+
+	resp, body := shareRequest(t, "GET", ts.URL+"/api/v1/shared/"+obj.HashValue, "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	shared := &SharedEntity{}
+	require.NoError(t, json.Unmarshal(body, shared))
+	require.Equal(t, share.ResourceScan, shared.Resource)
+	require.Equal(t, f.scan.Id, shared.Scan.Id)
+
+	// the scan link gives only issues of the scan, not other issues of the project
+	resp, body = shareRequest(t, "GET", ts.URL+"/api/v1/shared/"+obj.HashValue+"/issues", "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	issues := &issue.TargetIssueList{}
+	require.NoError(t, json.Unmarshal(body, issues))
+	require.Equal(t, 1, issues.Count)
+	require.Equal(t, f.scanIssue.Id, issues.Results[0].Id)
+
+	// the access is audited without the token
+	events, count, err := testMgr.Audit.FilterByQuery(bson.M{"share": obj.Id, "type": audit.TypeShareAccessed})
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	requests := map[string]bool{}
+	for _, ev := range events {
+		require.Equal(t, f.project.Id, ev.Project)
+		require.NotContains(t, ev.Request, obj.HashValue)
+		require.NotContains(t, ev.Message, obj.HashValue)
+		requests[ev.Request] = true
+	}
+	require.Equal(t, map[string]bool{
+		"GET /api/v1/shared/{token}":        true,
+		"GET /api/v1/shared/{token}/issues": true,
+	}, requests)
+	stored, err := testMgr.Shares.GetById(obj.Id)
+	require.NoError(t, err)
+	require.Equal(t, 2, stored.Uses)
+}
+
+func TestSharedProject(t *testing.T) {
+	f := newShareFixture(t)
+	ts := newShareServer(t, f.owner)
+	defer ts.Close()
+
+	resp, obj := createShare(t, ts.URL, "", &ShareEntity{Resource: share.ResourceProject, Project: f.project.Id})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, body := shareRequest(t, "GET", ts.URL+"/api/v1/shared/"+obj.HashValue+"/issues", "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	issues := &issue.TargetIssueList{}
+	require.NoError(t, json.Unmarshal(body, issues))
+	require.Equal(t, 2, issues.Count)
+
+	// reports are shared only by scan links
+	resp, _ = shareRequest(t, "GET", ts.URL+"/api/v1/shared/"+obj.HashValue+"/reports", "", nil)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestInactiveShares(t *testing.T) {
+	f := newShareFixture(t)
+	ts := newShareServer(t, f.owner)
+	defer ts.Close()
+
+	expired, err := testMgr.Shares.Create(&share.Share{
+		Resource: share.ResourceScan,
+		Project:  f.project.Id,
+		Scan:     f.scan.Id,
+		Owner:    f.owner.Id,
+		Expire:   time.Now().UTC().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+	for _, path := range []string{"", "/issues", "/reports"} {
+		resp, _ := shareRequest(t, "GET", ts.URL+"/api/v1/shared/"+expired.Hash+path, "", nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode, "expired %s", path)
+	}
+
+	resp, obj := createShare(t, ts.URL, "", &ShareEntity{Resource: share.ResourceScan, Scan: f.scan.Id})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, _ = shareRequest(t, "DELETE", fmt.Sprintf("%s/api/v1/shares/%s", ts.URL, obj.Id.Hex()), "", nil)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	for _, path := range []string{"", "/issues", "/reports"} {
+		resp, _ := shareRequest(t, "GET", ts.URL+"/api/v1/shared/"+obj.HashValue+path, "", nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode, "revoked %s", path)
+	}
+
+	resp, _ = shareRequest(t, "GET", ts.URL+"/api/v1/shared/unknown", "", nil)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// inactive links aren't audited as accessed
+	_, count, err := testMgr.Audit.FilterByQuery(bson.M{"share": bson.M{"$in": []bson.ObjectId{expired.Id, obj.Id}},
+		"type": audit.TypeShareAccessed})
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+}
+
+func TestCreateShareForbidden(t *testing.T) {
+	f := newShareFixture(t)
+
+	// service accounts of projects don't share their access further
+	service, err := testMgr.Users.Create(&user.User{Project: f.project.Id})
+	require.NoError(t, err)
+	ts := newShareServer(t, service)
+	defer ts.Close()
+	resp, _ := createShare(t, ts.URL, "", &ShareEntity{Resource: share.ResourceProject, Project: f.project.Id})
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// viewer tokens are read only
+	viewer, err := testMgr.Tokens.Create(&token.Token{User: f.owner.Id, Project: f.project.Id, Role: token.RoleViewer})
+	require.NoError(t, err)
+	stranger, err := testMgr.Users.Create(&user.User{})
+	require.NoError(t, err)
+	other := newShareServer(t, stranger)
+	defer other.Close()
+	resp, _ = createShare(t, other.URL, viewer.Hash, &ShareEntity{Resource: share.ResourceProject, Project: f.project.Id})
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// users who aren't members can't share projects
+	resp, _ = createShare(t, other.URL, "", &ShareEntity{Resource: share.ResourceProject, Project: f.project.Id})
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	_, count, err := testMgr.Shares.FilterByQuery(bson.M{"project": f.project.Id})
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+}
@@ -0,0 +1,754 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/compliance"
+	"github.com/bearded-web/bearded/models/issue"
+	"github.com/bearded-web/bearded/models/stats"
+	"github.com/bearded-web/bearded/models/target"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/store"
+	"github.com/bearded-web/bearded/services"
+)
+
+const (
+	DefaultTrendDays = 30
+	MaxTrendDays     = 365
+	// trend endpoint returns no more points than this
+	MaxTrendPoints = 366
+
+	DefaultCompareRows = 50
+	MaxCompareRows     = 500
+	// targets are columns of the comparison matrix
+	MaxCompareTargets = 1000
+
+	dateLayout       = "2006-01-02"
+	statsCachePrefix = "stats:"
+)
+
+// default trend length for the interval
+var defaultTrendPoints = map[stats.Interval]int{
+	stats.IntervalDay:   DefaultTrendDays,
+	stats.IntervalWeek:  12,
+	stats.IntervalMonth: 12,
+}
+
+type StatsService struct {
+	*services.BaseService
+	weights *stats.RiskWeights
+}
+
+func New(base *services.BaseService) *StatsService {
+	return &StatsService{
+		BaseService: base,
+	}
+}
+
+func (s *StatsService) Init() error {
+	cfg := s.ApiCfg().Risk
+	s.weights = &stats.RiskWeights{
+		Severity: map[issue.Severity]float64{},
+		Cvss:     cfg.Cvss,
+		Age:      cfg.Age,
+		MaxAge:   cfg.MaxAge,
+	}
+	for name, weight := range cfg.Weights {
+		severity, ok := issue.MapSeverity(issue.Severity(name))
+		if !ok {
+			return fmt.Errorf("wrong risk weight severity %q", name)
+		}
+		s.weights.Severity[severity] = weight
+	}
+	return nil
+}
+
+func addDefaults(r *restful.RouteBuilder) {
+	r.Notes("Authorization required")
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusInternalServerError,
+	))
+}
+
+func (s *StatsService) Register(container *restful.Container) {
+	ws := &restful.WebService{}
+	ws.Path("/api/v1/stats")
+	ws.Doc("Dashboard statistics")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+
+	r := ws.GET("").To(s.get)
+	r.Doc("get")
+	r.Operation("get")
+	addDefaults(r)
+	r.Notes("Authorization required. Stats of the project or of all available projects if the project isn't set.")
+	r.Param(ws.QueryParameter("project", "project id"))
+	r.Param(ws.QueryParameter("days", fmt.Sprintf("trend length in days, %d by default, %d max", DefaultTrendDays, MaxTrendDays)))
+	r.Writes(stats.Stats{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	r = ws.GET("trend").To(s.trend)
+	r.Doc("trend")
+	r.Operation("trend")
+	addDefaults(r)
+	r.Notes("Authorization required. Issues opened and resolved by intervals. " +
+		"Trend of the project or of all available projects if the project isn't set.")
+	r.Param(ws.QueryParameter("project", "project id"))
+	r.Param(ws.QueryParameter("severity", "comma separated severities, all by default"))
+	r.Param(ws.QueryParameter("interval", "one of: [day|week|month], day by default"))
+	r.Param(ws.QueryParameter("from", "start date in form of 2006-01-02 or RFC3339"))
+	r.Param(ws.QueryParameter("to", "end date in form of 2006-01-02 or RFC3339, now by default"))
+	r.Writes(stats.Trend{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	r = ws.GET("risk").To(s.risk)
+	r.Doc("risk")
+	r.Operation("risk")
+	addDefaults(r)
+	r.Notes("Authorization required. Risk score of open issues weighted by severity and age, with scores of targets " +
+		"and the trend by intervals. Risk of the target, the project or of all available projects if neither is set.")
+	r.Param(ws.QueryParameter("project", "project id"))
+	r.Param(ws.QueryParameter("target", "target id"))
+	r.Param(ws.QueryParameter("interval", "one of: [day|week|month], day by default"))
+	r.Param(ws.QueryParameter("from", "start date in form of 2006-01-02 or RFC3339"))
+	r.Param(ws.QueryParameter("to", "end date in form of 2006-01-02 or RFC3339, now by default"))
+	r.Writes(stats.Risk{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(http.StatusBadRequest, http.StatusNotFound))
+	ws.Route(r)
+
+	r = ws.GET("top").To(s.top)
+	r.Doc("top")
+	r.Operation("top")
+	addDefaults(r)
+	r.Notes("Authorization required. The most common vulnerability types or cwes by the number of issues. " +
+		"Issues of the project or of all available projects if the project isn't set.")
+	r.Param(ws.QueryParameter("project", "project id"))
+	r.Param(ws.QueryParameter("by", fmt.Sprintf("one of %v, type by default", stats.TopBys)))
+	r.Param(ws.QueryParameter("severity", "comma separated severities, all by default"))
+	r.Param(ws.QueryParameter("status", fmt.Sprintf("one of %v, open by default", stats.TopStatuses)))
+	r.Param(ws.QueryParameter("from", "issues created since the date in form of 2006-01-02 or RFC3339"))
+	r.Param(ws.QueryParameter("to", "issues created before the date in form of 2006-01-02 or RFC3339"))
+	r.Param(s.Paginator.SkipParam())
+	r.Param(s.Paginator.LimitParam())
+	r.Writes(stats.TopVulnList{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	r = ws.GET("compare").To(s.compare)
+	r.Doc("compare")
+	r.Operation("compare")
+	addDefaults(r)
+	r.Notes("Authorization required. Matrix of open issues by targets, rows are grouped issues with affected targets, " +
+		"the most widespread ones go first. Targets are compared within the project or all available projects " +
+		"if the project isn't set, all active targets are compared if targets aren't set.")
+	r.Param(ws.QueryParameter("project", "project id"))
+	r.Param(ws.QueryParameter("targets", fmt.Sprintf("comma separated target ids, %d max", MaxCompareTargets)))
+	r.Param(ws.QueryParameter("by", fmt.Sprintf("rows are issues grouped by one of %v, type by default", stats.CompareBys)))
+	r.Param(ws.QueryParameter("limit", fmt.Sprintf("number of rows, %d by default, %d max", DefaultCompareRows, MaxCompareRows)))
+	r.Writes(stats.Comparison{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(http.StatusBadRequest, http.StatusNotFound))
+	ws.Route(r)
+
+	r = ws.GET("compliance").To(s.compliance)
+	r.Doc("compliance")
+	r.Operation("compliance")
+	addDefaults(r)
+	r.Notes("Authorization required. Active targets in scope of the compliance framework and their open issues " +
+		"by violated controls, issues are mapped by cwes of their vulndb types or by classes. " +
+		"Targets of the project or of all available projects if the project isn't set.")
+	r.Param(ws.QueryParameter("framework", fmt.Sprintf("one of %v", compliance.Ids())).Required(true))
+	r.Param(ws.QueryParameter("project", "project id"))
+	r.Writes(compliance.Report{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	container.Add(ws)
+}
+
+func (s *StatsService) get(req *restful.Request, resp *restful.Response) {
+	days := DefaultTrendDays
+	if raw := req.QueryParameter("days"); raw != "" {
+		val, err := strconv.Atoi(raw)
+		if err != nil || val < 1 || val > MaxTrendDays {
+			services.WriteError(resp, http.StatusBadRequest,
+				services.NewBadReq("days should be a number from 1 to %d", MaxTrendDays))
+			return
+		}
+		days = val
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	projectId, query, key, sErr := s.scope(mgr, req)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	result := &stats.Stats{Project: projectId}
+	key = fmt.Sprintf("%s:%d", key, days)
+
+	ttl := time.Duration(s.ApiCfg().StatsCacheDuration) * time.Second
+	if cached := (&stats.Stats{}); s.getCached(key, cached) {
+		s.writeCached(resp, cached, ttl)
+		return
+	}
+
+	if err := s.fill(mgr, result, query, days); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	s.setCached(key, result, ttl)
+	s.writeCached(resp, result, ttl)
+}
+
+func (s *StatsService) trend(req *restful.Request, resp *restful.Response) {
+	result := &stats.Trend{}
+	var sErr *services.ErrResp
+	if result.Interval, result.From, result.To, sErr = parsePeriod(req); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	if raw := req.QueryParameter("severity"); raw != "" {
+		for _, val := range strings.Split(raw, ",") {
+			severity := issue.Severity(strings.TrimSpace(val))
+			if severity.Level() == 0 {
+				services.WriteError(resp, http.StatusBadRequest,
+					services.NewBadReq("severity should be one of %v", issue.Severities))
+				return
+			}
+			result.Severity = append(result.Severity, severity)
+		}
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	projectId, query, key, sErr := s.scope(mgr, req)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	result.Project = projectId
+	if len(result.Severity) > 0 {
+		query["severity"] = bson.M{"$in": result.Severity}
+	}
+	key = fmt.Sprintf("trend:%s:%s:%v:%d:%d", key, result.Interval, result.Severity,
+		result.From.Unix(), result.To.Unix()/60) // requests within a minute use the same cache
+
+	ttl := time.Duration(s.ApiCfg().StatsCacheDuration) * time.Second
+	if cached := (&stats.Trend{}); s.getCached(key, cached) {
+		s.writeCached(resp, cached, ttl)
+		return
+	}
+
+	var err error
+	if result.Points, err = mgr.Issues.GetTrend(query, result.From, result.To, result.Interval); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	s.setCached(key, result, ttl)
+	s.writeCached(resp, result, ttl)
+}
+
+func (s *StatsService) risk(req *restful.Request, resp *restful.Response) {
+	result := &stats.Risk{}
+	var from, to time.Time
+	var sErr *services.ErrResp
+	if result.Interval, from, to, sErr = parsePeriod(req); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	projectId, query, key, sErr := s.scope(mgr, req)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	result.Project = projectId
+	if targetId := req.QueryParameter("target"); targetId != "" {
+		if !s.IsId(targetId) {
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+			return
+		}
+		t, err := mgr.Targets.GetById(mgr.ToId(targetId))
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		if sErr := services.Must(services.HasProjectIdPermission(mgr, filters.GetUser(req), t.Project)); sErr != nil {
+			sErr.Write(resp)
+			return
+		}
+		result.Project, result.Target = t.Project, t.Id
+		query, key = bson.M{"target": t.Id}, "target:"+targetId
+	}
+	key = fmt.Sprintf("risk:%s:%s:%d:%d", key, result.Interval, from.Unix(), to.Unix()/60)
+
+	ttl := time.Duration(s.ApiCfg().StatsCacheDuration) * time.Second
+	if cached := (&stats.Risk{}); s.getCached(key, cached) {
+		s.writeCached(resp, cached, ttl)
+		return
+	}
+
+	issues, err := mgr.Issues.GetRiskIssues(query, from, to)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	s.weights.Fill(result, issues, from, to)
+	result.Created = time.Now().UTC()
+	s.setCached(key, result, ttl)
+	s.writeCached(resp, result, ttl)
+}
+
+func (s *StatsService) top(req *restful.Request, resp *restful.Response) {
+	result := &stats.TopVulnList{By: stats.TopByType}
+	if raw := req.QueryParameter("by"); raw != "" {
+		if result.By = stats.TopBy(raw); !result.By.IsValid() {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("by should be one of %v", stats.TopBys))
+			return
+		}
+	}
+	status := stats.TopOpen
+	if raw := req.QueryParameter("status"); raw != "" {
+		if status = stats.TopStatus(raw); !status.IsValid() {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("status should be one of %v", stats.TopStatuses))
+			return
+		}
+	}
+	filter := status.Query()
+	severities := []issue.Severity{}
+	if raw := req.QueryParameter("severity"); raw != "" {
+		for _, val := range strings.Split(raw, ",") {
+			severity := issue.Severity(strings.TrimSpace(val))
+			if severity.Level() == 0 {
+				services.WriteError(resp, http.StatusBadRequest,
+					services.NewBadReq("severity should be one of %v", issue.Severities))
+				return
+			}
+			severities = append(severities, severity)
+		}
+		filter["severity"] = bson.M{"$in": severities}
+	}
+	created := bson.M{}
+	for _, name := range []string{"from", "to"} {
+		raw := req.QueryParameter(name)
+		if raw == "" {
+			continue
+		}
+		date, err := parseDate(raw)
+		if err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("%s %s", name, err.Error()))
+			return
+		}
+		if name == "from" {
+			created["$gte"] = date
+		} else {
+			created["$lt"] = date
+		}
+	}
+	if len(created) > 0 {
+		filter["created"] = created
+	}
+	skip, limit := s.Paginator.Parse(req)
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	projectId, query, key, sErr := s.scope(mgr, req)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	result.Project = projectId
+	for k, v := range filter {
+		query[k] = v
+	}
+	key = fmt.Sprintf("top:%s:%s:%s:%v:%s:%s:%d:%d", key, result.By, status, severities,
+		req.QueryParameter("from"), req.QueryParameter("to"), skip, limit)
+
+	ttl := time.Duration(s.ApiCfg().StatsCacheDuration) * time.Second
+	if cached := (&stats.TopVulnList{}); s.getCached(key, cached) {
+		s.writeCached(resp, cached, ttl)
+		return
+	}
+
+	var err error
+	if result.Results, result.Count, err = mgr.Issues.GetTopVulns(query, result.By, skip, limit); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	result.Previous, result.Next = s.Paginator.Urls(req, skip, limit, result.Count)
+	s.setCached(key, result, ttl)
+	s.writeCached(resp, result, ttl)
+}
+
+func (s *StatsService) compare(req *restful.Request, resp *restful.Response) {
+	result := &stats.Comparison{By: stats.CompareByType}
+	if raw := req.QueryParameter("by"); raw != "" {
+		if result.By = stats.CompareBy(raw); !result.By.IsValid() {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("by should be one of %v", stats.CompareBys))
+			return
+		}
+	}
+	limit := DefaultCompareRows
+	if raw := req.QueryParameter("limit"); raw != "" {
+		val, err := strconv.Atoi(raw)
+		if err != nil || val < 1 || val > MaxCompareRows {
+			services.WriteError(resp, http.StatusBadRequest,
+				services.NewBadReq("limit should be a number from 1 to %d", MaxCompareRows))
+			return
+		}
+		limit = val
+	}
+	ids := []bson.ObjectId{}
+	if raw := req.QueryParameter("targets"); raw != "" {
+		seen := map[bson.ObjectId]bool{}
+		for _, val := range strings.Split(raw, ",") {
+			val = strings.TrimSpace(val)
+			if !s.IsId(val) {
+				services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+				return
+			}
+			if id := bson.ObjectIdHex(val); !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > MaxCompareTargets {
+			services.WriteError(resp, http.StatusBadRequest,
+				services.NewBadReq("no more than %d targets are compared", MaxCompareTargets))
+			return
+		}
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	projectId, query, key, sErr := s.scope(mgr, req)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	result.Project = projectId
+	key = fmt.Sprintf("compare:%s:%s:%d:%v", key, result.By, limit, ids)
+
+	ttl := time.Duration(s.ApiCfg().StatsCacheDuration) * time.Second
+	if cached := (&stats.Comparison{}); s.getCached(key, cached) {
+		s.writeCached(resp, cached, ttl)
+		return
+	}
+
+	var targets []*target.Target
+	var err error
+	if len(ids) > 0 {
+		targetQuery := bson.M{"_id": bson.M{"$in": ids}}
+		for k, v := range query {
+			targetQuery[k] = v
+		}
+		targets, _, err = mgr.Targets.FilterByQuery(targetQuery)
+	} else {
+		// targets are counted first, so big scopes aren't loaded only to be rejected
+		var count int
+		if count, err = mgr.Targets.CountActive(query); err == nil {
+			if count > MaxCompareTargets {
+				services.WriteError(resp, http.StatusBadRequest,
+					services.NewBadReq("no more than %d targets are compared, set targets", MaxCompareTargets))
+				return
+			}
+			targets, _, err = mgr.Targets.FilterActive(query, manager.Opts{Limit: MaxCompareTargets})
+		}
+	}
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	// targets which are missing or unavailable to the user
+	if len(targets) != len(ids) && len(ids) > 0 {
+		services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+		return
+	}
+	columns := make([]*stats.ComparedTarget, 0, len(targets))
+	targetIds := make([]bson.ObjectId, 0, len(targets))
+	for _, t := range targets {
+		columns = append(columns, &stats.ComparedTarget{Id: t.Id, Project: t.Project, Addr: t.Addr()})
+		targetIds = append(targetIds, t.Id)
+	}
+	query["target"] = bson.M{"$in": targetIds}
+	if result.Rows, err = mgr.Issues.GetComparison(query, result.By, limit); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	result.SetTargets(columns)
+	result.Created = time.Now().UTC()
+	s.setCached(key, result, ttl)
+	s.writeCached(resp, result, ttl)
+}
+
+// Helpers
+
+// Get the interval and the period of the trend from the request, from is aligned to the interval start
+func parsePeriod(req *restful.Request) (stats.Interval, time.Time, time.Time, *services.ErrResp) {
+	badReq := func(format string, args ...interface{}) (stats.Interval, time.Time, time.Time, *services.ErrResp) {
+		return "", time.Time{}, time.Time{}, &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq(format, args...)}
+	}
+	interval := stats.IntervalDay
+	if raw := req.QueryParameter("interval"); raw != "" {
+		interval = stats.Interval(raw)
+		if !interval.IsValid() {
+			return badReq("interval should be one of %v", stats.Intervals)
+		}
+	}
+	var err error
+	to := time.Now().UTC()
+	if raw := req.QueryParameter("to"); raw != "" {
+		if to, err = parseDate(raw); err != nil {
+			return badReq("to %s", err.Error())
+		}
+	}
+	// the first interval contains from, so it's aligned to the interval start
+	from := interval.Start(to)
+	for i := 1; i < defaultTrendPoints[interval]; i++ {
+		from = from.AddDate(0, 0, -1)
+		from = interval.Start(from)
+	}
+	if raw := req.QueryParameter("from"); raw != "" {
+		if from, err = parseDate(raw); err != nil {
+			return badReq("from %s", err.Error())
+		}
+		from = interval.Start(from)
+	}
+	if !from.Before(to) {
+		return badReq("from should be before to")
+	}
+	points := 0
+	for start := from; start.Before(to); start = interval.Next(start) {
+		if points++; points > MaxTrendPoints {
+			return badReq("trend is limited to %d points, use a bigger interval", MaxTrendPoints)
+		}
+	}
+	return interval, from, to, nil
+}
+
+// Get query for objects of the project from the request or of all projects available to the user.
+// Key identifies the scope in the cache.
+func (s *StatsService) compliance(req *restful.Request, resp *restful.Response) {
+	f := compliance.Get(strings.ToLower(req.QueryParameter("framework")))
+	if f == nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("framework should be one of %v", compliance.Ids()))
+		return
+	}
+	result := compliance.NewReport(f)
+	result.Created = time.Now().UTC()
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	projectId, query, key, sErr := s.scope(mgr, req)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	result.Project = projectId
+	key = fmt.Sprintf("compliance:%s:%s", key, f.Id)
+
+	ttl := time.Duration(s.ApiCfg().StatsCacheDuration) * time.Second
+	if cached := (&compliance.Report{}); s.getCached(key, cached) {
+		s.writeCached(resp, cached, ttl)
+		return
+	}
+
+	if err := fillCompliance(mgr, result, query); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	s.setCached(key, result, ttl)
+	s.writeCached(resp, result, ttl)
+}
+
+// fillCompliance finds in-scope targets of the query and groups their open issues by controls of the framework,
+// issues are read one by one and only their summaries are kept in the report
+func fillCompliance(mgr *manager.Manager, result *compliance.Report, query bson.M) error {
+	targetQuery, err := mgr.Targets.ComplianceQuery(query, result.Framework)
+	if err != nil {
+		return err
+	}
+	targets, _, err := mgr.Targets.FilterActive(targetQuery)
+	if err != nil {
+		return err
+	}
+	ids := make([]bson.ObjectId, 0, len(targets))
+	for _, t := range targets {
+		asset := &compliance.Asset{Id: t.Id, Project: t.Project, Addr: t.Addr(), Inherited: true}
+		for _, id := range t.Compliance {
+			if id == result.Framework {
+				asset.Inherited = false
+			}
+		}
+		result.AddTarget(asset)
+		ids = append(ids, t.Id)
+	}
+	defer result.Done()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	issueQuery := stats.TopOpen.Query()
+	issueQuery["target"] = bson.M{"$in": ids}
+	return mgr.Issues.Each(issueQuery, nil, func(obj *issue.TargetIssue) error {
+		reported := &compliance.ReportedIssue{
+			Id:       obj.Id,
+			Target:   obj.Target,
+			Summary:  obj.Summary,
+			Severity: obj.Severity,
+			VulnType: obj.VulnType,
+			Class:    obj.Class,
+		}
+		if obj.VulnType > 0 {
+			if v := mgr.Vulndb.GetById(obj.VulnType); v != nil {
+				reported.Cwe = v.Cwe
+			}
+		}
+		result.AddIssue(reported)
+		return nil
+	})
+}
+
+func (s *StatsService) scope(mgr *manager.Manager, req *restful.Request) (bson.ObjectId, bson.M, string, *services.ErrResp) {
+	u := filters.GetUser(req)
+	if projectId := req.QueryParameter("project"); projectId != "" {
+		if !s.IsId(projectId) {
+			return "", nil, "", &services.ErrResp{Code: http.StatusBadRequest, Err: services.IdHexErr}
+		}
+		if sErr := services.Must(services.HasProjectIdPermission(mgr, u, mgr.ToId(projectId))); sErr != nil {
+			return "", nil, "", sErr
+		}
+		return mgr.ToId(projectId), bson.M{"project": mgr.ToId(projectId)}, projectId, nil
+	}
+	if mgr.Permission.IsAdmin(u) {
+		return "", bson.M{}, "all", nil
+	}
+	projects, _, err := mgr.Projects.FilterByQuery(mgr.Projects.AccessQuery(u))
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return "", nil, "", &services.ErrResp{Code: http.StatusInternalServerError, Err: services.DbErr}
+	}
+	ids := make([]bson.ObjectId, 0, len(projects))
+	for _, p := range projects {
+		ids = append(ids, p.Id)
+	}
+	return "", bson.M{"project": bson.M{"$in": ids}}, "user:" + u.Id.Hex(), nil
+}
+
+func parseDate(raw string) (time.Time, error) {
+	if t, err := time.Parse(dateLayout, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return t, fmt.Errorf("should be in form of %s or RFC3339", dateLayout)
+	}
+	return t.UTC(), nil
+}
+
+func (s *StatsService) fill(mgr *manager.Manager, result *stats.Stats, query bson.M, days int) error {
+	var err error
+	result.Created = time.Now().UTC()
+	if result.Issues, err = mgr.Issues.GetStats(query); err != nil {
+		return err
+	}
+	if result.Scans, err = mgr.Scans.CountByStatus(query); err != nil {
+		return err
+	}
+	if result.Targets, err = mgr.Targets.CountActive(query); err != nil {
+		return err
+	}
+	issues, err := mgr.Issues.GetRiskIssues(query, result.Created, result.Created)
+	if err != nil {
+		return err
+	}
+	result.Risk, _ = s.weights.Score(issues, result.Created)
+	// today is included in the trend
+	to := stats.IntervalDay.Next(stats.IntervalDay.Start(result.Created))
+	from := to.AddDate(0, 0, -days)
+	if result.Trend, err = mgr.Issues.GetTrend(query, from, to, stats.IntervalDay); err != nil {
+		return err
+	}
+	result.Plugins, err = mgr.Scans.GetPluginTimings(query, from)
+	return err
+}
+
+func (s *StatsService) writeCached(resp *restful.Response, result interface{}, ttl time.Duration) {
+	if ttl > 0 {
+		resp.AddHeader("Cache-Control", fmt.Sprintf("private, max-age=%d", int(ttl.Seconds())))
+	}
+	resp.WriteEntity(result)
+}
+
+// Cached stats are kept in the store, so dispatchers share them
+func (s *StatsService) getCached(key string, result interface{}) bool {
+	if s.ApiCfg().StatsCacheDuration <= 0 {
+		return false
+	}
+	data, err := s.Store.Get(statsCachePrefix + key)
+	if err != nil {
+		if err != store.ErrNotFound {
+			logrus.Error(stackerr.Wrap(err))
+		}
+		return false
+	}
+	return json.Unmarshal(data, result) == nil
+}
+
+func (s *StatsService) setCached(key string, result interface{}, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return
+	}
+	if err := s.Store.Set(statsCachePrefix+key, data, ttl); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Tags are free-form labels in form of key or key=value, e.g. pci or env=production
+
+const (
+	TagParam          = "tag"
+	TagValueMaxLength = 128
+)
+
+var tagKeyRe = regexp.MustCompile(`^[\w.:-]{1,64}$`)
+
+type TagsEntity struct {
+	Tags []string `json:"tags" description:"tags in form of key or key=value"`
+}
+
+// TagsParam describes query parameter for filtering by tags
+func TagsParam(ws *restful.WebService) *restful.Parameter {
+	return ws.QueryParameter(TagParam, "filter by tag, repeat parameter to require all of the tags").AllowMultiple(true)
+}
+
+// TagsQuery adds tags from request to the query, objects should have all of them
+func TagsQuery(req *restful.Request, query bson.M) {
+	tags := req.Request.URL.Query()[TagParam]
+	switch len(tags) {
+	case 0:
+	case 1:
+		query["tags"] = tags[0]
+	default:
+		query["tags"] = bson.M{"$all": tags}
+	}
+}
+
+// ParseTag trims and checks the tag
+func ParseTag(tag string) (string, error) {
+	tag = strings.TrimSpace(tag)
+	key, value := tag, ""
+	if i := strings.Index(tag, "="); i >= 0 {
+		key, value = tag[:i], tag[i+1:]
+	}
+	if !tagKeyRe.MatchString(key) {
+		return "", fmt.Errorf("tag %q should have key of letters, digits and [_.:-] up to 64 symbols", tag)
+	}
+	if len(value) > TagValueMaxLength {
+		return "", fmt.Errorf("tag %q value is longer than %d symbols", tag, TagValueMaxLength)
+	}
+	return tag, nil
+}
+
+// AddTags merges tags from request body to the existed ones, the result is sorted without duplicates
+func AddTags(req *restful.Request, tags []string) ([]string, *ErrResp) {
+	raw := &TagsEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return nil, &ErrResp{Code: http.StatusBadRequest, Err: WrongEntityErr}
+	}
+	set := map[string]struct{}{}
+	for _, tag := range tags {
+		set[tag] = struct{}{}
+	}
+	for _, tag := range raw.Tags {
+		tag, err := ParseTag(tag)
+		if err != nil {
+			return nil, &ErrResp{Code: http.StatusBadRequest, Err: NewBadReq("%s", err.Error())}
+		}
+		set[tag] = struct{}{}
+	}
+	result := make([]string, 0, len(set))
+	for tag := range set {
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// RemoveTag returns tags without the tag and if the tag was found
+func RemoveTag(tags []string, tag string) ([]string, bool) {
+	result := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t != tag {
+			result = append(result, t)
+		}
+	}
+	return result, len(result) != len(tags)
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTag(t *testing.T) {
+	testData := []struct {
+		tag    string
+		result string
+		valid  bool
+	}{
+		{"pci", "pci", true},
+		{" env=production ", "env=production", true},
+		{"owner=", "owner=", true},
+		{"k8s.io:app-name=web=1", "k8s.io:app-name=web=1", true},
+		{"", "", false},
+		{"=value", "", false},
+		{"with space", "", false},
+		{strings.Repeat("k", 65), "", false},
+		{"key=" + strings.Repeat("v", TagValueMaxLength+1), "", false},
+	}
+	for _, data := range testData {
+		result, err := ParseTag(data.tag)
+		if data.valid {
+			assert.NoError(t, err, data.tag)
+		} else {
+			assert.Error(t, err, data.tag)
+		}
+		assert.Equal(t, data.result, result)
+	}
+}
+
+func TestRemoveTag(t *testing.T) {
+	tags, found := RemoveTag([]string{"a", "b=1", "c"}, "b=1")
+	assert.True(t, found)
+	assert.Equal(t, []string{"a", "c"}, tags)
+
+	tags, found = RemoveTag([]string{"a"}, "b")
+	assert.False(t, found)
+	assert.Equal(t, []string{"a"}, tags)
+}
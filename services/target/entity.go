@@ -19,8 +19,15 @@ type AndroidTargetEntity struct {
 }
 
 type TargetEntity struct {
-	Type    target.TargetType    `json:"type,omitempty" description:"one of [web|android]" create:"nonzero"`
-	Web     *WebTargetEntity     `json:"web,omitempty" description:"information about web target" cweb:"nonzero"`
-	Android *AndroidTargetEntity `json:"android,omitempty" description:"information about android target" cmobile:"nonzero"`
-	Project string               `json:"project,omitempty" create:"nonzero,bsonId"`
+	Type     target.TargetType    `json:"type,omitempty" description:"one of [web|android]" create:"nonzero"`
+	Web      *WebTargetEntity     `json:"web,omitempty" description:"information about web target" cweb:"nonzero"`
+	Android  *AndroidTargetEntity `json:"android,omitempty" description:"information about android target" cmobile:"nonzero"`
+	Project  string               `json:"project,omitempty" create:"nonzero,bsonId"`
+	Windows  []*target.Window     `json:"windows,omitempty" description:"scan windows, send an empty list to remove them, the timezone of the user is used if the window doesn't have one"`
+	Throttle *target.Throttle     `json:"throttle,omitempty" description:"load of plugins on the target, the rate is a hint for plugins, send zero values to remove it"`
+	History  *int                 `json:"history,omitempty" description:"done scans which are kept, zero uses the cap of the project"`
+
+	Compliance []string `json:"compliance,omitempty" description:"compliance frameworks which the target is in scope of, send an empty list to remove them"`
+
+	Version *int `json:"version,omitempty" description:"current target version, required for updates if If-Match header isn't set"`
 }
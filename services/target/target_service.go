@@ -8,16 +8,19 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
 
+	"github.com/bearded-web/bearded/models/audit"
 	"github.com/bearded-web/bearded/models/comment"
+	"github.com/bearded-web/bearded/models/file"
 	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
 	"github.com/bearded-web/bearded/models/target"
 	"github.com/bearded-web/bearded/pkg/filters"
 	"github.com/bearded-web/bearded/pkg/fltr"
 	"github.com/bearded-web/bearded/pkg/manager"
 	"github.com/bearded-web/bearded/pkg/pagination"
 	"github.com/bearded-web/bearded/services"
-	"gopkg.in/validator.v2"
 )
 
 const ParamId = "target-id"
@@ -51,12 +54,14 @@ func (s *TargetService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
-	ws.Filter(filters.AuthRequiredFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
 
 	r := ws.GET("").To(s.list)
 	r.Doc("list")
 	r.Operation("list")
 	s.SetParams(r, fltr.GetParams(ws, manager.TargetFltr{}))
+	r.Param(services.TagsParam(ws))
+	r.Param(services.ComplianceQueryParam(ws))
 	r.Writes(target.TargetList{})
 	r.Do(services.Returns(http.StatusOK))
 	r.Param(s.sorter.Param())
@@ -120,14 +125,67 @@ func (s *TargetService) Register(container *restful.Container) {
 	r.Doc("update")
 	r.Operation("update")
 	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.HeaderParameter(services.IfMatchHeader, "target version, required if version field isn't set"))
 	r.Writes(target.Target{})
 	r.Reads(TargetEntity{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(
+		http.StatusBadRequest,
+		http.StatusConflict,
+		services.StatusPreconditionRequired,
+	))
+	ws.Route(r)
+
+	r = ws.POST(fmt.Sprintf("{%s}/deactivate", ParamId)).To(s.TakeTarget(s.deactivate))
+	r.Doc("deactivate")
+	r.Operation("deactivate")
+	r.Notes("Authorization required. Take the target out of service, it's skipped by bulk scans and counts " +
+		"of active targets, new scans of it aren't allowed. Issues and scans are kept.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Writes(target.Target{})
 	r.Do(services.Returns(
 		http.StatusOK,
 		http.StatusNotFound))
 	r.Do(services.ReturnsE(http.StatusBadRequest))
 	ws.Route(r)
 
+	r = ws.POST(fmt.Sprintf("{%s}/reactivate", ParamId)).To(s.TakeTarget(s.reactivate))
+	r.Doc("reactivate")
+	r.Operation("reactivate")
+	r.Notes("Authorization required. Return the inactive target back to service.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Writes(target.Target{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	r = ws.POST(fmt.Sprintf("{%s}/tags", ParamId)).To(s.TakeTarget(s.tagsAdd))
+	r.Doc("tagsAdd")
+	r.Operation("tagsAdd")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Reads(services.TagsEntity{})
+	r.Writes(target.Target{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	r = ws.DELETE(fmt.Sprintf("{%s}/tags/{%s}", ParamId, services.TagParam)).To(s.TakeTarget(s.tagsDelete))
+	r.Doc("tagsDelete")
+	r.Operation("tagsDelete")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(ws.PathParameter(services.TagParam, ""))
+	r.Writes(target.Target{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	ws.Route(r)
+
 	container.Add(ws)
 }
 
@@ -139,43 +197,34 @@ func (s *TargetService) create(req *restful.Request, resp *restful.Response) {
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
-	if err := validator.WithTag("create").Validate(raw); err != nil {
-		resp.WriteServiceError(
-			http.StatusBadRequest,
-			services.NewBadReq("Validation error: %s", err.Error()),
-		)
+	if sErr := services.Validate(raw, "create"); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 	switch raw.Type {
 	case target.TypeWeb:
-		if err := validator.WithTag("cweb").Validate(raw); err != nil {
-			resp.WriteServiceError(
-				http.StatusBadRequest,
-				services.NewBadReq("Validation error: %s", err.Error()),
-			)
+		if sErr := services.Validate(raw, "cweb"); sErr != nil {
+			sErr.Write(resp)
 			return
 		}
 		addr, err := url.Parse(raw.Web.Domain)
 		if err != nil {
-			resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
 			return
 		}
 		if addr.Scheme == "" || !(addr.Scheme == "http" || addr.Scheme == "https") {
-			resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("scheme must be http or https"))
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("scheme must be http or https"))
 			return
 		}
 		new.Web = &target.WebTarget{
 			Domain: addr.String(),
 		}
 	case target.TypeAndroid:
-		if err := validator.WithTag("cmobile").Validate(raw); err != nil {
-			resp.WriteServiceError(
-				http.StatusBadRequest,
-				services.NewBadReq("Validation error: %s", err.Error()),
-			)
+		if sErr := services.Validate(raw, "cmobile"); sErr != nil {
+			sErr.Write(resp)
 			return
 		}
 
@@ -183,45 +232,77 @@ func (s *TargetService) create(req *restful.Request, resp *restful.Response) {
 			Name: raw.Android.Name,
 		}
 		if raw.Android.File != nil {
-			// TODO (m0sth8): HIGH! check file permissions
 			// TODO (m0sth8): check metadata for files (check if file existed, set true md5, size etc)
 			new.Android.File = raw.Android.File
 		}
 	default:
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("Unknown target type"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Unknown target type"))
 		return
 	}
 	new.Type = raw.Type
-	// TODO (m0sth8): add validation and extract it to manager
-
 	user := filters.GetUser(req)
+	if sErr := validateWindows(raw.Windows, user.Timezone); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	new.Windows = raw.Windows
+	if raw.Throttle != nil {
+		if err := raw.Throttle.Validate(); err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Throttle: %s", err))
+			return
+		}
+		if !raw.Throttle.IsZero() {
+			new.Throttle = raw.Throttle
+		}
+	}
+	if raw.History != nil {
+		if *raw.History < 0 {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("History can't be negative"))
+			return
+		}
+		new.History = *raw.History
+	}
+	if raw.Compliance != nil {
+		frameworks, sErr := services.ParseCompliance(raw.Compliance)
+		if sErr != nil {
+			sErr.Write(resp)
+			return
+		}
+		new.Compliance = frameworks
+	}
+	// TODO (m0sth8): add validation and extract it to manager
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	// TODO (m0sth8): check if the user has permission to add a target to the project
 	proj, err := mgr.Projects.GetById(mgr.ToId(raw.Project))
 	if err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("Project doesn't exist"))
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Project doesn't exist"))
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
-	if !mgr.Permission.HasProjectAccess(proj, user) {
-		logrus.Warnf("User %s try to access to project %s", user, proj)
-		resp.WriteServiceError(http.StatusForbidden, services.AuthForbidErr)
+	if sErr := services.Must(services.HasProjectPermission(mgr, user, proj)); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 	new.Project = proj.Id
+	if new.Android != nil {
+		if sErr := checkFile(mgr, proj.Id, new.Android.File); sErr != nil {
+			sErr.Write(resp)
+			return
+		}
+	}
 
 	obj, err := mgr.Targets.Create(new)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -233,13 +314,30 @@ func (s *TargetService) list(req *restful.Request, resp *restful.Response) {
 	// TODO (m0sth8): HIGH check project existence and permissions
 	query, err := fltr.FromRequest(req, manager.TargetFltr{})
 	if err != nil {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
+		return
+	}
+	services.TagsQuery(req, query)
+	if inactive, ok := query["inactive"]; ok && inactive == false {
+		manager.ActiveQuery(query)
+	}
+	framework, sErr := services.ComplianceFramework(req)
+	if sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
+	if framework != nil {
+		if query, err = mgr.Targets.ComplianceQuery(query, framework.Id); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+	}
+
 	skip, limit := s.Paginator.Parse(req)
 
 	opt := manager.Opts{
@@ -251,7 +349,7 @@ func (s *TargetService) list(req *restful.Request, resp *restful.Response) {
 	results, count, err := mgr.Targets.FilterByQuery(query, opt)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 	previous, next := s.Paginator.Urls(req, skip, limit, count)
@@ -267,12 +365,13 @@ func (s *TargetService) list(req *restful.Request, resp *restful.Response) {
 }
 
 func (s *TargetService) get(_ *restful.Request, resp *restful.Response, obj *target.Target, _ *project.Project) {
+	services.SetVersion(resp, obj.Version)
 	resp.WriteEntity(obj)
 }
 
-func (s *TargetService) delete(_ *restful.Request, resp *restful.Response, obj *target.Target, _ *project.Project) {
+func (s *TargetService) delete(req *restful.Request, resp *restful.Response, obj *target.Target, _ *project.Project) {
 	// TODO (m0sth8): do not remove target, just mark as deleted
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	mgr.Targets.Remove(obj)
@@ -287,54 +386,264 @@ func (s *TargetService) update(req *restful.Request, resp *restful.Response, obj
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if sErr := services.Validate(raw, "update"); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
-	if err := validator.WithTag("update").Validate(raw); err != nil {
-		resp.WriteServiceError(
-			http.StatusBadRequest,
-			services.NewBadReq("Validation error: %s", err.Error()),
-		)
+	// reject changes made to a stale copy of the target
+	if sErr := services.CheckVersion(req, raw.Version, obj.Version); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 	// update file for android target
 	if obj.Type == target.TypeAndroid {
 		if raw.Android != nil && raw.Android.File != nil && raw.Android.File.Id != obj.Android.File.Id {
-			// TODO (m0sth8): HIGH! check file permissions
+			mgr := s.RequestManager(req)
+			sErr := checkFile(mgr, obj.Project, raw.Android.File)
+			mgr.Close()
+			if sErr != nil {
+				sErr.Write(resp)
+				return
+			}
 			obj.Android.File = raw.Android.File
 			updated = true
 		}
 	}
+	if raw.Windows != nil {
+		if sErr := validateWindows(raw.Windows, filters.GetUser(req).Timezone); sErr != nil {
+			sErr.Write(resp)
+			return
+		}
+		obj.Windows = raw.Windows
+		updated = true
+	}
+	if raw.Throttle != nil {
+		if err := raw.Throttle.Validate(); err != nil {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Throttle: %s", err))
+			return
+		}
+		obj.Throttle = raw.Throttle
+		if raw.Throttle.IsZero() {
+			obj.Throttle = nil
+		}
+		updated = true
+	}
+	if raw.History != nil {
+		if *raw.History < 0 {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("History can't be negative"))
+			return
+		}
+		obj.History = *raw.History
+		updated = true
+	}
+	if raw.Compliance != nil {
+		frameworks, sErr := services.ParseCompliance(raw.Compliance)
+		if sErr != nil {
+			sErr.Write(resp)
+			return
+		}
+		obj.Compliance = frameworks
+		updated = true
+	}
 
 	if updated {
-		mgr := s.Manager()
+		mgr := s.RequestManager(req)
 		defer mgr.Close()
 
 		err := mgr.Targets.Update(obj)
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteErrorString(http.StatusNotFound, "Not found")
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+				return
+			}
+			if mgr.IsVersionConflict(err) {
+				services.WriteError(resp, http.StatusConflict, services.VersionErr)
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 	}
 
+	services.SetVersion(resp, obj.Version)
 	resp.WriteEntity(obj)
 
 }
 
-func (s *TargetService) comments(_ *restful.Request, resp *restful.Response, obj *target.Target, _ *project.Project) {
-	mgr := s.Manager()
+// the file should be uploaded by the user or belong to the project already
+func checkFile(mgr *manager.Manager, project bson.ObjectId, meta *file.Meta) *services.ErrResp {
+	if meta == nil {
+		return nil
+	}
+	if err := mgr.Files.CheckProject(project, meta); err != nil {
+		if err == manager.ErrForeignFile {
+			return &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("File not found")}
+		}
+		logrus.Error(stackerr.Wrap(err))
+		return &services.ErrResp{Code: http.StatusInternalServerError, Err: services.DbErr}
+	}
+	return nil
+}
+
+// windows without a timezone get the timezone of the user, so they don't move if the user changes it
+func validateWindows(windows []*target.Window, timezone string) *services.ErrResp {
+	for i, w := range windows {
+		if w == nil {
+			return &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("window %d is empty", i)}
+		}
+		if w.Timezone == "" {
+			w.Timezone = timezone
+		}
+		if err := w.Validate(); err != nil {
+			return &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("window %d: %s", i, err)}
+		}
+	}
+	return nil
+}
+
+func (s *TargetService) deactivate(req *restful.Request, resp *restful.Response, obj *target.Target, p *project.Project) {
+	if obj.Inactive {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("target is already inactive"))
+		return
+	}
+	s.setInactive(req, resp, obj, p, true)
+}
+
+func (s *TargetService) reactivate(req *restful.Request, resp *restful.Response, obj *target.Target, p *project.Project) {
+	if !obj.Inactive {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("target is active"))
+		return
+	}
+	s.setInactive(req, resp, obj, p, false)
+}
+
+func (s *TargetService) setInactive(req *restful.Request, resp *restful.Response, obj *target.Target, p *project.Project, inactive bool) {
+	u := filters.GetUser(req)
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if err := mgr.Targets.SetInactive(obj, inactive); err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		if mgr.IsVersionConflict(err) {
+			services.WriteError(resp, http.StatusConflict, services.VersionErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	ev := &audit.Event{
+		Type:    audit.TypeTargetReactivated,
+		Actor:   u.Id,
+		Project: p.Id,
+		Target:  obj.Id,
+		Message: fmt.Sprintf("User %s reactivated target %s of project %s", u, obj.Id.Hex(), p),
+	}
+	if inactive {
+		ev.Type = audit.TypeTargetDeactivated
+		ev.Message = fmt.Sprintf("User %s deactivated target %s of project %s", u, obj.Id.Hex(), p)
+		s.failPending(mgr, obj)
+	}
+	s.Record(mgr, ev)
+	resp.WriteEntity(obj)
+}
+
+// failPending fails scans of the deactivated target which aren't started yet,
+// so queued ones and ones waiting for the group or the window aren't dispatched later.
+// The target is already deactivated, so errors are only logged.
+func (s *TargetService) failPending(mgr *manager.Manager, obj *target.Target) {
+	scans, err := mgr.Scans.GetPending(obj.Id)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return
+	}
+	groups := map[bson.ObjectId]bool{}
+	for _, sc := range scans {
+		if err := mgr.Scans.Transition(sc, scan.StatusFailed); err != nil {
+			// the scan is started meanwhile
+			if !mgr.IsTransitionErr(err) && !mgr.IsNotFound(err) {
+				logrus.Error(stackerr.Wrap(err))
+			}
+			continue
+		}
+		logrus.Infof("Scan %s is failed, the target %s is deactivated", sc, obj.Id.Hex())
+		if err := s.Scheduler().UpdateScan(sc); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		}
+		if err := mgr.Feed.UpdateScan(sc); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		}
+		if sc.Group != "" {
+			groups[sc.Group] = true
+		}
+	}
+	// other scans of the groups could be started instead of the failed ones
+	if s.Groups == nil {
+		return
+	}
+	for group := range groups {
+		if err := s.Groups.Queue(group); err != nil {
+			logrus.Error(stackerr.Wrap(err))
+		}
+	}
+}
+
+func (s *TargetService) tagsAdd(req *restful.Request, resp *restful.Response, obj *target.Target, _ *project.Project) {
+	tags, sErr := services.AddTags(req, obj.Tags)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	obj.Tags = tags
+	s.saveTags(req, resp, obj)
+}
+
+func (s *TargetService) tagsDelete(req *restful.Request, resp *restful.Response, obj *target.Target, _ *project.Project) {
+	tags, found := services.RemoveTag(obj.Tags, req.PathParameter(services.TagParam))
+	if !found {
+		services.WriteError(resp, http.StatusNotFound, services.NewNotFound("Tag not found"))
+		return
+	}
+	obj.Tags = tags
+	s.saveTags(req, resp, obj)
+}
+
+func (s *TargetService) saveTags(req *restful.Request, resp *restful.Response, obj *target.Target) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if err := mgr.Targets.Update(obj); err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		if mgr.IsVersionConflict(err) {
+			services.WriteError(resp, http.StatusConflict, services.VersionErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.WriteEntity(obj)
+}
+
+func (s *TargetService) comments(req *restful.Request, resp *restful.Response, obj *target.Target, _ *project.Project) {
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	results, count, err := mgr.Comments.FilterBy(&manager.CommentFltr{Type: comment.Scan, Link: obj.Id})
 
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -349,30 +658,31 @@ func (s *TargetService) commentsAdd(req *restful.Request, resp *restful.Response
 	ent := &CommentEntity{}
 	if err := req.ReadEntity(ent); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 
 	if len(ent.Text) == 0 {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("Text is required"))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Text is required"))
 		return
 	}
 
 	u := filters.GetUser(req)
 	raw := &comment.Comment{
-		Owner: u.Id,
-		Type:  comment.Scan,
-		Link:  t.Id,
-		Text:  ent.Text,
+		Owner:   u.Id,
+		Type:    comment.Scan,
+		Link:    t.Id,
+		Project: t.Project,
+		Text:    ent.Text,
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	obj, err := mgr.Comments.Create(raw)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -389,31 +699,31 @@ func (s *TargetService) TakeTarget(fn TargetFunction) restful.RouteFunction {
 		// TODO (m0sth8): check permissions for the user for the project of this target
 		id := req.PathParameter(ParamId)
 		if !s.IsId(id) {
-			resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 			return
 		}
 
-		mgr := s.Manager()
+		mgr := s.RequestManager(req)
 		defer mgr.Close()
 
 		t, err := mgr.Targets.GetById(mgr.ToId(id))
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteErrorString(http.StatusNotFound, "Target not found")
+				services.WriteError(resp, http.StatusNotFound, services.NewNotFound("Target not found"))
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 		p, err := mgr.Projects.GetById(t.Project)
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteErrorString(http.StatusNotFound, "Project not found")
+				services.WriteError(resp, http.StatusNotFound, services.NewNotFound("Project not found"))
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 
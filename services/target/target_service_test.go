@@ -9,12 +9,14 @@ import (
 	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/emicklei/go-restful"
 	c "github.com/smartystreets/goconvey/convey"
 
 	"github.com/bearded-web/bearded/models/file"
 	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
 	"github.com/bearded-web/bearded/models/target"
 	"github.com/bearded-web/bearded/models/user"
 	"github.com/bearded-web/bearded/pkg/config"
@@ -23,6 +25,7 @@ import (
 	"github.com/bearded-web/bearded/pkg/manager"
 	"github.com/bearded-web/bearded/pkg/scheduler"
 	"github.com/bearded-web/bearded/pkg/tests"
+	"github.com/bearded-web/bearded/pkg/utils"
 	"github.com/bearded-web/bearded/services"
 )
 
@@ -98,6 +101,42 @@ func TestTargetService(t *testing.T) {
 					c.So(tgt.Type, c.ShouldEqual, target.TypeWeb)
 					c.So(tgt.Project, c.ShouldEqual, projectObj.Id)
 					c.So(tgt.Web.Domain, c.ShouldEqual, "http://google.com")
+					c.So(tgt.Inactive, c.ShouldBeFalse)
+				})
+				c.Convey("Deactivate and reactivate it", func() {
+					pending, err := testMgr.Scans.Create(&scan.Scan{Status: scan.StatusCreated, Target: tgt.Id, WaitWindow: true})
+					c.So(err, c.ShouldBeNil)
+					working, err := testMgr.Scans.Create(&scan.Scan{Status: scan.StatusWorking, Target: tgt.Id,
+						Dates: scan.Dates{Started: manager.TimeP(time.Now().UTC())}})
+					c.So(err, c.ShouldBeNil)
+
+					res, tgt2, err := setTargetState(ts.URL, testMgr.FromId(tgt.Id), "deactivate")
+					c.So(err, c.ShouldBeNil)
+					c.So(res.StatusCode, c.ShouldEqual, http.StatusOK)
+					c.So(tgt2.Inactive, c.ShouldBeTrue)
+					c.So(tgt2.Deactivated.IsZero(), c.ShouldBeFalse)
+
+					// scans which aren't started are failed, started ones are kept
+					pending, err = testMgr.Scans.GetById(pending.Id)
+					c.So(err, c.ShouldBeNil)
+					c.So(pending.Status, c.ShouldEqual, scan.StatusFailed)
+					working, err = testMgr.Scans.GetById(working.Id)
+					c.So(err, c.ShouldBeNil)
+					c.So(working.Status, c.ShouldEqual, scan.StatusWorking)
+
+					_, active, err := getTargets(ts.URL, url.Values{"inactive": {"false"}})
+					c.So(err, c.ShouldBeNil)
+					for _, obj := range active.Results {
+						c.So(obj.Id, c.ShouldNotEqual, tgt.Id)
+					}
+					res, _, _ = setTargetState(ts.URL, testMgr.FromId(tgt.Id), "deactivate")
+					c.So(res.StatusCode, c.ShouldEqual, http.StatusBadRequest)
+
+					res, tgt2, err = setTargetState(ts.URL, testMgr.FromId(tgt.Id), "reactivate")
+					c.So(err, c.ShouldBeNil)
+					c.So(res.StatusCode, c.ShouldEqual, http.StatusOK)
+					c.So(tgt2.Inactive, c.ShouldBeFalse)
+					c.So(tgt2.Deactivated.IsZero(), c.ShouldBeTrue)
 				})
 			})
 			c.Convey("With bad type", func() {
@@ -108,12 +147,12 @@ func TestTargetService(t *testing.T) {
 			c.Convey("Without web field", func() {
 				te.Web = nil
 				res, _, _ := createTarget(ts.URL, te)
-				shouldBeBadRequest(t, res, services.CodeWrongData, "Validation error: Web: zero value")
+				shouldBeBadRequest(t, res, services.CodeWrongData, "Validation error: web: zero value")
 			})
 			c.Convey("Without domain", func() {
 				te.Web.Domain = ""
 				res, _, _ := createTarget(ts.URL, te)
-				shouldBeBadRequest(t, res, services.CodeWrongData, "Validation error: Web.Domain: zero value")
+				shouldBeBadRequest(t, res, services.CodeWrongData, "Validation error: web.domain: zero value")
 			})
 			c.Convey("With bad domain", func() {
 				te.Web.Domain = "bad domain"
@@ -123,12 +162,12 @@ func TestTargetService(t *testing.T) {
 			c.Convey("Without project id", func() {
 				te.Project = ""
 				res, _, _ := createTarget(ts.URL, te)
-				shouldBeBadRequest(t, res, services.CodeWrongData, "Validation error: Project: zero value")
+				shouldBeBadRequest(t, res, services.CodeWrongData, "Validation error: project: zero value; project: should be bson uuid in hex form")
 			})
 			c.Convey("With bad project id", func() {
 				te.Project = "1234234sdf"
 				res, _, _ := createTarget(ts.URL, te)
-				shouldBeBadRequest(t, res, services.CodeWrongData, "Validation error: Project: should be bson uuid in hex form")
+				shouldBeBadRequest(t, res, services.CodeWrongData, "Validation error: project: should be bson uuid in hex form")
 			})
 			c.Convey("With non existed project id", func() {
 				te.Project = "553a8abcf18c0f18d3000004"
@@ -148,16 +187,25 @@ func TestTargetService(t *testing.T) {
 		})
 
 		c.Convey("Create android target", func() {
+			apk, err := testMgr.Files.Create(bytes.NewBufferString("apk"), &file.Meta{Name: "app.apk", Owner: u.Id})
+			c.So(err, c.ShouldBeNil)
+			apk2, err := testMgr.Files.Create(bytes.NewBufferString("apk2"), &file.Meta{Name: "app2.apk", Owner: u.Id})
+			c.So(err, c.ShouldBeNil)
 			te := &TargetEntity{
 				Type:    target.TypeAndroid,
 				Project: testMgr.FromId(projectObj.Id),
 				Android: &AndroidTargetEntity{
 					Name: "First",
 					File: &file.Meta{
-						Id: "file id",
+						Id: apk.Id,
 					},
 				},
 			}
+			c.Convey("With unknown file", func() {
+				te.Android.File.Id = "file id"
+				res, _, _ := createTarget(ts.URL, te)
+				c.So(res.StatusCode, c.ShouldEqual, http.StatusBadRequest)
+			})
 			c.Convey("With correct data", func() {
 				res, tgt, err := createTarget(ts.URL, te)
 				c.Convey("Successfull", func() {
@@ -166,9 +214,9 @@ func TestTargetService(t *testing.T) {
 					c.So(tgt.Type, c.ShouldEqual, target.TypeAndroid)
 					c.So(tgt.Project, c.ShouldEqual, projectObj.Id)
 					c.So(tgt.Android.Name, c.ShouldEqual, "First")
-					c.So(tgt.Android.File.Id, c.ShouldEqual, "file id")
+					c.So(tgt.Android.File.Id, c.ShouldEqual, apk.Id)
 					c.Convey("Update it with new file", func() {
-						te.Android.File.Id = "file id2"
+						te.Android.File.Id = apk2.Id
 						te.Android.Name = "First2"
 						res, tgt2, err := updateTarget(ts.URL, testMgr.FromId(tgt.Id), te)
 						c.So(err, c.ShouldBeNil)
@@ -176,20 +224,37 @@ func TestTargetService(t *testing.T) {
 						c.So(tgt2.Type, c.ShouldEqual, target.TypeAndroid)
 						c.So(tgt2.Project, c.ShouldEqual, projectObj.Id)
 						c.So(tgt2.Android.Name, c.ShouldEqual, "First")
-						c.So(tgt2.Android.File.Id, c.ShouldEqual, "file id2")
+						c.So(tgt2.Android.File.Id, c.ShouldEqual, apk2.Id)
+						c.So(tgt2.Version, c.ShouldEqual, tgt.Version+1)
 
 					})
+					c.Convey("Update it with stale version", func() {
+						te.Android.File.Id = "file id3"
+						te.Version = utils.IntP(tgt.Version - 1)
+						res, _, err := updateTarget(ts.URL, testMgr.FromId(tgt.Id), te)
+						c.So(err, c.ShouldBeNil)
+						c.So(res.StatusCode, c.ShouldEqual, http.StatusConflict)
+						tgt2, err := testMgr.Targets.GetById(tgt.Id)
+						c.So(err, c.ShouldBeNil)
+						c.So(tgt2.Android.File.Id, c.ShouldEqual, apk.Id)
+					})
+					c.Convey("Update it with unknown file", func() {
+						te.Android.File.Id = "file id4"
+						res, _, err := updateTarget(ts.URL, testMgr.FromId(tgt.Id), te)
+						c.So(err, c.ShouldBeNil)
+						c.So(res.StatusCode, c.ShouldEqual, http.StatusBadRequest)
+					})
 				})
 			})
 			c.Convey("Without name", func() {
 				te.Android.Name = ""
 				res, _, _ := createTarget(ts.URL, te)
-				shouldBeBadRequest(t, res, services.CodeWrongData, "Validation error: Android.Name: zero value")
+				shouldBeBadRequest(t, res, services.CodeWrongData, "Validation error: android.name: zero value")
 			})
 			c.Convey("Without android field", func() {
 				te.Android = nil
 				res, _, _ := createTarget(ts.URL, te)
-				shouldBeBadRequest(t, res, services.CodeWrongData, "Validation error: Android: zero value")
+				shouldBeBadRequest(t, res, services.CodeWrongData, "Validation error: android: zero value")
 			})
 			// TODO(m0sth8): add test for files permission violation
 		})
@@ -237,6 +302,14 @@ func updateTarget(baseUrl string, id string, entity *TargetEntity) (*http.Respon
 	req, _ := http.NewRequest("PUT", u.String(), buf)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
+	if entity.Version == nil {
+		// send the current version, like clients do after reading the target
+		current, err := testMgr.Targets.GetById(testMgr.ToId(id))
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set(services.IfMatchHeader, fmt.Sprintf("%d", current.Version))
+	}
 	resp, err := http.DefaultClient.Do(req)
 	defer resp.Body.Close()
 	if err != nil {
@@ -253,6 +326,25 @@ func updateTarget(baseUrl string, id string, entity *TargetEntity) (*http.Respon
 	return resp, nil, nil
 }
 
+func setTargetState(baseUrl string, id string, action string) (*http.Response, *target.Target, error) {
+	req, _ := http.NewRequest("POST", fmt.Sprintf("%s/api/v1/targets/%s/%s", baseUrl, id, action), nil)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		obj := &target.Target{}
+		err = json.NewDecoder(resp.Body).Decode(obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		return resp, obj, nil
+	}
+	return resp, nil, nil
+}
+
 func createTarget(baseUrl string, entity *TargetEntity) (*http.Response, *target.Target, error) {
 	u, err := url.Parse(fmt.Sprintf("%s/api/v1/targets", baseUrl))
 	if err != nil {
@@ -285,13 +377,13 @@ func shouldBeBadRequest(t *testing.T, res *http.Response, code services.CodeErr,
 	c.Convey("Response should be 400 (Bad request)", func() {
 		c.So(res.StatusCode, c.ShouldEqual, http.StatusBadRequest)
 		e := getServiceError(t, res)
-		c.So(e.Code, c.ShouldEqual, code)
+		c.So(e.Errno, c.ShouldEqual, code)
 		c.So(e.Message, c.ShouldEqual, message)
 	})
 }
 
-func getServiceError(t *testing.T, res *http.Response) *restful.ServiceError {
-	e := &restful.ServiceError{}
+func getServiceError(t *testing.T, res *http.Response) *services.ServiceError {
+	e := &services.ServiceError{}
 	err := json.NewDecoder(res.Body).Decode(e)
 	if err != nil {
 		t.Fatal(err)
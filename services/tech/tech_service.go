@@ -48,7 +48,7 @@ func (s *TechService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
-	ws.Filter(filters.AuthRequiredFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
 
 	r := ws.GET("").To(s.list)
 	addDefaults(r)
@@ -131,7 +131,7 @@ func (s *TechService) Register(container *restful.Container) {
 //
 //	if err := req.ReadEntity(raw); err != nil {
 //		logrus.Error(stackerr.Wrap(err))
-//		resp.WriteServiceError(
+//		services.WriteError(resp,
 //			http.StatusBadRequest,
 //			services.WrongEntityErr,
 //		)
@@ -139,7 +139,7 @@ func (s *TechService) Register(container *restful.Container) {
 //	}
 //	// check target field, it must be present
 //	if !s.IsId(raw.Target) {
-//		resp.WriteServiceError(
+//		services.WriteError(resp,
 //			http.StatusBadRequest,
 //			services.NewBadReq("Target is wrong"),
 //		)
@@ -147,25 +147,25 @@ func (s *TechService) Register(container *restful.Container) {
 //	}
 //	// validate other fields
 //	if err := validator.WithTag("creating").Validate(raw); err != nil {
-//		resp.WriteServiceError(
+//		services.WriteError(resp,
 //			http.StatusBadRequest,
 //			services.NewBadReq("Validation error: %s", err.Error()),
 //		)
 //		return
 //	}
 //
-//	mgr := s.Manager()
+//	mgr := s.RequestManager(req)
 //	defer mgr.Close()
 //
 //	// load target and project
 //	t, err := mgr.Targets.GetById(mgr.ToId(raw.Target))
 //	if err != nil {
 //		if mgr.IsNotFound(err) {
-//			resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("Target not found"))
+//			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("Target not found"))
 //			return
 //		}
 //		logrus.Error(stackerr.Wrap(err))
-//		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+//		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 //		return
 //	}
 //
@@ -187,13 +187,13 @@ func (s *TechService) Register(container *restful.Container) {
 //	obj, err := mgr.Techs.Create(newObj)
 //	if err != nil {
 //		if mgr.IsDup(err) {
-//			resp.WriteServiceError(
+//			services.WriteError(resp,
 //				http.StatusConflict,
 //				services.DuplicateErr)
 //			return
 //		}
 //		logrus.Error(stackerr.Wrap(err))
-//		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+//		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 //		return
 //	}
 //	// TODO (m0sth8): extract to worker
@@ -208,7 +208,7 @@ func (s *TechService) Register(container *restful.Container) {
 //			logrus.Error(stackerr.Wrap(err))
 //			return
 //		}
-//	}(s.Manager())
+//	}(s.BackgroundManager())
 //	resp.WriteHeader(http.StatusCreated)
 //	resp.WriteEntity(obj)
 //}
@@ -217,11 +217,11 @@ func (s *TechService) list(req *restful.Request, resp *restful.Response) {
 	// TODO (m0sth8): show techs only if user has permissions
 	query, err := fltr.FromRequest(req, manager.TechFltr{})
 	if err != nil {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	if search := req.QueryParameter("search"); search != "" {
@@ -240,7 +240,7 @@ func (s *TechService) list(req *restful.Request, resp *restful.Response) {
 	results, count, err := mgr.Techs.FilterByQuery(query, opt)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 	previous, next := s.Paginator.Urls(req, skip, limit, count)
@@ -264,10 +264,10 @@ func (s *TechService) update(req *restful.Request, resp *restful.Response, techO
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	// update tech object from entity
@@ -275,17 +275,17 @@ func (s *TechService) update(req *restful.Request, resp *restful.Response, techO
 
 	if err := mgr.Techs.Update(techObj); err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 			return
 		}
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.DuplicateErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -293,8 +293,8 @@ func (s *TechService) update(req *restful.Request, resp *restful.Response, techO
 	resp.WriteEntity(techObj)
 }
 
-func (s *TechService) delete(_ *restful.Request, resp *restful.Response, obj *tech.TargetTech) {
-	mgr := s.Manager()
+func (s *TechService) delete(req *restful.Request, resp *restful.Response, obj *tech.TargetTech) {
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	mgr.Techs.Remove(obj)
@@ -318,21 +318,21 @@ func (s *TechService) TakeTech(fn func(*restful.Request,
 	return func(req *restful.Request, resp *restful.Response) {
 		id := req.PathParameter(ParamId)
 		if !s.IsId(id) {
-			resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 			return
 		}
 
-		mgr := s.Manager()
+		mgr := s.RequestManager(req)
 		defer mgr.Close()
 
 		obj, err := mgr.Techs.GetById(mgr.ToId(id))
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteErrorString(http.StatusNotFound, "Not found")
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 
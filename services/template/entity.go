@@ -0,0 +1,25 @@
+package template
+
+import (
+	"github.com/bearded-web/bearded/models/scan"
+)
+
+type TemplateEntity struct {
+	Name     string                 `json:"name" description:"template name, 80 symbols max" validate:"nonzero,max=80"`
+	Desc     string                 `json:"desc,omitempty" validate:"max=1024"`
+	Project  string                 `json:"project,omitempty" description:"project which shares the template, global templates are created by admins"`
+	Plan     string                 `json:"plan,omitempty" description:"the default plan of the project if empty, required for global templates"`
+	Plugins  []*scan.TemplatePlugin `json:"plugins,omitempty" description:"config overrides of plan steps by plugin"`
+	Params   map[string]interface{} `json:"params,omitempty" description:"scan conf params for command args and form data of steps"`
+	Scope    *scan.TemplateScope    `json:"scope,omitempty"`
+	Schedule *scan.TemplateSchedule `json:"schedule,omitempty"`
+}
+
+// StartEntity starts the scan of the target from the template, set fields override the template
+type StartEntity struct {
+	Target   string                 `json:"target" validate:"nonzero,bsonId"`
+	Plugins  []*scan.TemplatePlugin `json:"plugins,omitempty" description:"config overrides of plan steps, they replace overrides of the template for the same plugins"`
+	Params   map[string]interface{} `json:"params,omitempty" description:"params which are merged to params of the template"`
+	Scope    *scan.TemplateScope    `json:"scope,omitempty"`
+	Schedule *scan.TemplateSchedule `json:"schedule,omitempty"`
+}
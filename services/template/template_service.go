@@ -0,0 +1,491 @@
+package template
+
+import (
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/project"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/fltr"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/pagination"
+	"github.com/bearded-web/bearded/services"
+	scanService "github.com/bearded-web/bearded/services/scan"
+)
+
+const ParamId = "template-id"
+
+type TemplateService struct {
+	*services.BaseService
+	sorter *fltr.Sorter
+}
+
+func New(base *services.BaseService) *TemplateService {
+	return &TemplateService{
+		BaseService: base,
+		sorter:      fltr.NewSorter("name", "created", "updated"),
+	}
+}
+
+func addDefaults(r *restful.RouteBuilder) {
+	r.Notes("Authorization required")
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusInternalServerError,
+	))
+}
+
+func (s *TemplateService) Register(container *restful.Container) {
+	ws := &restful.WebService{}
+	ws.Path("/api/v1/templates")
+	ws.Doc("Manage Scan Templates")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+
+	r := ws.GET("").To(s.list)
+	r.Doc("list")
+	r.Operation("list")
+	r.Notes("Authorization required. Templates of the project with global ones, only global templates without the project.")
+	s.SetParams(r, fltr.GetParams(ws, manager.TemplateFltr{}))
+	r.Writes(scan.TemplateList{})
+	r.Param(s.sorter.Param())
+	r.Param(s.Paginator.SkipParam())
+	r.Param(s.Paginator.LimitParam())
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	addDefaults(r)
+	ws.Route(r)
+
+	r = ws.POST("").To(s.create)
+	r.Doc("create")
+	r.Operation("create")
+	r.Notes("Authorization required. Admin permission is required for global templates.")
+	r.Reads(TemplateEntity{})
+	r.Writes(scan.Template{})
+	r.Do(services.Returns(http.StatusCreated))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	addDefaults(r)
+	ws.Route(r)
+
+	r = ws.GET(fmt.Sprintf("{%s}", ParamId)).To(s.TakeTemplate(s.get))
+	r.Doc("get")
+	r.Operation("get")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Writes(scan.Template{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	addDefaults(r)
+	ws.Route(r)
+
+	r = ws.PUT(fmt.Sprintf("{%s}", ParamId)).To(s.TakeTemplate(s.update))
+	r.Doc("update")
+	r.Operation("update")
+	r.Notes("Authorization required. Admin permission is required for global templates. The project of the template isn't changed.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Reads(TemplateEntity{})
+	r.Writes(scan.Template{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	addDefaults(r)
+	ws.Route(r)
+
+	r = ws.DELETE(fmt.Sprintf("{%s}", ParamId)).To(s.TakeTemplate(s.delete))
+	r.Doc("delete")
+	r.Operation("delete")
+	r.Notes("Authorization required. Admin permission is required for global templates. Scans keep the template id.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Do(services.Returns(
+		http.StatusNoContent,
+		http.StatusNotFound))
+	addDefaults(r)
+	ws.Route(r)
+
+	r = ws.POST(fmt.Sprintf("{%s}/scans", ParamId)).To(s.TakeTemplate(s.start))
+	r.Doc("start")
+	r.Operation("start")
+	r.Notes("Authorization required. Start the scan of the target with settings of the template, " +
+		"set fields of the body override them. Targets of global templates could be from any available project.")
+	r.Param(ws.PathParameter(ParamId, ""))
+	r.Param(scanService.OverrideParam(ws))
+	r.Reads(StartEntity{})
+	r.Writes(scan.Scan{})
+	r.Do(services.Returns(
+		http.StatusCreated,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	addDefaults(r)
+	ws.Route(r)
+
+	container.Add(ws)
+}
+
+func (s *TemplateService) list(req *restful.Request, resp *restful.Response) {
+	query, err := fltr.FromRequest(req, manager.TemplateFltr{})
+	if err != nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	global := bson.M{"project": bson.M{"$exists": false}}
+	if projectId, ok := query["project"].(bson.ObjectId); ok {
+		if _, sErr := s.takeProject(mgr, req, projectId); sErr != nil {
+			sErr.Write(resp)
+			return
+		}
+		delete(query, "project")
+		query["$or"] = []bson.M{{"project": projectId}, global}
+	} else {
+		query["project"] = global["project"]
+	}
+
+	skip, limit := s.Paginator.Parse(req)
+	opt := manager.Opts{
+		Sort:  s.sorter.Parse(req),
+		Limit: limit,
+		Skip:  skip,
+	}
+	results, count, err := mgr.Templates.FilterByQuery(query, opt)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	previous, next := s.Paginator.Urls(req, skip, limit, count)
+	resp.WriteEntity(&scan.TemplateList{
+		Meta:    pagination.Meta{Count: count, Previous: previous, Next: next},
+		Results: results,
+	})
+}
+
+func (s *TemplateService) create(req *restful.Request, resp *restful.Response) {
+	raw, sErr := s.readEntity(req)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	u := filters.GetUser(req)
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	var p *project.Project
+	if raw.Project != "" {
+		if !s.IsId(raw.Project) {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("project should be an id"))
+			return
+		}
+		if p, sErr = s.takeProject(mgr, req, mgr.ToId(raw.Project)); sErr != nil {
+			sErr.Write(resp)
+			return
+		}
+	} else if !mgr.Permission.IsAdmin(u) {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	obj := &scan.Template{Owner: u.Id}
+	if p != nil {
+		obj.Project = p.Id
+	}
+	if sErr := s.fill(mgr, obj, p, raw); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	obj, err := mgr.Templates.Create(obj)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(obj)
+}
+
+func (s *TemplateService) get(_ *restful.Request, resp *restful.Response, obj *scan.Template) {
+	resp.WriteEntity(obj)
+}
+
+func (s *TemplateService) update(req *restful.Request, resp *restful.Response, obj *scan.Template) {
+	raw, sErr := s.readEntity(req)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	p, sErr := s.takeEditable(mgr, req, obj)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	if sErr := s.fill(mgr, obj, p, raw); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	if err := mgr.Templates.Update(obj); err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+
+	resp.WriteHeader(http.StatusOK)
+	resp.WriteEntity(obj)
+}
+
+func (s *TemplateService) delete(req *restful.Request, resp *restful.Response, obj *scan.Template) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	if _, sErr := s.takeEditable(mgr, req, obj); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	if err := mgr.Templates.Remove(obj); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (s *TemplateService) start(req *restful.Request, resp *restful.Response, obj *scan.Template) {
+	raw := &StartEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
+		return
+	}
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	u := filters.GetUser(req)
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	t, err := mgr.Targets.GetById(mgr.ToId(raw.Target))
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("target not found"))
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	// targets of project templates are checked by their project, so the permission to the template is enough
+	if obj.Project == "" {
+		if sErr := services.Must(services.HasProjectIdPermission(mgr, u, t.Project)); sErr != nil {
+			sErr.Write(resp)
+			return
+		}
+	}
+
+	tmpl := obj.Override(&scan.Template{
+		Plugins:  raw.Plugins,
+		Params:   raw.Params,
+		Scope:    raw.Scope,
+		Schedule: raw.Schedule,
+	})
+	planObj, err := mgr.Plans.GetById(tmpl.Plan)
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("plan of the template not found"))
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	if err := validatePlugins(planObj, raw.Plugins); err != nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
+		return
+	}
+
+	projectId := obj.Project
+	if projectId == "" {
+		projectId = t.Project
+	}
+	sc, sErr := scanService.NewTemplateScan(mgr, u.Id, &scan.Scan{Project: projectId, Target: t.Id, Plan: tmpl.Plan}, tmpl)
+	if sErr != nil {
+		sErr.Write(resp)
+		return
+	}
+	override := req.QueryParameter("override") == "true"
+	if override {
+		logrus.Warnf("Scan windows of target %s are overridden by %s", t.Id.Hex(), u)
+	} else if tmpl.Schedule != nil {
+		override = tmpl.Schedule.Override
+	}
+	logrus.Infof("Scan of target %s is started from template %s by %s", t.Id.Hex(), obj, u)
+	scanService.StartScan(s.BaseService, resp, mgr, sc, override)
+}
+
+// Helpers
+
+func (s *TemplateService) readEntity(req *restful.Request) (*TemplateEntity, *services.ErrResp) {
+	raw := &TemplateEntity{}
+	if err := req.ReadEntity(raw); err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		return nil, &services.ErrResp{Code: http.StatusBadRequest, Err: services.WrongEntityErr}
+	}
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		return nil, sErr
+	}
+	return raw, nil
+}
+
+// fill the template from the entity, the plan is resolved for the project and overrides are checked with its steps
+func (s *TemplateService) fill(mgr *manager.Manager, obj *scan.Template, p *project.Project, raw *TemplateEntity) *services.ErrResp {
+	var planObj *plan.Plan
+	if p != nil {
+		var sErr *services.ErrResp
+		if planObj, sErr = scanService.TakePlan(mgr, p, raw.Plan); sErr != nil {
+			return sErr
+		}
+	} else {
+		if !s.IsId(raw.Plan) {
+			return &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("plan is required for global templates")}
+		}
+		var err error
+		if planObj, err = mgr.Plans.GetById(mgr.ToId(raw.Plan)); err != nil {
+			if mgr.IsNotFound(err) {
+				return &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("plan not found")}
+			}
+			logrus.Error(stackerr.Wrap(err))
+			return &services.ErrResp{Err: services.DbErr}
+		}
+	}
+	if err := validatePlugins(planObj, raw.Plugins); err != nil {
+		return &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq(err.Error())}
+	}
+	obj.Name = raw.Name
+	obj.Desc = raw.Desc
+	obj.Plan = planObj.Id
+	obj.Plugins = raw.Plugins
+	obj.Params = raw.Params
+	obj.Scope = raw.Scope
+	obj.Schedule = raw.Schedule
+	return nil
+}
+
+// validatePlugins checks that overrides are for plugins of plan steps and that their confs are valid templates
+func validatePlugins(planObj *plan.Plan, plugins []*scan.TemplatePlugin) error {
+	steps := map[string]bool{}
+	for _, step := range planObj.Workflow {
+		steps[step.Plugin] = true
+	}
+	seen := map[string]bool{}
+	for _, p := range plugins {
+		if p == nil || p.Plugin == "" {
+			return fmt.Errorf("plugin is required")
+		}
+		if !steps[p.Plugin] {
+			return fmt.Errorf("plan has no steps with the plugin %s", p.Plugin)
+		}
+		if seen[p.Plugin] {
+			return fmt.Errorf("plugin %s is overridden twice", p.Plugin)
+		}
+		seen[p.Plugin] = true
+		if p.Throttle != nil {
+			if err := p.Throttle.Validate(); err != nil {
+				return fmt.Errorf("plugin %s: %s", p.Plugin, err)
+			}
+		}
+		for _, text := range []string{p.CommandArgs, p.FormData} {
+			if _, err := template.New("").Parse(text); err != nil {
+				return fmt.Errorf("plugin %s: wrong template: %s", p.Plugin, err)
+			}
+		}
+	}
+	return nil
+}
+
+// takeProject checks that the project exists and the user has permission to it
+func (s *TemplateService) takeProject(mgr *manager.Manager, req *restful.Request, id bson.ObjectId) (*project.Project, *services.ErrResp) {
+	p, err := mgr.Projects.GetById(id)
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			return nil, &services.ErrResp{Code: http.StatusBadRequest, Err: services.NewBadReq("project not found")}
+		}
+		logrus.Error(stackerr.Wrap(err))
+		return nil, &services.ErrResp{Err: services.DbErr}
+	}
+	if sErr := services.Must(services.HasProjectPermission(mgr, filters.GetUser(req), p)); sErr != nil {
+		return nil, sErr
+	}
+	return p, nil
+}
+
+// takeEditable returns the project of the template, global templates are changed only by admins
+func (s *TemplateService) takeEditable(mgr *manager.Manager, req *restful.Request, obj *scan.Template) (*project.Project, *services.ErrResp) {
+	if obj.Project == "" {
+		if !mgr.Permission.IsAdmin(filters.GetUser(req)) {
+			return nil, &services.ErrResp{Code: http.StatusForbidden, Err: services.AuthForbidErr}
+		}
+		return nil, nil
+	}
+	return s.takeProject(mgr, req, obj.Project)
+}
+
+type TemplateFunction func(*restful.Request, *restful.Response, *scan.Template)
+
+// TakeTemplate takes the template which is available for the user, global templates are available for everyone
+func (s *TemplateService) TakeTemplate(fn TemplateFunction) restful.RouteFunction {
+	return func(req *restful.Request, resp *restful.Response) {
+		id := req.PathParameter(ParamId)
+		if !s.IsId(id) {
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+			return
+		}
+
+		mgr := s.RequestManager(req)
+		defer mgr.Close()
+
+		obj, err := mgr.Templates.GetById(mgr.ToId(id))
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusNotFound, services.NewNotFound("Template not found"))
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		if obj.Project != "" {
+			if sErr := services.Must(services.HasProjectIdPermission(mgr, filters.GetUser(req), obj.Project)); sErr != nil {
+				sErr.Write(resp)
+				return
+			}
+		}
+
+		mgr.Close()
+
+		fn(req, resp, obj)
+	}
+}
@@ -0,0 +1,46 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bearded-web/bearded/models/plan"
+	"github.com/bearded-web/bearded/models/scan"
+	"github.com/bearded-web/bearded/models/target"
+)
+
+func TestValidatePlugins(t *testing.T) {
+	planObj := &plan.Plan{Workflow: []*plan.WorkflowStep{{Plugin: "barbudo/nmap:0.0.1"}, {Plugin: "barbudo/w3af:0.0.1"}}}
+	for _, tc := range []struct {
+		name    string
+		plugins []*scan.TemplatePlugin
+		err     string
+	}{
+		{"no overrides", nil, ""},
+		{"valid", []*scan.TemplatePlugin{
+			{Plugin: "barbudo/nmap:0.0.1", CommandArgs: "-p {{.Params.ports}}"},
+			{Plugin: "barbudo/w3af:0.0.1", Throttle: &target.Throttle{Rate: 1}},
+		}, ""},
+		{"nil plugin", []*scan.TemplatePlugin{nil}, "plugin is required"},
+		{"empty plugin", []*scan.TemplatePlugin{{CommandArgs: "-sV"}}, "plugin is required"},
+		{"plugin without steps", []*scan.TemplatePlugin{{Plugin: "barbudo/wpscan:0.0.1"}},
+			"plan has no steps with the plugin barbudo/wpscan:0.0.1"},
+		{"twice", []*scan.TemplatePlugin{{Plugin: "barbudo/nmap:0.0.1"}, {Plugin: "barbudo/nmap:0.0.1"}},
+			"plugin barbudo/nmap:0.0.1 is overridden twice"},
+		{"negative throttle", []*scan.TemplatePlugin{{Plugin: "barbudo/nmap:0.0.1", Throttle: &target.Throttle{Rate: -1}}},
+			"plugin barbudo/nmap:0.0.1: limits shouldn't be negative"},
+		{"wrong args template", []*scan.TemplatePlugin{{Plugin: "barbudo/nmap:0.0.1", CommandArgs: "{{.Params"}},
+			"plugin barbudo/nmap:0.0.1: wrong template"},
+		{"wrong form data template", []*scan.TemplatePlugin{{Plugin: "barbudo/w3af:0.0.1", FormData: "{{end}}"}},
+			"plugin barbudo/w3af:0.0.1: wrong template"},
+	} {
+		err := validatePlugins(planObj, tc.plugins)
+		if tc.err == "" {
+			require.NoError(t, err, tc.name)
+			continue
+		}
+		require.Error(t, err, tc.name)
+		require.Contains(t, err.Error(), tc.err, tc.name)
+	}
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"golang.org/x/net/context"
+)
+
+// Every api request has a deadline, so slow db queries don't pile up.
+// The deadline is kept in the request attributes, managers from RequestManager give up on it.
+
+const timeoutAttr = "timeout"
+
+type requestTimeout struct {
+	start  time.Time
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// the deadline is counted from the request start, zero timeout means no deadline
+func (t *requestTimeout) set(timeout time.Duration) {
+	if t.cancel != nil {
+		t.cancel()
+	}
+	if timeout > 0 {
+		t.ctx, t.cancel = context.WithDeadline(t.parent, t.start.Add(timeout))
+	} else {
+		t.ctx, t.cancel = context.WithCancel(t.parent)
+	}
+}
+
+// StartTimeout sets the deadline for the request, the returned function must be called when the request is done.
+// Parent context is canceled when the client is gone.
+func StartTimeout(req *restful.Request, parent context.Context, timeout time.Duration) func() {
+	t := &requestTimeout{start: time.Now(), parent: parent}
+	t.set(timeout)
+	req.SetAttribute(timeoutAttr, t)
+	return func() {
+		t.cancel()
+	}
+}
+
+// Timeout is a route filter which overrides the default timeout for known long requests,
+// like reports or bulk operations. Zero timeout disables the deadline, e.g. for streams.
+func Timeout(timeout time.Duration) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		if t, ok := req.Attribute(timeoutAttr).(*requestTimeout); ok {
+			t.set(timeout)
+		}
+		chain.ProcessFilter(req, resp)
+	}
+}
+
+// Context of the request, it's done when the request deadline is passed or the client is disconnected
+func Context(req *restful.Request) context.Context {
+	if t, ok := req.Attribute(timeoutAttr).(*requestTimeout); ok {
+		return t.ctx
+	}
+	return context.Background()
+}
+
+// IsTimeout returns true if the request deadline is passed
+func IsTimeout(req *restful.Request) bool {
+	return Context(req).Err() == context.DeadlineExceeded
+}
@@ -7,8 +7,8 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/facebookgo/stackerr"
-	"gopkg.in/validator.v2"
 
+	"github.com/bearded-web/bearded/models/audit"
 	"github.com/bearded-web/bearded/models/token"
 	"github.com/bearded-web/bearded/pkg/filters"
 	"github.com/bearded-web/bearded/pkg/fltr"
@@ -44,7 +44,7 @@ func (s *TokenService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
-	ws.Filter(filters.AuthRequiredFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
 
 	r := ws.GET("").To(s.list)
 	addDefaults(r)
@@ -56,6 +56,8 @@ func (s *TokenService) Register(container *restful.Container) {
 	ws.Route(r)
 
 	r = ws.POST("").To(s.create)
+	// tokens outlive the session, so they aren't created by impersonating admins
+	r.Filter(filters.ForbidImpersonated)
 	addDefaults(r)
 	r.Doc("create")
 	r.Operation("create")
@@ -64,6 +66,7 @@ func (s *TokenService) Register(container *restful.Container) {
 	r.Do(services.Returns(http.StatusCreated))
 	r.Do(services.ReturnsE(
 		http.StatusBadRequest,
+		http.StatusForbidden,
 	))
 	ws.Route(r)
 
@@ -114,25 +117,27 @@ func (s *TokenService) create(req *restful.Request, resp *restful.Response) {
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(
+		services.WriteError(resp,
 			http.StatusBadRequest,
 			services.WrongEntityErr,
 		)
 		return
 	}
 	// validate fields
-	if err := validator.Validate(raw); err != nil {
-		resp.WriteServiceError(
-			http.StatusBadRequest,
-			services.NewBadReq("Validation error: %s", err.Error()),
-		)
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	u := filters.GetUser(req)
+	// project tokens are managed by the project owner
+	if u.IsService() {
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
 
 	newObj := &token.Token{
 		User: u.Id,
@@ -142,9 +147,20 @@ func (s *TokenService) create(req *restful.Request, resp *restful.Response) {
 	obj, err := mgr.Tokens.Create(newObj)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
+	// tokens of admins have admin permissions
+	if mgr.Permission.IsAdmin(u) {
+		s.Audit(mgr, &audit.Event{
+			Type:    audit.TypeTokenCreated,
+			Actor:   u.Id,
+			User:    u.Id,
+			Token:   obj.Id,
+			Role:    "admin",
+			Message: fmt.Sprintf("Admin %s created token %s", u, obj.Id.Hex()),
+		})
+	}
 	obj.HashValue = obj.Hash // show token hash after creation only
 
 	resp.WriteHeader(http.StatusCreated)
@@ -154,11 +170,11 @@ func (s *TokenService) create(req *restful.Request, resp *restful.Response) {
 func (s *TokenService) list(req *restful.Request, resp *restful.Response) {
 	query, err := fltr.FromRequest(req, manager.TokenFltr{})
 	if err != nil {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	u := filters.GetUser(req)
@@ -171,7 +187,7 @@ func (s *TokenService) list(req *restful.Request, resp *restful.Response) {
 	results, count, err := mgr.Tokens.FilterByQuery(query)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -191,19 +207,16 @@ func (s *TokenService) update(req *restful.Request, resp *restful.Response, toke
 
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 	// validate fields
-	if err := validator.Validate(raw); err != nil {
-		resp.WriteServiceError(
-			http.StatusBadRequest,
-			services.NewBadReq("Validation error: %s", err.Error()),
-		)
+	if sErr := services.Validate(raw, ""); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	// update token object from entity
@@ -213,11 +226,11 @@ func (s *TokenService) update(req *restful.Request, resp *restful.Response, toke
 
 	if err := mgr.Tokens.Update(tokenObj); err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -225,14 +238,14 @@ func (s *TokenService) update(req *restful.Request, resp *restful.Response, toke
 	resp.WriteEntity(tokenObj)
 }
 
-func (s *TokenService) delete(_ *restful.Request, resp *restful.Response, obj *token.Token) {
-	mgr := s.Manager()
+func (s *TokenService) delete(req *restful.Request, resp *restful.Response, obj *token.Token) {
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	err := mgr.Tokens.Remove(obj)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 	resp.WriteHeader(http.StatusNoContent)
@@ -245,27 +258,27 @@ func (s *TokenService) TakeToken(fn func(*restful.Request,
 	return func(req *restful.Request, resp *restful.Response) {
 		id := req.PathParameter(ParamId)
 		if !s.IsId(id) {
-			resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 			return
 		}
 
-		mgr := s.Manager()
+		mgr := s.RequestManager(req)
 		defer mgr.Close()
 
 		obj, err := mgr.Tokens.GetById(mgr.ToId(id))
 		if err != nil {
 			if mgr.IsNotFound(err) {
-				resp.WriteErrorString(http.StatusNotFound, "Not found")
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 				return
 			}
 			logrus.Error(stackerr.Wrap(err))
-			resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 			return
 		}
 		u := filters.GetUser(req)
 
 		if !u.IsAdmin() && (obj.User != u.Id || obj.Removed) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 			return
 		}
 		mgr.Close()
@@ -0,0 +1,245 @@
+package usage
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/bearded-web/bearded/models/usage"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/services"
+)
+
+const (
+	ByRequests = "requests"
+	ByScans    = "scans"
+)
+
+type UsageService struct {
+	*services.BaseService
+}
+
+func New(base *services.BaseService) *UsageService {
+	return &UsageService{
+		BaseService: base,
+	}
+}
+
+func addDefaults(r *restful.RouteBuilder) {
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusInternalServerError,
+	))
+}
+
+func (s *UsageService) Register(container *restful.Container) {
+	ws := &restful.WebService{}
+	ws.Path("/api/v1/usage")
+	ws.Doc("Api usage and quotas of users")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+
+	r := ws.GET("").To(s.get)
+	r.Doc("get")
+	r.Operation("get")
+	addDefaults(r)
+	r.Notes("Authorization required. Requests and scans of the current user in the last hour, day and 30 days " +
+		"with quotas of the day window and requests of its api tokens in the day window, admins can get usage of any user.")
+	r.Param(ws.QueryParameter("user", "user id, available only for admins"))
+	r.Writes(usage.Usage{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(http.StatusBadRequest, http.StatusNotFound))
+	ws.Route(r)
+
+	r = ws.GET("top").To(s.top)
+	r.Doc("top")
+	r.Operation("top")
+	addDefaults(r)
+	r.Notes("Authorization required, available only for admins. Users with the most requests or scans in the window.")
+	r.Param(ws.QueryParameter("window", fmt.Sprintf("one of %v, day by default", usage.Windows)))
+	r.Param(ws.QueryParameter("by", "one of [requests scans], requests by default"))
+	r.Param(s.Paginator.SkipParam())
+	r.Param(s.Paginator.LimitParam())
+	r.Writes(usage.ConsumerList{})
+	r.Do(services.Returns(http.StatusOK))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	container.Add(ws)
+}
+
+func (s *UsageService) get(req *restful.Request, resp *restful.Response) {
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	if raw := req.QueryParameter("user"); raw != "" && raw != u.Id.Hex() {
+		if !s.IsId(raw) {
+			services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+			return
+		}
+		if !mgr.Permission.IsAdmin(u) {
+			logrus.Warnf("User %s try to read usage of another user without admin permission", u)
+			services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+			return
+		}
+		other, err := mgr.Users.GetById(bson.ObjectIdHex(raw))
+		if err != nil {
+			if mgr.IsNotFound(err) {
+				services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+				return
+			}
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		u = other
+	}
+
+	result := &usage.Usage{User: u.Id, Windows: make([]*usage.Counts, 0, len(usage.Windows))}
+	pending := 0
+	if s.Quota != nil {
+		result.Quota = s.Quota.Quota(u)
+		pending = s.Quota.Pending(u.Id)
+	}
+	now := time.Now()
+	for _, w := range usage.Windows {
+		counts, err := mgr.Usage.Count(u.Id, w.Since(now))
+		if err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		counts.Window = w
+		counts.Requests += pending
+		result.Windows = append(result.Windows, counts)
+		if w == usage.WindowDay {
+			result.Remaining = usage.Quota{
+				Requests: remaining(result.Quota.Requests, counts.Requests),
+				Scans:    remaining(result.Quota.Scans, counts.Scans),
+			}
+		}
+	}
+	tokens, err := s.tokens(mgr, u.Id, now)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	result.Tokens = tokens
+	resp.WriteEntity(result)
+}
+
+// requests with tokens of the user in the day window, pending requests are counted too
+func (s *UsageService) tokens(mgr *manager.Manager, userId bson.ObjectId, now time.Time) ([]*usage.TokenCounts, error) {
+	counts, err := mgr.Usage.CountTokens(userId, usage.WindowDay.Since(now))
+	if err != nil {
+		return nil, err
+	}
+	if s.Quota != nil {
+		pending := s.Quota.PendingTokens(userId)
+		for _, c := range counts {
+			c.Requests += pending[c.Token]
+			delete(pending, c.Token)
+		}
+		for id, n := range pending {
+			counts = append(counts, &usage.TokenCounts{Token: id, Requests: n})
+		}
+	}
+	if len(counts) == 0 {
+		return counts, nil
+	}
+	ids := make([]bson.ObjectId, 0, len(counts))
+	for _, c := range counts {
+		ids = append(ids, c.Token)
+	}
+	tokens, _, err := mgr.Tokens.FilterByQuery(bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	names := map[bson.ObjectId]string{}
+	for _, t := range tokens {
+		names[t.Id] = t.Name
+	}
+	for _, c := range counts {
+		c.Name = names[c.Token]
+	}
+	return counts, nil
+}
+
+func (s *UsageService) top(req *restful.Request, resp *restful.Response) {
+	result := &usage.ConsumerList{Window: usage.WindowDay, By: ByRequests, Results: []*usage.Consumer{}}
+	if raw := req.QueryParameter("window"); raw != "" {
+		if result.Window = usage.Window(raw); !result.Window.IsValid() {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("window should be one of %v", usage.Windows))
+			return
+		}
+	}
+	if raw := req.QueryParameter("by"); raw != "" {
+		if raw != ByRequests && raw != ByScans {
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("by should be one of [%s %s]", ByRequests, ByScans))
+			return
+		}
+		result.By = raw
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	u := filters.GetUser(req)
+	if !mgr.Permission.IsAdmin(u) {
+		logrus.Warnf("User %s try to read top consumers without admin permission", u)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	skip, limit := s.Paginator.Parse(req)
+	var err error
+	result.Results, result.Count, err = mgr.Usage.Top(result.Window.Since(time.Now()), result.By, skip, limit)
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	if len(result.Results) > 0 {
+		ids := make([]bson.ObjectId, 0, len(result.Results))
+		for _, c := range result.Results {
+			ids = append(ids, c.User)
+		}
+		users, _, err := mgr.Users.FilterByQuery(bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			logrus.Error(stackerr.Wrap(err))
+			services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+			return
+		}
+		emails := map[bson.ObjectId]string{}
+		for _, other := range users {
+			emails[other.Id] = other.Email
+		}
+		for _, c := range result.Results {
+			c.Email = emails[c.User]
+		}
+	}
+	result.Previous, result.Next = s.Paginator.Urls(req, skip, limit, result.Count)
+	resp.WriteEntity(result)
+}
+
+// remaining usage of the quota, -1 is unlimited
+func remaining(quota, used int) int {
+	if quota <= 0 {
+		return -1
+	}
+	if used >= quota {
+		return 0
+	}
+	return quota - used
+}
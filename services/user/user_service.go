@@ -13,7 +13,6 @@ import (
 	"github.com/bearded-web/bearded/pkg/fltr"
 	"github.com/bearded-web/bearded/pkg/manager"
 	"github.com/bearded-web/bearded/pkg/pagination"
-	"github.com/bearded-web/bearded/pkg/validate"
 	"github.com/bearded-web/bearded/services"
 )
 
@@ -45,7 +44,7 @@ func (s *UserService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
-	ws.Filter(filters.AuthRequiredFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
 
 	r := ws.GET("").To(s.list)
 	r.Doc("list")
@@ -106,11 +105,11 @@ func (s *UserService) list(req *restful.Request, resp *restful.Response) {
 	// TODO (m0sth8): filter by email for admin only
 	query, err := fltr.FromRequest(req, manager.UserFltr{})
 	if err != nil {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	skip, limit := s.Paginator.Parse(req)
@@ -122,7 +121,7 @@ func (s *UserService) list(req *restful.Request, resp *restful.Response) {
 	results, count, err := mgr.Users.FilterByQuery(query, opt)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -139,35 +138,35 @@ func (s *UserService) create(req *restful.Request, resp *restful.Response) {
 	raw := &userEntity{}
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	u := filters.GetUser(req)
 	if !mgr.Permission.IsAdmin(u) {
 		logrus.Warnf("User %s try to create user without admin permission", u)
-		resp.WriteServiceError(http.StatusForbidden, services.AuthForbidErr)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
 		return
 	}
 
 	// check email
 	if valid, err := govalidator.ValidateStruct(raw); !valid {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq(err.Error()))
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq(err.Error()))
 		return
 	}
 	// check password
-	if valid, reason := validate.Password(raw.Password); !valid {
-		resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("Password %s", reason))
+	if sErr := s.CheckPassword("password", raw.Password); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 	// hash password
 	pass, err := s.PassCtx().Encrypt(raw.Password)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.AppErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.AppErr)
 		return
 	}
 
@@ -178,13 +177,13 @@ func (s *UserService) create(req *restful.Request, resp *restful.Response) {
 	})
 	if err != nil {
 		if mgr.IsDup(err) {
-			resp.WriteServiceError(
+			services.WriteError(resp,
 				http.StatusConflict,
 				services.NewError(services.CodeDuplicate, "user with this email is existed"))
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -196,21 +195,21 @@ func (s *UserService) get(req *restful.Request, resp *restful.Response) {
 	// TODO (m0sth8): Check permissions
 	userId := req.PathParameter("user-id")
 	if !s.IsId(userId) {
-		resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+		services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	u, err := mgr.Users.GetById(mgr.ToId(userId))
 	if err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
@@ -221,53 +220,58 @@ func (s *UserService) setPassword(req *restful.Request, resp *restful.Response)
 	// TODO (m0sth8): Check permissions for admins
 	userId := req.PathParameter("user-id")
 	if !s.IsId(userId) {
-		resp.WriteServiceError(http.StatusBadRequest, services.IdHexErr)
+		services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
 		return
 	}
 
 	raw := &passwordEntity{}
 	if err := req.ReadEntity(raw); err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusBadRequest, services.WrongEntityErr)
+		services.WriteError(resp, http.StatusBadRequest, services.WrongEntityErr)
 		return
 	}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	u, err := mgr.Users.GetById(mgr.ToId(userId))
 	if err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
 	currentUser := filters.GetUser(req)
 	if !mgr.Permission.IsAdmin(currentUser) || currentUser.Id != u.Id {
 		logrus.Warnf("User %s try to set password for user %s", currentUser, u)
-		resp.WriteServiceError(http.StatusForbidden, services.AuthForbidErr)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+
+	if sErr := s.CheckPassword("password", raw.Password); sErr != nil {
+		sErr.Write(resp)
 		return
 	}
 
 	pass, err := s.PassCtx().Encrypt(raw.Password)
 	if err != nil {
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.AppErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.AppErr)
 		return
 	}
 	u.Password = pass
 
 	if err := mgr.Users.Update(u); err != nil {
 		if mgr.IsNotFound(err) {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 			return
 		}
 		logrus.Error(stackerr.Wrap(err))
-		resp.WriteServiceError(http.StatusInternalServerError, services.DbErr)
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
 		return
 	}
 
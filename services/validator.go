@@ -3,6 +3,10 @@ package services
 import (
 	"encoding/hex"
 	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
 
 	"gopkg.in/validator.v2"
 )
@@ -29,3 +33,78 @@ func bsonIdValidation(v interface{}, param string) error {
 func init() {
 	validator.SetValidationFunc("bsonId", bsonIdValidation)
 }
+
+// FieldError describes one invalid field of the request entity
+type FieldError struct {
+	Field  string `json:"field" description:"json path to the field, e.g. web.domain"`
+	Reason string `json:"reason"`
+}
+
+// Validate checks the entity using validator rules from the tag ("validate" if tag is empty)
+// and returns bad request with all invalid fields, not only the first one.
+func Validate(entity interface{}, tag string) *ErrResp {
+	if tag == "" {
+		tag = "validate"
+	}
+	err := validator.WithTag(tag).Validate(entity)
+	if err == nil {
+		return nil
+	}
+	errMap, casted := err.(validator.ErrorMap)
+	if !casted {
+		return &ErrResp{Code: http.StatusBadRequest, Err: NewBadReq("Validation error: %s", err.Error())}
+	}
+	return &ErrResp{Code: http.StatusBadRequest, Err: NewValidationErr(entity, errMap)}
+}
+
+// NewValidationErr makes validation error with field details from validator error map
+func NewValidationErr(entity interface{}, errMap validator.ErrorMap) ServiceError {
+	fields := []*FieldError{}
+	for name, errs := range errMap {
+		path := jsonPath(reflect.TypeOf(entity), name)
+		for _, e := range errs {
+			fields = append(fields, &FieldError{Field: path, Reason: e.Error()})
+		}
+	}
+	return NewFieldsErr(fields...)
+}
+
+// NewFieldsErr makes validation error from field errors, the fields are sorted by path
+func NewFieldsErr(fields ...*FieldError) ServiceError {
+	sort.Stable(fieldErrors(fields))
+	reasons := make([]string, 0, len(fields))
+	for _, f := range fields {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", f.Field, f.Reason))
+	}
+	sErr := NewBadReq("Validation error: %s", strings.Join(reasons, "; "))
+	sErr.Fields = fields
+	return sErr
+}
+
+// jsonPath converts dotted path of go struct fields to the path of json names
+func jsonPath(t reflect.Type, name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t == nil || t.Kind() != reflect.Struct {
+			break
+		}
+		field, found := t.FieldByName(part)
+		if !found {
+			break
+		}
+		if jsonName := strings.Split(field.Tag.Get("json"), ",")[0]; jsonName != "" && jsonName != "-" {
+			parts[i] = jsonName
+		}
+		t = field.Type
+	}
+	return strings.Join(parts, ".")
+}
+
+type fieldErrors []*FieldError
+
+func (f fieldErrors) Len() int           { return len(f) }
+func (f fieldErrors) Less(i, j int) bool { return f[i].Field < f[j].Field }
+func (f fieldErrors) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
@@ -37,3 +37,28 @@ func TestBsonIdValidator(t *testing.T) {
 		validator.ErrorMap{"Id": {validator.ErrUnsupported}},
 		tValidator.Validate(c))
 }
+
+func TestValidate(t *testing.T) {
+	type Nested struct {
+		Domain string `json:"domain" creating:"nonzero"`
+	}
+	type Entity struct {
+		Name    string  `json:"name,omitempty" creating:"nonzero"`
+		Project string  `json:"project" creating:"nonzero,bsonId"`
+		Web     *Nested `json:"web"`
+	}
+
+	assert.Nil(t, Validate(&Entity{Name: "name", Project: "123456789012345678901234", Web: &Nested{"a"}}, "creating"))
+
+	sErr := Validate(&Entity{Web: &Nested{}}, "creating")
+	if assert.NotNil(t, sErr) {
+		assert.Equal(t, 400, sErr.Code)
+		e := sErr.Err.(ServiceError)
+		assert.Equal(t, ErrValidation, e.Code)
+		fields := []string{}
+		for _, f := range e.Fields {
+			fields = append(fields, f.Field)
+		}
+		assert.Equal(t, []string{"name", "project", "project", "web.domain"}, fields)
+	}
+}
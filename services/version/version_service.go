@@ -0,0 +1,42 @@
+package version
+
+import (
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+
+	"github.com/bearded-web/bearded/pkg/version"
+	"github.com/bearded-web/bearded/services"
+)
+
+type VersionService struct {
+	*services.BaseService
+}
+
+func New(base *services.BaseService) *VersionService {
+	return &VersionService{
+		BaseService: base,
+	}
+}
+
+func (s *VersionService) Register(container *restful.Container) {
+	ws := &restful.WebService{}
+	ws.Path("/api/version")
+	ws.Doc("Build information of the dispatcher")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+
+	r := ws.GET("").To(s.get)
+	r.Doc("get")
+	r.Operation("get")
+	r.Notes("Version, git commit and build date of the dispatcher, authorization isn't required")
+	r.Writes(version.Info{})
+	r.Do(services.Returns(http.StatusOK))
+	ws.Route(r)
+
+	container.Add(ws)
+}
+
+func (s *VersionService) get(_ *restful.Request, resp *restful.Response) {
+	resp.WriteEntity(version.Get())
+}
@@ -41,17 +41,24 @@ func (s *VulndbService) Register(container *restful.Container) {
 	ws.Consumes(restful.MIME_JSON)
 	ws.Produces(restful.MIME_JSON)
 
+	// vulndb is the same for everyone and read only, so proxies could cache it too
+	cache := services.CacheFor(s.ApiCfg().Caching.Vulndb, true)
+
 	r := ws.GET("").To(s.list)
+	r.Filter(cache)
 	r.Doc("list")
 	r.Operation("list")
 	r.Param(s.Paginator.SkipParam())
 	r.Param(s.Paginator.LimitParam())
+	r.Param(ws.QueryParameter("cwe", "filter by cwe id, like 79"))
+	r.Param(ws.QueryParameter("cve", "filter by cve id, like CVE-2014-6271"))
 	r.Writes(vuln.VulnList{}) // on the response
 	r.Do(services.Returns(http.StatusOK))
 	addDefaults(r)
 	ws.Route(r)
 
 	r = ws.GET(fmt.Sprintf("{%s}", ParamId)).To(s.TakeVuln(s.get))
+	r.Filter(cache)
 	r.Doc("get")
 	r.Operation("get")
 	r.Param(ws.PathParameter(ParamId, ""))
@@ -64,6 +71,7 @@ func (s *VulndbService) Register(container *restful.Container) {
 	ws.Route(r)
 
 	r = ws.GET("compact").To(s.compact)
+	r.Filter(cache)
 	r.Doc("compact list")
 	r.Operation("compact")
 	r.Writes(vuln.CompactVulnList{}) // on the response
@@ -75,10 +83,19 @@ func (s *VulndbService) Register(container *restful.Container) {
 }
 
 func (s *VulndbService) list(req *restful.Request, resp *restful.Response) {
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	results := mgr.Vulndb.GetVulns()
+	if cwe := req.QueryParameter("cwe"); cwe != "" {
+		results = mgr.Vulndb.GetByCwe(cwe)
+	}
+	if cve := req.QueryParameter("cve"); cve != "" {
+		results = intersect(results, mgr.Vulndb.GetByCve(cve))
+	}
+	if results == nil {
+		results = []*vuln.Vuln{}
+	}
 	count := len(results)
 	skip, limit := s.Paginator.Parse(req)
 	if skip < 0 || skip >= count {
@@ -109,7 +126,7 @@ func (s *VulndbService) get(req *restful.Request, resp *restful.Response, v *vul
 func (s *VulndbService) compact(req *restful.Request, resp *restful.Response) {
 	results := []*vuln.CompactVuln{}
 
-	mgr := s.Manager()
+	mgr := s.RequestManager(req)
 	defer mgr.Close()
 
 	for _, vuln := range mgr.Vulndb.GetVulns() {
@@ -125,22 +142,36 @@ func (s *VulndbService) compact(req *restful.Request, resp *restful.Response) {
 
 // Helpers
 
+// vulns of the list which are found in the other one, in the order of the list
+func intersect(list, other []*vuln.Vuln) []*vuln.Vuln {
+	var results []*vuln.Vuln
+	for _, v := range list {
+		for _, o := range other {
+			if v == o {
+				results = append(results, v)
+				break
+			}
+		}
+	}
+	return results
+}
+
 func (s *VulndbService) TakeVuln(fn func(*restful.Request,
 	*restful.Response, *vuln.Vuln)) restful.RouteFunction {
 	return func(req *restful.Request, resp *restful.Response) {
 		idStr := req.PathParameter(ParamId)
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			resp.WriteServiceError(http.StatusBadRequest, services.NewBadReq("id must be int"))
+			services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("id must be int"))
 			return
 		}
 
-		mgr := s.Manager()
+		mgr := s.RequestManager(req)
 		defer mgr.Close()
 
 		obj := mgr.Vulndb.GetById(id)
 		if obj == nil {
-			resp.WriteErrorString(http.StatusNotFound, "Not found")
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
 			return
 		}
 		mgr.Close()
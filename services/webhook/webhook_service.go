@@ -0,0 +1,202 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/emicklei/go-restful"
+	"github.com/facebookgo/stackerr"
+
+	"github.com/bearded-web/bearded/models/webhook"
+	"github.com/bearded-web/bearded/pkg/alert"
+	"github.com/bearded-web/bearded/pkg/filters"
+	"github.com/bearded-web/bearded/pkg/fltr"
+	"github.com/bearded-web/bearded/pkg/manager"
+	"github.com/bearded-web/bearded/pkg/pagination"
+	"github.com/bearded-web/bearded/services"
+)
+
+const (
+	ParamSubscription = "subscription"
+	ParamDelivery     = "delivery-id"
+)
+
+type WebhookService struct {
+	*services.BaseService
+}
+
+func New(base *services.BaseService) *WebhookService {
+	return &WebhookService{
+		BaseService: base,
+	}
+}
+
+func addDefaults(r *restful.RouteBuilder) {
+	r.Notes("Authorization required, available only for admins")
+	r.Do(services.ReturnsE(
+		http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusInternalServerError,
+	))
+}
+
+func (s *WebhookService) Register(container *restful.Container) {
+	ws := &restful.WebService{}
+	ws.Path("/api/v1/webhooks")
+	ws.Doc("Deliveries of alerts to webhooks")
+	ws.Consumes(restful.MIME_JSON)
+	ws.Produces(restful.MIME_JSON)
+	ws.Filter(filters.AuthTokenFilter(s.BaseManager()))
+	ws.Filter(filters.AuthRequiredFilter(s.BaseManager(), s.AuthChecks...))
+	ws.Filter(s.adminFilter)
+
+	r := ws.GET("").To(s.list)
+	addDefaults(r)
+	r.Doc("list")
+	r.Operation("list")
+	r.Writes(webhook.SubscriptionList{})
+	r.Do(services.Returns(http.StatusOK))
+	ws.Route(r)
+
+	r = ws.GET(fmt.Sprintf("{%s}/deliveries", ParamSubscription)).To(s.deliveries)
+	addDefaults(r)
+	r.Doc("deliveries")
+	r.Operation("deliveries")
+	r.Param(ws.PathParameter(ParamSubscription, "event or incident"))
+	s.SetParams(r, fltr.GetParams(ws, manager.DeliveryFltr{}))
+	r.Param(s.Paginator.SkipParam())
+	r.Param(s.Paginator.LimitParam())
+	r.Writes(webhook.DeliveryList{})
+	r.Do(services.Returns(
+		http.StatusOK,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	r = ws.POST(fmt.Sprintf("{%s}/deliveries/{%s}/replay", ParamSubscription, ParamDelivery)).To(s.replay)
+	addDefaults(r)
+	r.Doc("replay")
+	r.Operation("replay")
+	r.Notes("Authorization required, available only for admins. " +
+		"The body of the delivery is posted to the current webhook of the subscription, the new delivery is returned.")
+	r.Param(ws.PathParameter(ParamSubscription, "event or incident"))
+	r.Param(ws.PathParameter(ParamDelivery, ""))
+	r.Writes(webhook.Delivery{})
+	r.Do(services.Returns(
+		http.StatusCreated,
+		http.StatusNotFound))
+	r.Do(services.ReturnsE(http.StatusBadRequest))
+	ws.Route(r)
+
+	container.Add(ws)
+}
+
+func (s *WebhookService) adminFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	u := filters.GetUser(req)
+	if !s.BaseManager().Permission.IsAdmin(u) {
+		logrus.Warnf("User %s try to access webhooks without admin permission", u)
+		services.WriteError(resp, http.StatusForbidden, services.AuthForbidErr)
+		return
+	}
+	chain.ProcessFilter(req, resp)
+}
+
+// alerters which post to webhooks
+func (s *WebhookService) alerters() []*alert.Alerter {
+	result := []*alert.Alerter{}
+	for _, a := range []*alert.Alerter{s.Alerter, s.Incidents.Alerter()} {
+		if a != nil && a.Subscription() != nil {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+func (s *WebhookService) alerter(name string) *alert.Alerter {
+	for _, a := range s.alerters() {
+		if a.Key() == name {
+			return a
+		}
+	}
+	return nil
+}
+
+func (s *WebhookService) list(_ *restful.Request, resp *restful.Response) {
+	results := []*webhook.Subscription{}
+	for _, a := range s.alerters() {
+		results = append(results, a.Subscription())
+	}
+	resp.WriteEntity(&webhook.SubscriptionList{
+		Meta:    pagination.Meta{Count: len(results)},
+		Results: results,
+	})
+}
+
+func (s *WebhookService) deliveries(req *restful.Request, resp *restful.Response) {
+	name := req.PathParameter(ParamSubscription)
+	if s.alerter(name) == nil {
+		services.WriteError(resp, http.StatusNotFound, services.NewNotFound("subscription not found"))
+		return
+	}
+	query, err := fltr.FromRequest(req, manager.DeliveryFltr{})
+	if err != nil {
+		services.WriteError(resp, http.StatusBadRequest, services.NewBadReq("%s", err.Error()))
+		return
+	}
+	query["subscription"] = name
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	skip, limit := s.Paginator.Parse(req)
+	results, count, err := mgr.Webhooks.FilterByQuery(query, mgr.Opts(skip, limit, []string{"-_id"}))
+	if err != nil {
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+
+	previous, next := s.Paginator.Urls(req, skip, limit, count)
+	resp.WriteEntity(&webhook.DeliveryList{
+		Meta:    pagination.Meta{Count: count, Previous: previous, Next: next},
+		Results: results,
+	})
+}
+
+func (s *WebhookService) replay(req *restful.Request, resp *restful.Response) {
+	name := req.PathParameter(ParamSubscription)
+	a := s.alerter(name)
+	if a == nil {
+		services.WriteError(resp, http.StatusNotFound, services.NewNotFound("subscription not found"))
+		return
+	}
+	id := req.PathParameter(ParamDelivery)
+	if !s.IsId(id) {
+		services.WriteError(resp, http.StatusBadRequest, services.IdHexErr)
+		return
+	}
+
+	mgr := s.RequestManager(req)
+	defer mgr.Close()
+
+	orig, err := mgr.Webhooks.GetById(mgr.ToId(id))
+	if err != nil {
+		if mgr.IsNotFound(err) {
+			services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+			return
+		}
+		logrus.Error(stackerr.Wrap(err))
+		services.WriteError(resp, http.StatusInternalServerError, services.DbErr)
+		return
+	}
+	if orig.Subscription != name {
+		services.WriteError(resp, http.StatusNotFound, services.NotFoundErr)
+		return
+	}
+
+	d := a.Replay(orig)
+	logrus.Infof("Delivery %s of %s is replayed by %s: %s", orig.Id.Hex(), name, filters.GetUser(req), d.Status)
+	resp.WriteHeader(http.StatusCreated)
+	resp.WriteEntity(d)
+}